@@ -8,6 +8,7 @@ import kotlinx.coroutines.*
 import org.json.JSONObject
 import java.net.HttpURLConnection
 import java.net.URL
+import java.util.UUID
 
 class NotificationService : NotificationListenerService() {
     
@@ -112,6 +113,8 @@ class NotificationService : NotificationListenerService() {
             connection.apply {
                 requestMethod = "POST"
                 setRequestProperty("Content-Type", "application/json")
+                setRequestProperty("X-Webhook-Timestamp", (System.currentTimeMillis() / 1000).toString())
+                setRequestProperty("X-Webhook-Nonce", UUID.randomUUID().toString())
                 doOutput = true
                 connectTimeout = 5000
                 readTimeout = 5000
@@ -0,0 +1,21 @@
+-- migrations/012_platform_dust_ledger.sql
+-- Platform dust account for rounding remainders on P2P credits
+
+-- Every credit is rounded down to the currency precision; the remainder lands here
+CREATE TABLE IF NOT EXISTS platform_dust_ledger (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    currency VARCHAR(10) NOT NULL,
+    amount DECIMAL(20,8) NOT NULL CHECK (amount > 0),
+    source VARCHAR(50) NOT NULL, -- ESCROW_RELEASE, P2P_CONFIRM
+    reference VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_platform_dust_currency ON platform_dust_ledger(currency);
+CREATE INDEX IF NOT EXISTS idx_platform_dust_reference ON platform_dust_ledger(reference);
+
+-- Running dust balance per currency
+CREATE OR REPLACE VIEW platform_dust_balances AS
+SELECT currency, SUM(amount) AS balance, COUNT(*) AS entries, MAX(created_at) AS last_entry_at
+FROM platform_dust_ledger
+GROUP BY currency;
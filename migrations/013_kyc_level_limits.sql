@@ -0,0 +1,28 @@
+-- migrations/013_kyc_level_limits.sql
+-- Shared KYC level limits, read by the KYC service (advertised) and the wallet service (enforced)
+
+CREATE TABLE IF NOT EXISTS kyc_level_limits (
+    kyc_level INTEGER PRIMARY KEY CHECK (kyc_level >= 0 AND kyc_level <= 4),
+    limit_currency VARCHAR(10) NOT NULL DEFAULT 'BOB',
+    monthly_limit DECIMAL(20,8), -- NULL = no limit
+    daily_limit DECIMAL(20,8),
+    transaction_limit DECIMAL(20,8),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Limits are expressed in BOB; other currencies are converted before comparing.
+-- Unverified accounts (level 0) share the basic limits for now.
+INSERT INTO kyc_level_limits (kyc_level, limit_currency, monthly_limit, daily_limit, transaction_limit) VALUES
+    (0, 'BOB', 10000, 1000, 500),
+    (1, 'BOB', 10000, 1000, 500),
+    (2, 'BOB', 50000, 5000, 2000),
+    (3, 'BOB', NULL, 20000, 10000)
+ON CONFLICT (kyc_level) DO NOTHING;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'update_kyc_level_limits_updated_at') THEN
+        CREATE TRIGGER update_kyc_level_limits_updated_at BEFORE UPDATE ON kyc_level_limits
+            FOR EACH ROW EXECUTE FUNCTION update_updated_at();
+    END IF;
+END $$;
@@ -0,0 +1,27 @@
+-- migrations/014_system_alerts.sql
+-- Central table where background workers report problems for operators
+
+CREATE TABLE IF NOT EXISTS system_alerts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    severity VARCHAR(10) NOT NULL CHECK (severity IN ('INFO', 'WARNING', 'CRITICAL')),
+    source VARCHAR(50) NOT NULL,      -- service/worker that raised the alert
+    alert_type VARCHAR(50) NOT NULL,  -- STUCK_ESCROW, RECONCILIATION_DRIFT, DEAD_LETTER, FRAUD_FLAG, ...
+    dedupe_key VARCHAR(255),          -- repeated detections of the same problem bump occurrences instead of inserting
+    message TEXT NOT NULL,
+    details JSONB DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'OPEN' CHECK (status IN ('OPEN', 'ACKNOWLEDGED', 'RESOLVED')),
+    occurrences INTEGER NOT NULL DEFAULT 1,
+    acknowledged_by UUID REFERENCES users(id),
+    acknowledged_at TIMESTAMP WITH TIME ZONE,
+    resolved_by UUID REFERENCES users(id),
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    resolution_notes TEXT,
+    last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_system_alerts_status ON system_alerts(status, severity);
+CREATE INDEX IF NOT EXISTS idx_system_alerts_created ON system_alerts(created_at DESC);
+
+-- Only one unresolved alert per dedupe key
+CREATE UNIQUE INDEX IF NOT EXISTS idx_system_alerts_open_dedupe ON system_alerts(dedupe_key) WHERE status <> 'RESOLVED';
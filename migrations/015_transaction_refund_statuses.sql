@@ -0,0 +1,10 @@
+-- migrations/015_transaction_refund_statuses.sql
+-- Allow the dispute lifecycle statuses on transactions (DISPUTED on open, REFUNDED on refund)
+
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_status_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_status_check
+    CHECK (status IN ('PENDING', 'PROCESSING', 'COMPLETED', 'FAILED', 'CANCELLED', 'DISPUTED', 'REFUNDED'));
+
+-- One refund per dispute
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_refund_per_dispute
+    ON transactions(external_ref) WHERE transaction_type = 'REFUND';
@@ -0,0 +1,9 @@
+-- migrations/016_dispute_evidence_files.sql
+-- Evidence files uploaded to MinIO: file_path holds the object key in the dispute-evidence bucket
+
+ALTER TABLE dispute_evidence ADD COLUMN IF NOT EXISTS file_hash VARCHAR(64);
+ALTER TABLE dispute_evidence ADD COLUMN IF NOT EXISTS file_size BIGINT;
+ALTER TABLE dispute_evidence ADD COLUMN IF NOT EXISTS mime_type VARCHAR(100);
+ALTER TABLE dispute_evidence ADD COLUMN IF NOT EXISTS original_filename VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_dispute_evidence_dispute ON dispute_evidence(dispute_id);
@@ -0,0 +1,10 @@
+-- migrations/017_dispute_sla.sql
+-- SLA tracking for disputes: the dispute service worker flags disputes left OPEN too long
+
+ALTER TABLE disputes ADD COLUMN IF NOT EXISTS needs_escalation BOOLEAN DEFAULT FALSE;
+ALTER TABLE disputes ADD COLUMN IF NOT EXISTS priority INTEGER DEFAULT 0;
+ALTER TABLE disputes ADD COLUMN IF NOT EXISTS escalated_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_disputes_status_created ON disputes(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_disputes_needs_escalation ON disputes(needs_escalation) WHERE needs_escalation = TRUE;
+CREATE INDEX IF NOT EXISTS idx_disputes_mediator_status ON disputes(mediator_id, status);
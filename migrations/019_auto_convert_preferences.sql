@@ -0,0 +1,12 @@
+-- migrations/019_auto_convert_preferences.sql
+-- Opt-in preference to convert funds received from P2P sells and transfers into a preferred currency
+
+CREATE TABLE IF NOT EXISTS user_auto_convert_preferences (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    target_currency VARCHAR(10) NOT NULL CHECK (target_currency IN ('BOB', 'USD', 'USDT')),
+    max_slippage_percent DECIMAL(5,2) NOT NULL DEFAULT 1.00 CHECK (max_slippage_percent >= 0 AND max_slippage_percent <= 10),
+    min_amount DECIMAL(20,8) NOT NULL DEFAULT 0 CHECK (min_amount >= 0),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
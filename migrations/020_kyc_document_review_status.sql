@@ -0,0 +1,9 @@
+-- migrations/020_kyc_document_review_status.sql
+-- Documents whose OCR confidence is below the threshold are sent to manual review
+
+DO $$
+BEGIN
+    ALTER TABLE kyc_documents DROP CONSTRAINT IF EXISTS kyc_documents_status_check;
+    ALTER TABLE kyc_documents ADD CONSTRAINT kyc_documents_status_check
+        CHECK (status IN ('UPLOADED', 'PROCESSING', 'VERIFIED', 'NEEDS_REVIEW', 'FAILED'));
+END $$;
@@ -0,0 +1,14 @@
+-- migrations/021_sandbox_mode.sql
+-- Sandbox users and orders used for end-to-end trade simulations. They hold fake funds and
+-- are kept out of real cashier queues and market data.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_sandbox BOOLEAN DEFAULT FALSE;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS is_sandbox BOOLEAN DEFAULT FALSE;
+ALTER TABLE p2p_orders ADD COLUMN IF NOT EXISTS is_sandbox BOOLEAN DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_users_sandbox ON users(is_sandbox) WHERE is_sandbox = TRUE;
+CREATE INDEX IF NOT EXISTS idx_orders_sandbox ON orders(is_sandbox) WHERE is_sandbox = TRUE;
+
+-- USDT cashier float used by AcceptOrder/ConfirmPayment for USDT BUY orders
+ALTER TABLE users ADD COLUMN IF NOT EXISTS cashier_balance_usdt DECIMAL(20,8) DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS cashier_locked_usdt DECIMAL(20,8) DEFAULT 0;
@@ -0,0 +1,10 @@
+-- migrations/022_withdrawal_routing.sql
+-- Withdrawals are dispatched to a processor per currency/method; the monitor tracks
+-- external confirmations until the processor reports completion or failure
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS withdrawal_processor VARCHAR(30);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS external_confirmations INTEGER DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_transactions_processing_withdrawals
+    ON transactions(created_at)
+    WHERE transaction_type = 'WITHDRAWAL' AND status = 'PROCESSING';
@@ -0,0 +1,23 @@
+-- migrations/023_kyc_face_verification.sql
+-- Selfie vs CI face matching attempts; a failed match sends the submission to manual review
+
+CREATE TABLE IF NOT EXISTS kyc_face_verifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    submission_id UUID REFERENCES kyc_submissions(id) ON DELETE CASCADE,
+    document_id UUID REFERENCES kyc_documents(id) ON DELETE SET NULL,
+    selfie_path VARCHAR(500) NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    score DECIMAL(5,4) NOT NULL DEFAULT 0,
+    threshold DECIMAL(5,4) NOT NULL,
+    passed BOOLEAN NOT NULL DEFAULT FALSE,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_kyc_face_verifications_user ON kyc_face_verifications(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_kyc_face_verifications_submission ON kyc_face_verifications(submission_id);
+
+ALTER TABLE kyc_submissions ADD COLUMN IF NOT EXISTS face_match_score DECIMAL(5,4);
+ALTER TABLE kyc_submissions ADD COLUMN IF NOT EXISTS face_match_passed BOOLEAN;
+ALTER TABLE kyc_submissions ADD COLUMN IF NOT EXISTS requires_manual_review BOOLEAN DEFAULT FALSE;
@@ -0,0 +1,9 @@
+-- migrations/025_deposit_references.sql
+-- Sequence-backed deposit references so a bank transfer always maps to exactly one deposit
+
+CREATE SEQUENCE IF NOT EXISTS deposit_reference_seq START WITH 1000;
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS deposit_reference VARCHAR(32);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_deposit_reference
+    ON transactions(deposit_reference) WHERE deposit_reference IS NOT NULL;
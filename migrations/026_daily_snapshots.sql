@@ -0,0 +1,10 @@
+-- migrations/026_daily_snapshots.sql
+-- Daily precomputed analytics metrics for trend reports
+
+CREATE TABLE IF NOT EXISTS daily_snapshots (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    snapshot_date DATE NOT NULL UNIQUE,
+    data JSONB NOT NULL,
+    delivered_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,12 @@
+-- migrations/028_cashier_order_limits.sql
+-- Order size range each cashier accepts, per payout currency (max_amount 0 = unbounded)
+
+CREATE TABLE IF NOT EXISTS cashier_order_limits (
+    cashier_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    currency VARCHAR(10) NOT NULL,
+    min_amount DECIMAL(20,8) NOT NULL DEFAULT 0 CHECK (min_amount >= 0),
+    max_amount DECIMAL(20,8) NOT NULL DEFAULT 0 CHECK (max_amount >= 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (cashier_id, currency)
+);
@@ -0,0 +1,21 @@
+-- migrations/029_cashier_shift_holds.sql
+-- Shift-level holds: a cashier locks a working balance upfront and accepted orders draw from it
+
+CREATE TABLE IF NOT EXISTS cashier_shift_holds (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    cashier_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    currency VARCHAR(10) NOT NULL,
+    amount DECIMAL(20,8) NOT NULL CHECK (amount > 0),
+    remaining_amount DECIMAL(20,8) NOT NULL CHECK (remaining_amount >= 0),
+    released_amount DECIMAL(20,8) NOT NULL DEFAULT 0,
+    status VARCHAR(20) NOT NULL DEFAULT 'ACTIVE' CHECK (status IN ('ACTIVE', 'RELEASED')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    released_at TIMESTAMP
+);
+
+-- A cashier has at most one open shift hold per currency
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cashier_shift_holds_active
+    ON cashier_shift_holds(cashier_id, currency) WHERE status = 'ACTIVE';
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shift_hold_id UUID REFERENCES cashier_shift_holds(id);
@@ -0,0 +1,7 @@
+-- migrations/030_chat_message_references.sql
+-- Structured data attached to chat messages (e.g. the order/transaction a REFERENCE message points at)
+
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS metadata JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_chat_messages_reference
+    ON chat_messages((metadata->'reference'->>'id')) WHERE message_type = 'REFERENCE';
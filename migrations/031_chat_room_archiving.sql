@@ -0,0 +1,9 @@
+-- migrations/031_chat_room_archiving.sql
+-- Archiving of abandoned chat rooms; rooms under a legal hold are never archived
+
+ALTER TABLE chat_rooms ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE chat_rooms ADD COLUMN IF NOT EXISTS legal_hold BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE chat_rooms ADD COLUMN IF NOT EXISTS legal_hold_reason TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_chat_rooms_archivable
+    ON chat_rooms(last_message_at) WHERE archived_at IS NULL AND legal_hold = FALSE;
@@ -0,0 +1,11 @@
+-- migrations/032_webhook_nonces.sql
+-- Nonces seen on webhook endpoints, kept for the allowed clock skew to reject replayed calls
+
+CREATE TABLE IF NOT EXISTS webhook_nonces (
+    source VARCHAR(50) NOT NULL,
+    nonce VARCHAR(128) NOT NULL,
+    received_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (source, nonce)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_nonces_received_at ON webhook_nonces(received_at);
@@ -0,0 +1,7 @@
+-- migrations/033_transaction_pins.sql
+-- Transaction PIN required for withdrawals and large transfers, with its own failure lockout
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS transaction_pin_hash TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS transaction_pin_set_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pin_failed_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pin_locked_until TIMESTAMP WITH TIME ZONE;
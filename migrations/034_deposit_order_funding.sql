@@ -0,0 +1,8 @@
+-- migrations/034_deposit_order_funding.sql
+-- Deposits opened for a P2P buy order advance that order once the transfer clears
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS funding_order_id UUID REFERENCES orders(id);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS funding_deposit_id UUID REFERENCES transactions(id);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS funded_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_transactions_funding_order ON transactions(funding_order_id) WHERE funding_order_id IS NOT NULL;
@@ -0,0 +1,15 @@
+-- migrations/035_deposit_account_admin.sql
+-- Deposit accounts are managed from the admin API; only one may be active per currency
+
+ALTER TABLE deposit_accounts ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW();
+
+-- Keep the most recent active account per currency before enforcing uniqueness
+UPDATE deposit_accounts d SET is_active = FALSE
+WHERE d.is_active = TRUE AND EXISTS (
+    SELECT 1 FROM deposit_accounts newer
+    WHERE newer.currency = d.currency AND newer.is_active = TRUE
+        AND (newer.created_at, newer.id::text) > (d.created_at, d.id::text)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_deposit_accounts_one_active
+    ON deposit_accounts(currency) WHERE is_active = TRUE;
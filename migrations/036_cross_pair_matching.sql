@@ -0,0 +1,10 @@
+-- migrations/036_cross_pair_matching.sql
+-- Matches between orders of bridged currencies (e.g. USD against USDT) record the conversion used
+
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS sell_amount DECIMAL(20,8);
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS bridge_from VARCHAR(10);
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS bridge_to VARCHAR(10);
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS bridge_rate DECIMAL(20,8);
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS bridge_spread DECIMAL(10,6);
+
+UPDATE matches SET sell_amount = amount WHERE sell_amount IS NULL;
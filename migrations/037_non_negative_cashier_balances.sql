@@ -0,0 +1,24 @@
+-- migrations/037_non_negative_cashier_balances.sql
+-- Cashier balances can never go negative. Wallet balances are checked since 001, but the cashier
+-- columns on users only get a CHECK when 006 adds them, and 001 (USD) and 021 (USDT) add theirs
+-- without one. They get it here as NOT VALID: new writes are enforced, and rows that are already
+-- negative are left to be corrected by hand.
+
+DO $$
+DECLARE
+    col TEXT;
+BEGIN
+    FOREACH col IN ARRAY ARRAY[
+        'cashier_balance_usd', 'cashier_locked_usd',
+        'cashier_balance_bob', 'cashier_locked_bob',
+        'cashier_balance_usdt', 'cashier_locked_usdt'
+    ] LOOP
+        IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = col)
+            AND NOT EXISTS (
+                SELECT 1 FROM pg_constraint
+                WHERE conrelid = 'users'::regclass AND conname IN ('users_' || col || '_check', 'users_' || col || '_non_negative')
+            ) THEN
+            EXECUTE format('ALTER TABLE users ADD CONSTRAINT %I CHECK (%I >= 0) NOT VALID', 'users_' || col || '_non_negative', col);
+        END IF;
+    END LOOP;
+END $$;
@@ -0,0 +1,17 @@
+-- migrations/038_user_notifications.sql
+-- In-app notifications for traders and cashiers; high-frequency events are stored as periodic digests
+
+CREATE TABLE IF NOT EXISTS user_notifications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id),
+    event_type VARCHAR(30) NOT NULL,
+    message TEXT NOT NULL,
+    data JSONB DEFAULT '{}',
+    event_count INTEGER NOT NULL DEFAULT 1,
+    is_digest BOOLEAN NOT NULL DEFAULT FALSE,
+    read_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_notifications_user ON user_notifications(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_user_notifications_unread ON user_notifications(user_id) WHERE read_at IS NULL;
@@ -0,0 +1,14 @@
+-- migrations/039_withdrawal_approvals.sql
+-- Large withdrawals wait in PENDING_APPROVAL (funds locked) until an admin approves or rejects them
+
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_status_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_status_check
+    CHECK (status IN ('PENDING', 'PROCESSING', 'COMPLETED', 'FAILED', 'CANCELLED', 'DISPUTED', 'REFUNDED',
+                      'PENDING_APPROVAL', 'REJECTED'));
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reviewed_by UUID REFERENCES users(id);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reviewed_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_transactions_pending_approval
+    ON transactions(created_at)
+    WHERE transaction_type = 'WITHDRAWAL' AND status = 'PENDING_APPROVAL';
@@ -0,0 +1,25 @@
+-- migrations/040_order_timeout_disputes.sql
+-- Orders left in PROCESSING past the timeout move to DISPUTED and get a dispute linked to the order
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS marked_paid_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('ACTIVE', 'PARTIALLY_FILLED', 'FILLED', 'PARTIAL', 'CANCELLED', 'EXPIRED',
+                      'PENDING', 'MATCHED', 'PROCESSING', 'COMPLETED', 'DISPUTED'));
+
+ALTER TABLE p2p_orders DROP CONSTRAINT IF EXISTS p2p_orders_status_check;
+ALTER TABLE p2p_orders ADD CONSTRAINT p2p_orders_status_check
+    CHECK (status IN ('ACTIVE', 'PARTIALLY_FILLED', 'FILLED', 'PARTIAL', 'CANCELLED', 'EXPIRED',
+                      'PENDING', 'MATCHED', 'PROCESSING', 'COMPLETED', 'DISPUTED'));
+
+ALTER TABLE disputes ADD COLUMN IF NOT EXISTS order_id UUID REFERENCES orders(id);
+ALTER TABLE disputes ADD COLUMN IF NOT EXISTS auto_created BOOLEAN DEFAULT FALSE;
+
+-- One unresolved dispute per order
+CREATE UNIQUE INDEX IF NOT EXISTS idx_disputes_active_order
+    ON disputes(order_id) WHERE order_id IS NOT NULL AND status NOT IN ('RESOLVED', 'CLOSED');
+
+CREATE INDEX IF NOT EXISTS idx_orders_processing_since
+    ON orders(COALESCE(marked_paid_at, updated_at))
+    WHERE status = 'PROCESSING';
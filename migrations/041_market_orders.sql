@@ -0,0 +1,11 @@
+-- migrations/041_market_orders.sql
+-- Order kind: LIMIT orders wait for a cashier at their rate, MARKET orders are filled at once against the book
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS order_kind VARCHAR(10) NOT NULL DEFAULT 'LIMIT';
+ALTER TABLE p2p_orders ADD COLUMN IF NOT EXISTS order_kind VARCHAR(10) NOT NULL DEFAULT 'LIMIT';
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_order_kind_check;
+ALTER TABLE orders ADD CONSTRAINT orders_order_kind_check CHECK (order_kind IN ('LIMIT', 'MARKET'));
+
+ALTER TABLE p2p_orders DROP CONSTRAINT IF EXISTS p2p_orders_order_kind_check;
+ALTER TABLE p2p_orders ADD CONSTRAINT p2p_orders_order_kind_check CHECK (order_kind IN ('LIMIT', 'MARKET'));
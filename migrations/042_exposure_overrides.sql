@@ -0,0 +1,17 @@
+-- migrations/042_exposure_overrides.sql
+-- Admin overrides letting a user's withdrawals and transfers through the daily exposure limits until they expire
+
+CREATE TABLE IF NOT EXISTS exposure_overrides (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id),
+    granted_by UUID NOT NULL REFERENCES users(id),
+    reason TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_by UUID REFERENCES users(id),
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_exposure_overrides_active
+    ON exposure_overrides(user_id, expires_at)
+    WHERE revoked_at IS NULL;
@@ -0,0 +1,22 @@
+-- migrations/043_dead_letters.sql
+-- Bank notifications and withdrawals that failed processing, with their error history, for operators to replay or discard
+
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    source VARCHAR(30) NOT NULL CHECK (source IN ('BANK_NOTIFICATION', 'TRANSACTION')),
+    item_id VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'RETRYING'
+        CHECK (status IN ('RETRYING', 'PARKED', 'REPLAYING', 'RECOVERED', 'REPLAYED', 'DISCARDED')),
+    attempts INTEGER NOT NULL DEFAULT 1,
+    last_error TEXT NOT NULL,
+    errors JSONB NOT NULL DEFAULT '[]',
+    resolved_by UUID REFERENCES users(id),
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    resolution_notes TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (source, item_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_dead_letters_status ON dead_letters(status, created_at);
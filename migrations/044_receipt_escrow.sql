@@ -0,0 +1,20 @@
+-- migrations/044_receipt_escrow.sql
+-- Orders of the flows that require the user's receipt confirmation wait in AWAITING_RECEIPT with both sides' funds locked
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS escrowed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS receipt_deadline TIMESTAMP WITH TIME ZONE;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS receipt_confirmed_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('ACTIVE', 'PARTIALLY_FILLED', 'FILLED', 'PARTIAL', 'CANCELLED', 'EXPIRED',
+                      'PENDING', 'MATCHED', 'PROCESSING', 'AWAITING_RECEIPT', 'COMPLETED', 'DISPUTED'));
+
+ALTER TABLE p2p_orders DROP CONSTRAINT IF EXISTS p2p_orders_status_check;
+ALTER TABLE p2p_orders ADD CONSTRAINT p2p_orders_status_check
+    CHECK (status IN ('ACTIVE', 'PARTIALLY_FILLED', 'FILLED', 'PARTIAL', 'CANCELLED', 'EXPIRED',
+                      'PENDING', 'MATCHED', 'PROCESSING', 'AWAITING_RECEIPT', 'COMPLETED', 'DISPUTED'));
+
+CREATE INDEX IF NOT EXISTS idx_orders_receipt_deadline
+    ON orders(receipt_deadline)
+    WHERE status = 'AWAITING_RECEIPT';
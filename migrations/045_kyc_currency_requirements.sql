@@ -0,0 +1,24 @@
+-- migrations/045_kyc_currency_requirements.sql
+-- Minimum KYC level to deposit, withdraw, transfer or trade each currency, read by the KYC service (advertised) and the wallet and p2p services (enforced)
+
+CREATE TABLE IF NOT EXISTS kyc_currency_requirements (
+    currency VARCHAR(10) PRIMARY KEY,
+    min_kyc_level INTEGER NOT NULL DEFAULT 0 CHECK (min_kyc_level >= 0 AND min_kyc_level <= 4),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Fiat stays open to every verified level; crypto needs the selfie and proof of address of level 2.
+-- Currencies without a row have no minimum.
+INSERT INTO kyc_currency_requirements (currency, min_kyc_level) VALUES
+    ('BOB', 0),
+    ('USD', 0),
+    ('USDT', 2)
+ON CONFLICT (currency) DO NOTHING;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'update_kyc_currency_requirements_updated_at') THEN
+        CREATE TRIGGER update_kyc_currency_requirements_updated_at BEFORE UPDATE ON kyc_currency_requirements
+            FOR EACH ROW EXECUTE FUNCTION update_updated_at();
+    END IF;
+END $$;
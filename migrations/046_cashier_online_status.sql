@@ -0,0 +1,7 @@
+-- migrations/046_cashier_online_status.sql
+-- Whether a cashier is taking orders; the p2p service treats them as online while this is set and their Redis heartbeat has not expired
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_available BOOLEAN DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS availability_changed_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_users_available_cashiers ON users(id) WHERE is_cashier = true AND is_available = true;
@@ -0,0 +1,5 @@
+-- migrations/047_seller_escrow.sql
+-- SELL orders lock the seller's amount in their wallet when a cashier accepts them; remember how much was locked
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS seller_locked_amount DECIMAL(20,8);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS seller_locked_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,22 @@
+-- migrations/048_cashier_suspensions.sql
+-- Cashiers whose dispute rate or rating cross the policy thresholds are suspended from accepting orders until an admin lifts it
+
+CREATE TABLE IF NOT EXISTS cashier_suspensions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    cashier_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    orders_count INTEGER NOT NULL DEFAULT 0,
+    disputed_count INTEGER NOT NULL DEFAULT 0,
+    dispute_rate DECIMAL(5,2),
+    avg_rating DECIMAL(3,2),
+    suspended_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    lifted_at TIMESTAMP WITH TIME ZONE,
+    lifted_by UUID REFERENCES users(id),
+    lift_note TEXT
+);
+
+-- A cashier has at most one suspension in force
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cashier_suspensions_active
+    ON cashier_suspensions(cashier_id) WHERE lifted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_cashier_suspensions_cashier ON cashier_suspensions(cashier_id, suspended_at DESC);
@@ -0,0 +1,4 @@
+-- migrations/049_order_disputes.sql
+-- Users open disputes on P2P orders directly; remember the status an order was disputed from so resolution hands it back there
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS disputed_from_status VARCHAR(20);
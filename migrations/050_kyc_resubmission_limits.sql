@@ -0,0 +1,18 @@
+-- migrations/050_kyc_resubmission_limits.sql
+-- Number each KYC attempt so repeat applicants can be flagged, and let admins allow a resubmission past the rejection limits
+
+ALTER TABLE kyc_submissions ADD COLUMN IF NOT EXISTS attempt_number INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS kyc_resubmission_overrides (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    granted_by UUID REFERENCES users(id),
+    reason TEXT NOT NULL,
+    granted_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    used_at TIMESTAMP WITH TIME ZONE,
+    submission_id UUID
+);
+
+-- A user has at most one unused override
+CREATE UNIQUE INDEX IF NOT EXISTS idx_kyc_resubmission_overrides_open
+    ON kyc_resubmission_overrides(user_id) WHERE used_at IS NULL;
@@ -0,0 +1,19 @@
+-- migrations/051_kyc_document_expiry.sql
+-- Track when KYC documents expire; approvals whose documents lapse are marked KYC_EXPIRED and the user is downgraded until re-verified
+
+ALTER TABLE kyc_submissions ADD COLUMN IF NOT EXISTS document_expires_at DATE;
+ALTER TABLE kyc_submissions ADD COLUMN IF NOT EXISTS expired_at TIMESTAMPTZ;
+ALTER TABLE kyc_documents ADD COLUMN IF NOT EXISTS expires_at DATE;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS kyc_expired_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS kyc_level_before_expiry INTEGER;
+
+DO $$
+BEGIN
+    ALTER TABLE kyc_submissions DROP CONSTRAINT IF EXISTS kyc_submissions_status_check;
+    ALTER TABLE kyc_submissions ADD CONSTRAINT kyc_submissions_status_check
+        CHECK (status IN ('PENDING', 'APPROVED', 'REJECTED', 'UNDER_REVIEW', 'KYC_EXPIRED'));
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_kyc_submissions_document_expiry
+    ON kyc_submissions(document_expires_at) WHERE status = 'APPROVED';
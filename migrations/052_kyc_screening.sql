@@ -0,0 +1,26 @@
+-- migrations/052_kyc_screening.sql
+-- Sanctions and PEP lists KYC submissions are screened against, and the screening outcome of each submission
+
+CREATE TABLE IF NOT EXISTS kyc_screening_entries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    list_name VARCHAR(100) NOT NULL,
+    category VARCHAR(20) NOT NULL CHECK (category IN ('SANCTIONS', 'PEP')),
+    full_name TEXT NOT NULL,
+    -- Upper-cased words of the name without accents, as the KYC service normalizes names
+    name_tokens TEXT[] GENERATED ALWAYS AS (
+        array_remove(regexp_split_to_array(
+            translate(upper(full_name), 'ÁÉÍÓÚÜÑ', 'AEIOUUN'), '[^A-Z]+'), '')
+    ) STORED,
+    ci_number VARCHAR(20),
+    country VARCHAR(2),
+    active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_kyc_screening_entries_tokens ON kyc_screening_entries USING GIN (name_tokens) WHERE active;
+CREATE INDEX IF NOT EXISTS idx_kyc_screening_entries_ci ON kyc_screening_entries(ci_number) WHERE active;
+
+ALTER TABLE kyc_submissions ADD COLUMN IF NOT EXISTS screening_status VARCHAR(20);
+ALTER TABLE kyc_submissions ADD COLUMN IF NOT EXISTS screening_matches JSONB;
+ALTER TABLE kyc_submissions ADD COLUMN IF NOT EXISTS screening_provider VARCHAR(50);
+ALTER TABLE kyc_submissions ADD COLUMN IF NOT EXISTS screened_at TIMESTAMPTZ;
@@ -0,0 +1,8 @@
+-- migrations/053_admin_audit_log.sql
+-- Record which service wrote each audit entry and index audit_logs for the admin audit log filters
+
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS service VARCHAR(30);
+
+CREATE INDEX IF NOT EXISTS idx_audit_logs_created ON audit_logs(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_action_created ON audit_logs(action, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_user_created ON audit_logs(user_id, created_at DESC);
@@ -0,0 +1,9 @@
+-- migrations/054_account_closure.sql
+-- Users can close their account: the user row is kept for compliance with its PII anonymized and login disabled
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS closed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS closure_reason TEXT;
+-- SHA-256 of the email the account had, so compliance can still find a closed account by email
+ALTER TABLE users ADD COLUMN IF NOT EXISTS closed_email_hash VARCHAR(64);
+
+CREATE INDEX IF NOT EXISTS idx_users_closed ON users(closed_at DESC) WHERE closed_at IS NOT NULL;
@@ -0,0 +1,15 @@
+-- migrations/055_chat_message_edits.sql
+-- Senders can edit their chat messages for a short while and delete them; deleted messages stay as tombstones
+
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- Every previous version of an edited message, for audits and disputes
+CREATE TABLE IF NOT EXISTS chat_message_edits (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    message_id UUID NOT NULL REFERENCES chat_messages(id) ON DELETE CASCADE,
+    previous_content TEXT NOT NULL,
+    edited_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_message_edits_message ON chat_message_edits(message_id, edited_at);
@@ -0,0 +1,11 @@
+-- migrations/056_order_size_limits.sql
+-- Smallest and largest P2P order per currency, kept next to the KYC level needed to trade it; NULL = no bound
+
+ALTER TABLE kyc_currency_requirements ADD COLUMN IF NOT EXISTS min_order_amount DECIMAL(20,8);
+ALTER TABLE kyc_currency_requirements ADD COLUMN IF NOT EXISTS max_order_amount DECIMAL(20,8);
+
+UPDATE kyc_currency_requirements SET min_order_amount = 10, max_order_amount = 70000
+WHERE currency = 'BOB' AND min_order_amount IS NULL AND max_order_amount IS NULL;
+
+UPDATE kyc_currency_requirements SET min_order_amount = 1, max_order_amount = 10000
+WHERE currency IN ('USD', 'USDT') AND min_order_amount IS NULL AND max_order_amount IS NULL;
@@ -0,0 +1,5 @@
+-- migrations/057_market_trades_indexes.sql
+-- Serve the public trade history and ticker: recent matches by time, then the pair of their buy order
+
+CREATE INDEX IF NOT EXISTS idx_matches_created_at ON matches(created_at DESC, buy_order_id);
+CREATE INDEX IF NOT EXISTS idx_orders_pair_created_at ON orders(currency_from, currency_to, created_at DESC);
@@ -0,0 +1,12 @@
+-- migrations/058_transaction_tags.sql
+-- Free-form tags users put on their transactions; each party of a transaction keeps its own tags
+
+CREATE TABLE IF NOT EXISTS transaction_tags (
+    transaction_id UUID NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id),
+    tag VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (transaction_id, user_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_transaction_tags_user_tag ON transaction_tags(user_id, tag);
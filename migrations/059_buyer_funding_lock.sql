@@ -0,0 +1,4 @@
+-- migrations/059_buyer_funding_lock.sql
+-- BUY orders funded by a deposit lock the buyer's cost in their wallet; remember how much was locked
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS buyer_locked_amount DECIMAL(20,8);
@@ -0,0 +1,94 @@
+// services/analytics/cache.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Dashboard responses are cached in Redis for ANALYTICS_CACHE_TTL (a Go duration, default 60s;
+// 0 disables caching) keyed by route and query string. ?refresh=true recomputes and re-caches.
+
+const defaultAnalyticsCacheTTL = time.Minute
+
+var analyticsCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "analytics_cache_requests_total",
+	Help: "Analytics dashboard cache lookups, by endpoint and result (hit, miss, bypass).",
+}, []string{"endpoint", "result"})
+
+func analyticsCacheTTL() time.Duration {
+	value := os.Getenv("ANALYTICS_CACHE_TTL")
+	if value == "" {
+		return defaultAnalyticsCacheTTL
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		log.Printf("⚠️ Invalid ANALYTICS_CACHE_TTL %q, using %s", value, defaultAnalyticsCacheTTL)
+		return defaultAnalyticsCacheTTL
+	}
+	return ttl
+}
+
+// analyticsCacheKey identifies a response by route and query, ignoring refresh
+func analyticsCacheKey(c *gin.Context) string {
+	query := c.Request.URL.Query()
+	query.Del("refresh")
+	return fmt.Sprintf("analytics:cache:%s?%s", c.FullPath(), query.Encode())
+}
+
+// cachedJSON serves compute's result from the cache when possible. A compute error is answered
+// with 500 and errorMessage and never cached.
+func (s *Server) cachedJSON(c *gin.Context, errorMessage string, compute func() (interface{}, error)) {
+	endpoint := c.FullPath()
+	key := analyticsCacheKey(c)
+	ctx := context.Background()
+	cacheable := s.redis != nil && s.cacheTTL > 0
+
+	if cacheable && c.Query("refresh") != "true" {
+		payload, err := s.redis.Get(ctx, key).Bytes()
+		if err == nil {
+			analyticsCacheRequests.WithLabelValues(endpoint, "hit").Inc()
+			c.Header("X-Cache", "HIT")
+			c.Data(http.StatusOK, "application/json; charset=utf-8", payload)
+			return
+		}
+		if err != redis.Nil {
+			requestLog(c).Printf("⚠️ Analytics cache read failed for %s: %v", key, err)
+		}
+		analyticsCacheRequests.WithLabelValues(endpoint, "miss").Inc()
+		c.Header("X-Cache", "MISS")
+	} else {
+		analyticsCacheRequests.WithLabelValues(endpoint, "bypass").Inc()
+		c.Header("X-Cache", "BYPASS")
+	}
+
+	result, err := compute()
+	if err != nil {
+		requestLog(c).Printf("❌ %s: %v", errorMessage, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errorMessage})
+		return
+	}
+
+	payload, err := json.Marshal(result)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errorMessage})
+		return
+	}
+
+	if cacheable {
+		if err := s.redis.Set(ctx, key, payload, s.cacheTTL).Err(); err != nil {
+			requestLog(c).Printf("⚠️ Analytics cache write failed for %s: %v", key, err)
+		}
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", payload)
+}
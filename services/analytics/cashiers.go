@@ -0,0 +1,192 @@
+// services/analytics/cashiers.go
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cross-cashier view for admins: completed orders, volume per currency, average completion time,
+// completion rate and current rating of every cashier over a period (all time by default).
+// Assignments come from cashier_order_assignments, falling back to orders.cashier_id for orders
+// accepted before assignments were recorded. The current rating is the latest daily rating in
+// cashier_metrics. Volumes are summed in Postgres and returned as strings.
+
+type CashierStats struct {
+	CashierID            string            `json:"cashier_id"`
+	Email                string            `json:"email"`
+	AssignedOrders       int               `json:"assigned_orders"`
+	CompletedOrders      int               `json:"completed_orders"`
+	CompletionRate       float64           `json:"completion_rate"`
+	AvgCompletionMinutes *float64          `json:"avg_completion_minutes"`
+	Volume               map[string]string `json:"volume"`
+	Rating               *float64          `json:"rating"`
+}
+
+// Sort keys accepted by ?sort=; volume is sorted in the currency given by ?currency= (BOB by default)
+var cashierSortKeys = map[string]bool{
+	"completed_orders":       true,
+	"volume":                 true,
+	"avg_completion_minutes": true,
+	"completion_rate":        true,
+	"rating":                 true,
+}
+
+const cashierStatsQuery = `
+	WITH handled AS (
+		SELECT a.cashier_id, o.id, o.status, o.currency_from, o.amount,
+			COALESCE(a.assigned_at, o.accepted_at) AS started_at,
+			COALESCE(a.completed_at, o.updated_at) AS finished_at
+		FROM cashier_order_assignments a
+		JOIN orders o ON o.id = a.order_id
+		WHERE COALESCE(o.is_sandbox, false) = false
+		UNION
+		SELECT o.cashier_id, o.id, o.status, o.currency_from, o.amount, o.accepted_at, o.updated_at
+		FROM orders o
+		WHERE o.cashier_id IS NOT NULL AND COALESCE(o.is_sandbox, false) = false
+			AND NOT EXISTS (SELECT 1 FROM cashier_order_assignments a WHERE a.order_id = o.id)
+	)
+	SELECT u.id, u.email,
+		COUNT(h.id),
+		COUNT(h.id) FILTER (WHERE h.status = 'COMPLETED'),
+		AVG(EXTRACT(EPOCH FROM (h.finished_at - h.started_at))/60)
+			FILTER (WHERE h.status = 'COMPLETED' AND h.started_at IS NOT NULL),
+		(SELECT m.customer_rating::float8 FROM cashier_metrics m
+			WHERE m.cashier_id = u.id AND m.customer_rating IS NOT NULL
+			ORDER BY m.date DESC LIMIT 1)
+	FROM users u
+	LEFT JOIN handled h ON h.cashier_id = u.id AND ($1::interval IS NULL OR h.started_at > NOW() - $1::interval)
+	WHERE COALESCE(u.is_cashier, false) = true AND COALESCE(u.is_sandbox, false) = false
+	GROUP BY u.id, u.email
+`
+
+const cashierVolumeQuery = `
+	SELECT COALESCE(a.cashier_id, o.cashier_id), o.currency_from, SUM(o.amount)::text
+	FROM orders o
+	LEFT JOIN cashier_order_assignments a ON a.order_id = o.id
+	WHERE o.status = 'COMPLETED' AND COALESCE(a.cashier_id, o.cashier_id) IS NOT NULL
+		AND COALESCE(o.is_sandbox, false) = false
+		AND ($1::interval IS NULL OR COALESCE(a.assigned_at, o.accepted_at) > NOW() - $1::interval)
+	GROUP BY 1, 2
+`
+
+func (s *Server) handleGetCashierStats(c *gin.Context) {
+	period := c.DefaultQuery("period", "all")
+	if _, ok := statsPeriods[period]; !ok && period != "all" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period must be 24h, 7d, 30d, 1y or all"})
+		return
+	}
+	sortKey := c.DefaultQuery("sort", "completed_orders")
+	if !cashierSortKeys[sortKey] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be completed_orders, volume, avg_completion_minutes, completion_rate or rating"})
+		return
+	}
+	order := strings.ToLower(c.DefaultQuery("order", "desc"))
+	if order != "asc" && order != "desc" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be asc or desc"})
+		return
+	}
+	currency := strings.ToUpper(c.DefaultQuery("currency", "BOB"))
+
+	s.cachedJSON(c, "Failed to fetch cashier stats", func() (interface{}, error) {
+		cashiers, err := s.cashierStats(statsPeriods[period])
+		if err != nil {
+			return nil, err
+		}
+		sortCashierStats(cashiers, sortKey, currency, order == "asc")
+		return gin.H{
+			"period":   period,
+			"sort":     sortKey,
+			"order":    order,
+			"cashiers": cashiers,
+			"total":    len(cashiers),
+		}, nil
+	})
+}
+
+// cashierStats computes every cashier's figures; interval is empty for all time
+func (s *Server) cashierStats(interval string) ([]CashierStats, error) {
+	var window interface{}
+	if interval != "" {
+		window = interval
+	}
+
+	rows, err := s.db.Query(cashierStatsQuery, window)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cashiers := []CashierStats{}
+	index := make(map[string]int)
+	for rows.Next() {
+		stats := CashierStats{Volume: map[string]string{}}
+		if err := rows.Scan(&stats.CashierID, &stats.Email, &stats.AssignedOrders, &stats.CompletedOrders,
+			&stats.AvgCompletionMinutes, &stats.Rating); err != nil {
+			return nil, err
+		}
+		stats.CompletionRate = percentage(stats.CompletedOrders, stats.AssignedOrders)
+		index[stats.CashierID] = len(cashiers)
+		cashiers = append(cashiers, stats)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	volumeRows, err := s.db.Query(cashierVolumeQuery, window)
+	if err != nil {
+		return nil, err
+	}
+	defer volumeRows.Close()
+	for volumeRows.Next() {
+		var cashierID, currency, volume string
+		if err := volumeRows.Scan(&cashierID, &currency, &volume); err != nil {
+			return nil, err
+		}
+		if i, ok := index[cashierID]; ok {
+			cashiers[i].Volume[currency] = volume
+		}
+	}
+
+	return cashiers, volumeRows.Err()
+}
+
+// sortCashierStats orders cashiers by one figure; cashiers without a value for it go last
+func sortCashierStats(cashiers []CashierStats, key, currency string, ascending bool) {
+	value := func(stats CashierStats) (float64, bool) {
+		switch key {
+		case "volume":
+			volume, err := strconv.ParseFloat(stats.Volume[currency], 64)
+			return volume, err == nil
+		case "avg_completion_minutes":
+			if stats.AvgCompletionMinutes == nil {
+				return 0, false
+			}
+			return *stats.AvgCompletionMinutes, true
+		case "completion_rate":
+			return stats.CompletionRate, stats.AssignedOrders > 0
+		case "rating":
+			if stats.Rating == nil {
+				return 0, false
+			}
+			return *stats.Rating, true
+		}
+		return float64(stats.CompletedOrders), true
+	}
+
+	sort.SliceStable(cashiers, func(i, j int) bool {
+		a, aOK := value(cashiers[i])
+		b, bOK := value(cashiers[j])
+		if aOK != bOK {
+			return aOK
+		}
+		if ascending {
+			return a < b
+		}
+		return a > b
+	})
+}
@@ -0,0 +1,120 @@
+// services/analytics/kyc_funnel.go
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KYC funnel: users who started a submission in the window and how far they got. Steps are
+// nested, so a user counts for a step only if they also reached every previous one; a
+// passport upload counts as the identity document step.
+const kycFunnelQuery = `
+	WITH cohort AS (
+		SELECT
+			s.user_id,
+			BOOL_OR(d.document_type IN ('CI', 'PASSPORT')) AS uploaded_id,
+			BOOL_OR(d.document_type = 'SELFIE') AS uploaded_selfie,
+			BOOL_OR(s.status = 'APPROVED') AS approved
+		FROM kyc_submissions s
+		LEFT JOIN kyc_documents d ON d.submission_id = s.id
+		WHERE s.created_at >= $1 AND s.created_at < $2
+		GROUP BY s.user_id
+	)
+	SELECT
+		COUNT(*),
+		COUNT(*) FILTER (WHERE uploaded_id),
+		COUNT(*) FILTER (WHERE uploaded_id AND uploaded_selfie),
+		COUNT(*) FILTER (WHERE uploaded_id AND uploaded_selfie AND approved)
+	FROM cohort
+`
+
+var kycFunnelSteps = []string{"STARTED", "UPLOADED_CI", "UPLOADED_SELFIE", "APPROVED"}
+
+func (s *Server) handleGetKYCFunnel(c *gin.Context) {
+	from, to, toLabel, ok := funnelWindow(c)
+	if !ok {
+		return
+	}
+
+	counts := make([]int, len(kycFunnelSteps))
+	err := s.db.QueryRow(kycFunnelQuery, from, to).Scan(&counts[0], &counts[1], &counts[2], &counts[3])
+	if err != nil {
+		requestLog(c).Printf("❌ Failed to load KYC funnel: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load KYC funnel"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":  from.Format("2006-01-02"),
+		"to":    toLabel,
+		"steps": funnelSteps(kycFunnelSteps, counts),
+	})
+}
+
+// funnelWindow reads the ?from= and ?to= dates (inclusive, last 30 days by default). It answers
+// 400 and returns false when they are invalid.
+func funnelWindow(c *gin.Context) (time.Time, time.Time, string, bool) {
+	now := time.Now()
+	from, to := now.AddDate(0, 0, -30), now
+	toLabel := now.Format("2006-01-02")
+	if value := c.Query("from"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a YYYY-MM-DD date"})
+			return from, to, toLabel, false
+		}
+		from = date
+	}
+	if value := c.Query("to"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a YYYY-MM-DD date"})
+			return from, to, toLabel, false
+		}
+		to, toLabel = date.AddDate(0, 0, 1), value
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return from, to, toLabel, false
+	}
+	return from, to, toLabel, true
+}
+
+// funnelSteps reports each step's users and conversion. Conversion is relative to the previous
+// step; overall conversion is relative to the first one.
+func funnelSteps(names []string, counts []int) []map[string]interface{} {
+	steps := make([]map[string]interface{}, len(names))
+	for i, name := range names {
+		conversion, overall := 100.0, 100.0
+		if i > 0 {
+			conversion = percentage(counts[i], counts[i-1])
+			overall = percentage(counts[i], counts[0])
+		}
+		steps[i] = map[string]interface{}{
+			"step":               name,
+			"users":              counts[i],
+			"conversion_rate":    conversion,
+			"overall_conversion": overall,
+			"dropped":            funnelDropped(counts, i),
+		}
+	}
+	return steps
+}
+
+func percentage(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
+
+// funnelDropped is how many users reached step i but not the next one
+func funnelDropped(counts []int, i int) int {
+	if i+1 >= len(counts) {
+		return 0
+	}
+	return counts[i] - counts[i+1]
+}
@@ -0,0 +1,89 @@
+// services/analytics/kyc_funnel_test.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+func TestKYCFunnelCountsEachStage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	from, _ := time.Parse("2006-01-02", "2026-09-01")
+	to, _ := time.Parse("2006-01-02", "2026-10-01")
+
+	// 10 users started in September: 8 uploaded their CI, 5 of them a selfie too, and 4 were approved
+	mock.ExpectQuery(`WITH cohort AS .+ WHERE s.created_at >= \$1 AND s.created_at < \$2`).WithArgs(from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"started", "uploaded_id", "uploaded_selfie", "approved"}).
+			AddRow(int64(10), int64(8), int64(5), int64(4)))
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/analytics/kyc/funnel?from=2026-09-01&to=2026-09-30", nil)
+	(&Server{db: db}).handleGetKYCFunnel(c)
+
+	var response struct {
+		From  string `json:"from"`
+		To    string `json:"to"`
+		Steps []struct {
+			Step              string  `json:"step"`
+			Users             int     `json:"users"`
+			ConversionRate    float64 `json:"conversion_rate"`
+			OverallConversion float64 `json:"overall_conversion"`
+			Dropped           int     `json:"dropped"`
+		} `json:"steps"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("response = %d %s: %v", w.Code, w.Body.String(), err)
+	}
+	if response.From != "2026-09-01" || response.To != "2026-09-30" {
+		t.Errorf("window = %s to %s, want 2026-09-01 to 2026-09-30", response.From, response.To)
+	}
+
+	want := []struct {
+		step                string
+		users, dropped      int
+		conversion, overall float64
+	}{
+		{"STARTED", 10, 2, 100, 100},
+		{"UPLOADED_CI", 8, 3, 80, 80},
+		{"UPLOADED_SELFIE", 5, 1, 62.5, 50},
+		{"APPROVED", 4, 0, 80, 40},
+	}
+	if len(response.Steps) != len(want) {
+		t.Fatalf("steps = %+v, want %d", response.Steps, len(want))
+	}
+	for i, step := range response.Steps {
+		w := want[i]
+		if step.Step != w.step || step.Users != w.users || step.Dropped != w.dropped ||
+			step.ConversionRate != w.conversion || step.OverallConversion != w.overall {
+			t.Errorf("step %d = %+v, want %+v", i, step, w)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestKYCFunnelRejectsAnInvertedWindow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/analytics/kyc/funnel?from=2026-10-01&to=2026-09-01", nil)
+	(&Server{}).handleGetKYCFunnel(c)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
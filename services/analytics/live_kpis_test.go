@@ -0,0 +1,85 @@
+// services/analytics/live_kpis_test.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+func TestLiveKPIsStreamPendingOrdersFromEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := newLiveKPIHub(nil)
+	s := &Server{live: hub}
+	router := gin.New()
+	router.GET("/analytics/live", s.handleLiveKPIs)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/analytics/live", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	readKPIs := func() LiveKPIs {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var kpis LiveKPIs
+		if err := conn.ReadJSON(&kpis); err != nil {
+			t.Fatal(err)
+		}
+		return kpis
+	}
+	if kpis := readKPIs(); kpis.PendingOrders != 0 {
+		t.Fatalf("pending_orders on connect = %d, want 0", kpis.PendingOrders)
+	}
+
+	// An order.created event as the p2p service publishes it
+	var event liveOrderEvent
+	body := `{"event":"order.created","order_id":"order-1","occurred_at":"` + time.Now().Format(time.RFC3339) + `",
+		"order":{"user_id":"user-1","cashier_id":null,"currency_from":"BOB","amount":"690","status":"PENDING"}}`
+	if err := json.Unmarshal([]byte(body), &event); err != nil {
+		t.Fatal(err)
+	}
+	hub.applyOrderEvent(event)
+	hub.broadcastIfDirty()
+
+	kpis := readKPIs()
+	if kpis.PendingOrders != 1 || kpis.ActiveUsers != 1 {
+		t.Errorf("streamed %+v, want 1 pending order and 1 active user", kpis)
+	}
+
+	// Accepting the order moves it out of the pending count
+	event.Event, event.Order.Status = "order.accepted", "MATCHED"
+	hub.applyOrderEvent(event)
+	hub.broadcastIfDirty()
+	if kpis := readKPIs(); kpis.PendingOrders != 0 || kpis.OrdersInProgress != 1 {
+		t.Errorf("streamed %+v after acceptance, want 0 pending and 1 in progress", kpis)
+	}
+}
+
+func TestLiveVolumeReconcilesToTheCent(t *testing.T) {
+	hub := newLiveKPIHub(nil)
+	for i, amount := range reconciliationAmounts {
+		var event liveOrderEvent
+		event.Event, event.OrderID = "order.completed", fmt.Sprintf("order-%d", i)
+		event.Order.CurrencyFrom, event.Order.Amount, event.Order.Status = "BOB", amount, "COMPLETED"
+		hub.applyOrderEvent(event)
+	}
+
+	kpis := hub.snapshot()
+	if total := reconciliationTotal(); !kpis.VolumeToday["BOB"].Equal(total) {
+		t.Errorf("volume_today BOB = %s, want the ledger total %s", kpis.VolumeToday["BOB"], total)
+	}
+	encoded, _ := json.Marshal(kpis)
+	if !strings.Contains(string(encoded), `"volume_today":{"BOB":"98765432800.67654322"}`) {
+		t.Errorf("streamed %s, want the exact volume as a string", encoded)
+	}
+}
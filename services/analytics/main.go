@@ -9,12 +9,19 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
 	_ "github.com/lib/pq"
+	"github.com/shopspring/decimal"
+
+	"shared/dbpool"
 )
 
 type Server struct {
-	db     *sql.DB
-	router *gin.Engine
+	db       *sql.DB
+	redis    *redis.Client
+	router   *gin.Engine
+	cacheTTL time.Duration
+	live     *liveKPIHub
 }
 
 func main() {
@@ -33,13 +40,28 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 	defer db.Close()
+	dbpool.Configure(db)
+
+	// Redis connection, used to cache dashboard responses
+	redisClient := redis.NewClient(&redis.Options{
+		Addr: fmt.Sprintf("%s:%s", os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PORT")),
+	})
 
 	server := &Server{
-		db:     db,
-		router: gin.Default(),
+		db:       db,
+		redis:    redisClient,
+		router:   gin.Default(),
+		cacheTTL: analyticsCacheTTL(),
+		live:     newLiveKPIHub(db),
 	}
 
 	server.setupRoutes()
+	
+	// Compile the daily metrics snapshot in background
+	go server.runDailySnapshots()
+
+	// Keep the live dashboard KPIs up to date from the order event stream
+	go server.live.run()
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -53,9 +75,10 @@ func main() {
 }
 
 func (s *Server) setupRoutes() {
-	s.router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "healthy", "service": "analytics"})
-	})
+	setupMetrics(s.router, "analytics", analyticsCacheRequests)
+	s.router.Use(requestIDMiddleware())
+
+	setupHealthRoutes(s.router, "analytics", databaseCheck(s.db), redisCheck(s.redis), s.live.healthCheck())
 
 	api := s.router.Group("/api/v1")
 	{
@@ -64,42 +87,82 @@ func (s *Server) setupRoutes() {
 		api.GET("/analytics/transactions", s.adminMiddleware(), s.handleGetTransactionStats)
 		api.GET("/analytics/users", s.adminMiddleware(), s.handleGetUserStats)
 		api.GET("/analytics/revenue", s.adminMiddleware(), s.handleGetRevenueStats)
+		api.GET("/analytics/revenue/breakdown", s.adminMiddleware(), s.handleGetRevenueBreakdown)
 		api.GET("/analytics/kyc", s.adminMiddleware(), s.handleGetKYCStats)
+		api.GET("/analytics/kyc/funnel", s.adminMiddleware(), s.handleGetKYCFunnel)
+		api.GET("/analytics/retention", s.adminMiddleware(), s.handleGetRetention)
+		api.GET("/analytics/funnel", s.adminMiddleware(), s.handleGetUserFunnel)
+		api.GET("/analytics/live", wsTokenFromQuery(), s.adminMiddleware(), s.handleLiveKPIs)
 		api.GET("/analytics/disputes", s.adminMiddleware(), s.handleGetDisputeStats)
+		api.GET("/analytics/cashiers", s.adminMiddleware(), s.handleGetCashierStats)
 		
 		// Reports
 		api.GET("/reports/daily", s.adminMiddleware(), s.handleDailyReport)
 		api.GET("/reports/monthly", s.adminMiddleware(), s.handleMonthlyReport)
 		api.GET("/reports/regulatory", s.adminMiddleware(), s.handleRegulatoryReport)
+		api.GET("/reports/regulatory/export", s.adminMiddleware(), s.handleRegulatoryReportExport)
+		api.GET("/analytics/suspicious-activity", s.adminMiddleware(), s.handleGetSuspiciousActivity)
+		api.GET("/reports/snapshots", s.adminMiddleware(), s.handleGetSnapshots)
+		api.POST("/reports/snapshots", s.adminMiddleware(), s.handleGenerateSnapshot)
 	}
 }
 
+// Averages of money amounts are rounded to the scale of the DECIMAL(20,8) columns they come from
+const moneyScale = 8
+
+// Periods accepted by the dashboard endpoints, as Postgres intervals
+var statsPeriods = map[string]string{
+	"24h": "24 hours",
+	"7d":  "7 days",
+	"30d": "30 days",
+	"1y":  "1 year",
+}
+
 func (s *Server) handleGetOverview(c *gin.Context) {
+	period := c.DefaultQuery("period", "30d")
+	if _, ok := statsPeriods[period]; !ok {
+		c.JSON(400, gin.H{"error": "period must be 24h, 7d, 30d or 1y"})
+		return
+	}
+
+	s.cachedJSON(c, "Failed to fetch overview", func() (interface{}, error) {
+		return s.overviewStats(period), nil
+	})
+}
+
+// overviewStats computes the dashboard headline numbers; activity and volume cover period
+func (s *Server) overviewStats(period string) map[string]interface{} {
 	overview := make(map[string]interface{})
+	interval := statsPeriods[period]
+	overview["period"] = period
 	
 	// Total users
 	var totalUsers int
-	s.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&totalUsers)
+	s.db.QueryRow("SELECT COUNT(*) FROM users WHERE COALESCE(is_sandbox, false) = false").Scan(&totalUsers)
 	overview["total_users"] = totalUsers
 	
-	// Active users (last 30 days)
+	// Active users in the period
 	var activeUsers int
 	s.db.QueryRow(`
 		SELECT COUNT(DISTINCT from_user_id) 
 		FROM transactions 
-		WHERE created_at > NOW() - INTERVAL '30 days'
-	`).Scan(&activeUsers)
+		WHERE created_at > NOW() - $1::interval
+	`, interval).Scan(&activeUsers)
 	overview["active_users"] = activeUsers
 	
-	// Total volume (last 30 days)
-	var totalVolume float64
+	// Total volume in the period; money sums are scanned as decimals and served as exact strings
+	var totalVolume decimal.Decimal
 	s.db.QueryRow(`
 		SELECT COALESCE(SUM(amount), 0)
 		FROM transactions
 		WHERE status = 'COMPLETED'
-		AND created_at > NOW() - INTERVAL '30 days'
-	`).Scan(&totalVolume)
-	overview["total_volume_30d"] = totalVolume
+		AND created_at > NOW() - $1::interval
+	`, interval).Scan(&totalVolume)
+	overview["total_volume"] = totalVolume
+	if period == "30d" {
+		// Kept for dashboards reading the original field
+		overview["total_volume_30d"] = totalVolume
+	}
 	
 	// Total transactions
 	var totalTransactions int
@@ -110,27 +173,31 @@ func (s *Server) handleGetOverview(c *gin.Context) {
 	overview["total_transactions"] = totalTransactions
 	
 	// Average transaction size
-	var avgTransactionSize float64
+	var avgTransactionSize decimal.Decimal
 	s.db.QueryRow(`
 		SELECT COALESCE(AVG(amount), 0)
 		FROM transactions
 		WHERE status = 'COMPLETED'
 	`).Scan(&avgTransactionSize)
-	overview["avg_transaction_size"] = avgTransactionSize
+	overview["avg_transaction_size"] = avgTransactionSize.Round(moneyScale)
 	
 	// P2P orders
 	var activeOrders int
 	s.db.QueryRow(`
 		SELECT COUNT(*) FROM p2p_orders
-		WHERE status IN ('ACTIVE', 'PARTIALLY_FILLED')
+		WHERE status IN ('ACTIVE', 'PARTIALLY_FILLED') AND COALESCE(is_sandbox, false) = false
 	`).Scan(&activeOrders)
 	overview["active_orders"] = activeOrders
 	
-	c.JSON(200, overview)
+	return overview
 }
 
 func (s *Server) handleGetTransactionStats(c *gin.Context) {
 	period := c.DefaultQuery("period", "7d")
+	if _, ok := statsPeriods[period]; !ok {
+		c.JSON(400, gin.H{"error": "period must be 24h, 7d, 30d or 1y"})
+		return
+	}
 	
 	var interval string
 	switch period {
@@ -146,6 +213,18 @@ func (s *Server) handleGetTransactionStats(c *gin.Context) {
 		interval = "day"
 	}
 	
+	s.cachedJSON(c, "Failed to fetch transaction stats", func() (interface{}, error) {
+		stats, err := s.transactionStats(statsPeriods[period], interval)
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{"transaction_stats": stats}, nil
+	})
+}
+
+// transactionStats groups completed transactions of the last window (a Postgres interval such
+// as "7 days") by unit (hour, day or month); both are bound as parameters
+func (s *Server) transactionStats(window, unit string) ([]map[string]interface{}, error) {
 	rows, err := s.db.Query(`
 		SELECT 
 			date_trunc($1, created_at) as period,
@@ -154,14 +233,13 @@ func (s *Server) handleGetTransactionStats(c *gin.Context) {
 			AVG(amount) as avg_amount
 		FROM transactions
 		WHERE status = 'COMPLETED'
-		AND created_at > NOW() - INTERVAL '` + period + `'
+		AND created_at > NOW() - $2::interval
 		GROUP BY date_trunc($1, created_at)
 		ORDER BY period ASC
-	`, interval)
+	`, unit, window)
 	
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to fetch transaction stats"})
-		return
+		return nil, err
 	}
 	defer rows.Close()
 	
@@ -169,22 +247,28 @@ func (s *Server) handleGetTransactionStats(c *gin.Context) {
 	for rows.Next() {
 		var period time.Time
 		var count int
-		var volume, avgAmount float64
+		var volume, avgAmount decimal.Decimal
 		
 		if err := rows.Scan(&period, &count, &volume, &avgAmount); err == nil {
 			stats = append(stats, map[string]interface{}{
 				"period":     period,
 				"count":      count,
 				"volume":     volume,
-				"avg_amount": avgAmount,
+				"avg_amount": avgAmount.Round(moneyScale),
 			})
 		}
 	}
 	
-	c.JSON(200, gin.H{"transaction_stats": stats})
+	return stats, nil
 }
 
 func (s *Server) handleGetUserStats(c *gin.Context) {
+	s.cachedJSON(c, "Failed to fetch user stats", func() (interface{}, error) {
+		return s.userStats(), nil
+	})
+}
+
+func (s *Server) userStats() map[string]interface{} {
 	stats := make(map[string]interface{})
 	
 	// User growth
@@ -193,7 +277,7 @@ func (s *Server) handleGetUserStats(c *gin.Context) {
 			date_trunc('day', created_at) as day,
 			COUNT(*) as new_users
 		FROM users
-		WHERE created_at > NOW() - INTERVAL '30 days'
+		WHERE created_at > NOW() - INTERVAL '30 days' AND COALESCE(is_sandbox, false) = false
 		GROUP BY day
 		ORDER BY day ASC
 	`)
@@ -218,6 +302,7 @@ func (s *Server) handleGetUserStats(c *gin.Context) {
 	rows, err = s.db.Query(`
 		SELECT COALESCE(kyc_level, 0), COUNT(*) as count
 		FROM users
+		WHERE COALESCE(is_sandbox, false) = false
 		GROUP BY kyc_level
 		ORDER BY kyc_level
 	`)
@@ -237,14 +322,20 @@ func (s *Server) handleGetUserStats(c *gin.Context) {
 		stats["kyc_distribution"] = kycDist
 	}
 	
-	c.JSON(200, stats)
+	return stats
 }
 
 func (s *Server) handleGetRevenueStats(c *gin.Context) {
+	s.cachedJSON(c, "Failed to fetch revenue stats", func() (interface{}, error) {
+		return s.revenueStats(), nil
+	})
+}
+
+func (s *Server) revenueStats() map[string]interface{} {
 	revenue := make(map[string]interface{})
 	
 	// Total fees collected
-	var totalFees float64
+	var totalFees decimal.Decimal
 	s.db.QueryRow(`
 		SELECT COALESCE(SUM(fee), 0)
 		FROM transactions
@@ -269,7 +360,7 @@ func (s *Server) handleGetRevenueStats(c *gin.Context) {
 		var monthly []map[string]interface{}
 		for rows.Next() {
 			var month time.Time
-			var amount float64
+			var amount decimal.Decimal
 			if err := rows.Scan(&month, &amount); err == nil {
 				monthly = append(monthly, map[string]interface{}{
 					"month":   month,
@@ -280,10 +371,16 @@ func (s *Server) handleGetRevenueStats(c *gin.Context) {
 		revenue["monthly_revenue"] = monthly
 	}
 	
-	c.JSON(200, revenue)
+	return revenue
 }
 
 func (s *Server) handleGetKYCStats(c *gin.Context) {
+	s.cachedJSON(c, "Failed to fetch KYC stats", func() (interface{}, error) {
+		return s.kycStats(), nil
+	})
+}
+
+func (s *Server) kycStats() map[string]interface{} {
 	stats := make(map[string]interface{})
 	
 	// KYC submissions by status
@@ -329,10 +426,16 @@ func (s *Server) handleGetKYCStats(c *gin.Context) {
 		stats["approval_rate"] = float64(approvedSubmissions) / float64(totalSubmissions) * 100
 	}
 	
-	c.JSON(200, stats)
+	return stats
 }
 
 func (s *Server) handleGetDisputeStats(c *gin.Context) {
+	s.cachedJSON(c, "Failed to fetch dispute stats", func() (interface{}, error) {
+		return s.disputeStats(), nil
+	})
+}
+
+func (s *Server) disputeStats() map[string]interface{} {
 	stats := make(map[string]interface{})
 	
 	// Disputes by status
@@ -377,7 +480,7 @@ func (s *Server) handleGetDisputeStats(c *gin.Context) {
 		stats["resolution_rate"] = float64(resolvedDisputes) / float64(totalDisputes) * 100
 	}
 	
-	c.JSON(200, stats)
+	return stats
 }
 
 func (s *Server) handleDailyReport(c *gin.Context) {
@@ -388,7 +491,7 @@ func (s *Server) handleDailyReport(c *gin.Context) {
 	
 	// Daily transactions
 	var dailyTransactions int
-	var dailyVolume float64
+	var dailyVolume decimal.Decimal
 	s.db.QueryRow(`
 		SELECT COUNT(*), COALESCE(SUM(amount), 0)
 		FROM transactions
@@ -401,7 +504,7 @@ func (s *Server) handleDailyReport(c *gin.Context) {
 	// Daily registrations
 	var dailyRegistrations int
 	s.db.QueryRow(`
-		SELECT COUNT(*) FROM users WHERE DATE(created_at) = $1
+		SELECT COUNT(*) FROM users WHERE DATE(created_at) = $1 AND COALESCE(is_sandbox, false) = false
 	`, date).Scan(&dailyRegistrations)
 	report["new_users"] = dailyRegistrations
 	
@@ -416,7 +519,7 @@ func (s *Server) handleMonthlyReport(c *gin.Context) {
 	
 	// Monthly stats
 	var monthlyTransactions int
-	var monthlyVolume, monthlyFees float64
+	var monthlyVolume, monthlyFees decimal.Decimal
 	s.db.QueryRow(`
 		SELECT COUNT(*), COALESCE(SUM(amount), 0), COALESCE(SUM(fee), 0)
 		FROM transactions
@@ -460,6 +563,7 @@ func (s *Server) handleRegulatoryReport(c *gin.Context) {
 			COUNT(CASE WHEN kyc_level >= 1 THEN 1 END),
 			COUNT(*)
 		FROM users
+		WHERE COALESCE(is_sandbox, false) = false
 	`).Scan(&kycCompliant, &totalUsers)
 	
 	if totalUsers > 0 {
@@ -0,0 +1,99 @@
+// services/analytics/main_test.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+func TestPeriodsOutsideTheAllowlistAreRejected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{} // no database or cache: a period that gets past validation panics
+
+	handlers := map[string]gin.HandlerFunc{
+		"overview":          s.handleGetOverview,
+		"transactions":      s.handleGetTransactionStats,
+		"revenue breakdown": s.handleGetRevenueBreakdown,
+		"cashiers":          s.handleGetCashierStats,
+	}
+	periods := []string{
+		"30 days",
+		"1 day'; DROP TABLE transactions; --",
+		"day) FROM users; --",
+		"7D",
+		"month ",
+		"all'",
+	}
+
+	for name, handler := range handlers {
+		for _, period := range periods {
+			t.Run(name+" "+period, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+				c.Request = httptest.NewRequest(http.MethodGet, "/?period="+url.QueryEscape(period), nil)
+				handler(c)
+				if w.Code != http.StatusBadRequest {
+					t.Errorf("period %q = %d, want 400", period, w.Code)
+				}
+			})
+		}
+	}
+}
+
+// reconciliationAmounts is a small ledger whose float64 sum drifts from the exact one
+var reconciliationAmounts = []string{"0.1", "0.2", "98765432109.87654321", "0.00000001", "690.5"}
+
+func reconciliationTotal() decimal.Decimal {
+	total := decimal.Zero
+	for _, amount := range reconciliationAmounts {
+		total = total.Add(decimal.RequireFromString(amount))
+	}
+	return total
+}
+
+func TestMonthlyReportReconcilesDecimalSums(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Postgres sums the NUMERIC column exactly; fees are 0.1% of each amount
+	volume := reconciliationTotal()
+	fees := volume.Mul(decimal.RequireFromString("0.001"))
+	mock.ExpectQuery(`SELECT COUNT\(\*\), COALESCE\(SUM\(amount\), 0\), COALESCE\(SUM\(fee\), 0\)`).WithArgs("2026-09").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "volume", "fees"}).
+			AddRow(int64(len(reconciliationAmounts)), volume.String(), fees.String()))
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/reports/monthly?month=2026-09", nil)
+	(&Server{db: db}).handleMonthlyReport(c)
+
+	var report struct {
+		Transactions  int    `json:"transactions"`
+		Volume        string `json:"volume"`
+		FeesCollected string `json:"fees_collected"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("report %s: %v", w.Body.String(), err)
+	}
+	if report.Volume != "98765432800.67654322" || report.FeesCollected != "98765432.80067654322" {
+		t.Errorf("volume %s, fees %s, want the exact ledger sums 98765432800.67654322 and 98765432.80067654322",
+			report.Volume, report.FeesCollected)
+	}
+	if report.Transactions != len(reconciliationAmounts) {
+		t.Errorf("transactions = %d, want %d", report.Transactions, len(reconciliationAmounts))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
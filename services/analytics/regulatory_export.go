@@ -0,0 +1,284 @@
+// services/analytics/regulatory_export.go
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Monthly report for ASFI/UIF as a downloadable file: every high-value transaction of the month,
+// the users moving suspicious amounts with their volume, and KYC compliance figures. Thresholds
+// match the regulatory dashboard; amounts are compared as recorded, in the transaction currency.
+const (
+	regulatoryHighValueAmount  = 10000
+	regulatorySuspiciousAmount = 50000
+)
+
+// regulatorySection is one table of the report, rendered the same way in CSV and PDF
+type regulatorySection struct {
+	Title   string
+	Columns []string
+	Rows    [][]string
+}
+
+type regulatoryReport struct {
+	Month       string
+	From, To    time.Time
+	GeneratedAt time.Time
+	GeneratedBy string
+	Sections    []regulatorySection
+}
+
+func (s *Server) handleRegulatoryReportExport(c *gin.Context) {
+	format := c.DefaultQuery("format", "pdf")
+	if format != "csv" && format != "pdf" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or pdf"})
+		return
+	}
+
+	// Defaults to the last closed month, which is what gets filed
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -1, 0)
+	if value := c.Query("month"); value != "" {
+		month, err := time.ParseInLocation("2006-01", value, now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "month must be a YYYY-MM month"})
+			return
+		}
+		if month.After(now) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "month cannot be in the future"})
+			return
+		}
+		from = month
+	}
+
+	report := regulatoryReport{
+		Month:       from.Format("2006-01"),
+		From:        from,
+		To:          from.AddDate(0, 1, 0),
+		GeneratedAt: now,
+		GeneratedBy: c.GetString("user_id"),
+	}
+	if err := s.buildRegulatoryReport(&report); err != nil {
+		requestLog(c).Printf("❌ Failed to build regulatory report for %s: %v", report.Month, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build regulatory report"})
+		return
+	}
+
+	requestLog(c).Printf("📑 Regulatory report for %s exported by %s (%s)", report.Month, report.GeneratedBy, format)
+
+	filename := fmt.Sprintf("regulatory-report-%s.%s", report.Month, format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	if format == "csv" {
+		data, err := renderRegulatoryCSV(report)
+		if err != nil {
+			requestLog(c).Printf("❌ Failed to render regulatory CSV for %s: %v", report.Month, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render regulatory report"})
+			return
+		}
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+		return
+	}
+
+	data, err := renderRegulatoryPDF(report)
+	if err != nil {
+		requestLog(c).Printf("❌ Failed to render regulatory PDF for %s: %v", report.Month, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render regulatory report"})
+		return
+	}
+	c.Data(http.StatusOK, "application/pdf", data)
+}
+
+// buildRegulatoryReport fills the report sections for [From, To)
+func (s *Server) buildRegulatoryReport(report *regulatoryReport) error {
+	highValue := regulatorySection{
+		Title:   fmt.Sprintf("High-value transactions (amount > %d)", regulatoryHighValueAmount),
+		Columns: []string{"transaction_id", "created_at", "user_id", "email", "type", "method", "currency", "amount"},
+		Rows:    [][]string{},
+	}
+	rows, err := s.db.Query(`
+		SELECT t.id, t.created_at, COALESCE(t.user_id::text, ''), COALESCE(u.email, ''),
+			COALESCE(t.type, t.transaction_type, ''), COALESCE(t.method, t.payment_method, ''),
+			t.currency, t.amount::text
+		FROM transactions t
+		LEFT JOIN users u ON u.id = t.user_id
+		WHERE t.amount > $1 AND t.status = 'COMPLETED'
+			AND t.created_at >= $2 AND t.created_at < $3
+		ORDER BY t.created_at ASC
+	`, regulatoryHighValueAmount, report.From, report.To)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, userID, email, txType, method, currency, amount string
+		var createdAt time.Time
+		if err := rows.Scan(&id, &createdAt, &userID, &email, &txType, &method, &currency, &amount); err != nil {
+			return err
+		}
+		highValue.Rows = append(highValue.Rows, []string{
+			id, createdAt.Format(time.RFC3339), userID, email, txType, method, currency, amount,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Volumes are per currency; amounts in different currencies are never added together
+	suspicious := regulatorySection{
+		Title:   fmt.Sprintf("Suspicious activity (transactions > %d)", regulatorySuspiciousAmount),
+		Columns: []string{"user_id", "email", "kyc_level", "currency", "transactions", "volume"},
+		Rows:    [][]string{},
+	}
+	userRows, err := s.db.Query(`
+		SELECT t.from_user_id::text, COALESCE(u.email, ''), COALESCE(u.kyc_level, 0),
+			t.currency, COUNT(*), SUM(t.amount)::text
+		FROM transactions t
+		LEFT JOIN users u ON u.id = t.from_user_id
+		WHERE t.amount > $1 AND t.status = 'COMPLETED' AND t.from_user_id IS NOT NULL
+			AND t.created_at >= $2 AND t.created_at < $3
+		GROUP BY t.from_user_id, u.email, u.kyc_level, t.currency
+		ORDER BY SUM(t.amount) DESC
+	`, regulatorySuspiciousAmount, report.From, report.To)
+	if err != nil {
+		return err
+	}
+	defer userRows.Close()
+	for userRows.Next() {
+		var userID, email, currency, volume string
+		var kycLevel, count int
+		if err := userRows.Scan(&userID, &email, &kycLevel, &currency, &count, &volume); err != nil {
+			return err
+		}
+		suspicious.Rows = append(suspicious.Rows, []string{
+			userID, email, strconv.Itoa(kycLevel), currency, strconv.Itoa(count), volume,
+		})
+	}
+	if err := userRows.Err(); err != nil {
+		return err
+	}
+
+	// Compliance is measured on the accounts that existed at the end of the month
+	var totalUsers, compliantUsers, approved, rejected, pending int
+	err = s.db.QueryRow(`
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE kyc_level >= 1)
+		FROM users
+		WHERE created_at < $1 AND COALESCE(is_sandbox, false) = false
+	`, report.To).Scan(&totalUsers, &compliantUsers)
+	if err != nil {
+		return err
+	}
+	err = s.db.QueryRow(`
+		SELECT
+			COUNT(*) FILTER (WHERE status = 'APPROVED'),
+			COUNT(*) FILTER (WHERE status = 'REJECTED'),
+			COUNT(*) FILTER (WHERE status NOT IN ('APPROVED', 'REJECTED'))
+		FROM kyc_submissions
+		WHERE created_at >= $1 AND created_at < $2
+	`, report.From, report.To).Scan(&approved, &rejected, &pending)
+	if err != nil {
+		return err
+	}
+
+	kyc := regulatorySection{
+		Title:   "KYC compliance",
+		Columns: []string{"metric", "value"},
+		Rows: [][]string{
+			{"total_users", strconv.Itoa(totalUsers)},
+			{"verified_users (kyc_level >= 1)", strconv.Itoa(compliantUsers)},
+			{"compliance_rate_percent", strconv.FormatFloat(percentage(compliantUsers, totalUsers), 'f', 2, 64)},
+			{"submissions_approved", strconv.Itoa(approved)},
+			{"submissions_rejected", strconv.Itoa(rejected)},
+			{"submissions_pending", strconv.Itoa(pending)},
+		},
+	}
+
+	report.Sections = []regulatorySection{highValue, suspicious, kyc}
+	return nil
+}
+
+// renderRegulatoryCSV writes a header block followed by each section, separated by blank lines
+func renderRegulatoryCSV(report regulatoryReport) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	writer.Write([]string{"report", "ASFI/UIF regulatory report"})
+	writer.Write([]string{"period", report.From.Format("2006-01-02"), report.To.AddDate(0, 0, -1).Format("2006-01-02")})
+	writer.Write([]string{"generated_at", report.GeneratedAt.Format(time.RFC3339)})
+	writer.Write([]string{"generated_by", report.GeneratedBy})
+
+	for _, section := range report.Sections {
+		writer.Write(nil)
+		writer.Write([]string{fmt.Sprintf("%s (%d)", section.Title, len(section.Rows))})
+		writer.Write(section.Columns)
+		for _, row := range section.Rows {
+			writer.Write(row)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderRegulatoryPDF lays the report out as one table per section
+func renderRegulatoryPDF(report regulatoryReport) ([]byte, error) {
+	pdf := gofpdf.New("L", "mm", "A4", "")
+	pdf.SetTitle("ASFI/UIF regulatory report "+report.Month, true)
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.Cell(0, 10, "ASFI/UIF regulatory report - "+report.Month)
+	pdf.Ln(10)
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.Cell(0, 6, fmt.Sprintf("Period %s to %s", report.From.Format("2006-01-02"), report.To.AddDate(0, 0, -1).Format("2006-01-02")))
+	pdf.Ln(6)
+	pdf.Cell(0, 6, fmt.Sprintf("Generated %s by %s", report.GeneratedAt.Format(time.RFC3339), report.GeneratedBy))
+	pdf.Ln(10)
+
+	for _, section := range report.Sections {
+		pdf.SetFont("Helvetica", "B", 12)
+		pdf.Cell(0, 8, fmt.Sprintf("%s (%d)", section.Title, len(section.Rows)))
+		pdf.Ln(8)
+
+		width := 277.0 / float64(len(section.Columns))
+		pdf.SetFont("Helvetica", "B", 7)
+		for _, column := range section.Columns {
+			pdf.CellFormat(width, 6, pdfFit(pdf, column, width), "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+
+		pdf.SetFont("Helvetica", "", 7)
+		for _, row := range section.Rows {
+			for _, value := range row {
+				pdf.CellFormat(width, 5, pdfFit(pdf, value, width), "1", 0, "L", false, 0, "")
+			}
+			pdf.Ln(-1)
+		}
+		pdf.Ln(4)
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pdfFit truncates text to the column width
+func pdfFit(pdf *gofpdf.Fpdf, text string, width float64) string {
+	for len(text) > 0 && pdf.GetStringWidth(text) > width-2 {
+		text = text[:len(text)-1]
+	}
+	return text
+}
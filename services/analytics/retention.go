@@ -0,0 +1,212 @@
+// services/analytics/retention.go
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Retention: users are grouped by the week or month they signed up in, and each cohort reports
+// the share of its users with at least one completed transaction in every period since. Period 0
+// is the signup period itself. Sandbox users are left out.
+
+const maxRetentionPeriods = 52
+
+// Postgres date_trunc unit per ?cohort=
+var retentionUnits = map[string]string{
+	"weekly":  "week",
+	"monthly": "month",
+}
+
+const retentionCohortsQuery = `
+	SELECT date_trunc($1, created_at), COUNT(*)
+	FROM users
+	WHERE created_at >= $2 AND COALESCE(is_sandbox, false) = false
+	GROUP BY 1
+	ORDER BY 1
+`
+
+const retentionActivityQuery = `
+	SELECT date_trunc($1, u.created_at), date_trunc($1, t.created_at), COUNT(DISTINCT u.id)
+	FROM users u
+	JOIN transactions t ON COALESCE(t.user_id, t.from_user_id) = u.id
+	WHERE u.created_at >= $2 AND COALESCE(u.is_sandbox, false) = false
+		AND t.status = 'COMPLETED' AND t.created_at >= date_trunc($1, u.created_at)
+	GROUP BY 1, 2
+`
+
+// User funnel: users who registered in the window and how far they got. Steps are nested like
+// the KYC funnel, so a user counts for a step only if they also reached every previous one.
+const userFunnelQuery = `
+	WITH cohort AS (
+		SELECT
+			u.id,
+			EXISTS (SELECT 1 FROM kyc_submissions s WHERE s.user_id = u.id) AS kyc_submitted,
+			EXISTS (SELECT 1 FROM kyc_submissions s WHERE s.user_id = u.id AND s.status = 'APPROVED') AS kyc_approved,
+			EXISTS (SELECT 1 FROM transactions t WHERE COALESCE(t.user_id, t.to_user_id) = u.id
+				AND COALESCE(t.type, t.transaction_type) = 'DEPOSIT' AND t.status = 'COMPLETED') AS deposited,
+			EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.id AND o.status = 'COMPLETED') AS traded
+		FROM users u
+		WHERE u.created_at >= $1 AND u.created_at < $2 AND COALESCE(u.is_sandbox, false) = false
+	)
+	SELECT
+		COUNT(*),
+		COUNT(*) FILTER (WHERE kyc_submitted),
+		COUNT(*) FILTER (WHERE kyc_submitted AND kyc_approved),
+		COUNT(*) FILTER (WHERE kyc_submitted AND kyc_approved AND deposited),
+		COUNT(*) FILTER (WHERE kyc_submitted AND kyc_approved AND deposited AND traded)
+	FROM cohort
+`
+
+var userFunnelSteps = []string{"REGISTERED", "KYC_SUBMITTED", "KYC_APPROVED", "FIRST_DEPOSIT", "FIRST_TRADE"}
+
+type RetentionCohort struct {
+	Cohort string `json:"cohort"`
+	Users  int    `json:"users"`
+	// Active and Retention are indexed by periods since signup, up to the current period
+	Active    []int     `json:"active"`
+	Retention []float64 `json:"retention"`
+}
+
+func (s *Server) handleGetRetention(c *gin.Context) {
+	cohort := c.DefaultQuery("cohort", "monthly")
+	unit, ok := retentionUnits[cohort]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cohort must be weekly or monthly"})
+		return
+	}
+	periods, err := strconv.Atoi(c.DefaultQuery("periods", "12"))
+	if err != nil || periods <= 0 || periods > maxRetentionPeriods {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("periods must be between 1 and %d", maxRetentionPeriods)})
+		return
+	}
+
+	s.cachedJSON(c, "Failed to fetch retention", func() (interface{}, error) {
+		cohorts, err := s.retentionCohorts(unit, periods)
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{
+			"cohort":  cohort,
+			"periods": periods,
+			"cohorts": cohorts,
+		}, nil
+	})
+}
+
+// retentionCohorts builds the cohort matrix for the last periods weeks or months
+func (s *Server) retentionCohorts(unit string, periods int) ([]RetentionCohort, error) {
+	now := time.Now()
+	current := truncatePeriod(now, unit)
+	since := addPeriods(current, unit, -(periods - 1))
+
+	rows, err := s.db.Query(retentionCohortsQuery, unit, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cohorts := []RetentionCohort{}
+	index := make(map[string]int)
+	starts := []time.Time{}
+	for rows.Next() {
+		var start time.Time
+		var users int
+		if err := rows.Scan(&start, &users); err != nil {
+			return nil, err
+		}
+		elapsed := periodsBetween(start, current, unit) + 1
+		label := start.Format("2006-01-02")
+		index[label] = len(cohorts)
+		starts = append(starts, start)
+		cohorts = append(cohorts, RetentionCohort{
+			Cohort:    label,
+			Users:     users,
+			Active:    make([]int, elapsed),
+			Retention: make([]float64, elapsed),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	activityRows, err := s.db.Query(retentionActivityQuery, unit, since)
+	if err != nil {
+		return nil, err
+	}
+	defer activityRows.Close()
+	for activityRows.Next() {
+		var start, period time.Time
+		var active int
+		if err := activityRows.Scan(&start, &period, &active); err != nil {
+			return nil, err
+		}
+		i, ok := index[start.Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		offset := periodsBetween(starts[i], period, unit)
+		if offset >= 0 && offset < len(cohorts[i].Active) {
+			cohorts[i].Active[offset] = active
+		}
+	}
+	if err := activityRows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range cohorts {
+		for offset, active := range cohorts[i].Active {
+			cohorts[i].Retention[offset] = percentage(active, cohorts[i].Users)
+		}
+	}
+	return cohorts, nil
+}
+
+func truncatePeriod(t time.Time, unit string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if unit == "month" {
+		return day.AddDate(0, 0, 1-day.Day())
+	}
+	// date_trunc('week') starts weeks on Monday
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+func addPeriods(t time.Time, unit string, n int) time.Time {
+	if unit == "month" {
+		return t.AddDate(0, n, 0)
+	}
+	return t.AddDate(0, 0, 7*n)
+}
+
+// periodsBetween counts whole weeks or months from one period start to another
+func periodsBetween(from, to time.Time, unit string) int {
+	if unit == "month" {
+		return (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+	}
+	return int(math.Round(to.Sub(from).Hours() / (24 * 7)))
+}
+
+func (s *Server) handleGetUserFunnel(c *gin.Context) {
+	from, to, toLabel, ok := funnelWindow(c)
+	if !ok {
+		return
+	}
+
+	s.cachedJSON(c, "Failed to fetch user funnel", func() (interface{}, error) {
+		counts := make([]int, len(userFunnelSteps))
+		err := s.db.QueryRow(userFunnelQuery, from, to).Scan(&counts[0], &counts[1], &counts[2], &counts[3], &counts[4])
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{
+			"from":  from.Format("2006-01-02"),
+			"to":    toLabel,
+			"steps": funnelSteps(userFunnelSteps, counts),
+		}, nil
+	})
+}
@@ -0,0 +1,120 @@
+// services/analytics/revenue_test.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+func getRevenueBreakdown(s *Server, query string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/revenue/breakdown?"+query, nil)
+	s.handleGetRevenueBreakdown(c)
+	return w
+}
+
+func TestRevenueBreakdownGroupsFeesByTypeAndCurrency(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	from, _ := time.Parse("2006-01-02", "2026-08-01")
+	to, _ := time.Parse("2006-01-02", "2026-10-01")
+	august, september := from, from.AddDate(0, 1, 0)
+
+	// Seeded fees: withdrawal fees and P2P commissions in BOB over two months, a conversion spread in USD
+	mock.ExpectQuery(`SELECT date_trunc\(\$3, created_at\) AS period, fee_type, currency,.+GROUP BY period, fee_type, currency`).
+		WithArgs(from, to, "month").
+		WillReturnRows(sqlmock.NewRows([]string{"period", "fee_type", "currency", "sum", "count"}).
+			AddRow(august, "P2P_COMMISSION", "BOB", "13.80", int64(2)).
+			AddRow(august, "WITHDRAWAL_FEE", "BOB", "5.00", int64(1)).
+			AddRow(september, "CONVERSION_SPREAD", "USD", "0.35000001", int64(1)).
+			AddRow(september, "P2P_COMMISSION", "BOB", "6.90", int64(1)))
+	mock.ExpectQuery(`SELECT fee_type, currency, SUM\(revenue\)::text, COUNT\(\*\).+GROUP BY fee_type, currency`).
+		WithArgs(from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"fee_type", "currency", "sum", "count"}).
+			AddRow("CONVERSION_SPREAD", "USD", "0.35000001", int64(1)).
+			AddRow("P2P_COMMISSION", "BOB", "20.70", int64(3)).
+			AddRow("WITHDRAWAL_FEE", "BOB", "5.00", int64(1)))
+
+	w := getRevenueBreakdown(&Server{db: db}, "from=2026-08-01&to=2026-09-30")
+
+	var response struct {
+		Breakdown []struct {
+			Period       time.Time `json:"period"`
+			FeeType      string    `json:"fee_type"`
+			Currency     string    `json:"currency"`
+			Revenue      string    `json:"revenue"`
+			Transactions int       `json:"transactions"`
+		} `json:"breakdown"`
+		Totals []struct {
+			FeeType      string `json:"fee_type"`
+			Currency     string `json:"currency"`
+			Revenue      string `json:"revenue"`
+			Transactions int    `json:"transactions"`
+		} `json:"totals"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("response = %d %s: %v", w.Code, w.Body.String(), err)
+	}
+	if len(response.Breakdown) != 4 {
+		t.Fatalf("breakdown = %+v, want 4 groups", response.Breakdown)
+	}
+	if group := response.Breakdown[2]; !group.Period.Equal(september) || group.FeeType != "CONVERSION_SPREAD" ||
+		group.Currency != "USD" || group.Revenue != "0.35000001" {
+		t.Errorf("third group = %+v, want September's USD conversion spread of exactly 0.35000001", group)
+	}
+
+	want := map[string]string{
+		"CONVERSION_SPREAD USD": "0.35000001",
+		"P2P_COMMISSION BOB":    "20.70",
+		"WITHDRAWAL_FEE BOB":    "5.00",
+	}
+	if len(response.Totals) != len(want) {
+		t.Fatalf("totals = %+v, want one per type and currency", response.Totals)
+	}
+	for _, total := range response.Totals {
+		if revenue := want[total.FeeType+" "+total.Currency]; total.Revenue != revenue {
+			t.Errorf("%s %s total = %s, want %s", total.FeeType, total.Currency, total.Revenue, revenue)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRevenueBreakdownFiltersAreBound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	columns := []string{"period", "fee_type", "currency", "sum", "count"}
+	mock.ExpectQuery(`AND currency = \$3 AND fee_type = \$4\s+GROUP BY period`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "BOB", "WITHDRAWAL_FEE", "week").
+		WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectQuery(`AND currency = \$3 AND fee_type = \$4\s+GROUP BY fee_type, currency`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "BOB", "WITHDRAWAL_FEE").
+		WillReturnRows(sqlmock.NewRows(columns[1:]))
+
+	if w := getRevenueBreakdown(&Server{db: db}, "period=week&currency=bob&type=withdrawal_fee"); w.Code != http.StatusOK {
+		t.Errorf("status = %d %s, want 200", w.Code, w.Body.String())
+	}
+	if w := getRevenueBreakdown(&Server{db: db}, "period=quarter"); w.Code != http.StatusBadRequest {
+		t.Errorf("period=quarter status = %d, want 400", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,204 @@
+// services/analytics/snapshots.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Daily snapshots freeze the dashboard metrics once a day into daily_snapshots so admins can
+// follow trends without recomputing history. When REPORT_WEBHOOK_URL is set each new snapshot
+// is also POSTed there for delivery (email relay, storage bucket, chat...).
+
+const snapshotCheckInterval = time.Hour
+
+type DailySnapshot struct {
+	Date      string                 `json:"date"`
+	Data      map[string]interface{} `json:"data"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+func (s *Server) runDailySnapshots() {
+	s.ensureDailySnapshot()
+
+	ticker := time.NewTicker(snapshotCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.ensureDailySnapshot()
+	}
+}
+
+// ensureDailySnapshot compiles today's snapshot if it was not taken yet
+func (s *Server) ensureDailySnapshot() {
+	today := time.Now().UTC().Format("2006-01-02")
+
+	var exists bool
+	s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM daily_snapshots WHERE snapshot_date = $1)`, today).Scan(&exists)
+	if exists {
+		return
+	}
+
+	snapshot, created, err := s.generateSnapshot(today, false)
+	if err != nil {
+		log.Printf("❌ Failed to generate daily snapshot for %s: %v", today, err)
+		return
+	}
+	if created {
+		log.Printf("📊 Daily snapshot generated for %s", today)
+		s.deliverSnapshot(snapshot)
+	}
+}
+
+// compileSnapshot gathers the same metrics the dashboard endpoints serve
+func (s *Server) compileSnapshot() map[string]interface{} {
+	data := map[string]interface{}{
+		"overview": s.overviewStats("30d"),
+		"revenue":  s.revenueStats(),
+		"kyc":      s.kycStats(),
+		"disputes": s.disputeStats(),
+	}
+
+	if transactions, err := s.transactionStats("30 days", "day"); err == nil {
+		data["transactions"] = transactions
+	} else {
+		log.Printf("⚠️ Snapshot: failed to compile transaction stats: %v", err)
+	}
+
+	return data
+}
+
+// generateSnapshot stores a snapshot for the date. Existing snapshots are kept unless replace is set.
+func (s *Server) generateSnapshot(date string, replace bool) (*DailySnapshot, bool, error) {
+	snapshot := &DailySnapshot{
+		Date:      date,
+		Data:      s.compileSnapshot(),
+		CreatedAt: time.Now(),
+	}
+
+	payload, err := json.Marshal(snapshot.Data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	query := `
+		INSERT INTO daily_snapshots (snapshot_date, data, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (snapshot_date) DO NOTHING
+	`
+	if replace {
+		query = `
+			INSERT INTO daily_snapshots (snapshot_date, data, created_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (snapshot_date) DO UPDATE SET data = EXCLUDED.data, created_at = EXCLUDED.created_at
+		`
+	}
+
+	result, err := s.db.Exec(query, date, payload, snapshot.CreatedAt)
+	if err != nil {
+		return nil, false, err
+	}
+	rows, _ := result.RowsAffected()
+
+	return snapshot, rows > 0, nil
+}
+
+func (s *Server) deliverSnapshot(snapshot *DailySnapshot) {
+	webhookURL := os.Getenv("REPORT_WEBHOOK_URL")
+	if webhookURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(snapshot)
+	if err != nil {
+		return
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("⚠️ Failed to deliver snapshot %s: %v", snapshot.Date, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		log.Printf("⚠️ Snapshot %s delivery returned status %d", snapshot.Date, resp.StatusCode)
+		return
+	}
+
+	s.db.Exec(`UPDATE daily_snapshots SET delivered_at = NOW() WHERE snapshot_date = $1`, snapshot.Date)
+}
+
+func (s *Server) handleGetSnapshots(c *gin.Context) {
+	to := c.DefaultQuery("to", time.Now().UTC().Format("2006-01-02"))
+	from := c.DefaultQuery("from", time.Now().UTC().AddDate(0, 0, -30).Format("2006-01-02"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "90"))
+	if limit <= 0 || limit > 366 {
+		limit = 90
+	}
+
+	if _, err := time.Parse("2006-01-02", from); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid from date, expected YYYY-MM-DD"})
+		return
+	}
+	if _, err := time.Parse("2006-01-02", to); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid to date, expected YYYY-MM-DD"})
+		return
+	}
+
+	rows, err := s.db.Query(`
+		SELECT snapshot_date, data, created_at
+		FROM daily_snapshots
+		WHERE snapshot_date BETWEEN $1 AND $2
+		ORDER BY snapshot_date ASC
+		LIMIT $3
+	`, from, to, limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch snapshots"})
+		return
+	}
+	defer rows.Close()
+
+	snapshots := []DailySnapshot{}
+	for rows.Next() {
+		var snapshot DailySnapshot
+		var date time.Time
+		var data []byte
+		if err := rows.Scan(&date, &data, &snapshot.CreatedAt); err != nil {
+			continue
+		}
+		snapshot.Date = date.Format("2006-01-02")
+		json.Unmarshal(data, &snapshot.Data)
+		snapshots = append(snapshots, snapshot)
+	}
+
+	c.JSON(200, gin.H{
+		"from":      from,
+		"to":        to,
+		"snapshots": snapshots,
+	})
+}
+
+// handleGenerateSnapshot recompiles today's snapshot on demand
+func (s *Server) handleGenerateSnapshot(c *gin.Context) {
+	today := time.Now().UTC().Format("2006-01-02")
+
+	snapshot, _, err := s.generateSnapshot(today, true)
+	if err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to generate snapshot: %v", err)})
+		return
+	}
+
+	go s.deliverSnapshot(snapshot)
+
+	c.JSON(201, snapshot)
+}
@@ -0,0 +1,136 @@
+// services/analytics/suspicious_activity.go
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Drill-down behind the regulatory report's suspicious-activity count. Completed transactions of
+// the last days are scanned for three patterns, each flagged per user with the transactions that
+// triggered it:
+//   - RAPID_FIRE: rapidFireCount or more transactions within rapidFireWindow of each other
+//   - STRUCTURING: structuringCount or more deposits just under the threshold (90% to 100% of it)
+//   - HIGH_VELOCITY: total volume of at least highVelocityMultiple times the threshold
+// Amounts are compared in BOB using the platform's fixed reference rates.
+const (
+	rapidFireCount       = 5
+	rapidFireWindow      = "10 minutes"
+	structuringCount     = 3
+	structuringFloor     = 0.9
+	highVelocityMultiple = 5
+	maxSuspiciousDays    = 90
+	maxFlagTransactions  = 100
+)
+
+const suspiciousActivityQuery = `
+	WITH txs AS (
+		SELECT t.id, COALESCE(t.user_id, t.from_user_id) AS user_id,
+			COALESCE(t.type, t.transaction_type) AS tx_type, t.created_at,
+			t.amount * CASE t.currency WHEN 'USD' THEN 6.90 WHEN 'USDT' THEN 6.90 ELSE 1 END AS amount_bob
+		FROM transactions t
+		WHERE t.status = 'COMPLETED'
+			AND COALESCE(t.method, t.payment_method, '') <> 'INTERNAL'
+			AND COALESCE(t.user_id, t.from_user_id) IS NOT NULL
+			AND t.created_at > NOW() - make_interval(days => $1)
+	),
+	bursts AS (
+		SELECT *, COUNT(*) OVER (
+			PARTITION BY user_id ORDER BY created_at
+			RANGE BETWEEN $3::interval PRECEDING AND $3::interval FOLLOWING
+		) AS nearby
+		FROM txs
+	),
+	structured AS (
+		SELECT *, COUNT(*) OVER (PARTITION BY user_id) AS near_threshold
+		FROM txs
+		WHERE tx_type = 'DEPOSIT' AND amount_bob >= $2::numeric * $5::numeric AND amount_bob < $2::numeric
+	),
+	velocity AS (
+		SELECT *, SUM(amount_bob) OVER (PARTITION BY user_id) AS user_volume
+		FROM txs
+	),
+	flags AS (
+		SELECT 'RAPID_FIRE' AS pattern, id, user_id, amount_bob, created_at FROM bursts WHERE nearby >= $4
+		UNION ALL
+		SELECT 'STRUCTURING', id, user_id, amount_bob, created_at FROM structured WHERE near_threshold >= $6
+		UNION ALL
+		SELECT 'HIGH_VELOCITY', id, user_id, amount_bob, created_at FROM velocity WHERE user_volume >= $2::numeric * $7
+	)
+	SELECT f.pattern, f.user_id, COALESCE(u.email, ''), COUNT(*), SUM(f.amount_bob)::text,
+		MIN(f.created_at), MAX(f.created_at),
+		(array_agg(f.id::text ORDER BY f.created_at))[1:$8::int],
+		COUNT(*) OVER ()
+	FROM flags f
+	LEFT JOIN users u ON u.id = f.user_id
+	GROUP BY f.pattern, f.user_id, u.email
+	ORDER BY SUM(f.amount_bob) DESC, f.pattern, f.user_id
+	LIMIT $9 OFFSET $10
+`
+
+func (s *Server) handleGetSuspiciousActivity(c *gin.Context) {
+	threshold, err := strconv.ParseFloat(c.DefaultQuery("threshold", strconv.Itoa(regulatoryHighValueAmount)), 64)
+	if err != nil || threshold <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be a positive amount in BOB"})
+		return
+	}
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days <= 0 || days > maxSuspiciousDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("days must be between 1 and %d", maxSuspiciousDays)})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	rows, err := s.db.Query(suspiciousActivityQuery, days, threshold, rapidFireWindow, rapidFireCount,
+		structuringFloor, structuringCount, highVelocityMultiple, maxFlagTransactions, limit, offset)
+	if err != nil {
+		requestLog(c).Printf("❌ Failed to load suspicious activity: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load suspicious activity"})
+		return
+	}
+	defer rows.Close()
+
+	total := 0
+	flags := []map[string]interface{}{}
+	for rows.Next() {
+		var pattern, userID, email, volume string
+		var count int
+		var firstAt, lastAt time.Time
+		var transactionIDs []string
+		if err := rows.Scan(&pattern, &userID, &email, &count, &volume, &firstAt, &lastAt,
+			pq.Array(&transactionIDs), &total); err != nil {
+			continue
+		}
+		flags = append(flags, map[string]interface{}{
+			"pattern":           pattern,
+			"user_id":           userID,
+			"email":             email,
+			"transaction_count": count,
+			"volume_bob":        volume,
+			"first_at":          firstAt,
+			"last_at":           lastAt,
+			"transaction_ids":   transactionIDs,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"threshold": threshold,
+		"days":      days,
+		"flags":     flags,
+		"total":     total,
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
@@ -0,0 +1,235 @@
+// services/auth/account_closure.go
+package main
+
+import (
+    "context"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "golang.org/x/crypto/bcrypt"
+
+    "shared/revocation"
+)
+
+// Account closure: POST /account/close lets a user close their account once nothing of theirs
+// is in flight (no funds in any wallet or cashier balance, no open orders, disputes or pending
+// transactions). The user row stays for compliance and every transaction keeps pointing at it,
+// but the email and phone are replaced, the profile's personal data is cleared, every session
+// and API key is revoked and the account can no longer log in.
+
+type closureBlocker struct {
+    Reason string `json:"reason"`
+    Count  int    `json:"count"`
+}
+
+// accountClosureBlockers lists what keeps the user from closing their account
+func accountClosureBlockers(tx *sql.Tx, userID string) ([]closureBlocker, error) {
+    checks := []struct {
+        reason string
+        query  string
+    }{
+        {"WALLET_BALANCE", `
+            SELECT COUNT(*) FROM wallets
+            WHERE user_id = $1 AND (COALESCE(balance, 0) <> 0 OR COALESCE(locked_balance, 0) <> 0)`},
+        {"CASHIER_BALANCE", `
+            SELECT COUNT(*) FROM users
+            WHERE id = $1 AND (COALESCE(cashier_balance_usd, 0) <> 0 OR COALESCE(cashier_locked_usd, 0) <> 0
+                OR COALESCE(cashier_balance_bob, 0) <> 0 OR COALESCE(cashier_locked_bob, 0) <> 0
+                OR COALESCE(cashier_balance_usdt, 0) <> 0 OR COALESCE(cashier_locked_usdt, 0) <> 0)`},
+        {"OPEN_ORDERS", `
+            SELECT COUNT(*) FROM orders
+            WHERE (user_id = $1 OR cashier_id = $1) AND status NOT IN ('COMPLETED', 'CANCELLED', 'EXPIRED')`},
+        {"OPEN_DISPUTES", `
+            SELECT COUNT(*) FROM disputes
+            WHERE (initiator_id = $1 OR respondent_id = $1) AND status IN ('OPEN', 'IN_PROGRESS')`},
+        {"PENDING_TRANSACTIONS", `
+            SELECT COUNT(*) FROM transactions
+            WHERE user_id = $1 AND status IN ('PENDING', 'PROCESSING')`},
+    }
+
+    var blockers []closureBlocker
+    for _, check := range checks {
+        var count int
+        if err := tx.QueryRow(check.query, userID).Scan(&count); err != nil {
+            return nil, err
+        }
+        if count > 0 {
+            blockers = append(blockers, closureBlocker{Reason: check.reason, Count: count})
+        }
+    }
+    return blockers, nil
+}
+
+func (s *Server) handleCloseAccount(c *gin.Context) {
+    userID := c.GetString("user_id")
+
+    var req struct {
+        Password string `json:"password" binding:"required"`
+        Reason   string `json:"reason"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Your password is required to close the account"})
+        return
+    }
+
+    tx, err := s.db.Begin()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close account"})
+        return
+    }
+    defer tx.Rollback()
+
+    // Locking the user row keeps a concurrent close from running the checks twice
+    var email, passwordHash string
+    var closedAt sql.NullTime
+    err = tx.QueryRow(`
+        SELECT email, password_hash, closed_at FROM users WHERE id = $1 FOR UPDATE
+    `, userID).Scan(&email, &passwordHash, &closedAt)
+    if err == sql.ErrNoRows {
+        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+        return
+    }
+    if err != nil {
+        requestLog(c).Printf("Error loading user %s for closure: %v", userID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close account"})
+        return
+    }
+    if closedAt.Valid {
+        c.JSON(http.StatusConflict, gin.H{"error": "Account is already closed"})
+        return
+    }
+    if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+        return
+    }
+
+    blockers, err := accountClosureBlockers(tx, userID)
+    if err != nil {
+        requestLog(c).Printf("Error checking closure of account %s: %v", userID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close account"})
+        return
+    }
+    if len(blockers) > 0 {
+        c.JSON(http.StatusConflict, gin.H{
+            "error":    "The account cannot be closed yet: withdraw your funds and finish open orders, disputes and transactions first",
+            "code":     "ACCOUNT_CLOSURE_BLOCKED",
+            "blockers": blockers,
+        })
+        return
+    }
+
+    emailHash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+    _, err = tx.Exec(`
+        UPDATE users
+        SET closed_at = NOW(), closure_reason = NULLIF($2, ''), closed_email_hash = $3,
+            email = 'closed-' || id::text || '@closed.invalid', phone = NULL,
+            is_active = false, is_available = false, two_fa_secret = NULL, transaction_pin_hash = NULL,
+            updated_at = NOW()
+        WHERE id = $1
+    `, userID, strings.TrimSpace(req.Reason), hex.EncodeToString(emailHash[:]))
+    if err != nil {
+        requestLog(c).Printf("Error closing account %s: %v", userID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close account"})
+        return
+    }
+
+    _, err = tx.Exec(`
+        UPDATE user_profiles
+        SET first_name = NULL, last_name = NULL, ci_number = NULL, date_of_birth = NULL,
+            address = NULL, city = NULL, profile_image_url = NULL, updated_at = NOW()
+        WHERE user_id = $1
+    `, userID)
+    if err != nil {
+        requestLog(c).Printf("Error anonymizing profile of account %s: %v", userID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close account"})
+        return
+    }
+
+    // Sessions and API keys die with the account
+    if _, err := tx.Exec(`DELETE FROM refresh_tokens WHERE user_id = $1`, userID); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close account"})
+        return
+    }
+    if _, err := tx.Exec(`UPDATE api_keys SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close account"})
+        return
+    }
+    tx.Exec(`
+        INSERT INTO audit_logs (user_id, action, entity_type, entity_id, ip_address, user_agent, service)
+        VALUES ($1, 'ACCOUNT_CLOSED', 'user', $1, NULLIF($2, '')::inet, $3, 'auth')
+    `, userID, c.ClientIP(), c.Request.UserAgent())
+
+    if err := tx.Commit(); err != nil {
+        requestLog(c).Printf("Error committing closure of account %s: %v", userID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close account"})
+        return
+    }
+
+    // Access tokens already issued are still valid JWTs; the denylist makes every service's
+    // auth middleware reject them right away
+    if err := revocation.RevokeUser(context.Background(), s.redis, userID); err != nil {
+        requestLog(c).Printf("Error revoking the tokens of closed account %s: %v", userID, err)
+    }
+
+    requestLog(c).Printf("🚪 AUTH: Account %s closed by its owner", userID)
+    c.JSON(http.StatusOK, gin.H{"message": "Your account has been closed"})
+}
+
+// Admin handler listing closed accounts, most recently closed first
+func (s *Server) handleAdminGetClosedAccounts(c *gin.Context) {
+    limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+    if err != nil || limit <= 0 || limit > 200 {
+        limit = 50
+    }
+    offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+    if offset < 0 {
+        offset = 0
+    }
+
+    rows, err := s.db.Query(`
+        SELECT id, closed_at, COALESCE(closure_reason, ''), COALESCE(closed_email_hash, ''),
+            COALESCE(kyc_level, 0), created_at, COUNT(*) OVER()
+        FROM users
+        WHERE closed_at IS NOT NULL
+        ORDER BY closed_at DESC
+        LIMIT $1 OFFSET $2
+    `, limit, offset)
+    if err != nil {
+        requestLog(c).Printf("Error loading closed accounts: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load closed accounts"})
+        return
+    }
+    defer rows.Close()
+
+    total := 0
+    accounts := []gin.H{}
+    for rows.Next() {
+        var id, reason, emailHash string
+        var kycLevel int
+        var closedAt, createdAt time.Time
+        if err := rows.Scan(&id, &closedAt, &reason, &emailHash, &kycLevel, &createdAt, &total); err != nil {
+            continue
+        }
+        accounts = append(accounts, gin.H{
+            "user_id":           id,
+            "closed_at":         closedAt,
+            "closure_reason":    reason,
+            "closed_email_hash": emailHash,
+            "kyc_level":         kycLevel,
+            "created_at":        createdAt,
+        })
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "accounts": accounts,
+        "total":    total,
+        "limit":    limit,
+        "offset":   offset,
+    })
+}
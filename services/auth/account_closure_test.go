@@ -0,0 +1,55 @@
+// services/auth/account_closure_test.go
+package main
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/alicebob/miniredis/v2"
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+    "github.com/golang-jwt/jwt/v5"
+
+    "shared/revocation"
+)
+
+func TestAuthMiddlewareRejectsClosedAccounts(t *testing.T) {
+    t.Setenv("JWT_SECRET", "test-secret")
+    gin.SetMode(gin.TestMode)
+
+    mr := miniredis.RunT(t)
+    client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+    defer client.Close()
+
+    s := &Server{redis: client}
+    router := gin.New()
+    router.GET("/profile", s.authMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+    token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+        "user_id": "user-1",
+        "exp":     time.Now().Add(15 * time.Minute).Unix(),
+    }).SignedString([]byte("test-secret"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    getProfile := func() int {
+        w := httptest.NewRecorder()
+        req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+        req.Header.Set("Authorization", "Bearer "+token)
+        router.ServeHTTP(w, req)
+        return w.Code
+    }
+
+    if code := getProfile(); code != http.StatusOK {
+        t.Fatalf("status before closure = %d, want 200", code)
+    }
+    if err := revocation.RevokeUser(context.Background(), client, "user-1"); err != nil {
+        t.Fatal(err)
+    }
+    if code := getProfile(); code != http.StatusUnauthorized {
+        t.Errorf("status after closure = %d, want 401 for the still unexpired token", code)
+    }
+}
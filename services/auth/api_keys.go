@@ -0,0 +1,187 @@
+// services/auth/api_keys.go
+package main
+
+import (
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/lib/pq"
+)
+
+const (
+    apiKeyPrefix           = "p2pb_"
+    apiKeyPrefixLength     = 12
+    defaultAPIKeyRateLimit = 60
+    maxAPIKeyRateLimit     = 600
+    maxAPIKeysPerUser      = 10
+)
+
+// Scopes understood by the services that accept API keys. "read" grants every
+// read-only market endpoint, the others restrict a key to a single endpoint.
+var validAPIKeyScopes = map[string]bool{
+    "read":      true,
+    "rates":     true,
+    "orderbook": true,
+    "orders":    true,
+}
+
+type APIKey struct {
+    ID                 string     `json:"id"`
+    Name               string     `json:"name"`
+    KeyPrefix          string     `json:"key_prefix"`
+    Scopes             []string   `json:"scopes"`
+    RateLimitPerMinute int        `json:"rate_limit_per_minute"`
+    LastUsedAt         *time.Time `json:"last_used_at"`
+    RevokedAt          *time.Time `json:"revoked_at"`
+    CreatedAt          time.Time  `json:"created_at"`
+}
+
+type CreateAPIKeyRequest struct {
+    Name               string   `json:"name" binding:"required,max=100"`
+    Scopes             []string `json:"scopes"`
+    RateLimitPerMinute int      `json:"rate_limit_per_minute"`
+}
+
+// generateAPIKey returns a new secret and the SHA-256 hex digest stored in the database
+func generateAPIKey() (string, string, error) {
+    raw := make([]byte, 32)
+    if _, err := rand.Read(raw); err != nil {
+        return "", "", err
+    }
+
+    secret := apiKeyPrefix + hex.EncodeToString(raw)
+    return secret, hashAPIKey(secret), nil
+}
+
+func hashAPIKey(secret string) string {
+    sum := sha256.Sum256([]byte(secret))
+    return hex.EncodeToString(sum[:])
+}
+
+func (s *Server) handleCreateAPIKey(c *gin.Context) {
+    userID := c.GetString("user_id")
+
+    var req CreateAPIKeyRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    if len(req.Scopes) == 0 {
+        req.Scopes = []string{"read"}
+    }
+    for _, scope := range req.Scopes {
+        if !validAPIKeyScopes[scope] {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope: " + scope})
+            return
+        }
+    }
+
+    if req.RateLimitPerMinute == 0 {
+        req.RateLimitPerMinute = defaultAPIKeyRateLimit
+    }
+    if req.RateLimitPerMinute < 0 || req.RateLimitPerMinute > maxAPIKeyRateLimit {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "rate_limit_per_minute must be between 1 and 600"})
+        return
+    }
+
+    var activeKeys int
+    s.db.QueryRow(`
+        SELECT COUNT(*) FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL
+    `, userID).Scan(&activeKeys)
+    if activeKeys >= maxAPIKeysPerUser {
+        c.JSON(http.StatusConflict, gin.H{"error": "Maximum number of active API keys reached"})
+        return
+    }
+
+    secret, keyHash, err := generateAPIKey()
+    if err != nil {
+        requestLog(c).Printf("Error generating API key: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+        return
+    }
+
+    key := APIKey{
+        Name:               req.Name,
+        KeyPrefix:          secret[:apiKeyPrefixLength],
+        Scopes:             req.Scopes,
+        RateLimitPerMinute: req.RateLimitPerMinute,
+    }
+
+    err = s.db.QueryRow(`
+        INSERT INTO api_keys (user_id, name, key_prefix, key_hash, scopes, rate_limit_per_minute)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id, created_at
+    `, userID, key.Name, key.KeyPrefix, keyHash, pq.Array(key.Scopes), key.RateLimitPerMinute).Scan(&key.ID, &key.CreatedAt)
+    if err != nil {
+        requestLog(c).Printf("Error storing API key for user %s: %v", userID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+        return
+    }
+
+    requestLog(c).Printf("🔑 API key %s created for user %s", key.ID, userID)
+
+    // The secret is only ever returned here
+    c.JSON(http.StatusCreated, gin.H{
+        "api_key": key,
+        "secret":  secret,
+        "message": "Store this secret now, it will not be shown again",
+    })
+}
+
+func (s *Server) handleListAPIKeys(c *gin.Context) {
+    userID := c.GetString("user_id")
+
+    rows, err := s.db.Query(`
+        SELECT id, name, key_prefix, scopes, rate_limit_per_minute, last_used_at, revoked_at, created_at
+        FROM api_keys
+        WHERE user_id = $1
+        ORDER BY created_at DESC
+    `, userID)
+    if err != nil {
+        requestLog(c).Printf("Error listing API keys for user %s: %v", userID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list API keys"})
+        return
+    }
+    defer rows.Close()
+
+    keys := []APIKey{}
+    for rows.Next() {
+        var key APIKey
+        if err := rows.Scan(&key.ID, &key.Name, &key.KeyPrefix, pq.Array(&key.Scopes),
+            &key.RateLimitPerMinute, &key.LastUsedAt, &key.RevokedAt, &key.CreatedAt); err != nil {
+            requestLog(c).Printf("Error scanning API key: %v", err)
+            continue
+        }
+        keys = append(keys, key)
+    }
+
+    c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+func (s *Server) handleRevokeAPIKey(c *gin.Context) {
+    userID := c.GetString("user_id")
+    keyID := c.Param("id")
+
+    result, err := s.db.Exec(`
+        UPDATE api_keys SET revoked_at = NOW()
+        WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+    `, keyID, userID)
+    if err != nil {
+        requestLog(c).Printf("Error revoking API key %s: %v", keyID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+        return
+    }
+
+    if affected, _ := result.RowsAffected(); affected == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+        return
+    }
+
+    requestLog(c).Printf("🔒 API key %s revoked by user %s", keyID, userID)
+    c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
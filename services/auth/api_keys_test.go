@@ -0,0 +1,117 @@
+// services/auth/api_keys_test.go
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/gin-gonic/gin"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+    secret, keyHash, err := generateAPIKey()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.HasPrefix(secret, apiKeyPrefix) || len(secret) != len(apiKeyPrefix)+64 {
+        t.Errorf("secret = %q, want %s followed by 64 hex characters", secret, apiKeyPrefix)
+    }
+
+    sum := sha256.Sum256([]byte(secret))
+    if keyHash != hex.EncodeToString(sum[:]) || keyHash != hashAPIKey(secret) {
+        t.Errorf("hash = %s, want the SHA-256 hex digest of the secret", keyHash)
+    }
+
+    other, _, _ := generateAPIKey()
+    if other == secret {
+        t.Error("generateAPIKey() returned the same secret twice")
+    }
+}
+
+func TestCreateAPIKeyStoresOnlyTheHash(t *testing.T) {
+    db, mock, err := sqlmock.New()
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer db.Close()
+
+    var stored string
+    mock.ExpectQuery(`SELECT COUNT\(\*\) FROM api_keys`).WithArgs("user-1").
+        WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(int64(0)))
+    mock.ExpectQuery(`INSERT INTO api_keys`).
+        WithArgs("user-1", "Exchange bot", sqlmock.AnyArg(), capturedToken{&stored}, `{"rates","orderbook"}`, 120).
+        WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("key-1", time.Now()))
+
+    gin.SetMode(gin.TestMode)
+    router := gin.New()
+    router.POST("/api-keys", func(c *gin.Context) { c.Set("user_id", "user-1") }, (&Server{db: db}).handleCreateAPIKey)
+
+    w := jsonRequest(router, "/api-keys", `{"name":"Exchange bot","scopes":["rates","orderbook"],"rate_limit_per_minute":120}`)
+    if w.Code != http.StatusCreated {
+        t.Fatalf("status = %d, want 201: %s", w.Code, w.Body.String())
+    }
+
+    var response struct {
+        APIKey APIKey `json:"api_key"`
+        Secret string `json:"secret"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+        t.Fatal(err)
+    }
+    if stored == response.Secret || stored != hashAPIKey(response.Secret) {
+        t.Errorf("stored %q, want the hash of the returned secret", stored)
+    }
+    if response.APIKey.KeyPrefix != response.Secret[:apiKeyPrefixLength] {
+        t.Errorf("key_prefix = %q, want the first %d characters of the secret", response.APIKey.KeyPrefix, apiKeyPrefixLength)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestCreateAPIKeyValidatesScopesAndRateLimit(t *testing.T) {
+    tests := []struct {
+        name       string
+        body       string
+        activeKeys int64 // -1 when the request is rejected before counting keys
+        wantStatus int
+    }{
+        {name: "unknown scope", body: `{"name":"bot","scopes":["withdraw"]}`, activeKeys: -1, wantStatus: http.StatusBadRequest},
+        {name: "negative rate limit", body: `{"name":"bot","rate_limit_per_minute":-1}`, activeKeys: -1, wantStatus: http.StatusBadRequest},
+        {name: "rate limit above the maximum", body: `{"name":"bot","rate_limit_per_minute":601}`, activeKeys: -1,
+            wantStatus: http.StatusBadRequest},
+        {name: "too many active keys", body: `{"name":"bot"}`, activeKeys: maxAPIKeysPerUser, wantStatus: http.StatusConflict},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            db, mock, err := sqlmock.New()
+            if err != nil {
+                t.Fatal(err)
+            }
+            defer db.Close()
+
+            if tt.activeKeys >= 0 {
+                mock.ExpectQuery(`SELECT COUNT\(\*\) FROM api_keys`).WithArgs("user-1").
+                    WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.activeKeys))
+            }
+
+            gin.SetMode(gin.TestMode)
+            router := gin.New()
+            router.POST("/api-keys", func(c *gin.Context) { c.Set("user_id", "user-1") }, (&Server{db: db}).handleCreateAPIKey)
+
+            if w := jsonRequest(router, "/api-keys", tt.body); w.Code != tt.wantStatus {
+                t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+            }
+            if err := mock.ExpectationsWereMet(); err != nil {
+                t.Error(err)
+            }
+        })
+    }
+}
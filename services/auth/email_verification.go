@@ -0,0 +1,107 @@
+// services/auth/email_verification.go
+package main
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+// sendEmailVerification issues a new verification token for the user and delivers it
+func (s *Server) sendEmailVerification(userID, email string) error {
+    tokenBytes := make([]byte, 32)
+    if _, err := rand.Read(tokenBytes); err != nil {
+        return err
+    }
+    token := hex.EncodeToString(tokenBytes)
+
+    _, err := s.db.Exec(`
+        INSERT INTO email_verifications (user_id, token, expires_at)
+        VALUES ($1, $2, $3)
+    `, userID, token, time.Now().Add(emailVerificationTTL))
+    if err != nil {
+        return err
+    }
+
+    return s.notifier.SendEmailVerification(email, token)
+}
+
+// Verify email handler
+func (s *Server) handleVerifyEmail(c *gin.Context) {
+    var req struct {
+        Token string `json:"token" binding:"required"`
+    }
+
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    tx, err := s.db.Begin()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+        return
+    }
+    defer tx.Rollback()
+
+    var userID string
+    err = tx.QueryRow(`
+        UPDATE email_verifications SET used_at = NOW()
+        WHERE token = $1 AND used_at IS NULL AND expires_at > NOW()
+        RETURNING user_id
+    `, req.Token).Scan(&userID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+        return
+    }
+
+    if _, err := tx.Exec(`UPDATE users SET is_verified = true WHERE id = $1`, userID); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+        return
+    }
+
+    if err := tx.Commit(); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+        return
+    }
+
+    requestLog(c).Printf("✅ AUTH: Email verified for user %s", userID)
+    c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// Resend verification handler
+func (s *Server) handleResendVerification(c *gin.Context) {
+    userID := c.GetString("user_id")
+
+    var email string
+    var isVerified bool
+    err := s.db.QueryRow(`SELECT email, is_verified FROM users WHERE id = $1`, userID).Scan(&email, &isVerified)
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+        return
+    }
+
+    if isVerified {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Email is already verified"})
+        return
+    }
+
+    // Only the newest link stays valid
+    s.db.Exec(`
+        UPDATE email_verifications SET expires_at = NOW()
+        WHERE user_id = $1 AND used_at IS NULL AND expires_at > NOW()
+    `, userID)
+
+    if err := s.sendEmailVerification(userID, email); err != nil {
+        requestLog(c).Printf("❌ AUTH: Failed to send verification email to user %s: %v", userID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
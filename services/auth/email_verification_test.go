@@ -0,0 +1,131 @@
+// services/auth/email_verification_test.go
+package main
+
+import (
+    "database/sql/driver"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/gin-gonic/gin"
+)
+
+// recordingNotifier keeps what would have been emailed
+type recordingNotifier struct {
+    verifications []sentEmail
+    resets        []sentEmail
+}
+
+type sentEmail struct {
+    email, token string
+}
+
+func (n *recordingNotifier) SendEmailVerification(email, token string) error {
+    n.verifications = append(n.verifications, sentEmail{email, token})
+    return nil
+}
+
+func (n *recordingNotifier) SendPasswordReset(email, token string) error {
+    n.resets = append(n.resets, sentEmail{email, token})
+    return nil
+}
+
+// capturedToken matches any token and remembers it
+type capturedToken struct{ value *string }
+
+func (a capturedToken) Match(v driver.Value) bool {
+    token, ok := v.(string)
+    *a.value = token
+    return ok && len(token) == 64
+}
+
+func jsonRequest(router *gin.Engine, path, body string) *httptest.ResponseRecorder {
+    w := httptest.NewRecorder()
+    req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+    req.Header.Set("Content-Type", "application/json")
+    router.ServeHTTP(w, req)
+    return w
+}
+
+func TestResendVerificationSendsTheStoredToken(t *testing.T) {
+    db, mock, err := sqlmock.New()
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer db.Close()
+
+    var stored string
+    mock.ExpectQuery(`SELECT email, is_verified FROM users`).WithArgs("user-1").
+        WillReturnRows(sqlmock.NewRows([]string{"email", "is_verified"}).AddRow("ana@example.com", false))
+    mock.ExpectExec(`UPDATE email_verifications SET expires_at = NOW\(\)`).WithArgs("user-1").
+        WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectExec(`INSERT INTO email_verifications`).WithArgs("user-1", capturedToken{&stored}, sqlmock.AnyArg()).
+        WillReturnResult(sqlmock.NewResult(0, 1))
+
+    gin.SetMode(gin.TestMode)
+    notifier := &recordingNotifier{}
+    s := &Server{db: db, notifier: notifier}
+    router := gin.New()
+    router.POST("/resend-verification", func(c *gin.Context) { c.Set("user_id", "user-1") }, s.handleResendVerification)
+
+    if w := jsonRequest(router, "/resend-verification", ""); w.Code != http.StatusOK {
+        t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+    }
+    if len(notifier.verifications) != 1 {
+        t.Fatalf("sent %d verification emails, want 1", len(notifier.verifications))
+    }
+    if sent := notifier.verifications[0]; sent.email != "ana@example.com" || sent.token != stored {
+        t.Errorf("sent %+v, want the stored token %s to ana@example.com", sent, stored)
+    }
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestVerifyEmail(t *testing.T) {
+    tests := []struct {
+        name       string
+        valid      bool
+        wantStatus int
+    }{
+        {name: "valid token", valid: true, wantStatus: http.StatusOK},
+        {name: "used or expired token", wantStatus: http.StatusBadRequest},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            db, mock, err := sqlmock.New()
+            if err != nil {
+                t.Fatal(err)
+            }
+            defer db.Close()
+
+            mock.ExpectBegin()
+            rows := sqlmock.NewRows([]string{"user_id"})
+            if tt.valid {
+                rows.AddRow("user-1")
+            }
+            mock.ExpectQuery(`UPDATE email_verifications SET used_at = NOW\(\)\s+WHERE token = \$1 AND used_at IS NULL AND expires_at > NOW\(\)`).
+                WithArgs("token-1").WillReturnRows(rows)
+            if tt.valid {
+                mock.ExpectExec(`UPDATE users SET is_verified = true`).WithArgs("user-1").WillReturnResult(sqlmock.NewResult(0, 1))
+                mock.ExpectCommit()
+            } else {
+                mock.ExpectRollback()
+            }
+
+            gin.SetMode(gin.TestMode)
+            router := gin.New()
+            router.POST("/verify-email", (&Server{db: db}).handleVerifyEmail)
+
+            if w := jsonRequest(router, "/verify-email", `{"token":"token-1"}`); w.Code != tt.wantStatus {
+                t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+            }
+            if err := mock.ExpectationsWereMet(); err != nil {
+                t.Error(err)
+            }
+        })
+    }
+}
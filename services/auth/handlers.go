@@ -4,7 +4,6 @@ package main
 import (
     "context"
     "database/sql"
-    "log"
     "net/http"
     "os"
     "strings"
@@ -51,31 +50,31 @@ type User struct {
 
 // Register handler
 func (s *Server) handleRegister(c *gin.Context) {
-    log.Printf("🔐 AUTH: Registration request received from %s", c.ClientIP())
-    log.Printf("🔐 AUTH: Request headers: %v", c.Request.Header)
+    requestLog(c).Printf("🔐 AUTH: Registration request received from %s", c.ClientIP())
+    requestLog(c).Printf("🔐 AUTH: Request headers: %v", c.Request.Header)
     
     var req RegisterRequest
     if err := c.ShouldBindJSON(&req); err != nil {
-        log.Printf("❌ AUTH: Failed to bind JSON: %v", err)
+        requestLog(c).Printf("❌ AUTH: Failed to bind JSON: %v", err)
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
 
-    log.Printf("🔐 AUTH: Registration data received - Email: %s, FirstName: %s, LastName: %s, Phone: %s", 
+    requestLog(c).Printf("🔐 AUTH: Registration data received - Email: %s, FirstName: %s, LastName: %s, Phone: %s", 
         req.Email, req.FirstName, req.LastName, req.Phone)
 
     // Hash password
-    log.Printf("🔐 AUTH: Hashing password")
+    requestLog(c).Printf("🔐 AUTH: Hashing password")
     hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
     if err != nil {
-        log.Printf("❌ AUTH: Failed to hash password: %v", err)
+        requestLog(c).Printf("❌ AUTH: Failed to hash password: %v", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
         return
     }
 
     // Create user
     userID := uuid.New().String()
-    log.Printf("🔐 AUTH: Generated user ID: %s", userID)
+    requestLog(c).Printf("🔐 AUTH: Generated user ID: %s", userID)
     
     // Handle empty phone to avoid unique constraint violation
     var phone interface{}
@@ -85,14 +84,14 @@ func (s *Server) handleRegister(c *gin.Context) {
         phone = nil
     }
     
-    log.Printf("🔐 AUTH: Creating user in database")
+    requestLog(c).Printf("🔐 AUTH: Creating user in database")
     _, err = s.db.Exec(`
         INSERT INTO users (id, email, phone, password_hash)
         VALUES ($1, $2, $3, $4)
     `, userID, req.Email, phone, string(hashedPassword))
 
     if err != nil {
-        log.Printf("❌ AUTH: Database error during user creation: %v", err)
+        requestLog(c).Printf("❌ AUTH: Database error during user creation: %v", err)
         if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "UNIQUE constraint") {
             c.JSON(http.StatusConflict, gin.H{"error": "Email or phone already exists"})
             return
@@ -101,24 +100,24 @@ func (s *Server) handleRegister(c *gin.Context) {
         return
     }
     
-    log.Printf("✅ AUTH: User created successfully in database")
+    requestLog(c).Printf("✅ AUTH: User created successfully in database")
 
     // Create user profile if firstName or lastName provided
     if req.FirstName != "" || req.LastName != "" {
-        log.Printf("🔐 AUTH: Creating user profile")
+        requestLog(c).Printf("🔐 AUTH: Creating user profile")
         _, err = s.db.Exec(`
             INSERT INTO user_profiles (user_id, first_name, last_name)
             VALUES ($1, $2, $3)
         `, userID, req.FirstName, req.LastName)
         if err != nil {
-            log.Printf("❌ AUTH: Failed to create user profile: %v", err)
+            requestLog(c).Printf("❌ AUTH: Failed to create user profile: %v", err)
         } else {
-            log.Printf("✅ AUTH: User profile created successfully")
+            requestLog(c).Printf("✅ AUTH: User profile created successfully")
         }
     }
 
     // Create wallets for default currencies
-    log.Printf("🔐 AUTH: Creating default wallets")
+    requestLog(c).Printf("🔐 AUTH: Creating default wallets")
     currencies := []string{"BOB", "USD", "USDT"}
     for _, currency := range currencies {
         _, err = s.db.Exec(`
@@ -126,30 +125,35 @@ func (s *Server) handleRegister(c *gin.Context) {
             VALUES ($1, $2, 0, 0)
         `, userID, currency)
         if err != nil {
-            log.Printf("❌ AUTH: Failed to create wallet for currency %s: %v", currency, err)
+            requestLog(c).Printf("❌ AUTH: Failed to create wallet for currency %s: %v", currency, err)
         } else {
-            log.Printf("✅ AUTH: Created wallet for %s", currency)
+            requestLog(c).Printf("✅ AUTH: Created wallet for %s", currency)
         }
     }
 
+    // Send the email verification link
+    if err := s.sendEmailVerification(userID, req.Email); err != nil {
+        requestLog(c).Printf("❌ AUTH: Failed to send verification email: %v", err)
+    }
+
     // Generate tokens
-    log.Printf("🔐 AUTH: Generating access token")
+    requestLog(c).Printf("🔐 AUTH: Generating access token")
     accessToken, err := s.generateAccessToken(userID)
     if err != nil {
-        log.Printf("❌ AUTH: Failed to generate access token: %v", err)
+        requestLog(c).Printf("❌ AUTH: Failed to generate access token: %v", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
         return
     }
 
-    log.Printf("🔐 AUTH: Generating refresh token")
+    requestLog(c).Printf("🔐 AUTH: Generating refresh token")
     refreshToken, err := s.generateRefreshToken(userID)
     if err != nil {
-        log.Printf("❌ AUTH: Failed to generate refresh token: %v", err)
+        requestLog(c).Printf("❌ AUTH: Failed to generate refresh token: %v", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
         return
     }
 
-    log.Printf("✅ AUTH: Registration completed successfully for user %s", userID)
+    requestLog(c).Printf("✅ AUTH: Registration completed successfully for user %s", userID)
     response := AuthResponse{
         UserID:       userID,
         AccessToken:  accessToken,
@@ -157,65 +161,77 @@ func (s *Server) handleRegister(c *gin.Context) {
         ExpiresIn:    900, // 15 minutes
     }
     
-    log.Printf("📤 AUTH: Sending registration response")
+    requestLog(c).Printf("📤 AUTH: Sending registration response")
     c.JSON(http.StatusCreated, response)
 }
 
 // Login handler
 func (s *Server) handleLogin(c *gin.Context) {
-    log.Printf("🔑 LOGIN: Starting login process")
-    log.Printf("🌐 LOGIN: Request method: %s, path: %s", c.Request.Method, c.Request.URL.Path)
-    log.Printf("📋 LOGIN: Request headers: Content-Type: %s", c.GetHeader("Content-Type"))
+    requestLog(c).Printf("🔑 LOGIN: Starting login process")
+    requestLog(c).Printf("🌐 LOGIN: Request method: %s, path: %s", c.Request.Method, c.Request.URL.Path)
+    requestLog(c).Printf("📋 LOGIN: Request headers: Content-Type: %s", c.GetHeader("Content-Type"))
     
     var req LoginRequest
     if err := c.ShouldBindJSON(&req); err != nil {
-        log.Printf("❌ LOGIN: Invalid request format: %v", err)
-        log.Printf("❌ LOGIN: Request body binding failed, raw body may be malformed")
+        requestLog(c).Printf("❌ LOGIN: Invalid request format: %v", err)
+        requestLog(c).Printf("❌ LOGIN: Request body binding failed, raw body may be malformed")
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
 
-    log.Printf("📧 LOGIN: Attempting login for email: %s", req.Email)
-    log.Printf("🔐 LOGIN: Password provided: %t (length: %d)", req.Password != "", len(req.Password))
+    requestLog(c).Printf("📧 LOGIN: Attempting login for email: %s", req.Email)
+    requestLog(c).Printf("🔐 LOGIN: Password provided: %t (length: %d)", req.Password != "", len(req.Password))
 
     // Find user by email or phone
     var user User
+    var lockedUntil sql.NullTime
     err := s.db.QueryRow(`
-        SELECT id, email, COALESCE(phone, '') as phone, password_hash, is_verified, kyc_level, COALESCE(role, 'user') as role
+        SELECT id, email, COALESCE(phone, '') as phone, password_hash, is_verified, kyc_level, COALESCE(role, 'user') as role, locked_until
         FROM users
-        WHERE email = $1 OR COALESCE(phone, '') = $1
-    `, req.Email).Scan(&user.ID, &user.Email, &user.Phone, &user.PasswordHash, &user.IsVerified, &user.KYCLevel, &user.Role)
+        WHERE (email = $1 OR COALESCE(phone, '') = $1) AND closed_at IS NULL
+    `, req.Email).Scan(&user.ID, &user.Email, &user.Phone, &user.PasswordHash, &user.IsVerified, &user.KYCLevel, &user.Role, &lockedUntil)
 
     if err != nil {
-        log.Printf("❌ LOGIN: User not found for email '%s': %v", req.Email, err)
+        requestLog(c).Printf("❌ LOGIN: User not found for email '%s': %v", req.Email, err)
         c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
         return
     }
 
-    log.Printf("👤 LOGIN: Found user %s, verifying password", user.ID)
+    if lockedUntil.Valid && lockedUntil.Time.After(time.Now()) {
+        requestLog(c).Printf("🔒 LOGIN: User %s is locked until %s", user.ID, lockedUntil.Time.Format(time.RFC3339))
+        respondAccountLocked(c, lockedUntil.Time)
+        return
+    }
+
+    requestLog(c).Printf("👤 LOGIN: Found user %s, verifying password", user.ID)
 
     // Verify password
     if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-        log.Printf("❌ LOGIN: Password verification failed for user %s: %v", user.ID, err)
+        requestLog(c).Printf("❌ LOGIN: Password verification failed for user %s: %v", user.ID, err)
+        if until, locked := s.recordFailedLogin(user.ID); locked {
+            respondAccountLocked(c, until)
+            return
+        }
         c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
         return
     }
 
-    log.Printf("✅ LOGIN: Password verification successful for user %s", user.ID)
+    requestLog(c).Printf("✅ LOGIN: Password verification successful for user %s", user.ID)
+    s.resetFailedLogins(user.ID)
 
     // Generate tokens
-    log.Printf("🔑 LOGIN: Generating access token for user %s", user.ID)
+    requestLog(c).Printf("🔑 LOGIN: Generating access token for user %s", user.ID)
     accessToken, err := s.generateAccessToken(user.ID)
     if err != nil {
-        log.Printf("❌ LOGIN: Failed to generate access token: %v", err)
+        requestLog(c).Printf("❌ LOGIN: Failed to generate access token: %v", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
         return
     }
 
-    log.Printf("🔄 LOGIN: Generating refresh token for user %s", user.ID)
+    requestLog(c).Printf("🔄 LOGIN: Generating refresh token for user %s", user.ID)
     refreshToken, err := s.generateRefreshToken(user.ID)
     if err != nil {
-        log.Printf("❌ LOGIN: Failed to generate refresh token: %v", err)
+        requestLog(c).Printf("❌ LOGIN: Failed to generate refresh token: %v", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
         return
     }
@@ -227,8 +243,8 @@ func (s *Server) handleLogin(c *gin.Context) {
         ExpiresIn:    900,
     }
     
-    log.Printf("✅ LOGIN: Login successful for user %s, sending response", user.ID)
-    log.Printf("📤 LOGIN: Response data - UserID: %s, TokenLength: %d, ExpiresIn: %d", 
+    requestLog(c).Printf("✅ LOGIN: Login successful for user %s, sending response", user.ID)
+    requestLog(c).Printf("📤 LOGIN: Response data - UserID: %s, TokenLength: %d, ExpiresIn: %d", 
         response.UserID, len(response.AccessToken), response.ExpiresIn)
     
     c.JSON(http.StatusOK, response)
@@ -249,8 +265,9 @@ func (s *Server) handleRefresh(c *gin.Context) {
     var userID string
     var expiresAt time.Time
     err := s.db.QueryRow(`
-        SELECT user_id, expires_at FROM refresh_tokens
-        WHERE token = $1
+        SELECT rt.user_id, rt.expires_at FROM refresh_tokens rt
+        JOIN users u ON u.id = rt.user_id
+        WHERE rt.token = $1 AND u.closed_at IS NULL
     `, req.RefreshToken).Scan(&userID, &expiresAt)
 
     if err != nil {
@@ -302,28 +319,13 @@ func (s *Server) handleLogout(c *gin.Context) {
     c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
-// Verify email handler
-func (s *Server) handleVerifyEmail(c *gin.Context) {
-    var req struct {
-        Token string `json:"token" binding:"required"`
-    }
-
-    if err := c.ShouldBindJSON(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-        return
-    }
-
-    // TODO: Implement email verification logic
-    c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
-}
-
 // Get profile handler
 func (s *Server) handleGetProfile(c *gin.Context) {
     userID := c.GetString("user_id")
-    log.Printf("DEBUG: Received user_id from context: '%s'", userID)
+    requestLog(c).Printf("DEBUG: Received user_id from context: '%s'", userID)
 
     if userID == "" {
-        log.Printf("DEBUG: user_id is empty")
+        requestLog(c).Printf("DEBUG: user_id is empty")
         c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
         return
     }
@@ -340,7 +342,7 @@ func (s *Server) handleGetProfile(c *gin.Context) {
     `, userID).Scan(&user.ID, &user.Email, &user.Phone, &user.IsVerified, &user.KYCLevel, &user.Role, &user.CreatedAt, &firstName, &lastName)
 
     if err != nil {
-        log.Printf("DEBUG: Database query error for user_id '%s': %v", userID, err)
+        requestLog(c).Printf("DEBUG: Database query error for user_id '%s': %v", userID, err)
         c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
         return
     }
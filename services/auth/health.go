@@ -0,0 +1,89 @@
+// services/auth/health.go
+package main
+
+import (
+    "context"
+    "database/sql"
+    "net/http"
+    "os"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+)
+
+// GET /ready (and GET /health, kept for existing probes) answers 503 when Postgres or Redis does
+// not answer a ping within HEALTH_CHECK_TIMEOUT (default 2s). GET /live only says the process is up.
+
+const defaultHealthCheckTimeout = 2 * time.Second
+
+type healthCheck struct {
+    name  string
+    check func(ctx context.Context) error
+}
+
+func healthCheckTimeout() time.Duration {
+    if value, err := time.ParseDuration(os.Getenv("HEALTH_CHECK_TIMEOUT")); err == nil && value > 0 {
+        return value
+    }
+    return defaultHealthCheckTimeout
+}
+
+func databaseCheck(db *sql.DB) healthCheck {
+    return healthCheck{name: "database", check: db.PingContext}
+}
+
+func redisCheck(client *redis.Client) healthCheck {
+    return healthCheck{name: "redis", check: func(ctx context.Context) error {
+        return client.Ping(ctx).Err()
+    }}
+}
+
+// setupHealthRoutes registers /live, /ready and /health
+func setupHealthRoutes(router *gin.Engine, service string, checks ...healthCheck) {
+    router.GET("/live", func(c *gin.Context) {
+        c.JSON(http.StatusOK, gin.H{"status": "alive", "service": service})
+    })
+
+    ready := func(c *gin.Context) {
+        statuses, healthy := runHealthChecks(checks)
+        if !healthy {
+            c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unhealthy", "service": service, "checks": statuses})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"status": "healthy", "service": service, "checks": statuses})
+    }
+    router.GET("/ready", ready)
+    router.GET("/health", ready)
+}
+
+// runHealthChecks runs the checks concurrently under one timeout and reports "ok" or the error of
+// each
+func runHealthChecks(checks []healthCheck) (map[string]string, bool) {
+    ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout())
+    defer cancel()
+
+    errs := make([]error, len(checks))
+    var wg sync.WaitGroup
+    for i, hc := range checks {
+        wg.Add(1)
+        go func(i int, hc healthCheck) {
+            defer wg.Done()
+            errs[i] = hc.check(ctx)
+        }(i, hc)
+    }
+    wg.Wait()
+
+    statuses := make(map[string]string, len(checks))
+    healthy := true
+    for i, hc := range checks {
+        if errs[i] != nil {
+            statuses[hc.name] = errs[i].Error()
+            healthy = false
+            continue
+        }
+        statuses[hc.name] = "ok"
+    }
+    return statuses, healthy
+}
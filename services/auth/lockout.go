@@ -0,0 +1,146 @@
+// services/auth/lockout.go
+package main
+
+import (
+    "database/sql"
+    "encoding/json"
+    "log"
+    "net/http"
+    "os"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// Account lockout complements the per-IP rate limiter: failed passwords are counted on the
+// user row, and once ACCOUNT_LOCKOUT_THRESHOLD is reached the account is locked for
+// ACCOUNT_LOCKOUT_BASE_MINUTES, doubling with every further failure up to a day.
+
+const (
+    defaultLockoutThreshold = 5
+    defaultLockoutBase      = 15 * time.Minute
+    maxLockoutDuration      = 24 * time.Hour
+)
+
+func lockoutThreshold() int {
+    if value, err := strconv.Atoi(os.Getenv("ACCOUNT_LOCKOUT_THRESHOLD")); err == nil && value > 0 {
+        return value
+    }
+    return defaultLockoutThreshold
+}
+
+func lockoutBaseDuration() time.Duration {
+    if value, err := strconv.Atoi(os.Getenv("ACCOUNT_LOCKOUT_BASE_MINUTES")); err == nil && value > 0 {
+        return time.Duration(value) * time.Minute
+    }
+    return defaultLockoutBase
+}
+
+// lockoutDuration returns how long to lock an account after failedCount consecutive failures
+func lockoutDuration(failedCount int) time.Duration {
+    threshold := lockoutThreshold()
+    if failedCount < threshold {
+        return 0
+    }
+
+    // Doubled step by step: 2^n overflows a Duration long before n runs out of failures
+    duration := lockoutBaseDuration()
+    for i := threshold; i < failedCount && duration < maxLockoutDuration; i++ {
+        duration *= 2
+    }
+    if duration > maxLockoutDuration {
+        return maxLockoutDuration
+    }
+    return duration
+}
+
+// recordFailedLogin bumps the failure counter and locks the account once the threshold is hit
+func (s *Server) recordFailedLogin(userID string) (time.Time, bool) {
+    var failedCount int
+    err := s.db.QueryRow(`
+        UPDATE users SET failed_login_count = COALESCE(failed_login_count, 0) + 1
+        WHERE id = $1
+        RETURNING failed_login_count
+    `, userID).Scan(&failedCount)
+    if err != nil {
+        log.Printf("❌ LOGIN: Failed to record failed login for user %s: %v", userID, err)
+        return time.Time{}, false
+    }
+
+    duration := lockoutDuration(failedCount)
+    if duration == 0 {
+        return time.Time{}, false
+    }
+
+    lockedUntil := time.Now().Add(duration)
+    s.db.Exec(`UPDATE users SET locked_until = $1 WHERE id = $2`, lockedUntil, userID)
+    log.Printf("🔒 LOGIN: User %s locked until %s after %d failed logins", userID, lockedUntil.Format(time.RFC3339), failedCount)
+
+    return lockedUntil, true
+}
+
+func (s *Server) resetFailedLogins(userID string) {
+    s.db.Exec(`
+        UPDATE users SET failed_login_count = 0, locked_until = NULL
+        WHERE id = $1 AND (COALESCE(failed_login_count, 0) > 0 OR locked_until IS NOT NULL)
+    `, userID)
+}
+
+func respondAccountLocked(c *gin.Context, lockedUntil time.Time) {
+    retryAfter := int(time.Until(lockedUntil).Seconds()) + 1
+    c.Header("Retry-After", strconv.Itoa(retryAfter))
+    c.JSON(http.StatusLocked, gin.H{
+        "error":        "Account temporarily locked due to too many failed login attempts",
+        "locked_until": lockedUntil,
+        "retry_after":  retryAfter,
+    })
+}
+
+// Admin unlock handler
+func (s *Server) handleUnlockUser(c *gin.Context) {
+    userID := c.Param("id")
+    adminID := c.GetString("user_id")
+
+    // The self-join reads the lockout as it was before the update
+    var failedLogins int
+    var lockedUntil sql.NullTime
+    err := s.db.QueryRow(`
+        UPDATE users u SET failed_login_count = 0, locked_until = NULL
+        FROM users previous
+        WHERE u.id = $1 AND previous.id = u.id
+        RETURNING COALESCE(previous.failed_login_count, 0), previous.locked_until
+    `, userID).Scan(&failedLogins, &lockedUntil)
+    if err == sql.ErrNoRows {
+        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+        return
+    }
+
+    requestLog(c).Printf("🔓 AUTH: User %s unlocked by admin %s", userID, adminID)
+
+    before := gin.H{"failed_login_count": failedLogins, "locked_until": nil}
+    if lockedUntil.Valid {
+        before["locked_until"] = lockedUntil.Time
+    }
+    s.recordAuditChange(c, adminID, "USER_UNLOCK", "user", userID, before,
+        gin.H{"failed_login_count": 0, "locked_until": nil})
+    c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully"})
+}
+
+// recordAuditChange stores an admin action on an entity in audit_logs, with its values before
+// and after the action
+func (s *Server) recordAuditChange(c *gin.Context, adminID, action, entityType, entityID string, before, after gin.H) {
+    beforeJSON, _ := json.Marshal(before)
+    afterJSON, _ := json.Marshal(after)
+    _, err := s.db.Exec(`
+        INSERT INTO audit_logs (user_id, action, entity_type, entity_id, old_values, new_values, ip_address, user_agent, service)
+        VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')::inet, $8, 'auth')
+    `, adminID, action, entityType, entityID, string(beforeJSON), string(afterJSON), c.ClientIP(), c.Request.UserAgent())
+    if err != nil {
+        log.Printf("⚠️ Failed to write audit log %s for %s %s: %v", action, entityType, entityID, err)
+    }
+}
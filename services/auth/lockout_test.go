@@ -0,0 +1,37 @@
+// services/auth/lockout_test.go
+package main
+
+import (
+    "testing"
+    "time"
+)
+
+func TestLockoutDuration(t *testing.T) {
+    tests := []struct {
+        name        string
+        threshold   string
+        baseMinutes string
+        failures    int
+        want        time.Duration
+    }{
+        {name: "below the threshold", failures: 4, want: 0},
+        {name: "at the threshold", failures: 5, want: 15 * time.Minute},
+        {name: "doubles", failures: 6, want: 30 * time.Minute},
+        {name: "doubles again", failures: 8, want: 2 * time.Hour},
+        {name: "capped at a day", failures: 12, want: 24 * time.Hour},
+        {name: "long streaks stay capped", failures: 200, want: 24 * time.Hour},
+        {name: "custom threshold and base", threshold: "3", baseMinutes: "5", failures: 4, want: 10 * time.Minute},
+        {name: "base longer than a day", baseMinutes: "2000", failures: 5, want: 24 * time.Hour},
+        {name: "invalid settings use the defaults", threshold: "0", baseMinutes: "-5", failures: 5, want: 15 * time.Minute},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            t.Setenv("ACCOUNT_LOCKOUT_THRESHOLD", tt.threshold)
+            t.Setenv("ACCOUNT_LOCKOUT_BASE_MINUTES", tt.baseMinutes)
+            if got := lockoutDuration(tt.failures); got != tt.want {
+                t.Errorf("lockoutDuration(%d) = %s, want %s", tt.failures, got, tt.want)
+            }
+        })
+    }
+}
@@ -10,12 +10,15 @@ import (
     "github.com/gin-gonic/gin"
     "github.com/go-redis/redis/v8"
     _ "github.com/lib/pq"
+
+    "shared/dbpool"
 )
 
 type Server struct {
-    db     *sql.DB
-    redis  *redis.Client
-    router *gin.Engine
+    db       *sql.DB
+    redis    *redis.Client
+    router   *gin.Engine
+    notifier Notifier
 }
 
 func main() {
@@ -34,6 +37,7 @@ func main() {
         log.Fatal("Failed to connect to database:", err)
     }
     defer db.Close()
+    dbpool.Configure(db)
 
     // Redis connection
     redisClient := redis.NewClient(&redis.Options{
@@ -42,9 +46,14 @@ func main() {
 
     // Create server
     server := &Server{
-        db:     db,
-        redis:  redisClient,
-        router: gin.Default(),
+        db:       db,
+        redis:    redisClient,
+        router:   gin.Default(),
+        notifier: NewNotifier(),
+    }
+
+    if !deliversEmail(server.notifier) {
+        log.Printf("⚠️ No email notifier configured (NOTIFIER_PROVIDER=webhook), password reset is disabled")
     }
 
     // Setup routes
@@ -63,10 +72,11 @@ func main() {
 }
 
 func (s *Server) setupRoutes() {
-    // Health check
-    s.router.GET("/health", func(c *gin.Context) {
-        c.JSON(200, gin.H{"status": "healthy", "service": "auth"})
-    })
+    setupMetrics(s.router, "auth")
+    s.router.Use(requestIDMiddleware())
+
+    // Health checks
+    setupHealthRoutes(s.router, "auth", databaseCheck(s.db), redisCheck(s.redis))
     
     // Debug route
     s.router.GET("/debug", func(c *gin.Context) {
@@ -76,15 +86,34 @@ func (s *Server) setupRoutes() {
     // Auth routes
     api := s.router.Group("/api/v1")
     {
-        api.POST("/register", s.handleRegister)
-        api.POST("/login", s.handleLogin)
+        api.POST("/register", s.authRateLimiter("register", false), s.handleRegister)
+        api.POST("/login", s.authRateLimiter("login", true), s.handleLogin)
+        api.POST("/forgot-password", s.authRateLimiter("forgot_password", false), s.handleForgotPassword)
+        api.POST("/reset-password", s.handleResetPassword)
         api.POST("/refresh", s.handleRefresh)
         api.POST("/logout", s.handleLogout)
         api.POST("/verify-email", s.handleVerifyEmail)
+        api.POST("/resend-verification", s.authMiddleware(), s.authRateLimiter("resend_verification", false), s.handleResendVerification)
         api.GET("/debug-me", func(c *gin.Context) {
             c.JSON(200, gin.H{"message": "Debug /me route working"})
         })
         api.GET("/me", s.authMiddleware(), s.handleGetProfile)
         api.PUT("/profile", s.authMiddleware(), s.handleUpdateProfile)
+
+        // API keys for market data access
+        api.POST("/api-keys", s.authMiddleware(), s.handleCreateAPIKey)
+        api.GET("/api-keys", s.authMiddleware(), s.handleListAPIKeys)
+        api.DELETE("/api-keys/:id", s.authMiddleware(), s.handleRevokeAPIKey)
+
+        // Transaction PIN for withdrawals and large transfers
+        api.GET("/transaction-pin", s.authMiddleware(), s.handleGetTransactionPIN)
+        api.PUT("/transaction-pin", s.authMiddleware(), s.authRateLimiter("transaction_pin", false), s.handleSetTransactionPIN)
+
+        // Admin
+        api.POST("/admin/users/:id/unlock", s.authMiddleware(), s.adminMiddleware(), s.handleUnlockUser)
+        api.GET("/admin/accounts/closed", s.authMiddleware(), s.adminMiddleware(), s.handleAdminGetClosedAccounts)
+
+        // Account closure
+        api.POST("/account/close", s.authMiddleware(), s.authRateLimiter("close_account", false), s.handleCloseAccount)
     }
 }
\ No newline at end of file
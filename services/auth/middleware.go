@@ -10,6 +10,8 @@ import (
 
     "github.com/gin-gonic/gin"
     "github.com/golang-jwt/jwt/v5"
+
+    "shared/revocation"
 )
 
 func (s *Server) authMiddleware() gin.HandlerFunc {
@@ -72,6 +74,12 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
             }
             
             log.Printf("DEBUG: Successfully extracted user_id: '%s'", userID)
+            // Tokens issued before the account was closed are still signed and unexpired
+            if revocation.IsUserRevoked(c.Request.Context(), s.redis, userID) {
+                c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is closed"})
+                c.Abort()
+                return
+            }
             c.Set("user_id", userID)
             c.Next()
         } else {
@@ -80,4 +88,20 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
             return
         }
     }
+}
+
+func (s *Server) adminMiddleware() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        userID := c.GetString("user_id")
+
+        var role string
+        err := s.db.QueryRow("SELECT COALESCE(role, 'user') FROM users WHERE id = $1", userID).Scan(&role)
+        if err != nil || role != "admin" {
+            c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+            c.Abort()
+            return
+        }
+
+        c.Next()
+    }
 }
\ No newline at end of file
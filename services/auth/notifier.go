@@ -0,0 +1,90 @@
+// services/auth/notifier.go
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "os"
+    "time"
+)
+
+// Notifier delivers account emails (verification links, password resets). Selected with
+// NOTIFIER_PROVIDER: "log" (default, only logs) or "webhook" (POSTs to NOTIFIER_WEBHOOK_URL,
+// e.g. an email relay).
+type Notifier interface {
+    SendEmailVerification(email, token string) error
+    SendPasswordReset(email, token string) error
+}
+
+func NewNotifier() Notifier {
+    switch os.Getenv("NOTIFIER_PROVIDER") {
+    case "webhook":
+        url := os.Getenv("NOTIFIER_WEBHOOK_URL")
+        if url == "" {
+            log.Printf("⚠️ NOTIFIER_WEBHOOK_URL not set, using log notifier")
+            return &LogNotifier{}
+        }
+        return &WebhookNotifier{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+    default:
+        return &LogNotifier{}
+    }
+}
+
+// LogNotifier only records that a message would have been sent, without the token
+type LogNotifier struct{}
+
+// deliversEmail reports whether messages actually reach the user. Endpoints whose only effect
+// is the email they send stay disabled with the log notifier.
+func deliversEmail(n Notifier) bool {
+    _, logOnly := n.(*LogNotifier)
+    return n != nil && !logOnly
+}
+
+func (n *LogNotifier) SendEmailVerification(email, token string) error {
+    log.Printf("📧 NOTIFY: Verification email for %s", email)
+    return nil
+}
+
+func (n *LogNotifier) SendPasswordReset(email, token string) error {
+    log.Printf("📧 NOTIFY: Password reset email for %s", email)
+    return nil
+}
+
+// WebhookNotifier hands the message to an external delivery service
+type WebhookNotifier struct {
+    url    string
+    client *http.Client
+}
+
+func (n *WebhookNotifier) SendEmailVerification(email, token string) error {
+    return n.send("email_verification", email, token)
+}
+
+func (n *WebhookNotifier) SendPasswordReset(email, token string) error {
+    return n.send("password_reset", email, token)
+}
+
+func (n *WebhookNotifier) send(template, email, token string) error {
+    body, err := json.Marshal(map[string]string{
+        "template": template,
+        "to":       email,
+        "token":    token,
+    })
+    if err != nil {
+        return err
+    }
+
+    resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        return fmt.Errorf("notifier returned status %d", resp.StatusCode)
+    }
+    return nil
+}
@@ -0,0 +1,108 @@
+// services/auth/password_reset.go
+package main
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "golang.org/x/crypto/bcrypt"
+)
+
+const passwordResetTTL = time.Hour
+
+type ForgotPasswordRequest struct {
+    Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+    Token       string `json:"token" binding:"required"`
+    NewPassword string `json:"new_password" binding:"required,min=6"`
+}
+
+// Forgot password handler. Always answers the same way so it can't be used to find
+// registered emails. Without a notifier that delivers email the reset link could never reach
+// the user, so the endpoint answers 503 instead of pretending it was sent.
+func (s *Server) handleForgotPassword(c *gin.Context) {
+    if !deliversEmail(s.notifier) {
+        c.JSON(http.StatusServiceUnavailable, gin.H{
+            "error": "Password reset by email is not available, please contact support",
+            "code":  "PASSWORD_RESET_UNAVAILABLE",
+        })
+        return
+    }
+
+    var req ForgotPasswordRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    response := gin.H{"message": "If the email is registered you will receive reset instructions"}
+
+    var userID, email string
+    err := s.db.QueryRow(`SELECT id, email FROM users WHERE LOWER(email) = LOWER($1)`, strings.TrimSpace(req.Email)).Scan(&userID, &email)
+    if err != nil {
+        c.JSON(http.StatusOK, response)
+        return
+    }
+
+    tokenBytes := make([]byte, 32)
+    if _, err := rand.Read(tokenBytes); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate reset token"})
+        return
+    }
+    token := hex.EncodeToString(tokenBytes)
+
+    ctx := context.Background()
+    if err := s.redis.Set(ctx, "password_reset:"+token, userID, passwordResetTTL).Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate reset token"})
+        return
+    }
+
+    requestLog(c).Printf("🔑 AUTH: Password reset requested for user %s", userID)
+    if err := s.notifier.SendPasswordReset(email, token); err != nil {
+        requestLog(c).Printf("❌ AUTH: Failed to send password reset to user %s: %v", userID, err)
+    }
+
+    c.JSON(http.StatusOK, response)
+}
+
+// Reset password handler
+func (s *Server) handleResetPassword(c *gin.Context) {
+    var req ResetPasswordRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    ctx := context.Background()
+    userID, err := s.redis.GetDel(ctx, "password_reset:"+req.Token).Result()
+    if err != nil || userID == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+        return
+    }
+
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+        return
+    }
+
+    if _, err := s.db.Exec(`
+        UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2
+    `, string(hashedPassword), userID); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+        return
+    }
+
+    // Sessions opened with the old password are no longer valid
+    s.db.Exec(`DELETE FROM refresh_tokens WHERE user_id = $1`, userID)
+
+    requestLog(c).Printf("✅ AUTH: Password reset for user %s", userID)
+    c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
@@ -0,0 +1,90 @@
+// services/auth/password_reset_test.go
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/alicebob/miniredis/v2"
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+)
+
+func TestForgotPasswordDisabledWithoutEmailDelivery(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    // No database or Redis: nothing is looked up or stored before the notifier is checked
+    s := &Server{notifier: &LogNotifier{}}
+    router := gin.New()
+    router.POST("/forgot-password", s.handleForgotPassword)
+
+    w := httptest.NewRecorder()
+    req := httptest.NewRequest(http.MethodPost, "/forgot-password", strings.NewReader(`{"email":"ana@example.com"}`))
+    req.Header.Set("Content-Type", "application/json")
+    router.ServeHTTP(w, req)
+
+    if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "PASSWORD_RESET_UNAVAILABLE") {
+        t.Errorf("response = %d %s, want 503 PASSWORD_RESET_UNAVAILABLE", w.Code, w.Body.String())
+    }
+}
+
+func TestForgotPasswordSendsTheResetLink(t *testing.T) {
+    tests := []struct {
+        name       string
+        registered bool
+    }{
+        {name: "registered email", registered: true},
+        {name: "unknown email gets the same answer", registered: false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            db, mock, err := sqlmock.New()
+            if err != nil {
+                t.Fatal(err)
+            }
+            defer db.Close()
+            mr := miniredis.RunT(t)
+            client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+            defer client.Close()
+
+            rows := sqlmock.NewRows([]string{"id", "email"})
+            if tt.registered {
+                rows.AddRow("user-1", "Ana@Example.com")
+            }
+            mock.ExpectQuery(`WHERE LOWER\(email\) = LOWER\(\$1\)`).WithArgs("ANA@example.com").WillReturnRows(rows)
+
+            gin.SetMode(gin.TestMode)
+            notifier := &recordingNotifier{}
+            router := gin.New()
+            router.POST("/forgot-password", (&Server{db: db, redis: client, notifier: notifier}).handleForgotPassword)
+
+            if w := jsonRequest(router, "/forgot-password", `{"email":"ANA@example.com"}`); w.Code != http.StatusOK {
+                t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+            }
+            if !tt.registered {
+                if len(notifier.resets) != 0 {
+                    t.Errorf("sent %d reset emails for an unknown address", len(notifier.resets))
+                }
+                return
+            }
+
+            if len(notifier.resets) != 1 {
+                t.Fatalf("sent %d reset emails, want 1", len(notifier.resets))
+            }
+            sent := notifier.resets[0]
+            if sent.email != "Ana@Example.com" {
+                t.Errorf("reset sent to %s, want the registered address", sent.email)
+            }
+            // The emailed token is the one handleResetPassword will redeem
+            if userID, err := mr.Get("password_reset:" + sent.token); err != nil || userID != "user-1" {
+                t.Errorf("password_reset:%s = %q, %v, want user-1", sent.token, userID, err)
+            }
+            if ttl := mr.TTL("password_reset:" + sent.token); ttl != passwordResetTTL {
+                t.Errorf("reset token TTL = %s, want %s", ttl, passwordResetTTL)
+            }
+        })
+    }
+}
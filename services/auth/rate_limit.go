@@ -0,0 +1,175 @@
+// services/auth/rate_limit.go
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "math"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+)
+
+// Brute-force protection for the public auth endpoints. Attempts are counted in Redis per
+// client IP and per email; once either counter reaches the limit the endpoint answers 429
+// until the window expires. Configurable with AUTH_RATE_LIMIT_MAX_ATTEMPTS and
+// AUTH_RATE_LIMIT_WINDOW_MINUTES.
+
+const (
+    defaultAuthRateLimitAttempts = 5
+    defaultAuthRateLimitWindow   = 15 * time.Minute
+)
+
+type authRateLimitConfig struct {
+    maxAttempts int64
+    window      time.Duration
+}
+
+func loadAuthRateLimitConfig() authRateLimitConfig {
+    cfg := authRateLimitConfig{
+        maxAttempts: defaultAuthRateLimitAttempts,
+        window:      defaultAuthRateLimitWindow,
+    }
+
+    if value := os.Getenv("AUTH_RATE_LIMIT_MAX_ATTEMPTS"); value != "" {
+        if attempts, err := strconv.ParseInt(value, 10, 64); err == nil && attempts > 0 {
+            cfg.maxAttempts = attempts
+        }
+    }
+    if value := os.Getenv("AUTH_RATE_LIMIT_WINDOW_MINUTES"); value != "" {
+        if minutes, err := strconv.Atoi(value); err == nil && minutes > 0 {
+            cfg.window = time.Duration(minutes) * time.Minute
+        }
+    }
+
+    return cfg
+}
+
+// countAuthAttemptScript counts an attempt on every key and starts the window of a key on its
+// first one. It returns the attempts and TTL of each key in turn. All keys are counted in one
+// step: concurrent requests can't all read a counter below the limit, and can't interleave
+// between the IP and account counters so that none of them gets the last attempt.
+var countAuthAttemptScript = redis.NewScript(`
+    local result = {}
+    for _, key in ipairs(KEYS) do
+        local attempts = redis.call("INCR", key)
+        if attempts == 1 then
+            redis.call("PEXPIRE", key, ARGV[1])
+        end
+        table.insert(result, attempts)
+        table.insert(result, redis.call("PTTL", key))
+    end
+    return result
+`)
+
+// refundAuthAttemptScript takes back an attempt that turned out not to count, without
+// recreating a counter whose window has already expired
+var refundAuthAttemptScript = redis.NewScript(`
+    if tonumber(redis.call("GET", KEYS[1]) or "0") > 0 then
+        redis.call("DECR", KEYS[1])
+    end
+    return 0
+`)
+
+// authRateLimiter limits attempts on an auth endpoint. Every attempt is counted before the
+// handler runs and refused once a counter goes over the limit. With failuresOnly (login) only
+// failed attempts are kept: a successful one is taken back from the per-IP counter and clears
+// the account's, so a user logging in doesn't reset the count of an IP guessing other
+// accounts. Otherwise (register, forgot-password) every attempt counts.
+func (s *Server) authRateLimiter(action string, failuresOnly bool) gin.HandlerFunc {
+    cfg := loadAuthRateLimitConfig()
+
+    return func(c *gin.Context) {
+        ctx := context.Background()
+        ipKey := fmt.Sprintf("auth:ratelimit:%s:ip:%s", action, c.ClientIP())
+        accountKey := ""
+        keys := []string{ipKey}
+        if email := peekRequestEmail(c); email != "" {
+            accountKey = fmt.Sprintf("auth:ratelimit:%s:email:%s", action, email)
+            keys = append(keys, accountKey)
+        }
+
+        var retryAfter time.Duration
+        result, err := countAuthAttemptScript.Run(ctx, s.redis, keys, cfg.window.Milliseconds()).Int64Slice()
+        if err != nil || len(result) != 2*len(keys) {
+            log.Printf("⚠️ AUTH: Failed to count %s attempt (%s): %v", action, strings.Join(keys, ", "), err)
+            result = nil
+        }
+        for i := 0; i+1 < len(result); i += 2 {
+            if result[i] <= cfg.maxAttempts {
+                continue
+            }
+
+            log.Printf("🚫 AUTH: Rate limit reached for %s (%s)", action, keys[i/2])
+            if ttl := time.Duration(result[i+1]) * time.Millisecond; ttl > retryAfter {
+                retryAfter = ttl
+            }
+        }
+
+        if retryAfter > 0 {
+            seconds := int(math.Ceil(retryAfter.Seconds()))
+            c.Header("Retry-After", strconv.Itoa(seconds))
+            c.JSON(http.StatusTooManyRequests, gin.H{
+                "error":       "Too many attempts, please try again later",
+                "retry_after": seconds,
+            })
+            c.Abort()
+            return
+        }
+
+        c.Next()
+
+        if !failuresOnly {
+            return
+        }
+        switch status := c.Writer.Status(); {
+        case status < http.StatusBadRequest:
+            s.refundAuthAttempt(ctx, ipKey)
+            if accountKey != "" {
+                s.redis.Del(ctx, accountKey)
+            }
+        case status >= http.StatusInternalServerError:
+            // Server errors are not the caller's fault
+            for _, key := range keys {
+                s.refundAuthAttempt(ctx, key)
+            }
+        }
+    }
+}
+
+func (s *Server) refundAuthAttempt(ctx context.Context, key string) {
+    if err := refundAuthAttemptScript.Run(ctx, s.redis, []string{key}).Err(); err != nil {
+        log.Printf("⚠️ AUTH: Failed to refund attempt (%s): %v", key, err)
+    }
+}
+
+// peekRequestEmail reads the email from the JSON body and puts the body back for the handler
+func peekRequestEmail(c *gin.Context) string {
+    if c.Request.Body == nil {
+        return ""
+    }
+
+    body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+    c.Request.Body.Close()
+    c.Request.Body = io.NopCloser(bytes.NewReader(body))
+    if err != nil {
+        return ""
+    }
+
+    var payload struct {
+        Email string `json:"email"`
+    }
+    if json.Unmarshal(body, &payload) != nil {
+        return ""
+    }
+    return strings.ToLower(strings.TrimSpace(payload.Email))
+}
@@ -0,0 +1,147 @@
+// services/auth/rate_limit_test.go
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/alicebob/miniredis/v2"
+    "github.com/gin-gonic/gin"
+    "github.com/go-redis/redis/v8"
+)
+
+// newRateLimitTestRouter serves /login behind the limiter, answering with the status the test
+// sets, and counts the requests that got through to the handler
+func newRateLimitTestRouter(t *testing.T, failuresOnly bool, status *int32, handled *int32) (*gin.Engine, *miniredis.Miniredis) {
+    t.Setenv("AUTH_RATE_LIMIT_MAX_ATTEMPTS", "5")
+    t.Setenv("AUTH_RATE_LIMIT_WINDOW_MINUTES", "15")
+    gin.SetMode(gin.TestMode)
+
+    mr := miniredis.RunT(t)
+    client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+    t.Cleanup(func() { client.Close() })
+
+    s := &Server{redis: client}
+    router := gin.New()
+    router.POST("/login", s.authRateLimiter("login", failuresOnly), func(c *gin.Context) {
+        atomic.AddInt32(handled, 1)
+        c.Status(int(atomic.LoadInt32(status)))
+    })
+    return router, mr
+}
+
+func attemptLogin(router *gin.Engine, email string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"`+email+`"}`))
+    req.Header.Set("Content-Type", "application/json")
+    req.RemoteAddr = "203.0.113.7:4000"
+    w := httptest.NewRecorder()
+    router.ServeHTTP(w, req)
+    return w
+}
+
+func TestAuthRateLimiterBlocksAfterMaxFailures(t *testing.T) {
+    status, handled := int32(http.StatusUnauthorized), int32(0)
+    router, mr := newRateLimitTestRouter(t, true, &status, &handled)
+
+    for i := 1; i <= 5; i++ {
+        if w := attemptLogin(router, "ana@example.com"); w.Code != http.StatusUnauthorized {
+            t.Fatalf("attempt %d = %d, want 401", i, w.Code)
+        }
+    }
+    w := attemptLogin(router, "ana@example.com")
+    if w.Code != http.StatusTooManyRequests {
+        t.Fatalf("attempt 6 = %d, want 429", w.Code)
+    }
+    if retryAfter := w.Header().Get("Retry-After"); retryAfter != "900" {
+        t.Errorf("Retry-After = %q, want 900", retryAfter)
+    }
+    if handled != 5 {
+        t.Errorf("handler ran %d times, want 5", handled)
+    }
+
+    mr.FastForward(15 * time.Minute)
+    if w := attemptLogin(router, "ana@example.com"); w.Code != http.StatusUnauthorized {
+        t.Errorf("attempt after the window = %d, want 401", w.Code)
+    }
+}
+
+func TestAuthRateLimiterCountsConcurrentAttempts(t *testing.T) {
+    status, handled := int32(http.StatusUnauthorized), int32(0)
+    router, _ := newRateLimitTestRouter(t, true, &status, &handled)
+
+    var wg sync.WaitGroup
+    for i := 0; i < 20; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            attemptLogin(router, "ana@example.com")
+        }()
+    }
+    wg.Wait()
+
+    if handled != 5 {
+        t.Errorf("handler ran %d times for 20 concurrent attempts, want 5", handled)
+    }
+}
+
+func TestAuthRateLimiterSuccessClearsOnlyTheAccount(t *testing.T) {
+    status, handled := int32(http.StatusUnauthorized), int32(0)
+    router, mr := newRateLimitTestRouter(t, true, &status, &handled)
+
+    for i := 0; i < 4; i++ {
+        attemptLogin(router, "victim@example.com")
+    }
+    atomic.StoreInt32(&status, http.StatusOK)
+    if w := attemptLogin(router, "own@example.com"); w.Code != http.StatusOK {
+        t.Fatalf("login = %d, want 200", w.Code)
+    }
+
+    if mr.Exists("auth:ratelimit:login:email:own@example.com") {
+        t.Error("successful login kept its account counter")
+    }
+    if got, _ := mr.Get("auth:ratelimit:login:ip:203.0.113.7"); got != "4" {
+        t.Errorf("IP counter after a successful login = %q, want 4", got)
+    }
+
+    // The IP has one failure left
+    atomic.StoreInt32(&status, http.StatusUnauthorized)
+    if w := attemptLogin(router, "victim@example.com"); w.Code != http.StatusUnauthorized {
+        t.Fatalf("fifth failure = %d, want 401", w.Code)
+    }
+    if w := attemptLogin(router, "other@example.com"); w.Code != http.StatusTooManyRequests {
+        t.Errorf("sixth failure from the IP = %d, want 429", w.Code)
+    }
+}
+
+func TestAuthRateLimiterIgnoresServerErrors(t *testing.T) {
+    status, handled := int32(http.StatusInternalServerError), int32(0)
+    router, mr := newRateLimitTestRouter(t, true, &status, &handled)
+
+    for i := 0; i < 10; i++ {
+        if w := attemptLogin(router, "ana@example.com"); w.Code != http.StatusInternalServerError {
+            t.Fatalf("attempt %d = %d, want 500", i+1, w.Code)
+        }
+    }
+    if got, _ := mr.Get("auth:ratelimit:login:ip:203.0.113.7"); got != "0" {
+        t.Errorf("IP counter after server errors = %q, want 0", got)
+    }
+}
+
+func TestAuthRateLimiterCountsEveryAttempt(t *testing.T) {
+    status, handled := int32(http.StatusOK), int32(0)
+    router, _ := newRateLimitTestRouter(t, false, &status, &handled)
+
+    for i := 1; i <= 5; i++ {
+        if w := attemptLogin(router, "ana@example.com"); w.Code != http.StatusOK {
+            t.Fatalf("attempt %d = %d, want 200", i, w.Code)
+        }
+    }
+    if w := attemptLogin(router, "ana@example.com"); w.Code != http.StatusTooManyRequests {
+        t.Errorf("attempt 6 = %d, want 429", w.Code)
+    }
+}
@@ -0,0 +1,102 @@
+// services/auth/transaction_pin.go
+package main
+
+import (
+    "database/sql"
+    "net/http"
+    "regexp"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "golang.org/x/crypto/bcrypt"
+)
+
+// The transaction PIN is a second secret, separate from the password, that the wallet asks for
+// on withdrawals and large transfers. Setting or changing it requires the account password;
+// doing so also clears any PIN lockout the wallet applied after wrong attempts.
+
+var transactionPINPattern = regexp.MustCompile(`^[0-9]{4,6}$`)
+
+type SetTransactionPINRequest struct {
+    PIN      string `json:"pin" binding:"required"`
+    Password string `json:"password" binding:"required"`
+}
+
+func (s *Server) handleGetTransactionPIN(c *gin.Context) {
+    userID := c.GetString("user_id")
+
+    var setAt, lockedUntil sql.NullTime
+    err := s.db.QueryRow(`
+        SELECT transaction_pin_set_at, pin_locked_until FROM users WHERE id = $1
+    `, userID).Scan(&setAt, &lockedUntil)
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+        return
+    }
+
+    response := gin.H{"is_set": setAt.Valid}
+    if setAt.Valid {
+        response["set_at"] = setAt.Time
+    }
+    if lockedUntil.Valid && lockedUntil.Time.After(time.Now()) {
+        response["locked_until"] = lockedUntil.Time
+    }
+    c.JSON(http.StatusOK, response)
+}
+
+func (s *Server) handleSetTransactionPIN(c *gin.Context) {
+    userID := c.GetString("user_id")
+
+    var req SetTransactionPINRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if !transactionPINPattern.MatchString(req.PIN) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "PIN must be 4 to 6 digits"})
+        return
+    }
+
+    var passwordHash string
+    var pinSet bool
+    err := s.db.QueryRow(`
+        SELECT password_hash, transaction_pin_hash IS NOT NULL FROM users WHERE id = $1
+    `, userID).Scan(&passwordHash, &pinSet)
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+        return
+    }
+
+    if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+        requestLog(c).Printf("❌ PIN: Wrong password for user %s while setting transaction PIN", userID)
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+        return
+    }
+
+    pinHash, err := bcrypt.GenerateFromPassword([]byte(req.PIN), bcrypt.DefaultCost)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set PIN"})
+        return
+    }
+
+    _, err = s.db.Exec(`
+        UPDATE users SET
+            transaction_pin_hash = $1,
+            transaction_pin_set_at = NOW(),
+            pin_failed_count = 0,
+            pin_locked_until = NULL
+        WHERE id = $2
+    `, string(pinHash), userID)
+    if err != nil {
+        requestLog(c).Printf("❌ PIN: Failed to store transaction PIN for user %s: %v", userID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set PIN"})
+        return
+    }
+
+    message := "Transaction PIN set successfully"
+    if pinSet {
+        message = "Transaction PIN changed successfully"
+    }
+    requestLog(c).Printf("🔑 PIN: Transaction PIN updated for user %s", userID)
+    c.JSON(http.StatusOK, gin.H{"message": message})
+}
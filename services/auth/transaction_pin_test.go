@@ -0,0 +1,36 @@
+// services/auth/transaction_pin_test.go
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+func TestSetTransactionPINRejectsMalformedPINs(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    // Rejected before the password is checked, so no database is needed
+    for _, pin := range []string{"123", "1234567", "12a4", " 1234", "١٢٣٤"} {
+        w := httptest.NewRecorder()
+        c, _ := gin.CreateTestContext(w)
+        c.Set("user_id", "user-1")
+        c.Request = httptest.NewRequest(http.MethodPut, "/transaction-pin",
+            strings.NewReader(`{"pin":"`+pin+`","password":"secret"}`))
+        c.Request.Header.Set("Content-Type", "application/json")
+
+        (&Server{}).handleSetTransactionPIN(c)
+        if w.Code != http.StatusBadRequest {
+            t.Errorf("PIN %q = %d, want 400", pin, w.Code)
+        }
+    }
+
+    for _, pin := range []string{"1234", "00000", "987654"} {
+        if !transactionPINPattern.MatchString(pin) {
+            t.Errorf("PIN %q rejected", pin)
+        }
+    }
+}
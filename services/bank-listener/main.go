@@ -12,6 +12,8 @@ import (
     "github.com/gin-gonic/gin"
     "github.com/shopspring/decimal"
     _ "github.com/lib/pq"
+
+    "shared/dbpool"
 )
 
 type BankNotification struct {
@@ -49,6 +51,7 @@ func main() {
         log.Fatal("Failed to connect to database:", err)
     }
     defer db.Close()
+    dbpool.Configure(db)
 
     // Test database connection
     if err := db.Ping(); err != nil {
@@ -61,20 +64,23 @@ func main() {
     }
 
     router := gin.Default()
+    setupMetrics(router, "bank-listener")
+    router.Use(requestIDMiddleware())
 
-    // Health check
-    router.GET("/health", func(c *gin.Context) {
-        c.JSON(200, gin.H{"status": "healthy", "service": "bank-listener"})
-    })
+    // Health checks
+    setupHealthRoutes(router, "bank-listener", databaseCheck(db))
+
+    // Rate limiting and replay protection for the notification and ack endpoints
+    guard := newWebhookGuard(db, "bank-listener")
 
     // Android notification endpoint
-    router.POST("/api/notification", server.handleAndroidNotification)
+    router.POST("/api/notification", guard.middleware(), server.handleAndroidNotification)
     
     // Get notifications for wallet service
     router.GET("/api/notifications", server.getNotifications)
     
     // Acknowledge processed notification
-    router.POST("/api/acknowledge", server.acknowledgeNotification)
+    router.POST("/api/acknowledge", guard.middleware(), server.acknowledgeNotification)
 
     port := os.Getenv("PORT")
     if port == "" {
@@ -96,17 +102,17 @@ func (s *Server) handleAndroidNotification(c *gin.Context) {
     }
 
     if err := c.ShouldBindJSON(&payload); err != nil {
-        log.Printf("❌ Error parsing Android notification: %v", err)
+        requestLog(c).Printf("❌ Error parsing Android notification: %v", err)
         c.JSON(400, gin.H{"error": "Invalid payload"})
         return
     }
 
-    log.Printf("📱 Received Android notification: %s - %s", payload.Title, payload.Content)
+    requestLog(c).Printf("📱 Received Android notification: %s - %s", payload.Title, payload.Content)
 
     // Parse bank notification from Android content
     notification, err := s.parseBankNotification(payload)
     if err != nil {
-        log.Printf("⚠️ Could not parse bank notification: %v", err)
+        requestLog(c).Printf("⚠️ Could not parse bank notification: %v", err)
         c.JSON(200, gin.H{"status": "ignored", "reason": "not a bank notification"})
         return
     }
@@ -114,7 +120,7 @@ func (s *Server) handleAndroidNotification(c *gin.Context) {
     // Store notification
     err = s.storeNotification(notification)
     if err != nil {
-        log.Printf("❌ Error storing notification: %v", err)
+        requestLog(c).Printf("❌ Error storing notification: %v", err)
         c.JSON(500, gin.H{"error": "Failed to store notification"})
         return
     }
@@ -122,7 +128,7 @@ func (s *Server) handleAndroidNotification(c *gin.Context) {
     // Add to in-memory queue for immediate processing
     s.notifications = append(s.notifications, notification)
 
-    log.Printf("✅ Bank notification processed: %s %s from %s", 
+    requestLog(c).Printf("✅ Bank notification processed: %s %s from %s", 
         notification.Amount.String(), notification.Currency, notification.SenderName)
 
     c.JSON(200, gin.H{
@@ -355,7 +361,7 @@ func (s *Server) getNotifications(c *gin.Context) {
     
     rows, err := s.db.Query(query)
     if err != nil {
-        log.Printf("❌ Error querying notifications: %v", err)
+        requestLog(c).Printf("❌ Error querying notifications: %v", err)
         c.JSON(500, gin.H{"error": "Database error"})
         return
     }
@@ -398,11 +404,11 @@ func (s *Server) acknowledgeNotification(c *gin.Context) {
     `, payload.NotificationID)
     
     if err != nil {
-        log.Printf("❌ Error acknowledging notification: %v", err)
+        requestLog(c).Printf("❌ Error acknowledging notification: %v", err)
         c.JSON(500, gin.H{"error": "Database error"})
         return
     }
     
-    log.Printf("✅ Acknowledged notification: %s", payload.NotificationID)
+    requestLog(c).Printf("✅ Acknowledged notification: %s", payload.NotificationID)
     c.JSON(200, gin.H{"status": "acknowledged"})
 }
\ No newline at end of file
@@ -0,0 +1,178 @@
+// services/bank-listener/webhook_guard.go
+package main
+
+import (
+    "bytes"
+    "crypto/hmac"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "io"
+    "log"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// Webhook callers must send X-Webhook-Timestamp (unix seconds), a unique X-Webhook-Nonce and
+// X-Webhook-Signature, the hex HMAC-SHA256 of "<timestamp>.<nonce>.<body>" with WEBHOOK_SECRET,
+// so neither can be changed to replay a captured call. Calls with a bad signature, a timestamp
+// more than WEBHOOK_MAX_SKEW_SECONDS away from now, or a nonce already used are rejected. Each caller IP may make WEBHOOK_RATE_LIMIT_PER_MINUTE calls per
+// minute and endpoint. WEBHOOK_REPLAY_PROTECTION=false turns the nonce check off for old clients.
+
+const (
+    webhookTimestampHeader = "X-Webhook-Timestamp"
+    webhookNonceHeader     = "X-Webhook-Nonce"
+    webhookSignatureHeader = "X-Webhook-Signature"
+)
+
+type webhookGuard struct {
+    db        *sql.DB
+    source    string
+    maxSkew   time.Duration
+    perMinute int
+    replay    bool
+    secret    string
+
+    mu      sync.Mutex
+    window  time.Time
+    callers map[string]int
+}
+
+func newWebhookGuard(db *sql.DB, source string) *webhookGuard {
+    maxSkew := 300
+    if value, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_SKEW_SECONDS")); err == nil && value > 0 {
+        maxSkew = value
+    }
+    perMinute := 60
+    if value, err := strconv.Atoi(os.Getenv("WEBHOOK_RATE_LIMIT_PER_MINUTE")); err == nil && value > 0 {
+        perMinute = value
+    }
+
+    guard := &webhookGuard{
+        db:        db,
+        source:    source,
+        maxSkew:   time.Duration(maxSkew) * time.Second,
+        perMinute: perMinute,
+        replay:    os.Getenv("WEBHOOK_REPLAY_PROTECTION") != "false",
+        secret:    os.Getenv("WEBHOOK_SECRET"),
+        callers:   make(map[string]int),
+    }
+    go guard.purgeNonces()
+    return guard
+}
+
+func (g *webhookGuard) middleware() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if retryAfter, ok := g.take(c.FullPath() + " " + c.ClientIP()); !ok {
+            requestLog(c).Printf("🚦 Webhook rate limit hit by %s on %s", c.ClientIP(), c.FullPath())
+            c.Header("Retry-After", strconv.Itoa(retryAfter))
+            c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many webhook calls"})
+            return
+        }
+
+        if !g.replay {
+            c.Next()
+            return
+        }
+
+        if g.secret == "" {
+            requestLog(c).Printf("❌ Webhook on %s rejected: WEBHOOK_SECRET is not configured", c.FullPath())
+            c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Webhook verification is not configured"})
+            return
+        }
+
+        header := c.GetHeader(webhookTimestampHeader)
+        timestamp, err := strconv.ParseInt(header, 10, 64)
+        nonce := c.GetHeader(webhookNonceHeader)
+        if err != nil || nonce == "" || len(nonce) > 128 {
+            c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Missing webhook timestamp or nonce"})
+            return
+        }
+
+        // Checked before the nonce is recorded, so a forged call can't burn the nonce of a real one
+        body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+        if err != nil {
+            c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read webhook body"})
+            return
+        }
+        c.Request.Body = io.NopCloser(bytes.NewReader(body))
+        expected := signWebhook(g.secret, header, nonce, body)
+        if !hmac.Equal([]byte(expected), []byte(strings.ToLower(c.GetHeader(webhookSignatureHeader)))) {
+            requestLog(c).Printf("⚠️ Webhook with invalid signature from %s rejected", c.ClientIP())
+            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook signature"})
+            return
+        }
+
+        skew := time.Since(time.Unix(timestamp, 0))
+        if skew > g.maxSkew || skew < -g.maxSkew {
+            requestLog(c).Printf("⚠️ Stale webhook from %s rejected (skew %s)", c.ClientIP(), skew.Round(time.Second))
+            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Webhook timestamp outside the allowed window"})
+            return
+        }
+
+        result, err := g.db.Exec(`
+            INSERT INTO webhook_nonces (source, nonce) VALUES ($1, $2)
+            ON CONFLICT (source, nonce) DO NOTHING
+        `, g.source, nonce)
+        if err != nil {
+            requestLog(c).Printf("❌ Failed to record webhook nonce: %v", err)
+            c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify webhook"})
+            return
+        }
+        if rows, _ := result.RowsAffected(); rows == 0 {
+            requestLog(c).Printf("⚠️ Replayed webhook from %s rejected (nonce %s)", c.ClientIP(), nonce)
+            c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Webhook nonce already used"})
+            return
+        }
+
+        c.Next()
+    }
+}
+
+// take counts a call for the key in the current one-minute window. It returns false, with the
+// seconds left in the window, once the key is over the limit.
+func (g *webhookGuard) take(key string) (int, bool) {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+
+    now := time.Now()
+    if now.Sub(g.window) >= time.Minute {
+        g.window = now
+        g.callers = make(map[string]int)
+    }
+
+    g.callers[key]++
+    if g.callers[key] > g.perMinute {
+        return int(time.Minute-now.Sub(g.window))/int(time.Second) + 1, false
+    }
+    return 0, true
+}
+
+// purgeNonces forgets nonces old enough that their timestamp would be rejected anyway
+func (g *webhookGuard) purgeNonces() {
+    ticker := time.NewTicker(10 * time.Minute)
+    defer ticker.Stop()
+
+    for range ticker.C {
+        _, err := g.db.Exec(`
+            DELETE FROM webhook_nonces WHERE source = $1 AND received_at < $2
+        `, g.source, time.Now().Add(-2*g.maxSkew))
+        if err != nil {
+            log.Printf("❌ Failed to purge webhook nonces: %v", err)
+        }
+    }
+}
+
+// signWebhook returns the signature expected for the body sent with timestamp and nonce
+func signWebhook(secret, timestamp, nonce string, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte(timestamp + "." + nonce + "."))
+    mac.Write(body)
+    return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,135 @@
+// services/chat/archive.go
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rooms whose order was completed or cancelled, or whose dispute was resolved or closed, are
+// archived once nobody has written in them for CHAT_ROOM_ARCHIVE_AFTER_DAYS. Archived rooms are
+// hidden from the room list and read-only, but their history stays available. Rooms under a
+// legal hold are never archived.
+
+func roomArchiveAfter() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("CHAT_ROOM_ARCHIVE_AFTER_DAYS"))
+	if err != nil || days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func (s *Server) runRoomArchiver() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		s.archiveAbandonedRooms()
+		<-ticker.C
+	}
+}
+
+// archiveAbandonedRooms archives every eligible room and returns their IDs
+func (s *Server) archiveAbandonedRooms() []string {
+	rows, err := s.db.Query(`
+		UPDATE chat_rooms r SET archived_at = NOW()
+		WHERE r.archived_at IS NULL
+			AND COALESCE(r.legal_hold, false) = false
+			AND r.last_message_at < $1
+			AND (
+				(r.room_type = 'TRANSACTION' AND EXISTS (
+					SELECT 1 FROM orders o
+					WHERE o.id = r.transaction_id AND o.status IN ('COMPLETED', 'CANCELLED', 'EXPIRED')
+				) AND NOT EXISTS (
+					SELECT 1 FROM disputes d
+					WHERE (d.transaction_id = r.transaction_id
+						OR d.transaction_id IN (SELECT t.id FROM transactions t WHERE t.order_id = r.transaction_id))
+						AND d.status NOT IN ('RESOLVED', 'CLOSED')
+				))
+				OR (r.room_type = 'DISPUTE' AND EXISTS (
+					SELECT 1 FROM disputes d
+					WHERE d.id = r.dispute_id AND d.status IN ('RESOLVED', 'CLOSED')
+				))
+			)
+		RETURNING r.id
+	`, time.Now().Add(-roomArchiveAfter()))
+	if err != nil {
+		log.Printf("❌ Failed to archive abandoned chat rooms: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	archived := []string{}
+	for rows.Next() {
+		var roomID string
+		if err := rows.Scan(&roomID); err == nil {
+			archived = append(archived, roomID)
+		}
+	}
+
+	if len(archived) > 0 {
+		s.hub.dropRooms(archived)
+		log.Printf("🗄️ Archived %d abandoned chat rooms", len(archived))
+	}
+	return archived
+}
+
+// dropRooms stops delivering messages of the given rooms to connected clients, on every instance
+func (h *Hub) dropRooms(roomIDs []string) {
+	h.forgetRooms(roomIDs)
+	h.relay.publish(hubEvent{DropRooms: roomIDs})
+}
+
+func (h *Hub) forgetRooms(roomIDs []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, client := range h.clients {
+		for _, roomID := range roomIDs {
+			delete(client.rooms, roomID)
+		}
+	}
+}
+
+func (s *Server) handleArchiveAbandonedRooms(c *gin.Context) {
+	archived := s.archiveAbandonedRooms()
+	c.JSON(http.StatusOK, gin.H{"archived": archived, "count": len(archived)})
+}
+
+func (s *Server) handleSetLegalHold(c *gin.Context) {
+	roomID := c.Param("id")
+
+	var req struct {
+		Hold   bool   `json:"hold"`
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Hold && req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required to place a legal hold"})
+		return
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE chat_rooms SET legal_hold = $1, legal_hold_reason = NULLIF($2, '')
+		WHERE id = $3
+	`, req.Hold, req.Reason, roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update legal hold"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	requestLog(c).Printf("⚖️ Legal hold on chat room %s set to %t by %s", roomID, req.Hold, c.GetString("user_id"))
+	c.JSON(http.StatusOK, gin.H{"room_id": roomID, "legal_hold": req.Hold})
+}
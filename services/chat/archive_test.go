@@ -0,0 +1,82 @@
+// services/chat/archive_test.go
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+// cutoffArg matches an inactivity cutoff the given duration before now
+type cutoffArg time.Duration
+
+func (a cutoffArg) Match(v driver.Value) bool {
+	cutoff, ok := v.(time.Time)
+	return ok && time.Since(cutoff.Add(time.Duration(a))) < time.Minute
+}
+
+func TestRoomOfLongCompletedOrderIsArchivedAndHidden(t *testing.T) {
+	t.Setenv("CHAT_ROOM_ARCHIVE_AFTER_DAYS", "7")
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// room-old belongs to an order completed weeks ago; room-active to one still in progress
+	mock.ExpectQuery(`UPDATE chat_rooms r SET archived_at = NOW\(\)\s+WHERE r.archived_at IS NULL\s+AND COALESCE\(r.legal_hold, false\) = false`).
+		WithArgs(cutoffArg(7 * 24 * time.Hour)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("room-old"))
+
+	client := &Client{UserID: "user-1", rooms: map[string]bool{"room-old": true, "room-active": true}}
+	hub := &Hub{
+		clients: map[string]*Client{"client-1": client},
+		relay:   &hubRelay{outbound: make(chan hubEvent, 1)},
+	}
+	s := &Server{db: db, hub: hub}
+
+	if archived := s.archiveAbandonedRooms(); len(archived) != 1 || archived[0] != "room-old" {
+		t.Fatalf("archived = %v, want room-old", archived)
+	}
+	// The live hub stops delivering the archived room, here and on the other instances
+	if client.rooms["room-old"] || !client.rooms["room-active"] {
+		t.Errorf("client rooms = %v, want only room-active", client.rooms)
+	}
+	if event := <-hub.relay.outbound; len(event.DropRooms) != 1 || event.DropRooms[0] != "room-old" {
+		t.Errorf("relayed %+v, want room-old dropped", event)
+	}
+
+	// The room list only asks for rooms that are not archived
+	mock.ExpectQuery(`FROM chat_rooms\s+WHERE participants::jsonb \? \$1 AND \(archived_at IS NOT NULL\) = \$2`).
+		WithArgs("user-1", false).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "room_type", "transaction_id", "dispute_id", "participants",
+			"last_message_at", "created_at", "archived_at"}).
+			AddRow("room-active", "TRANSACTION", "order-2", nil, `["user-1","cashier-1"]`, time.Now(), time.Now(), nil))
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/rooms", nil)
+	c.Set("user_id", "user-1")
+	s.handleGetRooms(c)
+
+	var response struct {
+		Rooms []ChatRoom `json:"rooms"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("response = %d %s: %v", w.Code, w.Body.String(), err)
+	}
+	if len(response.Rooms) != 1 || response.Rooms[0].ID != "room-active" {
+		t.Errorf("rooms = %+v, want only room-active", response.Rooms)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
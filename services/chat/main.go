@@ -12,13 +12,17 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	_ "github.com/lib/pq"
+
+	"shared/dbpool"
 )
 
 type Server struct {
 	db     *sql.DB
+	redis  *redis.Client
 	router *gin.Engine
 	hub    *Hub
 }
@@ -29,6 +33,9 @@ type Hub struct {
 	register   chan *Client
 	unregister chan *Client
 	mu         sync.RWMutex
+
+	relay  *hubRelay     // shares broadcasts with the other chat instances
+	remote chan hubEvent // events published by the other instances
 }
 
 type Client struct {
@@ -37,6 +44,9 @@ type Client struct {
 	conn   *websocket.Conn
 	send   chan Message
 	rooms  map[string]bool
+
+	replayed   map[string]bool      // message IDs already sent by replayMissed
+	lastTyping map[string]time.Time // room ID -> last TYPING relayed, for the debounce
 }
 
 type Message struct {
@@ -46,6 +56,10 @@ type Message struct {
 	Type      string    `json:"message_type"`
 	Content   string    `json:"content"`
 	Timestamp time.Time `json:"created_at"`
+
+	Reference *MessageReference `json:"reference,omitempty"`
+	EditedAt  *time.Time        `json:"edited_at,omitempty"`
+	Deleted   bool              `json:"deleted,omitempty"`
 }
 
 type ChatRoom struct {
@@ -56,6 +70,7 @@ type ChatRoom struct {
 	Participants []string  `json:"participants"`
 	LastMessage  time.Time `json:"last_message_at"`
 	CreatedAt    time.Time `json:"created_at"`
+	ArchivedAt   *time.Time `json:"archived_at,omitempty"`
 }
 
 var upgrader = websocket.Upgrader{
@@ -80,22 +95,34 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 	defer db.Close()
+	dbpool.Configure(db)
+
+	// Redis connection, relaying messages between chat instances
+	redisClient := redis.NewClient(&redis.Options{
+		Addr: fmt.Sprintf("%s:%s", os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PORT")),
+	})
 
 	hub := &Hub{
 		clients:    make(map[string]*Client),
 		broadcast:  make(chan Message),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		relay:      newHubRelay(redisClient),
+		remote:     make(chan hubEvent, pubsubOutboundBuffer),
 	}
 
 	server := &Server{
 		db:     db,
+		redis:  redisClient,
 		router: gin.Default(),
 		hub:    hub,
 	}
 
 	// Start hub
 	go server.hub.run()
+	go hub.relay.runPublisher()
+	go hub.relay.runSubscriber(hub.remote)
+	go server.runRoomArchiver()
 
 	server.setupRoutes()
 
@@ -111,9 +138,10 @@ func main() {
 }
 
 func (s *Server) setupRoutes() {
-	s.router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "healthy", "service": "chat"})
-	})
+	setupMetrics(s.router, "chat")
+	s.router.Use(requestIDMiddleware())
+
+	setupHealthRoutes(s.router, "chat", databaseCheck(s.db), redisCheck(s.redis))
 
 	api := s.router.Group("/api/v1")
 	{
@@ -125,7 +153,14 @@ func (s *Server) setupRoutes() {
 		api.GET("/rooms", s.authMiddleware(), s.handleGetRooms)
 		api.GET("/rooms/:id/messages", s.authMiddleware(), s.handleGetMessages)
 		api.POST("/rooms/:id/messages", s.authMiddleware(), s.handleSendMessage)
+		api.PUT("/rooms/:id/messages/:messageId", s.authMiddleware(), s.handleEditMessage)
+		api.DELETE("/rooms/:id/messages/:messageId", s.authMiddleware(), s.handleDeleteMessage)
 		api.POST("/rooms/:id/join", s.authMiddleware(), s.handleJoinRoom)
+		api.POST("/rooms/:id/leave", s.authMiddleware(), s.handleLeaveRoom)
+		
+		// Admin: archiving and legal holds
+		api.POST("/rooms/archive-abandoned", s.authMiddleware(), s.adminMiddleware(), s.handleArchiveAbandonedRooms)
+		api.PUT("/rooms/:id/legal-hold", s.authMiddleware(), s.adminMiddleware(), s.handleSetLegalHold)
 	}
 }
 
@@ -148,18 +183,43 @@ func (h *Hub) run() {
 			log.Printf("Client %s disconnected", client.ID)
 
 		case message := <-h.broadcast:
-			h.mu.RLock()
-			for _, client := range h.clients {
-				if client.rooms[message.RoomID] {
-					select {
-					case client.send <- message:
-					default:
-						close(client.send)
-						delete(h.clients, client.ID)
-					}
+			h.deliver(message)
+			h.relay.publish(hubEvent{Message: &message})
+
+		case event := <-h.remote:
+			switch {
+			case event.Message != nil:
+				h.deliver(*event.Message)
+			case event.Leave != nil:
+				h.forgetUserRoom(event.Leave.UserID, event.Leave.RoomID)
+			case len(event.DropRooms) > 0:
+				h.forgetRooms(event.DropRooms)
+			}
+		}
+	}
+}
+
+// deliver hands the message to the clients of this instance that are in its room
+func (h *Hub) deliver(message Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, client := range h.clients {
+		// Nobody needs to see their own typing indicator
+		if isEphemeral(message.Type) && client.UserID == message.SenderID {
+			continue
+		}
+		if client.rooms[message.RoomID] {
+			select {
+			case client.send <- message:
+			default:
+				// A backed-up client only misses the typing indicator
+				if isEphemeral(message.Type) {
+					continue
 				}
+				close(client.send)
+				delete(h.clients, client.ID)
 			}
-			h.mu.RUnlock()
 		}
 	}
 }
@@ -174,7 +234,7 @@ func (s *Server) handleWebSocket(c *gin.Context) {
 
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade failed: %v", err)
+		requestLog(c).Printf("WebSocket upgrade failed: %v", err)
 		return
 	}
 
@@ -191,6 +251,11 @@ func (s *Server) handleWebSocket(c *gin.Context) {
 
 	s.hub.register <- client
 
+	// Catch up on what was missed while disconnected before live delivery starts
+	if lastSeenID := c.Query("last_seen_message_id"); lastSeenID != "" {
+		client.replayMissed(s.db, lastSeenID)
+	}
+
 	go client.writePump()
 	go client.readPump(s.hub, s.db)
 }
@@ -215,16 +280,32 @@ func (c *Client) readPump(hub *Hub, db *sql.DB) {
 			break
 		}
 
+		// Typing indicators are relayed as they are, never stored
+		if isEphemeral(msg.Type) {
+			c.relayTyping(hub, msg)
+			c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+			continue
+		}
+
 		// Set message metadata
 		msg.ID = uuid.New().String()
 		msg.SenderID = c.UserID
 		msg.Timestamp = time.Now()
 
+		if msg.Type == MessageTypeReference {
+			if err := resolveMessageReference(db, msg.SenderID, msg.Reference); err != nil {
+				log.Printf("Rejected reference message from %s: %v", msg.SenderID, err)
+				continue
+			}
+		} else {
+			msg.Reference = nil
+		}
+
 		// Save message to database
 		_, err = db.Exec(`
-			INSERT INTO chat_messages (id, room_id, sender_id, message_type, content, created_at)
-			VALUES ($1, $2, $3, $4, $5, $6)
-		`, msg.ID, msg.RoomID, msg.SenderID, msg.Type, msg.Content, msg.Timestamp)
+			INSERT INTO chat_messages (id, room_id, sender_id, message_type, content, metadata, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, msg.ID, msg.RoomID, msg.SenderID, msg.Type, msg.Content, referenceMetadata(msg.Reference), msg.Timestamp)
 
 		if err != nil {
 			log.Printf("Failed to save message: %v", err)
@@ -260,6 +341,10 @@ func (c *Client) writePump() {
 				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
+			if c.replayed[message.ID] && !isMessageEvent(message.Type) {
+				delete(c.replayed, message.ID)
+				continue
+			}
 
 			if err := c.conn.WriteJSON(message); err != nil {
 				log.Printf("WebSocket write error: %v", err)
@@ -279,7 +364,7 @@ func (s *Server) loadUserRooms(client *Client) {
 	rows, err := s.db.Query(`
 		SELECT cr.id 
 		FROM chat_rooms cr
-		WHERE cr.participants::jsonb ? $1
+		WHERE cr.participants::jsonb ? $1 AND cr.archived_at IS NULL
 	`, client.UserID)
 
 	if err != nil {
@@ -346,15 +431,18 @@ func (s *Server) handleCreateRoom(c *gin.Context) {
 func (s *Server) handleGetRooms(c *gin.Context) {
 	userID := c.GetString("user_id")
 	
+	// Archived rooms are only listed on request (?archived=true)
+	archived := c.Query("archived") == "true"
+	
 	rows, err := s.db.Query(`
-		SELECT id, room_type, transaction_id, dispute_id, participants, last_message_at, created_at
+		SELECT id, room_type, transaction_id, dispute_id, participants, last_message_at, created_at, archived_at
 		FROM chat_rooms
-		WHERE participants::jsonb ? $1
+		WHERE participants::jsonb ? $1 AND (archived_at IS NOT NULL) = $2
 		ORDER BY last_message_at DESC
-	`, userID)
+	`, userID, archived)
 	
 	if err != nil {
-		log.Printf("Error fetching rooms for user %s: %v", userID, err)
+		requestLog(c).Printf("Error fetching rooms for user %s: %v", userID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rooms"})
 		return
 	}
@@ -366,7 +454,7 @@ func (s *Server) handleGetRooms(c *gin.Context) {
 		var participantsJSON string
 		
 		err := rows.Scan(&room.ID, &room.Type, &room.TransactionID, &room.DisputeID,
-			&participantsJSON, &room.LastMessage, &room.CreatedAt)
+			&participantsJSON, &room.LastMessage, &room.CreatedAt, &room.ArchivedAt)
 		if err != nil {
 			continue
 		}
@@ -403,7 +491,7 @@ func (s *Server) handleGetMessages(c *gin.Context) {
 	
 	// Get messages
 	rows, err := s.db.Query(`
-		SELECT id, room_id, sender_id, message_type, content, created_at
+		SELECT id, room_id, sender_id, message_type, content, metadata, created_at, edited_at, deleted_at
 		FROM chat_messages
 		WHERE room_id = $1
 		ORDER BY created_at ASC
@@ -419,10 +507,14 @@ func (s *Server) handleGetMessages(c *gin.Context) {
 	var messages []Message
 	for rows.Next() {
 		var msg Message
-		err := rows.Scan(&msg.ID, &msg.RoomID, &msg.SenderID, &msg.Type, &msg.Content, &msg.Timestamp)
+		var metadata sql.NullString
+		var editedAt, deletedAt sql.NullTime
+		err := rows.Scan(&msg.ID, &msg.RoomID, &msg.SenderID, &msg.Type, &msg.Content, &metadata, &msg.Timestamp, &editedAt, &deletedAt)
 		if err != nil {
 			continue
 		}
+		msg.Reference = parseReferenceMetadata(metadata)
+		msg.applyTombstone(editedAt, deletedAt)
 		messages = append(messages, msg)
 	}
 	
@@ -434,8 +526,9 @@ func (s *Server) handleSendMessage(c *gin.Context) {
 	userID := c.GetString("user_id")
 	
 	var req struct {
-		Type    string `json:"message_type"`
-		Content string `json:"content" binding:"required"`
+		Type      string            `json:"message_type"`
+		Content   string            `json:"content"`
+		Reference *MessageReference `json:"reference"`
 	}
 	
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -446,12 +539,20 @@ func (s *Server) handleSendMessage(c *gin.Context) {
 	if req.Type == "" {
 		req.Type = "TEXT"
 	}
+	if req.Type != MessageTypeReference {
+		req.Reference = nil
+		if req.Content == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "content is required"})
+			return
+		}
+	}
 	
 	// Check if user is participant
 	var participantsJSON string
+	var archivedAt *time.Time
 	err := s.db.QueryRow(`
-		SELECT participants FROM chat_rooms WHERE id = $1
-	`, roomID).Scan(&participantsJSON)
+		SELECT participants, archived_at FROM chat_rooms WHERE id = $1
+	`, roomID).Scan(&participantsJSON, &archivedAt)
 	
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
@@ -466,6 +567,28 @@ func (s *Server) handleSendMessage(c *gin.Context) {
 		return
 	}
 	
+	if archivedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Room is archived"})
+		return
+	}
+	
+	// Reference messages must point at an entity the sender is a party to
+	if req.Type == MessageTypeReference {
+		err := resolveMessageReference(s.db, userID, req.Reference)
+		switch err {
+		case nil:
+		case errReferenceForbidden:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		case errReferenceNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	
 	// Create message
 	msg := Message{
 		ID:        uuid.New().String(),
@@ -474,13 +597,14 @@ func (s *Server) handleSendMessage(c *gin.Context) {
 		Type:      req.Type,
 		Content:   req.Content,
 		Timestamp: time.Now(),
+		Reference: req.Reference,
 	}
 	
 	// Save message
 	_, err = s.db.Exec(`
-		INSERT INTO chat_messages (id, room_id, sender_id, message_type, content, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, msg.ID, msg.RoomID, msg.SenderID, msg.Type, msg.Content, msg.Timestamp)
+		INSERT INTO chat_messages (id, room_id, sender_id, message_type, content, metadata, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, msg.ID, msg.RoomID, msg.SenderID, msg.Type, msg.Content, referenceMetadata(msg.Reference), msg.Timestamp)
 	
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
@@ -500,6 +624,7 @@ func (s *Server) handleSendMessage(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{
 		"message_id": msg.ID,
 		"message":    "Message sent successfully",
+		"reference":  msg.Reference,
 	})
 }
 
@@ -541,6 +666,125 @@ func (s *Server) handleJoinRoom(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Joined room successfully"})
 }
 
+// handleLeaveRoom removes the caller from the room. The parties of an order or dispute that is
+// still open cannot leave its room; a DIRECT room is archived once its last participant leaves.
+func (s *Server) handleLeaveRoom(c *gin.Context) {
+	roomID := c.Param("id")
+	userID := c.GetString("user_id")
+	
+	tx, err := s.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave room"})
+		return
+	}
+	defer tx.Rollback()
+	
+	var roomType, participantsJSON string
+	var transactionID, disputeID sql.NullString
+	err = tx.QueryRow(`
+		SELECT room_type, participants, transaction_id, dispute_id
+		FROM chat_rooms WHERE id = $1
+		FOR UPDATE
+	`, roomID).Scan(&roomType, &participantsJSON, &transactionID, &disputeID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Printf("Error loading chat room %s: %v", roomID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave room"})
+		return
+	}
+	
+	var participants []string
+	json.Unmarshal([]byte(participantsJSON), &participants)
+	if !contains(participants, userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not a participant of this room"})
+		return
+	}
+	
+	if roomType != "DIRECT" {
+		var mustStay bool
+		err = tx.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM orders o
+				WHERE o.id = $1 AND o.status NOT IN ('COMPLETED', 'CANCELLED', 'EXPIRED')
+					AND $3 IN (o.user_id::text, o.cashier_id::text)
+			) OR EXISTS (
+				SELECT 1 FROM disputes d
+				WHERE (d.id = $2 OR d.order_id = $1 OR d.transaction_id = $1
+						OR d.transaction_id IN (SELECT t.id FROM transactions t WHERE t.order_id = $1))
+					AND d.status NOT IN ('RESOLVED', 'CLOSED')
+					AND $3 IN (d.initiator_id::text, d.respondent_id::text, d.mediator_id::text)
+			)
+		`, transactionID, disputeID, userID).Scan(&mustStay)
+		if err != nil {
+			requestLog(c).Printf("Error checking parties of chat room %s: %v", roomID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave room"})
+			return
+		}
+		if mustStay {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Parties of an open order or dispute cannot leave its room",
+				"code":  "ROOM_PARTY_CANNOT_LEAVE",
+			})
+			return
+		}
+	}
+	
+	remaining := []string{}
+	for _, participant := range participants {
+		if participant != userID {
+			remaining = append(remaining, participant)
+		}
+	}
+	archive := roomType == "DIRECT" && len(remaining) == 0
+	remainingJSON, _ := json.Marshal(remaining)
+	
+	_, err = tx.Exec(`
+		UPDATE chat_rooms
+		SET participants = $2,
+			archived_at = CASE WHEN $3 THEN COALESCE(archived_at, NOW()) ELSE archived_at END
+		WHERE id = $1
+	`, roomID, string(remainingJSON), archive)
+	if err != nil {
+		requestLog(c).Printf("Error removing %s from chat room %s: %v", userID, roomID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave room"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave room"})
+		return
+	}
+	
+	s.hub.leaveRoom(userID, roomID)
+	requestLog(c).Printf("🚪 User %s left chat room %s", userID, roomID)
+	
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Left room successfully",
+		"room_id":  roomID,
+		"archived": archive,
+	})
+}
+
+// leaveRoom stops delivering the room's messages to the user's connected clients, on every
+// instance
+func (h *Hub) leaveRoom(userID, roomID string) {
+	h.forgetUserRoom(userID, roomID)
+	h.relay.publish(hubEvent{Leave: &roomLeave{UserID: userID, RoomID: roomID}})
+}
+
+func (h *Hub) forgetUserRoom(userID, roomID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, client := range h.clients {
+		if client.UserID == userID {
+			delete(client.rooms, roomID)
+		}
+	}
+}
+
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
 		if s == item {
@@ -0,0 +1,184 @@
+// services/chat/message_edits.go
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// The sender of a message can edit it within CHAT_MESSAGE_EDIT_WINDOW (Go duration, default 15m)
+// of sending it, and delete it at any time. Edits keep the previous text in chat_message_edits;
+// deletes only set deleted_at, so the original stays in the database for audits and disputes
+// while history shows "[deleted]". Connected clients are told through message_edited and
+// message_deleted frames carrying the message ID. Messages of archived rooms cannot be changed.
+
+const (
+	MessageEventEdited  = "message_edited"
+	MessageEventDeleted = "message_deleted"
+
+	deletedMessageContent = "[deleted]"
+)
+
+func messageEditWindow() time.Duration {
+	if value, err := time.ParseDuration(os.Getenv("CHAT_MESSAGE_EDIT_WINDOW")); err == nil && value > 0 {
+		return value
+	}
+	return 15 * time.Minute
+}
+
+// isMessageEvent reports whether the frame announces a change to an earlier message
+func isMessageEvent(messageType string) bool {
+	return messageType == MessageEventEdited || messageType == MessageEventDeleted
+}
+
+// applyTombstone marks an edited message and hides the content of a deleted one
+func (msg *Message) applyTombstone(editedAt, deletedAt sql.NullTime) {
+	if editedAt.Valid {
+		msg.EditedAt = &editedAt.Time
+	}
+	if deletedAt.Valid {
+		msg.Deleted = true
+		msg.Content = deletedMessageContent
+		msg.Reference = nil
+	}
+}
+
+// lockOwnMessage loads and locks the message for the caller. It writes the error response and
+// returns false when the message does not exist, is not the caller's or can no longer change.
+func lockOwnMessage(c *gin.Context, tx *sql.Tx) (Message, bool) {
+	msg := Message{ID: c.Param("messageId"), RoomID: c.Param("id")}
+	if _, err := uuid.Parse(msg.ID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return msg, false
+	}
+
+	var deletedAt, archivedAt sql.NullTime
+	err := tx.QueryRow(`
+		SELECT m.sender_id, m.message_type, m.content, m.created_at, m.deleted_at, r.archived_at
+		FROM chat_messages m
+		JOIN chat_rooms r ON r.id = m.room_id
+		WHERE m.id = $1 AND m.room_id::text = $2
+		FOR UPDATE OF m
+	`, msg.ID, msg.RoomID).Scan(&msg.SenderID, &msg.Type, &msg.Content, &msg.Timestamp, &deletedAt, &archivedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return msg, false
+	}
+	if err != nil {
+		requestLog(c).Printf("Error loading chat message %s: %v", msg.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load message"})
+		return msg, false
+	}
+
+	switch {
+	case msg.SenderID != c.GetString("user_id"):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the sender can change this message"})
+	case deletedAt.Valid:
+		c.JSON(http.StatusConflict, gin.H{"error": "Message was deleted"})
+	case archivedAt.Valid:
+		c.JSON(http.StatusConflict, gin.H{"error": "Room is archived"})
+	default:
+		return msg, true
+	}
+	return msg, false
+}
+
+func (s *Server) handleEditMessage(c *gin.Context) {
+	var req struct {
+		Content string `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to edit message"})
+		return
+	}
+	defer tx.Rollback()
+
+	msg, ok := lockOwnMessage(c, tx)
+	if !ok {
+		return
+	}
+	if msg.Type == MessageTypeReference {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reference messages cannot be edited"})
+		return
+	}
+	if time.Since(msg.Timestamp) > messageEditWindow() {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Messages can only be edited within " + messageEditWindow().String() + " of sending them",
+			"code":  "MESSAGE_EDIT_WINDOW_EXPIRED",
+		})
+		return
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO chat_message_edits (message_id, previous_content) VALUES ($1, $2)
+	`, msg.ID, msg.Content)
+	if err != nil {
+		requestLog(c).Printf("Error saving previous version of chat message %s: %v", msg.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to edit message"})
+		return
+	}
+
+	var editedAt time.Time
+	err = tx.QueryRow(`
+		UPDATE chat_messages SET content = $2, edited_at = NOW() WHERE id = $1 RETURNING edited_at
+	`, msg.ID, req.Content).Scan(&editedAt)
+	if err != nil {
+		requestLog(c).Printf("Error editing chat message %s: %v", msg.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to edit message"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to edit message"})
+		return
+	}
+
+	msg.Type = MessageEventEdited
+	msg.Content = req.Content
+	msg.EditedAt = &editedAt
+	s.hub.broadcast <- msg
+
+	c.JSON(http.StatusOK, gin.H{"message_id": msg.ID, "content": msg.Content, "edited_at": editedAt})
+}
+
+func (s *Server) handleDeleteMessage(c *gin.Context) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete message"})
+		return
+	}
+	defer tx.Rollback()
+
+	msg, ok := lockOwnMessage(c, tx)
+	if !ok {
+		return
+	}
+
+	if _, err := tx.Exec(`UPDATE chat_messages SET deleted_at = NOW() WHERE id = $1`, msg.ID); err != nil {
+		requestLog(c).Printf("Error deleting chat message %s: %v", msg.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete message"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete message"})
+		return
+	}
+	requestLog(c).Printf("🗑️ Chat message %s deleted by its sender", msg.ID)
+
+	msg.Type = MessageEventDeleted
+	msg.Content = deletedMessageContent
+	msg.Deleted = true
+	s.hub.broadcast <- msg
+
+	c.JSON(http.StatusOK, gin.H{"message_id": msg.ID, "deleted": true})
+}
@@ -9,6 +9,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+
+	"shared/revocation"
 )
 
 func (s *Server) authMiddleware() gin.HandlerFunc {
@@ -59,6 +61,11 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 				return
 			}
 			
+			if revocation.IsUserRevoked(c.Request.Context(), s.redis, userID) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is closed"})
+				c.Abort()
+				return
+			}
 			c.Set("user_id", userID)
 			c.Next()
 		} else {
@@ -67,4 +74,18 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 			return
 		}
 	}
-}
\ No newline at end of file
+}
+
+func (s *Server) adminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var role string
+		err := s.db.QueryRow(`SELECT COALESCE(role, '') FROM users WHERE id = $1`, c.GetString("user_id")).Scan(&role)
+		if err != nil || role != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,114 @@
+// services/chat/pubsub.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// Several chat instances can run behind the gateway. Each one delivers a broadcast to its own
+// clients right away and publishes it on the CHAT_PUBSUB_CHANNEL Redis channel (chat:events by
+// default); every instance subscribes and hands what other instances published to its local
+// clients, skipping its own events by instance ID. Room changes that stop delivery (leaving,
+// archiving) travel the same way. While Redis is unreachable each instance keeps serving its
+// own clients and resubscribes in the background.
+
+const (
+	pubsubOutboundBuffer = 1024
+	pubsubRetryDelay     = 5 * time.Second
+)
+
+// hubEvent is what instances exchange; exactly one of its payloads is set
+type hubEvent struct {
+	Origin    string     `json:"origin"`
+	Message   *Message   `json:"message,omitempty"`
+	Leave     *roomLeave `json:"leave,omitempty"`
+	DropRooms []string   `json:"drop_rooms,omitempty"`
+}
+
+type roomLeave struct {
+	UserID string `json:"user_id"`
+	RoomID string `json:"room_id"`
+}
+
+type hubRelay struct {
+	redis    *redis.Client
+	channel  string
+	instance string
+	outbound chan hubEvent
+}
+
+func newHubRelay(client *redis.Client) *hubRelay {
+	channel := os.Getenv("CHAT_PUBSUB_CHANNEL")
+	if channel == "" {
+		channel = "chat:events"
+	}
+	return &hubRelay{
+		redis:    client,
+		channel:  channel,
+		instance: uuid.New().String(),
+		outbound: make(chan hubEvent, pubsubOutboundBuffer),
+	}
+}
+
+// publish queues the event for the other instances without blocking the hub
+func (r *hubRelay) publish(event hubEvent) {
+	event.Origin = r.instance
+	select {
+	case r.outbound <- event:
+	default:
+		log.Printf("⚠️ Chat relay backlog full, event not sent to other instances")
+	}
+}
+
+// runPublisher sends queued events in order
+func (r *hubRelay) runPublisher() {
+	ctx := context.Background()
+	for event := range r.outbound {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Error encoding chat relay event: %v", err)
+			continue
+		}
+		if err := r.redis.Publish(ctx, r.channel, payload).Err(); err != nil {
+			log.Printf("⚠️ Failed to publish chat event to other instances: %v", err)
+		}
+	}
+}
+
+// runSubscriber passes the events of other instances to the hub, resubscribing after failures
+func (r *hubRelay) runSubscriber(remote chan<- hubEvent) {
+	ctx := context.Background()
+	for {
+		sub := r.redis.Subscribe(ctx, r.channel)
+		if _, err := sub.Receive(ctx); err != nil {
+			log.Printf("⚠️ Chat relay: failed to subscribe to %s, retrying: %v", r.channel, err)
+			sub.Close()
+			time.Sleep(pubsubRetryDelay)
+			continue
+		}
+
+		log.Printf("📡 Chat relay: instance %s subscribed to %s", r.instance, r.channel)
+		for msg := range sub.Channel() {
+			var event hubEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				log.Printf("⚠️ Chat relay: skipping malformed event: %v", err)
+				continue
+			}
+			if event.Origin == r.instance {
+				continue
+			}
+			remote <- event
+		}
+
+		log.Printf("⚠️ Chat relay: subscription to %s closed, resubscribing", r.channel)
+		sub.Close()
+		time.Sleep(pubsubRetryDelay)
+	}
+}
@@ -0,0 +1,144 @@
+// services/chat/references.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+)
+
+// REFERENCE messages embed an order or transaction so clients can render a preview card.
+// The sender must be a party to the referenced entity; the preview is captured when the
+// message is sent. CHAT_REFERENCE_TYPES lists the entity types that may be referenced.
+
+const MessageTypeReference = "REFERENCE"
+
+type MessageReference struct {
+	Type    string                 `json:"type"` // ORDER or TRANSACTION
+	ID      string                 `json:"id"`
+	Preview map[string]interface{} `json:"preview,omitempty"`
+}
+
+var (
+	errReferenceTypeDisabled = errors.New("this reference type is not enabled")
+	errReferenceNotFound     = errors.New("referenced entity not found")
+	errReferenceForbidden    = errors.New("not authorized to reference this entity")
+)
+
+func referenceTypesEnabled() map[string]bool {
+	value := os.Getenv("CHAT_REFERENCE_TYPES")
+	if value == "" {
+		value = "ORDER,TRANSACTION"
+	}
+
+	enabled := make(map[string]bool)
+	for _, t := range strings.Split(value, ",") {
+		if t = strings.ToUpper(strings.TrimSpace(t)); t != "" {
+			enabled[t] = true
+		}
+	}
+	return enabled
+}
+
+// resolveMessageReference checks the referenced entity exists and the sender may reference it,
+// then fills in the preview
+func resolveMessageReference(db *sql.DB, senderID string, ref *MessageReference) error {
+	if ref == nil || ref.ID == "" {
+		return errReferenceNotFound
+	}
+	ref.Type = strings.ToUpper(ref.Type)
+	if !referenceTypesEnabled()[ref.Type] {
+		return errReferenceTypeDisabled
+	}
+
+	var ownerID, cashierID sql.NullString
+	var preview map[string]interface{}
+
+	switch ref.Type {
+	case "ORDER":
+		var orderType, currencyFrom, currencyTo, amount, rate, status string
+		var createdAt sql.NullTime
+		err := db.QueryRow(`
+			SELECT user_id, cashier_id, order_type, currency_from, currency_to,
+				amount::text, rate::text, status, created_at
+			FROM orders WHERE id::text = $1
+		`, ref.ID).Scan(&ownerID, &cashierID, &orderType, &currencyFrom, &currencyTo,
+			&amount, &rate, &status, &createdAt)
+		if err != nil {
+			return errReferenceNotFound
+		}
+		preview = map[string]interface{}{
+			"order_type":    orderType,
+			"currency_from": currencyFrom,
+			"currency_to":   currencyTo,
+			"amount":        amount,
+			"rate":          rate,
+			"status":        status,
+			"created_at":    createdAt.Time,
+		}
+	case "TRANSACTION":
+		var fromID, toID sql.NullString
+		var transactionType, amount, currency, status string
+		var createdAt sql.NullTime
+		err := db.QueryRow(`
+			SELECT user_id, from_user_id, to_user_id, transaction_type,
+				amount::text, currency, status, created_at
+			FROM transactions WHERE id::text = $1
+		`, ref.ID).Scan(&ownerID, &fromID, &toID, &transactionType, &amount, &currency, &status, &createdAt)
+		if err != nil {
+			return errReferenceNotFound
+		}
+		if fromID.String == senderID || toID.String == senderID {
+			ownerID = sql.NullString{String: senderID, Valid: true}
+		}
+		preview = map[string]interface{}{
+			"transaction_type": transactionType,
+			"amount":           amount,
+			"currency":         currency,
+			"status":           status,
+			"created_at":       createdAt.Time,
+		}
+	default:
+		return errReferenceTypeDisabled
+	}
+
+	if ownerID.String != senderID && cashierID.String != senderID && !isStaff(db, senderID) {
+		return errReferenceForbidden
+	}
+
+	ref.Preview = preview
+	return nil
+}
+
+// isStaff reports whether the user is an admin or mediator, who may reference any entity
+func isStaff(db *sql.DB, userID string) bool {
+	var staff bool
+	db.QueryRow(`
+		SELECT COALESCE(role, '') = 'admin' OR COALESCE(is_mediator, false)
+		FROM users WHERE id = $1
+	`, userID).Scan(&staff)
+	return staff
+}
+
+// referenceMetadata serializes the reference for chat_messages.metadata
+func referenceMetadata(ref *MessageReference) interface{} {
+	if ref == nil {
+		return nil
+	}
+	data, _ := json.Marshal(map[string]interface{}{"reference": ref})
+	return string(data)
+}
+
+// parseReferenceMetadata extracts the reference stored with a message, if any
+func parseReferenceMetadata(metadata sql.NullString) *MessageReference {
+	if !metadata.Valid {
+		return nil
+	}
+	var data struct {
+		Reference *MessageReference `json:"reference"`
+	}
+	json.Unmarshal([]byte(metadata.String), &data)
+	return data.Reference
+}
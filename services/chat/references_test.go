@@ -0,0 +1,110 @@
+// services/chat/references_test.go
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+// referenceArg matches chat_messages.metadata holding a reference to the given order with its preview
+type referenceArg string
+
+func (a referenceArg) Match(v driver.Value) bool {
+	metadata, ok := v.(string)
+	if !ok {
+		return false
+	}
+	var data struct {
+		Reference MessageReference `json:"reference"`
+	}
+	json.Unmarshal([]byte(metadata), &data)
+	return data.Reference.Type == "ORDER" && data.Reference.ID == string(a) && data.Reference.Preview["amount"] == "690"
+}
+
+// sendReferenceMessage posts a reference to order-1 as user-1 in room-1
+func sendReferenceMessage(s *Server) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/rooms/room-1/messages",
+		strings.NewReader(`{"message_type":"REFERENCE","reference":{"type":"order","id":"order-1"}}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "id", Value: "room-1"}}
+	c.Set("user_id", "user-1")
+	s.handleSendMessage(c)
+	return w
+}
+
+func expectReferencedOrder(mock sqlmock.Sqlmock, ownerID string) {
+	mock.ExpectQuery(`SELECT participants, archived_at FROM chat_rooms WHERE id = \$1`).WithArgs("room-1").
+		WillReturnRows(sqlmock.NewRows([]string{"participants", "archived_at"}).AddRow(`["user-1","cashier-1"]`, nil))
+	mock.ExpectQuery(`FROM orders WHERE id::text = \$1`).WithArgs("order-1").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "cashier_id", "order_type", "currency_from", "currency_to",
+			"amount", "rate", "status", "created_at"}).
+			AddRow(ownerID, "cashier-1", "SELL", "USD", "BOB", "690", "6.9", "MATCHED", time.Now()))
+}
+
+func TestSendReferenceMessageToOwnOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	expectReferencedOrder(mock, "user-1")
+	mock.ExpectExec(`INSERT INTO chat_messages`).
+		WithArgs(sqlmock.AnyArg(), "room-1", "user-1", MessageTypeReference, "", referenceArg("order-1"), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE chat_rooms\s+SET last_message_at`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	hub := &Hub{broadcast: make(chan Message, 1)}
+	w := sendReferenceMessage(&Server{db: db, hub: hub})
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d %s, want 201", w.Code, w.Body.String())
+	}
+	var response struct {
+		Reference MessageReference `json:"reference"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Reference.Type != "ORDER" || response.Reference.Preview["status"] != "MATCHED" ||
+		response.Reference.Preview["rate"] != "6.9" {
+		t.Errorf("reference = %+v, want the ORDER preview", response.Reference)
+	}
+	if msg := <-hub.broadcast; msg.Reference == nil || msg.Reference.ID != "order-1" {
+		t.Errorf("broadcast %+v, want the message with its reference", msg)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSendReferenceMessageToSomeoneElsesOrderIsForbidden(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// order-1 belongs to user-2 and user-1 is neither the cashier nor staff
+	expectReferencedOrder(mock, "user-2")
+	mock.ExpectQuery(`SELECT COALESCE\(role, ''\) = 'admin' OR COALESCE\(is_mediator, false\)`).WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"staff"}).AddRow(false))
+
+	w := sendReferenceMessage(&Server{db: db, hub: &Hub{broadcast: make(chan Message, 1)}})
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d %s, want 403", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
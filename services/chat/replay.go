@@ -0,0 +1,125 @@
+// services/chat/replay.go
+package main
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// A client reconnecting after a drop passes the ID of the last message it received as
+// ?last_seen_message_id= on /ws. Before live delivery starts it is sent the messages of its rooms
+// created after that one, oldest first, at most CHAT_REPLAY_LIMIT (default 200) and none older
+// than CHAT_REPLAY_WINDOW (Go duration, default 24h). A replay_complete frame follows with the
+// count; when truncated is set the client should page the rest with GET /rooms/:id/messages.
+
+const (
+	defaultReplayLimit  = 200
+	defaultReplayWindow = 24 * time.Hour
+)
+
+func replayLimit() int {
+	if value, err := strconv.Atoi(os.Getenv("CHAT_REPLAY_LIMIT")); err == nil && value > 0 {
+		return value
+	}
+	return defaultReplayLimit
+}
+
+func replayWindow() time.Duration {
+	if value, err := time.ParseDuration(os.Getenv("CHAT_REPLAY_WINDOW")); err == nil && value > 0 {
+		return value
+	}
+	return defaultReplayWindow
+}
+
+type replayComplete struct {
+	Type      string `json:"message_type"`
+	Replayed  int    `json:"replayed"`
+	Truncated bool   `json:"truncated"`
+}
+
+// missedMessages loads the messages of the client's rooms created after lastSeenID. The cursor
+// must belong to one of those rooms; otherwise nothing is replayed.
+func missedMessages(db *sql.DB, client *Client, lastSeenID string) ([]Message, bool, error) {
+	if _, err := uuid.Parse(lastSeenID); err != nil || len(client.rooms) == 0 {
+		return nil, false, nil
+	}
+	roomIDs := make([]string, 0, len(client.rooms))
+	for roomID := range client.rooms {
+		roomIDs = append(roomIDs, roomID)
+	}
+
+	limit := replayLimit()
+	rows, err := db.Query(`
+		SELECT m.id, m.room_id, m.sender_id, m.message_type, m.content, m.metadata, m.created_at,
+			m.edited_at, m.deleted_at, seen.created_at < $3
+		FROM chat_messages seen
+		JOIN chat_messages m ON m.room_id::text = ANY($2)
+			AND (m.created_at, m.id) > (seen.created_at, seen.id)
+			AND m.created_at >= $3
+		WHERE seen.id = $1 AND seen.room_id::text = ANY($2)
+		ORDER BY m.created_at, m.id
+		LIMIT $4
+	`, lastSeenID, pq.Array(roomIDs), time.Now().Add(-replayWindow()), limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	truncated := false
+	for rows.Next() {
+		var msg Message
+		var metadata sql.NullString
+		var editedAt, deletedAt sql.NullTime
+		var cursorExpired bool
+		if err := rows.Scan(&msg.ID, &msg.RoomID, &msg.SenderID, &msg.Type, &msg.Content, &metadata, &msg.Timestamp,
+			&editedAt, &deletedAt, &cursorExpired); err != nil {
+			return nil, false, err
+		}
+		// Messages between the cursor and the start of the window are not replayed
+		truncated = truncated || cursorExpired
+		msg.Reference = parseReferenceMetadata(metadata)
+		msg.applyTombstone(editedAt, deletedAt)
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	if len(messages) > limit {
+		messages = messages[:limit]
+		truncated = true
+	}
+	return messages, truncated, nil
+}
+
+// replayMissed writes the missed messages straight to the connection; it runs after the client
+// is registered but before writePump starts, so live messages queue in client.send behind the
+// replay. Messages that were both replayed and queued are skipped by writePump.
+func (c *Client) replayMissed(db *sql.DB, lastSeenID string) {
+	messages, truncated, err := missedMessages(db, c, lastSeenID)
+	if err != nil {
+		log.Printf("Failed to load missed messages for %s: %v", c.UserID, err)
+		return
+	}
+
+	c.replayed = make(map[string]bool, len(messages))
+	for _, msg := range messages {
+		c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := c.conn.WriteJSON(msg); err != nil {
+			log.Printf("WebSocket replay error: %v", err)
+			return
+		}
+		c.replayed[msg.ID] = true
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	c.conn.WriteJSON(replayComplete{Type: "replay_complete", Replayed: len(messages), Truncated: truncated})
+	log.Printf("Replayed %d missed messages to %s", len(messages), c.ID)
+}
@@ -0,0 +1,47 @@
+// services/chat/typing.go
+package main
+
+import (
+	"time"
+)
+
+// TYPING messages tell the other participants of a room that the sender is writing. They are
+// ephemeral: relayed to the room's connected clients other than the sender's, never stored. A
+// client sends one every few seconds while the user types; events arriving within typingDebounce
+// of the previous one for the same room are dropped.
+
+const (
+	MessageTypeTyping = "TYPING"
+
+	typingDebounce = 2 * time.Second
+)
+
+// isEphemeral reports whether messages of this type are relayed without being stored
+func isEphemeral(messageType string) bool {
+	return messageType == MessageTypeTyping
+}
+
+// relayTyping broadcasts a typing event for the sender; it is called from readPump only
+func (c *Client) relayTyping(hub *Hub, msg Message) {
+	hub.mu.RLock()
+	member := c.rooms[msg.RoomID]
+	hub.mu.RUnlock()
+	if !member {
+		return
+	}
+
+	if c.lastTyping == nil {
+		c.lastTyping = make(map[string]time.Time)
+	}
+	if last, ok := c.lastTyping[msg.RoomID]; ok && time.Since(last) < typingDebounce {
+		return
+	}
+	c.lastTyping[msg.RoomID] = time.Now()
+
+	hub.broadcast <- Message{
+		RoomID:    msg.RoomID,
+		SenderID:  c.UserID,
+		Type:      MessageTypeTyping,
+		Timestamp: time.Now(),
+	}
+}
@@ -0,0 +1,25 @@
+// services/dispute/audit_log.go
+package main
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordAuditLog stores an admin action in audit_logs, with any details in new_values
+func (s *Server) recordAuditLog(c *gin.Context, userID, action, entityType, entityID string, details map[string]interface{}) {
+	detailsJSON, _ := json.Marshal(details)
+	_, err := s.db.Exec(`
+		INSERT INTO audit_logs (user_id, action, entity_type, entity_id, new_values, ip_address, user_agent, service)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::inet, $7, 'dispute')
+	`, userID, action, entityType, entityID, string(detailsJSON), c.ClientIP(), c.Request.UserAgent())
+
+	if err != nil {
+		log.Printf("⚠️ Failed to write audit log %s for %s %s: %v", action, entityType, entityID, err)
+		return
+	}
+
+	log.Printf("📝 Audit: %s by %s on %s %s", action, userID, entityType, entityID)
+}
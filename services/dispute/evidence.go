@@ -0,0 +1,256 @@
+// services/dispute/evidence.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/nfnt/resize"
+)
+
+const evidenceBucket = "dispute-evidence"
+
+// Max evidence upload size (10MB, same as KYC documents)
+const maxEvidenceSize = 10 * 1024 * 1024
+
+var evidenceContentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".pdf":  "application/pdf",
+}
+
+func (s *Server) ensureEvidenceBucket() {
+	if s.minioClient == nil {
+		return
+	}
+
+	ctx := context.Background()
+	exists, err := s.minioClient.BucketExists(ctx, evidenceBucket)
+	if err != nil {
+		log.Printf("Warning: could not check evidence bucket: %v", err)
+		return
+	}
+	if !exists {
+		if err := s.minioClient.MakeBucket(ctx, evidenceBucket, minio.MakeBucketOptions{}); err != nil {
+			log.Printf("Warning: could not create evidence bucket: %v", err)
+		}
+	}
+}
+
+// getDisputeParticipants returns initiator, respondent and mediator (may be empty)
+func (s *Server) getDisputeParticipants(disputeID string) (string, string, string, error) {
+	var initiatorID, respondentID string
+	var mediatorID sql.NullString
+	err := s.db.QueryRow(`
+		SELECT initiator_id, respondent_id, mediator_id
+		FROM disputes
+		WHERE id = $1
+	`, disputeID).Scan(&initiatorID, &respondentID, &mediatorID)
+
+	return initiatorID, respondentID, mediatorID.String, err
+}
+
+func (s *Server) handleUploadEvidence(c *gin.Context) {
+	disputeID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	evidenceType := c.PostForm("evidence_type")
+	description := c.PostForm("description")
+
+	validTypes := []string{"SCREENSHOT", "DOCUMENT", "TRANSACTION_PROOF", "OTHER"}
+	if !contains(validTypes, evidenceType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid evidence type"})
+		return
+	}
+
+	initiatorID, respondentID, _, err := s.getDisputeParticipants(disputeID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dispute not found"})
+		return
+	}
+
+	if userID != initiatorID && userID != respondentID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxEvidenceSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File too large (max 10MB)"})
+		return
+	}
+
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	contentType, ok := evidenceContentTypes[ext]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type (allowed: jpg, jpeg, png, pdf)"})
+		return
+	}
+
+	// Images are resized and re-encoded as JPEG, PDFs are stored as-is
+	var data []byte
+	if ext != ".pdf" {
+		data, err = s.processImage(file)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File is not a valid image"})
+			return
+		}
+		ext = ".jpg"
+		contentType = "image/jpeg"
+	} else {
+		data, err = io.ReadAll(io.LimitReader(file, maxEvidenceSize+1))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+			return
+		}
+		if len(data) > maxEvidenceSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File too large (max 10MB)"})
+			return
+		}
+		if !bytes.HasPrefix(data, []byte("%PDF")) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File is not a valid PDF"})
+			return
+		}
+	}
+
+	if s.minioClient == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "File storage unavailable"})
+		return
+	}
+
+	hash := sha256.Sum256(data)
+	fileHash := hex.EncodeToString(hash[:])
+
+	evidenceID := uuid.New().String()
+	objectKey := fmt.Sprintf("%s/%s%s", disputeID, evidenceID, ext)
+
+	_, err = s.minioClient.PutObject(
+		c.Request.Context(),
+		evidenceBucket,
+		objectKey,
+		bytes.NewReader(data),
+		int64(len(data)),
+		minio.PutObjectOptions{ContentType: contentType},
+	)
+	if err != nil {
+		requestLog(c).Printf("Error uploading evidence for dispute %s: %v", disputeID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store evidence file"})
+		return
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO dispute_evidence (
+			id, dispute_id, submitted_by, evidence_type, description, file_path,
+			file_hash, file_size, mime_type, original_filename, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, evidenceID, disputeID, userID, evidenceType, description, objectKey,
+		fileHash, len(data), contentType, header.Filename, time.Now())
+
+	if err != nil {
+		requestLog(c).Printf("Error saving evidence %s: %v", evidenceID, err)
+		s.minioClient.RemoveObject(context.Background(), evidenceBucket, objectKey, minio.RemoveObjectOptions{})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit evidence"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"evidence_id": evidenceID,
+		"file_path":   objectKey,
+		"file_hash":   fileHash,
+		"file_size":   len(data),
+		"mime_type":   contentType,
+		"message":     "Evidence uploaded successfully",
+	})
+}
+
+func (s *Server) handleGetEvidenceFile(c *gin.Context) {
+	disputeID := c.Param("id")
+	evidenceID := c.Param("evidenceId")
+	userID := c.GetString("user_id")
+
+	initiatorID, respondentID, mediatorID, err := s.getDisputeParticipants(disputeID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dispute not found"})
+		return
+	}
+
+	if userID != initiatorID && userID != respondentID && (mediatorID == "" || userID != mediatorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	var objectKey, fileHash, mimeType string
+	var fileSize int64
+	err = s.db.QueryRow(`
+		SELECT file_path, COALESCE(file_hash, ''), COALESCE(file_size, 0), COALESCE(mime_type, 'application/octet-stream')
+		FROM dispute_evidence
+		WHERE id = $1 AND dispute_id = $2
+	`, evidenceID, disputeID).Scan(&objectKey, &fileHash, &fileSize, &mimeType)
+
+	// Evidence submitted with a client-supplied path has no stored object
+	if err != nil || fileHash == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Evidence file not found"})
+		return
+	}
+
+	if s.minioClient == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "File storage unavailable"})
+		return
+	}
+
+	object, err := s.minioClient.GetObject(c.Request.Context(), evidenceBucket, objectKey, minio.GetObjectOptions{})
+	if err != nil {
+		requestLog(c).Printf("Error reading evidence %s: %v", evidenceID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read evidence file"})
+		return
+	}
+	defer object.Close()
+
+	c.DataFromReader(http.StatusOK, fileSize, mimeType, object, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`inline; filename="%s"`, filepath.Base(objectKey)),
+		"X-Content-SHA256":    fileHash,
+	})
+}
+
+// processImage resizes large images and compresses them as JPEG (same approach as KYC documents)
+func (s *Server) processImage(file io.Reader) ([]byte, error) {
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	if bounds.Max.X > 1024 || bounds.Max.Y > 1024 {
+		img = resize.Resize(1024, 0, img, resize.Lanczos3)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -3,17 +3,20 @@ package main
 
 import (
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 )
 
 type Dispute struct {
 	ID              string     `json:"id"`
 	TransactionID   string     `json:"transaction_id"`
+	OrderID         *string    `json:"order_id,omitempty"` // set on disputes opened for a P2P order
 	InitiatorID     string     `json:"initiator_id"`
 	RespondentID    string     `json:"respondent_id"`
 	Type            string     `json:"dispute_type"`
@@ -24,7 +27,7 @@ type Dispute struct {
 	MediatorID      *string    `json:"mediator_id"`
 	Resolution      *string    `json:"resolution_notes"`
 	ResolutionType  *string    `json:"resolution_type"`
-	ResolutionAmount *float64  `json:"resolution_amount"`
+	ResolutionAmount *decimal.Decimal `json:"resolution_amount"`
 	CreatedAt       time.Time  `json:"created_at"`
 	ResolvedAt      *time.Time `json:"resolved_at"`
 }
@@ -50,8 +53,10 @@ type DisputeMessage struct {
 func (s *Server) handleCreateDispute(c *gin.Context) {
 	userID := c.GetString("user_id")
 	
+	// Disputes are opened either on a wallet transaction or on a P2P order
 	var req struct {
-		TransactionID string `json:"transaction_id" binding:"required"`
+		TransactionID string `json:"transaction_id"`
+		OrderID       string `json:"order_id"`
 		Type          string `json:"dispute_type" binding:"required"`
 		Title         string `json:"title" binding:"required"`
 		Description   string `json:"description" binding:"required"`
@@ -62,6 +67,11 @@ func (s *Server) handleCreateDispute(c *gin.Context) {
 		return
 	}
 	
+	if (req.TransactionID == "") == (req.OrderID == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either transaction_id or order_id"})
+		return
+	}
+	
 	// Validate dispute type
 	validTypes := []string{"PAYMENT_NOT_RECEIVED", "PAYMENT_NOT_SENT", "WRONG_AMOUNT", "FRAUD", "OTHER"}
 	if !contains(validTypes, req.Type) {
@@ -69,14 +79,48 @@ func (s *Server) handleCreateDispute(c *gin.Context) {
 		return
 	}
 	
-	// Get transaction details
+	if req.OrderID != "" {
+		disputeID, respondentID, err := s.openUserOrderDispute(req.OrderID, userID, req.Type, req.Title, req.Description)
+		switch err {
+		case nil:
+		case errOrderNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		case errNotOrderParty:
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not part of this order"})
+			return
+		case errOrderNotDisputable:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Order cannot be disputed in its current status"})
+			return
+		case errOrderDisputeExists:
+			c.JSON(http.StatusConflict, gin.H{"error": "Dispute already exists for this order"})
+			return
+		default:
+			requestLog(c).Printf("Error opening dispute for order %s: %v", req.OrderID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create dispute"})
+			return
+		}
+		
+		go s.notifyDisputeCreated(c.GetString("request_id"), respondentID, disputeID)
+		
+		c.JSON(http.StatusCreated, gin.H{
+			"dispute_id": disputeID,
+			"order_id":   req.OrderID,
+			"status":     "OPEN",
+			"message":    "Dispute created successfully",
+		})
+		return
+	}
+	
+	// Get transaction details, with the order it belongs to if any
 	var transactionUserFrom, transactionUserTo string
 	var transactionStatus string
+	var linkedOrderID sql.NullString
 	err := s.db.QueryRow(`
-		SELECT from_user_id, to_user_id, status
+		SELECT from_user_id, to_user_id, status, COALESCE(funding_order_id, order_id)::text
 		FROM transactions
 		WHERE id = $1
-	`, req.TransactionID).Scan(&transactionUserFrom, &transactionUserTo, &transactionStatus)
+	`, req.TransactionID).Scan(&transactionUserFrom, &transactionUserTo, &transactionStatus, &linkedOrderID)
 	
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
@@ -107,30 +151,19 @@ func (s *Server) handleCreateDispute(c *gin.Context) {
 		respondentID = transactionUserTo
 	}
 	
-	// Create dispute
-	disputeID := uuid.New().String()
-	_, err = s.db.Exec(`
-		INSERT INTO disputes (
-			id, transaction_id, initiator_id, respondent_id,
-			dispute_type, status, title, description, created_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-	`, disputeID, req.TransactionID, userID, respondentID,
-	   req.Type, "OPEN", req.Title, req.Description, time.Now())
-	
+	disputeID, err := s.openTransactionDispute(req.TransactionID, linkedOrderID, userID, respondentID, req.Type, req.Title, req.Description)
+	if err == errOrderDisputeExists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Dispute already exists for the order of this transaction"})
+		return
+	}
 	if err != nil {
+		requestLog(c).Printf("Error opening dispute for transaction %s: %v", req.TransactionID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create dispute"})
 		return
 	}
 	
-	// Update transaction status to disputed
-	_, err = s.db.Exec(`
-		UPDATE transactions
-		SET status = 'DISPUTED'
-		WHERE id = $1
-	`, req.TransactionID)
-	
 	// Notify respondent
-	go s.notifyDisputeCreated(respondentID, disputeID)
+	go s.notifyDisputeCreated(c.GetString("request_id"), respondentID, disputeID)
 	
 	c.JSON(http.StatusCreated, gin.H{
 		"dispute_id": disputeID,
@@ -143,14 +176,14 @@ func (s *Server) handleGetMyDisputes(c *gin.Context) {
 	userID := c.GetString("user_id")
 	
 	rows, err := s.db.Query(`
-		SELECT id, transaction_id, dispute_type, status, title, description, created_at
+		SELECT id, COALESCE(transaction_id::text, ''), order_id, dispute_type, status, title, description, created_at
 		FROM disputes
 		WHERE initiator_id = $1 OR respondent_id = $1
 		ORDER BY created_at DESC
 	`, userID)
 	
 	if err != nil {
-		log.Printf("Error fetching disputes for user %s: %v", userID, err)
+		requestLog(c).Printf("Error fetching disputes for user %s: %v", userID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch disputes"})
 		return
 	}
@@ -160,7 +193,7 @@ func (s *Server) handleGetMyDisputes(c *gin.Context) {
 	for rows.Next() {
 		var d Dispute
 		err := rows.Scan(
-			&d.ID, &d.TransactionID, &d.Type,
+			&d.ID, &d.TransactionID, &d.OrderID, &d.Type,
 			&d.Status, &d.Title, &d.Description, &d.CreatedAt,
 		)
 		if err != nil {
@@ -178,13 +211,13 @@ func (s *Server) handleGetDispute(c *gin.Context) {
 	
 	var dispute Dispute
 	err := s.db.QueryRow(`
-		SELECT id, transaction_id, initiator_id, respondent_id,
+		SELECT id, COALESCE(transaction_id::text, ''), order_id, initiator_id, respondent_id,
 		       dispute_type, status, title, description, mediator_id,
 		       resolution_notes, resolution_type, resolution_amount, created_at, resolved_at
 		FROM disputes
 		WHERE id = $1
 	`, disputeID).Scan(
-		&dispute.ID, &dispute.TransactionID, &dispute.InitiatorID,
+		&dispute.ID, &dispute.TransactionID, &dispute.OrderID, &dispute.InitiatorID,
 		&dispute.RespondentID, &dispute.Type, &dispute.Status,
 		&dispute.Title, &dispute.Description, &dispute.MediatorID,
 		&dispute.Resolution, &dispute.ResolutionType, &dispute.ResolutionAmount,
@@ -337,7 +370,7 @@ func (s *Server) handleSendMessage(c *gin.Context) {
 
 func (s *Server) handleGetPendingDisputes(c *gin.Context) {
 	rows, err := s.db.Query(`
-		SELECT d.id, d.transaction_id, d.initiator_id, d.respondent_id,
+		SELECT d.id, COALESCE(d.transaction_id::text, ''), d.order_id, d.initiator_id, d.respondent_id,
 		       d.dispute_type, d.status, d.title, d.created_at,
 		       u1.email as initiator_email, u2.email as respondent_email
 		FROM disputes d
@@ -356,15 +389,17 @@ func (s *Server) handleGetPendingDisputes(c *gin.Context) {
 	var disputes []map[string]interface{}
 	for rows.Next() {
 		var id, transactionID, initiatorID, respondentID, disputeType, status, title string
+		var orderID sql.NullString
 		var createdAt time.Time
 		var initiatorEmail, respondentEmail string
 		
-		if err := rows.Scan(&id, &transactionID, &initiatorID, &respondentID,
+		if err := rows.Scan(&id, &transactionID, &orderID, &initiatorID, &respondentID,
 			&disputeType, &status, &title, &createdAt,
 			&initiatorEmail, &respondentEmail); err == nil {
 			disputes = append(disputes, map[string]interface{}{
 				"id":               id,
 				"transaction_id":   transactionID,
+				"order_id":         nullableString(orderID),
 				"initiator_id":     initiatorID,
 				"respondent_id":    respondentID,
 				"dispute_type":     disputeType,
@@ -417,6 +452,10 @@ func (s *Server) handleAssignMediator(c *gin.Context) {
 		return
 	}
 	
+	s.recordAuditLog(c, c.GetString("user_id"), "DISPUTE_ASSIGN_MEDIATOR", "dispute", disputeID, map[string]interface{}{
+		"mediator_id": req.MediatorID,
+	})
+	
 	c.JSON(http.StatusOK, gin.H{"message": "Mediator assigned successfully"})
 }
 
@@ -425,7 +464,7 @@ func (s *Server) handleResolveDispute(c *gin.Context) {
 	
 	var req struct {
 		ResolutionType   string  `json:"resolution_type" binding:"required"`
-		ResolutionAmount *float64 `json:"resolution_amount"`
+		ResolutionAmount *decimal.Decimal `json:"resolution_amount"`
 		ResolutionNotes  string   `json:"resolution_notes" binding:"required"`
 	}
 	
@@ -441,35 +480,48 @@ func (s *Server) handleResolveDispute(c *gin.Context) {
 		return
 	}
 	
-	// Resolve dispute
-	_, err := s.db.Exec(`
-		UPDATE disputes
-		SET status = 'RESOLVED', resolution_type = $1, resolution_amount = $2,
-		    resolution_notes = $3, resolved_at = $4
-		WHERE id = $5
-	`, req.ResolutionType, req.ResolutionAmount, req.ResolutionNotes, time.Now(), disputeID)
-	
+	// Move funds and resolve atomically
+	refund, err := s.resolveDisputeWithRefund(disputeID, req.ResolutionType, req.ResolutionAmount, req.ResolutionNotes)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dispute not found"})
+		return
+	}
+	if err == errDisputeAlreadyResolved {
+		c.JSON(http.StatusConflict, gin.H{"error": "Dispute already resolved"})
+		return
+	}
+	if err == errInsufficientRefundFunds {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, errInvalidRefund) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
+		requestLog(c).Printf("Error resolving dispute %s: %v", disputeID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve dispute"})
 		return
 	}
 	
-	// Update transaction status based on resolution
-	if req.ResolutionType == "REFUND_FULL" || req.ResolutionType == "REFUND_PARTIAL" {
-		s.db.Exec(`
-			UPDATE transactions
-			SET status = 'REFUNDED'
-			WHERE id = (SELECT transaction_id FROM disputes WHERE id = $1)
-		`, disputeID)
-	} else {
-		s.db.Exec(`
-			UPDATE transactions
-			SET status = 'COMPLETED'
-			WHERE id = (SELECT transaction_id FROM disputes WHERE id = $1)
-		`, disputeID)
+	details := map[string]interface{}{
+		"resolution_type":  req.ResolutionType,
+		"resolution_notes": req.ResolutionNotes,
+	}
+	if req.ResolutionAmount != nil {
+		details["resolution_amount"] = *req.ResolutionAmount
+	}
+	if refund != nil {
+		details["refund"] = refund
+	}
+	s.recordAuditLog(c, c.GetString("user_id"), "DISPUTE_RESOLVE", "dispute", disputeID, details)
+	
+	response := gin.H{"message": "Dispute resolved successfully"}
+	if refund != nil {
+		response["refund"] = refund
 	}
 	
-	c.JSON(http.StatusOK, gin.H{"message": "Dispute resolved successfully"})
+	c.JSON(http.StatusOK, response)
 }
 
 func (s *Server) handleGetStats(c *gin.Context) {
@@ -520,9 +572,11 @@ func (s *Server) handleGetStats(c *gin.Context) {
 }
 
 // Helper functions
-func (s *Server) notifyDisputeCreated(userID, disputeID string) {
-	log.Printf("Notifying user %s of new dispute %s", userID, disputeID)
-	// Send email/SMS/push notification
+func (s *Server) notifyDisputeCreated(requestID, userID, disputeID string) {
+	taggedLog(requestID).Printf("Notifying user %s of new dispute %s", userID, disputeID)
+	s.events.Publish("dispute.created", userID,
+		fmt.Sprintf("A dispute involving you was opened (%s)", disputeID[:8]),
+		map[string]interface{}{"dispute_id": disputeID})
 }
 
 func contains(slice []string, item string) bool {
@@ -9,13 +9,19 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
 	_ "github.com/lib/pq"
+
+	"shared/dbpool"
 )
 
 type Server struct {
-	db     *sql.DB
-	redis  *redis.Client
-	router *gin.Engine
+	db          *sql.DB
+	redis       *redis.Client
+	router      *gin.Engine
+	minioClient *minio.Client
+	events      *EventPublisher
 }
 
 func main() {
@@ -34,17 +40,36 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 	defer db.Close()
+	dbpool.Configure(db)
 
 	// Redis connection
 	redisClient := redis.NewClient(&redis.Options{
 		Addr: fmt.Sprintf("%s:%s", os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PORT")),
 	})
 
+	// MinIO client for evidence files
+	minioClient, err := minio.New("minio:9000", &minio.Options{
+		Creds:  credentials.NewStaticV4("minioadmin", "minioadmin", ""),
+		Secure: false,
+	})
+	if err != nil {
+		log.Printf("Warning: MinIO connection failed: %v", err)
+	}
+
 	server := &Server{
-		db:     db,
-		redis:  redisClient,
-		router: gin.Default(),
+		db:          db,
+		redis:       redisClient,
+		router:      gin.Default(),
+		minioClient: minioClient,
+		events:      NewEventPublisher(),
 	}
+	server.ensureEvidenceBucket()
+
+	// Escalate disputes that stay OPEN past the SLA
+	go server.processOverdueDisputes()
+
+	// Open disputes for orders stuck waiting for the cashier's confirmation
+	go server.processStalledOrders()
 
 	server.setupRoutes()
 
@@ -60,9 +85,15 @@ func main() {
 }
 
 func (s *Server) setupRoutes() {
-	s.router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "healthy", "service": "dispute"})
-	})
+	setupMetrics(s.router, "dispute",
+		countGauge(s.db, "disputes_open", "Disputes not resolved yet (OPEN or IN_PROGRESS).",
+			`SELECT COUNT(*) FROM disputes WHERE status IN ('OPEN', 'IN_PROGRESS')`),
+		countGauge(s.db, "disputes_needing_escalation", "Open disputes past their SLA.",
+			`SELECT COUNT(*) FROM disputes WHERE status = 'OPEN' AND COALESCE(needs_escalation, false)`),
+	)
+	s.router.Use(requestIDMiddleware())
+
+	setupHealthRoutes(s.router, "dispute", databaseCheck(s.db), redisCheck(s.redis), s.events.healthCheck())
 
 	api := s.router.Group("/api/v1")
 	{
@@ -71,10 +102,13 @@ func (s *Server) setupRoutes() {
 		api.GET("/disputes", s.authMiddleware(), s.handleGetMyDisputes)
 		api.GET("/disputes/:id", s.authMiddleware(), s.handleGetDispute)
 		api.POST("/disputes/:id/evidence", s.authMiddleware(), s.handleSubmitEvidence)
+		api.POST("/disputes/:id/evidence/upload", s.authMiddleware(), s.handleUploadEvidence)
+		api.GET("/disputes/:id/evidence/:evidenceId/file", s.authMiddleware(), s.handleGetEvidenceFile)
 		api.POST("/disputes/:id/messages", s.authMiddleware(), s.handleSendMessage)
 		
 		// Admin routes
 		api.GET("/disputes/pending", s.adminMiddleware(), s.handleGetPendingDisputes)
+		api.GET("/disputes/overdue", s.adminMiddleware(), s.handleGetOverdueDisputes)
 		api.POST("/disputes/:id/assign", s.adminMiddleware(), s.handleAssignMediator)
 		api.POST("/disputes/:id/resolve", s.adminMiddleware(), s.handleResolveDispute)
 		api.GET("/disputes/stats", s.adminMiddleware(), s.handleGetStats)
@@ -10,6 +10,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+
+	"shared/revocation"
 )
 
 func (s *Server) authMiddleware() gin.HandlerFunc {
@@ -71,6 +73,11 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 				return
 			}
 			
+			if revocation.IsUserRevoked(c.Request.Context(), s.redis, userID) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is closed"})
+				c.Abort()
+				return
+			}
 			c.Set("user_id", userID)
 			c.Next()
 		} else {
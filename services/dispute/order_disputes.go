@@ -0,0 +1,167 @@
+// services/dispute/order_disputes.go
+package main
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// P2P trades live in orders, not transactions, so users open disputes on them by order_id. The
+// initiator must be the order's user or its cashier and the other one is the respondent. An
+// order still in progress (MATCHED, PROCESSING or AWAITING_RECEIPT) moves to DISPUTED, which
+// freezes payment confirmation, receipt confirmation and cancellation until the dispute is
+// resolved; resolution hands it back to the status it was disputed from. Completed orders can
+// still be disputed but keep their status, their funds having already moved.
+
+var (
+	errOrderNotFound      = errors.New("order not found")
+	errNotOrderParty      = errors.New("not part of this order")
+	errOrderNotDisputable = errors.New("order cannot be disputed in its current status")
+	errOrderDisputeExists = errors.New("dispute already exists for this order")
+)
+
+// Order statuses that move to DISPUTED when a dispute is opened
+var freezableOrderStatuses = map[string]bool{"MATCHED": true, "PROCESSING": true, "AWAITING_RECEIPT": true}
+
+// openUserOrderDispute opens a dispute on the order for one of its parties and returns the
+// dispute and the respondent
+func (s *Server) openUserOrderDispute(orderID, userID, disputeType, title, description string) (string, string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", "", err
+	}
+	defer tx.Rollback()
+
+	var ownerID, status string
+	var cashierID sql.NullString
+	err = tx.QueryRow(`
+		SELECT user_id, cashier_id, status FROM orders WHERE id = $1 FOR UPDATE
+	`, orderID).Scan(&ownerID, &cashierID, &status)
+	if err == sql.ErrNoRows {
+		return "", "", errOrderNotFound
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	// Without a cashier there is no counterparty to dispute with
+	if !cashierID.Valid || (userID != ownerID && userID != cashierID.String) {
+		return "", "", errNotOrderParty
+	}
+	if !freezableOrderStatuses[status] && status != "COMPLETED" {
+		return "", "", errOrderNotDisputable
+	}
+
+	var existingID string
+	err = tx.QueryRow(`
+		SELECT id FROM disputes WHERE order_id = $1 AND status NOT IN ('RESOLVED', 'CLOSED')
+	`, orderID).Scan(&existingID)
+	if err == nil {
+		return "", "", errOrderDisputeExists
+	}
+	if err != sql.ErrNoRows {
+		return "", "", err
+	}
+
+	respondentID := cashierID.String
+	if userID == cashierID.String {
+		respondentID = ownerID
+	}
+
+	disputeID := uuid.New().String()
+	_, err = tx.Exec(`
+		INSERT INTO disputes (
+			id, order_id, initiator_id, respondent_id,
+			dispute_type, status, title, description, created_at
+		) VALUES ($1, $2, $3, $4, $5, 'OPEN', $6, $7, NOW())
+	`, disputeID, orderID, userID, respondentID, disputeType, title, description)
+	if err != nil {
+		return "", "", err
+	}
+
+	if freezableOrderStatuses[status] {
+		if err = freezeDisputedOrder(tx, orderID, status); err != nil {
+			return "", "", err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", "", err
+	}
+	return disputeID, respondentID, nil
+}
+
+// freezeDisputedOrder moves an order from status to DISPUTED, remembering where it came from
+func freezeDisputedOrder(tx *sql.Tx, orderID, status string) error {
+	_, err := tx.Exec(`
+		UPDATE orders SET status = 'DISPUTED', disputed_from_status = $2, updated_at = NOW()
+		WHERE id = $1
+	`, orderID, status)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE p2p_orders SET status = 'DISPUTED', updated_at = NOW() WHERE id = $1`, orderID)
+	return err
+}
+
+// openTransactionDispute opens a dispute on a transaction and flags it DISPUTED. When the
+// transaction belongs to an order still in progress the dispute is linked to the order and the
+// order is frozen the same way as a dispute opened on the order.
+func (s *Server) openTransactionDispute(transactionID string, orderID sql.NullString, initiatorID, respondentID, disputeType, title, description string) (string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var orderStatus string
+	if orderID.Valid {
+		err = tx.QueryRow(`SELECT status FROM orders WHERE id = $1 FOR UPDATE`, orderID.String).Scan(&orderStatus)
+		if err == sql.ErrNoRows {
+			orderID.Valid = false
+		} else if err != nil {
+			return "", err
+		}
+	}
+	if orderID.Valid {
+		var existingID string
+		err = tx.QueryRow(`
+			SELECT id FROM disputes WHERE order_id = $1 AND status NOT IN ('RESOLVED', 'CLOSED')
+		`, orderID.String).Scan(&existingID)
+		if err == nil {
+			return "", errOrderDisputeExists
+		}
+		if err != sql.ErrNoRows {
+			return "", err
+		}
+	}
+
+	disputeID := uuid.New().String()
+	_, err = tx.Exec(`
+		INSERT INTO disputes (
+			id, transaction_id, order_id, initiator_id, respondent_id,
+			dispute_type, status, title, description, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, 'OPEN', $7, $8, NOW())
+	`, disputeID, transactionID, nullableString(orderID), initiatorID, respondentID, disputeType, title, description)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = tx.Exec(`UPDATE transactions SET status = 'DISPUTED' WHERE id = $1`, transactionID); err != nil {
+		return "", err
+	}
+
+	if orderID.Valid && freezableOrderStatuses[orderStatus] {
+		if err = freezeDisputedOrder(tx, orderID.String, orderStatus); err != nil {
+			return "", err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", err
+	}
+	return disputeID, nil
+}
@@ -0,0 +1,307 @@
+// services/dispute/order_timeouts.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Orders whose payment was marked as sent (PROCESSING) but never confirmed by the cashier are
+// moved to DISPUTED and get a PAYMENT_NOT_RECEIVED dispute with a mediator assigned, instead of
+// stalling. Orders held in escrow (AWAITING_RECEIPT) whose user did not confirm receipt before
+// the receipt deadline set by the p2p service are disputed the same way, with the cashier as
+// initiator. DISPUTED orders cannot be confirmed or cancelled until the mediator resolves them.
+
+const (
+	defaultProcessingTimeoutMinutes = 120
+	orderTimeoutCheckInterval       = time.Minute
+	orderTimeoutLockKey             = "dispute:order_timeout_worker:lock"
+)
+
+// orderProcessingTimeout returns how long an order may stay PROCESSING, configurable through
+// ORDER_PROCESSING_TIMEOUT_MINUTES; 0 disables automatic disputes
+func orderProcessingTimeout() time.Duration {
+	minutes := defaultProcessingTimeoutMinutes
+	if value := os.Getenv("ORDER_PROCESSING_TIMEOUT_MINUTES"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 {
+			minutes = parsed
+		} else {
+			log.Printf("⚠️ Invalid ORDER_PROCESSING_TIMEOUT_MINUTES %q, using %dm", value, defaultProcessingTimeoutMinutes)
+		}
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// processStalledOrders opens disputes for timed out orders on a ticker until the process exits
+func (s *Server) processStalledOrders() {
+	timeout := orderProcessingTimeout()
+	if timeout == 0 {
+		log.Printf("⚠️ ORDER_PROCESSING_TIMEOUT_MINUTES=0, stalled orders are not disputed automatically")
+	}
+
+	ticker := time.NewTicker(orderTimeoutCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.runOrderTimeoutCheck(timeout)
+	}
+}
+
+// runOrderTimeoutCheck takes the Redis lock so only one replica disputes orders per tick
+func (s *Server) runOrderTimeoutCheck(timeout time.Duration) {
+	if s.redis == nil {
+		return
+	}
+
+	ctx := context.Background()
+	token := uuid.New().String()
+
+	acquired, err := s.redis.SetNX(ctx, orderTimeoutLockKey, token, orderTimeoutCheckInterval).Result()
+	if err != nil {
+		log.Printf("Error acquiring order timeout lock: %v", err)
+		return
+	}
+	if !acquired {
+		return
+	}
+	defer s.redis.Eval(ctx, releaseLockScript, []string{orderTimeoutLockKey}, token)
+
+	if timeout > 0 {
+		s.disputeStalledOrders(timeout)
+	}
+	s.disputeUnconfirmedReceipts()
+}
+
+// disputeStalledOrders opens a dispute for every order PROCESSING for longer than timeout
+func (s *Server) disputeStalledOrders(timeout time.Duration) {
+	cutoff := time.Now().Add(-timeout)
+
+	rows, err := s.db.Query(`
+		SELECT id
+		FROM orders
+		WHERE status = 'PROCESSING'
+		  AND cashier_id IS NOT NULL
+		  AND COALESCE(marked_paid_at, updated_at) < $1
+		  AND COALESCE(is_sandbox, false) = false
+		ORDER BY COALESCE(marked_paid_at, updated_at) ASC
+		LIMIT 50
+	`, cutoff)
+	if err != nil {
+		log.Printf("Error querying stalled orders: %v", err)
+		return
+	}
+
+	var orderIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			orderIDs = append(orderIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, orderID := range orderIDs {
+		disputeID, err := s.openOrderTimeoutDispute(orderID, timeout)
+		if err == sql.ErrNoRows {
+			// Confirmed or disputed since the scan
+			continue
+		}
+		if err != nil {
+			log.Printf("Error opening dispute for stalled order %s: %v", orderID, err)
+			continue
+		}
+		log.Printf("⏰ Order %s stalled in PROCESSING for over %s, dispute %s opened", orderID, timeout, disputeID)
+	}
+}
+
+// disputeUnconfirmedReceipts opens a dispute for every escrowed order past its receipt deadline
+func (s *Server) disputeUnconfirmedReceipts() {
+	rows, err := s.db.Query(`
+		SELECT id
+		FROM orders
+		WHERE status = 'AWAITING_RECEIPT'
+		  AND receipt_deadline < NOW()
+		  AND COALESCE(is_sandbox, false) = false
+		ORDER BY receipt_deadline ASC
+		LIMIT 50
+	`)
+	if err != nil {
+		log.Printf("Error querying unconfirmed receipts: %v", err)
+		return
+	}
+
+	var orderIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			orderIDs = append(orderIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, orderID := range orderIDs {
+		disputeID, err := s.openStalledOrderDispute(orderID, stalledOrderDispute{
+			Status:           "AWAITING_RECEIPT",
+			DisputeType:      "OTHER",
+			CashierInitiates: true,
+			Title: func(orderID string) string {
+				return fmt.Sprintf("Receipt not confirmed for order %s", orderID[:8])
+			},
+			Description: func(orderType, amount, currency string) string {
+				return fmt.Sprintf("The cashier confirmed the %s order for %s %s but the user did not confirm receipt before the deadline. The funds stay in escrow until the dispute is resolved. Opened automatically.",
+					orderType, amount, currency)
+			},
+		})
+		if err == sql.ErrNoRows {
+			// Confirmed or disputed since the scan
+			continue
+		}
+		if err != nil {
+			log.Printf("Error opening dispute for unconfirmed receipt %s: %v", orderID, err)
+			continue
+		}
+		log.Printf("⏰ Order %s awaited receipt past its deadline, dispute %s opened", orderID, disputeID)
+	}
+}
+
+// stalledOrderDispute describes the dispute opened for an order stuck in Status
+type stalledOrderDispute struct {
+	Status      string
+	DisputeType string
+	// CashierInitiates makes the cashier the initiator and the user the respondent
+	CashierInitiates bool
+	Title            func(orderID string) string
+	Description      func(orderType, amount, currency string) string
+}
+
+// openOrderTimeoutDispute moves a stalled order to DISPUTED and opens its dispute, with the
+// user as initiator and the cashier as respondent, handing it to the least loaded mediator
+func (s *Server) openOrderTimeoutDispute(orderID string, timeout time.Duration) (string, error) {
+	return s.openStalledOrderDispute(orderID, stalledOrderDispute{
+		Status:      "PROCESSING",
+		DisputeType: "PAYMENT_NOT_RECEIVED",
+		Title: func(orderID string) string {
+			return fmt.Sprintf("Payment not confirmed for order %s", orderID[:8])
+		},
+		Description: func(orderType, amount, currency string) string {
+			return fmt.Sprintf("The %s order for %s %s was marked as paid but the cashier did not confirm it within %s. Opened automatically.",
+				orderType, amount, currency, timeout)
+		},
+	})
+}
+
+// openStalledOrderDispute moves an order from kind.Status to DISPUTED and opens its dispute,
+// handing it to the least loaded mediator
+func (s *Server) openStalledOrderDispute(orderID string, kind stalledOrderDispute) (string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	// The status guard keeps a confirmation racing with the worker from being disputed
+	var userID, cashierID, orderType, currency, amount string
+	err = tx.QueryRow(`
+		UPDATE orders SET status = 'DISPUTED', disputed_from_status = status, updated_at = NOW()
+		WHERE id = $1 AND status = $2 AND cashier_id IS NOT NULL
+		RETURNING user_id, cashier_id, order_type, currency_from, amount::text
+	`, orderID, kind.Status).Scan(&userID, &cashierID, &orderType, &currency, &amount)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(`UPDATE p2p_orders SET status = 'DISPUTED', updated_at = NOW() WHERE id = $1`, orderID)
+	if err != nil {
+		return "", err
+	}
+
+	var mediatorID sql.NullString
+	mediator, err := s.findLeastLoadedMediator(userID, cashierID)
+	if err == nil {
+		mediatorID = sql.NullString{String: mediator, Valid: true}
+	} else if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	// Without a mediator the dispute stays OPEN and the SLA worker assigns one later
+	status := "OPEN"
+	if mediatorID.Valid {
+		status = "IN_PROGRESS"
+	}
+
+	initiatorID, respondentID := userID, cashierID
+	if kind.CashierInitiates {
+		initiatorID, respondentID = cashierID, userID
+	}
+
+	disputeID := uuid.New().String()
+	_, err = tx.Exec(`
+		INSERT INTO disputes (
+			id, order_id, initiator_id, respondent_id, mediator_id,
+			dispute_type, status, title, description, auto_created, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, TRUE, NOW())
+	`, disputeID, orderID, initiatorID, respondentID, mediatorID, kind.DisputeType, status,
+		kind.Title(orderID), kind.Description(orderType, amount, currency))
+	if err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", err
+	}
+
+	go s.notifyDisputeCreated("", userID, disputeID)
+	go s.notifyDisputeCreated("", cashierID, disputeID)
+	if mediatorID.Valid {
+		go s.notifyDisputeCreated("", mediatorID.String, disputeID)
+	}
+
+	return disputeID, nil
+}
+
+// reopenDisputedOrder hands a DISPUTED order back to the step it was disputed from once its
+// dispute is resolved: the user's payment for orders disputed before it, the cashier
+// confirmation, or the user's receipt confirmation for orders whose funds are escrowed. The
+// timeout starts over from the resolution.
+func reopenDisputedOrder(tx *sql.Tx, orderID string) error {
+	var status string
+	err := tx.QueryRow(`
+		UPDATE orders SET
+			status = CASE WHEN escrowed_at IS NOT NULL THEN 'AWAITING_RECEIPT'
+				WHEN disputed_from_status = 'MATCHED' THEN 'MATCHED' ELSE 'PROCESSING' END,
+			accepted_at = CASE WHEN escrowed_at IS NULL AND disputed_from_status = 'MATCHED' THEN NOW() ELSE accepted_at END,
+			marked_paid_at = CASE WHEN escrowed_at IS NOT NULL OR disputed_from_status = 'MATCHED' THEN marked_paid_at ELSE NOW() END,
+			receipt_deadline = CASE WHEN escrowed_at IS NOT NULL THEN NOW() + (receipt_deadline - escrowed_at) END,
+			escrowed_at = CASE WHEN escrowed_at IS NOT NULL THEN NOW() END,
+			disputed_from_status = NULL,
+			updated_at = NOW()
+		WHERE id = $1 AND status = 'DISPUTED'
+		RETURNING status
+	`, orderID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE p2p_orders SET status = $2, updated_at = NOW()
+		WHERE id = $1 AND status = 'DISPUTED'
+	`, orderID, status)
+	return err
+}
+
+func nullableString(value sql.NullString) interface{} {
+	if value.Valid {
+		return value.String
+	}
+	return nil
+}
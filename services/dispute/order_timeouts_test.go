@@ -0,0 +1,77 @@
+// services/dispute/order_timeouts_test.go
+package main
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// cutoffArg matches a cutoff the given duration before now
+type cutoffArg time.Duration
+
+func (a cutoffArg) Match(v driver.Value) bool {
+	cutoff, ok := v.(time.Time)
+	return ok && time.Since(cutoff.Add(time.Duration(a))) < time.Minute
+}
+
+func TestStalledProcessingOrderOpensADispute(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const stalled, confirmed = "5a1d0e2f-0000-4000-8000-000000000001", "c0ff1e2d-0000-4000-8000-000000000002"
+
+	// Both orders were marked paid over two hours ago; the second is confirmed before the worker gets to it
+	mock.ExpectQuery(`FROM orders\s+WHERE status = 'PROCESSING'\s+AND cashier_id IS NOT NULL`).
+		WithArgs(cutoffArg(2 * time.Hour)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(stalled).AddRow(confirmed))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE orders SET status = 'DISPUTED', disputed_from_status = status`).WithArgs(stalled, "PROCESSING").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "cashier_id", "order_type", "currency_from", "amount"}).
+			AddRow("user-1", "cashier-1", "BUY", "BOB", "690"))
+	mock.ExpectExec(`UPDATE p2p_orders SET status = 'DISPUTED'`).WithArgs(stalled).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`WHERE COALESCE\(u.is_mediator, false\) = true`).WithArgs("user-1", "cashier-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("mediator-1"))
+	mock.ExpectExec(`INSERT INTO disputes`).
+		WithArgs(sqlmock.AnyArg(), stalled, "user-1", "cashier-1", "mediator-1", "PAYMENT_NOT_RECEIVED", "IN_PROGRESS",
+			"Payment not confirmed for order 5a1d0e2f", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// The status guard finds the confirmed order no longer PROCESSING and leaves it alone
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE orders SET status = 'DISPUTED'`).WithArgs(confirmed, "PROCESSING").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "cashier_id", "order_type", "currency_from", "amount"}))
+	mock.ExpectRollback()
+
+	// Notifications go to an unreachable broker and are dropped
+	s := &Server{db: db, events: &EventPublisher{url: "amqp://127.0.0.1:1"}}
+	s.disputeStalledOrders(2 * time.Hour)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOrderProcessingTimeoutIsConfigurable(t *testing.T) {
+	tests := map[string]time.Duration{
+		"":    defaultProcessingTimeoutMinutes * time.Minute,
+		"45":  45 * time.Minute,
+		"0":   0,
+		"-5":  defaultProcessingTimeoutMinutes * time.Minute,
+		"abc": defaultProcessingTimeoutMinutes * time.Minute,
+	}
+	for value, want := range tests {
+		t.Setenv("ORDER_PROCESSING_TIMEOUT_MINUTES", value)
+		if got := orderProcessingTimeout(); got != want {
+			t.Errorf("ORDER_PROCESSING_TIMEOUT_MINUTES=%q gives %s, want %s", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// services/dispute/refunds.go
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Refunds are executed directly against the shared wallets/transactions tables inside the
+// same DB transaction that resolves the dispute, the same way the p2p engine settles orders.
+// This keeps the money movement and the RESOLVED status atomic without a cross-service call.
+
+var errDisputeAlreadyResolved = errors.New("dispute already resolved")
+var errInsufficientRefundFunds = errors.New("counterparty has insufficient balance for refund")
+var errInvalidRefund = errors.New("invalid refund")
+
+type RefundResult struct {
+	TransactionID string `json:"refund_transaction_id"`
+	BeneficiaryID string `json:"beneficiary_id"`
+	PayerID       string `json:"payer_id"`
+	Amount        string `json:"amount"`
+	Currency      string `json:"currency"`
+}
+
+// resolveDisputeWithRefund moves the refunded funds (if any), records a REFUND transaction and
+// marks the dispute RESOLVED, all in one DB transaction. Re-resolving returns errDisputeAlreadyResolved.
+func (s *Server) resolveDisputeWithRefund(disputeID, resolutionType string, resolutionAmount *decimal.Decimal, notes string) (*RefundResult, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the dispute row so concurrent resolutions serialize
+	var status string
+	var transactionID, orderID sql.NullString
+	err = tx.QueryRow(`
+		SELECT status, transaction_id, order_id FROM disputes WHERE id = $1 FOR UPDATE
+	`, disputeID).Scan(&status, &transactionID, &orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if status == "RESOLVED" || status == "CLOSED" {
+		return nil, errDisputeAlreadyResolved
+	}
+
+	// A refund already recorded for this dispute means it was executed before
+	var existingRefund string
+	err = tx.QueryRow(`
+		SELECT id FROM transactions WHERE transaction_type = 'REFUND' AND external_ref = $1
+	`, disputeID).Scan(&existingRefund)
+	if err == nil {
+		return nil, errDisputeAlreadyResolved
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	// Disputes opened for a stalled order have no transaction to refund yet; the mediator
+	// settles them by handing the order back to the cashier confirmation step
+	if !transactionID.Valid && (resolutionType == "REFUND_FULL" || resolutionType == "REFUND_PARTIAL") {
+		return nil, fmt.Errorf("%w: order disputes have no transaction to refund", errInvalidRefund)
+	}
+
+	var result *RefundResult
+	if resolutionType != "NO_REFUND" && transactionID.Valid {
+		result, err = s.executeRefund(tx, disputeID, transactionID.String, resolutionType, resolutionAmount)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Only mark the dispute resolved once the money moved
+	_, err = tx.Exec(`
+		UPDATE disputes
+		SET status = 'RESOLVED', resolution_type = $1, resolution_amount = $2,
+		    resolution_notes = $3, resolved_at = $4, updated_at = NOW()
+		WHERE id = $5
+	`, resolutionType, resolutionAmount, notes, time.Now(), disputeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if transactionID.Valid {
+		transactionStatus := "COMPLETED"
+		if result != nil {
+			transactionStatus = "REFUNDED"
+		}
+		_, err = tx.Exec(`
+			UPDATE transactions SET status = $1, updated_at = NOW() WHERE id = $2
+		`, transactionStatus, transactionID.String)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if orderID.Valid {
+		if err = reopenDisputedOrder(tx, orderID.String); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// executeRefund returns funds from the payee to the payer of the disputed transaction
+func (s *Server) executeRefund(tx *sql.Tx, disputeID, transactionID, resolutionType string, resolutionAmount *decimal.Decimal) (*RefundResult, error) {
+	var payerID, payeeID sql.NullString
+	var amount decimal.Decimal
+	var currency string
+	err := tx.QueryRow(`
+		SELECT from_user_id, to_user_id, amount, currency
+		FROM transactions WHERE id = $1 FOR UPDATE
+	`, transactionID).Scan(&payerID, &payeeID, &amount, &currency)
+	if err != nil {
+		return nil, fmt.Errorf("disputed transaction not found: %v", err)
+	}
+
+	if !payerID.Valid || !payeeID.Valid {
+		return nil, fmt.Errorf("%w: disputed transaction has no counterparty to refund from", errInvalidRefund)
+	}
+
+	refundAmount := amount
+	if resolutionType != "REFUND_FULL" {
+		if resolutionAmount == nil || !resolutionAmount.IsPositive() {
+			return nil, fmt.Errorf("%w: resolution_amount is required for %s", errInvalidRefund, resolutionType)
+		}
+		if resolutionAmount.GreaterThan(amount) {
+			return nil, fmt.Errorf("%w: resolution_amount exceeds the disputed amount (%s %s)", errInvalidRefund, amount, currency)
+		}
+		refundAmount = *resolutionAmount
+	}
+
+	// Take the funds back from the payee
+	result, err := tx.Exec(`
+		UPDATE wallets SET balance = balance - $1::numeric, updated_at = NOW()
+		WHERE user_id = $2 AND currency = $3 AND balance >= $1::numeric
+	`, refundAmount, payeeID.String, currency)
+	if err != nil {
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, errInsufficientRefundFunds
+	}
+
+	// Credit the payer
+	_, err = tx.Exec(`
+		INSERT INTO wallets (user_id, currency, balance, locked_balance, created_at, updated_at)
+		VALUES ($1, $2, $3::numeric, 0, NOW(), NOW())
+		ON CONFLICT (user_id, currency)
+		DO UPDATE SET balance = wallets.balance + $3::numeric, updated_at = NOW()
+	`, payerID.String, currency, refundAmount)
+	if err != nil {
+		return nil, err
+	}
+
+	refundID := uuid.New().String()
+	_, err = tx.Exec(`
+		INSERT INTO transactions (id, user_id, from_user_id, to_user_id, type, transaction_type, currency, amount,
+			status, method, payment_method, external_ref, payment_reference, notes, created_at, completed_at, updated_at)
+		VALUES ($1, $2, $3, $2, 'REFUND', 'REFUND', $4, $5::numeric, 'COMPLETED', 'DISPUTE', 'DISPUTE', $6, $7, $8, NOW(), NOW(), NOW())
+	`, refundID, payerID.String, payeeID.String, currency, refundAmount, disputeID, transactionID,
+		fmt.Sprintf("%s refund for dispute %s", resolutionType, disputeID))
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("💸 Dispute %s refunded: %s %s from %s to %s", disputeID, refundAmount, currency, payeeID.String, payerID.String)
+
+	return &RefundResult{
+		TransactionID: refundID,
+		BeneficiaryID: payerID.String,
+		PayerID:       payeeID.String,
+		Amount:        refundAmount.String(),
+		Currency:      currency,
+	}, nil
+}
@@ -0,0 +1,49 @@
+// services/dispute/request_id.go
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Every request carries an X-Request-Id, generated by the gateway or here when the service is
+// called directly. It is echoed in the response and, through requestLog/taggedLog, prefixed to
+// log lines so one flow can be followed across services.
+
+const requestIDHeader = "X-Request-Id"
+
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if requestID == "" || len(requestID) > 128 {
+			requestID = newRequestID()
+			c.Request.Header.Set(requestIDHeader, requestID)
+		}
+
+		c.Set("request_id", requestID)
+		c.Header(requestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestLog returns a logger tagged with the ID of the current request
+func requestLog(c *gin.Context) *log.Logger {
+	return taggedLog(c.GetString("request_id"))
+}
+
+// taggedLog is for work that outlives the request, e.g. goroutines started by a handler
+func taggedLog(requestID string) *log.Logger {
+	if requestID == "" {
+		return log.Default()
+	}
+	return log.New(log.Writer(), "[req "+requestID+"] ", log.Flags())
+}
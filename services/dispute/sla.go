@@ -0,0 +1,248 @@
+// services/dispute/sla.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultDisputeSLAHours = 48
+	slaCheckInterval       = 5 * time.Minute
+	slaLockKey             = "dispute:sla_worker:lock"
+)
+
+// releaseLockScript deletes the lock only if this replica still owns it
+const releaseLockScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`
+
+// disputeSLA returns how long a dispute may stay OPEN before it is escalated,
+// configurable through DISPUTE_SLA_HOURS
+func disputeSLA() time.Duration {
+	hours := defaultDisputeSLAHours
+	if value := os.Getenv("DISPUTE_SLA_HOURS"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			hours = parsed
+		} else {
+			log.Printf("⚠️ Invalid DISPUTE_SLA_HOURS %q, using %dh", value, defaultDisputeSLAHours)
+		}
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// processOverdueDisputes runs the SLA check on a ticker until the process exits
+func (s *Server) processOverdueDisputes() {
+	ticker := time.NewTicker(slaCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.runSLACheck()
+	}
+}
+
+// runSLACheck takes the Redis lock so only one replica escalates disputes per tick
+func (s *Server) runSLACheck() {
+	if s.redis == nil {
+		return
+	}
+
+	ctx := context.Background()
+	token := uuid.New().String()
+
+	acquired, err := s.redis.SetNX(ctx, slaLockKey, token, slaCheckInterval).Result()
+	if err != nil {
+		log.Printf("Error acquiring dispute SLA lock: %v", err)
+		return
+	}
+	if !acquired {
+		return
+	}
+	defer s.redis.Eval(ctx, releaseLockScript, []string{slaLockKey}, token)
+
+	s.checkOverdueDisputes(disputeSLA())
+}
+
+// checkOverdueDisputes flags disputes that have been OPEN longer than the SLA
+// and hands them to the least loaded mediator
+func (s *Server) checkOverdueDisputes(sla time.Duration) {
+	cutoff := time.Now().Add(-sla)
+
+	rows, err := s.db.Query(`
+		UPDATE disputes
+		SET needs_escalation = TRUE,
+		    priority = COALESCE(priority, 0) + 1,
+		    escalated_at = NOW(),
+		    updated_at = NOW()
+		WHERE status = 'OPEN'
+		  AND created_at < $1
+		  AND COALESCE(needs_escalation, FALSE) = FALSE
+		RETURNING id
+	`, cutoff)
+	if err != nil {
+		log.Printf("Error flagging overdue disputes: %v", err)
+		return
+	}
+
+	var escalated []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			escalated = append(escalated, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range escalated {
+		log.Printf("⏰ Dispute %s exceeded SLA of %s, flagged for escalation", id, sla)
+	}
+
+	// Overdue disputes still waiting for a mediator, oldest first
+	rows, err = s.db.Query(`
+		SELECT id, initiator_id, respondent_id
+		FROM disputes
+		WHERE status = 'OPEN'
+		  AND mediator_id IS NULL
+		  AND needs_escalation = TRUE
+		ORDER BY priority DESC, created_at ASC
+		LIMIT 50
+	`)
+	if err != nil {
+		log.Printf("Error querying unassigned overdue disputes: %v", err)
+		return
+	}
+
+	type pendingDispute struct {
+		id, initiatorID, respondentID string
+	}
+	var pending []pendingDispute
+	for rows.Next() {
+		var d pendingDispute
+		if err := rows.Scan(&d.id, &d.initiatorID, &d.respondentID); err == nil {
+			pending = append(pending, d)
+		}
+	}
+	rows.Close()
+
+	for _, d := range pending {
+		mediatorID, err := s.findLeastLoadedMediator(d.initiatorID, d.respondentID)
+		if err == sql.ErrNoRows {
+			log.Printf("⚠️ No mediator available for overdue dispute %s", d.id)
+			return
+		}
+		if err != nil {
+			log.Printf("Error finding mediator for dispute %s: %v", d.id, err)
+			continue
+		}
+
+		result, err := s.db.Exec(`
+			UPDATE disputes
+			SET mediator_id = $1, status = 'IN_PROGRESS', updated_at = NOW()
+			WHERE id = $2 AND status = 'OPEN' AND mediator_id IS NULL
+		`, mediatorID, d.id)
+		if err != nil {
+			log.Printf("Error auto-assigning mediator to dispute %s: %v", d.id, err)
+			continue
+		}
+
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			log.Printf("👨‍⚖️ Dispute %s auto-assigned to mediator %s", d.id, mediatorID)
+		}
+	}
+}
+
+// findLeastLoadedMediator picks the mediator with the fewest disputes in progress,
+// skipping the parties of the dispute itself
+func (s *Server) findLeastLoadedMediator(initiatorID, respondentID string) (string, error) {
+	var mediatorID string
+	err := s.db.QueryRow(`
+		SELECT u.id
+		FROM users u
+		LEFT JOIN disputes d ON d.mediator_id = u.id AND d.status = 'IN_PROGRESS'
+		WHERE COALESCE(u.is_mediator, false) = true
+		  AND u.id NOT IN ($1, $2)
+		GROUP BY u.id
+		ORDER BY COUNT(d.id) ASC, u.id ASC
+		LIMIT 1
+	`, initiatorID, respondentID).Scan(&mediatorID)
+
+	return mediatorID, err
+}
+
+func (s *Server) handleGetOverdueDisputes(c *gin.Context) {
+	sla := disputeSLA()
+	cutoff := time.Now().Add(-sla)
+
+	rows, err := s.db.Query(`
+		SELECT d.id, COALESCE(d.transaction_id::text, ''), d.order_id, d.initiator_id, d.respondent_id, d.mediator_id,
+		       d.dispute_type, d.status, d.title, COALESCE(d.priority, 0),
+		       COALESCE(d.needs_escalation, false), d.escalated_at, d.created_at
+		FROM disputes d
+		WHERE d.status IN ('OPEN', 'IN_PROGRESS')
+		  AND (d.needs_escalation = TRUE OR (d.status = 'OPEN' AND d.created_at < $1))
+		ORDER BY d.priority DESC, d.created_at ASC
+	`, cutoff)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch overdue disputes"})
+		return
+	}
+	defer rows.Close()
+
+	disputes := []map[string]interface{}{}
+	for rows.Next() {
+		var id, transactionID, initiatorID, respondentID, disputeType, status, title string
+		var orderID, mediatorID sql.NullString
+		var priority int
+		var needsEscalation bool
+		var escalatedAt sql.NullTime
+		var createdAt time.Time
+
+		if err := rows.Scan(&id, &transactionID, &orderID, &initiatorID, &respondentID, &mediatorID,
+			&disputeType, &status, &title, &priority,
+			&needsEscalation, &escalatedAt, &createdAt); err != nil {
+			continue
+		}
+
+		dispute := map[string]interface{}{
+			"id":               id,
+			"transaction_id":   transactionID,
+			"order_id":         nullableString(orderID),
+			"initiator_id":     initiatorID,
+			"respondent_id":    respondentID,
+			"mediator_id":      nil,
+			"dispute_type":     disputeType,
+			"status":           status,
+			"title":            title,
+			"priority":         priority,
+			"needs_escalation": needsEscalation,
+			"escalated_at":     nil,
+			"created_at":       createdAt,
+			"open_hours":       int(time.Since(createdAt).Hours()),
+		}
+		if mediatorID.Valid {
+			dispute["mediator_id"] = mediatorID.String
+		}
+		if escalatedAt.Valid {
+			dispute["escalated_at"] = escalatedAt.Time
+		}
+		disputes = append(disputes, dispute)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"disputes":  disputes,
+		"sla_hours": int(sla.Hours()),
+		"total":     len(disputes),
+	})
+}
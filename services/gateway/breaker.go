@@ -0,0 +1,147 @@
+// services/gateway/breaker.go
+package main
+
+import (
+    "log"
+    "os"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// Per-service circuit breaker. Every proxied call is recorded as a success or a failure
+// (5xx, upstream unreachable, or slower than the slow-call limit). When the failures among the
+// last calls reach the threshold the breaker opens and requests are rejected right away. After
+// the open duration a single probe is let through (half-open): success closes the breaker,
+// failure opens it again.
+
+const (
+    breakerClosed   = "closed"
+    breakerOpen     = "open"
+    breakerHalfOpen = "half_open"
+)
+
+type breakerConfig struct {
+    failureThreshold int
+    window           int
+    openDuration     time.Duration
+    slowCall         time.Duration
+}
+
+func loadBreakerConfig() breakerConfig {
+    return breakerConfig{
+        failureThreshold: envInt("GATEWAY_BREAKER_FAILURE_THRESHOLD", 5),
+        window:           envInt("GATEWAY_BREAKER_WINDOW", 20),
+        openDuration:     time.Duration(envInt("GATEWAY_BREAKER_OPEN_SECONDS", 30)) * time.Second,
+        slowCall:         time.Duration(envInt("GATEWAY_BREAKER_SLOW_CALL_MS", 5000)) * time.Millisecond,
+    }
+}
+
+func envInt(name string, fallback int) int {
+    if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+        return value
+    }
+    return fallback
+}
+
+type circuitBreaker struct {
+    service string
+    config  breakerConfig
+
+    mu       sync.Mutex
+    state    string
+    results  []bool // recent outcomes, true = failure
+    openedAt time.Time
+    probing  bool
+}
+
+func newCircuitBreaker(service string, config breakerConfig) *circuitBreaker {
+    return &circuitBreaker{service: service, config: config, state: breakerClosed}
+}
+
+// allow reports whether a request may be sent to the service now
+func (b *circuitBreaker) allow() bool {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    switch b.state {
+    case breakerOpen:
+        if time.Since(b.openedAt) < b.config.openDuration {
+            return false
+        }
+        b.state = breakerHalfOpen
+        log.Printf("🟡 GATEWAY: Circuit for %s half-open, probing", b.service)
+        fallthrough
+    case breakerHalfOpen:
+        if b.probing {
+            return false
+        }
+        b.probing = true
+        return true
+    default:
+        return true
+    }
+}
+
+// record stores the outcome of a call that allow let through
+func (b *circuitBreaker) record(status int, elapsed time.Duration) {
+    failed := status >= 500 || elapsed > b.config.slowCall
+
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    if b.state == breakerHalfOpen {
+        b.probing = false
+        if failed {
+            b.trip()
+            return
+        }
+        b.state = breakerClosed
+        b.results = nil
+        log.Printf("🟢 GATEWAY: Circuit for %s closed", b.service)
+        return
+    }
+
+    b.results = append(b.results, failed)
+    if len(b.results) > b.config.window {
+        b.results = b.results[len(b.results)-b.config.window:]
+    }
+
+    failures := 0
+    for _, result := range b.results {
+        if result {
+            failures++
+        }
+    }
+    if failures >= b.config.failureThreshold {
+        b.trip()
+    }
+}
+
+func (b *circuitBreaker) trip() {
+    b.state = breakerOpen
+    b.openedAt = time.Now()
+    b.results = nil
+    log.Printf("🔴 GATEWAY: Circuit for %s open for %s", b.service, b.config.openDuration)
+}
+
+// retryAfter is how long until an open breaker lets a probe through
+func (b *circuitBreaker) retryAfter() time.Duration {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    if b.state != breakerOpen {
+        return 0
+    }
+    return b.config.openDuration - time.Since(b.openedAt)
+}
+
+func (b *circuitBreaker) currentState() string {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    if b.state == breakerOpen && time.Since(b.openedAt) >= b.config.openDuration {
+        return breakerHalfOpen
+    }
+    return b.state
+}
@@ -0,0 +1,141 @@
+// services/gateway/health.go
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "io"
+    "net/http"
+    "os"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// Aggregate health at GET /health/all: the gateway calls /health on every service it proxies to,
+// concurrently and within GATEWAY_HEALTH_TIMEOUT (default 3s, above the services' own dependency
+// timeout), and reports each one's status, latency, dependency checks and circuit state. The
+// report is cached for GATEWAY_HEALTH_CACHE_TTL (default 5s) and concurrent callers share a
+// single round of checks, so dashboards polling it do not multiply the load on the services.
+// The response is 503 when any service is unhealthy or unreachable.
+
+type serviceHealth struct {
+    Status     string          `json:"status"`
+    HTTPStatus int             `json:"http_status,omitempty"`
+    LatencyMS  int64           `json:"latency_ms"`
+    Circuit    string          `json:"circuit"`
+    Checks     json.RawMessage `json:"checks,omitempty"`
+    Error      string          `json:"error,omitempty"`
+}
+
+type healthReport struct {
+    Status    string                   `json:"status"`
+    CheckedAt time.Time                `json:"checked_at"`
+    Services  map[string]serviceHealth `json:"services"`
+}
+
+type healthAggregator struct {
+    client   *http.Client
+    timeout  time.Duration
+    cacheTTL time.Duration
+
+    mu     sync.Mutex
+    report *healthReport
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+    if value, err := time.ParseDuration(os.Getenv(name)); err == nil && value > 0 {
+        return value
+    }
+    return fallback
+}
+
+func newHealthAggregator() *healthAggregator {
+    // Not the retrying upstream transport: a 503 from a service is the answer, not a blip
+    return &healthAggregator{
+        client:   &http.Client{},
+        timeout:  envDuration("GATEWAY_HEALTH_TIMEOUT", 3*time.Second),
+        cacheTTL: envDuration("GATEWAY_HEALTH_CACHE_TTL", 5*time.Second),
+    }
+}
+
+// handleHealthAll serves the cached report, refreshing it once it is older than the cache TTL.
+// Callers arriving during a refresh wait for it instead of starting their own.
+func (g *Gateway) handleHealthAll(c *gin.Context) {
+    h := g.health
+    h.mu.Lock()
+    if h.report == nil || time.Since(h.report.CheckedAt) >= h.cacheTTL {
+        h.report = g.checkServices()
+    }
+    report := h.report
+    h.mu.Unlock()
+
+    code := http.StatusOK
+    if report.Status != "healthy" {
+        code = http.StatusServiceUnavailable
+    }
+    c.JSON(code, report)
+}
+
+// checkServices is not tied to the caller's request, since its report is shared with others
+func (g *Gateway) checkServices() *healthReport {
+    ctx, cancel := context.WithTimeout(context.Background(), g.health.timeout)
+    defer cancel()
+
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+    services := make(map[string]serviceHealth, len(g.services))
+    for name, target := range g.services {
+        wg.Add(1)
+        go func(name, target string) {
+            defer wg.Done()
+            result := g.health.checkService(ctx, target+"/health")
+            result.Circuit = g.breakers[name].currentState()
+            mu.Lock()
+            services[name] = result
+            mu.Unlock()
+        }(name, target.String())
+    }
+    wg.Wait()
+
+    status := "healthy"
+    for _, result := range services {
+        if result.Status != "healthy" {
+            status = "degraded"
+        }
+    }
+    return &healthReport{Status: status, CheckedAt: time.Now(), Services: services}
+}
+
+func (h *healthAggregator) checkService(ctx context.Context, healthURL string) serviceHealth {
+    started := time.Now()
+    result := serviceHealth{Status: "unreachable"}
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL, nil)
+    if err != nil {
+        result.Error = err.Error()
+        return result
+    }
+    resp, err := h.client.Do(req)
+    result.LatencyMS = time.Since(started).Milliseconds()
+    if err != nil {
+        result.Error = err.Error()
+        return result
+    }
+    defer resp.Body.Close()
+
+    result.HTTPStatus = resp.StatusCode
+    result.Status = "unhealthy"
+    if resp.StatusCode == http.StatusOK {
+        result.Status = "healthy"
+    }
+
+    var body struct {
+        Checks json.RawMessage `json:"checks"`
+    }
+    if data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); err == nil && json.Unmarshal(data, &body) == nil {
+        result.Checks = body.Checks
+    }
+    return result
+}
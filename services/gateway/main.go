@@ -2,25 +2,38 @@
 package main
 
 import (
+    "context"
+    "errors"
+    "fmt"
     "log"
     "net/http"
     "net/http/httputil"
     "net/url"
     "os"
+    "strconv"
     "strings"
+    "time"
 
     "github.com/gin-gonic/gin"
 )
 
 type Gateway struct {
-    router   *gin.Engine
-    services map[string]*url.URL
+    router    *gin.Engine
+    services  map[string]*url.URL
+    breakers  map[string]*circuitBreaker
+    transport http.RoundTripper
+    timeout   time.Duration
+    health    *healthAggregator
 }
 
 func main() {
     gateway := &Gateway{
-        router:   gin.Default(),
-        services: make(map[string]*url.URL),
+        router:    gin.Default(),
+        services:  make(map[string]*url.URL),
+        breakers:  make(map[string]*circuitBreaker),
+        transport: newUpstreamTransport(),
+        timeout:   upstreamTimeout(),
+        health:    newHealthAggregator(),
     }
 
     // Configure service URLs
@@ -90,14 +103,23 @@ func (g *Gateway) configureServices() {
         analyticsURL, _ = url.Parse("http://analytics-service:3008")
     }
     g.services["analytics"] = analyticsURL
+
+    breakerConfig := loadBreakerConfig()
+    for name := range g.services {
+        g.breakers[name] = newCircuitBreaker(name, breakerConfig)
+    }
 }
 
 func (g *Gateway) setupRoutes() {
+    setupMetrics(g.router, "gateway", proxyDuration)
+    g.router.Use(requestIDMiddleware())
+
     // CORS middleware
     g.router.Use(func(c *gin.Context) {
         c.Header("Access-Control-Allow-Origin", "*")
         c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-        c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-Requested-With")
+        c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-Requested-With, X-API-Key, X-Request-Id")
+        c.Header("Access-Control-Expose-Headers", "X-Request-Id")
         
         if c.Request.Method == "OPTIONS" {
             c.AbortWithStatus(204)
@@ -109,13 +131,25 @@ func (g *Gateway) setupRoutes() {
 
     // Health check
     g.router.GET("/health", func(c *gin.Context) {
+        status := "healthy"
+        circuits := make(map[string]string)
+        for name, breaker := range g.breakers {
+            circuits[name] = breaker.currentState()
+            if circuits[name] != breakerClosed {
+                status = "degraded"
+            }
+        }
+
         c.JSON(200, gin.H{
-            "status":  "healthy",
-            "service": "gateway",
+            "status":   status,
+            "service":  "gateway",
+            "circuits": circuits,
         })
     })
 
-    // Serve static files (QR images and uploads)
+    g.router.GET("/health/all", g.handleHealthAll)
+
+    // Serve static files (QR images uploaded before they moved to object storage)
     g.router.Static("/uploads", "/tmp/uploads")
     g.router.Static("/images", "/tmp/images")
 
@@ -128,59 +162,138 @@ func (g *Gateway) setupRoutes() {
         api.POST("/refresh", g.proxyToService("auth"))
         api.POST("/logout", g.proxyToService("auth"))
         api.POST("/verify-email", g.proxyToService("auth"))
+        api.POST("/resend-verification", g.proxyToService("auth"))
+        api.POST("/forgot-password", g.proxyToService("auth"))
+        api.POST("/reset-password", g.proxyToService("auth"))
         api.GET("/me", g.proxyToService("auth"))
         api.PUT("/profile", g.proxyToService("auth"))
+        api.POST("/api-keys", g.proxyToService("auth"))
+        api.GET("/api-keys", g.proxyToService("auth"))
+        api.DELETE("/api-keys/:id", g.proxyToService("auth"))
+        api.GET("/transaction-pin", g.proxyToService("auth"))
+        api.PUT("/transaction-pin", g.proxyToService("auth"))
+        api.POST("/admin/users/:id/unlock", g.proxyToService("auth"))
+        api.GET("/admin/accounts/closed", g.proxyToService("auth"))
+        api.POST("/account/close", g.proxyToService("auth"))
+        api.GET("/admin/users/:id/compliance-file", g.proxyToService("kyc"))
 
         // P2P routes
         api.GET("/rates", g.proxyToService("p2p"))
+        api.GET("/limits", g.proxyToService("p2p"))
         api.GET("/orders", g.proxyToService("p2p"))
         api.POST("/orders", g.proxyToService("p2p"))
+        api.POST("/orders/batch", g.proxyToService("p2p"))
         api.GET("/orders/:id", g.proxyToService("p2p"))
         api.PUT("/orders/:id", g.proxyToService("p2p"))
         api.DELETE("/orders/:id", g.proxyToService("p2p"))
         api.POST("/orders/:id/mark-paid", g.proxyToService("p2p"))
+        api.POST("/orders/:id/confirm-receipt", g.proxyToService("p2p"))
         api.GET("/orderbook", g.proxyToService("p2p"))
+        api.GET("/market/depth", g.proxyToService("p2p"))
+        api.GET("/market/suggest-rate", g.proxyToService("p2p"))
+        api.GET("/market/trades", g.proxyToService("p2p"))
+        api.GET("/market/ticker", g.proxyToService("p2p"))
         api.POST("/trade", g.proxyToService("p2p"))
+        api.GET("/trade/quote", g.proxyToService("p2p"))
         api.GET("/users/:id/stats", g.proxyToService("p2p"))
         
         // User-specific P2P routes
         log.Printf("📋 GATEWAY: Registering user-specific routes")
         api.GET("/user/orders", g.proxyToService("p2p"))
         api.GET("/user/stats", g.proxyToService("p2p"))
+        api.GET("/notifications", g.proxyToService("p2p"))
+        api.POST("/notifications/read", g.proxyToService("p2p"))
         log.Printf("📋 GATEWAY: User-specific routes registered")
 
         // Cashier P2P routes
         log.Printf("🏦 GATEWAY: Registering cashier routes")
+        api.GET("/cashier/stream", g.proxyToService("p2p"))
         api.GET("/cashier/pending-orders", g.proxyToService("p2p"))
+        api.POST("/cashier/availability", g.proxyToService("p2p"))
+        api.POST("/cashier/heartbeat", g.proxyToService("p2p"))
         api.POST("/cashier/orders/:id/accept", g.proxyToService("p2p"))
         api.POST("/cashier/orders/:id/confirm-payment", g.proxyToService("p2p"))
         api.GET("/cashier/my-orders", g.proxyToService("p2p"))
         api.GET("/cashier/metrics", g.proxyToService("p2p"))
+        api.GET("/cashier/performance", g.proxyToService("p2p"))
+        api.GET("/cashier/suspension", g.proxyToService("p2p"))
+        api.GET("/cashier/order-limits", g.proxyToService("p2p"))
+        api.PUT("/cashier/order-limits", g.proxyToService("p2p"))
+        api.DELETE("/cashier/order-limits/:currency", g.proxyToService("p2p"))
+        api.GET("/cashier/shift-holds", g.proxyToService("p2p"))
+        api.POST("/cashier/shift-holds", g.proxyToService("p2p"))
+        api.POST("/cashier/shift-holds/:id/release", g.proxyToService("p2p"))
         log.Printf("🏦 GATEWAY: Cashier routes registered")
 
+        // Admin P2P routes
+        api.GET("/admin/orders/:id/full", g.proxyToService("p2p"))
+        api.POST("/admin/reconciliation/run", g.proxyToService("p2p"))
+        api.GET("/admin/cashiers/:id/performance", g.proxyToService("p2p"))
+        api.GET("/admin/cashiers/suspensions", g.proxyToService("p2p"))
+        api.POST("/admin/cashiers/suspensions/run", g.proxyToService("p2p"))
+        api.POST("/admin/cashiers/:id/unsuspend", g.proxyToService("p2p"))
+        api.GET("/admin/audit-log", g.proxyToService("p2p"))
+
         // Wallet routes
         api.GET("/wallets", g.proxyToService("wallet"))
         api.GET("/wallets/:currency", g.proxyToService("wallet"))
         api.POST("/deposit", g.proxyToService("wallet"))
+        api.POST("/deposits/:id/amend", g.proxyToService("wallet"))
         api.GET("/deposit-instructions/:currency", g.proxyToService("wallet"))
         api.GET("/deposit-qr/:currency", g.proxyToService("wallet"))
+        api.GET("/deposit-qr/:currency/image", g.proxyToService("wallet"))
+        api.GET("/attestations/reserves", g.proxyToService("wallet"))
+        api.GET("/attestations/public-key", g.proxyToService("wallet"))
         api.POST("/withdraw", g.proxyToService("wallet"))
         api.POST("/transfer", g.proxyToService("wallet"))
+        api.POST("/confirmations/requirements", g.proxyToService("wallet"))
+        api.POST("/confirmations/otp", g.proxyToService("wallet"))
         api.POST("/convert", g.proxyToService("wallet"))
+        api.GET("/auto-convert", g.proxyToService("wallet"))
+        api.PUT("/auto-convert", g.proxyToService("wallet"))
         api.GET("/transactions", g.proxyToService("wallet"))
+        api.GET("/transactions/export", g.proxyToService("wallet"))
         api.GET("/transactions/:id", g.proxyToService("wallet"))
+        api.POST("/transactions/:id/tags", g.proxyToService("wallet"))
+        api.DELETE("/transactions/:id/tags/:tag", g.proxyToService("wallet"))
         api.POST("/webhooks/paypal", g.proxyToService("wallet"))
         api.POST("/webhooks/stripe", g.proxyToService("wallet"))
         api.POST("/webhooks/bank", g.proxyToService("wallet"))
+        api.POST("/webhooks/withdrawals/:processor", g.proxyToService("wallet"))
+
+        // Sandbox routes (only served when SANDBOX_MODE=true in the services)
+        api.POST("/sandbox/trades", g.proxyToService("p2p"))
+        api.POST("/sandbox/bank-notifications", g.proxyToService("wallet"))
         
         // Admin routes
         api.GET("/admin/deposit-qr", g.proxyToService("wallet"))
         api.POST("/admin/deposit-qr", g.proxyToService("wallet"))
         api.DELETE("/admin/deposit-qr/:id", g.proxyToService("wallet"))
+        api.GET("/admin/deposit-accounts", g.proxyToService("wallet"))
+        api.POST("/admin/deposit-accounts", g.proxyToService("wallet"))
+        api.POST("/admin/deposit-accounts/:id/toggle", g.proxyToService("wallet"))
+        api.DELETE("/admin/deposit-accounts/:id", g.proxyToService("wallet"))
+        api.GET("/admin/alerts", g.proxyToService("wallet"))
+        api.POST("/admin/alerts/:id/acknowledge", g.proxyToService("wallet"))
+        api.POST("/admin/alerts/:id/resolve", g.proxyToService("wallet"))
+        api.GET("/admin/negative-balances", g.proxyToService("wallet"))
+        api.POST("/admin/withdrawals/:id/complete", g.proxyToService("wallet"))
+        api.POST("/admin/withdrawals/:id/fail", g.proxyToService("wallet"))
+        api.GET("/admin/withdrawals/pending", g.proxyToService("wallet"))
+        api.POST("/admin/withdrawals/:id/approve", g.proxyToService("wallet"))
+        api.POST("/admin/withdrawals/:id/reject", g.proxyToService("wallet"))
+        api.GET("/admin/exposure", g.proxyToService("wallet"))
+        api.POST("/admin/exposure/overrides", g.proxyToService("wallet"))
+        api.DELETE("/admin/exposure/overrides/:id", g.proxyToService("wallet"))
+        api.POST("/admin/attestations/reserves", g.proxyToService("wallet"))
+        api.GET("/admin/dead-letter", g.proxyToService("wallet"))
+        api.POST("/admin/dead-letter/:id/replay", g.proxyToService("wallet"))
+        api.POST("/admin/dead-letter/:id/discard", g.proxyToService("wallet"))
 
         // KYC routes
         api.GET("/kyc/status", g.proxyToService("kyc"))
         api.POST("/kyc/submit", g.proxyToService("kyc"))
+        api.POST("/kyc/validate", g.proxyToService("kyc"))
         api.POST("/kyc/upload-document", g.proxyToService("kyc"))
         api.POST("/kyc/verify-selfie", g.proxyToService("kyc"))
         api.GET("/kyc/levels", g.proxyToService("kyc"))
@@ -189,15 +302,19 @@ func (g *Gateway) setupRoutes() {
         api.GET("/kyc/pending", g.proxyToService("kyc"))
         api.POST("/kyc/approve/:id", g.proxyToService("kyc"))
         api.POST("/kyc/reject/:id", g.proxyToService("kyc"))
+        api.POST("/kyc/users/:id/allow-resubmission", g.proxyToService("kyc"))
 
         // Dispute routes
         api.POST("/disputes", g.proxyToService("dispute"))
         api.GET("/disputes", g.proxyToService("dispute"))
         api.GET("/disputes/:id", g.proxyToService("dispute"))
         api.POST("/disputes/:id/evidence", g.proxyToService("dispute"))
+        api.POST("/disputes/:id/evidence/upload", g.proxyToService("dispute"))
+        api.GET("/disputes/:id/evidence/:evidenceId/file", g.proxyToService("dispute"))
         api.POST("/disputes/:id/messages", g.proxyToService("dispute"))
         // Admin dispute routes
         api.GET("/disputes/pending", g.proxyToService("dispute"))
+        api.GET("/disputes/overdue", g.proxyToService("dispute"))
         api.POST("/disputes/:id/assign", g.proxyToService("dispute"))
         api.POST("/disputes/:id/resolve", g.proxyToService("dispute"))
         api.GET("/disputes/stats", g.proxyToService("dispute"))
@@ -208,37 +325,72 @@ func (g *Gateway) setupRoutes() {
         api.GET("/rooms", g.proxyToService("chat"))
         api.GET("/rooms/:id/messages", g.proxyToService("chat"))
         api.POST("/rooms/:id/messages", g.proxyToService("chat"))
+        api.PUT("/rooms/:id/messages/:messageId", g.proxyToService("chat"))
+        api.DELETE("/rooms/:id/messages/:messageId", g.proxyToService("chat"))
         api.POST("/rooms/:id/join", g.proxyToService("chat"))
+        api.POST("/rooms/:id/leave", g.proxyToService("chat"))
+        api.POST("/rooms/archive-abandoned", g.proxyToService("chat"))
+        api.PUT("/rooms/:id/legal-hold", g.proxyToService("chat"))
 
         // Analytics routes
         api.GET("/analytics/overview", g.proxyToService("analytics"))
         api.GET("/analytics/transactions", g.proxyToService("analytics"))
         api.GET("/analytics/users", g.proxyToService("analytics"))
         api.GET("/analytics/revenue", g.proxyToService("analytics"))
+        api.GET("/analytics/revenue/breakdown", g.proxyToService("analytics"))
         api.GET("/analytics/kyc", g.proxyToService("analytics"))
+        api.GET("/analytics/kyc/funnel", g.proxyToService("analytics"))
+        api.GET("/analytics/retention", g.proxyToService("analytics"))
+        api.GET("/analytics/funnel", g.proxyToService("analytics"))
+        api.GET("/analytics/live", g.proxyToService("analytics"))
         api.GET("/analytics/disputes", g.proxyToService("analytics"))
+        api.GET("/analytics/cashiers", g.proxyToService("analytics"))
         api.GET("/reports/daily", g.proxyToService("analytics"))
         api.GET("/reports/monthly", g.proxyToService("analytics"))
         api.GET("/reports/regulatory", g.proxyToService("analytics"))
+        api.GET("/reports/regulatory/export", g.proxyToService("analytics"))
+        api.GET("/analytics/suspicious-activity", g.proxyToService("analytics"))
+        api.GET("/reports/snapshots", g.proxyToService("analytics"))
+        api.POST("/reports/snapshots", g.proxyToService("analytics"))
     }
 }
 
 func (g *Gateway) proxyToService(serviceName string) gin.HandlerFunc {
     return func(c *gin.Context) {
-        log.Printf("🌐 GATEWAY: Incoming request - Method: %s, Path: %s, Service: %s", 
+        logger := requestLog(c)
+        logger.Printf("🌐 GATEWAY: Incoming request - Method: %s, Path: %s, Service: %s", 
             c.Request.Method, c.Request.URL.Path, serviceName)
         
         serviceURL, exists := g.services[serviceName]
         if !exists {
-            log.Printf("❌ GATEWAY: Service '%s' not found", serviceName)
+            logger.Printf("❌ GATEWAY: Service '%s' not found", serviceName)
             c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Service unavailable"})
             return
         }
 
-        log.Printf("🎯 GATEWAY: Routing to service URL: %s", serviceURL.String())
+        // Fail fast while the service is known to be failing
+        breaker := g.breakers[serviceName]
+        if !breaker.allow() {
+            logger.Printf("🚫 GATEWAY: Circuit open for %s, rejecting request", serviceName)
+            c.Header("Retry-After", fmt.Sprintf("%.0f", breaker.retryAfter().Seconds()+1))
+            c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Service temporarily unavailable"})
+            return
+        }
+
+        logger.Printf("🎯 GATEWAY: Routing to service URL: %s", serviceURL.String())
 
         // Create reverse proxy
         proxy := httputil.NewSingleHostReverseProxy(serviceURL)
+        proxy.Transport = g.transport
+        proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+            if errors.Is(err, context.DeadlineExceeded) || r.Context().Err() == context.DeadlineExceeded {
+                logger.Printf("⏱️ GATEWAY: %s service timed out after %s", serviceName, g.timeout)
+                c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Service timed out"})
+                return
+            }
+            logger.Printf("❌ GATEWAY: %s service error: %v", serviceName, err)
+            c.JSON(http.StatusBadGateway, gin.H{"error": "Service unavailable"})
+        }
         
         // Modify the request
         proxy.Director = func(req *http.Request) {
@@ -248,8 +400,8 @@ func (g *Gateway) proxyToService(serviceName string) gin.HandlerFunc {
             req.URL.Path = "/api/v1" + strings.TrimPrefix(c.Request.URL.Path, "/api/v1")
             req.Host = serviceURL.Host
             
-            log.Printf("🔀 GATEWAY: Path transformation - Original: %s, New: %s", originalPath, req.URL.Path)
-            log.Printf("🔀 GATEWAY: Full target URL: %s", req.URL.String())
+            logger.Printf("🔀 GATEWAY: Path transformation - Original: %s, New: %s", originalPath, req.URL.Path)
+            logger.Printf("🔀 GATEWAY: Full target URL: %s", req.URL.String())
             
             // Copy headers
             for key, values := range c.Request.Header {
@@ -258,12 +410,29 @@ func (g *Gateway) proxyToService(serviceName string) gin.HandlerFunc {
                 }
             }
             
-            log.Printf("🔀 GATEWAY: Headers copied, Authorization: %s", req.Header.Get("Authorization"))
+            req.Header.Set(requestIDHeader, c.GetString("request_id"))
+            
+            logger.Printf("🔀 GATEWAY: Headers copied, Authorization: %s", req.Header.Get("Authorization"))
+        }
+
+        // WebSocket sessions stay open as long as the client wants: no service timeout, and their
+        // duration says nothing about the service's health
+        if strings.EqualFold(c.Request.Header.Get("Upgrade"), "websocket") {
+            logger.Printf("📡 GATEWAY: Proxying WebSocket to %s service", serviceName)
+            proxy.ServeHTTP(c.Writer, c.Request)
+            return
         }
 
         // Handle the request
-        log.Printf("📡 GATEWAY: Proxying request to %s service", serviceName)
-        proxy.ServeHTTP(c.Writer, c.Request)
-        log.Printf("📡 GATEWAY: Request completed for %s", c.Request.URL.Path)
+        logger.Printf("📡 GATEWAY: Proxying request to %s service", serviceName)
+        ctx, cancel := context.WithTimeout(c.Request.Context(), g.timeout)
+        defer cancel()
+
+        start := time.Now()
+        proxy.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+        elapsed := time.Since(start)
+        breaker.record(c.Writer.Status(), elapsed)
+        proxyDuration.WithLabelValues(serviceName, strconv.Itoa(c.Writer.Status())).Observe(elapsed.Seconds())
+        logger.Printf("📡 GATEWAY: Request completed for %s", c.Request.URL.Path)
     }
 }
\ No newline at end of file
@@ -0,0 +1,80 @@
+// services/gateway/metrics.go
+package main
+
+import (
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// HTTP metrics shared by every service (this file is kept in sync across services). Paths are
+// labelled with the gin route template so cardinality stays bounded.
+
+type httpMetrics struct {
+    requests *prometheus.CounterVec
+    duration *prometheus.HistogramVec
+    inFlight prometheus.Gauge
+}
+
+func newHTTPMetrics(registerer prometheus.Registerer) *httpMetrics {
+    m := &httpMetrics{
+        requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Name: "http_requests_total",
+            Help: "HTTP requests handled, by method, route and status.",
+        }, []string{"method", "path", "status"}),
+        duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+            Name:    "http_request_duration_seconds",
+            Help:    "HTTP request latency, by method, route and status.",
+            Buckets: prometheus.DefBuckets,
+        }, []string{"method", "path", "status"}),
+        inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+            Name: "http_requests_in_flight",
+            Help: "HTTP requests currently being served.",
+        }),
+    }
+    registerer.MustRegister(m.requests, m.duration, m.inFlight)
+    return m
+}
+
+func (m *httpMetrics) middleware() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if c.Request.URL.Path == "/metrics" {
+            c.Next()
+            return
+        }
+
+        start := time.Now()
+        m.inFlight.Inc()
+        defer m.inFlight.Dec()
+
+        c.Next()
+
+        path := c.FullPath()
+        if path == "" {
+            path = "unmatched"
+        }
+        status := strconv.Itoa(c.Writer.Status())
+        m.requests.WithLabelValues(c.Request.Method, path, status).Inc()
+        m.duration.WithLabelValues(c.Request.Method, path, status).Observe(time.Since(start).Seconds())
+    }
+}
+
+// setupMetrics instruments the router and exposes /metrics. It must run before the routes are
+// registered so the middleware applies to them. Every metric carries a constant service label.
+func setupMetrics(router *gin.Engine, service string, collectors ...prometheus.Collector) {
+    registerer := prometheus.WrapRegistererWith(prometheus.Labels{"service": service}, prometheus.DefaultRegisterer)
+    registerer.MustRegister(collectors...)
+
+    router.Use(newHTTPMetrics(registerer).middleware())
+    router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+}
+
+// proxyDuration tracks the latency of each downstream service as seen by the gateway
+var proxyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+    Name:    "gateway_proxy_duration_seconds",
+    Help:    "Latency of proxied requests, by downstream service and status.",
+    Buckets: prometheus.DefBuckets,
+}, []string{"upstream", "status"})
@@ -0,0 +1,87 @@
+// services/gateway/transport.go
+package main
+
+import (
+    "errors"
+    "log"
+    "net"
+    "net/http"
+    "os"
+    "strconv"
+    "time"
+)
+
+// Upstream transport shared by every proxied request. Each request gets a deadline of
+// GATEWAY_UPSTREAM_TIMEOUT; GET requests that fail to connect or get a 502/503 back are retried
+// up to GATEWAY_UPSTREAM_RETRIES times with exponential backoff. Other methods are never retried.
+
+const retryBaseDelay = 100 * time.Millisecond
+
+func upstreamTimeout() time.Duration {
+    if value, err := time.ParseDuration(os.Getenv("GATEWAY_UPSTREAM_TIMEOUT")); err == nil && value > 0 {
+        return value
+    }
+    return 30 * time.Second
+}
+
+func newUpstreamTransport() http.RoundTripper {
+    transport := &http.Transport{
+        Proxy: http.ProxyFromEnvironment,
+        DialContext: (&net.Dialer{
+            Timeout:   5 * time.Second,
+            KeepAlive: 30 * time.Second,
+        }).DialContext,
+        MaxIdleConns:          100,
+        MaxIdleConnsPerHost:   20,
+        IdleConnTimeout:       90 * time.Second,
+        TLSHandshakeTimeout:   10 * time.Second,
+        ExpectContinueTimeout: 1 * time.Second,
+    }
+
+    retries := 2
+    if value, err := strconv.Atoi(os.Getenv("GATEWAY_UPSTREAM_RETRIES")); err == nil && value >= 0 {
+        retries = value
+    }
+
+    return &retryTransport{next: transport, retries: retries}
+}
+
+type retryTransport struct {
+    next    http.RoundTripper
+    retries int
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    resp, err := t.next.RoundTrip(req)
+    if req.Method != http.MethodGet || req.Body != nil && req.Body != http.NoBody {
+        return resp, err
+    }
+
+    for attempt := 1; attempt <= t.retries && retryable(resp, err); attempt++ {
+        if resp != nil {
+            resp.Body.Close()
+        }
+
+        delay := retryBaseDelay << (attempt - 1)
+        select {
+        case <-req.Context().Done():
+            return nil, req.Context().Err()
+        case <-time.After(delay):
+        }
+
+        log.Printf("🔁 GATEWAY: Retrying GET %s (attempt %d/%d)", req.URL.Path, attempt, t.retries)
+        resp, err = t.next.RoundTrip(req)
+    }
+
+    return resp, err
+}
+
+// retryable reports whether a GET failed in a way worth another attempt: a connection error
+// (not our own deadline) or the upstream saying it is temporarily unavailable
+func retryable(resp *http.Response, err error) bool {
+    if err != nil {
+        var netErr net.Error
+        return errors.As(err, &netErr) && !netErr.Timeout()
+    }
+    return resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable
+}
@@ -0,0 +1,360 @@
+// services/kyc/compliance.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Compliance case file: everything the platform knows about a user, compiled for regulator
+// requests (UIF/ASFI). Document links are presigned and expire after complianceLinkTTL.
+
+const complianceLinkTTL = 15 * time.Minute
+
+// complianceMiddleware lets admins and compliance officers through. It goes after authMiddleware in
+// the route rather than calling it, since authMiddleware's c.Next would run the handler before the
+// role is checked.
+func (s *Server) complianceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var role string
+		err := s.db.QueryRow(`SELECT COALESCE(role, '') FROM users WHERE id = $1`, c.GetString("user_id")).Scan(&role)
+		if err != nil || (role != "admin" && role != "compliance") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Compliance access required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func (s *Server) handleGetComplianceFile(c *gin.Context) {
+	userID := c.Param("id")
+	officerID := c.GetString("user_id")
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "pdf" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or pdf"})
+		return
+	}
+
+	file, err := s.buildComplianceFile(c.Request.Context(), userID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Printf("❌ COMPLIANCE: Failed to build case file for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build compliance file"})
+		return
+	}
+	file["generated_by"] = officerID
+
+	s.recordAuditLog(c, officerID, "COMPLIANCE_FILE_EXPORT", "user", userID, map[string]interface{}{"format": format})
+	requestLog(c).Printf("📁 COMPLIANCE: Case file for user %s exported by %s (%s)", userID, officerID, format)
+
+	if format == "json" {
+		c.JSON(http.StatusOK, file)
+		return
+	}
+
+	pdf, err := renderComplianceFilePDF(file)
+	if err != nil {
+		requestLog(c).Printf("❌ COMPLIANCE: Failed to render PDF for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render compliance file"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="compliance-%s.pdf"`, userID))
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// buildComplianceFile gathers identity, KYC, transactions, flags, disputes and security events
+func (s *Server) buildComplianceFile(ctx context.Context, userID string) (gin.H, error) {
+	identity, err := s.queryRows(`
+		SELECT u.id, u.email, u.phone, u.kyc_level, COALESCE(u.role, 'user') as role,
+			u.is_verified, u.is_active, u.is_cashier, u.created_at,
+			COALESCE(up.first_name, '') as first_name, COALESCE(up.last_name, '') as last_name,
+			COALESCE(up.ci_number, '') as ci_number, up.date_of_birth,
+			COALESCE(up.address, '') as address, COALESCE(up.city, '') as city
+		FROM users u
+		LEFT JOIN user_profiles up ON up.user_id = u.id
+		WHERE u.id = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(identity) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	file := gin.H{
+		"generated_at": time.Now(),
+		"user":         identity[0],
+	}
+
+	// KYC submissions and their documents, with time-limited download links
+	submissions, err := s.queryRows(`
+		SELECT id, kyc_level, status, submitted_at, reviewed_at, reviewed_by, rejection_reason,
+			COALESCE(face_match_score, 0) as face_match_score,
+			COALESCE(requires_manual_review, false) as requires_manual_review
+		FROM kyc_submissions
+		WHERE user_id = $1
+		ORDER BY submitted_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, submission := range submissions {
+		documents, err := s.queryRows(`
+			SELECT id, document_type, file_path, status, created_at
+			FROM kyc_documents
+			WHERE submission_id = $1
+			ORDER BY created_at ASC
+		`, submission["id"])
+		if err != nil {
+			return nil, err
+		}
+		for _, document := range documents {
+			document["url"] = s.presignDocument(ctx, fmt.Sprint(document["file_path"]))
+		}
+		submission["documents"] = documents
+	}
+	file["kyc"] = submissions
+
+	transactions, err := s.queryRows(`
+		SELECT id, transaction_type, amount, currency, fee, status,
+			COALESCE(payment_method, method) as method, external_ref, created_at, completed_at
+		FROM transactions
+		WHERE user_id = $1 OR from_user_id = $1 OR to_user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	file["transactions"] = transactions
+
+	orders, err := s.queryRows(`
+		SELECT id, order_type, currency_from, currency_to, amount, rate, status,
+			CASE WHEN user_id = $1 THEN 'TRADER' ELSE 'CASHIER' END as role, created_at
+		FROM orders
+		WHERE (user_id = $1 OR cashier_id = $1) AND COALESCE(is_sandbox, false) = false
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	file["orders"] = orders
+
+	// Flagged activity: alerts raised about the user and failed face matches
+	flags, err := s.queryRows(`
+		SELECT 'SYSTEM_ALERT' as kind, alert_type as type, severity, message, status, created_at
+		FROM system_alerts
+		WHERE details->>'user_id' = $1
+		UNION ALL
+		SELECT 'FACE_MATCH' as kind, provider as type, 'WARNING' as severity,
+			'Selfie did not match the identity document (score ' || score::text || ')' as message,
+			'OPEN' as status, created_at
+		FROM kyc_face_verifications
+		WHERE user_id::text = $1 AND passed = false
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	file["flags"] = flags
+
+	disputes, err := s.queryRows(`
+		SELECT id, transaction_id, status, dispute_type, title, resolution_type, resolution_amount,
+			CASE WHEN initiator_id = $1 THEN 'INITIATOR' ELSE 'RESPONDENT' END as role,
+			created_at, resolved_at
+		FROM disputes
+		WHERE initiator_id = $1 OR respondent_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	file["disputes"] = disputes
+
+	// Security events: audit trail entries by or about the user, plus current lockout state
+	events, err := s.queryRows(`
+		SELECT action, entity_type, entity_id, host(ip_address) as ip_address, user_agent, created_at
+		FROM audit_logs
+		WHERE user_id = $1 OR (entity_type = 'user' AND entity_id = $1)
+		ORDER BY created_at DESC
+		LIMIT 500
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	lockout, err := s.queryRows(`
+		SELECT failed_login_count, locked_until FROM users WHERE id = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	file["security"] = gin.H{
+		"events":  events,
+		"lockout": lockout[0],
+	}
+
+	return file, nil
+}
+
+func (s *Server) presignDocument(ctx context.Context, path string) string {
+	if s.minioClient == nil || path == "" {
+		return ""
+	}
+	link, err := s.minioClient.PresignedGetObject(ctx, "kyc-documents", path, complianceLinkTTL, nil)
+	if err != nil {
+		log.Printf("⚠️ COMPLIANCE: Failed to presign %s: %v", path, err)
+		return ""
+	}
+	return link.String()
+}
+
+// renderComplianceFilePDF lays the case file out as one table per section
+func renderComplianceFilePDF(file gin.H) ([]byte, error) {
+	pdf := gofpdf.New("L", "mm", "A4", "")
+	pdf.SetTitle("Compliance case file", true)
+	pdf.AddPage()
+
+	user := file["user"].(map[string]interface{})
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.Cell(0, 10, "Compliance case file")
+	pdf.Ln(10)
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.Cell(0, 6, fmt.Sprintf("Generated %s by %v", file["generated_at"].(time.Time).Format(time.RFC3339), file["generated_by"]))
+	pdf.Ln(10)
+
+	pdfSection(pdf, "Identity", []map[string]interface{}{user},
+		[]string{"id", "email", "phone", "first_name", "last_name", "ci_number", "kyc_level", "created_at"})
+
+	var documents []map[string]interface{}
+	for _, submission := range file["kyc"].([]map[string]interface{}) {
+		documents = append(documents, submission["documents"].([]map[string]interface{})...)
+	}
+	pdfSection(pdf, "KYC submissions", file["kyc"].([]map[string]interface{}),
+		[]string{"id", "kyc_level", "status", "submitted_at", "reviewed_at", "face_match_score", "rejection_reason"})
+	pdfSection(pdf, "KYC documents (links expire after "+complianceLinkTTL.String()+")", documents,
+		[]string{"document_type", "status", "created_at", "url"})
+	pdfSection(pdf, "Transactions", file["transactions"].([]map[string]interface{}),
+		[]string{"created_at", "transaction_type", "amount", "currency", "fee", "status", "method", "external_ref"})
+	pdfSection(pdf, "P2P orders", file["orders"].([]map[string]interface{}),
+		[]string{"created_at", "role", "order_type", "currency_from", "currency_to", "amount", "rate", "status"})
+	pdfSection(pdf, "Flagged activity", file["flags"].([]map[string]interface{}),
+		[]string{"created_at", "kind", "type", "severity", "status", "message"})
+	pdfSection(pdf, "Disputes", file["disputes"].([]map[string]interface{}),
+		[]string{"created_at", "role", "dispute_type", "status", "title", "resolution_type", "resolved_at"})
+	pdfSection(pdf, "Security events", file["security"].(gin.H)["events"].([]map[string]interface{}),
+		[]string{"created_at", "action", "entity_type", "ip_address", "user_agent"})
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func pdfSection(pdf *gofpdf.Fpdf, title string, rows []map[string]interface{}, columns []string) {
+	pdf.SetFont("Helvetica", "B", 12)
+	pdf.Cell(0, 8, fmt.Sprintf("%s (%d)", title, len(rows)))
+	pdf.Ln(8)
+
+	width := 277.0 / float64(len(columns))
+	pdf.SetFont("Helvetica", "B", 7)
+	for _, column := range columns {
+		pdf.CellFormat(width, 6, column, "1", 0, "L", false, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Helvetica", "", 7)
+	for _, row := range rows {
+		for _, column := range columns {
+			pdf.CellFormat(width, 5, pdfValue(pdf, row[column], width), "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.Ln(4)
+}
+
+// pdfValue formats a cell and truncates it to the column width
+func pdfValue(pdf *gofpdf.Fpdf, value interface{}, width float64) string {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		text = ""
+	case time.Time:
+		text = v.Format("2006-01-02 15:04")
+	default:
+		text = fmt.Sprint(v)
+	}
+
+	for len(text) > 0 && pdf.GetStringWidth(text) > width-2 {
+		text = text[:len(text)-1]
+	}
+	return text
+}
+
+// queryRows runs a query and returns every row as a column->value map
+func (s *Server) queryRows(query string, args ...interface{}) ([]map[string]interface{}, error) {
+	results := []map[string]interface{}{}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return results, err
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return results, err
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				row[column] = string(b)
+			} else {
+				row[column] = values[i]
+			}
+		}
+		results = append(results, row)
+	}
+
+	return results, rows.Err()
+}
+
+// recordAuditLog stores an admin action in audit_logs, with any details in new_values
+func (s *Server) recordAuditLog(c *gin.Context, userID, action, entityType, entityID string, details map[string]interface{}) {
+	detailsJSON, _ := json.Marshal(details)
+	_, err := s.db.Exec(`
+		INSERT INTO audit_logs (user_id, action, entity_type, entity_id, new_values, ip_address, user_agent, service)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::inet, $7, 'kyc')
+	`, userID, action, entityType, entityID, string(detailsJSON), c.ClientIP(), c.Request.UserAgent())
+
+	if err != nil {
+		log.Printf("⚠️ Failed to write audit log %s for %s %s: %v", action, entityType, entityID, err)
+	}
+}
@@ -0,0 +1,84 @@
+// services/kyc/compliance_test.go
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// expectComplianceFile expects every query of an otherwise empty case file for user-2
+func expectComplianceFile(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`LEFT JOIN user_profiles up ON up.user_id = u.id`).WithArgs("user-2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow("user-2", "ana@example.com"))
+	for _, table := range []string{"kyc_submissions", "transactions", "orders", "system_alerts", "disputes", "audit_logs"} {
+		mock.ExpectQuery(`FROM ` + table).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	}
+	mock.ExpectQuery(`SELECT failed_login_count, locked_until FROM users`).WithArgs("user-2").
+		WillReturnRows(sqlmock.NewRows([]string{"failed_login_count", "locked_until"}).AddRow(0, nil))
+}
+
+func TestComplianceFileRequiresComplianceRole(t *testing.T) {
+	tests := []struct {
+		role       string
+		wantStatus int
+	}{
+		{role: "", wantStatus: http.StatusForbidden},
+		{role: "user", wantStatus: http.StatusForbidden},
+		{role: "mediator", wantStatus: http.StatusForbidden},
+		{role: "compliance", wantStatus: http.StatusOK},
+		{role: "admin", wantStatus: http.StatusOK},
+	}
+
+	t.Setenv("JWT_SECRET", "test-secret")
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "officer-1",
+		"exp":     time.Now().Add(15 * time.Minute).Unix(),
+	}).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(`SELECT COALESCE\(role, ''\) FROM users WHERE id = \$1`).WithArgs("officer-1").
+				WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(tt.role))
+			if tt.wantStatus == http.StatusOK {
+				expectComplianceFile(mock)
+				// The export is audited against the officer, naming the user it is about
+				mock.ExpectExec(`INSERT INTO audit_logs`).
+					WithArgs("officer-1", "COMPLIANCE_FILE_EXPORT", "user", "user-2", `{"format":"json"}`,
+						sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			gin.SetMode(gin.TestMode)
+			s := &Server{db: db}
+			router := gin.New()
+			router.GET("/admin/users/:id/compliance-file", s.authMiddleware(), s.complianceMiddleware(), s.handleGetComplianceFile)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/admin/users/user-2/compliance-file", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
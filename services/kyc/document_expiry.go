@@ -0,0 +1,224 @@
+// services/kyc/document_expiry.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Document expiry: a submission carries the CI expiry the user typed (document_expiry), and each
+// uploaded document may carry its own (the expires_at form field, or for a CI the date the OCR
+// reads next to VENCE / EXPIRA). A proof of address without a date is valid for
+// KYC_PROOF_OF_ADDRESS_VALIDITY_DAYS (default 365) from upload. The submission keeps the earliest
+// of them in document_expires_at. Once that date passes, an hourly job marks the approved
+// submission KYC_EXPIRED, drops the user to KYC level 0, which every tier check reads, and notifies
+// them; approving a new submission restores the level.
+
+const (
+	documentExpiryCheckInterval = time.Hour
+	documentExpiryLockKey       = "kyc:document_expiry_worker:lock"
+
+	defaultProofOfAddressValidityDays = 365
+)
+
+// releaseLockScript deletes the lock only if this replica still owns it
+const releaseLockScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`
+
+const documentDateLayout = "2006-01-02"
+
+func proofOfAddressValidity() time.Duration {
+	days := defaultProofOfAddressValidityDays
+	if value, err := strconv.Atoi(os.Getenv("KYC_PROOF_OF_ADDRESS_VALIDITY_DAYS")); err == nil && value >= 0 {
+		days = value
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// parseDocumentExpiry reads a YYYY-MM-DD expiry date; an empty value means none was given
+func parseDocumentExpiry(value string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse(documentDateLayout, value)
+	if err != nil {
+		return nil, fmt.Errorf("expiry date must be YYYY-MM-DD")
+	}
+	if !date.After(time.Now()) {
+		return nil, fmt.Errorf("the document has already expired")
+	}
+	return &date, nil
+}
+
+// ocrExpiryDate turns the DD/MM/YYYY expiry_date read from a CI into a date
+func ocrExpiryDate(result *OCRResult) *time.Time {
+	value := result.Fields["expiry_date"]
+	if value == "" {
+		return nil
+	}
+	date, err := time.Parse("02/01/2006", value)
+	if err != nil {
+		return nil
+	}
+	return &date
+}
+
+// nullDate converts an optional date for a DATE column
+func nullDate(date *time.Time) interface{} {
+	if date == nil {
+		return nil
+	}
+	return date.Format(documentDateLayout)
+}
+
+// recordDocumentExpiry sets the document's expiry when it has none yet and pulls the submission's
+// document_expires_at forward if the document expires earlier
+func (s *Server) recordDocumentExpiry(docID string, expiresAt time.Time) error {
+	_, err := s.db.Exec(`
+		WITH doc AS (
+			UPDATE kyc_documents SET expires_at = COALESCE(expires_at, $2::date)
+			WHERE id = $1
+			RETURNING submission_id, expires_at
+		)
+		UPDATE kyc_submissions ks SET document_expires_at = LEAST(ks.document_expires_at, doc.expires_at)
+		FROM doc
+		WHERE ks.id = doc.submission_id
+	`, docID, expiresAt.Format(documentDateLayout))
+	return err
+}
+
+// processDocumentExpiry runs the expiry check on a ticker until the process exits
+func (s *Server) processDocumentExpiry() {
+	ticker := time.NewTicker(documentExpiryCheckInterval)
+	defer ticker.Stop()
+
+	s.runDocumentExpiryCheck()
+	for range ticker.C {
+		s.runDocumentExpiryCheck()
+	}
+}
+
+// runDocumentExpiryCheck takes the Redis lock so only one replica expires approvals per tick
+func (s *Server) runDocumentExpiryCheck() {
+	ctx := context.Background()
+	token := uuid.New().String()
+
+	acquired, err := s.redis.SetNX(ctx, documentExpiryLockKey, token, documentExpiryCheckInterval).Result()
+	if err != nil {
+		log.Printf("Error acquiring KYC document expiry lock: %v", err)
+		return
+	}
+	if !acquired {
+		return
+	}
+	defer s.redis.Eval(ctx, releaseLockScript, []string{documentExpiryLockKey}, token)
+
+	s.expireLapsedSubmissions()
+}
+
+// expireLapsedSubmissions expires every approved submission whose documents lapsed before today
+func (s *Server) expireLapsedSubmissions() {
+	rows, err := s.db.Query(`
+		SELECT id FROM kyc_submissions
+		WHERE status = 'APPROVED' AND document_expires_at < CURRENT_DATE
+	`)
+	if err != nil {
+		log.Printf("Error loading lapsed KYC submissions: %v", err)
+		return
+	}
+	var submissionIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			submissionIDs = append(submissionIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, submissionID := range submissionIDs {
+		if err := s.expireSubmission(submissionID); err != nil {
+			log.Printf("❌ KYC: Failed to expire submission %s: %v", submissionID, err)
+		}
+	}
+}
+
+func (s *Server) expireSubmission(submissionID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID string
+	var expiresAt time.Time
+	err = tx.QueryRow(`
+		UPDATE kyc_submissions SET status = 'KYC_EXPIRED', expired_at = NOW()
+		WHERE id = $1 AND status = 'APPROVED' AND document_expires_at < CURRENT_DATE
+		RETURNING user_id, document_expires_at
+	`, submissionID).Scan(&userID, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Only the user's current approval sets their level; an older lapsed one just changes status
+	var current bool
+	err = tx.QueryRow(`
+		SELECT NOT EXISTS (
+			SELECT 1 FROM kyc_submissions
+			WHERE user_id = $1 AND status = 'APPROVED' AND id <> $2
+		)
+	`, userID, submissionID).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	var previousLevel int
+	if current {
+		err = tx.QueryRow(`
+			UPDATE users u SET kyc_level_before_expiry = old.kyc_level, kyc_level = 0, kyc_expired_at = NOW()
+			FROM (SELECT id, COALESCE(kyc_level, 0) AS kyc_level FROM users WHERE id = $1 FOR UPDATE) old
+			WHERE u.id = old.id
+			RETURNING old.kyc_level
+		`, userID).Scan(&previousLevel)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if current {
+		log.Printf("⏳ KYC: Submission %s expired on %s, user %s downgraded from level %d",
+			submissionID, expiresAt.Format(documentDateLayout), userID, previousLevel)
+		s.notifyKYCExpired(userID, expiresAt, previousLevel)
+	}
+	return nil
+}
+
+func (s *Server) notifyKYCExpired(userID string, expiresAt time.Time, previousLevel int) {
+	s.events.Publish("kyc.expired", userID,
+		fmt.Sprintf("Your identity documents expired on %s. Submit updated documents to restore KYC level %d",
+			expiresAt.Format(documentDateLayout), previousLevel),
+		map[string]interface{}{
+			"expired_on":     expiresAt.Format(documentDateLayout),
+			"previous_level": previousLevel,
+		})
+}
@@ -0,0 +1,171 @@
+// services/kyc/face.go
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FaceMatcher compares a selfie against the photo on the user's CI and returns a
+// similarity score between 0 and 1. Selected with FACE_MATCH_PROVIDER (mock or http). The mock
+// passes every selfie, so it has to be chosen explicitly and only with APP_ENV development or
+// test; any other configuration without a working provider stops the service at startup.
+type FaceMatcher interface {
+	Name() string
+	Compare(selfieData, documentData []byte) (float64, error)
+}
+
+const defaultFaceMatchThreshold = 0.80
+
+// mockProvidersAllowed reports whether APP_ENV allows mock providers; anything but development
+// or test counts as production
+func mockProvidersAllowed() bool {
+	switch strings.ToLower(os.Getenv("APP_ENV")) {
+	case "development", "test":
+		return true
+	}
+	return false
+}
+
+func NewFaceMatcher() (FaceMatcher, error) {
+	provider := strings.ToLower(os.Getenv("FACE_MATCH_PROVIDER"))
+
+	switch provider {
+	case "http":
+		endpoint := os.Getenv("FACE_MATCH_ENDPOINT")
+		if endpoint == "" {
+			return nil, fmt.Errorf("FACE_MATCH_PROVIDER=http requires FACE_MATCH_ENDPOINT")
+		}
+		log.Printf("🙂 Face match provider: http (%s)", endpoint)
+		return &HTTPFaceMatcher{
+			endpoint: endpoint,
+			apiKey:   os.Getenv("FACE_MATCH_API_KEY"),
+			client:   &http.Client{Timeout: 30 * time.Second},
+		}, nil
+	case "mock":
+		if !mockProvidersAllowed() {
+			return nil, fmt.Errorf("the mock face matcher is only allowed with APP_ENV development or test")
+		}
+		log.Printf("🙂 Face match provider: mock")
+		return &MockFaceMatcher{}, nil
+	case "":
+		return nil, fmt.Errorf("FACE_MATCH_PROVIDER is not set")
+	default:
+		return nil, fmt.Errorf("unknown FACE_MATCH_PROVIDER %q", provider)
+	}
+}
+
+// faceMatchThreshold is the minimum similarity for a selfie to pass, configurable with FACE_MATCH_THRESHOLD
+func faceMatchThreshold() float64 {
+	if value := os.Getenv("FACE_MATCH_THRESHOLD"); value != "" {
+		if threshold, err := strconv.ParseFloat(value, 64); err == nil && threshold >= 0 && threshold <= 1 {
+			return threshold
+		}
+		log.Printf("⚠️ Invalid FACE_MATCH_THRESHOLD %q, using %.2f", value, defaultFaceMatchThreshold)
+	}
+	return defaultFaceMatchThreshold
+}
+
+// MockFaceMatcher returns a deterministic score derived from the selfie size, for development and tests
+type MockFaceMatcher struct{}
+
+func (m *MockFaceMatcher) Name() string { return "mock" }
+
+func (m *MockFaceMatcher) Compare(selfieData, documentData []byte) (float64, error) {
+	return 0.85 + (float64(len(selfieData)%10) / 100), nil
+}
+
+// HTTPFaceMatcher calls a face comparison service with both images base64 encoded and
+// expects {"similarity": 0-1} (or 0-100) back
+type HTTPFaceMatcher struct {
+	endpoint string
+	apiKey   string
+	client   *http.Client
+}
+
+func (m *HTTPFaceMatcher) Name() string { return "http" }
+
+func (m *HTTPFaceMatcher) Compare(selfieData, documentData []byte) (float64, error) {
+	payload, err := json.Marshal(map[string]string{
+		"source_image": base64.StdEncoding.EncodeToString(selfieData),
+		"target_image": base64.StdEncoding.EncodeToString(documentData),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, m.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("face match request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return 0, fmt.Errorf("face match returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		Similarity float64 `json:"similarity"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("invalid face match response: %w", err)
+	}
+
+	similarity := result.Similarity
+	if similarity > 1 {
+		similarity /= 100
+	}
+	return similarity, nil
+}
+
+// recordFaceVerification stores every selfie attempt. A failed attempt blocks automatic
+// approval of the submission and sends it to manual review.
+func (s *Server) recordFaceVerification(userID, submissionID, documentID, selfiePath string, score, threshold float64, passed bool, errMsg string) {
+	_, err := s.db.Exec(`
+		INSERT INTO kyc_face_verifications (
+			user_id, submission_id, document_id, selfie_path, provider, score, threshold, passed, error
+		) VALUES ($1, NULLIF($2, '')::uuid, NULLIF($3, '')::uuid, $4, $5, $6, $7, $8, NULLIF($9, ''))
+	`, userID, submissionID, documentID, selfiePath, s.faceMatcher.Name(), score, threshold, passed, errMsg)
+	if err != nil {
+		log.Printf("❌ KYC_FACE: Failed to record face verification for user %s: %v", userID, err)
+	}
+
+	if submissionID == "" {
+		return
+	}
+
+	if passed {
+		s.db.Exec(`
+			UPDATE kyc_submissions SET face_match_score = $1, face_match_passed = true, updated_at = NOW()
+			WHERE id = $2
+		`, score, submissionID)
+		return
+	}
+
+	s.db.Exec(`
+		UPDATE kyc_submissions
+		SET face_match_score = $1, face_match_passed = false, requires_manual_review = true,
+			status = CASE WHEN status IN ('PENDING', 'UNDER_REVIEW') THEN 'UNDER_REVIEW' ELSE status END,
+			updated_at = NOW()
+		WHERE id = $2
+	`, score, submissionID)
+}
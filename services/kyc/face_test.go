@@ -0,0 +1,45 @@
+// services/kyc/face_test.go
+package main
+
+import "testing"
+
+func TestNewFaceMatcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		appEnv   string
+		provider string
+		endpoint string
+		want     string // provider name, empty when configuration must fail
+	}{
+		{name: "http with endpoint", provider: "http", endpoint: "http://faces", want: "http"},
+		{name: "http without endpoint", provider: "http"},
+		{name: "mock in development", appEnv: "development", provider: "mock", want: "mock"},
+		{name: "mock in test", appEnv: "test", provider: "MOCK", want: "mock"},
+		{name: "mock in production", appEnv: "production", provider: "mock"},
+		{name: "mock without APP_ENV", provider: "mock"},
+		{name: "no provider in development", appEnv: "development"},
+		{name: "unknown provider", appEnv: "development", provider: "rekognition"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("APP_ENV", tt.appEnv)
+			t.Setenv("FACE_MATCH_PROVIDER", tt.provider)
+			t.Setenv("FACE_MATCH_ENDPOINT", tt.endpoint)
+
+			matcher, err := NewFaceMatcher()
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("NewFaceMatcher() = %s, want an error", matcher.Name())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewFaceMatcher() error = %v", err)
+			}
+			if matcher.Name() != tt.want {
+				t.Errorf("NewFaceMatcher() = %s, want %s", matcher.Name(), tt.want)
+			}
+		})
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"io"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 	"log"
@@ -38,6 +39,7 @@ type KYCSubmission struct {
 	IncomeSource    string     `json:"income_source"`
 	ExpectedVolume  float64    `json:"expected_volume"`
 	PEPStatus       bool       `json:"pep_status"`
+	DocumentExpiry  string     `json:"document_expiry"`
 	Status          string     `json:"status"`
 	RejectionReason string     `json:"rejection_reason"`
 	SubmittedAt     time.Time  `json:"submitted_at"`
@@ -45,6 +47,41 @@ type KYCSubmission struct {
 	ReviewedBy      *string    `json:"reviewed_by"`
 }
 
+// VerificationData is the applicant's data as stored in kyc_submissions.verification_data
+type VerificationData struct {
+	FirstName      string  `json:"first_name"`
+	LastName       string  `json:"last_name"`
+	CINumber       string  `json:"ci_number"`
+	CIComplement   string  `json:"ci_complement"`
+	DateOfBirth    string  `json:"date_of_birth"`
+	Address        string  `json:"address"`
+	City           string  `json:"city"`
+	Phone          string  `json:"phone"`
+	Occupation     string  `json:"occupation"`
+	IncomeSource   string  `json:"income_source"`
+	ExpectedVolume float64 `json:"expected_volume"`
+	PEPStatus      bool    `json:"pep_status"`
+}
+
+// verificationDataJSON encodes the submitted data for the verification_data column
+func (k KYCSubmission) verificationDataJSON() (string, error) {
+	data, err := json.Marshal(VerificationData{
+		FirstName:      k.FirstName,
+		LastName:       k.LastName,
+		CINumber:       k.CINumber,
+		CIComplement:   k.CIComplement,
+		DateOfBirth:    k.DateOfBirth,
+		Address:        k.Address,
+		City:           k.City,
+		Phone:          k.Phone,
+		Occupation:     k.Occupation,
+		IncomeSource:   k.IncomeSource,
+		ExpectedVolume: k.ExpectedVolume,
+		PEPStatus:      k.PEPStatus,
+	})
+	return string(data), err
+}
+
 type Document struct {
 	ID         string    `json:"id"`
 	UserID     string    `json:"user_id"`
@@ -58,15 +95,15 @@ type Document struct {
 
 func (s *Server) handleSubmitKYC(c *gin.Context) {
 	userID := c.GetString("user_id")
-	log.Printf("DEBUG: Starting KYC submission for user: %s", userID)
+	requestLog(c).Printf("DEBUG: Starting KYC submission for user: %s", userID)
 	
 	var req KYCSubmission
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("ERROR: JSON binding failed for user %s: %v", userID, err)
+		requestLog(c).Printf("ERROR: JSON binding failed for user %s: %v", userID, err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	log.Printf("DEBUG: KYC data bound successfully for user: %s", userID)
+	requestLog(c).Printf("DEBUG: KYC data bound successfully for user: %s", userID)
 	
 	// Validate CI number format (Bolivia)
 	if !s.validateCINumber(req.CINumber) {
@@ -74,33 +111,64 @@ func (s *Server) handleSubmitKYC(c *gin.Context) {
 		return
 	}
 	
+	documentExpiry, err := parseDocumentExpiry(req.DocumentExpiry)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document_expiry: " + err.Error()})
+		return
+	}
+	
+	verificationData, err := req.verificationDataJSON()
+	if err != nil {
+		requestLog(c).Printf("Error encoding KYC data for user %s: %v", userID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid KYC data"})
+		return
+	}
+	
 	// Check for existing submission
 	var existingID string
-	err := s.db.QueryRow(`
+	err = s.db.QueryRow(`
 		SELECT id FROM kyc_submissions 
 		WHERE user_id = $1 AND status IN ('UNDER_REVIEW', 'PENDING')
 	`, userID).Scan(&existingID)
 	
 	var submissionID string
 	if err == sql.ErrNoRows {
+		// A new attempt, limited after rejections
+		check, err := s.checkResubmission(userID)
+		if err != nil {
+			requestLog(c).Printf("Error checking KYC attempts of user %s: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check previous KYC attempts"})
+			return
+		}
+		if !check.Allowed {
+			requestLog(c).Printf("⛔ KYC: Submission of user %s refused (%s, %d rejections)", userID, check.Code, check.Rejections)
+			respondResubmissionDenied(c, check)
+			return
+		}
+		
 		// Create new KYC submission
 		submissionID = uuid.New().String()
 		_, err = s.db.Exec(`
 			INSERT INTO kyc_submissions (
 				id, user_id, kyc_level, status, submitted_at,
-				verification_data
-			) VALUES ($1, $2, $3, $4, $5, $6)
-		`, submissionID, userID, req.KYCLevel, "PENDING", time.Now(), 
-		   fmt.Sprintf(`{"first_name":"%s","last_name":"%s","ci_number":"%s","ci_complement":"%s","date_of_birth":"%s","address":"%s","city":"%s","phone":"%s","occupation":"%s","income_source":"%s","expected_volume":%f,"pep_status":%t}`,
-			req.FirstName, req.LastName, req.CINumber, req.CIComplement, req.DateOfBirth, req.Address, req.City, req.Phone, req.Occupation, req.IncomeSource, req.ExpectedVolume, req.PEPStatus))
+				verification_data, attempt_number, document_expires_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, submissionID, userID, req.KYCLevel, "PENDING", time.Now(), verificationData, check.Rejections+1,
+			nullDate(documentExpiry))
 		
 		if err != nil {
-			log.Printf("Error creating KYC submission for user %s: %v", userID, err)
+			requestLog(c).Printf("Error creating KYC submission for user %s: %v", userID, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit KYC"})
 			return
 		}
+		
+		if check.OverrideID != "" {
+			if err := s.consumeResubmissionOverride(check.OverrideID, submissionID); err != nil {
+				requestLog(c).Printf("⚠️ KYC: Failed to mark resubmission override %s used: %v", check.OverrideID, err)
+			}
+		}
 	} else if err != nil {
-		log.Printf("Error querying existing KYC submission for user %s: %v", userID, err)
+		requestLog(c).Printf("Error querying existing KYC submission for user %s: %v", userID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing KYC"})
 		return
 	} else {
@@ -109,22 +177,22 @@ func (s *Server) handleSubmitKYC(c *gin.Context) {
 		_, err = s.db.Exec(`
 			UPDATE kyc_submissions 
 			SET kyc_level = $1, status = 'PENDING', submitted_at = $2,
-				verification_data = $3
+				verification_data = $3,
+				document_expires_at = LEAST($5::date, (
+					SELECT MIN(expires_at) FROM kyc_documents WHERE submission_id = $4
+				))
 			WHERE id = $4
-		`, req.KYCLevel, time.Now(), 
-		   fmt.Sprintf(`{"first_name":"%s","last_name":"%s","ci_number":"%s","ci_complement":"%s","date_of_birth":"%s","address":"%s","city":"%s","phone":"%s","occupation":"%s","income_source":"%s","expected_volume":%f,"pep_status":%t}`,
-			req.FirstName, req.LastName, req.CINumber, req.CIComplement, req.DateOfBirth, req.Address, req.City, req.Phone, req.Occupation, req.IncomeSource, req.ExpectedVolume, req.PEPStatus),
-		   submissionID)
+		`, req.KYCLevel, time.Now(), verificationData, submissionID, nullDate(documentExpiry))
 		
 		if err != nil {
-			log.Printf("Error updating KYC submission for user %s: %v", userID, err)
+			requestLog(c).Printf("Error updating KYC submission for user %s: %v", userID, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update KYC"})
 			return
 		}
 	}
 	
 	// Start automatic verification process
-	go s.performAutomaticVerification(submissionID)
+	go s.performAutomaticVerification(c.GetString("request_id"), submissionID)
 	
 	c.JSON(http.StatusCreated, gin.H{
 		"submission_id": submissionID,
@@ -134,95 +202,105 @@ func (s *Server) handleSubmitKYC(c *gin.Context) {
 }
 
 func (s *Server) handleUploadDocument(c *gin.Context) {
-	log.Printf("📤 KYC_UPLOAD: Starting document upload handler")
+	requestLog(c).Printf("📤 KYC_UPLOAD: Starting document upload handler")
 	
 	userID := c.GetString("user_id")
-	log.Printf("📤 KYC_UPLOAD: User ID: %s", userID)
+	requestLog(c).Printf("📤 KYC_UPLOAD: User ID: %s", userID)
 	
 	docType := c.PostForm("type")
-	log.Printf("📤 KYC_UPLOAD: Document type: '%s'", docType)
+	requestLog(c).Printf("📤 KYC_UPLOAD: Document type: '%s'", docType)
 	
 	// Log all form fields
 	if c.Request.ParseForm() == nil {
-		log.Printf("📤 KYC_UPLOAD: Form fields:")
+		requestLog(c).Printf("📤 KYC_UPLOAD: Form fields:")
 		for key, values := range c.Request.PostForm {
-			log.Printf("  %s: %v", key, values)
+			requestLog(c).Printf("  %s: %v", key, values)
 		}
 	}
 	
 	// Validate document type
 	validTypes := []string{"CI", "PASSPORT", "SELFIE", "PROOF_ADDRESS"}
-	log.Printf("📤 KYC_UPLOAD: Valid types: %v", validTypes)
+	requestLog(c).Printf("📤 KYC_UPLOAD: Valid types: %v", validTypes)
 	if !contains(validTypes, docType) {
-		log.Printf("❌ KYC_UPLOAD: Invalid document type '%s'", docType)
+		requestLog(c).Printf("❌ KYC_UPLOAD: Invalid document type '%s'", docType)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document type"})
 		return
 	}
-	log.Printf("✅ KYC_UPLOAD: Document type validation passed")
+	requestLog(c).Printf("✅ KYC_UPLOAD: Document type validation passed")
+	
+	expiresAt, err := parseDocumentExpiry(c.PostForm("expires_at"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expires_at: " + err.Error()})
+		return
+	}
+	if expiresAt == nil && docType == "PROOF_ADDRESS" && proofOfAddressValidity() > 0 {
+		validUntil := time.Now().Add(proofOfAddressValidity())
+		expiresAt = &validUntil
+	}
 	
 	// Get file from request
-	log.Printf("📤 KYC_UPLOAD: Attempting to get file from form data")
+	requestLog(c).Printf("📤 KYC_UPLOAD: Attempting to get file from form data")
 	file, header, err := c.Request.FormFile("document")
 	if err != nil {
-		log.Printf("❌ KYC_UPLOAD: Failed to get file from request: %v", err)
+		requestLog(c).Printf("❌ KYC_UPLOAD: Failed to get file from request: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
 		return
 	}
 	defer file.Close()
-	log.Printf("✅ KYC_UPLOAD: File received - Name: %s, Size: %d bytes", header.Filename, header.Size)
+	requestLog(c).Printf("✅ KYC_UPLOAD: File received - Name: %s, Size: %d bytes", header.Filename, header.Size)
 	
 	// Validate file size (max 10MB)
-	log.Printf("📤 KYC_UPLOAD: Validating file size (current: %d bytes, max: 10MB)", header.Size)
+	requestLog(c).Printf("📤 KYC_UPLOAD: Validating file size (current: %d bytes, max: 10MB)", header.Size)
 	if header.Size > 10*1024*1024 {
-		log.Printf("❌ KYC_UPLOAD: File too large - %d bytes exceeds 10MB limit", header.Size)
+		requestLog(c).Printf("❌ KYC_UPLOAD: File too large - %d bytes exceeds 10MB limit", header.Size)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "File too large (max 10MB)"})
 		return
 	}
-	log.Printf("✅ KYC_UPLOAD: File size validation passed")
+	requestLog(c).Printf("✅ KYC_UPLOAD: File size validation passed")
 	
 	// Validate file type
 	allowedTypes := map[string]bool{
 		".jpg": true, ".jpeg": true, ".png": true, ".pdf": true,
 	}
 	ext := strings.ToLower(filepath.Ext(header.Filename))
-	log.Printf("📤 KYC_UPLOAD: Validating file type - extension: '%s'", ext)
-	log.Printf("📤 KYC_UPLOAD: Allowed types: %v", allowedTypes)
+	requestLog(c).Printf("📤 KYC_UPLOAD: Validating file type - extension: '%s'", ext)
+	requestLog(c).Printf("📤 KYC_UPLOAD: Allowed types: %v", allowedTypes)
 	if !allowedTypes[ext] {
-		log.Printf("❌ KYC_UPLOAD: Invalid file type '%s' not in allowed types", ext)
+		requestLog(c).Printf("❌ KYC_UPLOAD: Invalid file type '%s' not in allowed types", ext)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type"})
 		return
 	}
-	log.Printf("✅ KYC_UPLOAD: File type validation passed")
+	requestLog(c).Printf("✅ KYC_UPLOAD: File type validation passed")
 	
 	// Process and compress image if needed
 	var processedData []byte
-	log.Printf("📤 KYC_UPLOAD: Starting file processing for extension: %s", ext)
+	requestLog(c).Printf("📤 KYC_UPLOAD: Starting file processing for extension: %s", ext)
 	if ext != ".pdf" {
-		log.Printf("📤 KYC_UPLOAD: Processing as image - calling processImage()")
+		requestLog(c).Printf("📤 KYC_UPLOAD: Processing as image - calling processImage()")
 		processedData, err = s.processImage(file)
 		if err != nil {
-			log.Printf("❌ KYC_UPLOAD: Image processing failed: %v", err)
+			requestLog(c).Printf("❌ KYC_UPLOAD: Image processing failed: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process image"})
 			return
 		}
-		log.Printf("✅ KYC_UPLOAD: Image processed successfully - size after processing: %d bytes", len(processedData))
+		requestLog(c).Printf("✅ KYC_UPLOAD: Image processed successfully - size after processing: %d bytes", len(processedData))
 	} else {
-		log.Printf("📤 KYC_UPLOAD: Processing as PDF - reading raw file data")
+		requestLog(c).Printf("📤 KYC_UPLOAD: Processing as PDF - reading raw file data")
 		processedData, err = io.ReadAll(file)
 		if err != nil {
-			log.Printf("❌ KYC_UPLOAD: PDF reading failed: %v", err)
+			requestLog(c).Printf("❌ KYC_UPLOAD: PDF reading failed: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
 			return
 		}
-		log.Printf("✅ KYC_UPLOAD: PDF read successfully - size: %d bytes", len(processedData))
+		requestLog(c).Printf("✅ KYC_UPLOAD: PDF read successfully - size: %d bytes", len(processedData))
 	}
 	
 	// Upload to MinIO
 	fileName := fmt.Sprintf("%s/%s_%s%s", userID, docType, uuid.New().String(), ext)
-	log.Printf("📤 KYC_UPLOAD: Starting MinIO upload - fileName: %s", fileName)
+	requestLog(c).Printf("📤 KYC_UPLOAD: Starting MinIO upload - fileName: %s", fileName)
 	
 	if s.minioClient != nil {
-		log.Printf("📤 KYC_UPLOAD: MinIO client available, uploading to bucket 'kyc-documents'")
+		requestLog(c).Printf("📤 KYC_UPLOAD: MinIO client available, uploading to bucket 'kyc-documents'")
 		_, err = s.minioClient.PutObject(
 			c.Request.Context(),
 			"kyc-documents",
@@ -232,12 +310,12 @@ func (s *Server) handleUploadDocument(c *gin.Context) {
 			minio.PutObjectOptions{ContentType: "application/octet-stream"},
 		)
 		if err != nil {
-			log.Printf("❌ KYC_UPLOAD: MinIO upload failed: %v", err)
+			requestLog(c).Printf("❌ KYC_UPLOAD: MinIO upload failed: %v", err)
 		} else {
-			log.Printf("✅ KYC_UPLOAD: MinIO upload successful")
+			requestLog(c).Printf("✅ KYC_UPLOAD: MinIO upload successful")
 		}
 	} else {
-		log.Printf("⚠️ KYC_UPLOAD: MinIO client is nil - skipping file upload to storage")
+		requestLog(c).Printf("⚠️ KYC_UPLOAD: MinIO client is nil - skipping file upload to storage")
 	}
 	
 	// Ensure user has a KYC submission - create one if it doesn't exist
@@ -247,7 +325,7 @@ func (s *Server) handleUploadDocument(c *gin.Context) {
 	`, userID).Scan(&submissionID)
 	
 	if err == sql.ErrNoRows {
-		log.Printf("📤 KYC_UPLOAD: No KYC submission found, creating automatic submission")
+		requestLog(c).Printf("📤 KYC_UPLOAD: No KYC submission found, creating automatic submission")
 		submissionID = uuid.New().String()
 		_, err = s.db.Exec(`
 			INSERT INTO kyc_submissions (
@@ -256,23 +334,23 @@ func (s *Server) handleUploadDocument(c *gin.Context) {
 		`, submissionID, userID, 1, "UNDER_REVIEW", time.Now(), "{}")
 		
 		if err != nil {
-			log.Printf("❌ KYC_UPLOAD: Failed to create automatic submission: %v", err)
+			requestLog(c).Printf("❌ KYC_UPLOAD: Failed to create automatic submission: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create KYC submission"})
 			return
 		}
-		log.Printf("✅ KYC_UPLOAD: Automatic submission created with ID: %s", submissionID)
+		requestLog(c).Printf("✅ KYC_UPLOAD: Automatic submission created with ID: %s", submissionID)
 	} else if err != nil {
-		log.Printf("❌ KYC_UPLOAD: Failed to query existing submission: %v", err)
+		requestLog(c).Printf("❌ KYC_UPLOAD: Failed to query existing submission: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process KYC submission"})
 		return
 	} else {
-		log.Printf("✅ KYC_UPLOAD: Using existing submission ID: %s", submissionID)
+		requestLog(c).Printf("✅ KYC_UPLOAD: Using existing submission ID: %s", submissionID)
 	}
 	
 	// Save document record
 	docID := uuid.New().String()
-	log.Printf("📤 KYC_UPLOAD: Saving document record to database - docID: %s", docID)
-	log.Printf("📤 KYC_UPLOAD: Document details - userID: %s, docType: %s, fileName: %s, size: %d", 
+	requestLog(c).Printf("📤 KYC_UPLOAD: Saving document record to database - docID: %s", docID)
+	requestLog(c).Printf("📤 KYC_UPLOAD: Document details - userID: %s, docType: %s, fileName: %s, size: %d", 
 		userID, docType, fileName, len(processedData))
 	
 	_, err = s.db.Exec(`
@@ -282,21 +360,27 @@ func (s *Server) handleUploadDocument(c *gin.Context) {
 	`, docID, submissionID, docType, fileName, len(processedData), header.Header.Get("Content-Type"), time.Now())
 	
 	if err != nil {
-		log.Printf("❌ KYC_UPLOAD: Database save failed: %v", err)
+		requestLog(c).Printf("❌ KYC_UPLOAD: Database save failed: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save document"})
 		return
 	}
-	log.Printf("✅ KYC_UPLOAD: Document record saved successfully in database")
+	requestLog(c).Printf("✅ KYC_UPLOAD: Document record saved successfully in database")
+	
+	if expiresAt != nil {
+		if err := s.recordDocumentExpiry(docID, *expiresAt); err != nil {
+			requestLog(c).Printf("⚠️ KYC_UPLOAD: Failed to record expiry of document %s: %v", docID, err)
+		}
+	}
 	
 	// Perform OCR if it's a CI document
 	if docType == "CI" {
-		log.Printf("📤 KYC_UPLOAD: Document type is CI - starting OCR process in background")
-		go s.performOCR(docID, processedData)
+		requestLog(c).Printf("📤 KYC_UPLOAD: Document type is CI - starting OCR process in background")
+		go s.performOCR(c.GetString("request_id"), docID, processedData)
 	} else {
-		log.Printf("📤 KYC_UPLOAD: Document type is %s - skipping OCR", docType)
+		requestLog(c).Printf("📤 KYC_UPLOAD: Document type is %s - skipping OCR", docType)
 	}
 	
-	log.Printf("📤 KYC_UPLOAD: Upload process completed successfully - returning response")
+	requestLog(c).Printf("📤 KYC_UPLOAD: Upload process completed successfully - returning response")
 	c.JSON(http.StatusOK, gin.H{
 		"document_id": docID,
 		"status":      "uploaded",
@@ -310,15 +394,17 @@ func (s *Server) handleGetKYCStatus(c *gin.Context) {
 	var submission KYCSubmission
 	var verificationData sql.NullString
 	var rejectionReason sql.NullString
+	var documentExpiresAt, expiredAt sql.NullTime
 	err := s.db.QueryRow(`
-		SELECT id, user_id, kyc_level, status, submitted_at, reviewed_at, reviewed_by, rejection_reason, verification_data
+		SELECT id, user_id, kyc_level, status, submitted_at, reviewed_at, reviewed_by, rejection_reason, verification_data,
+			document_expires_at, expired_at
 		FROM kyc_submissions 
 		WHERE user_id = $1 
 		ORDER BY created_at DESC 
 		LIMIT 1
 	`, userID).Scan(&submission.ID, &submission.UserID, &submission.KYCLevel, 
 		&submission.Status, &submission.SubmittedAt, &submission.ReviewedAt, 
-		&submission.ReviewedBy, &rejectionReason, &verificationData)
+		&submission.ReviewedBy, &rejectionReason, &verificationData, &documentExpiresAt, &expiredAt)
 	
 	// Handle nullable rejection_reason
 	if rejectionReason.Valid {
@@ -331,14 +417,27 @@ func (s *Server) handleGetKYCStatus(c *gin.Context) {
 	}
 	
 	if err != nil {
-		log.Printf("Error getting KYC status for user %s: %v", userID, err)
+		requestLog(c).Printf("Error getting KYC status for user %s: %v", userID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get KYC status"})
 		return
 	}
 	
+	// Expiry of the documents behind the submission
+	expiry := gin.H{"expires_at": nil, "expired": submission.Status == "KYC_EXPIRED"}
+	if documentExpiresAt.Valid {
+		submission.DocumentExpiry = documentExpiresAt.Time.Format(documentDateLayout)
+		expiry["expires_at"] = submission.DocumentExpiry
+		if !expiredAt.Valid {
+			expiry["days_remaining"] = int(time.Until(documentExpiresAt.Time.AddDate(0, 0, 1)).Hours() / 24)
+		}
+	}
+	if expiredAt.Valid {
+		expiry["expired_at"] = expiredAt.Time
+	}
+	
 	// Get documents
 	rows, err := s.db.Query(`
-		SELECT id, document_type, file_path, status, created_at
+		SELECT id, document_type, file_path, status, created_at, expires_at
 		FROM kyc_documents 
 		WHERE submission_id = $1
 	`, submission.ID)
@@ -349,66 +448,150 @@ func (s *Server) handleGetKYCStatus(c *gin.Context) {
 		for rows.Next() {
 			var docID, docType, filePath, status string
 			var createdAt time.Time
-			if err := rows.Scan(&docID, &docType, &filePath, &status, &createdAt); err == nil {
-				documents = append(documents, map[string]interface{}{
+			var expiresAt sql.NullTime
+			if err := rows.Scan(&docID, &docType, &filePath, &status, &createdAt, &expiresAt); err == nil {
+				document := map[string]interface{}{
 					"id":          docID,
 					"type":        docType,
 					"status":      status,
 					"uploaded_at": createdAt,
-				})
+				}
+				if expiresAt.Valid {
+					document["expires_at"] = expiresAt.Time.Format(documentDateLayout)
+				}
+				documents = append(documents, document)
 			}
 		}
 		
 		c.JSON(http.StatusOK, gin.H{
 			"submission": submission,
 			"documents":  documents,
+			"expiry":     expiry,
 		})
 	} else {
 		c.JSON(http.StatusOK, gin.H{
 			"submission": submission,
 			"documents":  []map[string]interface{}{},
+			"expiry":     expiry,
 		})
 	}
 }
 
+// handleGetPendingKYC lists the submissions waiting for review, oldest first unless
+// ?sort=newest. Filters: ?level=1..3 and ?older_than= a duration such as 48h or 3d, measured
+// from submission. Paginated with ?limit= (default 50, max 200) and ?offset=.
 func (s *Server) handleGetPendingKYC(c *gin.Context) {
+	var level sql.NullInt64
+	if value := c.Query("level"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 3 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "level must be 1, 2 or 3"})
+			return
+		}
+		level = sql.NullInt64{Int64: int64(parsed), Valid: true}
+	}
+	
+	var submittedBefore sql.NullTime
+	if value := c.Query("older_than"); value != "" {
+		age, err := parseSubmissionAge(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "older_than must be a duration such as 48h or 3d"})
+			return
+		}
+		submittedBefore = sql.NullTime{Time: time.Now().Add(-age), Valid: true}
+	}
+	
+	order := "ASC"
+	switch c.DefaultQuery("sort", "oldest") {
+	case "oldest":
+	case "newest":
+		order = "DESC"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be oldest or newest"})
+		return
+	}
+	
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+	
 	rows, err := s.db.Query(`
 		SELECT ks.id, ks.user_id, ks.kyc_level, ks.status, ks.submitted_at, 
-			   u.email, u.first_name, u.last_name
+			   u.email, u.first_name, u.last_name,
+			   ks.face_match_score, COALESCE(ks.requires_manual_review, false),
+			   COALESCE(ks.screening_status, ''), COUNT(*) OVER()
 		FROM kyc_submissions ks
 		JOIN users u ON ks.user_id = u.id
-		WHERE ks.status = 'PENDING'
-		ORDER BY ks.submitted_at ASC
-	`)
+		WHERE (ks.status = 'PENDING'
+				OR (ks.status = 'UNDER_REVIEW' AND COALESCE(ks.requires_manual_review, false)))
+			AND ($1::int IS NULL OR ks.kyc_level = $1)
+			AND ($2::timestamptz IS NULL OR ks.submitted_at < $2)
+		ORDER BY ks.submitted_at `+order+`, ks.id
+		LIMIT $3 OFFSET $4
+	`, level, submittedBefore, limit, offset)
 	
 	if err != nil {
+		requestLog(c).Printf("Error loading pending KYC submissions: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get pending KYC"})
 		return
 	}
 	defer rows.Close()
 	
-	var submissions []map[string]interface{}
+	total := 0
+	submissions := []map[string]interface{}{}
 	for rows.Next() {
 		var id, userID, email, firstName, lastName string
 		var level int
 		var status string
 		var submittedAt time.Time
+		var faceMatchScore sql.NullFloat64
+		var manualReview bool
+		var screeningStatus string
 		
 		if err := rows.Scan(&id, &userID, &level, &status, &submittedAt, 
-			&email, &firstName, &lastName); err == nil {
+			&email, &firstName, &lastName, &faceMatchScore, &manualReview, &screeningStatus, &total); err == nil {
 			submissions = append(submissions, map[string]interface{}{
-				"id":           id,
-				"user_id":      userID,
-				"level":        level,
-				"status":       status,
-				"submitted_at": submittedAt,
-				"user_email":   email,
-				"user_name":    firstName + " " + lastName,
+				"id":                     id,
+				"user_id":                userID,
+				"level":                  level,
+				"status":                 status,
+				"submitted_at":           submittedAt,
+				"user_email":             email,
+				"user_name":              firstName + " " + lastName,
+				"face_match_score":       faceMatchScore.Float64,
+				"requires_manual_review": manualReview,
+				"screening_status":       screeningStatus,
 			})
 		}
 	}
 	
-	c.JSON(http.StatusOK, gin.H{"submissions": submissions})
+	c.JSON(http.StatusOK, gin.H{
+		"submissions": submissions,
+		"total":       total,
+		"limit":       limit,
+		"offset":      offset,
+	})
+}
+
+// parseSubmissionAge accepts Go durations ("36h", "90m") and whole days ("3d")
+func parseSubmissionAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age: %s", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age: %s", value)
+	}
+	return age, nil
 }
 
 func (s *Server) handleApproveKYC(c *gin.Context) {
@@ -437,9 +620,14 @@ func (s *Server) handleApproveKYC(c *gin.Context) {
 	if err == nil {
 		s.db.Exec(`
 			UPDATE users 
-			SET kyc_level = $1, kyc_verified_at = $2
+			SET kyc_level = $1, kyc_verified_at = $2, kyc_expired_at = NULL, kyc_level_before_expiry = NULL
 			WHERE id = $3
 		`, level, time.Now(), userID)
+		s.recordAuditLog(c, adminID, "KYC_APPROVE", "kyc_submission", submissionID, map[string]interface{}{
+			"user_id": userID,
+			"level":   level,
+		})
+		go s.notifyKYCApproval(userID, level)
 	}
 	
 	c.JSON(http.StatusOK, gin.H{"message": "KYC approved successfully"})
@@ -458,17 +646,29 @@ func (s *Server) handleRejectKYC(c *gin.Context) {
 	}
 	
 	// Update submission status
-	_, err := s.db.Exec(`
+	var userID string
+	err := s.db.QueryRow(`
 		UPDATE kyc_submissions 
 		SET status = 'REJECTED', reviewed_at = $1, reviewed_by = $2, rejection_reason = $3
 		WHERE id = $4
-	`, time.Now(), adminID, req.Reason, submissionID)
+		RETURNING user_id
+	`, time.Now(), adminID, req.Reason, submissionID).Scan(&userID)
 	
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject KYC"})
 		return
 	}
 	
+	s.recordAuditLog(c, adminID, "KYC_REJECT", "kyc_submission", submissionID, map[string]interface{}{
+		"user_id": userID,
+		"reason":  req.Reason,
+	})
+	go s.notifyKYCRejection(userID, req.Reason)
+	
 	c.JSON(http.StatusOK, gin.H{"message": "KYC rejected successfully"})
 }
 
@@ -509,40 +709,70 @@ func (s *Server) handleGetKYCLevels(c *gin.Context) {
 		},
 	}
 	
+	// Limits are shared with the wallet service through kyc_level_limits
+	rows, err := s.db.Query(`
+		SELECT kyc_level, limit_currency, COALESCE(monthly_limit, -1), COALESCE(daily_limit, -1), COALESCE(transaction_limit, -1)
+		FROM kyc_level_limits
+	`)
+	if err != nil {
+		requestLog(c).Printf("Error loading KYC level limits, using defaults: %v", err)
+	} else {
+		defer rows.Close()
+		for rows.Next() {
+			var level int
+			var currency string
+			var monthly, daily, perTx float64
+			if err := rows.Scan(&level, &currency, &monthly, &daily, &perTx); err != nil {
+				continue
+			}
+			for _, l := range levels {
+				if l["level"] == level {
+					l["limits"] = map[string]interface{}{
+						"monthly_volume": monthly,
+						"daily_volume":   daily,
+						"transaction":    perTx,
+						"currency":       currency,
+					}
+				}
+			}
+		}
+	}
+	
 	c.JSON(http.StatusOK, gin.H{"levels": levels})
 }
 
 func (s *Server) handleGetRequirements(c *gin.Context) {
-	level := c.Param("level")
-	
-	var requirements map[string]interface{}
-	switch level {
-	case "1":
-		requirements = map[string]interface{}{
-			"level":        1,
-			"documents":    []string{"CI"},
-			"information":  []string{"first_name", "last_name", "ci_number", "date_of_birth"},
-			"optional":     []string{"phone", "address"},
-		}
-	case "2":
-		requirements = map[string]interface{}{
-			"level":        2,
-			"documents":    []string{"CI", "SELFIE", "PROOF_ADDRESS"},
-			"information":  []string{"first_name", "last_name", "ci_number", "date_of_birth", "address", "city", "phone"},
-			"optional":     []string{"occupation"},
-		}
-	case "3":
-		requirements = map[string]interface{}{
-			"level":        3,
-			"documents":    []string{"CI", "SELFIE", "PROOF_ADDRESS"},
-			"information":  []string{"first_name", "last_name", "ci_number", "date_of_birth", "address", "city", "phone", "occupation", "income_source"},
-			"optional":     []string{"expected_volume", "pep_status"},
-		}
-	default:
+	level, _ := strconv.Atoi(c.Param("level"))
+	
+	requirements, ok := kycLevelRequirements[level]
+	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid KYC level"})
 		return
 	}
 	
+	rows, err := s.db.Query(`SELECT currency, min_kyc_level FROM kyc_currency_requirements ORDER BY currency`)
+	if err != nil {
+		log.Printf("Error loading KYC currency requirements: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load currency requirements"})
+		return
+	}
+	defer rows.Close()
+	
+	requirements.Currencies = []string{}
+	requirements.CurrencyRequirements = map[string]int{}
+	for rows.Next() {
+		var currency string
+		var minLevel int
+		if err := rows.Scan(&currency, &minLevel); err != nil {
+			log.Printf("Error scanning KYC currency requirement: %v", err)
+			continue
+		}
+		requirements.CurrencyRequirements[currency] = minLevel
+		if minLevel <= level {
+			requirements.Currencies = append(requirements.Currencies, currency)
+		}
+	}
+	
 	c.JSON(http.StatusOK, requirements)
 }
 
@@ -564,28 +794,99 @@ func (s *Server) handleVerifySelfie(c *gin.Context) {
 		return
 	}
 	
+	// Load the CI photo the selfie is compared against
+	var submissionID, documentID, documentPath string
+	err = s.db.QueryRow(`
+		SELECT kd.submission_id, kd.id, kd.file_path
+		FROM kyc_documents kd
+		JOIN kyc_submissions ks ON kd.submission_id = ks.id
+		WHERE ks.user_id = $1 AND kd.document_type = 'CI'
+		ORDER BY kd.created_at DESC
+		LIMIT 1
+	`, userID).Scan(&submissionID, &documentID, &documentPath)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload your CI document before the selfie"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load CI document"})
+		return
+	}
+	
+	if s.minioClient == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Document storage unavailable"})
+		return
+	}
+	
+	documentData, err := s.loadDocument(c, documentPath)
+	if err != nil {
+		requestLog(c).Printf("❌ KYC_FACE: Failed to read CI document %s: %v", documentPath, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load CI document"})
+		return
+	}
+	
 	// Save selfie
 	fileName := fmt.Sprintf("%s/selfie_%s.jpg", userID, uuid.New().String())
-	if s.minioClient != nil {
-		s.minioClient.PutObject(
-			c.Request.Context(),
-			"kyc-documents",
-			fileName,
-			bytes.NewReader(processedData),
-			int64(len(processedData)),
-			minio.PutObjectOptions{ContentType: "image/jpeg"},
-		)
+	_, err = s.minioClient.PutObject(
+		c.Request.Context(),
+		"kyc-documents",
+		fileName,
+		bytes.NewReader(processedData),
+		int64(len(processedData)),
+		minio.PutObjectOptions{ContentType: "image/jpeg"},
+	)
+	if err != nil {
+		requestLog(c).Printf("❌ KYC_FACE: Failed to store selfie for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store selfie"})
+		return
+	}
+	
+	threshold := faceMatchThreshold()
+	score, err := s.faceMatcher.Compare(processedData, documentData)
+	if err != nil {
+		requestLog(c).Printf("❌ KYC_FACE: Face comparison failed for user %s: %v", userID, err)
+		s.recordFaceVerification(userID, submissionID, documentID, fileName, 0, threshold, false, err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"verified":      false,
+			"manual_review": true,
+			"message":       "Face comparison unavailable, your submission will be reviewed manually",
+		})
+		return
 	}
 	
-	// Perform face verification (simulated)
-	verified := s.performFaceVerification(userID, processedData)
+	verified := score >= threshold
+	s.recordFaceVerification(userID, submissionID, documentID, fileName, score, threshold, verified, "")
+	requestLog(c).Printf("🙂 KYC_FACE: User %s selfie score %.3f (threshold %.2f, verified=%v)", userID, score, threshold, verified)
+	
+	if !verified {
+		c.JSON(http.StatusOK, gin.H{
+			"verified":      false,
+			"score":         score,
+			"threshold":     threshold,
+			"manual_review": true,
+			"message":       "Selfie does not match your CI photo, your submission will be reviewed manually",
+		})
+		return
+	}
 	
 	c.JSON(http.StatusOK, gin.H{
-		"verified": verified,
-		"message":  "Selfie verification completed",
+		"verified":  true,
+		"score":     score,
+		"threshold": threshold,
+		"message":   "Selfie verification completed",
 	})
 }
 
+// loadDocument reads a stored KYC document back from MinIO
+func (s *Server) loadDocument(c *gin.Context, path string) ([]byte, error) {
+	object, err := s.minioClient.GetObject(c.Request.Context(), "kyc-documents", path, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	
+	return io.ReadAll(object)
+}
+
 // Helper functions
 func (s *Server) validateCINumber(ci string) bool {
 	// Basic CI validation for Bolivia
@@ -643,57 +944,81 @@ func (s *Server) processImage(file io.Reader) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func (s *Server) performAutomaticVerification(submissionID string) {
+func (s *Server) performAutomaticVerification(requestID, submissionID string) {
 	// Simulate automatic verification process
 	time.Sleep(2 * time.Second)
 	
-	// Update status to under review
-	s.db.Exec(`
+	// Sanctions/PEP hits and self-declared PEPs are flagged for manual review
+	s.screenSubmission(requestID, submissionID)
+	
+	// Update status to under review; attempts after a rejection always get a manual review
+	_, err := s.db.Exec(`
 		UPDATE kyc_submissions 
-		SET status = 'UNDER_REVIEW' 
+		SET status = 'UNDER_REVIEW',
+			requires_manual_review = COALESCE(requires_manual_review, false) OR attempt_number > 1
 		WHERE id = $1
 	`, submissionID)
+	if err != nil {
+		taggedLog(requestID).Printf("❌ KYC: Failed to move submission %s to review: %v", submissionID, err)
+	}
 }
 
-func (s *Server) performOCR(docID string, imageData []byte) {
-	log.Printf("🔍 KYC_OCR: Starting OCR process for document ID: %s", docID)
-	log.Printf("🔍 KYC_OCR: Image data size: %d bytes", len(imageData))
+func (s *Server) performOCR(requestID, docID string, imageData []byte) {
+	logger := taggedLog(requestID)
+	logger.Printf("🔍 KYC_OCR: Starting OCR process for document ID: %s", docID)
+	logger.Printf("🔍 KYC_OCR: Image data size: %d bytes", len(imageData))
+	
+	s.db.Exec(`UPDATE kyc_documents SET status = 'PROCESSING' WHERE id = $1`, docID)
 	
-	// Simulate OCR processing
-	log.Printf("🔍 KYC_OCR: Simulating OCR processing (in production this would use real OCR service)")
-	ocrResults := map[string]string{
-		"full_name": "JUAN CARLOS PEREZ GONZALEZ",
-		"ci_number": "12345678",
-		"birth_date": "15/03/1990",
+	result, err := s.ocrService.ExtractFromCI(imageData)
+	if err != nil {
+		logger.Printf("❌ KYC_OCR: OCR extraction failed for document %s: %v", docID, err)
+		errorJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+		s.db.Exec(`
+			UPDATE kyc_documents 
+			SET status = 'FAILED', ocr_data = $1
+			WHERE id = $2
+		`, string(errorJSON), docID)
+		return
 	}
 	
-	ocrJSON, err := json.Marshal(ocrResults)
+	// Low confidence or unreadable fields go to manual review instead of being verified
+	status := "VERIFIED"
+	threshold := ocrConfidenceThreshold()
+	missing := missingCIFields(result)
+	if result.Confidence < threshold || len(missing) > 0 {
+		status = "NEEDS_REVIEW"
+		logger.Printf("⚠️ KYC_OCR: Document %s needs review - confidence %.2f (threshold %.2f), missing fields: %v",
+			docID, result.Confidence, threshold, missing)
+	}
+	
+	ocrJSON, err := json.Marshal(result)
 	if err != nil {
-		log.Printf("❌ KYC_OCR: Failed to marshal OCR results: %v", err)
+		logger.Printf("❌ KYC_OCR: Failed to marshal OCR results: %v", err)
 		return
 	}
-	log.Printf("✅ KYC_OCR: OCR processing completed - results: %s", string(ocrJSON))
+	logger.Printf("✅ KYC_OCR: OCR processing completed (%s) - fields: %v", result.Provider, result.Fields)
 	
-	log.Printf("🔍 KYC_OCR: Updating document status in database")
-	result, err := s.db.Exec(`
+	logger.Printf("🔍 KYC_OCR: Updating document status in database to %s", status)
+	dbResult, err := s.db.Exec(`
 		UPDATE kyc_documents 
-		SET status = 'VERIFIED', ocr_data = $1
-		WHERE id = $2
-	`, string(ocrJSON), docID)
+		SET status = $1, ocr_data = $2
+		WHERE id = $3
+	`, status, string(ocrJSON), docID)
 	
 	if err != nil {
-		log.Printf("❌ KYC_OCR: Failed to update document status: %v", err)
+		logger.Printf("❌ KYC_OCR: Failed to update document status: %v", err)
 		return
 	}
 	
-	rowsAffected, _ := result.RowsAffected()
-	log.Printf("✅ KYC_OCR: Document status updated successfully - rows affected: %d", rowsAffected)
-}
-
-func (s *Server) performFaceVerification(userID string, selfieData []byte) bool {
-	// Simulate face verification
-	// In production, this would use a face recognition service
-	return true
+	rowsAffected, _ := dbResult.RowsAffected()
+	logger.Printf("✅ KYC_OCR: Document status updated successfully - rows affected: %d", rowsAffected)
+	
+	if expiresAt := ocrExpiryDate(result); expiresAt != nil {
+		if err := s.recordDocumentExpiry(docID, *expiresAt); err != nil {
+			logger.Printf("⚠️ KYC_OCR: Failed to record expiry of document %s: %v", docID, err)
+		}
+	}
 }
 
 func contains(slice []string, item string) bool {
@@ -0,0 +1,43 @@
+// services/kyc/handlers_test.go
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestVerificationDataJSONEscapesInput(t *testing.T) {
+	submission := KYCSubmission{
+		FirstName:      `Ana "La Paz"`,
+		LastName:       `Quispe\Mamani`,
+		Address:        "Av. 6 de Agosto\n#123",
+		City:           `El Alto","pep_status":true,"x":"`,
+		Occupation:     "Comerciante <tienda> & co",
+		ExpectedVolume: 2500.5,
+	}
+
+	data, err := submission.verificationDataJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Quotes, backslashes and newlines stay inside their fields: nothing can inject a key
+	var decoded VerificationData
+	if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+		t.Fatalf("verification_data is not valid JSON: %v\n%s", err, data)
+	}
+	want := VerificationData{
+		FirstName:      submission.FirstName,
+		LastName:       submission.LastName,
+		Address:        submission.Address,
+		City:           submission.City,
+		Occupation:     submission.Occupation,
+		ExpectedVolume: submission.ExpectedVolume,
+	}
+	if decoded != want {
+		t.Errorf("decoded = %+v, want %+v", decoded, want)
+	}
+	if decoded.PEPStatus {
+		t.Error("pep_status injected through the city field")
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	_ "github.com/lib/pq"
+
+	"shared/dbpool"
 )
 
 type Server struct {
@@ -19,7 +21,10 @@ type Server struct {
 	redis       *redis.Client
 	router      *gin.Engine
 	minioClient *minio.Client
-	ocrService  *OCRService
+	ocrService  OCRService
+	faceMatcher FaceMatcher
+	screening   ScreeningProvider
+	events      *EventPublisher
 }
 
 func main() {
@@ -38,6 +43,7 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 	defer db.Close()
+	dbpool.Configure(db)
 
 	// Redis connection
 	redisClient := redis.NewClient(&redis.Options{
@@ -53,6 +59,11 @@ func main() {
 		log.Printf("Warning: MinIO connection failed: %v", err)
 	}
 
+	faceMatcher, err := NewFaceMatcher()
+	if err != nil {
+		log.Fatal("Failed to configure face matching: ", err)
+	}
+
 	// Create server
 	server := &Server{
 		db:          db,
@@ -60,11 +71,17 @@ func main() {
 		router:      gin.Default(),
 		minioClient: minioClient,
 		ocrService:  NewOCRService(),
+		faceMatcher: faceMatcher,
+		screening:   NewScreeningProvider(db),
+		events:      NewEventPublisher(),
 	}
 
 	// Setup routes
 	server.setupRoutes()
 
+	// Expire approvals whose identity documents have lapsed
+	go server.processDocumentExpiry()
+
 	// Start server
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -78,16 +95,21 @@ func main() {
 }
 
 func (s *Server) setupRoutes() {
-	// Health check
-	s.router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "healthy", "service": "kyc"})
-	})
+	setupMetrics(s.router, "kyc",
+		countGauge(s.db, "kyc_submissions_pending", "KYC submissions waiting for review.",
+			`SELECT COUNT(*) FROM kyc_submissions WHERE status IN ('PENDING', 'UNDER_REVIEW')`),
+	)
+	s.router.Use(requestIDMiddleware())
+
+	// Health checks
+	setupHealthRoutes(s.router, "kyc", databaseCheck(s.db), redisCheck(s.redis), s.events.healthCheck())
 
 	// KYC routes
 	api := s.router.Group("/api/v1")
 	{
 		// KYC submission
 		api.POST("/kyc/submit", s.authMiddleware(), s.handleSubmitKYC)
+		api.POST("/kyc/validate", s.authMiddleware(), s.handleValidateKYC)
 		api.GET("/kyc/status", s.authMiddleware(), s.handleGetKYCStatus)
 		api.POST("/kyc/upload-document", s.authMiddleware(), s.handleUploadDocument)
 		api.POST("/kyc/verify-selfie", s.authMiddleware(), s.handleVerifySelfie)
@@ -96,6 +118,8 @@ func (s *Server) setupRoutes() {
 		api.GET("/kyc/pending", s.adminMiddleware(), s.handleGetPendingKYC)
 		api.POST("/kyc/approve/:id", s.adminMiddleware(), s.handleApproveKYC)
 		api.POST("/kyc/reject/:id", s.adminMiddleware(), s.handleRejectKYC)
+		api.POST("/kyc/users/:id/allow-resubmission", s.adminMiddleware(), s.handleAllowKYCResubmission)
+		api.GET("/admin/users/:id/compliance-file", s.authMiddleware(), s.complianceMiddleware(), s.handleGetComplianceFile)
 		
 		// Verification levels
 		api.GET("/kyc/levels", s.handleGetKYCLevels)
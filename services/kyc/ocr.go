@@ -2,30 +2,82 @@
 package main
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
-type OCRService struct {
-	// In production, use Google Vision API or AWS Textract
-}
-
-func NewOCRService() *OCRService {
-	return &OCRService{}
+// OCRService extracts the identity fields printed on a Bolivian CI.
+// The implementation is selected with OCR_PROVIDER (mock, google_vision or tesseract).
+type OCRService interface {
+	ExtractFromCI(imageData []byte) (*OCRResult, error)
 }
 
 type OCRResult struct {
+	Provider   string            `json:"provider"`
 	Text       string            `json:"text"`
 	Fields     map[string]string `json:"fields"`
 	Confidence float64           `json:"confidence"`
 }
 
-func (o *OCRService) ExtractFromCI(imageData []byte) (*OCRResult, error) {
-	// Simplified OCR - in production use real OCR service
-	// This is a mock implementation
-	
+// Fields that must be read from a CI for the document to be verified automatically
+var requiredCIFields = []string{"ci_number", "first_name", "last_name", "birth_date"}
+
+const defaultOCRConfidenceThreshold = 0.80
+
+func NewOCRService() OCRService {
+	provider := strings.ToLower(os.Getenv("OCR_PROVIDER"))
+	endpoint := os.Getenv("OCR_ENDPOINT")
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	switch provider {
+	case "google_vision":
+		if endpoint == "" {
+			endpoint = "https://vision.googleapis.com/v1/images:annotate"
+		}
+		log.Printf("🔍 OCR provider: Google Vision")
+		return &GoogleVisionOCRService{endpoint: endpoint, apiKey: os.Getenv("OCR_API_KEY"), client: client}
+	case "tesseract":
+		if endpoint == "" {
+			endpoint = "http://tesseract:8884/ocr"
+		}
+		log.Printf("🔍 OCR provider: Tesseract (%s)", endpoint)
+		return &TesseractOCRService{endpoint: endpoint, client: client}
+	case "", "mock":
+		log.Printf("🔍 OCR provider: mock")
+		return &MockOCRService{}
+	default:
+		log.Printf("⚠️ Unknown OCR_PROVIDER %q, using mock", provider)
+		return &MockOCRService{}
+	}
+}
+
+// ocrConfidenceThreshold is the minimum confidence to verify a document without manual review
+func ocrConfidenceThreshold() float64 {
+	if value := os.Getenv("OCR_CONFIDENCE_THRESHOLD"); value != "" {
+		if threshold, err := strconv.ParseFloat(value, 64); err == nil && threshold >= 0 && threshold <= 1 {
+			return threshold
+		}
+		log.Printf("⚠️ Invalid OCR_CONFIDENCE_THRESHOLD %q, using %.2f", value, defaultOCRConfidenceThreshold)
+	}
+	return defaultOCRConfidenceThreshold
+}
+
+// MockOCRService returns fixed data, for development and tests
+type MockOCRService struct{}
+
+func (o *MockOCRService) ExtractFromCI(imageData []byte) (*OCRResult, error) {
 	result := &OCRResult{
+		Provider:   "mock",
 		Text:       "Mock OCR text",
 		Fields:     make(map[string]string),
 		Confidence: 0.95,
@@ -41,107 +93,231 @@ func (o *OCRService) ExtractFromCI(imageData []byte) (*OCRResult, error) {
 	return result, nil
 }
 
-func (o *OCRService) ValidateBolivianCI(ciNumber string, ocrResult *OCRResult) bool {
-	// Validate that CI number matches OCR result
-	if ocrResult.Fields["ci_number"] != ciNumber {
-		return false
-	}
-	
-	// Additional validations
-	return true
+// GoogleVisionOCRService calls the Vision API images:annotate endpoint with DOCUMENT_TEXT_DETECTION
+type GoogleVisionOCRService struct {
+	endpoint string
+	apiKey   string
+	client   *http.Client
 }
 
-func (s *Server) performOCRVerification(documentID string, imageData []byte) {
-	result, err := s.ocrService.ExtractFromCI(imageData)
+func (o *GoogleVisionOCRService) ExtractFromCI(imageData []byte) (*OCRResult, error) {
+	payload := map[string]interface{}{
+		"requests": []map[string]interface{}{
+			{
+				"image":    map[string]string{"content": base64.StdEncoding.EncodeToString(imageData)},
+				"features": []map[string]string{{"type": "DOCUMENT_TEXT_DETECTION"}},
+			},
+		},
+	}
+	body, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("OCR failed for document %s: %v", documentID, err)
-		return
+		return nil, err
 	}
-	
-	// Store OCR results
-	ocrJSON, _ := json.Marshal(result)
-	_, err = s.db.Exec(`
-		UPDATE kyc_documents
-		SET ocr_data = $1, status = 'VERIFIED'
-		WHERE id = $2
-	`, ocrJSON, documentID)
-	
+
+	url := o.endpoint
+	if o.apiKey != "" {
+		url += "?key=" + o.apiKey
+	}
+
+	resp, err := o.client.Post(url, "application/json", bytes.NewReader(body))
 	if err != nil {
-		log.Printf("Failed to store OCR results: %v", err)
+		return nil, fmt.Errorf("vision request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("vision returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var visionResp struct {
+		Responses []struct {
+			FullTextAnnotation struct {
+				Text  string `json:"text"`
+				Pages []struct {
+					Confidence float64 `json:"confidence"`
+				} `json:"pages"`
+			} `json:"fullTextAnnotation"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"responses"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&visionResp); err != nil {
+		return nil, fmt.Errorf("invalid vision response: %w", err)
 	}
+	if len(visionResp.Responses) == 0 {
+		return nil, fmt.Errorf("empty vision response")
+	}
+
+	annotation := visionResp.Responses[0]
+	if annotation.Error != nil {
+		return nil, fmt.Errorf("vision error: %s", annotation.Error.Message)
+	}
+
+	confidence := 0.0
+	for _, page := range annotation.FullTextAnnotation.Pages {
+		confidence += page.Confidence
+	}
+	if len(annotation.FullTextAnnotation.Pages) > 0 {
+		confidence /= float64(len(annotation.FullTextAnnotation.Pages))
+	}
+
+	text := annotation.FullTextAnnotation.Text
+	return &OCRResult{
+		Provider:   "google_vision",
+		Text:       text,
+		Fields:     parseCIFields(text),
+		Confidence: confidence,
+	}, nil
 }
 
-func (s *Server) compareFaces(selfieData []byte, ciPhotoPath string) float64 {
-	// Simplified face comparison
-	// In production, use AWS Rekognition, Azure Face API, or similar
-	
-	// Mock implementation - returns random score for demo
-	return 0.85 + (float64(len(selfieData)%10) / 100)
+// TesseractOCRService posts the raw image to a self-hosted Tesseract HTTP wrapper that
+// answers with {"text": "...", "confidence": 0-100}
+type TesseractOCRService struct {
+	endpoint string
+	client   *http.Client
 }
 
-func (s *Server) performOCRAutomaticVerification(submissionID string) {
-	// Automatic verification checks
-	time.Sleep(2 * time.Second) // Simulate processing
-	
-	// Get submission details
-	var userID string
-	var verificationData string
-	err := s.db.QueryRow(`
-		SELECT user_id, verification_data FROM kyc_submissions
-		WHERE id = $1
-	`, submissionID).Scan(&userID, &verificationData)
-	
+func (o *TesseractOCRService) ExtractFromCI(imageData []byte) (*OCRResult, error) {
+	req, err := http.NewRequest(http.MethodPost, o.endpoint, bytes.NewReader(imageData))
 	if err != nil {
-		return
+		return nil, err
 	}
-	
-	// Parse verification data to get CI number
-	var data map[string]interface{}
-	json.Unmarshal([]byte(verificationData), &data)
-	
-	ciNumber := ""
-	if ci, ok := data["ci_number"].(string); ok {
-		ciNumber = ci
+	req.Header.Set("Content-Type", "image/jpeg")
+	req.Header.Set("X-OCR-Language", "spa")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("tesseract request failed: %w", err)
 	}
-	
-	// Check against blacklists
-	if s.checkBlacklist(ciNumber) {
-		s.db.Exec(`
-			UPDATE kyc_submissions
-			SET status = 'REJECTED', rejection_reason = 'Failed security check'
-			WHERE id = $1
-		`, submissionID)
-		return
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("tesseract returned status %d: %s", resp.StatusCode, string(respBody))
 	}
-	
-	// Update to under review for manual verification
-	s.db.Exec(`
-		UPDATE kyc_submissions
-		SET status = 'UNDER_REVIEW'
-		WHERE id = $1
-	`, submissionID)
+
+	var tesseractResp struct {
+		Text       string  `json:"text"`
+		Confidence float64 `json:"confidence"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tesseractResp); err != nil {
+		return nil, fmt.Errorf("invalid tesseract response: %w", err)
+	}
+
+	// Tesseract reports mean word confidence on a 0-100 scale
+	confidence := tesseractResp.Confidence
+	if confidence > 1 {
+		confidence /= 100
+	}
+
+	return &OCRResult{
+		Provider:   "tesseract",
+		Text:       tesseractResp.Text,
+		Fields:     parseCIFields(tesseractResp.Text),
+		Confidence: confidence,
+	}, nil
 }
 
-func (s *Server) checkBlacklist(ciNumber string) bool {
-	// Simulate blacklist check
-	// In production, this would check against real blacklist database
-	blacklistedCIs := []string{"12345678", "87654321", "11111111"}
-	
-	for _, blocked := range blacklistedCIs {
-		if blocked == ciNumber {
-			return true
+var (
+	ciNumberPattern  = regexp.MustCompile(`(?i)(?:C\.?\s*I\.?|N[°ºO]?\.?)\s*[:.]?\s*(\d{5,10})(?:\s*-?\s*(LP|CB|SC|OR|PT|CH|TJ|BE|PD))?`)
+	birthDatePattern = regexp.MustCompile(`(?i)NAC[A-Z]*[^0-9]{0,40}(\d{1,2})[/.\- ](\d{1,2}|[A-Z]{3,10})[/.\- ](\d{4})`)
+	anyDatePattern   = regexp.MustCompile(`(\d{2})[/.\-](\d{2})[/.\-](\d{4})`)
+	expiryPattern    = regexp.MustCompile(`(?i)(?:VENC|EXPIRA|VALID)[A-Z]*[^0-9]{0,40}(\d{1,2})[/.\- ](\d{1,2})[/.\- ](\d{4})`)
+	namePattern      = regexp.MustCompile(`(?i)^\s*(NOMBRES?|APELLIDOS?)\s*[:.]?\s*(.*)$`)
+)
+
+// parseCIFields pulls ci_number, first_name, last_name, birth_date and expiry_date out of the raw text of a CI.
+// Fields that cannot be found are left out so the caller can send the document to review.
+func parseCIFields(text string) map[string]string {
+	fields := make(map[string]string)
+
+	if match := ciNumberPattern.FindStringSubmatch(text); match != nil {
+		fields["ci_number"] = match[1]
+		if match[2] != "" {
+			fields["expedition"] = strings.ToUpper(match[2])
+		}
+	}
+
+	if match := birthDatePattern.FindStringSubmatch(text); match != nil {
+		day := match[1]
+		if len(day) == 1 {
+			day = "0" + day
+		}
+		fields["birth_date"] = fmt.Sprintf("%s/%s/%s", day, strings.ToUpper(match[2]), match[3])
+	} else if match := anyDatePattern.FindStringSubmatch(text); match != nil {
+		fields["birth_date"] = fmt.Sprintf("%s/%s/%s", match[1], match[2], match[3])
+	}
+
+	if match := expiryPattern.FindStringSubmatch(text); match != nil {
+		day, month := match[1], match[2]
+		if len(day) == 1 {
+			day = "0" + day
+		}
+		if len(month) == 1 {
+			month = "0" + month
+		}
+		fields["expiry_date"] = fmt.Sprintf("%s/%s/%s", day, month, match[3])
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		match := namePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		// The value is either on the same line as the label or on the next one
+		value := strings.TrimSpace(match[2])
+		if value == "" && i+1 < len(lines) {
+			value = strings.TrimSpace(lines[i+1])
+		}
+		if value == "" {
+			continue
+		}
+
+		if strings.HasPrefix(strings.ToUpper(match[1]), "NOMBRE") {
+			fields["first_name"] = strings.ToUpper(value)
+		} else {
+			fields["last_name"] = strings.ToUpper(value)
+		}
+	}
+
+	return fields
+}
+
+// missingCIFields lists the required fields the OCR could not read
+func missingCIFields(result *OCRResult) []string {
+	var missing []string
+	for _, field := range requiredCIFields {
+		if result.Fields[field] == "" {
+			missing = append(missing, field)
 		}
 	}
+	return missing
+}
+
+func validateBolivianCI(ciNumber string, ocrResult *OCRResult) bool {
+	// Validate that CI number matches OCR result
+	if ocrResult.Fields["ci_number"] != ciNumber {
+		return false
+	}
 	
-	return false
+	// Additional validations
+	return true
 }
 
 func (s *Server) notifyKYCApproval(userID string, level int) {
-	// Send email/SMS notification
 	log.Printf("Notifying user %s of KYC approval (level %d)", userID, level)
+	s.events.Publish("kyc.approved", userID,
+		fmt.Sprintf("Your identity verification was approved: you are now KYC level %d", level),
+		map[string]interface{}{"level": level})
 }
 
 func (s *Server) notifyKYCRejection(userID string, reason string) {
-	// Send email/SMS notification
 	log.Printf("Notifying user %s of KYC rejection: %s", userID, reason)
+	s.events.Publish("kyc.rejected", userID,
+		fmt.Sprintf("Your identity verification was rejected: %s", reason),
+		map[string]interface{}{"reason": reason})
 }
\ No newline at end of file
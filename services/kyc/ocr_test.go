@@ -0,0 +1,166 @@
+// services/kyc/ocr_test.go
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// stubOCRService returns a canned result or error
+type stubOCRService struct {
+	result *OCRResult
+	err    error
+}
+
+func (o *stubOCRService) ExtractFromCI(imageData []byte) (*OCRResult, error) {
+	return o.result, o.err
+}
+
+// ocrDataArg matches the stored ocr_data when it decodes to the given fields
+type ocrDataArg map[string]string
+
+func (a ocrDataArg) Match(v driver.Value) bool {
+	var stored struct {
+		Fields map[string]string `json:"fields"`
+		Error  string            `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(v.(string)), &stored); err != nil {
+		return false
+	}
+	if a["error"] != "" {
+		return stored.Error == a["error"]
+	}
+	for key, value := range a {
+		if stored.Fields[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMockOCRServiceReadsEveryRequiredField(t *testing.T) {
+	result, err := (&MockOCRService{}).ExtractFromCI([]byte("image"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missing := missingCIFields(result); len(missing) > 0 {
+		t.Errorf("missing fields %v in %+v", missing, result.Fields)
+	}
+	if result.Provider != "mock" || result.Confidence < defaultOCRConfidenceThreshold {
+		t.Errorf("result = %+v, want a mock result above the default threshold", result)
+	}
+	if !validateBolivianCI("7654321", result) || validateBolivianCI("1234567", result) {
+		t.Error("validateBolivianCI does not compare against the CI number read by the mock")
+	}
+}
+
+func TestNewOCRServiceSelectsProvider(t *testing.T) {
+	tests := map[string]string{
+		"":              "*main.MockOCRService",
+		"mock":          "*main.MockOCRService",
+		"google_vision": "*main.GoogleVisionOCRService",
+		"TESSERACT":     "*main.TesseractOCRService",
+		"unknown":       "*main.MockOCRService",
+	}
+	for provider, want := range tests {
+		t.Setenv("OCR_PROVIDER", provider)
+		if got := fmt.Sprintf("%T", NewOCRService()); got != want {
+			t.Errorf("OCR_PROVIDER=%q built %s, want %s", provider, got, want)
+		}
+	}
+}
+
+func TestPerformOCRStoresResultAndStatus(t *testing.T) {
+	mockFields := ocrDataArg{"ci_number": "7654321", "first_name": "JUAN", "last_name": "PEREZ GONZALEZ"}
+
+	tests := []struct {
+		name       string
+		service    OCRService
+		threshold  string
+		wantStatus string
+		wantData   ocrDataArg
+	}{
+		{name: "mock above the threshold", service: &MockOCRService{}, wantStatus: "VERIFIED", wantData: mockFields},
+		{name: "mock below a stricter threshold", service: &MockOCRService{}, threshold: "0.99",
+			wantStatus: "NEEDS_REVIEW", wantData: mockFields},
+		{name: "a required field unreadable", service: &stubOCRService{result: &OCRResult{Provider: "stub", Confidence: 0.99,
+			Fields: map[string]string{"ci_number": "7654321", "first_name": "JUAN", "last_name": "PEREZ"}}},
+			wantStatus: "NEEDS_REVIEW", wantData: ocrDataArg{"ci_number": "7654321"}},
+		{name: "provider error", service: &stubOCRService{err: errors.New("timeout")},
+			wantStatus: "FAILED", wantData: ocrDataArg{"error": "timeout"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OCR_CONFIDENCE_THRESHOLD", tt.threshold)
+
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectExec(`UPDATE kyc_documents SET status = 'PROCESSING'`).WithArgs("doc-1").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			if tt.wantStatus == "FAILED" {
+				mock.ExpectExec(`SET status = 'FAILED', ocr_data = \$1`).WithArgs(tt.wantData, "doc-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			} else {
+				mock.ExpectExec(`SET status = \$1, ocr_data = \$2`).WithArgs(tt.wantStatus, tt.wantData, "doc-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			(&Server{db: db, ocrService: tt.service}).performOCR("req-1", "doc-1", []byte("image"))
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestTesseractOCRServiceParsesCI(t *testing.T) {
+	text := "ESTADO PLURINACIONAL DE BOLIVIA\nC.I. 7654321 LP\nNOMBRES:\nJuan Carlos\nAPELLIDOS: Perez Gonzalez\n" +
+		"FECHA DE NACIMIENTO 15/03/1990\nVENCIMIENTO 20/08/2030"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "image" || r.Header.Get("X-OCR-Language") != "spa" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"text": text, "confidence": 91})
+	}))
+	defer server.Close()
+
+	result, err := (&TesseractOCRService{endpoint: server.URL, client: server.Client()}).ExtractFromCI([]byte("image"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"ci_number":   "7654321",
+		"expedition":  "LP",
+		"first_name":  "JUAN CARLOS",
+		"last_name":   "PEREZ GONZALEZ",
+		"birth_date":  "15/03/1990",
+		"expiry_date": "20/08/2030",
+	}
+	for field, value := range want {
+		if result.Fields[field] != value {
+			t.Errorf("%s = %q, want %q", field, result.Fields[field], value)
+		}
+	}
+	// Tesseract's 0-100 confidence is scaled to 0-1
+	if result.Confidence != 0.91 {
+		t.Errorf("confidence = %v, want 0.91", result.Confidence)
+	}
+}
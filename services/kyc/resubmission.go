@@ -0,0 +1,167 @@
+// services/kyc/resubmission.go
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Resubmission limits: after a rejection a user has to wait KYC_RESUBMIT_COOLDOWN_HOURS (default
+// 24) before submitting again, and after KYC_MAX_REJECTED_ATTEMPTS rejections (default 3) they
+// cannot submit at all. Either can be disabled with 0. An admin can let a user through once with
+// POST /kyc/users/:id/allow-resubmission. Every new submission records its attempt number, and
+// any attempt after a rejection goes to manual review instead of the automatic checks.
+
+const (
+	defaultMaxRejectedAttempts = 3
+	defaultResubmitCooldown    = 24 * time.Hour
+)
+
+type ResubmissionPolicy struct {
+	MaxRejected int
+	Cooldown    time.Duration
+}
+
+func resubmissionPolicy() ResubmissionPolicy {
+	policy := ResubmissionPolicy{MaxRejected: defaultMaxRejectedAttempts, Cooldown: defaultResubmitCooldown}
+	if value, err := strconv.Atoi(os.Getenv("KYC_MAX_REJECTED_ATTEMPTS")); err == nil && value >= 0 {
+		policy.MaxRejected = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("KYC_RESUBMIT_COOLDOWN_HOURS")); err == nil && value >= 0 {
+		policy.Cooldown = time.Duration(value) * time.Hour
+	}
+	return policy
+}
+
+// ResubmissionCheck is the outcome of checking a new submission against the policy
+type ResubmissionCheck struct {
+	Rejections     int
+	LastRejectedAt *time.Time
+	Allowed        bool
+	Code           string
+	RetryAfter     time.Duration
+	OverrideID     string
+}
+
+// evaluate applies the policy to a user's rejection history as of now
+func (p ResubmissionPolicy) evaluate(rejections int, lastRejectedAt *time.Time, now time.Time) ResubmissionCheck {
+	check := ResubmissionCheck{Rejections: rejections, LastRejectedAt: lastRejectedAt, Allowed: true}
+	if p.MaxRejected > 0 && rejections >= p.MaxRejected {
+		check.Allowed = false
+		check.Code = "KYC_ATTEMPTS_EXHAUSTED"
+		return check
+	}
+	if p.Cooldown > 0 && lastRejectedAt != nil {
+		if wait := lastRejectedAt.Add(p.Cooldown).Sub(now); wait > 0 {
+			check.Allowed = false
+			check.Code = "KYC_RESUBMIT_COOLDOWN"
+			check.RetryAfter = wait
+		}
+	}
+	return check
+}
+
+// checkResubmission counts the user's rejected submissions and applies the policy, letting an
+// unused admin override through
+func (s *Server) checkResubmission(userID string) (ResubmissionCheck, error) {
+	var rejections int
+	var lastRejectedAt sql.NullTime
+	var overrideID sql.NullString
+	err := s.db.QueryRow(`
+		SELECT COUNT(*), MAX(COALESCE(ks.reviewed_at, ks.submitted_at)),
+			(SELECT id::text FROM kyc_resubmission_overrides WHERE user_id = $1 AND used_at IS NULL)
+		FROM kyc_submissions ks
+		WHERE ks.user_id = $1 AND ks.status = 'REJECTED'
+	`, userID).Scan(&rejections, &lastRejectedAt, &overrideID)
+	if err != nil {
+		return ResubmissionCheck{}, err
+	}
+
+	var last *time.Time
+	if lastRejectedAt.Valid {
+		last = &lastRejectedAt.Time
+	}
+	check := resubmissionPolicy().evaluate(rejections, last, time.Now())
+	if !check.Allowed && overrideID.Valid {
+		check.Allowed = true
+		check.OverrideID = overrideID.String
+	}
+	return check, nil
+}
+
+// consumeResubmissionOverride marks the override used by the submission it let through
+func (s *Server) consumeResubmissionOverride(overrideID, submissionID string) error {
+	_, err := s.db.Exec(`
+		UPDATE kyc_resubmission_overrides SET used_at = NOW(), submission_id = $2
+		WHERE id = $1 AND used_at IS NULL
+	`, overrideID, submissionID)
+	return err
+}
+
+func respondResubmissionDenied(c *gin.Context, check ResubmissionCheck) {
+	response := gin.H{
+		"code":       check.Code,
+		"rejections": check.Rejections,
+	}
+	if check.Code == "KYC_RESUBMIT_COOLDOWN" {
+		retryAfter := int(check.RetryAfter.Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		response["error"] = fmt.Sprintf("Your last KYC submission was rejected; you can submit again in %s",
+			check.RetryAfter.Round(time.Minute))
+		response["retry_after"] = retryAfter
+		response["retry_at"] = check.LastRejectedAt.Add(resubmissionPolicy().Cooldown)
+	} else {
+		response["error"] = "Maximum number of KYC attempts reached; please contact support"
+	}
+	c.JSON(http.StatusTooManyRequests, response)
+}
+
+// handleAllowKYCResubmission lets the user submit once more regardless of the limits
+func (s *Server) handleAllowKYCResubmission(c *gin.Context) {
+	userID := c.Param("id")
+	adminID := c.GetString("user_id")
+
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var overrideID string
+	err := s.db.QueryRow(`
+		INSERT INTO kyc_resubmission_overrides (user_id, granted_by, reason)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, userID, adminID, req.Reason).Scan(&overrideID)
+	if pqErr, ok := err.(*pq.Error); ok {
+		switch pqErr.Code {
+		case "23505":
+			c.JSON(http.StatusConflict, gin.H{"error": "The user already has an unused resubmission override"})
+			return
+		case "23503", "22P02":
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+	}
+	if err != nil {
+		requestLog(c).Printf("Error granting KYC resubmission to user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to allow resubmission"})
+		return
+	}
+
+	s.recordAuditLog(c, adminID, "KYC_ALLOW_RESUBMISSION", "user", userID, map[string]interface{}{
+		"override_id": overrideID,
+		"reason":      req.Reason,
+	})
+	requestLog(c).Printf("🔓 KYC: Admin %s allowed user %s to resubmit: %s", adminID, userID, req.Reason)
+	c.JSON(http.StatusCreated, gin.H{"override_id": overrideID, "user_id": userID})
+}
@@ -0,0 +1,131 @@
+// services/kyc/resubmission_test.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+func TestResubmissionPolicyBoundaries(t *testing.T) {
+	policy := ResubmissionPolicy{MaxRejected: 3, Cooldown: 24 * time.Hour}
+	now := time.Now()
+	ago := func(d time.Duration) *time.Time {
+		at := now.Add(-d)
+		return &at
+	}
+
+	tests := []struct {
+		name           string
+		rejections     int
+		lastRejectedAt *time.Time
+		wantCode       string // empty when the submission is allowed
+		wantRetryAfter time.Duration
+	}{
+		{name: "first submission", rejections: 0},
+		{name: "one second before the cooldown ends", rejections: 1, lastRejectedAt: ago(24*time.Hour - time.Second),
+			wantCode: "KYC_RESUBMIT_COOLDOWN", wantRetryAfter: time.Second},
+		{name: "cooldown just ended", rejections: 1, lastRejectedAt: ago(24 * time.Hour)},
+		{name: "last attempt before the maximum", rejections: 2, lastRejectedAt: ago(48 * time.Hour)},
+		{name: "maximum rejections reached", rejections: 3, lastRejectedAt: ago(48 * time.Hour),
+			wantCode: "KYC_ATTEMPTS_EXHAUSTED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := policy.evaluate(tt.rejections, tt.lastRejectedAt, now)
+			if check.Allowed != (tt.wantCode == "") || check.Code != tt.wantCode || check.RetryAfter != tt.wantRetryAfter {
+				t.Errorf("evaluate() = %+v, want code %q retrying after %s", check, tt.wantCode, tt.wantRetryAfter)
+			}
+		})
+	}
+
+	disabled := ResubmissionPolicy{}
+	if check := disabled.evaluate(10, ago(time.Minute), now); !check.Allowed {
+		t.Errorf("evaluate() with both limits disabled = %+v, want allowed", check)
+	}
+}
+
+func TestSubmitKYCEnforcesResubmissionLimits(t *testing.T) {
+	t.Setenv("KYC_MAX_REJECTED_ATTEMPTS", "3")
+	t.Setenv("KYC_RESUBMIT_COOLDOWN_HOURS", "24")
+
+	tests := []struct {
+		name          string
+		rejections    int64
+		lastRejection time.Duration // how long ago
+		override      interface{}
+		wantCode      string
+	}{
+		{name: "inside the cooldown", rejections: 1, lastRejection: 2 * time.Hour, wantCode: "KYC_RESUBMIT_COOLDOWN"},
+		{name: "out of attempts", rejections: 3, lastRejection: 72 * time.Hour, wantCode: "KYC_ATTEMPTS_EXHAUSTED"},
+		{name: "admin override", rejections: 3, lastRejection: time.Hour, override: "override-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(`WHERE user_id = \$1 AND status IN \('UNDER_REVIEW', 'PENDING'\)`).WithArgs("user-1").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectQuery(`FROM kyc_submissions ks\s+WHERE ks.user_id = \$1 AND ks.status = 'REJECTED'`).WithArgs("user-1").
+				WillReturnRows(sqlmock.NewRows([]string{"count", "max", "override"}).
+					AddRow(tt.rejections, time.Now().Add(-tt.lastRejection), tt.override))
+			if tt.override != nil {
+				// The fourth attempt is recorded and uses up the override; failing the insert stops the test there
+				mock.ExpectExec(`INSERT INTO kyc_submissions`).
+					WithArgs(sqlmock.AnyArg(), "user-1", 1, "PENDING", sqlmock.AnyArg(), sqlmock.AnyArg(), 4, nil).
+					WillReturnError(errors.New("insert failed"))
+			}
+
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/kyc/submit",
+				strings.NewReader(`{"kyc_level":1,"first_name":"Ana","last_name":"Quispe","ci_number":"1234567"}`))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Set("user_id", "user-1")
+			(&Server{db: db}).handleSubmitKYC(c)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+			if tt.wantCode == "" {
+				if w.Code == http.StatusTooManyRequests {
+					t.Errorf("status = 429 despite the override: %s", w.Body.String())
+				}
+				return
+			}
+
+			var response struct {
+				Code       string `json:"code"`
+				RetryAfter int    `json:"retry_after"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			if w.Code != http.StatusTooManyRequests || response.Code != tt.wantCode {
+				t.Fatalf("response = %d %s, want 429 %s", w.Code, w.Body.String(), tt.wantCode)
+			}
+			if tt.wantCode == "KYC_RESUBMIT_COOLDOWN" {
+				// 22 hours left, reported in seconds in the body and the Retry-After header
+				header, _ := strconv.Atoi(w.Header().Get("Retry-After"))
+				if remaining := 22 * 60 * 60; response.RetryAfter < remaining-5 || response.RetryAfter > remaining+1 ||
+					header != response.RetryAfter {
+					t.Errorf("retry_after = %d (header %q), want about %d seconds", response.RetryAfter,
+						w.Header().Get("Retry-After"), remaining)
+				}
+			}
+		})
+	}
+}
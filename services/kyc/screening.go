@@ -0,0 +1,286 @@
+// services/kyc/screening.go
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Sanctions/PEP screening: every submission's name and CI are checked against the lists of the
+// provider selected with SCREENING_PROVIDER: table (default, kyc_screening_entries), http (an
+// external screening API at SCREENING_ENDPOINT) or mock. A hit, a self-declared PEP or a provider
+// failure never lets the submission through on its own: screening_status becomes NEEDS_REVIEW,
+// the matched entries are kept in screening_matches and the submission goes to manual review.
+
+// Screening outcomes stored in kyc_submissions.screening_status
+const (
+	screeningClear       = "CLEAR"
+	screeningNeedsReview = "NEEDS_REVIEW"
+)
+
+type ScreeningSubject struct {
+	FullName    string `json:"name"`
+	CINumber    string `json:"ci_number"`
+	DateOfBirth string `json:"date_of_birth,omitempty"`
+}
+
+type ScreeningMatch struct {
+	EntryID   string  `json:"entry_id"`
+	ListName  string  `json:"list_name"`
+	Category  string  `json:"category"`
+	Name      string  `json:"name"`
+	MatchedOn string  `json:"matched_on"`
+	Score     float64 `json:"score"`
+}
+
+// ScreeningProvider returns the list entries the subject matches
+type ScreeningProvider interface {
+	Name() string
+	Screen(subject ScreeningSubject) ([]ScreeningMatch, error)
+}
+
+func NewScreeningProvider(db *sql.DB) ScreeningProvider {
+	provider := strings.ToLower(os.Getenv("SCREENING_PROVIDER"))
+
+	switch provider {
+	case "", "table":
+		log.Printf("🛡️ Screening provider: table")
+		return &TableScreeningProvider{db: db}
+	case "http":
+		endpoint := os.Getenv("SCREENING_ENDPOINT")
+		if endpoint == "" {
+			log.Printf("⚠️ SCREENING_ENDPOINT not set, using the screening table")
+			return &TableScreeningProvider{db: db}
+		}
+		log.Printf("🛡️ Screening provider: http (%s)", endpoint)
+		return &HTTPScreeningProvider{
+			endpoint: endpoint,
+			apiKey:   os.Getenv("SCREENING_API_KEY"),
+			client:   &http.Client{Timeout: 15 * time.Second},
+		}
+	case "mock":
+		log.Printf("🛡️ Screening provider: mock")
+		return &MockScreeningProvider{}
+	default:
+		log.Printf("⚠️ Unknown SCREENING_PROVIDER %q, using the screening table", provider)
+		return &TableScreeningProvider{db: db}
+	}
+}
+
+// Lists often print names without accents or Ñ
+var screeningAccents = strings.NewReplacer("Á", "A", "É", "E", "Í", "I", "Ó", "O", "Ú", "U", "Ü", "U", "Ñ", "N")
+
+// screeningTokens upper-cases the name, drops accents and splits it into words of A-Z letters,
+// the same normalization as kyc_screening_entries.name_tokens
+func screeningTokens(name string) []string {
+	upper := screeningAccents.Replace(strings.ToUpper(name))
+	return strings.FieldsFunc(upper, func(r rune) bool { return r < 'A' || r > 'Z' })
+}
+
+// nameMatchScore is the share of the longer name's words found in the other one; names only
+// match when every word of the shorter one, at least two, appears in the longer one, since
+// lists and documents often drop a second surname or middle name
+func nameMatchScore(a, b []string) float64 {
+	short, long := a, b
+	if len(short) > len(long) {
+		short, long = long, short
+	}
+	if len(short) < 2 {
+		return 0
+	}
+
+	words := make(map[string]int)
+	for _, word := range long {
+		words[word]++
+	}
+	for _, word := range short {
+		if words[word] == 0 {
+			return 0
+		}
+		words[word]--
+	}
+	return float64(len(short)) / float64(len(long))
+}
+
+// normalizeCI keeps the digits of a CI number, dropping the complement and expedition
+func normalizeCI(ci string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, ci)
+}
+
+// TableScreeningProvider screens against the active entries of kyc_screening_entries
+type TableScreeningProvider struct {
+	db *sql.DB
+}
+
+func (p *TableScreeningProvider) Name() string { return "table" }
+
+func (p *TableScreeningProvider) Screen(subject ScreeningSubject) ([]ScreeningMatch, error) {
+	tokens := screeningTokens(subject.FullName)
+	ci := normalizeCI(subject.CINumber)
+
+	rows, err := p.db.Query(`
+		SELECT id, list_name, category, full_name, name_tokens, COALESCE(ci_number, '')
+		FROM kyc_screening_entries
+		WHERE active AND (name_tokens && $1 OR (ci_number <> '' AND regexp_replace(ci_number, '[^0-9]', '', 'g') = $2))
+	`, pq.Array(tokens), ci)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []ScreeningMatch
+	for rows.Next() {
+		var match ScreeningMatch
+		var entryTokens []string
+		var entryCI string
+		if err := rows.Scan(&match.EntryID, &match.ListName, &match.Category, &match.Name,
+			pq.Array(&entryTokens), &entryCI); err != nil {
+			return nil, err
+		}
+
+		if ci != "" && normalizeCI(entryCI) == ci {
+			match.MatchedOn = "CI"
+			match.Score = 1
+		} else if score := nameMatchScore(tokens, entryTokens); score > 0 {
+			match.MatchedOn = "NAME"
+			match.Score = score
+		} else {
+			continue
+		}
+		matches = append(matches, match)
+	}
+	return matches, rows.Err()
+}
+
+// HTTPScreeningProvider posts the subject to a screening API and expects
+// {"matches": [{"entry_id", "list_name", "category", "name", "matched_on", "score"}]} back
+type HTTPScreeningProvider struct {
+	endpoint string
+	apiKey   string
+	client   *http.Client
+}
+
+func (p *HTTPScreeningProvider) Name() string { return "http" }
+
+func (p *HTTPScreeningProvider) Screen(subject ScreeningSubject) ([]ScreeningMatch, error) {
+	payload, err := json.Marshal(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("screening request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("screening returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		Matches []ScreeningMatch `json:"matches"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid screening response: %w", err)
+	}
+	return result.Matches, nil
+}
+
+// MockScreeningProvider flags anyone whose name contains SANCTIONED or whose CI is 00000000, for
+// development and tests
+type MockScreeningProvider struct{}
+
+func (p *MockScreeningProvider) Name() string { return "mock" }
+
+func (p *MockScreeningProvider) Screen(subject ScreeningSubject) ([]ScreeningMatch, error) {
+	if normalizeCI(subject.CINumber) == "00000000" {
+		return []ScreeningMatch{{EntryID: "mock-ci", ListName: "MOCK", Category: "SANCTIONS",
+			Name: subject.FullName, MatchedOn: "CI", Score: 1}}, nil
+	}
+	for _, token := range screeningTokens(subject.FullName) {
+		if token == "SANCTIONED" {
+			return []ScreeningMatch{{EntryID: "mock-name", ListName: "MOCK", Category: "SANCTIONS",
+				Name: subject.FullName, MatchedOn: "NAME", Score: 1}}, nil
+		}
+	}
+	return nil, nil
+}
+
+// screenSubmission screens the applicant of a submission and records the outcome; anything but a
+// clear result sends the submission to manual review
+func (s *Server) screenSubmission(requestID, submissionID string) {
+	logger := taggedLog(requestID)
+
+	var verificationData string
+	err := s.db.QueryRow(`
+		SELECT COALESCE(verification_data::text, '{}') FROM kyc_submissions WHERE id = $1
+	`, submissionID).Scan(&verificationData)
+	if err != nil {
+		logger.Printf("❌ KYC_SCREENING: Failed to load submission %s: %v", submissionID, err)
+		return
+	}
+
+	var data VerificationData
+	json.Unmarshal([]byte(verificationData), &data)
+	subject := ScreeningSubject{
+		FullName:    strings.TrimSpace(data.FirstName + " " + data.LastName),
+		CINumber:    data.CINumber,
+		DateOfBirth: data.DateOfBirth,
+	}
+
+	status := screeningClear
+	matches, err := s.screening.Screen(subject)
+	if err != nil {
+		logger.Printf("⚠️ KYC_SCREENING: Provider %s failed for submission %s, sending it to review: %v",
+			s.screening.Name(), submissionID, err)
+		status = screeningNeedsReview
+	}
+	if len(matches) > 0 {
+		logger.Printf("🚩 KYC_SCREENING: Submission %s matched %d sanctions/PEP entries", submissionID, len(matches))
+		status = screeningNeedsReview
+	}
+	if data.PEPStatus {
+		logger.Printf("🚩 KYC_SCREENING: Submission %s declares a politically exposed person", submissionID)
+		status = screeningNeedsReview
+	}
+
+	if matches == nil {
+		matches = []ScreeningMatch{}
+	}
+	matchesJSON, _ := json.Marshal(matches)
+	_, err = s.db.Exec(`
+		UPDATE kyc_submissions
+		SET screening_status = $2, screening_matches = $3, screening_provider = $4, screened_at = NOW(),
+			requires_manual_review = COALESCE(requires_manual_review, false) OR $2 = 'NEEDS_REVIEW'
+		WHERE id = $1
+	`, submissionID, status, string(matchesJSON), s.screening.Name())
+	if err != nil {
+		logger.Printf("❌ KYC_SCREENING: Failed to record screening of submission %s: %v", submissionID, err)
+	}
+}
@@ -0,0 +1,114 @@
+// services/kyc/screening_test.go
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// failingScreeningProvider stands in for a screening API that is down
+type failingScreeningProvider struct{}
+
+func (p failingScreeningProvider) Name() string { return "failing" }
+
+func (p failingScreeningProvider) Screen(subject ScreeningSubject) ([]ScreeningMatch, error) {
+	return nil, errors.New("connection refused")
+}
+
+// screeningMatchesArg matches the recorded matches when they hold exactly the given entry IDs
+type screeningMatchesArg []string
+
+func (a screeningMatchesArg) Match(v driver.Value) bool {
+	var matches []ScreeningMatch
+	if err := json.Unmarshal([]byte(v.(string)), &matches); err != nil || len(matches) != len(a) {
+		return false
+	}
+	for i, match := range matches {
+		if match.EntryID != a[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestScreenSubmissionRoutesHitsToReview(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        VerificationData
+		provider    ScreeningProvider
+		wantStatus  string
+		wantMatches screeningMatchesArg
+	}{
+		{name: "no hit", data: VerificationData{FirstName: "Ana", LastName: "Quispe", CINumber: "1234567"},
+			provider: &MockScreeningProvider{}, wantStatus: screeningClear, wantMatches: screeningMatchesArg{}},
+		{name: "name on a list", data: VerificationData{FirstName: "Juan", LastName: "Sanctioned", CINumber: "1234567"},
+			provider: &MockScreeningProvider{}, wantStatus: screeningNeedsReview, wantMatches: screeningMatchesArg{"mock-name"}},
+		{name: "CI on a list", data: VerificationData{FirstName: "Ana", LastName: "Quispe", CINumber: "00000000"},
+			provider: &MockScreeningProvider{}, wantStatus: screeningNeedsReview, wantMatches: screeningMatchesArg{"mock-ci"}},
+		{name: "self-declared PEP", data: VerificationData{FirstName: "Ana", LastName: "Quispe", CINumber: "1234567", PEPStatus: true},
+			provider: &MockScreeningProvider{}, wantStatus: screeningNeedsReview, wantMatches: screeningMatchesArg{}},
+		{name: "provider unavailable", data: VerificationData{FirstName: "Ana", LastName: "Quispe", CINumber: "1234567"},
+			provider: failingScreeningProvider{}, wantStatus: screeningNeedsReview, wantMatches: screeningMatchesArg{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			data, _ := json.Marshal(tt.data)
+			mock.ExpectQuery(`SELECT COALESCE\(verification_data::text, '\{\}'\) FROM kyc_submissions`).WithArgs("submission-1").
+				WillReturnRows(sqlmock.NewRows([]string{"verification_data"}).AddRow(string(data)))
+			mock.ExpectExec(`SET screening_status = \$2`).
+				WithArgs("submission-1", tt.wantStatus, tt.wantMatches, tt.provider.Name()).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			(&Server{db: db, screening: tt.provider}).screenSubmission("req-1", "submission-1")
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestTableScreeningProviderNormalizesNames(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	columns := []string{"id", "list_name", "category", "full_name", "name_tokens", "ci_number"}
+	mock.ExpectQuery(`FROM kyc_screening_entries`).WithArgs(`{"JOSE","NUNEZ","PENA"}`, "1234567").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("entry-1", "PEP_BO", "PEP", "José Núñez", "{JOSE,NUNEZ}", "").
+			AddRow("entry-2", "OFAC", "SANCTIONS", "Carlos Peña", "{CARLOS,PENA}", "").
+			AddRow("entry-3", "UIF", "SANCTIONS", "Someone Else", "{SOMEONE,ELSE}", "1234567-LP"))
+
+	matches, err := (&TableScreeningProvider{db: db}).Screen(ScreeningSubject{FullName: "José Núñez Peña", CINumber: "1234567 LP"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// entry-2 shares a single word, not enough to match
+	want := map[string]string{"entry-1": "NAME", "entry-3": "CI"}
+	if len(matches) != len(want) {
+		t.Fatalf("matches = %+v, want entry-1 by name and entry-3 by CI", matches)
+	}
+	for _, match := range matches {
+		if want[match.EntryID] != match.MatchedOn {
+			t.Errorf("match %s on %s, want %q", match.EntryID, match.MatchedOn, want[match.EntryID])
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,151 @@
+// services/kyc/validation.go
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KYCRequirements lists what a submission needs for a KYC level
+type KYCRequirements struct {
+	Level       int      `json:"level"`
+	Documents   []string `json:"documents"`
+	Information []string `json:"information"`
+	Optional    []string `json:"optional"`
+	// Currencies unlocked at this level and the minimum level of every configured currency, filled
+	// from kyc_currency_requirements by handleGetRequirements
+	Currencies           []string       `json:"currencies,omitempty"`
+	CurrencyRequirements map[string]int `json:"currency_requirements,omitempty"`
+}
+
+var kycLevelRequirements = map[int]KYCRequirements{
+	1: {
+		Level:       1,
+		Documents:   []string{"CI"},
+		Information: []string{"first_name", "last_name", "ci_number", "date_of_birth"},
+		Optional:    []string{"phone", "address"},
+	},
+	2: {
+		Level:       2,
+		Documents:   []string{"CI", "SELFIE", "PROOF_ADDRESS"},
+		Information: []string{"first_name", "last_name", "ci_number", "date_of_birth", "address", "city", "phone"},
+		Optional:    []string{"occupation"},
+	},
+	3: {
+		Level:       3,
+		Documents:   []string{"CI", "SELFIE", "PROOF_ADDRESS"},
+		Information: []string{"first_name", "last_name", "ci_number", "date_of_birth", "address", "city", "phone", "occupation", "income_source"},
+		Optional:    []string{"expected_volume", "pep_status"},
+	},
+}
+
+// ValidationIssue is one thing standing between a KYC submission and its requested level
+type ValidationIssue struct {
+	Kind    string `json:"kind"` // FIELD or DOCUMENT
+	Name    string `json:"name"`
+	Code    string `json:"code"` // MISSING or INVALID_FORMAT
+	Message string `json:"message"`
+}
+
+// submissionFields returns the text fields of a submission by their JSON name
+func submissionFields(req KYCSubmission) map[string]string {
+	return map[string]string{
+		"first_name":    req.FirstName,
+		"last_name":     req.LastName,
+		"ci_number":     req.CINumber,
+		"ci_complement": req.CIComplement,
+		"date_of_birth": req.DateOfBirth,
+		"address":       req.Address,
+		"city":          req.City,
+		"phone":         req.Phone,
+		"occupation":    req.Occupation,
+		"income_source": req.IncomeSource,
+	}
+}
+
+// validateSubmission checks the fields of a submission against its level's requirements
+// and the documents the user already uploaded
+func (s *Server) validateSubmission(req KYCSubmission, requirements KYCRequirements, uploaded []string) []ValidationIssue {
+	issues := []ValidationIssue{}
+
+	fields := submissionFields(req)
+	for _, name := range requirements.Information {
+		if value, ok := fields[name]; ok && strings.TrimSpace(value) == "" {
+			issues = append(issues, ValidationIssue{Kind: "FIELD", Name: name, Code: "MISSING", Message: fmt.Sprintf("%s is required for level %d", name, requirements.Level)})
+		}
+	}
+
+	if req.CINumber != "" && !s.validateCINumber(req.CINumber) {
+		issues = append(issues, ValidationIssue{Kind: "FIELD", Name: "ci_number", Code: "INVALID_FORMAT", Message: "Invalid CI number format (6 to 10 digits)"})
+	}
+
+	for _, docType := range requirements.Documents {
+		if !contains(uploaded, docType) {
+			issues = append(issues, ValidationIssue{Kind: "DOCUMENT", Name: docType, Code: "MISSING", Message: docType + " document has not been uploaded"})
+		}
+	}
+
+	return issues
+}
+
+// uploadedDocumentTypes returns the document types attached to the user's latest submission,
+// which is the one a submit would update
+func (s *Server) uploadedDocumentTypes(userID string) ([]string, error) {
+	rows, err := s.db.Query(`
+		SELECT DISTINCT d.document_type
+		FROM kyc_documents d
+		WHERE d.submission_id = (
+			SELECT id FROM kyc_submissions WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1
+		)
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types := []string{}
+	for rows.Next() {
+		var docType string
+		if err := rows.Scan(&docType); err == nil {
+			types = append(types, docType)
+		}
+	}
+	return types, rows.Err()
+}
+
+// handleValidateKYC runs the submission checks without creating or updating a submission
+func (s *Server) handleValidateKYC(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req KYCSubmission
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	requirements, ok := kycLevelRequirements[req.KYCLevel]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid KYC level"})
+		return
+	}
+
+	uploaded, err := s.uploadedDocumentTypes(userID)
+	if err != nil {
+		requestLog(c).Printf("Error loading KYC documents for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load uploaded documents"})
+		return
+	}
+
+	issues := s.validateSubmission(req, requirements, uploaded)
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid":              len(issues) == 0,
+		"kyc_level":          req.KYCLevel,
+		"issues":             issues,
+		"uploaded_documents": uploaded,
+		"requirements":       requirements,
+	})
+}
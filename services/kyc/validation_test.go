@@ -0,0 +1,84 @@
+// services/kyc/validation_test.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+type validationResponse struct {
+	Valid  bool              `json:"valid"`
+	Issues []ValidationIssue `json:"issues"`
+}
+
+// validateKYC previews the submission for user-1, who already uploaded the given documents
+func validateKYC(t *testing.T, body string, uploaded ...string) validationResponse {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"document_type"})
+	for _, docType := range uploaded {
+		rows.AddRow(docType)
+	}
+	mock.ExpectQuery(`SELECT DISTINCT d.document_type\s+FROM kyc_documents d`).WithArgs("user-1").WillReturnRows(rows)
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/kyc/validate", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", "user-1")
+	(&Server{db: db}).handleValidateKYC(c)
+
+	// A preview only reads: any insert or update would be an unexpected call
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	var response validationResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("response = %d %s: %v", w.Code, w.Body.String(), err)
+	}
+	return response
+}
+
+func TestValidateKYCPreviewOfACompleteSubmission(t *testing.T) {
+	response := validateKYC(t, `{"kyc_level":1,"first_name":"Ana","last_name":"Quispe","ci_number":"1234567",
+		"date_of_birth":"1990-03-15"}`, "CI")
+
+	if !response.Valid || len(response.Issues) != 0 {
+		t.Errorf("preview = %+v, want valid without issues", response)
+	}
+}
+
+func TestValidateKYCReportsMissingLevel2Documents(t *testing.T) {
+	response := validateKYC(t, `{"kyc_level":2,"first_name":"Ana","last_name":"Quispe","ci_number":"12AB",
+		"date_of_birth":"1990-03-15","address":"Av. Arce 123","city":"","phone":"70000000"}`, "CI")
+
+	if response.Valid {
+		t.Fatal("preview reported valid with documents missing")
+	}
+	want := map[string]string{
+		"FIELD city":             "MISSING",
+		"FIELD ci_number":        "INVALID_FORMAT",
+		"DOCUMENT SELFIE":        "MISSING",
+		"DOCUMENT PROOF_ADDRESS": "MISSING",
+	}
+	if len(response.Issues) != len(want) {
+		t.Fatalf("issues = %+v, want %d", response.Issues, len(want))
+	}
+	for _, issue := range response.Issues {
+		if code := want[issue.Kind+" "+issue.Name]; issue.Code != code {
+			t.Errorf("issue %s %s = %s, want %q", issue.Kind, issue.Name, issue.Code, code)
+		}
+	}
+}
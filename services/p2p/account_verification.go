@@ -0,0 +1,136 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"unicode"
+)
+
+// Before paying, the buyer can check that the bank account they are told to transfer to belongs
+// to the cashier KYC verified. The order detail carries an account_verification block comparing
+// the holder of the cashier's registered bank account (user_bank_accounts) with the name on their
+// latest approved KYC submission. Only the outcome, the bank, the last digits of the account and
+// the holder's initials are exposed, never the full KYC name.
+
+// Account verification outcomes
+const (
+	accountHolderMatch      = "MATCH"
+	accountHolderMismatch   = "MISMATCH"
+	accountHolderUnverified = "UNVERIFIED" // no approved KYC to compare with
+	accountHolderNoAccount  = "NO_ACCOUNT"
+)
+
+type AccountVerification struct {
+	Status        string `json:"status"`
+	HolderMatches bool   `json:"holder_matches_kyc_name"`
+	KYCVerified   bool   `json:"kyc_verified"`
+	BankName      string `json:"bank_name,omitempty"`
+	AccountLast4  string `json:"account_last4,omitempty"`
+	HolderMasked  string `json:"holder,omitempty"`
+
+	accountNumber string
+}
+
+// cashierAccountVerification compares the cashier's active bank account with their KYC name
+func (s *Server) cashierAccountVerification(cashierID string) (AccountVerification, error) {
+	var bankName, accountNumber, holder, firstName, lastName sql.NullString
+	err := s.db.QueryRow(`
+		SELECT a.bank_name, a.account_number, a.account_holder,
+			k.verification_data->>'first_name', k.verification_data->>'last_name'
+		FROM users u
+		LEFT JOIN LATERAL (
+			SELECT bank_name, account_number, account_holder FROM user_bank_accounts
+			WHERE user_id = u.id AND is_active = true
+			ORDER BY updated_at DESC LIMIT 1
+		) a ON true
+		LEFT JOIN LATERAL (
+			SELECT verification_data FROM kyc_submissions
+			WHERE user_id = u.id AND status = 'APPROVED'
+			ORDER BY reviewed_at DESC NULLS LAST LIMIT 1
+		) k ON true
+		WHERE u.id = $1
+	`, cashierID).Scan(&bankName, &accountNumber, &holder, &firstName, &lastName)
+	if err != nil {
+		return AccountVerification{}, err
+	}
+
+	kycName := strings.TrimSpace(firstName.String + " " + lastName.String)
+	verification := AccountVerification{KYCVerified: kycName != ""}
+	if !accountNumber.Valid {
+		verification.Status = accountHolderNoAccount
+		return verification, nil
+	}
+
+	verification.BankName = bankName.String
+	verification.accountNumber = accountNumber.String
+	verification.AccountLast4 = lastDigits(accountNumber.String, 4)
+	verification.HolderMasked = maskName(holder.String)
+
+	switch {
+	case !verification.KYCVerified:
+		verification.Status = accountHolderUnverified
+	case holderMatchesName(holder.String, kycName):
+		verification.Status = accountHolderMatch
+		verification.HolderMatches = true
+	default:
+		verification.Status = accountHolderMismatch
+	}
+	return verification, nil
+}
+
+// Bank statements often print names without accents or Ñ
+var nameAccents = strings.NewReplacer("Á", "A", "É", "E", "Í", "I", "Ó", "O", "Ú", "U", "Ü", "U", "Ñ", "N")
+
+// nameTokens upper-cases the name, drops accents and punctuation and splits it into words
+func nameTokens(name string) []string {
+	var b strings.Builder
+	for _, r := range nameAccents.Replace(strings.ToUpper(name)) {
+		if unicode.IsLetter(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Fields(b.String())
+}
+
+// holderMatchesName accepts the account holder when every word of the shorter of the two names
+// appears in the other and at least two words match, since banks often drop the second surname
+// or a middle name
+func holderMatchesName(holder, kycName string) bool {
+	short, long := nameTokens(holder), nameTokens(kycName)
+	if len(short) > len(long) {
+		short, long = long, short
+	}
+	if len(short) < 2 {
+		return false
+	}
+
+	words := make(map[string]int)
+	for _, word := range long {
+		words[word]++
+	}
+	for _, word := range short {
+		if words[word] == 0 {
+			return false
+		}
+		words[word]--
+	}
+	return true
+}
+
+// maskName keeps the initial of each word: "JUAN PEREZ" becomes "J*** P***"
+func maskName(name string) string {
+	var masked []string
+	for _, word := range nameTokens(name) {
+		masked = append(masked, string([]rune(word)[:1])+"***")
+	}
+	return strings.Join(masked, " ")
+}
+
+func lastDigits(value string, n int) string {
+	if len(value) <= n {
+		return value
+	}
+	return value[len(value)-n:]
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestHolderMatchesName(t *testing.T) {
+	tests := []struct {
+		holder, kycName string
+		want            bool
+	}{
+		{holder: "JUAN PEREZ QUISPE", kycName: "Juan Pérez Quispe", want: true},
+		{holder: "PEREZ QUISPE, JUAN", kycName: "Juan Pérez Quispe", want: true},
+		{holder: "JUAN PEREZ", kycName: "Juan Carlos Pérez Quispe", want: true},
+		{holder: "MARIA NUÑEZ", kycName: "María Nunez", want: true},
+		{holder: "JUAN MAMANI", kycName: "Juan Pérez Quispe", want: false},
+		{holder: "JUAN", kycName: "Juan Pérez", want: false},
+		{holder: "JUAN JUAN", kycName: "Juan Pérez", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := holderMatchesName(tt.holder, tt.kycName); got != tt.want {
+			t.Errorf("holderMatchesName(%q, %q) = %v, want %v", tt.holder, tt.kycName, got, tt.want)
+		}
+	}
+}
+
+func TestCashierAccountVerification(t *testing.T) {
+	columns := []string{"bank_name", "account_number", "account_holder", "first_name", "last_name"}
+	tests := []struct {
+		name        string
+		row         []driver.Value
+		wantStatus  string
+		wantMatches bool
+	}{
+		{name: "verified account in the KYC name",
+			row:        []driver.Value{"BNB", "10000023456", "JUAN PEREZ QUISPE", "Juan", "Pérez Quispe"},
+			wantStatus: accountHolderMatch, wantMatches: true},
+		{name: "account in someone else's name",
+			row:        []driver.Value{"BNB", "10000023456", "ROSA MAMANI", "Juan", "Pérez Quispe"},
+			wantStatus: accountHolderMismatch},
+		{name: "no approved KYC",
+			row:        []driver.Value{"BNB", "10000023456", "JUAN PEREZ QUISPE", nil, nil},
+			wantStatus: accountHolderUnverified},
+		{name: "no bank account registered",
+			row:        []driver.Value{nil, nil, nil, "Juan", "Pérez Quispe"},
+			wantStatus: accountHolderNoAccount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(`FROM user_bank_accounts`).WithArgs("cashier-1").
+				WillReturnRows(sqlmock.NewRows(columns).AddRow(tt.row...))
+
+			verification, err := (&Server{db: db}).cashierAccountVerification("cashier-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if verification.Status != tt.wantStatus || verification.HolderMatches != tt.wantMatches {
+				t.Errorf("verification = %+v, want %s with holder_matches_kyc_name %v", verification, tt.wantStatus, tt.wantMatches)
+			}
+
+			// Only initials and the last digits of the account reach the buyer
+			body, _ := json.Marshal(verification)
+			for _, leaked := range []string{"Juan", "JUAN", "Pérez", "PEREZ", "ROSA", "10000023456"} {
+				if strings.Contains(string(body), leaked) {
+					t.Errorf("account_verification %s exposes %q", body, leaked)
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCashierAccountVerificationMasksTheMatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM user_bank_accounts`).WithArgs("cashier-1").
+		WillReturnRows(sqlmock.NewRows([]string{"bank_name", "account_number", "account_holder", "first_name", "last_name"}).
+			AddRow("BNB", "10000023456", "Juan Pérez", "Juan", "Pérez"))
+
+	verification, err := (&Server{db: db}).cashierAccountVerification("cashier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verification.HolderMasked != "J*** P***" || verification.AccountLast4 != "3456" || !verification.KYCVerified {
+		t.Errorf("verification = %+v, want holder J*** P***, last digits 3456 and a verified KYC", verification)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Admin handlers
+
+// handleAdminGetOrderFull aggregates everything related to an order for support investigations:
+// the order itself, a status timeline, the cashier, fund movements, transaction rows,
+// any dispute and the chat history.
+func (s *Server) handleAdminGetOrderFull(c *gin.Context) {
+	orderID := c.Param("id")
+	adminID := c.GetString("user_id")
+
+	if orderID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order ID is required"})
+		return
+	}
+
+	var order Order
+	var paymentMethodsJSON string
+	var completedAt sql.NullTime
+	err := s.db.QueryRow(`
+		SELECT id, user_id, cashier_id, order_type, currency_from, currency_to,
+			amount, remaining_amount, rate, COALESCE(min_amount, 0), COALESCE(max_amount, 0),
+			COALESCE(payment_methods, '[]'), status, accepted_at, expires_at, created_at
+		FROM orders WHERE id = $1
+	`, orderID).Scan(&order.ID, &order.UserID, &order.CashierID, &order.Type, &order.CurrencyFrom,
+		&order.CurrencyTo, &order.Amount, &order.RemainingAmount, &order.Rate,
+		&order.MinAmount, &order.MaxAmount, &paymentMethodsJSON, &order.Status,
+		&order.AcceptedAt, &order.ExpiresAt, &order.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Printf("Error getting order %s: %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get order"})
+		return
+	}
+
+	json.Unmarshal([]byte(paymentMethodsJSON), &order.PaymentMethods)
+
+	// Audit the access before returning any data
+	s.recordAuditLog(c, adminID, "ADMIN_VIEW_ORDER_FULL", "order", orderID, nil)
+
+	response := gin.H{"order": order}
+
+	// Order owner
+	owner, err := s.queryRows(`
+		SELECT u.id, u.email, u.phone, u.kyc_level,
+			COALESCE(up.first_name, '') as first_name, COALESCE(up.last_name, '') as last_name
+		FROM users u
+		LEFT JOIN user_profiles up ON up.user_id = u.id
+		WHERE u.id = $1
+	`, order.UserID)
+	if err != nil {
+		requestLog(c).Printf("Error getting owner for order %s: %v", orderID, err)
+	}
+	if len(owner) > 0 {
+		response["user"] = owner[0]
+	}
+
+	// Cashier and assignment
+	response["cashier"] = nil
+	if order.CashierID != nil {
+		cashier, err := s.queryRows(`
+			SELECT u.id, u.email, u.phone,
+				COALESCE(up.first_name, '') as first_name, COALESCE(up.last_name, '') as last_name
+			FROM users u
+			LEFT JOIN user_profiles up ON up.user_id = u.id
+			WHERE u.id = $1
+		`, *order.CashierID)
+		if err != nil {
+			requestLog(c).Printf("Error getting cashier for order %s: %v", orderID, err)
+		}
+		if len(cashier) > 0 {
+			response["cashier"] = cashier[0]
+		}
+	}
+
+	assignments, err := s.queryRows(`
+		SELECT id, cashier_id, status, assigned_at, completed_at
+		FROM cashier_order_assignments
+		WHERE order_id = $1
+		ORDER BY assigned_at ASC
+	`, orderID)
+	if err != nil {
+		requestLog(c).Printf("Error getting assignments for order %s: %v", orderID, err)
+	}
+	response["assignments"] = assignments
+
+	for _, assignment := range assignments {
+		if t, ok := assignment["completed_at"].(time.Time); ok {
+			completedAt = sql.NullTime{Time: t, Valid: true}
+		}
+	}
+
+	// Escrow / fund movements: matches and wallet ledger entries tied to the order
+	matches, err := s.queryRows(`
+		SELECT id, buy_order_id, sell_order_id, amount, rate, status, created_at
+		FROM p2p_matches
+		WHERE buy_order_id = $1 OR sell_order_id = $1
+		ORDER BY created_at ASC
+	`, orderID)
+	if err != nil {
+		requestLog(c).Printf("Error getting matches for order %s: %v", orderID, err)
+	}
+
+	fundMovements, err := s.queryRows(`
+		SELECT id, user_id, transaction_type, currency, amount, status, method, external_ref, created_at
+		FROM wallet_transactions
+		WHERE external_ref = $1
+			OR metadata->>'order_id' = $1
+			OR external_ref IN (
+				SELECT id::text FROM p2p_matches WHERE buy_order_id::text = $1 OR sell_order_id::text = $1
+			)
+		ORDER BY created_at ASC
+	`, orderID)
+	if err != nil {
+		requestLog(c).Printf("Error getting fund movements for order %s: %v", orderID, err)
+	}
+	response["escrow"] = gin.H{
+		"matches":   matches,
+		"movements": fundMovements,
+	}
+
+	// Transaction rows
+	transactions, err := s.queryRows(`
+		SELECT id, from_user_id, to_user_id, user_id, transaction_type, amount, currency,
+			fee, status, payment_method, external_ref, escrow_released, created_at, completed_at
+		FROM transactions
+		WHERE order_id::text = $1 OR external_ref = $1
+		ORDER BY created_at ASC
+	`, orderID)
+	if err != nil {
+		requestLog(c).Printf("Error getting transactions for order %s: %v", orderID, err)
+	}
+	response["transactions"] = transactions
+
+	// Dispute, either opened against the order itself or one of its transactions
+	response["dispute"] = nil
+	disputes, err := s.queryRows(`
+		SELECT id, transaction_id, initiator_id, respondent_id, mediator_id, status, dispute_type,
+			title, description, resolution_type, resolution_amount, resolution_notes,
+			created_at, resolved_at
+		FROM disputes
+		WHERE transaction_id::text = $1
+			OR order_id::text = $1
+			OR transaction_id IN (SELECT id FROM transactions WHERE order_id::text = $1)
+		ORDER BY created_at DESC
+	`, orderID)
+	if err != nil {
+		requestLog(c).Printf("Error getting dispute for order %s: %v", orderID, err)
+	}
+	if len(disputes) > 0 {
+		dispute := disputes[0]
+		evidence, err := s.queryRows(`
+			SELECT id, submitted_by, evidence_type, file_path, description, created_at
+			FROM dispute_evidence
+			WHERE dispute_id = $1
+			ORDER BY created_at ASC
+		`, dispute["id"])
+		if err != nil {
+			requestLog(c).Printf("Error getting dispute evidence for order %s: %v", orderID, err)
+		}
+		dispute["evidence"] = evidence
+		response["dispute"] = dispute
+	}
+
+	// Chat messages from the transaction room
+	messages, err := s.queryRows(`
+		SELECT m.id, m.room_id, m.sender_id, m.message_type, m.content, m.created_at
+		FROM chat_messages m
+		JOIN chat_rooms r ON r.id = m.room_id
+		WHERE r.transaction_id::text = $1
+		ORDER BY m.created_at ASC
+	`, orderID)
+	if err != nil {
+		requestLog(c).Printf("Error getting chat messages for order %s: %v", orderID, err)
+	}
+	response["chat_messages"] = messages
+
+	// Status history built from the timestamps recorded along the order lifecycle
+	history := []gin.H{{"status": "CREATED", "at": order.CreatedAt}}
+	if order.AcceptedAt != nil {
+		history = append(history, gin.H{"status": "MATCHED", "at": *order.AcceptedAt, "by": order.CashierID})
+	}
+	if completedAt.Valid {
+		history = append(history, gin.H{"status": "COMPLETED", "at": completedAt.Time, "by": order.CashierID})
+	}
+	for _, dispute := range disputes {
+		history = append(history, gin.H{"status": "DISPUTED", "at": dispute["created_at"], "by": dispute["initiator_id"]})
+		if dispute["resolved_at"] != nil {
+			history = append(history, gin.H{"status": "DISPUTE_RESOLVED", "at": dispute["resolved_at"], "by": dispute["mediator_id"]})
+		}
+	}
+	response["status_history"] = history
+	response["current_status"] = order.Status
+
+	c.JSON(http.StatusOK, response)
+}
+
+// queryRows runs a query and returns every row as a column->value map
+func (s *Server) queryRows(query string, args ...interface{}) ([]map[string]interface{}, error) {
+	results := []map[string]interface{}{}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return results, err
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return results, err
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				row[column] = string(b)
+			} else {
+				row[column] = values[i]
+			}
+		}
+		results = append(results, row)
+	}
+
+	return results, rows.Err()
+}
+
+// recordAuditLog stores an admin action in audit_logs, with any details in new_values
+func (s *Server) recordAuditLog(c *gin.Context, userID, action, entityType, entityID string, details map[string]interface{}) {
+	detailsJSON, _ := json.Marshal(details)
+	_, err := s.db.Exec(`
+		INSERT INTO audit_logs (user_id, action, entity_type, entity_id, new_values, ip_address, user_agent, service)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::inet, $7, 'p2p')
+	`, userID, action, entityType, entityID, string(detailsJSON), c.ClientIP(), c.Request.UserAgent())
+
+	if err != nil {
+		log.Printf("⚠️ Failed to write audit log %s for %s %s: %v", action, entityType, entityID, err)
+		return
+	}
+
+	log.Printf("📝 Audit: %s by %s on %s %s", action, userID, entityType, entityID)
+}
+
+// auditLogTime accepts RFC 3339 timestamps and plain dates for the audit log range filters
+func auditLogTime(value string) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// handleAdminGetAuditLog lists the admin actions every service records in audit_logs, newest
+// first. Filters: admin_id, action, service, entity_type, entity_id, and from/to (a date or an
+// RFC 3339 timestamp; a plain to date includes that whole day).
+func (s *Server) handleAdminGetAuditLog(c *gin.Context) {
+	var conditions []string
+	var args []interface{}
+	addFilter := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if adminID := c.Query("admin_id"); adminID != "" {
+		addFilter("a.user_id::text = $%d", adminID)
+	}
+	if action := strings.ToUpper(c.Query("action")); action != "" {
+		addFilter("a.action = $%d", action)
+	}
+	if service := strings.ToLower(c.Query("service")); service != "" {
+		addFilter("a.service = $%d", service)
+	}
+	if entityType := c.Query("entity_type"); entityType != "" {
+		addFilter("a.entity_type = $%d", entityType)
+	}
+	if entityID := c.Query("entity_id"); entityID != "" {
+		addFilter("a.entity_id::text = $%d", entityID)
+	}
+	if value := c.Query("from"); value != "" {
+		from, err := auditLogTime(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date (YYYY-MM-DD) or an RFC 3339 timestamp"})
+			return
+		}
+		addFilter("a.created_at >= $%d", from)
+	}
+	if value := c.Query("to"); value != "" {
+		to, err := auditLogTime(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date (YYYY-MM-DD) or an RFC 3339 timestamp"})
+			return
+		}
+		if len(value) == len("2006-01-02") {
+			to = to.AddDate(0, 0, 1)
+		}
+		addFilter("a.created_at < $%d", to)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM audit_logs a "+where, args...).Scan(&total); err != nil {
+		requestLog(c).Printf("Error counting audit log entries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load audit log"})
+		return
+	}
+
+	entries, err := s.queryRows(`
+		SELECT a.id, a.user_id AS admin_id, u.email AS admin_email, a.action, a.service,
+			a.entity_type, a.entity_id, a.new_values AS details, host(a.ip_address) AS ip_address,
+			a.user_agent, a.created_at
+		FROM audit_logs a
+		LEFT JOIN users u ON u.id = a.user_id
+		`+where+fmt.Sprintf(" ORDER BY a.created_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2),
+		append(args, limit, offset)...)
+	if err != nil {
+		requestLog(c).Printf("Error loading audit log: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load audit log"})
+		return
+	}
+	for _, entry := range entries {
+		if details, ok := entry["details"].(string); ok {
+			entry["details"] = json.RawMessage(details)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+var orderFullColumns = []string{"id", "user_id", "cashier_id", "order_type", "currency_from", "currency_to",
+	"amount", "remaining_amount", "rate", "min_amount", "max_amount", "payment_methods", "status",
+	"accepted_at", "expires_at", "created_at"}
+
+func getOrderFull(s *Server, orderID string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/admin/orders/"+orderID+"/full", nil)
+	c.Params = gin.Params{{Key: "id", Value: orderID}}
+	c.Set("user_id", "admin-1")
+	s.handleAdminGetOrderFull(c)
+	return w
+}
+
+func TestAdminGetOrderFullNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM orders WHERE id = \$1`).WithArgs("missing").WillReturnError(sql.ErrNoRows)
+
+	w := getOrderFull(&Server{db: db}, "missing")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+	// Nothing was viewed, so nothing is audited: any other query fails the mock
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAdminGetOrderFullAuditsAndBuildsHistory(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	created := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	accepted := created.Add(5 * time.Minute)
+	completed := created.Add(20 * time.Minute)
+
+	mock.ExpectQuery(`FROM orders WHERE id = \$1`).WithArgs("order-1").WillReturnRows(sqlmock.NewRows(orderFullColumns).
+		AddRow("order-1", "user-1", nil, "BUY", "BOB", "USD", "100", "0", "6.90", "0", "0", `["BANK"]`, "COMPLETED",
+			accepted, nil, created))
+	mock.ExpectExec(`INSERT INTO audit_logs`).
+		WithArgs("admin-1", "ADMIN_VIEW_ORDER_FULL", "order", "order-1", "null", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM users u`).WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow("user-1", []byte("ana@example.com")))
+	mock.ExpectQuery(`FROM cashier_order_assignments`).WillReturnRows(sqlmock.NewRows(
+		[]string{"id", "cashier_id", "status", "assigned_at", "completed_at"}).
+		AddRow("assignment-1", "cashier-1", "COMPLETED", accepted, completed))
+	mock.ExpectQuery(`FROM p2p_matches`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`FROM wallet_transactions`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`FROM transactions`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`FROM disputes`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`FROM chat_messages`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	w := getOrderFull(&Server{db: db}, "order-1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	var response struct {
+		User          map[string]interface{} `json:"user"`
+		StatusHistory []struct {
+			Status string    `json:"status"`
+			At     time.Time `json:"at"`
+		} `json:"status_history"`
+		CurrentStatus string `json:"current_status"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.User["email"] != "ana@example.com" {
+		t.Errorf("user email = %v, want the text of the column", response.User["email"])
+	}
+	want := []struct {
+		status string
+		at     time.Time
+	}{{"CREATED", created}, {"MATCHED", accepted}, {"COMPLETED", completed}}
+	if len(response.StatusHistory) != len(want) {
+		t.Fatalf("status_history = %+v, want %d entries", response.StatusHistory, len(want))
+	}
+	for i, entry := range want {
+		if response.StatusHistory[i].Status != entry.status || !response.StatusHistory[i].At.Equal(entry.at) {
+			t.Errorf("status_history[%d] = %+v, want %s at %s", i, response.StatusHistory[i], entry.status, entry.at)
+		}
+	}
+	if response.CurrentStatus != "COMPLETED" {
+		t.Errorf("current_status = %s, want COMPLETED", response.CurrentStatus)
+	}
+}
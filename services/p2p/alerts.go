@@ -0,0 +1,39 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+)
+
+// raiseSystemAlert records a problem detected by a background worker in system_alerts, where
+// admins list, acknowledge and resolve them through the wallet service's /admin/alerts. Alerts
+// sharing an unresolved dedupe key are collapsed into one row with an occurrence counter.
+func raiseSystemAlert(db *sql.DB, severity, source, alertType, dedupeKey, message string, details map[string]interface{}) {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	detailsJSON, _ := json.Marshal(details)
+
+	var key interface{}
+	if dedupeKey != "" {
+		key = dedupeKey
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO system_alerts (severity, source, alert_type, dedupe_key, message, details)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (dedupe_key) WHERE status <> 'RESOLVED'
+		DO UPDATE SET occurrences = system_alerts.occurrences + 1,
+			last_seen_at = NOW(),
+			message = EXCLUDED.message,
+			details = EXCLUDED.details
+	`, severity, source, alertType, key, message, string(detailsJSON))
+
+	if err != nil {
+		log.Printf("❌ Failed to raise %s alert %s: %v", severity, alertType, err)
+		return
+	}
+
+	log.Printf("🚨 [%s] %s: %s", severity, alertType, message)
+}
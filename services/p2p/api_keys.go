@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// apiKeyMiddleware authenticates partner requests carrying an X-API-Key header.
+// Keys are issued by the auth service; requests without the header stay public.
+func (s *Server) apiKeyMiddleware(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		secret := c.GetHeader("X-API-Key")
+		if secret == "" {
+			c.Next()
+			return
+		}
+
+		sum := sha256.Sum256([]byte(secret))
+		keyHash := hex.EncodeToString(sum[:])
+
+		var keyID, userID string
+		var scopes []string
+		var rateLimit int
+		err := s.db.QueryRow(`
+			SELECT id, user_id, scopes, rate_limit_per_minute
+			FROM api_keys
+			WHERE key_hash = $1 AND revoked_at IS NULL
+		`, keyHash).Scan(&keyID, &userID, pq.Array(&scopes), &rateLimit)
+
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or revoked API key"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			log.Printf("Error validating API key: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate API key"})
+			c.Abort()
+			return
+		}
+
+		if !apiKeyHasScope(scopes, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key not allowed for this endpoint", "required_scope": scope})
+			c.Abort()
+			return
+		}
+
+		// Fixed one-minute window per key
+		window := time.Now().Unix() / 60
+		counterKey := fmt.Sprintf("apikey:ratelimit:%s:%d", keyID, window)
+		ctx := context.Background()
+
+		count, err := s.redis.Incr(ctx, counterKey).Result()
+		if err != nil {
+			log.Printf("Error updating API key rate limit for %s: %v", keyID, err)
+		} else {
+			if count == 1 {
+				s.redis.Expire(ctx, counterKey, time.Minute)
+			}
+
+			remaining := int64(rateLimit) - count
+			if remaining < 0 {
+				remaining = 0
+			}
+			c.Header("X-RateLimit-Limit", strconv.Itoa(rateLimit))
+			c.Header("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+
+			if count > int64(rateLimit) {
+				c.Header("Retry-After", strconv.FormatInt(60-time.Now().Unix()%60, 10))
+				c.JSON(http.StatusTooManyRequests, gin.H{"error": "API key rate limit exceeded"})
+				c.Abort()
+				return
+			}
+		}
+
+		s.db.Exec(`UPDATE api_keys SET last_used_at = NOW() WHERE id = $1`, keyID)
+
+		c.Set("api_key_id", keyID)
+		c.Set("api_key_user_id", userID)
+		c.Next()
+	}
+}
+
+// apiKeyHasScope reports whether a key may call an endpoint; "read" covers all read-only endpoints
+func apiKeyHasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == "read" || s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+const testAPIKey = "p2pb_0123456789abcdef"
+
+// expectAPIKey expects testAPIKey to be looked up by its SHA-256 digest, the way the auth
+// service stores it
+func expectAPIKey(mock sqlmock.Sqlmock, scopes string, rateLimit int) {
+	sum := sha256.Sum256([]byte(testAPIKey))
+	rows := sqlmock.NewRows([]string{"id", "user_id", "scopes", "rate_limit_per_minute"})
+	if scopes != "" {
+		rows.AddRow("key-1", "partner-1", scopes, rateLimit)
+	}
+	mock.ExpectQuery(`FROM api_keys\s+WHERE key_hash = \$1 AND revoked_at IS NULL`).
+		WithArgs(hex.EncodeToString(sum[:])).WillReturnRows(rows)
+}
+
+func newAPIKeyRouter(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	s := &Server{db: db, redis: client}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/rates", s.apiKeyMiddleware("rates"), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"api_key_id": c.GetString("api_key_id")})
+	})
+	return router, mock
+}
+
+func getWithAPIKey(router *gin.Engine, secret string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/rates", nil)
+	if secret != "" {
+		req.Header.Set("X-API-Key", secret)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPIKeyHasScope(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		scope  string
+		want   bool
+	}{
+		{scopes: []string{"read"}, scope: "orderbook", want: true},
+		{scopes: []string{"rates"}, scope: "rates", want: true},
+		{scopes: []string{"rates", "orders"}, scope: "orderbook", want: false},
+		{scopes: nil, scope: "rates", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := apiKeyHasScope(tt.scopes, tt.scope); got != tt.want {
+			t.Errorf("apiKeyHasScope(%v, %s) = %v, want %v", tt.scopes, tt.scope, got, tt.want)
+		}
+	}
+}
+
+func TestAPIKeyMiddlewareAuthenticatesAndScopes(t *testing.T) {
+	tests := []struct {
+		name       string
+		secret     string
+		scopes     string // empty when the key is unknown or revoked
+		wantStatus int
+	}{
+		{name: "no key stays public", wantStatus: http.StatusOK},
+		{name: "unknown or revoked key", secret: testAPIKey, wantStatus: http.StatusUnauthorized},
+		{name: "key without the scope", secret: testAPIKey, scopes: "{orderbook}", wantStatus: http.StatusForbidden},
+		{name: "key with the scope", secret: testAPIKey, scopes: "{rates}", wantStatus: http.StatusOK},
+		{name: "read covers every market endpoint", secret: testAPIKey, scopes: "{read}", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := newAPIKeyRouter(t)
+			if tt.secret != "" {
+				expectAPIKey(mock, tt.scopes, 60)
+			}
+			if tt.secret != "" && tt.wantStatus == http.StatusOK {
+				mock.ExpectExec(`UPDATE api_keys SET last_used_at = NOW\(\)`).WithArgs("key-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			if w := getWithAPIKey(router, tt.secret); w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAPIKeyMiddlewareRateLimitsPerKey(t *testing.T) {
+	router, mock := newAPIKeyRouter(t)
+	for i := 0; i < 3; i++ {
+		expectAPIKey(mock, "{rates}", 2)
+		if i < 2 {
+			mock.ExpectExec(`UPDATE api_keys SET last_used_at = NOW\(\)`).WithArgs("key-1").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+	}
+
+	for i, wantRemaining := range []string{"1", "0"} {
+		w := getWithAPIKey(router, testAPIKey)
+		if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "2" || w.Header().Get("X-RateLimit-Remaining") != wantRemaining {
+			t.Fatalf("request %d = %d with headers %v, want 200 and %s remaining", i+1, w.Code, w.Header(), wantRemaining)
+		}
+	}
+
+	w := getWithAPIKey(router, testAPIKey)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("request 3 = %d with headers %v, want 429 with Retry-After", w.Code, w.Header())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
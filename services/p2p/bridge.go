@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Cross-pair matching lets a BUY order meet a SELL order whose base currency differs but is
+// bridged to it, e.g. a USD buyer against a USDT seller, both quoted in BOB. It is off unless
+// P2P_CROSS_PAIR_MATCHING=true. P2P_CURRENCY_BRIDGES lists the bridges as FROM:TO:RATE (units
+// of TO per unit of FROM, default "USD:USDT:1") and P2P_BRIDGE_SPREAD (default 0.002) is kept
+// by the platform on every bridged conversion. Bridged matches carry the bridge they used.
+
+type CurrencyBridge struct {
+	From   string          `json:"from"`
+	To     string          `json:"to"`
+	Rate   decimal.Decimal `json:"rate"` // units of To delivered per unit of From, after spread
+	Spread decimal.Decimal `json:"spread"`
+}
+
+func crossPairMatchingEnabled() bool {
+	return os.Getenv("P2P_CROSS_PAIR_MATCHING") == "true"
+}
+
+func bridgeSpread() decimal.Decimal {
+	if spread, err := decimal.NewFromString(os.Getenv("P2P_BRIDGE_SPREAD")); err == nil && !spread.IsNegative() && spread.LessThan(decimal.NewFromInt(1)) {
+		return spread
+	}
+	return decimal.NewFromFloat(0.002)
+}
+
+// loadCurrencyBridges parses P2P_CURRENCY_BRIDGES into mid rates keyed by "FROM:TO", both ways
+func loadCurrencyBridges() map[string]decimal.Decimal {
+	value := os.Getenv("P2P_CURRENCY_BRIDGES")
+	if value == "" {
+		value = "USD:USDT:1"
+	}
+
+	bridges := make(map[string]decimal.Decimal)
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 3 {
+			continue
+		}
+		rate, err := decimal.NewFromString(parts[2])
+		if err != nil || !rate.IsPositive() {
+			continue
+		}
+		from, to := strings.ToUpper(parts[0]), strings.ToUpper(parts[1])
+		bridges[from+":"+to] = rate
+		bridges[to+":"+from] = decimal.NewFromInt(1).DivRound(rate, 8)
+	}
+	return bridges
+}
+
+// currencyBridge returns the bridge converting from into to, if cross-pair matching allows it
+func currencyBridge(from, to string) (*CurrencyBridge, bool) {
+	if !crossPairMatchingEnabled() {
+		return nil, false
+	}
+	mid, ok := loadCurrencyBridges()[from+":"+to]
+	if !ok {
+		return nil, false
+	}
+	spread := bridgeSpread()
+	return &CurrencyBridge{
+		From:   from,
+		To:     to,
+		Rate:   mid.Mul(decimal.NewFromInt(1).Sub(spread)).Round(8),
+		Spread: spread,
+	}, true
+}
+
+// bridgedCurrencies lists the currencies an order's base currency can be matched against
+func bridgedCurrencies(currency string) []string {
+	if !crossPairMatchingEnabled() {
+		return nil
+	}
+	var currencies []string
+	for key := range loadCurrencyBridges() {
+		if parts := strings.Split(key, ":"); parts[0] == currency {
+			currencies = append(currencies, parts[1])
+		}
+	}
+	return currencies
+}
+
+// matchBridge checks whether a BUY and a SELL order trade the same thing. Exact reciprocal pairs
+// need no bridge; otherwise both must be quoted in the same currency and the seller's base must
+// be bridged into the buyer's.
+func matchBridge(buy, sell Order) (*CurrencyBridge, bool) {
+	if buy.CurrencyFrom != sell.CurrencyTo {
+		return nil, false
+	}
+	if buy.CurrencyTo == sell.CurrencyFrom {
+		return nil, true
+	}
+	return currencyBridge(sell.CurrencyFrom, buy.CurrencyTo)
+}
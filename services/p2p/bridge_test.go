@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestLoadCurrencyBridges(t *testing.T) {
+	t.Setenv("P2P_CURRENCY_BRIDGES", "usd:usdt:1.0010, EUR:USD, BOB:USD:-1, USD:EUR:abc")
+
+	bridges := loadCurrencyBridges()
+	want := map[string]string{
+		"USD:USDT": "1.001",
+		"USDT:USD": "0.999001", // 1 / 1.001 to 8 places
+	}
+	if len(bridges) != len(want) {
+		t.Errorf("loadCurrencyBridges() = %v, want only the valid entry both ways", bridges)
+	}
+	for key, rate := range want {
+		if !bridges[key].Equal(decimal.RequireFromString(rate)) {
+			t.Errorf("bridge %s = %s, want %s", key, bridges[key], rate)
+		}
+	}
+}
+
+func TestCurrencyBridge(t *testing.T) {
+	t.Setenv("P2P_CURRENCY_BRIDGES", "")
+	t.Setenv("P2P_BRIDGE_SPREAD", "")
+
+	t.Setenv("P2P_CROSS_PAIR_MATCHING", "")
+	if _, ok := currencyBridge("USDT", "USD"); ok {
+		t.Error("bridge available with cross-pair matching off")
+	}
+	if currencies := bridgedCurrencies("USD"); len(currencies) != 0 {
+		t.Errorf("bridgedCurrencies() = %v with cross-pair matching off", currencies)
+	}
+
+	t.Setenv("P2P_CROSS_PAIR_MATCHING", "true")
+	bridge, ok := currencyBridge("USDT", "USD")
+	if !ok {
+		t.Fatal("default USD/USDT bridge missing")
+	}
+	// The platform keeps the default 0.2% spread
+	if !bridge.Rate.Equal(decimal.RequireFromString("0.998")) || !bridge.Spread.Equal(decimal.RequireFromString("0.002")) {
+		t.Errorf("bridge = %s at spread %s, want 0.998 at 0.002", bridge.Rate, bridge.Spread)
+	}
+	if _, ok := currencyBridge("USD", "BOB"); ok {
+		t.Error("bridge returned for an unconfigured pair")
+	}
+
+	for _, spread := range []string{"-0.1", "1", "abc"} {
+		t.Setenv("P2P_BRIDGE_SPREAD", spread)
+		if got := bridgeSpread(); !got.Equal(decimal.RequireFromString("0.002")) {
+			t.Errorf("bridgeSpread() with %q = %s, want the default", spread, got)
+		}
+	}
+}
+
+func TestBridgedMatch(t *testing.T) {
+	t.Setenv("P2P_CROSS_PAIR_MATCHING", "true")
+	t.Setenv("P2P_CURRENCY_BRIDGES", "")
+	t.Setenv("P2P_BRIDGE_SPREAD", "")
+
+	buy := Order{ID: "buy-1", Type: "BUY", CurrencyFrom: "BOB", CurrencyTo: "USD",
+		RemainingAmount: decimal.NewFromInt(100), Rate: decimal.RequireFromString("6.95")}
+	sell := Order{ID: "sell-1", Type: "SELL", CurrencyFrom: "USDT", CurrencyTo: "BOB",
+		RemainingAmount: decimal.NewFromInt(50), Rate: decimal.RequireFromString("6.90")}
+
+	e := &MatchingEngine{}
+	if !e.canMatch(buy, sell) {
+		t.Fatal("USD buyer not matched against a USDT seller")
+	}
+
+	match := e.createMatch(sell, buy)
+	if match.Bridge == nil || match.Bridge.From != "USDT" || match.Bridge.To != "USD" {
+		t.Fatalf("match bridge = %+v, want USDT into USD", match.Bridge)
+	}
+	// 50 USDT deliver 49.9 USD after the spread; the seller gives up all 50
+	if !match.Amount.Equal(decimal.RequireFromString("49.9")) || !match.SellAmount.Equal(decimal.NewFromInt(50)) {
+		t.Errorf("match amounts = %s USD / %s USDT, want 49.9 / 50", match.Amount, match.SellAmount)
+	}
+	// 6.90 BOB per USDT is 6.90 / 0.998 per USD
+	if want := decimal.RequireFromString("6.91382766"); !match.Rate.Equal(want) {
+		t.Errorf("match rate = %s, want %s", match.Rate, want)
+	}
+
+	// The spread can price a seller out of a buyer's limit
+	buy.Rate = decimal.RequireFromString("6.91")
+	if e.canMatch(buy, sell) {
+		t.Error("matched although the bridged rate is above the buyer's limit")
+	}
+
+	t.Setenv("P2P_CROSS_PAIR_MATCHING", "false")
+	buy.Rate = decimal.RequireFromString("6.95")
+	if e.canMatch(buy, sell) {
+		t.Error("bridged match with cross-pair matching off")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// Buyer funding: when a deposit opened for a BUY order clears, the wallet service moves the
+// order's cost from the buyer's balance to locked_balance in the deposit transaction and records
+// it in orders.buyer_locked_amount; a MARKET BUY order locks its cost the same way when it
+// executes. Settlement takes the cost from locked_balance, and a cancellation returns it to the
+// balance. Orders without the lock settle from balance.
+
+// buyerLockedAmount returns the amount locked in the buyer's wallet when the order was funded
+func buyerLockedAmount(tx *sql.Tx, orderID string) (decimal.Decimal, error) {
+	var amount decimal.Decimal
+	err := tx.QueryRow(`SELECT COALESCE(buyer_locked_amount, 0) FROM orders WHERE id = $1`, orderID).Scan(&amount)
+	return amount, err
+}
+
+// lockBuyerFunds moves amount from the buyer's balance to locked_balance and records it on the order
+func lockBuyerFunds(tx *sql.Tx, order Order, amount decimal.Decimal) error {
+	result, err := tx.Exec(`
+		UPDATE wallets
+		SET balance = balance - $1, locked_balance = COALESCE(locked_balance, 0) + $1, updated_at = NOW()
+		WHERE user_id = $2 AND currency = $3 AND balance >= $1
+	`, amount, order.UserID, order.CurrencyFrom)
+	if err != nil {
+		return fmt.Errorf("failed to lock buyer funds: %v", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return fmt.Errorf("insufficient %s balance. Required: %s", order.CurrencyFrom, amount.String())
+	}
+
+	_, err = tx.Exec(`UPDATE orders SET buyer_locked_amount = $2 WHERE id = $1`, order.ID, amount)
+	if err != nil {
+		return fmt.Errorf("failed to record buyer lock: %v", err)
+	}
+	return nil
+}
+
+// debitBuyer takes what a BUY order costs from the buyer's wallet at settlement: from the locked
+// balance when a deposit funded it, otherwise from the balance
+func debitBuyer(tx *sql.Tx, order Order, amount decimal.Decimal) error {
+	locked, err := buyerLockedAmount(tx, order.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load buyer lock: %v", err)
+	}
+
+	query := `
+		UPDATE wallets
+		SET balance = balance - $1, updated_at = NOW()
+		WHERE user_id = $2 AND currency = $3 AND balance >= $1
+	`
+	if locked.IsPositive() {
+		query = `
+			UPDATE wallets
+			SET locked_balance = locked_balance - $1, updated_at = NOW()
+			WHERE user_id = $2 AND currency = $3 AND locked_balance >= $1
+		`
+	}
+
+	result, err := tx.Exec(query, amount, order.UserID, order.CurrencyFrom)
+	if err != nil {
+		return fmt.Errorf("failed to deduct %s from buyer wallet: %v", order.CurrencyFrom, err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return fmt.Errorf("insufficient %s balance for buyer (required: %s)", order.CurrencyFrom, amount.String())
+	}
+	return nil
+}
+
+// unlockBuyerFunds returns the buyer's locked amount to their balance when a funded BUY order is
+// cancelled
+func unlockBuyerFunds(tx *sql.Tx, order Order) error {
+	locked, err := buyerLockedAmount(tx, order.ID)
+	if err != nil || !locked.IsPositive() {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE wallets
+		SET balance = balance + $1, locked_balance = locked_balance - $1, updated_at = NOW()
+		WHERE user_id = $2 AND currency = $3 AND locked_balance >= $1
+	`, locked, order.UserID, order.CurrencyFrom)
+	if err != nil {
+		return fmt.Errorf("failed to unlock buyer funds: %v", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return fmt.Errorf("locked %s funds not found for buyer (expected: %s)", order.CurrencyFrom, locked.String())
+	}
+
+	_, err = tx.Exec(`UPDATE orders SET buyer_locked_amount = NULL WHERE id = $1`, order.ID)
+	return err
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+)
+
+func TestDebitBuyer(t *testing.T) {
+	order := Order{ID: "order-1", UserID: "user-1", Type: "BUY", CurrencyFrom: "BOB", CurrencyTo: "USD"}
+	cost := decimal.RequireFromString("690")
+
+	tests := []struct {
+		name   string
+		locked string
+		debit  string
+	}{
+		{name: "funded order settles from the locked balance", locked: "690",
+			debit: `SET locked_balance = locked_balance - \$1, updated_at = NOW\(\)\s+WHERE user_id = \$2 AND currency = \$3 AND locked_balance >= \$1`},
+		{name: "unfunded order settles from the balance", locked: "0",
+			debit: `SET balance = balance - \$1, updated_at = NOW\(\)\s+WHERE user_id = \$2 AND currency = \$3 AND balance >= \$1`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT COALESCE\(buyer_locked_amount, 0\) FROM orders`).WithArgs("order-1").
+				WillReturnRows(sqlmock.NewRows([]string{"buyer_locked_amount"}).AddRow(tt.locked))
+			mock.ExpectExec(tt.debit).WithArgs(cost, "user-1", "BOB").WillReturnResult(sqlmock.NewResult(0, 1))
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := debitBuyer(tx, order, cost); err != nil {
+				t.Fatalf("debitBuyer() error = %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestUnlockBuyerFunds(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	order := Order{ID: "order-1", UserID: "user-1", Type: "BUY", CurrencyFrom: "BOB"}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT COALESCE\(buyer_locked_amount, 0\) FROM orders`).WithArgs("order-1").
+		WillReturnRows(sqlmock.NewRows([]string{"buyer_locked_amount"}).AddRow("690"))
+	mock.ExpectExec(`SET balance = balance \+ \$1, locked_balance = locked_balance - \$1`).
+		WithArgs(decimal.RequireFromString("690"), "user-1", "BOB").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE orders SET buyer_locked_amount = NULL`).WithArgs("order-1").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unlockBuyerFunds(tx, order); err != nil {
+		t.Fatalf("unlockBuyerFunds() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLockBuyerFunds(t *testing.T) {
+	order := Order{ID: "order-1", UserID: "user-1", Type: "BUY", CurrencyFrom: "BOB", CurrencyTo: "USD"}
+	cost := decimal.RequireFromString("690")
+	lockSQL := `SET balance = balance - \$1, locked_balance = COALESCE\(locked_balance, 0\) \+ \$1, updated_at = NOW\(\)\s+WHERE user_id = \$2 AND currency = \$3 AND balance >= \$1`
+
+	t.Run("locks the cost and records it on the order", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(lockSQL).WithArgs(cost, "user-1", "BOB").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE orders SET buyer_locked_amount = \$2 WHERE id = \$1`).WithArgs("order-1", cost).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := lockBuyerFunds(tx, order, cost); err != nil {
+			t.Fatalf("lockBuyerFunds() error = %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("refuses a balance that no longer covers the cost", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(lockSQL).WithArgs(cost, "user-1", "BOB").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := lockBuyerFunds(tx, order, cost); err == nil {
+			t.Fatal("lockBuyerFunds() succeeded without the balance to cover the cost")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"time"
@@ -13,16 +12,17 @@ import (
 
 // Cashier handlers
 
-// handleGetPendingOrders returns all orders waiting for cashier acceptance
+// handleGetPendingOrders returns the orders waiting for acceptance within the cashier's order limits
 func (s *Server) handleGetPendingOrders(c *gin.Context) {
-	orders, err := s.engine.GetPendingOrders()
+	cashierID := c.GetString("user_id")
+	orders, err := s.engine.GetPendingOrders(cashierID)
 	if err != nil {
-		log.Printf("Error getting pending orders: %v", err)
+		requestLog(c).Printf("Error getting pending orders: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get pending orders"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"orders": orders})
+	c.JSON(http.StatusOK, gin.H{"orders": orders, "online": s.engine.cashierOnline(cashierID)})
 }
 
 // handleAcceptOrder allows a cashier to accept a pending order
@@ -35,15 +35,30 @@ func (s *Server) handleAcceptOrder(c *gin.Context) {
 		return
 	}
 
-	err := s.engine.AcceptOrder(orderID, cashierID)
+	err := s.engine.AcceptOrder(orderID, cashierID, c.GetString("request_id"))
 	if err != nil {
-		log.Printf("Error accepting order: %v", err)
+		requestLog(c).Printf("Error accepting order: %v", err)
 		
 		// Return appropriate status based on error type
 		if err.Error() == "order is not available for acceptance" {
 			c.JSON(http.StatusConflict, gin.H{"error": "Order is no longer available"})
 			return
 		}
+		if err == errCashierSuspended {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Your account is suspended from accepting new orders",
+				"code":  "CASHIER_SUSPENDED",
+			})
+			return
+		}
+		if err == errOrderOutsideCashierLimits {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Order size is outside your accepted range"})
+			return
+		}
+		if err == errInsufficientSellerBalance {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The seller no longer has enough unlocked balance for this order"})
+			return
+		}
 		if err.Error() == "insufficient cashier balance" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient balance to accept this order"})
 			return
@@ -68,7 +83,7 @@ func (s *Server) handleConfirmPayment(c *gin.Context) {
 
 	err := s.engine.ConfirmPayment(orderID, cashierID)
 	if err != nil {
-		log.Printf("Error confirming payment: %v", err)
+		requestLog(c).Printf("Error confirming payment: %v", err)
 		
 		if err.Error() == "order not found or not assigned to this cashier" {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Order not assigned to you or not found"})
@@ -114,7 +129,7 @@ func (s *Server) handleGetCashierOrders(c *gin.Context) {
 
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		log.Printf("Error getting cashier orders: %v", err)
+		requestLog(c).Printf("Error getting cashier orders: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get orders"})
 		return
 	}
@@ -189,7 +204,7 @@ func (s *Server) handleGetCashierMetrics(c *gin.Context) {
 		&metrics.VolumeUSD, &metrics.VolumeBOB, &metrics.AvgCompletionMinutes)
 
 	if err != nil {
-		log.Printf("Error getting cashier metrics: %v", err)
+		requestLog(c).Printf("Error getting cashier metrics: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get metrics"})
 		return
 	}
@@ -199,5 +214,12 @@ func (s *Server) handleGetCashierMetrics(c *gin.Context) {
 		metrics.CompletionRate = float64(metrics.CompletedOrders) / float64(metrics.TotalOrders) * 100
 	}
 
-	c.JSON(http.StatusOK, gin.H{"metrics": metrics})
+	presence, err := s.engine.cashierPresence(cashierID)
+	if err != nil {
+		requestLog(c).Printf("Error getting cashier availability: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get metrics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"metrics": metrics, "availability": presence})
 }
\ No newline at end of file
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// Cashiers can restrict the order sizes they are offered, per currency. The size of an order is
+// what the cashier has to pay out: the amount for BUY orders and amount*rate for SELL orders,
+// both in CurrencyTo. A max of 0 means no upper bound.
+
+type CashierOrderLimit struct {
+	Currency  string          `json:"currency"`
+	MinAmount decimal.Decimal `json:"min_amount"`
+	MaxAmount decimal.Decimal `json:"max_amount"`
+}
+
+type CashierOrderLimitRequest struct {
+	Currency  string  `json:"currency" binding:"required"`
+	MinAmount float64 `json:"min_amount" binding:"gte=0"`
+	MaxAmount float64 `json:"max_amount" binding:"gte=0"`
+}
+
+var errOrderOutsideCashierLimits = fmt.Errorf("order size is outside your accepted range")
+
+// cashierOrderSize returns the currency and amount the cashier pays out for the order
+func cashierOrderSize(order Order) (string, decimal.Decimal) {
+	if order.Type == "SELL" {
+		return order.CurrencyTo, order.Amount.Mul(order.Rate)
+	}
+	return order.CurrencyTo, order.Amount
+}
+
+func (l CashierOrderLimit) allows(amount decimal.Decimal) bool {
+	if amount.LessThan(l.MinAmount) {
+		return false
+	}
+	return l.MaxAmount.IsZero() || amount.LessThanOrEqual(l.MaxAmount)
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// loadCashierOrderLimits returns the cashier's limits keyed by currency
+func loadCashierOrderLimits(db queryer, cashierID string) (map[string]CashierOrderLimit, error) {
+	rows, err := db.Query(`
+		SELECT currency, min_amount, max_amount
+		FROM cashier_order_limits
+		WHERE cashier_id = $1
+	`, cashierID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	limits := make(map[string]CashierOrderLimit)
+	for rows.Next() {
+		var limit CashierOrderLimit
+		if err := rows.Scan(&limit.Currency, &limit.MinAmount, &limit.MaxAmount); err == nil {
+			limits[limit.Currency] = limit
+		}
+	}
+	return limits, nil
+}
+
+// withinCashierLimits reports whether the order fits the cashier's configured range
+func withinCashierLimits(limits map[string]CashierOrderLimit, order Order) bool {
+	currency, amount := cashierOrderSize(order)
+	limit, ok := limits[currency]
+	return !ok || limit.allows(amount)
+}
+
+func (s *Server) handleGetCashierOrderLimits(c *gin.Context) {
+	cashierID := c.GetString("user_id")
+
+	limits, err := loadCashierOrderLimits(s.db, cashierID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get order limits"})
+		return
+	}
+
+	result := []CashierOrderLimit{}
+	for _, limit := range limits {
+		result = append(result, limit)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"limits": result})
+}
+
+func (s *Server) handleSetCashierOrderLimit(c *gin.Context) {
+	cashierID := c.GetString("user_id")
+
+	var req CashierOrderLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	currency := strings.ToUpper(req.Currency)
+	if _, ok := defaultCurrencyPrecision[currency]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported currency"})
+		return
+	}
+	if req.MaxAmount > 0 && req.MaxAmount < req.MinAmount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_amount must be greater than min_amount"})
+		return
+	}
+
+	limit := CashierOrderLimit{
+		Currency:  currency,
+		MinAmount: decimal.NewFromFloat(req.MinAmount),
+		MaxAmount: decimal.NewFromFloat(req.MaxAmount),
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO cashier_order_limits (cashier_id, currency, min_amount, max_amount, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (cashier_id, currency)
+		DO UPDATE SET min_amount = $3, max_amount = $4, updated_at = NOW()
+	`, cashierID, limit.Currency, limit.MinAmount, limit.MaxAmount)
+	if err != nil {
+		requestLog(c).Printf("Error saving cashier order limit: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save order limit"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"limit": limit})
+}
+
+func (s *Server) handleDeleteCashierOrderLimit(c *gin.Context) {
+	cashierID := c.GetString("user_id")
+	currency := strings.ToUpper(c.Param("currency"))
+
+	_, err := s.db.Exec(`
+		DELETE FROM cashier_order_limits WHERE cashier_id = $1 AND currency = $2
+	`, cashierID, currency)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete order limit"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Order limit removed"})
+}
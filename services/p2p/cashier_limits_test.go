@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/shopspring/decimal"
+)
+
+// expectCashierOrderLimits expects cashier-1's limits: 100-1000 BOB and at least 50 USD with no maximum
+func expectCashierOrderLimits(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`FROM cashier_order_limits\s+WHERE cashier_id = \$1`).WithArgs("cashier-1").
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "min_amount", "max_amount"}).
+			AddRow("BOB", "100", "1000").
+			AddRow("USD", "50", "0"))
+}
+
+func TestWithinCashierLimits(t *testing.T) {
+	limits := map[string]CashierOrderLimit{
+		"BOB": {Currency: "BOB", MinAmount: decimal.NewFromInt(100), MaxAmount: decimal.NewFromInt(1000)},
+	}
+	order := func(orderType, currencyTo, amount string) Order {
+		return Order{Type: orderType, CurrencyTo: currencyTo, Amount: decimal.RequireFromString(amount),
+			Rate: decimal.RequireFromString("6.9")}
+	}
+
+	tests := []struct {
+		name  string
+		order Order
+		want  bool
+	}{
+		{name: "SELL paid out inside the range", order: order("SELL", "BOB", "100"), want: true},        // 690 BOB
+		{name: "SELL paid out above the maximum", order: order("SELL", "BOB", "145"), want: false},      // 1000.5 BOB
+		{name: "SELL paid out at the maximum", order: order("SELL", "BOB", "144.92753623"), want: true}, // 999.99 BOB
+		{name: "BUY below the minimum", order: order("BUY", "BOB", "99.99"), want: false},
+		{name: "BUY at the minimum", order: order("BUY", "BOB", "100"), want: true},
+		{name: "currency without limits", order: order("BUY", "USD", "1"), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withinCashierLimits(limits, tt.order); got != tt.want {
+				t.Errorf("withinCashierLimits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPendingOrdersOutsideCashierLimitsAreFiltered(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	online := func() {
+		mock.ExpectQuery(`SELECT id FROM users WHERE id::text = ANY\(\$1\)`).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("cashier-1"))
+	}
+	online()
+	expectCashierOrderLimits(mock)
+	rows := sqlmock.NewRows([]string{"id", "user_id", "order_type", "currency_from", "currency_to", "amount",
+		"remaining_amount", "rate", "min_amount", "max_amount", "payment_methods", "status", "created_at"})
+	for _, order := range []struct{ id, orderType, from, to, amount string }{
+		{"sell-in-range", "SELL", "USD", "BOB", "100"},  // pays out 690 BOB
+		{"sell-too-large", "SELL", "USD", "BOB", "200"}, // 1380 BOB
+		{"sell-too-small", "SELL", "USD", "BOB", "10"},  // 69 BOB
+		{"buy-too-small", "BUY", "BOB", "USD", "20"},
+		{"buy-no-maximum", "BUY", "BOB", "USD", "5000"},
+	} {
+		rows.AddRow(order.id, "user-1", order.orderType, order.from, order.to, order.amount, order.amount, "6.9",
+			"0", "0", `["QR"]`, "PENDING", time.Now())
+	}
+	mock.ExpectQuery(`FROM orders\s+WHERE status = 'PENDING'`).WillReturnRows(rows)
+	online()
+
+	// cashier-1 switched availability on and has a live heartbeat
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	mr.Set(cashierHeartbeatKey("cashier-1"), "1")
+
+	engine := NewMatchingEngine(db, client, nil)
+	engine.notifier.channels = nil
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/cashier/pending-orders", nil)
+	c.Set("user_id", "cashier-1")
+	(&Server{db: db, engine: engine}).handleGetPendingOrders(c)
+
+	var response struct {
+		Orders []Order `json:"orders"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("response = %d %s: %v", w.Code, w.Body.String(), err)
+	}
+	var ids []string
+	for _, order := range response.Orders {
+		ids = append(ids, order.ID)
+	}
+	if len(ids) != 2 || ids[0] != "sell-in-range" || ids[1] != "buy-no-maximum" {
+		t.Errorf("pending orders = %v, want only sell-in-range and buy-no-maximum", ids)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAcceptOrderOutsideCashierLimitsIsRejected(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM orders WHERE id = \$1 FOR UPDATE`).WithArgs("order-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "order_type", "currency_from", "currency_to", "amount",
+			"remaining_amount", "rate", "status", "is_sandbox"}).
+			AddRow("order-1", "user-1", "SELL", "USD", "BOB", "200", "200", "6.9", "PENDING", false))
+	mock.ExpectQuery(`FROM orders o, users u`).WithArgs("order-1", "cashier-1").
+		WillReturnRows(sqlmock.NewRows([]string{"mismatch"}).AddRow(false))
+	mock.ExpectQuery(`FROM cashier_suspensions WHERE cashier_id = \$1 AND lifted_at IS NULL`).WithArgs("cashier-1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	expectCashierOrderLimits(mock)
+	mock.ExpectRollback()
+
+	engine := NewMatchingEngine(db, nil, nil)
+	engine.notifier.channels = nil
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/cashier/orders/order-1/accept", nil)
+	c.Params = gin.Params{{Key: "id", Value: "order-1"}}
+	c.Set("user_id", "cashier-1")
+	(&Server{db: db, engine: engine}).handleAcceptOrder(c)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("accept = %d %s, want 400 for an order paying out 1380 BOB", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
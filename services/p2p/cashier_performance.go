@@ -0,0 +1,273 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Performance history for trend charts: orders, completion rate, average completion time,
+// volume per currency and rating, bucketed by day, week or month over a range such as 30d,
+// 12w or 12m, plus lifetime totals. Orders are bucketed by when the cashier accepted them;
+// ratings come from the daily cashier_metrics rows. Volumes are summed in Postgres and
+// returned as strings so no precision is lost.
+
+var performanceIntervals = map[string]bool{"day": true, "week": true, "month": true}
+
+// Longest history returned per interval, so a request cannot ask for years of daily buckets
+var maxPerformanceBuckets = map[string]int{"day": 366, "week": 260, "month": 120}
+
+type PerformanceBucket struct {
+	Period               time.Time         `json:"period"`
+	TotalOrders          int               `json:"total_orders"`
+	CompletedOrders      int               `json:"completed_orders"`
+	CompletionRate       float64           `json:"completion_rate"`
+	AvgCompletionMinutes *float64          `json:"avg_completion_minutes"`
+	Volume               map[string]string `json:"volume"`
+	AvgRating            *float64          `json:"avg_rating"`
+}
+
+// parsePerformanceRange turns "30d", "12w", "12m" or "2y" into the start of the range
+func parsePerformanceRange(value string, now time.Time) (time.Time, error) {
+	if len(value) < 2 {
+		return time.Time{}, fmt.Errorf("range must look like 30d, 12w, 12m or 2y")
+	}
+	count, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || count <= 0 {
+		return time.Time{}, fmt.Errorf("range must look like 30d, 12w, 12m or 2y")
+	}
+	switch value[len(value)-1] {
+	case 'd':
+		return now.AddDate(0, 0, -count), nil
+	case 'w':
+		return now.AddDate(0, 0, -7*count), nil
+	case 'm':
+		return now.AddDate(0, -count, 0), nil
+	case 'y':
+		return now.AddDate(-count, 0, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("range must look like 30d, 12w, 12m or 2y")
+}
+
+// performanceBucketCount approximates how many buckets a range spans
+func performanceBucketCount(interval string, from, to time.Time) int {
+	days := int(to.Sub(from).Hours()/24) + 1
+	switch interval {
+	case "week":
+		return days/7 + 1
+	case "month":
+		return days/30 + 1
+	}
+	return days
+}
+
+// handleGetCashierPerformance serves the calling cashier's history
+func (s *Server) handleGetCashierPerformance(c *gin.Context) {
+	s.respondCashierPerformance(c, c.GetString("user_id"))
+}
+
+// handleAdminGetCashierPerformance serves any cashier's history to admins
+func (s *Server) handleAdminGetCashierPerformance(c *gin.Context) {
+	cashierID := c.Param("id")
+
+	var isCashier bool
+	err := s.db.QueryRow(`SELECT COALESCE(is_cashier, false) FROM users WHERE id = $1`, cashierID).Scan(&isCashier)
+	if err == sql.ErrNoRows || (err == nil && !isCashier) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cashier not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load cashier"})
+		return
+	}
+
+	s.respondCashierPerformance(c, cashierID)
+}
+
+func (s *Server) respondCashierPerformance(c *gin.Context, cashierID string) {
+	interval := c.DefaultQuery("interval", "month")
+	if !performanceIntervals[interval] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be day, week or month"})
+		return
+	}
+
+	rangeParam := strings.ToLower(c.DefaultQuery("range", "12m"))
+	now := time.Now()
+	from, err := parsePerformanceRange(rangeParam, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if performanceBucketCount(interval, from, now) > maxPerformanceBuckets[interval] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("range is too long for interval %s, at most %d buckets", interval, maxPerformanceBuckets[interval])})
+		return
+	}
+
+	buckets, err := s.cashierPerformanceBuckets(cashierID, interval, from)
+	if err != nil {
+		requestLog(c).Printf("Error getting cashier performance for %s: %v", cashierID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get performance history"})
+		return
+	}
+
+	lifetime, err := s.cashierLifetimePerformance(cashierID)
+	if err != nil {
+		requestLog(c).Printf("Error getting cashier lifetime performance for %s: %v", cashierID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get performance history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cashier_id": cashierID,
+		"interval":   interval,
+		"range":      rangeParam,
+		"from":       from,
+		"to":         now,
+		"buckets":    buckets,
+		"lifetime":   lifetime,
+	})
+}
+
+// cashierPerformanceBuckets returns one bucket per interval since from, empty ones included
+func (s *Server) cashierPerformanceBuckets(cashierID, interval string, from time.Time) ([]PerformanceBucket, error) {
+	rows, err := s.db.Query(`
+		WITH buckets AS (
+			SELECT generate_series(date_trunc($2, $3::timestamptz), date_trunc($2, NOW()), ('1 ' || $2)::interval) AS period
+		)
+		SELECT b.period,
+			COUNT(o.id),
+			COUNT(o.id) FILTER (WHERE o.status = 'COMPLETED'),
+			AVG(EXTRACT(EPOCH FROM (o.updated_at - o.accepted_at))/60) FILTER (WHERE o.status = 'COMPLETED' AND o.accepted_at IS NOT NULL)
+		FROM buckets b
+		LEFT JOIN orders o ON o.cashier_id = $1
+			AND date_trunc($2, COALESCE(o.accepted_at, o.created_at)) = b.period
+		GROUP BY b.period
+		ORDER BY b.period ASC
+	`, cashierID, interval, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []PerformanceBucket{}
+	index := make(map[time.Time]int)
+	for rows.Next() {
+		bucket := PerformanceBucket{Volume: map[string]string{}}
+		if err := rows.Scan(&bucket.Period, &bucket.TotalOrders, &bucket.CompletedOrders, &bucket.AvgCompletionMinutes); err != nil {
+			return nil, err
+		}
+		if bucket.TotalOrders > 0 {
+			bucket.CompletionRate = float64(bucket.CompletedOrders) / float64(bucket.TotalOrders) * 100
+		}
+		index[bucket.Period.UTC()] = len(buckets)
+		buckets = append(buckets, bucket)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Completed volume per currency the customer paid in
+	volumeRows, err := s.db.Query(`
+		SELECT date_trunc($2, COALESCE(accepted_at, created_at)) AS period, currency_from, SUM(amount)::text
+		FROM orders
+		WHERE cashier_id = $1 AND status = 'COMPLETED'
+			AND COALESCE(accepted_at, created_at) >= date_trunc($2, $3::timestamptz)
+		GROUP BY period, currency_from
+	`, cashierID, interval, from)
+	if err != nil {
+		return nil, err
+	}
+	defer volumeRows.Close()
+	for volumeRows.Next() {
+		var period time.Time
+		var currency, volume string
+		if err := volumeRows.Scan(&period, &currency, &volume); err != nil {
+			return nil, err
+		}
+		if i, ok := index[period.UTC()]; ok {
+			buckets[i].Volume[currency] = volume
+		}
+	}
+
+	ratingRows, err := s.db.Query(`
+		SELECT date_trunc($2, date::timestamptz) AS period, AVG(customer_rating)::float8
+		FROM cashier_metrics
+		WHERE cashier_id = $1 AND customer_rating IS NOT NULL
+			AND date >= date_trunc($2, $3::timestamptz)::date
+		GROUP BY period
+	`, cashierID, interval, from)
+	if err != nil {
+		return nil, err
+	}
+	defer ratingRows.Close()
+	for ratingRows.Next() {
+		var period time.Time
+		var rating float64
+		if err := ratingRows.Scan(&period, &rating); err != nil {
+			return nil, err
+		}
+		if i, ok := index[period.UTC()]; ok {
+			buckets[i].AvgRating = &rating
+		}
+	}
+
+	return buckets, nil
+}
+
+// cashierLifetimePerformance summarizes every order the cashier ever accepted
+func (s *Server) cashierLifetimePerformance(cashierID string) (gin.H, error) {
+	var total, completed int
+	var avgMinutes, avgRating *float64
+	var firstOrderAt *time.Time
+	err := s.db.QueryRow(`
+		SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE status = 'COMPLETED'),
+			AVG(EXTRACT(EPOCH FROM (updated_at - accepted_at))/60) FILTER (WHERE status = 'COMPLETED' AND accepted_at IS NOT NULL),
+			MIN(COALESCE(accepted_at, created_at)),
+			(SELECT AVG(customer_rating)::float8 FROM cashier_metrics WHERE cashier_id = $1 AND customer_rating IS NOT NULL)
+		FROM orders
+		WHERE cashier_id = $1
+	`, cashierID).Scan(&total, &completed, &avgMinutes, &firstOrderAt, &avgRating)
+	if err != nil {
+		return nil, err
+	}
+
+	volume := map[string]string{}
+	rows, err := s.db.Query(`
+		SELECT currency_from, SUM(amount)::text
+		FROM orders
+		WHERE cashier_id = $1 AND status = 'COMPLETED'
+		GROUP BY currency_from
+	`, cashierID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currency, amount string
+		if err := rows.Scan(&currency, &amount); err == nil {
+			volume[currency] = amount
+		}
+	}
+
+	completionRate := 0.0
+	if total > 0 {
+		completionRate = float64(completed) / float64(total) * 100
+	}
+
+	return gin.H{
+		"total_orders":           total,
+		"completed_orders":       completed,
+		"completion_rate":        completionRate,
+		"avg_completion_minutes": avgMinutes,
+		"volume":                 volume,
+		"avg_rating":             avgRating,
+		"first_order_at":         firstOrderAt,
+	}, nil
+}
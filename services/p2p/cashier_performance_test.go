@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+func getCashierPerformance(s *Server, query string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/cashier/performance?"+query, nil)
+	c.Set("user_id", "cashier-1")
+	s.handleGetCashierPerformance(c)
+	return w
+}
+
+func TestCashierPerformanceBucketsMonths(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	july := time.Date(2026, time.July, 1, 0, 0, 0, 0, time.UTC)
+	august, september := july.AddDate(0, 1, 0), july.AddDate(0, 2, 0)
+	minutes := func(value float64) *float64 { return &value }
+
+	// July: 3 of 4 orders completed; August: none; September: 4 of 5
+	mock.ExpectQuery(`WITH buckets AS .+ generate_series`).WithArgs("cashier-1", "month", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"period", "count", "completed", "avg"}).
+			AddRow(july, int64(4), int64(3), 12.5).
+			AddRow(august, int64(0), int64(0), nil).
+			AddRow(september, int64(5), int64(4), 8.0))
+	mock.ExpectQuery(`SELECT date_trunc\(\$2, COALESCE\(accepted_at, created_at\)\) AS period, currency_from, SUM\(amount\)::text`).
+		WithArgs("cashier-1", "month", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"period", "currency_from", "sum"}).
+			AddRow(july, "BOB", "1380.50").
+			AddRow(july, "USD", "100").
+			AddRow(september, "BOB", "2070.00000001"))
+	mock.ExpectQuery(`FROM cashier_metrics\s+WHERE cashier_id = \$1 AND customer_rating IS NOT NULL\s+AND date >=`).
+		WithArgs("cashier-1", "month", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"period", "avg"}).AddRow(september, 4.5))
+	mock.ExpectQuery(`SELECT COUNT\(\*\),\s+COUNT\(\*\) FILTER \(WHERE status = 'COMPLETED'\)`).WithArgs("cashier-1").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "completed", "avg", "min", "rating"}).
+			AddRow(int64(9), int64(7), 10.0, july, 4.5))
+	mock.ExpectQuery(`SELECT currency_from, SUM\(amount\)::text\s+FROM orders`).WithArgs("cashier-1").
+		WillReturnRows(sqlmock.NewRows([]string{"currency_from", "sum"}).
+			AddRow("BOB", "3450.50000001").
+			AddRow("USD", "100"))
+
+	w := getCashierPerformance(&Server{db: db}, "interval=month&range=3m")
+
+	var response struct {
+		Buckets  []PerformanceBucket `json:"buckets"`
+		Lifetime struct {
+			TotalOrders    int               `json:"total_orders"`
+			CompletionRate float64           `json:"completion_rate"`
+			Volume         map[string]string `json:"volume"`
+		} `json:"lifetime"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("response = %d %s: %v", w.Code, w.Body.String(), err)
+	}
+
+	want := []struct {
+		period     time.Time
+		rate       float64
+		avgMinutes *float64
+		volume     map[string]string
+		rated      bool
+	}{
+		{july, 75, minutes(12.5), map[string]string{"BOB": "1380.50", "USD": "100"}, false},
+		{august, 0, nil, map[string]string{}, false},
+		{september, 80, minutes(8), map[string]string{"BOB": "2070.00000001"}, true},
+	}
+	if len(response.Buckets) != len(want) {
+		t.Fatalf("buckets = %+v, want %d", response.Buckets, len(want))
+	}
+	for i, bucket := range response.Buckets {
+		w := want[i]
+		if !bucket.Period.Equal(w.period) || bucket.CompletionRate != w.rate {
+			t.Errorf("bucket %d = %s at %.1f%%, want %s at %.1f%%", i, bucket.Period, bucket.CompletionRate, w.period, w.rate)
+		}
+		if (bucket.AvgCompletionMinutes == nil) != (w.avgMinutes == nil) ||
+			(w.avgMinutes != nil && *bucket.AvgCompletionMinutes != *w.avgMinutes) {
+			t.Errorf("bucket %d avg_completion_minutes = %v, want %v", i, bucket.AvgCompletionMinutes, w.avgMinutes)
+		}
+		if len(bucket.Volume) != len(w.volume) {
+			t.Errorf("bucket %d volume = %v, want %v", i, bucket.Volume, w.volume)
+		}
+		for currency, volume := range w.volume {
+			if bucket.Volume[currency] != volume {
+				t.Errorf("bucket %d %s volume = %q, want %s", i, currency, bucket.Volume[currency], volume)
+			}
+		}
+		if (bucket.AvgRating != nil) != w.rated {
+			t.Errorf("bucket %d avg_rating = %v, want rated %v", i, bucket.AvgRating, w.rated)
+		}
+	}
+
+	if response.Lifetime.TotalOrders != 9 || response.Lifetime.Volume["BOB"] != "3450.50000001" ||
+		response.Lifetime.CompletionRate < 77.77 || response.Lifetime.CompletionRate > 77.78 {
+		t.Errorf("lifetime = %+v, want 9 orders at 77.8%% and 3450.50000001 BOB", response.Lifetime)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCashierPerformanceRejectsInvalidRanges(t *testing.T) {
+	for _, query := range []string{"interval=year", "range=12x", "range=0m", "interval=day&range=2y"} {
+		if w := getCashierPerformance(&Server{}, query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d, want 400", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/lib/pq"
+)
+
+// Cashier availability: a cashier is online while they have switched availability on with
+// POST /cashier/availability (users.is_available) and their heartbeat key is alive in Redis.
+// Heartbeats come from POST /cashier/heartbeat and from the pongs of an open /cashier/stream; the
+// key expires CASHIER_HEARTBEAT_TTL seconds (default 90) after the last one, so a cashier whose
+// app crashed or lost its connection drops offline without doing anything. Offline cashiers get
+// no pending orders, no stream pushes and no new order notifications. When Redis cannot be read
+// the availability switch alone decides, so a Redis outage does not take every cashier offline.
+
+const defaultCashierHeartbeatTTL = 90 * time.Second
+
+func cashierHeartbeatTTL() time.Duration {
+	if value, err := strconv.Atoi(os.Getenv("CASHIER_HEARTBEAT_TTL")); err == nil && value > 0 {
+		return time.Duration(value) * time.Second
+	}
+	return defaultCashierHeartbeatTTL
+}
+
+func cashierHeartbeatKey(cashierID string) string {
+	return "cashier:heartbeat:" + cashierID
+}
+
+type CashierPresence struct {
+	IsAvailable bool       `json:"is_available"`
+	Online      bool       `json:"online"`
+	LastSeenAt  *time.Time `json:"last_seen_at,omitempty"`
+	ChangedAt   *time.Time `json:"availability_changed_at,omitempty"`
+}
+
+func (e *MatchingEngine) cashierAvailable(cashierID string) (bool, error) {
+	var available bool
+	err := e.db.QueryRow(`SELECT COALESCE(is_available, false) FROM users WHERE id = $1`, cashierID).Scan(&available)
+	return available, err
+}
+
+// cashierHeartbeat records the cashier as seen now when they are available; it returns whether
+// they are online afterwards
+func (e *MatchingEngine) cashierHeartbeat(cashierID string) (bool, error) {
+	available, err := e.cashierAvailable(cashierID)
+	if err != nil || !available {
+		return false, err
+	}
+
+	ctx := context.Background()
+	if err := e.redis.Set(ctx, cashierHeartbeatKey(cashierID), time.Now().Unix(), cashierHeartbeatTTL()).Err(); err != nil {
+		log.Printf("⚠️ Failed to record heartbeat of cashier %s: %v", cashierID, err)
+	}
+	return true, nil
+}
+
+// cashierOnline reports whether the cashier should be offered orders
+func (e *MatchingEngine) cashierOnline(cashierID string) bool {
+	online, err := e.onlineCashiers([]string{cashierID})
+	if err != nil {
+		log.Printf("Error checking availability of cashier %s: %v", cashierID, err)
+		return false
+	}
+	return online[cashierID]
+}
+
+// onlineCashiers returns which of the given cashiers are online
+func (e *MatchingEngine) onlineCashiers(cashierIDs []string) (map[string]bool, error) {
+	online := make(map[string]bool)
+	if len(cashierIDs) == 0 {
+		return online, nil
+	}
+
+	rows, err := e.db.Query(`
+		SELECT id FROM users WHERE id::text = ANY($1) AND COALESCE(is_available, false) = true
+	`, pq.Array(cashierIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var available []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		available = append(available, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(available) == 0 {
+		return online, nil
+	}
+
+	ctx := context.Background()
+	pipe := e.redis.Pipeline()
+	heartbeats := make([]*redis.IntCmd, len(available))
+	for i, id := range available {
+		heartbeats[i] = pipe.Exists(ctx, cashierHeartbeatKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ Cashier heartbeats unavailable, using the availability switch only: %v", err)
+		for _, id := range available {
+			online[id] = true
+		}
+		return online, nil
+	}
+
+	for i, id := range available {
+		if heartbeats[i].Val() > 0 {
+			online[id] = true
+		}
+	}
+	return online, nil
+}
+
+func (e *MatchingEngine) cashierPresence(cashierID string) (CashierPresence, error) {
+	var presence CashierPresence
+	var changedAt sql.NullTime
+	err := e.db.QueryRow(`
+		SELECT COALESCE(is_available, false), availability_changed_at FROM users WHERE id = $1
+	`, cashierID).Scan(&presence.IsAvailable, &changedAt)
+	if err != nil {
+		return presence, err
+	}
+	if changedAt.Valid {
+		presence.ChangedAt = &changedAt.Time
+	}
+
+	if seen, err := e.redis.Get(context.Background(), cashierHeartbeatKey(cashierID)).Int64(); err == nil {
+		lastSeen := time.Unix(seen, 0)
+		presence.LastSeenAt = &lastSeen
+	}
+	presence.Online = presence.IsAvailable && presence.LastSeenAt != nil
+	return presence, nil
+}
+
+// handleSetCashierAvailability switches the cashier on or off; switching on counts as a heartbeat
+func (s *Server) handleSetCashierAvailability(c *gin.Context) {
+	cashierID := c.GetString("user_id")
+
+	var req struct {
+		Available *bool `json:"available" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := s.db.Exec(`
+		UPDATE users SET is_available = $2, availability_changed_at = NOW() WHERE id = $1
+	`, cashierID, *req.Available)
+	if err != nil {
+		requestLog(c).Printf("Error updating availability of cashier %s: %v", cashierID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update availability"})
+		return
+	}
+
+	if *req.Available {
+		s.engine.cashierHeartbeat(cashierID)
+	} else {
+		s.redis.Del(context.Background(), cashierHeartbeatKey(cashierID))
+	}
+	requestLog(c).Printf("🟢 Cashier %s availability set to %t", cashierID, *req.Available)
+
+	// Open streams switch between the pending orders and an empty list
+	s.cashierStream.resyncCashier(cashierID)
+
+	presence, err := s.engine.cashierPresence(cashierID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load availability"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"availability": presence})
+}
+
+func (s *Server) handleCashierHeartbeat(c *gin.Context) {
+	cashierID := c.GetString("user_id")
+
+	online, err := s.engine.cashierHeartbeat(cashierID)
+	if err != nil {
+		requestLog(c).Printf("Error recording heartbeat of cashier %s: %v", cashierID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record heartbeat"})
+		return
+	}
+
+	response := gin.H{
+		"online":      online,
+		"ttl_seconds": int(cashierHeartbeatTTL().Seconds()),
+	}
+	if !online {
+		response["message"] = "Availability is off; enable it with POST /cashier/availability to receive orders"
+	}
+	c.JSON(http.StatusOK, response)
+}
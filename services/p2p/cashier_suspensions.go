@@ -0,0 +1,368 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Automatic cashier suspension: every CASHIER_SUSPENSION_CHECK_MINUTES the engine looks at each
+// cashier's orders accepted in the last CASHIER_SUSPENSION_WINDOW_DAYS and suspends those whose
+// share of disputed orders exceeds CASHIER_MAX_DISPUTE_RATE percent or whose average rating is
+// below CASHIER_MIN_RATING, once they have CASHIER_SUSPENSION_MIN_ORDERS orders in the window.
+// A suspended cashier cannot accept new orders; the ones already accepted settle as usual. The
+// cashier is notified and admins get a CASHIER_SUSPENDED system alert. Only an admin lifts a
+// suspension, and the window then restarts at the lift so old disputes do not suspend again.
+
+const (
+	defaultSuspensionCheckMinutes = 15
+	defaultSuspensionWindowDays   = 30
+	defaultMaxDisputeRate         = 10.0
+	defaultMinCashierRating       = 3.0
+	defaultSuspensionMinOrders    = 10
+	suspensionAlertSource         = "p2p.cashier_policy"
+)
+
+var errCashierSuspended = fmt.Errorf("cashier is suspended")
+
+// CashierSuspensionPolicy holds the thresholds; a zero MaxDisputeRate or MinRating disables
+// that check
+type CashierSuspensionPolicy struct {
+	WindowDays     int     `json:"window_days"`
+	MaxDisputeRate float64 `json:"max_dispute_rate"`
+	MinRating      float64 `json:"min_rating"`
+	MinOrders      int     `json:"min_orders"`
+}
+
+type CashierSuspension struct {
+	ID            string     `json:"id"`
+	CashierID     string     `json:"cashier_id"`
+	Reason        string     `json:"reason"`
+	OrdersCount   int        `json:"orders_count"`
+	DisputedCount int        `json:"disputed_count"`
+	DisputeRate   *float64   `json:"dispute_rate"`
+	AvgRating     *float64   `json:"avg_rating"`
+	SuspendedAt   time.Time  `json:"suspended_at"`
+	LiftedAt      *time.Time `json:"lifted_at,omitempty"`
+	LiftedBy      *string    `json:"lifted_by,omitempty"`
+	LiftNote      *string    `json:"lift_note,omitempty"`
+}
+
+// cashierActivity is a cashier's record over the policy window
+type cashierActivity struct {
+	CashierID string
+	Orders    int
+	Disputed  int
+	AvgRating *float64
+}
+
+func (a cashierActivity) disputeRate() float64 {
+	if a.Orders == 0 {
+		return 0
+	}
+	return float64(a.Disputed) / float64(a.Orders) * 100
+}
+
+func envFloat(name string, fallback float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil && value >= 0 {
+		return value
+	}
+	return fallback
+}
+
+func envInt(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value >= 0 {
+		return value
+	}
+	return fallback
+}
+
+func loadCashierSuspensionPolicy() CashierSuspensionPolicy {
+	policy := CashierSuspensionPolicy{
+		WindowDays:     envInt("CASHIER_SUSPENSION_WINDOW_DAYS", defaultSuspensionWindowDays),
+		MaxDisputeRate: envFloat("CASHIER_MAX_DISPUTE_RATE", defaultMaxDisputeRate),
+		MinRating:      envFloat("CASHIER_MIN_RATING", defaultMinCashierRating),
+		MinOrders:      envInt("CASHIER_SUSPENSION_MIN_ORDERS", defaultSuspensionMinOrders),
+	}
+	if policy.WindowDays == 0 {
+		policy.WindowDays = defaultSuspensionWindowDays
+	}
+	return policy
+}
+
+// suspensionReason returns why the activity crosses the policy, or "" when it does not
+func (p CashierSuspensionPolicy) suspensionReason(activity cashierActivity) string {
+	if activity.Orders == 0 || activity.Orders < p.MinOrders {
+		return ""
+	}
+
+	var reasons []string
+	if p.MaxDisputeRate > 0 && activity.disputeRate() > p.MaxDisputeRate {
+		reasons = append(reasons, fmt.Sprintf("dispute rate %.1f%% (%d of %d orders) above %.1f%%",
+			activity.disputeRate(), activity.Disputed, activity.Orders, p.MaxDisputeRate))
+	}
+	if p.MinRating > 0 && activity.AvgRating != nil && *activity.AvgRating < p.MinRating {
+		reasons = append(reasons, fmt.Sprintf("average rating %.2f below %.2f", *activity.AvgRating, p.MinRating))
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// cashierSuspended reports whether the cashier has a suspension in force
+func cashierSuspended(q interface {
+	QueryRow(string, ...interface{}) *sql.Row
+}, cashierID string) (bool, error) {
+	var suspended bool
+	err := q.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM cashier_suspensions WHERE cashier_id = $1 AND lifted_at IS NULL)
+	`, cashierID).Scan(&suspended)
+	return suspended, err
+}
+
+// runCashierSuspensionPolicy evaluates the policy on every tick until the process exits
+func (e *MatchingEngine) runCashierSuspensionPolicy() {
+	minutes := envInt("CASHIER_SUSPENSION_CHECK_MINUTES", defaultSuspensionCheckMinutes)
+	if minutes == 0 {
+		log.Println("🚫 Automatic cashier suspension disabled")
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(minutes) * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := e.suspendCashiersOverPolicy(loadCashierSuspensionPolicy()); err != nil {
+			log.Printf("❌ Cashier suspension check failed: %v", err)
+		}
+	}
+}
+
+// cashierActivities returns the window record of every active cashier not already suspended;
+// the window starts at the later of its usual start and the cashier's last lifted suspension
+func (e *MatchingEngine) cashierActivities(windowStart time.Time) ([]cashierActivity, error) {
+	rows, err := e.db.Query(`
+		SELECT u.id, COALESCE(a.orders, 0), COALESCE(a.disputed, 0), r.rating
+		FROM users u
+		CROSS JOIN LATERAL (
+			SELECT GREATEST($1::timestamptz, COALESCE(MAX(lifted_at), $1::timestamptz)) AS since
+			FROM cashier_suspensions WHERE cashier_id = u.id
+		) w
+		LEFT JOIN LATERAL (
+			SELECT COUNT(*) AS orders,
+				COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM disputes d WHERE d.order_id = o.id)) AS disputed
+			FROM orders o
+			WHERE o.cashier_id = u.id AND o.accepted_at >= w.since
+		) a ON true
+		LEFT JOIN LATERAL (
+			SELECT AVG(customer_rating)::float8 AS rating
+			FROM cashier_metrics
+			WHERE cashier_id = u.id AND customer_rating IS NOT NULL AND date >= w.since::date
+		) r ON true
+		WHERE u.is_cashier = true
+		  AND COALESCE(u.is_sandbox, false) = false
+		  AND NOT EXISTS (SELECT 1 FROM cashier_suspensions s WHERE s.cashier_id = u.id AND s.lifted_at IS NULL)
+	`, windowStart)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activities []cashierActivity
+	for rows.Next() {
+		var activity cashierActivity
+		if err := rows.Scan(&activity.CashierID, &activity.Orders, &activity.Disputed, &activity.AvgRating); err != nil {
+			return nil, err
+		}
+		activities = append(activities, activity)
+	}
+	return activities, rows.Err()
+}
+
+// suspendCashiersOverPolicy suspends every cashier crossing the policy and returns the new
+// suspensions
+func (e *MatchingEngine) suspendCashiersOverPolicy(policy CashierSuspensionPolicy) ([]CashierSuspension, error) {
+	windowStart := time.Now().AddDate(0, 0, -policy.WindowDays)
+	activities, err := e.cashierActivities(windowStart)
+	if err != nil {
+		return nil, err
+	}
+
+	suspensions := []CashierSuspension{}
+	for _, activity := range activities {
+		reason := policy.suspensionReason(activity)
+		if reason == "" {
+			continue
+		}
+
+		suspension, err := e.suspendCashier(activity, reason)
+		if err == sql.ErrNoRows {
+			// Suspended by another replica since the scan
+			continue
+		}
+		if err != nil {
+			log.Printf("Error suspending cashier %s: %v", activity.CashierID, err)
+			continue
+		}
+		suspensions = append(suspensions, suspension)
+	}
+
+	log.Printf("🚫 Cashier suspension check: %d cashiers evaluated, %d suspended", len(activities), len(suspensions))
+	return suspensions, nil
+}
+
+const cashierSuspensionColumns = `id, cashier_id, reason, orders_count, disputed_count, dispute_rate::float8,
+	avg_rating::float8, suspended_at, lifted_at, lifted_by, lift_note`
+
+func scanCashierSuspension(row interface{ Scan(...interface{}) error }) (CashierSuspension, error) {
+	var suspension CashierSuspension
+	err := row.Scan(&suspension.ID, &suspension.CashierID, &suspension.Reason, &suspension.OrdersCount,
+		&suspension.DisputedCount, &suspension.DisputeRate, &suspension.AvgRating, &suspension.SuspendedAt,
+		&suspension.LiftedAt, &suspension.LiftedBy, &suspension.LiftNote)
+	return suspension, err
+}
+
+// suspendCashier records the suspension, notifies the cashier and alerts admins
+func (e *MatchingEngine) suspendCashier(activity cashierActivity, reason string) (CashierSuspension, error) {
+	suspension, err := scanCashierSuspension(e.db.QueryRow(`
+		INSERT INTO cashier_suspensions (cashier_id, reason, orders_count, disputed_count, dispute_rate, avg_rating)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (cashier_id) WHERE lifted_at IS NULL DO NOTHING
+		RETURNING `+cashierSuspensionColumns,
+		activity.CashierID, reason, activity.Orders, activity.Disputed, activity.disputeRate(), activity.AvgRating))
+	if err != nil {
+		return suspension, err
+	}
+
+	log.Printf("🚫 Cashier %s suspended: %s", activity.CashierID, reason)
+
+	e.notifier.Notify(NotificationEvent{
+		UserID:  activity.CashierID,
+		Type:    eventCashierSuspended,
+		Message: fmt.Sprintf("You can no longer accept new orders: %s. Orders you already accepted can still be completed. Contact support to review the suspension", reason),
+	})
+	raiseSystemAlert(e.db, "WARNING", suspensionAlertSource, "CASHIER_SUSPENDED",
+		"cashier_suspended:"+suspension.ID,
+		fmt.Sprintf("Cashier %s was suspended automatically: %s", activity.CashierID, reason),
+		map[string]interface{}{
+			"cashier_id":    activity.CashierID,
+			"suspension_id": suspension.ID,
+			"orders":        activity.Orders,
+			"disputed":      activity.Disputed,
+			"dispute_rate":  activity.disputeRate(),
+			"avg_rating":    activity.AvgRating,
+		})
+
+	return suspension, nil
+}
+
+// handleGetCashierSuspension tells the cashier whether they are suspended and why
+func (s *Server) handleGetCashierSuspension(c *gin.Context) {
+	cashierID := c.GetString("user_id")
+
+	suspension, err := scanCashierSuspension(s.db.QueryRow(`
+		SELECT `+cashierSuspensionColumns+` FROM cashier_suspensions
+		WHERE cashier_id = $1 AND lifted_at IS NULL
+	`, cashierID))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, gin.H{"suspended": false, "policy": loadCashierSuspensionPolicy()})
+		return
+	}
+	if err != nil {
+		requestLog(c).Printf("Error loading suspension of cashier %s: %v", cashierID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load suspension"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suspended": true, "suspension": suspension, "policy": loadCashierSuspensionPolicy()})
+}
+
+// handleAdminGetCashierSuspensions lists suspensions, only those in force unless ?status=ALL
+func (s *Server) handleAdminGetCashierSuspensions(c *gin.Context) {
+	query := `SELECT ` + cashierSuspensionColumns + ` FROM cashier_suspensions`
+	if c.Query("status") != "ALL" {
+		query += ` WHERE lifted_at IS NULL`
+	}
+	query += ` ORDER BY suspended_at DESC LIMIT 200`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		requestLog(c).Printf("Error listing cashier suspensions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list suspensions"})
+		return
+	}
+	defer rows.Close()
+
+	suspensions := []CashierSuspension{}
+	for rows.Next() {
+		suspension, err := scanCashierSuspension(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list suspensions"})
+			return
+		}
+		suspensions = append(suspensions, suspension)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suspensions": suspensions, "policy": loadCashierSuspensionPolicy()})
+}
+
+// handleAdminRunCashierSuspensions evaluates the policy now and returns the new suspensions
+func (s *Server) handleAdminRunCashierSuspensions(c *gin.Context) {
+	suspensions, err := s.engine.suspendCashiersOverPolicy(loadCashierSuspensionPolicy())
+	if err != nil {
+		requestLog(c).Printf("Error running cashier suspension check: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run suspension check"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suspensions": suspensions, "total": len(suspensions)})
+}
+
+// handleAdminUnsuspendCashier lifts the cashier's suspension in force
+func (s *Server) handleAdminUnsuspendCashier(c *gin.Context) {
+	cashierID := c.Param("id")
+	adminID := c.GetString("user_id")
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	suspension, err := scanCashierSuspension(s.db.QueryRow(`
+		UPDATE cashier_suspensions SET lifted_at = NOW(), lifted_by = $2, lift_note = NULLIF($3, '')
+		WHERE cashier_id = $1 AND lifted_at IS NULL
+		RETURNING `+cashierSuspensionColumns,
+		cashierID, adminID, strings.TrimSpace(req.Note)))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cashier is not suspended"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Printf("Error lifting suspension of cashier %s: %v", cashierID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lift suspension"})
+		return
+	}
+
+	requestLog(c).Printf("✅ Suspension of cashier %s lifted by admin %s", cashierID, adminID)
+	s.recordAuditLog(c, adminID, "CASHIER_UNSUSPEND", "user", cashierID, map[string]interface{}{
+		"suspension_id": suspension.ID,
+		"note":          strings.TrimSpace(req.Note),
+	})
+	s.engine.notifier.Notify(NotificationEvent{
+		UserID:  cashierID,
+		Type:    eventCashierReinstated,
+		Message: "Your suspension was lifted: you can accept new orders again",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"suspension": suspension})
+}
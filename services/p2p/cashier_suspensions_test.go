@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+var testSuspensionPolicy = CashierSuspensionPolicy{WindowDays: 30, MaxDisputeRate: 10, MinRating: 3, MinOrders: 10}
+
+func TestSuspensionReason(t *testing.T) {
+	rating := func(value float64) *float64 { return &value }
+	tests := []struct {
+		name     string
+		activity cashierActivity
+		want     string // substring of the reason, empty when the cashier stays active
+	}{
+		{name: "dispute rate above the threshold", activity: cashierActivity{Orders: 10, Disputed: 2},
+			want: "dispute rate 20.0% (2 of 10 orders) above 10.0%"},
+		{name: "dispute rate at the threshold", activity: cashierActivity{Orders: 10, Disputed: 1}},
+		{name: "too few orders to judge", activity: cashierActivity{Orders: 9, Disputed: 9}},
+		{name: "low rating", activity: cashierActivity{Orders: 10, AvgRating: rating(2.5)},
+			want: "average rating 2.50 below 3.00"},
+		{name: "no ratings yet", activity: cashierActivity{Orders: 10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := testSuspensionPolicy.suspensionReason(tt.activity)
+			if (tt.want == "") != (got == "") || !strings.Contains(got, tt.want) {
+				t.Errorf("suspensionReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCashierOverDisputeRateIsSuspendedAndCannotAccept(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// cashier-1 had 3 of 10 orders disputed; cashier-2 1 of 10, exactly the threshold
+	mock.ExpectQuery(`FROM users u\s+CROSS JOIN LATERAL`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "orders", "disputed", "rating"}).
+			AddRow("cashier-1", 10, 3, 4.5).
+			AddRow("cashier-2", 10, 1, nil))
+	mock.ExpectQuery(`INSERT INTO cashier_suspensions`).
+		WithArgs("cashier-1", sqlmock.AnyArg(), 10, 3, 30.0, 4.5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "cashier_id", "reason", "orders_count", "disputed_count",
+			"dispute_rate", "avg_rating", "suspended_at", "lifted_at", "lifted_by", "lift_note"}).
+			AddRow("suspension-1", "cashier-1", "dispute rate 30.0% (3 of 10 orders) above 10.0%", 10, 3, 30.0, 4.5,
+				time.Now(), nil, nil, nil))
+	mock.ExpectExec(`INSERT INTO user_notifications`).
+		WithArgs("cashier-1", eventCashierSuspended, sqlmock.AnyArg(), sqlmock.AnyArg(), 1, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO system_alerts`).
+		WithArgs("WARNING", suspensionAlertSource, "CASHIER_SUSPENDED", "cashier_suspended:suspension-1",
+			sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	engine := NewMatchingEngine(db, nil, nil)
+	engine.notifier.channels = nil
+	suspensions, err := engine.suspendCashiersOverPolicy(testSuspensionPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suspensions) != 1 || suspensions[0].CashierID != "cashier-1" {
+		t.Fatalf("suspensions = %+v, want cashier-1 only", suspensions)
+	}
+
+	// The suspension is in force when cashier-1 tries to take a new order
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM orders WHERE id = \$1 FOR UPDATE`).WithArgs("order-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "order_type", "currency_from", "currency_to", "amount",
+			"remaining_amount", "rate", "status", "is_sandbox"}).
+			AddRow("order-1", "user-1", "BUY", "BOB", "USD", "100", "100", "6.9", "PENDING", false))
+	mock.ExpectQuery(`FROM orders o, users u`).WithArgs("order-1", "cashier-1").
+		WillReturnRows(sqlmock.NewRows([]string{"mismatch"}).AddRow(false))
+	mock.ExpectQuery(`FROM cashier_suspensions WHERE cashier_id = \$1 AND lifted_at IS NULL`).WithArgs("cashier-1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/cashier/orders/order-1/accept", nil)
+	c.Params = gin.Params{{Key: "id", Value: "order-1"}}
+	c.Set("user_id", "cashier-1")
+	(&Server{db: db, engine: engine}).handleAcceptOrder(c)
+
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "CASHIER_SUSPENDED") {
+		t.Errorf("accept = %d %s, want 403 CASHIER_SUSPENDED", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Currencies the platform trades. SUPPORTED_CURRENCIES (default "USD,BOB,USDT") is read by the
+// p2p and wallet services alike; every ordered pair of two different supported currencies is a
+// tradable pair. Currency codes from requests are trimmed and upper-cased before being checked.
+
+const defaultSupportedCurrencies = "USD,BOB,USDT"
+
+func supportedCurrencies() []string {
+	value := os.Getenv("SUPPORTED_CURRENCIES")
+	if value == "" {
+		value = defaultSupportedCurrencies
+	}
+
+	var currencies []string
+	seen := make(map[string]bool)
+	for _, currency := range strings.Split(value, ",") {
+		currency = strings.ToUpper(strings.TrimSpace(currency))
+		if currency != "" && !seen[currency] {
+			seen[currency] = true
+			currencies = append(currencies, currency)
+		}
+	}
+	return currencies
+}
+
+func isSupportedCurrency(currency string) bool {
+	for _, supported := range supportedCurrencies() {
+		if supported == currency {
+			return true
+		}
+	}
+	return false
+}
+
+// supportedPairs lists every tradable pair as {from, to}
+func supportedPairs() [][2]string {
+	currencies := supportedCurrencies()
+	var pairs [][2]string
+	for _, from := range currencies {
+		for _, to := range currencies {
+			if from != to {
+				pairs = append(pairs, [2]string{from, to})
+			}
+		}
+	}
+	return pairs
+}
+
+// normalizePair upper-cases both currencies and checks they form a tradable pair
+func normalizePair(currencyFrom, currencyTo string) (string, string, error) {
+	from := strings.ToUpper(strings.TrimSpace(currencyFrom))
+	to := strings.ToUpper(strings.TrimSpace(currencyTo))
+
+	switch {
+	case !isSupportedCurrency(from):
+		return from, to, fmt.Errorf("unsupported currency %q", from)
+	case !isSupportedCurrency(to):
+		return from, to, fmt.Errorf("unsupported currency %q", to)
+	case from == to:
+		return from, to, fmt.Errorf("currency_from and currency_to must differ")
+	}
+	return from, to, nil
+}
+
+// bindPair normalizes the pair of a request, answering 400 when it is not tradable
+func bindPair(c *gin.Context, currencyFrom, currencyTo string) (string, string, bool) {
+	from, to, err := normalizePair(currencyFrom, currencyTo)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":                err.Error(),
+			"supported_currencies": supportedCurrencies(),
+		})
+		return "", "", false
+	}
+	return from, to, true
+}
+
+// bindPairQuery reads a pair written as FROM_TO (e.g. USD_BOB) from the pair query parameter
+func bindPairQuery(c *gin.Context) (string, string, bool) {
+	currencies := strings.SplitN(c.Query("pair"), "_", 2)
+	if len(currencies) != 2 || currencies[0] == "" || currencies[1] == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "pair is required, e.g. USD_BOB"})
+		return "", "", false
+	}
+	return bindPair(c, currencies[0], currencies[1])
+}
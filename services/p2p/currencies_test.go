@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestNormalizePair(t *testing.T) {
+	tests := []struct {
+		from, to         string
+		wantFrom, wantTo string
+		valid            bool
+	}{
+		{from: "USD", to: "BOB", wantFrom: "USD", wantTo: "BOB", valid: true},
+		{from: "usd", to: "bob", wantFrom: "USD", wantTo: "BOB", valid: true},
+		{from: " usdt ", to: "Usd", wantFrom: "USDT", wantTo: "USD", valid: true},
+		{from: "BOB", to: "USDT", wantFrom: "BOB", wantTo: "USDT", valid: true},
+		{from: "XYZ", to: "ABC"},
+		{from: "USD", to: "EUR"},
+		{from: "BOB", to: "bob"},
+		{from: "", to: "BOB"},
+	}
+
+	for _, tt := range tests {
+		from, to, err := normalizePair(tt.from, tt.to)
+		if (err == nil) != tt.valid {
+			t.Errorf("normalizePair(%q, %q) error = %v, want valid %v", tt.from, tt.to, err, tt.valid)
+		}
+		if tt.valid && (from != tt.wantFrom || to != tt.wantTo) {
+			t.Errorf("normalizePair(%q, %q) = %s/%s, want %s/%s", tt.from, tt.to, from, to, tt.wantFrom, tt.wantTo)
+		}
+	}
+}
+
+func TestSupportedCurrenciesFromEnvironment(t *testing.T) {
+	if pairs := supportedPairs(); len(pairs) != 6 {
+		t.Errorf("default pairs = %v, want every ordered pair of USD, BOB and USDT", pairs)
+	}
+
+	t.Setenv("SUPPORTED_CURRENCIES", " bob,EUR, bob ,")
+	if currencies := supportedCurrencies(); strings.Join(currencies, ",") != "BOB,EUR" {
+		t.Errorf("supportedCurrencies() = %v, want [BOB EUR]", currencies)
+	}
+	if _, _, err := normalizePair("eur", "bob"); err != nil {
+		t.Errorf("EUR/BOB rejected after being configured: %v", err)
+	}
+	if _, _, err := normalizePair("USD", "BOB"); err == nil {
+		t.Error("USD/BOB accepted after USD was removed from SUPPORTED_CURRENCIES")
+	}
+}
+
+func TestCreateOrderValidatesCurrencyPair(t *testing.T) {
+	tests := []struct {
+		name, from, to string
+		wantStatus     int
+	}{
+		{name: "unknown currencies", from: "XYZ", to: "ABC", wantStatus: http.StatusBadRequest},
+		{name: "one unknown currency", from: "USD", to: "ABC", wantStatus: http.StatusBadRequest},
+		{name: "same currency on both sides", from: "usd", to: "USD", wantStatus: http.StatusBadRequest},
+		// A supported pair reaches the KYC check, which fails here to stop the test
+		{name: "lower-case supported pair", from: "usd", to: "bob", wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if tt.wantStatus != http.StatusBadRequest {
+				mock.ExpectQuery(`SELECT COALESCE\(kyc_level, 0\) FROM users`).WithArgs("user-1").
+					WillReturnError(errors.New("connection reset"))
+			}
+
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"type":"SELL","currency_from":"`+
+				tt.from+`","currency_to":"`+tt.to+`","amount":100,"rate":6.9,"payment_methods":["QR"]}`))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Set("user_id", "user-1")
+			(&Server{db: db}).handleCreateOrder(c)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus == http.StatusBadRequest && !strings.Contains(w.Body.String(), `"supported_currencies":["USD","BOB","USDT"]`) {
+				t.Errorf("body = %s, want the supported currencies listed", w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestMarketEndpointsValidateCurrencyPair(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	// Only the normalized pair is cached, so a lower-case request must be upper-cased to hit it
+	mr.Set("orderbook:USD_BOB", `{"buy_orders":[],"sell_orders":[]}`)
+	s := &Server{engine: &MatchingEngine{redis: client}}
+
+	tests := []struct {
+		name       string
+		handler    gin.HandlerFunc
+		query      string
+		wantStatus int
+	}{
+		{name: "orderbook with a supported pair", handler: s.handleGetOrderBook,
+			query: "currency_from=usd&currency_to=bob", wantStatus: http.StatusOK},
+		{name: "orderbook with an unknown pair", handler: s.handleGetOrderBook,
+			query: "currency_from=XYZ&currency_to=ABC", wantStatus: http.StatusBadRequest},
+		{name: "market depth with a supported pair", handler: s.handleGetMarketDepth,
+			query: "currency_from=Usd&currency_to=Bob", wantStatus: http.StatusOK},
+		{name: "market depth with an unknown currency", handler: s.handleGetMarketDepth,
+			query: "currency_from=USD&currency_to=XYZ", wantStatus: http.StatusBadRequest},
+		{name: "market depth with the same currency", handler: s.handleGetMarketDepth,
+			query: "currency_from=BOB&currency_to=BOB", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+			tt.handler(c)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
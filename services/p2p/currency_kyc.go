@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkCurrencyKYC stops order creation when either currency of the pair needs a higher KYC level
+// than the user has (kyc_currency_requirements); currencies without a requirement are open to all
+func (s *Server) checkCurrencyKYC(c *gin.Context, userID string, currencies ...string) bool {
+	var level int
+	if err := s.db.QueryRow(`SELECT COALESCE(kyc_level, 0) FROM users WHERE id = $1`, userID).Scan(&level); err != nil {
+		log.Printf("Error loading KYC level of %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify KYC level"})
+		return false
+	}
+
+	for _, currency := range currencies {
+		currency = strings.ToUpper(currency)
+		var required int
+		err := s.db.QueryRow(`
+			SELECT COALESCE(MAX(min_kyc_level), 0) FROM kyc_currency_requirements WHERE currency = $1
+		`, currency).Scan(&required)
+		if err != nil {
+			log.Printf("Error loading KYC requirement for %s: %v", currency, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify KYC level"})
+			return false
+		}
+
+		if level < required {
+			requestLog(c).Printf("🚫 User %s (KYC level %d) cannot trade %s, requires level %d", userID, level, currency, required)
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":          fmt.Sprintf("Trading %s requires KYC level %d, your current level is %d", currency, required, level),
+				"code":           "KYC_LEVEL_REQUIRED",
+				"currency":       currency,
+				"kyc_level":      level,
+				"required_level": required,
+			})
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckCurrencyKYC(t *testing.T) {
+	tests := []struct {
+		name       string
+		from, to   string
+		required   map[string]int64 // per currency, in the order they are checked
+		wantStatus int
+	}{
+		{name: "USDT needs level 2", from: "USDT", to: "BOB", required: map[string]int64{"USDT": 2},
+			wantStatus: http.StatusForbidden},
+		{name: "either side of the pair", from: "BOB", to: "USDT", required: map[string]int64{"BOB": 0, "USDT": 2},
+			wantStatus: http.StatusForbidden},
+		{name: "BOB and USD open to level 1", from: "BOB", to: "USD", required: map[string]int64{"BOB": 0, "USD": 1},
+			wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(`SELECT COALESCE\(kyc_level, 0\) FROM users`).WithArgs("user-1").
+				WillReturnRows(sqlmock.NewRows([]string{"kyc_level"}).AddRow(1))
+			for _, currency := range []string{tt.from, tt.to} {
+				required, checked := tt.required[currency]
+				if !checked {
+					break
+				}
+				mock.ExpectQuery(`FROM kyc_currency_requirements`).WithArgs(currency).
+					WillReturnRows(sqlmock.NewRows([]string{"min_kyc_level"}).AddRow(required))
+			}
+
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/orders", nil)
+
+			allowed := (&Server{db: db}).checkCurrencyKYC(c, "user-1", strings.ToLower(tt.from), tt.to)
+			if allowed != (tt.wantStatus == http.StatusOK) {
+				t.Fatalf("checkCurrencyKYC() = %v, want the opposite", allowed)
+			}
+			if !allowed && (w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), `"currency":"USDT"`)) {
+				t.Errorf("response = %d %s, want %d for USDT", w.Code, w.Body.String(), tt.wantStatus)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -16,18 +16,22 @@ import (
 )
 
 type MatchingEngine struct {
-	db    *sql.DB
-	redis *redis.Client
+	db       *sql.DB
+	redis    *redis.Client
+	notifier *NotificationDispatcher
+	events   *OrderEventPublisher
 }
 
 type Match struct {
-	BuyOrder  Order           `json:"buy_order"`
-	SellOrder Order           `json:"sell_order"`
-	CashierID string          `json:"cashier_id"`
-	Amount    decimal.Decimal `json:"amount"`
-	Rate      decimal.Decimal `json:"rate"`
-	Status    string          `json:"status"`
-	MatchedAt time.Time       `json:"matched_at"`
+	BuyOrder   Order           `json:"buy_order"`
+	SellOrder  Order           `json:"sell_order"`
+	CashierID  string          `json:"cashier_id"`
+	Amount     decimal.Decimal `json:"amount"`      // in the buy order's base currency
+	SellAmount decimal.Decimal `json:"sell_amount"` // in the sell order's base currency
+	Rate       decimal.Decimal `json:"rate"`        // quote per unit of Amount
+	Bridge     *CurrencyBridge `json:"bridge,omitempty"`
+	Status     string          `json:"status"`
+	MatchedAt  time.Time       `json:"matched_at"`
 }
 
 type OrderBook struct {
@@ -35,10 +39,12 @@ type OrderBook struct {
 	SellOrders []Order `json:"sell_orders"`
 }
 
-func NewMatchingEngine(db *sql.DB, redis *redis.Client) *MatchingEngine {
+func NewMatchingEngine(db *sql.DB, redis *redis.Client, events *OrderEventPublisher) *MatchingEngine {
 	return &MatchingEngine{
-		db:    db,
-		redis: redis,
+		db:       db,
+		redis:    redis,
+		notifier: NewNotificationDispatcher(db),
+		events:   events,
 	}
 }
 
@@ -48,6 +54,21 @@ func (e *MatchingEngine) Start() {
 	// Start order book cache refresh
 	go e.refreshOrderBookCache()
 	
+	// Deliver coalesced notifications
+	go e.notifier.Start()
+	
+	// Turn dispute and KYC events into notifications
+	go e.notifier.ConsumeEvents()
+	
+	// Check settled orders and matches against the wallet ledger
+	go e.runReconciliation()
+	
+	// Cancel accepted orders the user never paid
+	go e.runPaymentWindowSweeper()
+	
+	// Suspend cashiers with too many disputes or too low a rating
+	go e.runCashierSuspensionPolicy()
+	
 	// Note: Removed automatic matching loop - cashiers now accept orders manually
 }
 
@@ -85,8 +106,8 @@ func (e *MatchingEngine) AddOrder(order Order) (string, error) {
 	// Insert order into database (both tables for consistency)
 	query := `
 		INSERT INTO orders (user_id, order_type, currency_from, currency_to, amount, 
-			remaining_amount, rate, min_amount, max_amount, payment_methods, status, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			remaining_amount, rate, min_amount, max_amount, payment_methods, status, created_at, is_sandbox)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 		RETURNING id
 	`
 	
@@ -115,7 +136,7 @@ func (e *MatchingEngine) AddOrder(order Order) (string, error) {
 	err := e.db.QueryRow(query,
 		order.UserID, order.Type, order.CurrencyFrom, order.CurrencyTo,
 		order.Amount, order.RemainingAmount, order.Rate, order.MinAmount, order.MaxAmount,
-		string(paymentMethodsJSON), order.Status, order.CreatedAt,
+		string(paymentMethodsJSON), order.Status, order.CreatedAt, order.IsSandbox,
 	).Scan(&order.ID)
 	
 	if err != nil {
@@ -128,15 +149,15 @@ func (e *MatchingEngine) AddOrder(order Order) (string, error) {
 	// Also insert into p2p_orders for backward compatibility
 	p2pQuery := `
 		INSERT INTO p2p_orders (id, user_id, order_type, currency_from, currency_to, amount, 
-			remaining_amount, rate, min_amount, max_amount, payment_methods, status, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			remaining_amount, rate, min_amount, max_amount, payment_methods, status, created_at, is_sandbox)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 		ON CONFLICT (id) DO NOTHING
 	`
 	
 	_, err = e.db.Exec(p2pQuery,
 		order.ID, order.UserID, order.Type, order.CurrencyFrom, order.CurrencyTo,
 		order.Amount, order.RemainingAmount, order.Rate, order.MinAmount, order.MaxAmount,
-		pgArray, order.Status, order.CreatedAt,
+		pgArray, order.Status, order.CreatedAt, order.IsSandbox,
 	)
 	
 	if err != nil {
@@ -146,14 +167,22 @@ func (e *MatchingEngine) AddOrder(order Order) (string, error) {
 	// Add to Redis cache for cashiers to see pending orders
 	e.cachePendingOrder(ctx, order)
 	
-	// Notify available cashiers (in real implementation, this would send notifications)
+	// Notify available cashiers
 	log.Printf("📝 New %s order created: %s (%s %s -> %s) - waiting for cashier acceptance", 
 		order.Type, order.ID, order.Amount.String(), order.CurrencyFrom, order.CurrencyTo)
+	if !order.IsSandbox {
+		go e.notifyCashiersOfOrder(order)
+	}
+	e.publishOrderEvent(orderEventCreated, order.ID, "")
 	
 	return order.ID, nil
 }
 
 func (e *MatchingEngine) cachePendingOrder(ctx context.Context, order Order) {
+	// Sandbox orders never reach the caches cashiers and the order book read
+	if order.IsSandbox {
+		return
+	}
 	orderJSON, _ := json.Marshal(order)
 	
 	// Cache pending orders for cashiers to see
@@ -168,6 +197,9 @@ func (e *MatchingEngine) cachePendingOrder(ctx context.Context, order Order) {
 }
 
 func (e *MatchingEngine) cacheOrder(ctx context.Context, order Order) {
+	if order.IsSandbox {
+		return
+	}
 	orderJSON, _ := json.Marshal(order)
 	
 	// Cache by currency pair and type for orderbook display
@@ -190,12 +222,27 @@ func (e *MatchingEngine) findMatches(newOrder Order) []Match {
 		oppositeType = "BUY"
 	}
 	
-	// Get cached orders of opposite type for the same currency pair
-	key := fmt.Sprintf("orders:%s_%s:%s", newOrder.CurrencyFrom, newOrder.CurrencyTo, oppositeType)
-	orders, err := e.redis.LRange(ctx, key, 0, -1).Result()
-	if err != nil {
-		log.Printf("Error getting cached orders: %v", err)
-		return matches
+	// Get cached orders of opposite type for the same currency pair, plus the bridged pairs
+	// when cross-pair matching is enabled
+	keys := []string{fmt.Sprintf("orders:%s_%s:%s", newOrder.CurrencyFrom, newOrder.CurrencyTo, oppositeType)}
+	if newOrder.Type == "BUY" {
+		for _, currency := range bridgedCurrencies(newOrder.CurrencyTo) {
+			keys = append(keys, fmt.Sprintf("orders:%s_%s:%s", currency, newOrder.CurrencyFrom, oppositeType))
+		}
+	} else {
+		for _, currency := range bridgedCurrencies(newOrder.CurrencyFrom) {
+			keys = append(keys, fmt.Sprintf("orders:%s_%s:%s", newOrder.CurrencyTo, currency, oppositeType))
+		}
+	}
+	
+	var orders []string
+	for _, key := range keys {
+		cached, err := e.redis.LRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			log.Printf("Error getting cached orders: %v", err)
+			continue
+		}
+		orders = append(orders, cached...)
 	}
 	
 	var candidateOrders []Order
@@ -213,16 +260,16 @@ func (e *MatchingEngine) findMatches(newOrder Order) []Match {
 		candidateOrders = append(candidateOrders, order)
 	}
 	
-	// Sort orders for optimal matching
+	// Sort orders for optimal matching, comparing bridged orders at their effective rate
 	if newOrder.Type == "BUY" {
 		// For buy orders, match with sell orders starting from lowest rate
 		sort.Slice(candidateOrders, func(i, j int) bool {
-			return candidateOrders[i].Rate.LessThan(candidateOrders[j].Rate)
+			return effectiveRate(newOrder, candidateOrders[i]).LessThan(effectiveRate(newOrder, candidateOrders[j]))
 		})
 	} else {
 		// For sell orders, match with buy orders starting from highest rate
 		sort.Slice(candidateOrders, func(i, j int) bool {
-			return candidateOrders[i].Rate.GreaterThan(candidateOrders[j].Rate)
+			return effectiveRate(newOrder, candidateOrders[i]).GreaterThan(effectiveRate(newOrder, candidateOrders[j]))
 		})
 	}
 	
@@ -232,8 +279,11 @@ func (e *MatchingEngine) findMatches(newOrder Order) []Match {
 			match := e.createMatch(newOrder, candidateOrder)
 			matches = append(matches, match)
 			
-			// Update remaining amount
+			// Update remaining amount, in the new order's own base currency
 			matchAmount := match.Amount
+			if newOrder.Type == "SELL" {
+				matchAmount = match.SellAmount
+			}
 			newOrder.RemainingAmount = newOrder.RemainingAmount.Sub(matchAmount)
 			
 			// If order is fully filled, stop matching
@@ -246,51 +296,83 @@ func (e *MatchingEngine) findMatches(newOrder Order) []Match {
 	return matches
 }
 
+// buySell orders two opposing orders as (buy, sell)
+func buySell(order1, order2 Order) (Order, Order, bool) {
+	if order1.Type == "BUY" && order2.Type == "SELL" {
+		return order1, order2, true
+	}
+	if order1.Type == "SELL" && order2.Type == "BUY" {
+		return order2, order1, true
+	}
+	return Order{}, Order{}, false
+}
+
+// sellRateForBuyer expresses the sell order's rate per unit of the buyer's base currency
+func sellRateForBuyer(sell Order, bridge *CurrencyBridge) decimal.Decimal {
+	if bridge == nil {
+		return sell.Rate
+	}
+	return sell.Rate.DivRound(bridge.Rate, 8)
+}
+
+// effectiveRate is the candidate's rate as seen from the new order's side of a match
+func effectiveRate(newOrder, candidate Order) decimal.Decimal {
+	buy, sell, ok := buySell(newOrder, candidate)
+	if !ok || candidate.Type == "BUY" {
+		return candidate.Rate
+	}
+	bridge, _ := matchBridge(buy, sell)
+	return sellRateForBuyer(sell, bridge)
+}
+
 func (e *MatchingEngine) canMatch(order1, order2 Order) bool {
-	// Check currency pair compatibility
-	if order1.CurrencyFrom != order2.CurrencyTo || order1.CurrencyTo != order2.CurrencyFrom {
+	buy, sell, ok := buySell(order1, order2)
+	if !ok {
 		return false
 	}
 	
-	// Check rate compatibility
-	if order1.Type == "BUY" && order2.Type == "SELL" {
-		// Buy order rate must be >= sell order rate
-		return order1.Rate.GreaterThanOrEqual(order2.Rate)
-	} else if order1.Type == "SELL" && order2.Type == "BUY" {
-		// Sell order rate must be <= buy order rate  
-		return order1.Rate.LessThanOrEqual(order2.Rate)
+	// Check currency pair compatibility, directly or through a bridge
+	bridge, ok := matchBridge(buy, sell)
+	if !ok {
+		return false
 	}
 	
-	return false
+	// Buy order rate must be >= sell order rate, both per unit of the buyer's base
+	return buy.Rate.GreaterThanOrEqual(sellRateForBuyer(sell, bridge))
 }
 
 func (e *MatchingEngine) createMatch(order1, order2 Order) Match {
-	// Determine match amount (minimum of remaining amounts)
-	matchAmount := order1.RemainingAmount
-	if order2.RemainingAmount.LessThan(matchAmount) {
-		matchAmount = order2.RemainingAmount
+	buyOrder, sellOrder, _ := buySell(order1, order2)
+	bridge, _ := matchBridge(buyOrder, sellOrder)
+	
+	// Match amount is the minimum of remaining amounts, in the buyer's base currency. A bridged
+	// seller delivers Amount / bridge rate of their own currency, the spread staying with the platform.
+	sellAvailable := sellOrder.RemainingAmount
+	if bridge != nil {
+		sellAvailable = sellAvailable.Mul(bridge.Rate).Round(8)
+	}
+	matchAmount := buyOrder.RemainingAmount
+	if sellAvailable.LessThan(matchAmount) {
+		matchAmount = sellAvailable
 	}
 	
-	// Determine match rate (maker's rate takes priority)
-	var matchRate decimal.Decimal
-	var buyOrder, sellOrder Order
-	
-	if order1.Type == "BUY" {
-		buyOrder = order1
-		sellOrder = order2
-		matchRate = order2.Rate // Sell order (maker) rate
-	} else {
-		buyOrder = order2
-		sellOrder = order1
-		matchRate = order1.Rate // Sell order (maker) rate
+	sellAmount := matchAmount
+	if bridge != nil {
+		sellAmount = matchAmount.DivRound(bridge.Rate, 8)
+		if sellAmount.GreaterThan(sellOrder.RemainingAmount) {
+			sellAmount = sellOrder.RemainingAmount
+		}
 	}
 	
+	// Sell order (maker) rate takes priority
 	return Match{
-		BuyOrder:  buyOrder,
-		SellOrder: sellOrder,
-		Amount:    matchAmount,
-		Rate:      matchRate,
-		MatchedAt: time.Now(),
+		BuyOrder:   buyOrder,
+		SellOrder:  sellOrder,
+		Amount:     matchAmount,
+		SellAmount: sellAmount,
+		Rate:       sellRateForBuyer(sellOrder, bridge),
+		Bridge:     bridge,
+		MatchedAt:  time.Now(),
 	}
 }
 
@@ -302,12 +384,38 @@ func (e *MatchingEngine) executeMatch(match Match) (string, error) {
 	}
 	defer tx.Rollback()
 	
+	matchID, err := recordMatch(tx, match)
+	if err != nil {
+		return "", err
+	}
+	
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return "", err
+	}
+	
+	e.matchExecuted(match, matchID)
+	return matchID, nil
+}
+
+// recordMatch inserts the match and takes its amounts from both orders in tx
+func recordMatch(tx *sql.Tx, match Match) (string, error) {
 	// Insert match record
 	matchID := fmt.Sprintf("match_%d", time.Now().UnixNano())
-	_, err = tx.Exec(`
-		INSERT INTO matches (id, buy_order_id, sell_order_id, amount, rate, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, matchID, match.BuyOrder.ID, match.SellOrder.ID, match.Amount, match.Rate, match.MatchedAt)
+	var bridgeFrom, bridgeTo sql.NullString
+	var bridgeRate, bridgeSpread decimal.NullDecimal
+	if match.Bridge != nil {
+		bridgeFrom = sql.NullString{String: match.Bridge.From, Valid: true}
+		bridgeTo = sql.NullString{String: match.Bridge.To, Valid: true}
+		bridgeRate = decimal.NullDecimal{Decimal: match.Bridge.Rate, Valid: true}
+		bridgeSpread = decimal.NullDecimal{Decimal: match.Bridge.Spread, Valid: true}
+	}
+	_, err := tx.Exec(`
+		INSERT INTO matches (id, buy_order_id, sell_order_id, amount, sell_amount, rate,
+			bridge_from, bridge_to, bridge_rate, bridge_spread, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, matchID, match.BuyOrder.ID, match.SellOrder.ID, match.Amount, match.SellAmount, match.Rate,
+		bridgeFrom, bridgeTo, bridgeRate, bridgeSpread, match.MatchedAt)
 	
 	if err != nil {
 		return "", err
@@ -324,29 +432,35 @@ func (e *MatchingEngine) executeMatch(match Match) (string, error) {
 		return "", err
 	}
 	
+	// The sell order gives up its own currency, which differs from Amount on bridged matches
 	_, err = tx.Exec(`
 		UPDATE orders SET remaining_amount = remaining_amount - $1,
 			status = CASE WHEN remaining_amount - $1 <= 0 THEN 'FILLED' ELSE 'ACTIVE' END
 		WHERE id = $2
-	`, match.Amount, match.SellOrder.ID)
+	`, match.SellAmount, match.SellOrder.ID)
 	
 	if err != nil {
 		return "", err
 	}
-	
-	// Commit transaction
-	if err = tx.Commit(); err != nil {
-		return "", err
-	}
-	
+	return matchID, nil
+}
+
+// matchExecuted updates the caches and announces a match once it is committed
+func (e *MatchingEngine) matchExecuted(match Match, matchID string) {
 	// Update Redis cache
 	e.removeOrderFromCache(match.BuyOrder.ID)
 	e.removeOrderFromCache(match.SellOrder.ID)
 	
 	log.Printf("✅ Match executed: %s (Amount: %s, Rate: %s)", 
 		matchID, match.Amount.String(), match.Rate.String())
+	if match.Bridge != nil {
+		log.Printf("🌉 Match %s bridged %s %s -> %s %s at %s (spread %s)", matchID,
+			match.SellAmount.String(), match.Bridge.From, match.Amount.String(), match.Bridge.To,
+			match.Bridge.Rate.String(), match.Bridge.Spread.String())
+	}
 	
-	return matchID, nil
+	e.publishOrderEvent(orderEventMatched, match.BuyOrder.ID, matchID)
+	e.publishOrderEvent(orderEventMatched, match.SellOrder.ID, matchID)
 }
 
 func (e *MatchingEngine) removeOrderFromCache(orderID string) {
@@ -445,17 +559,8 @@ func (e *MatchingEngine) refreshOrderBookCache() {
 	defer ticker.Stop()
 	
 	for range ticker.C {
-		// Refresh cache for popular currency pairs
-		pairs := [][]string{
-			{"USD", "BOB"},
-			{"BOB", "USD"},
-			{"USDT", "BOB"},
-			{"BOB", "USDT"},
-			{"USD", "USDT"},
-			{"USDT", "USD"},
-		}
-		
-		for _, pair := range pairs {
+		// Refresh cache for every tradable pair
+		for _, pair := range supportedPairs() {
 			e.GetOrderBook(pair[0], pair[1])
 		}
 	}
@@ -463,13 +568,24 @@ func (e *MatchingEngine) refreshOrderBookCache() {
 
 // Cashier system methods
 
-// GetPendingOrders returns all orders waiting for cashier acceptance
-func (e *MatchingEngine) GetPendingOrders() ([]Order, error) {
+// GetPendingOrders returns the orders waiting for acceptance that fit the cashier's order limits
+func (e *MatchingEngine) GetPendingOrders(cashierID string) ([]Order, error) {
+	// Offline cashiers are not offered orders
+	if !e.cashierOnline(cashierID) {
+		return []Order{}, nil
+	}
+	
+	limits, err := loadCashierOrderLimits(e.db, cashierID)
+	if err != nil {
+		return nil, err
+	}
+	
 	query := `
 		SELECT id, user_id, order_type, currency_from, currency_to, amount, remaining_amount,
 			rate, COALESCE(min_amount, 0), COALESCE(max_amount, 0), COALESCE(payment_methods, '[]'), status, created_at
 		FROM orders 
 		WHERE status = 'PENDING' AND (expires_at IS NULL OR expires_at > NOW())
+			AND COALESCE(is_sandbox, false) = false
 		ORDER BY created_at ASC
 	`
 	
@@ -492,6 +608,10 @@ func (e *MatchingEngine) GetPendingOrders() ([]Order, error) {
 			continue
 		}
 		
+		if !withinCashierLimits(limits, order) {
+			continue
+		}
+		
 		json.Unmarshal([]byte(paymentMethodsJSON), &order.PaymentMethods)
 		orders = append(orders, order)
 	}
@@ -500,7 +620,7 @@ func (e *MatchingEngine) GetPendingOrders() ([]Order, error) {
 }
 
 // AcceptOrder allows a cashier to accept a pending order
-func (e *MatchingEngine) AcceptOrder(orderID, cashierID string) error {
+func (e *MatchingEngine) AcceptOrder(orderID, cashierID, requestID string) error {
 	tx, err := e.db.Begin()
 	if err != nil {
 		return err
@@ -511,10 +631,10 @@ func (e *MatchingEngine) AcceptOrder(orderID, cashierID string) error {
 	var order Order
 	err = tx.QueryRow(`
 		SELECT id, user_id, order_type, currency_from, currency_to, amount, 
-			remaining_amount, rate, status
+			remaining_amount, rate, status, COALESCE(is_sandbox, false)
 		FROM orders WHERE id = $1 FOR UPDATE
 	`, orderID).Scan(&order.ID, &order.UserID, &order.Type, &order.CurrencyFrom, 
-		&order.CurrencyTo, &order.Amount, &order.RemainingAmount, &order.Rate, &order.Status)
+		&order.CurrencyTo, &order.Amount, &order.RemainingAmount, &order.Rate, &order.Status, &order.IsSandbox)
 	
 	if err != nil {
 		return fmt.Errorf("order not found: %v", err)
@@ -524,22 +644,54 @@ func (e *MatchingEngine) AcceptOrder(orderID, cashierID string) error {
 		return fmt.Errorf("order is not available for acceptance")
 	}
 	
-	// Verify cashier has sufficient balance for BUY orders
+	// Sandbox orders and sandbox cashiers never mix with real ones
+	var sandboxMismatch bool
+	err = tx.QueryRow(`
+		SELECT COALESCE(o.is_sandbox, false) <> COALESCE(u.is_sandbox, false)
+		FROM orders o, users u
+		WHERE o.id = $1 AND u.id = $2
+	`, orderID, cashierID).Scan(&sandboxMismatch)
+	
+	if err != nil || sandboxMismatch {
+		return fmt.Errorf("order is not available for acceptance")
+	}
+	
+	// Suspended cashiers keep settling their orders but cannot take new ones
+	suspended, err := cashierSuspended(tx, cashierID)
+	if err != nil {
+		return fmt.Errorf("failed to check cashier suspension: %v", err)
+	}
+	if suspended {
+		return errCashierSuspended
+	}
+	
+	// Respect the order sizes the cashier chose to accept
+	limits, err := loadCashierOrderLimits(tx, cashierID)
+	if err != nil {
+		return fmt.Errorf("failed to load cashier limits: %v", err)
+	}
+	if !withinCashierLimits(limits, order) {
+		return errOrderOutsideCashierLimits
+	}
+	
+	// BUY orders covered by the cashier's shift hold are already locked
+	var shiftHoldID sql.NullString
 	if order.Type == "BUY" {
+		holdID, err := drawFromShiftHold(tx, cashierID, order.CurrencyTo, order.Amount)
+		if err != nil {
+			return fmt.Errorf("failed to draw from shift hold: %v", err)
+		}
+		shiftHoldID = sql.NullString{String: holdID, Valid: holdID != ""}
+	}
+	
+	// Verify cashier has sufficient balance for BUY orders
+	if order.Type == "BUY" && !shiftHoldID.Valid {
 		var cashierBalance decimal.Decimal
-		var balanceColumn string
-		var lockedColumn string
 		
 		// Determinar columnas según la moneda de destino
-		switch order.CurrencyTo {
-		case "USD":
-			balanceColumn = "cashier_balance_usd"
-			lockedColumn = "cashier_locked_usd"
-		case "USDT":
-			balanceColumn = "cashier_balance_usdt"
-			lockedColumn = "cashier_locked_usdt"
-		default:
-			return fmt.Errorf("unsupported currency for cashier: %s", order.CurrencyTo)
+		balanceColumn, lockedColumn, err := cashierBalanceColumns(order.CurrencyTo)
+		if err != nil {
+			return err
 		}
 		
 		query := fmt.Sprintf(`SELECT COALESCE(%s, 0) FROM users WHERE id = $1 AND is_cashier = true`, balanceColumn)
@@ -568,15 +720,24 @@ func (e *MatchingEngine) AcceptOrder(orderID, cashierID string) error {
 		}
 	}
 	
-	// Update order with cashier assignment in both tables
-	_, err = tx.Exec(`
+	// Lock the seller's funds for SELL orders until the cashier confirms payment
+	if err = lockSellerFunds(tx, order); err != nil {
+		return err
+	}
+	
+	// Update order with cashier assignment in both tables. Orders already paid by a linked
+	// deposit skip MATCHED and wait for the cashier's confirmation right away.
+	var newStatus string
+	err = tx.QueryRow(`
 		UPDATE orders SET 
 			cashier_id = $1,
-			status = 'MATCHED',
+			status = CASE WHEN funded_at IS NOT NULL THEN 'PROCESSING' ELSE 'MATCHED' END,
 			accepted_at = NOW(),
-			updated_at = NOW()
+			updated_at = NOW(),
+			shift_hold_id = $3
 		WHERE id = $2
-	`, cashierID, orderID)
+		RETURNING status
+	`, cashierID, orderID, shiftHoldID).Scan(&newStatus)
 	
 	if err != nil {
 		return fmt.Errorf("failed to update order: %v", err)
@@ -586,11 +747,11 @@ func (e *MatchingEngine) AcceptOrder(orderID, cashierID string) error {
 	_, err = tx.Exec(`
 		UPDATE p2p_orders SET 
 			cashier_id = $1,
-			status = 'MATCHED',
+			status = $3,
 			accepted_at = NOW(),
 			updated_at = NOW()
 		WHERE id = $2
-	`, cashierID, orderID)
+	`, cashierID, orderID, newStatus)
 	
 	if err != nil {
 		// Log error but don't fail the transaction
@@ -613,14 +774,22 @@ func (e *MatchingEngine) AcceptOrder(orderID, cashierID string) error {
 	}
 	
 	// Create chat room for this transaction
-	go e.createTransactionChatRoom(orderID, order.UserID, cashierID)
+	go e.createTransactionChatRoom(requestID, orderID, order.UserID, cashierID)
 	
 	// Remove from pending cache and update order cache
 	e.removePendingOrderFromCache(orderID)
-	order.Status = "MATCHED"
+	order.Status = newStatus
 	e.cacheOrder(context.Background(), order)
 	
-	log.Printf("✅ Order accepted by cashier: Order %s accepted by cashier %s", orderID, cashierID)
+	taggedLog(requestID).Printf("✅ Order accepted by cashier: Order %s accepted by cashier %s", orderID, cashierID)
+	
+	e.notifier.Notify(NotificationEvent{
+		UserID:  order.UserID,
+		Type:    eventOrderAccepted,
+		OrderID: orderID,
+		Message: fmt.Sprintf("Your %s order for %s %s was accepted by a cashier", order.Type, order.Amount.String(), order.CurrencyFrom),
+	})
+	e.publishOrderEvent(orderEventAccepted, orderID, "")
 	
 	return nil
 }
@@ -636,17 +805,62 @@ func (e *MatchingEngine) ConfirmPayment(orderID, cashierID string) error {
 	// Verify order ownership by cashier
 	var order Order
 	err = tx.QueryRow(`
-		SELECT id, user_id, order_type, currency_from, currency_to, amount, rate, status
+		SELECT id, user_id, order_type, currency_from, currency_to, amount, rate, status, COALESCE(is_sandbox, false)
 		FROM orders WHERE id = $1 AND cashier_id = $2 AND status IN ('MATCHED', 'PROCESSING') FOR UPDATE
 	`, orderID, cashierID).Scan(&order.ID, &order.UserID, &order.Type, 
-		&order.CurrencyFrom, &order.CurrencyTo, &order.Amount, &order.Rate, &order.Status)
+		&order.CurrencyFrom, &order.CurrencyTo, &order.Amount, &order.Rate, &order.Status, &order.IsSandbox)
 	
 	if err != nil {
 		return fmt.Errorf("order not found or not assigned to this cashier")
 	}
 	
+	if receiptConfirmationRequired(order.Type) {
+		if err = escrowForReceipt(tx, order, cashierID); err != nil {
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+		
+		log.Printf("🔒 Payment confirmed: Order %s held in escrow until the user confirms receipt", orderID)
+		
+		e.notifier.Notify(NotificationEvent{
+			UserID:  order.UserID,
+			Type:    eventReceiptPending,
+			OrderID: orderID,
+			Message: fmt.Sprintf("The cashier marked your %s order for %s %s as paid. Confirm receipt to release the funds", order.Type, order.Amount.String(), order.CurrencyFrom),
+		})
+		return nil
+	}
+	
+	if err = e.settleOrder(tx, order, cashierID); err != nil {
+		return err
+	}
+	
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	
+	log.Printf("✅ Payment confirmed: Order %s completed by cashier %s", orderID, cashierID)
+	
+	e.notifier.Notify(NotificationEvent{
+		UserID:  order.UserID,
+		Type:    eventPaymentConfirmed,
+		OrderID: orderID,
+		Message: fmt.Sprintf("Payment confirmed: your %s order for %s %s is completed", order.Type, order.Amount.String(), order.CurrencyFrom),
+	})
+	e.publishOrderEvent(orderEventCompleted, orderID, "")
+	
+	return nil
+}
+
+// settleOrder completes an order and moves the funds between the user and the cashier
+func (e *MatchingEngine) settleOrder(tx *sql.Tx, order Order, cashierID string) error {
+	orderID := order.ID
+	
 	// Update order to completed in both tables
-	_, err = tx.Exec(`
+	_, err := tx.Exec(`
 		UPDATE orders SET status = 'COMPLETED', updated_at = NOW() WHERE id = $1
 	`, orderID)
 	
@@ -674,34 +888,31 @@ func (e *MatchingEngine) ConfirmPayment(orderID, cashierID string) error {
 		log.Printf("💰 Processing BUY order: User pays %s %s to get %s %s", 
 			amountToPay.String(), order.CurrencyFrom, order.Amount.String(), order.CurrencyTo)
 		
-		// 1. Deduct payment amount from buyer's wallet (CurrencyFrom)
-		result, err := tx.Exec(`
-			UPDATE wallets 
-			SET balance = balance - $1, updated_at = NOW()
-			WHERE user_id = $2 AND currency = $3 AND balance >= $1
-		`, amountToPay, order.UserID, order.CurrencyFrom)
-		
-		if err != nil {
-			return fmt.Errorf("failed to deduct %s from buyer wallet: %v", order.CurrencyFrom, err)
-		}
-		
-		rowsAffected, err := result.RowsAffected()
-		if err != nil || rowsAffected == 0 {
-			return fmt.Errorf("insufficient %s balance for buyer (required: %s)", order.CurrencyFrom, amountToPay.String())
+		// 1. Deduct payment amount from buyer's wallet (CurrencyFrom), locked if a deposit funded it
+		if err = debitBuyer(tx, order, amountToPay); err != nil {
+			return err
 		}
 		
 		// 2. Add payment to cashier's wallet (CurrencyFrom)
+		cashierCredit, dust := roundForCurrency(order.CurrencyFrom, amountToPay)
 		_, err = tx.Exec(`
 			INSERT INTO wallets (user_id, currency, balance, created_at, updated_at) 
 			VALUES ($1, $2, $3, NOW(), NOW())
 			ON CONFLICT (user_id, currency) 
 			DO UPDATE SET balance = wallets.balance + $3, updated_at = NOW()
-		`, cashierID, order.CurrencyFrom, amountToPay)
+		`, cashierID, order.CurrencyFrom, cashierCredit)
 		
 		if err != nil {
 			return fmt.Errorf("failed to credit %s to cashier wallet: %v", order.CurrencyFrom, err)
 		}
 		
+		if err = recordOrderDust(tx, order, order.CurrencyFrom, dust); err != nil {
+			return fmt.Errorf("failed to record %s dust: %v", order.CurrencyFrom, err)
+		}
+		
+		// Amount the buyer receives, rounded to the CurrencyTo precision
+		buyerCredit, buyerDust := roundForCurrency(order.CurrencyTo, order.Amount)
+		
 		// 3. Release cashier locked funds and give to buyer (CurrencyTo)
 		var lockedColumn string
 		switch order.CurrencyTo {
@@ -727,7 +938,7 @@ func (e *MatchingEngine) ConfirmPayment(orderID, cashierID string) error {
 				VALUES ($1, $2, $3, NOW(), NOW())
 				ON CONFLICT (user_id, currency) 
 				DO UPDATE SET balance = wallets.balance + $3, updated_at = NOW()
-			`, order.UserID, order.CurrencyTo, order.Amount)
+			`, order.UserID, order.CurrencyTo, buyerCredit)
 			
 			if err != nil {
 				return fmt.Errorf("failed to credit %s to buyer wallet: %v", order.CurrencyTo, err)
@@ -758,15 +969,19 @@ func (e *MatchingEngine) ConfirmPayment(orderID, cashierID string) error {
 				VALUES ($1, $2, $3, NOW(), NOW())
 				ON CONFLICT (user_id, currency) 
 				DO UPDATE SET balance = wallets.balance + $3, updated_at = NOW()
-			`, order.UserID, order.CurrencyTo, order.Amount)
+			`, order.UserID, order.CurrencyTo, buyerCredit)
 			
 			if err != nil {
 				return fmt.Errorf("failed to credit %s to buyer wallet: %v", order.CurrencyTo, err)
 			}
 		}
 		
+		if err = recordOrderDust(tx, order, order.CurrencyTo, buyerDust); err != nil {
+			return fmt.Errorf("failed to record %s dust: %v", order.CurrencyTo, err)
+		}
+		
 		log.Printf("✅ BUY order completed: User paid %s %s, received %s %s", 
-			amountToPay.String(), order.CurrencyFrom, order.Amount.String(), order.CurrencyTo)
+			amountToPay.String(), order.CurrencyFrom, buyerCredit.String(), order.CurrencyTo)
 			
 	} else if order.Type == "SELL" {
 		// SELL order: User sells CurrencyFrom for CurrencyTo
@@ -777,34 +992,28 @@ func (e *MatchingEngine) ConfirmPayment(orderID, cashierID string) error {
 		log.Printf("💰 Processing SELL order: User sells %s %s to get %s %s", 
 			order.Amount.String(), order.CurrencyFrom, amountToReceive.String(), order.CurrencyTo)
 		
-		// 1. Deduct selling amount from user's wallet (CurrencyFrom)
-		result, err := tx.Exec(`
-			UPDATE wallets 
-			SET balance = balance - $1, updated_at = NOW()
-			WHERE user_id = $2 AND currency = $3 AND balance >= $1
-		`, order.Amount, order.UserID, order.CurrencyFrom)
-		
-		if err != nil {
-			return fmt.Errorf("failed to deduct %s from seller wallet: %v", order.CurrencyFrom, err)
-		}
-		
-		rowsAffected, err := result.RowsAffected()
-		if err != nil || rowsAffected == 0 {
-			return fmt.Errorf("insufficient %s balance for seller (required: %s)", order.CurrencyFrom, order.Amount.String())
+		// 1. Deduct selling amount from user's wallet (CurrencyFrom), locked since acceptance
+		if err = debitSeller(tx, order); err != nil {
+			return err
 		}
 		
 		// 2. Give sold currency to cashier (CurrencyFrom)
+		cashierCredit, dust := roundForCurrency(order.CurrencyFrom, order.Amount)
 		_, err = tx.Exec(`
 			INSERT INTO wallets (user_id, currency, balance, created_at, updated_at) 
 			VALUES ($1, $2, $3, NOW(), NOW())
 			ON CONFLICT (user_id, currency) 
 			DO UPDATE SET balance = wallets.balance + $3, updated_at = NOW()
-		`, cashierID, order.CurrencyFrom, order.Amount)
+		`, cashierID, order.CurrencyFrom, cashierCredit)
 		
 		if err != nil {
 			return fmt.Errorf("failed to credit %s to cashier wallet: %v", order.CurrencyFrom, err)
 		}
 		
+		if err = recordOrderDust(tx, order, order.CurrencyFrom, dust); err != nil {
+			return fmt.Errorf("failed to record %s dust: %v", order.CurrencyFrom, err)
+		}
+		
 		// 3. Pay user with CurrencyTo from cashier
 		_, err = tx.Exec(`
 			UPDATE wallets 
@@ -817,19 +1026,34 @@ func (e *MatchingEngine) ConfirmPayment(orderID, cashierID string) error {
 		}
 		
 		// 4. Credit user with received amount (CurrencyTo)
+		sellerCredit, sellerDust := roundForCurrency(order.CurrencyTo, amountToReceive)
 		_, err = tx.Exec(`
 			INSERT INTO wallets (user_id, currency, balance, created_at, updated_at) 
 			VALUES ($1, $2, $3, NOW(), NOW())
 			ON CONFLICT (user_id, currency) 
 			DO UPDATE SET balance = wallets.balance + $3, updated_at = NOW()
-		`, order.UserID, order.CurrencyTo, amountToReceive)
+		`, order.UserID, order.CurrencyTo, sellerCredit)
 		
 		if err != nil {
 			return fmt.Errorf("failed to credit %s to seller wallet: %v", order.CurrencyTo, err)
 		}
 		
+		if err = recordOrderDust(tx, order, order.CurrencyTo, sellerDust); err != nil {
+			return fmt.Errorf("failed to record %s dust: %v", order.CurrencyTo, err)
+		}
+		
+		// The wallet service converts the proceeds on order.completed if the seller opted in
+		
 		log.Printf("✅ SELL order completed: User sold %s %s, received %s %s", 
-			order.Amount.String(), order.CurrencyFrom, amountToReceive.String(), order.CurrencyTo)
+			order.Amount.String(), order.CurrencyFrom, sellerCredit.String(), order.CurrencyTo)
+	}
+	
+	// Ledger rows for the movements above, checked by the reconciliation job. Sandbox trades move
+	// fake funds and stay out of the ledger.
+	if !order.IsSandbox {
+		if err = recordSettlementLedger(tx, order, cashierID); err != nil {
+			return fmt.Errorf("failed to record settlement ledger: %v", err)
+		}
 	}
 	
 	// Update assignment status
@@ -843,13 +1067,6 @@ func (e *MatchingEngine) ConfirmPayment(orderID, cashierID string) error {
 		return fmt.Errorf("failed to update assignment: %v", err)
 	}
 	
-	// Commit transaction
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-	
-	log.Printf("✅ Payment confirmed: Order %s completed by cashier %s", orderID, cashierID)
-	
 	return nil
 }
 
@@ -960,6 +1177,7 @@ func (e *MatchingEngine) CancelOrder(orderID, userID string) error {
 	e.removeOrderFromCache(orderID)
 	
 	log.Printf("✅ Order cancelled: %s (Remaining: %s)", orderID, remainingAmount.String())
+	e.publishOrderEvent(orderEventCancelled, orderID, "")
 	
 	return nil
 }
@@ -992,13 +1210,15 @@ func (e *MatchingEngine) GetMarketDepth(currencyFrom, currencyTo string) (map[st
 }
 
 // createTransactionChatRoom creates a chat room for a P2P transaction
-func (e *MatchingEngine) createTransactionChatRoom(orderID, userID, cashierID string) {
-	log.Printf("🔄 Creating chat room for transaction %s between user %s and cashier %s", orderID, userID, cashierID)
+func (e *MatchingEngine) createTransactionChatRoom(requestID, orderID, userID, cashierID string) {
+	logger := taggedLog(requestID)
+	
+	logger.Printf("🔄 Creating chat room for transaction %s between user %s and cashier %s", orderID, userID, cashierID)
 	
 	// Create participants JSON array
 	participants, err := json.Marshal([]string{userID, cashierID})
 	if err != nil {
-		log.Printf("❌ Error marshaling participants: %v", err)
+		logger.Printf("❌ Error marshaling participants: %v", err)
 		return
 	}
 	
@@ -1010,11 +1230,11 @@ func (e *MatchingEngine) createTransactionChatRoom(orderID, userID, cashierID st
 	`, roomID, "TRANSACTION", orderID, string(participants))
 	
 	if err != nil {
-		log.Printf("❌ Error creating chat room in database: %v", err)
+		logger.Printf("❌ Error creating chat room in database: %v", err)
 		return
 	}
 	
-	log.Printf("✅ Chat room created successfully for transaction %s", orderID)
+	logger.Printf("✅ Chat room created successfully for transaction %s", orderID)
 }
 
 // convertJSONArrayToPGArray converts a JSON array to PostgreSQL array format
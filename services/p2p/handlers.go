@@ -7,7 +7,6 @@ import (
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -31,59 +30,58 @@ type OrderResponse struct {
 	Matches        []string               `json:"matches,omitempty"`
 }
 
-func (s *Server) handleGetOrders(c *gin.Context) {
-	// Get query parameters
-	currencyFrom := c.Query("currency_from")
-	currencyTo := c.Query("currency_to")
-	orderType := c.Query("type")
-	status := c.Query("status")
-	limit := c.DefaultQuery("limit", "50")
-	offset := c.DefaultQuery("offset", "0")
-	
-	limitInt, _ := strconv.Atoi(limit)
-	offsetInt, _ := strconv.Atoi(offset)
-	
-	// Build query
-	var conditions []string
+// orderListColumns are the columns scanned by the order list endpoints
+const orderListColumns = `id, user_id, order_type, currency_from, currency_to, amount, remaining_amount,
+			rate, min_amount, max_amount, payment_methods, status, created_at`
+
+// orderBookFilters builds the WHERE clause of the public order list, shared by its page and
+// count queries
+func orderBookFilters(c *gin.Context) (string, []interface{}) {
+	where := "WHERE status = 'PENDING' AND COALESCE(is_sandbox, false) = false"
 	var args []interface{}
-	argIndex := 1
-	
-	baseQuery := `
-		SELECT id, user_id, order_type, currency_from, currency_to, amount, remaining_amount,
-			rate, min_amount, max_amount, payment_methods, status, created_at
-		FROM p2p_orders
-		WHERE status = 'PENDING'
-	`
 	
-	if currencyFrom != "" {
-		conditions = append(conditions, fmt.Sprintf("currency_from = $%d", argIndex))
+	if currencyFrom := c.Query("currency_from"); currencyFrom != "" {
 		args = append(args, currencyFrom)
-		argIndex++
+		where += fmt.Sprintf(" AND currency_from = $%d", len(args))
 	}
 	
-	if currencyTo != "" {
-		conditions = append(conditions, fmt.Sprintf("currency_to = $%d", argIndex))
+	if currencyTo := c.Query("currency_to"); currencyTo != "" {
 		args = append(args, currencyTo)
-		argIndex++
+		where += fmt.Sprintf(" AND currency_to = $%d", len(args))
 	}
 	
-	if orderType != "" {
-		conditions = append(conditions, fmt.Sprintf("order_type = $%d", argIndex))
+	if orderType := c.Query("type"); orderType != "" {
 		args = append(args, orderType)
-		argIndex++
+		where += fmt.Sprintf(" AND order_type = $%d", len(args))
 	}
 	
-	if status != "" && (status == "MATCHED" || status == "PROCESSING") {
-		conditions = append(conditions, fmt.Sprintf("status = $%d", argIndex))
+	if status := c.Query("status"); status == "MATCHED" || status == "PROCESSING" {
 		args = append(args, status)
-		argIndex++
+		where += fmt.Sprintf(" AND status = $%d", len(args))
 	}
 	
-	if len(conditions) > 0 {
-		baseQuery += " AND " + strings.Join(conditions, " AND ")
-	}
+	return where, args
+}
+
+// countRows returns how many rows of table match the WHERE clause used for a page
+func (s *Server) countRows(table, where string, args []interface{}) int {
+	var total int
+	s.db.QueryRow("SELECT COUNT(*) FROM "+table+" "+where, args...).Scan(&total)
+	return total
+}
+
+func (s *Server) handleGetOrders(c *gin.Context) {
+	limit := c.DefaultQuery("limit", "50")
+	offset := c.DefaultQuery("offset", "0")
+	
+	limitInt, _ := strconv.Atoi(limit)
+	offsetInt, _ := strconv.Atoi(offset)
 	
-	baseQuery += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	where, args := orderBookFilters(c)
+	total := s.countRows("p2p_orders", where, args)
+	
+	baseQuery := "SELECT " + orderListColumns + " FROM p2p_orders " + where +
+		fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
 	args = append(args, limitInt, offsetInt)
 	
 	rows, err := s.db.Query(baseQuery, args...)
@@ -113,7 +111,7 @@ func (s *Server) handleGetOrders(c *gin.Context) {
 	
 	c.JSON(http.StatusOK, gin.H{
 		"orders": orders,
-		"total":  len(orders),
+		"total":  total,
 		"limit":  limitInt,
 		"offset": offsetInt,
 	})
@@ -124,15 +122,34 @@ func (s *Server) handleCreateOrder(c *gin.Context) {
 	
 	var req CreateOrderRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("❌ BACKEND: Error en ShouldBindJSON: %v", err)
+		requestLog(c).Printf("❌ BACKEND: Error en ShouldBindJSON: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	
-	log.Printf("📦 BACKEND: Request recibido: %+v", req)
+	requestLog(c).Printf("📦 BACKEND: Request recibido: %+v", req)
 	
 	userID := c.GetString("user_id")
-	log.Printf("👤 BACKEND: UserID del token: %s", userID)
+	requestLog(c).Printf("👤 BACKEND: UserID del token: %s", userID)
+	
+	var ok bool
+	if req.CurrencyFrom, req.CurrencyTo, ok = bindPair(c, req.CurrencyFrom, req.CurrencyTo); !ok {
+		return
+	}
+	if !s.checkCurrencyKYC(c, userID, req.CurrencyFrom, req.CurrencyTo) {
+		return
+	}
+	if req.OrderKind == OrderKindMarket {
+		s.handleCreateMarketOrder(c, req, userID)
+		return
+	}
+	if req.Rate <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rate is required for LIMIT orders"})
+		return
+	}
+	if !s.checkPairPendingLimit(c, req.CurrencyFrom, req.CurrencyTo) {
+		return
+	}
 	
 	// Convert to decimals
 	amount := decimal.NewFromFloat(req.Amount)
@@ -140,24 +157,50 @@ func (s *Server) handleCreateOrder(c *gin.Context) {
 	minAmount := decimal.NewFromFloat(req.MinAmount)
 	maxAmount := decimal.NewFromFloat(req.MaxAmount)
 	
-	log.Printf("🔢 BACKEND: Conversión de decimales completada:")
-	log.Printf("  - amount: %s (original: %f)", amount.String(), req.Amount)
-	log.Printf("  - rate: %s (original: %f)", rate.String(), req.Rate)
-	log.Printf("  - minAmount: %s (original: %f)", minAmount.String(), req.MinAmount)
-	log.Printf("  - maxAmount: %s (original: %f)", maxAmount.String(), req.MaxAmount)
+	requestLog(c).Printf("🔢 BACKEND: Conversión de decimales completada:")
+	requestLog(c).Printf("  - amount: %s (original: %f)", amount.String(), req.Amount)
+	requestLog(c).Printf("  - rate: %s (original: %f)", rate.String(), req.Rate)
+	requestLog(c).Printf("  - minAmount: %s (original: %f)", minAmount.String(), req.MinAmount)
+	requestLog(c).Printf("  - maxAmount: %s (original: %f)", maxAmount.String(), req.MaxAmount)
+	
+	// Amounts entered in the quote currency are converted to the base currency at the order rate
+	amountIn := req.AmountIn
+	if amountIn == "" {
+		amountIn = "BASE"
+	}
+	baseCurrency, quoteCurrency := orderBaseQuote(req.Type, req.CurrencyFrom, req.CurrencyTo)
+	quoteAmount := amount
+	if amountIn == "QUOTE" {
+		amount = quoteToBase(baseCurrency, amount, rate)
+		minAmount = quoteToBase(baseCurrency, minAmount, rate)
+		maxAmount = quoteToBase(baseCurrency, maxAmount, rate)
+		
+		if !amount.IsPositive() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("amount in %s is too small for rate %s", quoteCurrency, rate.String())})
+			return
+		}
+		
+		requestLog(c).Printf("💱 BACKEND: Monto en moneda cotizada %s %s -> %s %s (rate %s)",
+			quoteAmount.String(), quoteCurrency, amount.String(), baseCurrency, rate.String())
+	} else {
+		quoteAmount = amount.Mul(rate)
+	}
 	
 	// Validate amounts
 	if minAmount.GreaterThan(amount) {
-		log.Printf("❌ BACKEND: Validación falló - min_amount (%s) > amount (%s)", minAmount.String(), amount.String())
+		requestLog(c).Printf("❌ BACKEND: Validación falló - min_amount (%s) > amount (%s)", minAmount.String(), amount.String())
 		c.JSON(http.StatusBadRequest, gin.H{"error": "min_amount cannot be greater than amount"})
 		return
 	}
 	
 	if maxAmount.LessThan(amount) && !maxAmount.IsZero() {
-		log.Printf("❌ BACKEND: Validación falló - max_amount (%s) < amount (%s)", maxAmount.String(), amount.String())
+		requestLog(c).Printf("❌ BACKEND: Validación falló - max_amount (%s) < amount (%s)", maxAmount.String(), amount.String())
 		c.JSON(http.StatusBadRequest, gin.H{"error": "max_amount cannot be less than amount"})
 		return
 	}
+	if !s.checkOrderSize(c, baseCurrency, amount) {
+		return
+	}
 	
 	log.Println("✅ BACKEND: Validaciones de cantidad pasaron")
 	
@@ -182,19 +225,19 @@ func (s *Server) handleCreateOrder(c *gin.Context) {
 	expiresAt := time.Now().Add(24 * time.Hour)
 	order.ExpiresAt = &expiresAt
 	
-	log.Printf("📋 BACKEND: Orden creada (antes de DB): %+v", order)
-	log.Printf("⏰ BACKEND: ExpiresAt: %s", expiresAt.Format(time.RFC3339))
+	requestLog(c).Printf("📋 BACKEND: Orden creada (antes de DB): %+v", order)
+	requestLog(c).Printf("⏰ BACKEND: ExpiresAt: %s", expiresAt.Format(time.RFC3339))
 	
 	// Add to matching engine (no automatic matching)
 	log.Println("🔧 BACKEND: Llamando a engine.AddOrder...")
 	orderID, err := s.engine.AddOrder(order)
 	if err != nil {
-		log.Printf("❌ BACKEND: Error en engine.AddOrder: %v", err)
+		requestLog(c).Printf("❌ BACKEND: Error en engine.AddOrder: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
 		return
 	}
 	
-	log.Printf("✅ BACKEND: Orden creada exitosamente con ID: %s", orderID)
+	requestLog(c).Printf("✅ BACKEND: Orden creada exitosamente con ID: %s", orderID)
 	
 	response := OrderResponse{
 		ID:              orderID,
@@ -215,9 +258,39 @@ func (s *Server) handleCreateOrder(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Order created successfully - waiting for cashier acceptance",
 		"order":   response,
+		"amount_interpretation": gin.H{
+			"amount_in":      amountIn,
+			"base_currency":  baseCurrency,
+			"base_amount":    order.Amount,
+			"quote_currency": quoteCurrency,
+			"quote_amount":   quoteAmount,
+			"rate":           order.Rate,
+		},
 	})
 }
 
+// orderBaseQuote returns the currency an order amount is denominated in (base) and the one paid or
+// received at the order rate (quote). BUY orders buy CurrencyTo paying CurrencyFrom; SELL orders sell
+// CurrencyFrom to receive CurrencyTo.
+func orderBaseQuote(orderType, currencyFrom, currencyTo string) (string, string) {
+	if orderType == "BUY" {
+		return currencyTo, currencyFrom
+	}
+	return currencyFrom, currencyTo
+}
+
+// quoteToBase converts a quote-currency amount into the base currency at the given rate
+func quoteToBase(baseCurrency string, quoteAmount, rate decimal.Decimal) decimal.Decimal {
+	if quoteAmount.IsZero() || rate.IsZero() {
+		return decimal.Zero
+	}
+	places, ok := loadCurrencyPrecision()[baseCurrency]
+	if !ok {
+		places = 8
+	}
+	return quoteAmount.DivRound(rate, places)
+}
+
 func (s *Server) handleGetOrderBook(c *gin.Context) {
 	currencyFrom := c.Query("currency_from")
 	currencyTo := c.Query("currency_to")
@@ -226,6 +299,10 @@ func (s *Server) handleGetOrderBook(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "currency_from and currency_to are required"})
 		return
 	}
+	currencyFrom, currencyTo, ok := bindPair(c, currencyFrom, currencyTo)
+	if !ok {
+		return
+	}
 	
 	orderBook, err := s.engine.GetOrderBook(currencyFrom, currencyTo)
 	if err != nil {
@@ -243,18 +320,9 @@ func (s *Server) handleGetOrderBook(c *gin.Context) {
 
 func (s *Server) handleGetRates(c *gin.Context) {
 	// Get real-time rates from order book
-	pairs := [][]string{
-		{"USD", "BOB"},
-		{"BOB", "USD"},
-		{"USDT", "BOB"},
-		{"BOB", "USDT"},
-		{"USD", "USDT"},
-		{"USDT", "USD"},
-	}
-	
 	rates := make(map[string]interface{})
 	
-	for _, pair := range pairs {
+	for _, pair := range supportedPairs() {
 		currencyFrom, currencyTo := pair[0], pair[1]
 		orderBook, err := s.engine.GetOrderBook(currencyFrom, currencyTo)
 		if err != nil {
@@ -378,6 +446,10 @@ func (s *Server) handleGetMarketDepth(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "currency_from and currency_to are required"})
 		return
 	}
+	currencyFrom, currencyTo, ok := bindPair(c, currencyFrom, currencyTo)
+	if !ok {
+		return
+	}
 	
 	depth, err := s.engine.GetMarketDepth(currencyFrom, currencyTo)
 	if err != nil {
@@ -400,7 +472,8 @@ func (s *Server) handleGetMatches(c *gin.Context) {
 	query := `
 		SELECT m.id, m.buy_order_id, m.sell_order_id, m.amount, m.rate, m.created_at,
 			   bo.user_id as buy_user_id, so.user_id as sell_user_id,
-			   bo.currency_from, bo.currency_to
+			   bo.currency_from, bo.currency_to,
+			   m.sell_amount, m.bridge_from, m.bridge_to, m.bridge_rate, m.bridge_spread
 		FROM matches m
 		JOIN orders bo ON m.buy_order_id = bo.id
 		JOIN orders so ON m.sell_order_id = so.id
@@ -421,9 +494,12 @@ func (s *Server) handleGetMatches(c *gin.Context) {
 		var matchID, buyOrderID, sellOrderID, buyUserID, sellUserID, currencyFrom, currencyTo string
 		var amount, rate decimal.Decimal
 		var createdAt time.Time
+		var sellAmount, bridgeRate, bridgeSpread decimal.NullDecimal
+		var bridgeFrom, bridgeTo sql.NullString
 		
 		err := rows.Scan(&matchID, &buyOrderID, &sellOrderID, &amount, &rate, &createdAt,
-			&buyUserID, &sellUserID, &currencyFrom, &currencyTo)
+			&buyUserID, &sellUserID, &currencyFrom, &currencyTo,
+			&sellAmount, &bridgeFrom, &bridgeTo, &bridgeRate, &bridgeSpread)
 		
 		if err != nil {
 			continue
@@ -446,6 +522,17 @@ func (s *Server) handleGetMatches(c *gin.Context) {
 			"matched_at":     createdAt,
 		}
 		
+		// Disclose the conversion applied when the two orders traded different currencies
+		if bridgeFrom.Valid {
+			match["sell_amount"] = sellAmount.Decimal
+			match["bridge"] = CurrencyBridge{
+				From:   bridgeFrom.String,
+				To:     bridgeTo.String,
+				Rate:   bridgeRate.Decimal,
+				Spread: bridgeSpread.Decimal,
+			}
+		}
+		
 		matches = append(matches, match)
 	}
 	
@@ -466,23 +553,18 @@ func (s *Server) handleGetOrderHistory(c *gin.Context) {
 	limitInt, _ := strconv.Atoi(limit)
 	offsetInt, _ := strconv.Atoi(offset)
 	
-	query := `
-		SELECT id, user_id, order_type, currency_from, currency_to, amount, remaining_amount,
-			rate, min_amount, max_amount, payment_methods, status, created_at
-		FROM p2p_orders
-		WHERE user_id = $1
-	`
-	
+	where := "WHERE user_id = $1"
 	args := []interface{}{userID}
-	argIndex := 2
 	
 	if status != "" && status != "ALL" {
-		query += fmt.Sprintf(" AND status = $%d", argIndex)
 		args = append(args, status)
-		argIndex++
+		where += fmt.Sprintf(" AND status = $%d", len(args))
 	}
 	
-	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	total := s.countRows("p2p_orders", where, args)
+	
+	query := "SELECT " + orderListColumns + " FROM p2p_orders " + where +
+		fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
 	args = append(args, limitInt, offsetInt)
 	
 	rows, err := s.db.Query(query, args...)
@@ -511,7 +593,7 @@ func (s *Server) handleGetOrderHistory(c *gin.Context) {
 	
 	c.JSON(http.StatusOK, gin.H{
 		"orders": orders,
-		"total":  len(orders),
+		"total":  total,
 		"limit":  limitInt,
 		"offset": offsetInt,
 	})
@@ -552,17 +634,22 @@ func (s *Server) handleMarkAsPaid(c *gin.Context) {
 		return
 	}
 
-	// Update order status to PROCESSING
-	_, err = s.db.Exec(`
+	// Update order status to PROCESSING; the cashier has until the processing timeout to confirm.
+	// The status guard loses against the payment window cancelling the order meanwhile.
+	result, err := s.db.Exec(`
 		UPDATE orders 
-		SET status = 'PROCESSING', updated_at = NOW()
-		WHERE id = $1
+		SET status = 'PROCESSING', marked_paid_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'MATCHED'
 	`, orderID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
 		return
 	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order is no longer awaiting payment"})
+		return
+	}
 
 	// Also update p2p_orders table for consistency
 	s.db.Exec(`
@@ -605,7 +692,7 @@ func (s *Server) handleGetOrderDetails(c *gin.Context) {
 		WHERE o.id = $1 AND o.user_id = $2
 	`
 
-	log.Printf("🔍 DEBUG: Getting order details for orderID: %s, userID: %s", orderID, userID)
+	requestLog(c).Printf("🔍 DEBUG: Getting order details for orderID: %s, userID: %s", orderID, userID)
 	
 	err := s.db.QueryRow(query, orderID, userID).Scan(
 		&order.ID, &order.UserID, &cashierID, &order.Type, &order.CurrencyFrom,
@@ -616,12 +703,12 @@ func (s *Server) handleGetOrderDetails(c *gin.Context) {
 	)
 
 	if err != nil {
-		log.Printf("❌ DEBUG: Query error: %v", err)
+		requestLog(c).Printf("❌ DEBUG: Query error: %v", err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
 	}
 	
-	log.Printf("✅ DEBUG: Order found: %s, status: %s", order.ID, order.Status)
+	requestLog(c).Printf("✅ DEBUG: Order found: %s, status: %s", order.ID, order.Status)
 
 	// Parse payment methods
 	json.Unmarshal([]byte(paymentMethodsJSON), &order.PaymentMethods)
@@ -638,11 +725,24 @@ func (s *Server) handleGetOrderDetails(c *gin.Context) {
 			"phone": cashierPhone.String,
 		}
 
+		// Whether the cashier's registered account is in their KYC name, so the buyer can check
+		// it before paying
+		bankName, account := "Banco Nacional de Bolivia", "10000023456"
+		verification, err := s.cashierAccountVerification(cashierID.String)
+		if err != nil {
+			requestLog(c).Printf("Error verifying bank account of cashier %s: %v", cashierID.String, err)
+		} else {
+			response["account_verification"] = verification
+			if verification.accountNumber != "" {
+				bankName, account = verification.BankName, verification.accountNumber
+			}
+		}
+
 		// Add payment instructions for MATCHED orders
 		if order.Status == "MATCHED" {
 			response["payment_instructions"] = gin.H{
-				"bank_name":    "Banco Nacional de Bolivia",
-				"account":      "10000023456",
+				"bank_name":    bankName,
+				"account":      account,
 				"holder_name":  cashierName.String,
 				"amount_bob":   order.Amount.Mul(order.Rate),
 				"reference":    orderID,
@@ -663,7 +763,7 @@ func (s *Server) handleGetTradingStats(c *gin.Context) {
 	var totalVolume decimal.Decimal
 	
 	s.db.QueryRow("SELECT COUNT(*) FROM orders WHERE user_id = $1", userID).Scan(&totalOrders)
-	s.db.QueryRow("SELECT COUNT(*) FROM orders WHERE user_id = $1 AND status IN ('PENDING', 'MATCHED', 'PROCESSING')", userID).Scan(&activeOrders)
+	s.db.QueryRow("SELECT COUNT(*) FROM orders WHERE user_id = $1 AND status IN ('PENDING', 'MATCHED', 'PROCESSING', 'AWAITING_RECEIPT')", userID).Scan(&activeOrders)
 	s.db.QueryRow("SELECT COUNT(*) FROM orders WHERE user_id = $1 AND status = 'COMPLETED'", userID).Scan(&filledOrders)
 	s.db.QueryRow("SELECT COUNT(*) FROM orders WHERE user_id = $1 AND status = 'CANCELLED'", userID).Scan(&cancelledOrders)
 	
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+var orderListRows = []string{"id", "user_id", "order_type", "currency_from", "currency_to", "amount", "remaining_amount",
+	"rate", "min_amount", "max_amount", "payment_methods", "status", "created_at"}
+
+// getOrderPage calls the handler and returns how many orders the page held and the reported total
+func getOrderPage(t *testing.T, handler gin.HandlerFunc, target string) (int, int) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+	c.Set("user_id", "user-1")
+	handler(c)
+
+	var response struct {
+		Orders []OrderResponse `json:"orders"`
+		Total  int             `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("response = %d %s: %v", w.Code, w.Body.String(), err)
+	}
+	return len(response.Orders), response.Total
+}
+
+func TestGetOrdersTotalCountsEveryMatchingOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// The count and the page share the same filters; 30 orders match and the page holds two
+	where := `WHERE status = 'PENDING' AND COALESCE\(is_sandbox, false\) = false AND currency_from = \$1 AND order_type = \$2`
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM p2p_orders `+where+`$`).WithArgs("USD", "SELL").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(int64(30)))
+	rows := sqlmock.NewRows(orderListRows)
+	for _, id := range []string{"order-11", "order-12"} {
+		rows.AddRow(id, "user-2", "SELL", "USD", "BOB", "100", "100", "6.9", "0", "0", "{QR}", "PENDING", time.Now())
+	}
+	mock.ExpectQuery(`FROM p2p_orders `+where+` ORDER BY created_at DESC LIMIT \$3 OFFSET \$4`).
+		WithArgs("USD", "SELL", 2, 10).WillReturnRows(rows)
+
+	page, total := getOrderPage(t, (&Server{db: db}).handleGetOrders, "/orders?currency_from=USD&type=SELL&limit=2&offset=10")
+	if page != 2 || total != 30 {
+		t.Errorf("page of %d with total %d, want 2 of 30", page, total)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetOrderHistoryTotalCountsEveryMatchingOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM p2p_orders WHERE user_id = \$1 AND status = \$2$`).WithArgs("user-1", "FILLED").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(int64(5)))
+	mock.ExpectQuery(`FROM p2p_orders WHERE user_id = \$1 AND status = \$2 ORDER BY created_at DESC LIMIT \$3 OFFSET \$4`).
+		WithArgs("user-1", "FILLED", 1, 0).
+		WillReturnRows(sqlmock.NewRows(orderListRows).
+			AddRow("order-1", "user-1", "BUY", "BOB", "USD", "690", "0", "6.9", "0", "0", `["QR"]`, "FILLED", time.Now()))
+
+	page, total := getOrderPage(t, (&Server{db: db}).handleGetOrderHistory, "/orders/history?status=FILLED&limit=1")
+	if page != 1 || total != 5 {
+		t.Errorf("page of %d with total %d, want 1 of 5", page, total)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
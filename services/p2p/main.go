@@ -15,14 +15,18 @@ import (
     "github.com/shopspring/decimal"
     _ "github.com/lib/pq"
     "github.com/streadway/amqp"
+
+    "shared/dbpool"
+    "shared/revocation"
 )
 
 type Server struct {
-    db       *sql.DB
-    redis    *redis.Client
-    rabbit   *amqp.Connection
-    router   *gin.Engine
-    engine   *MatchingEngine
+    db            *sql.DB
+    redis         *redis.Client
+    rabbit        *amqp.Connection
+    router        *gin.Engine
+    engine        *MatchingEngine
+    cashierStream *CashierStreamHub
 }
 
 type Order struct {
@@ -41,6 +45,7 @@ type Order struct {
     Status         string          `json:"status"`
     AcceptedAt     *time.Time      `json:"accepted_at,omitempty"`
     ExpiresAt      *time.Time      `json:"expires_at,omitempty"`
+    IsSandbox      bool            `json:"is_sandbox,omitempty"` // Sandbox simulation order, invisible to real cashiers
     CreatedAt      time.Time       `json:"created_at"`
 }
 
@@ -49,10 +54,17 @@ type CreateOrderRequest struct {
     CurrencyFrom   string   `json:"currency_from" binding:"required"`
     CurrencyTo     string   `json:"currency_to" binding:"required"`
     Amount         float64  `json:"amount" binding:"required,gt=0"`
-    Rate           float64  `json:"rate" binding:"required,gt=0"`
+    Rate           float64  `json:"rate" binding:"omitempty,gt=0"` // required for LIMIT orders
     MinAmount      float64  `json:"min_amount"`
     MaxAmount      float64  `json:"max_amount"`
     PaymentMethods []string `json:"payment_methods" binding:"required,min=1"`
+    // AmountIn tells how Amount/MinAmount/MaxAmount are expressed: BASE (default) is the
+    // currency being bought or sold, QUOTE is the currency paid/received at Rate
+    AmountIn       string   `json:"amount_in" binding:"omitempty,oneof=BASE QUOTE"`
+    // OrderKind is LIMIT (default, waits for a cashier at Rate) or MARKET (filled immediately
+    // against the book, at most MaxSlippage percent worse than the best rate)
+    OrderKind      string   `json:"order_kind" binding:"omitempty,oneof=LIMIT MARKET"`
+    MaxSlippage    *float64 `json:"max_slippage" binding:"omitempty,gte=0,lte=50"`
 }
 
 func main() {
@@ -71,6 +83,7 @@ func main() {
         log.Fatal("Failed to connect to database:", err)
     }
     defer db.Close()
+    dbpool.Configure(db)
 
     // Redis connection
     redisClient := redis.NewClient(&redis.Options{
@@ -97,8 +110,10 @@ func main() {
     }
 
     // Initialize matching engine
-    server.engine = NewMatchingEngine(db, redisClient)
+    server.engine = NewMatchingEngine(db, redisClient, NewOrderEventPublisher(rabbitConn))
     go server.engine.Start()
+    server.cashierStream = NewCashierStreamHub(server.engine)
+    go server.cashierStream.ConsumeOrderEvents()
 
     // Setup routes
     server.setupRoutes()
@@ -116,41 +131,91 @@ func main() {
 }
 
 func (s *Server) setupRoutes() {
-    // Health check
-    s.router.GET("/health", func(c *gin.Context) {
-        c.JSON(200, gin.H{"status": "healthy", "service": "p2p"})
-    })
+    setupMetrics(s.router, "p2p",
+        countGauge(s.db, "p2p_pending_orders", "Orders waiting for a cashier.",
+            `SELECT COUNT(*) FROM orders WHERE status = 'PENDING' AND COALESCE(is_sandbox, false) = false`),
+        countGauge(s.db, "p2p_active_orders", "Orders accepted by a cashier and not completed yet.",
+            `SELECT COUNT(*) FROM orders WHERE status IN ('MATCHED', 'PROCESSING') AND COALESCE(is_sandbox, false) = false`),
+    )
+    s.router.Use(requestIDMiddleware())
+
+    // Health checks
+    setupHealthRoutes(s.router, "p2p", databaseCheck(s.db), redisCheck(s.redis), rabbitCheck(s.rabbit))
 
     // P2P routes
     api := s.router.Group("/api/v1")
     {
         // Order management
-        api.GET("/orders", s.handleGetOrders)
-        api.POST("/orders", s.authMiddleware(), s.handleCreateOrder)
-        api.GET("/orderbook", s.handleGetOrderBook)
-        api.GET("/rates", s.handleGetRates)
+        api.GET("/orders", s.apiKeyMiddleware("orders"), s.handleGetOrders)
+        api.POST("/orders", s.authMiddleware(), s.orderRateLimitMiddleware(), s.handleCreateOrder)
+        api.GET("/orderbook", s.apiKeyMiddleware("orderbook"), s.handleGetOrderBook)
+        api.GET("/rates", s.apiKeyMiddleware("rates"), s.handleGetRates)
+        api.GET("/limits", s.handleGetLimits)
+        api.GET("/trade/quote", s.authMiddleware(), s.handleTradeQuote)
         
         // User-specific routes (protected)
         api.GET("/user/orders", s.authMiddleware(), s.handleGetUserOrders)
+        api.PUT("/orders/:id", s.authMiddleware(), s.handleUpdateOrder)
         api.DELETE("/orders/:id", s.authMiddleware(), s.handleCancelOrder)
+        api.POST("/orders/batch", s.authMiddleware(), s.handleGetOrdersBatch)
         api.GET("/orders/:id", s.authMiddleware(), s.handleGetOrderDetails)
         api.POST("/orders/:id/mark-paid", s.authMiddleware(), s.handleMarkAsPaid)
+        api.POST("/orders/:id/confirm-receipt", s.authMiddleware(), s.handleConfirmReceipt)
         api.GET("/user/matches", s.authMiddleware(), s.handleGetMatches)
         api.GET("/user/history", s.authMiddleware(), s.handleGetOrderHistory)
         api.GET("/user/stats", s.authMiddleware(), s.handleGetTradingStats)
+        api.GET("/notifications", s.authMiddleware(), s.handleGetNotifications)
+        api.POST("/notifications/read", s.authMiddleware(), s.handleMarkNotificationsRead)
         
         // Market data
         api.GET("/market/depth", s.handleGetMarketDepth)
+        api.GET("/market/suggest-rate", s.handleSuggestRate)
+        api.GET("/market/trades", s.handleGetMarketTrades)
+        api.GET("/market/ticker", s.handleGetMarketTicker)
     }
 
-    // Cashier routes
+    // Cashier routes. The live pending orders stream also takes the token as ?token=, since
+    // browsers cannot set headers on a WebSocket handshake.
+    api.GET("/cashier/stream", wsTokenFromQuery(), s.authMiddleware(), s.cashierMiddleware(), s.handleCashierStream)
+    
     cashier := api.Group("/cashier").Use(s.authMiddleware(), s.cashierMiddleware())
     {
         cashier.GET("/pending-orders", s.handleGetPendingOrders)
+        cashier.POST("/availability", s.handleSetCashierAvailability)
+        cashier.POST("/heartbeat", s.handleCashierHeartbeat)
         cashier.POST("/orders/:id/accept", s.handleAcceptOrder)
         cashier.POST("/orders/:id/confirm-payment", s.handleConfirmPayment)
         cashier.GET("/my-orders", s.handleGetCashierOrders)
         cashier.GET("/metrics", s.handleGetCashierMetrics)
+        cashier.GET("/performance", s.handleGetCashierPerformance)
+        cashier.GET("/suspension", s.handleGetCashierSuspension)
+        cashier.GET("/order-limits", s.handleGetCashierOrderLimits)
+        cashier.PUT("/order-limits", s.handleSetCashierOrderLimit)
+        cashier.DELETE("/order-limits/:currency", s.handleDeleteCashierOrderLimit)
+        cashier.GET("/shift-holds", s.handleGetShiftHolds)
+        cashier.POST("/shift-holds", s.handlePlaceShiftHold)
+        cashier.POST("/shift-holds/:id/release", s.handleReleaseShiftHold)
+    }
+
+    // Admin routes
+    admin := api.Group("/admin").Use(s.authMiddleware(), s.adminMiddleware())
+    {
+        admin.GET("/orders/:id/full", s.handleAdminGetOrderFull)
+        admin.POST("/reconciliation/run", s.handleAdminRunReconciliation)
+        admin.GET("/cashiers/:id/performance", s.handleAdminGetCashierPerformance)
+        admin.GET("/cashiers/suspensions", s.handleAdminGetCashierSuspensions)
+        admin.POST("/cashiers/suspensions/run", s.handleAdminRunCashierSuspensions)
+        admin.POST("/cashiers/:id/unsuspend", s.handleAdminUnsuspendCashier)
+        admin.GET("/audit-log", s.handleAdminGetAuditLog)
+    }
+
+    // Sandbox routes, only available when SANDBOX_MODE=true
+    if sandboxEnabled() {
+        log.Printf("🧪 Sandbox mode enabled")
+        sandbox := api.Group("/sandbox").Use(s.authMiddleware())
+        {
+            sandbox.POST("/trades", s.handleSandboxTrade)
+        }
     }
 }
 
@@ -178,6 +243,11 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
         
         if claims, ok := token.Claims.(jwt.MapClaims); ok {
             userID := claims["user_id"].(string)
+            if revocation.IsUserRevoked(c.Request.Context(), s.redis, userID) {
+                c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is closed"})
+                c.Abort()
+                return
+            }
             c.Set("user_id", userID)
             c.Next()
         }
@@ -202,6 +272,27 @@ func (s *Server) cashierMiddleware() gin.HandlerFunc {
             return
         }
         
+        c.Next()
+    }
+}
+
+func (s *Server) adminMiddleware() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        userID := c.GetString("user_id")
+        if userID == "" {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+            c.Abort()
+            return
+        }
+        
+        var role string
+        err := s.db.QueryRow("SELECT COALESCE(role, '') FROM users WHERE id = $1", userID).Scan(&role)
+        if err != nil || role != "admin" {
+            c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+            c.Abort()
+            return
+        }
+        
         c.Next()
     }
 }
\ No newline at end of file
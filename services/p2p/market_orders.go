@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// MARKET orders never rest in the book: they take the best opposing ACTIVE orders found by
+// findMatches at the opposing orders' rates, immediate-or-cancel. Fills stop at the first order
+// whose rate is more than max_slippage percent worse than the best one, and whatever could
+// not be filled is cancelled.
+
+const (
+	OrderKindLimit  = "LIMIT"
+	OrderKindMarket = "MARKET"
+)
+
+const defaultMarketSlippagePercent = 1
+
+// A BUY market order accepts any seller rate when probing the book; the slippage bound is
+// applied to the matches afterwards
+var marketBuyRateCeiling = decimal.New(1, 12)
+
+var errMarketOrderNoLiquidity = fmt.Errorf("no opposing orders available within the slippage bound")
+
+// MarketFill is the outcome of a market order
+type MarketFill struct {
+	Order          Order
+	MatchIDs       []string
+	FilledAmount   decimal.Decimal // in the order's base currency
+	UnfilledAmount decimal.Decimal
+	AverageRate    decimal.Decimal
+	BestRate       decimal.Decimal
+	WorstRate      decimal.Decimal
+}
+
+// takerMatches returns every match the order could take from the book at the resting orders'
+// rates, best rate first. Nothing is written.
+func (e *MatchingEngine) takerMatches(order Order) []Match {
+	probe := order
+	probe.Status = "ACTIVE"
+	probe.RemainingAmount = order.Amount
+	probe.Rate = marketBuyRateCeiling
+	if order.Type == "SELL" {
+		probe.Rate = decimal.Zero
+	}
+	
+	matches := e.findMatches(probe)
+	if len(matches) == 0 {
+		return nil
+	}
+	
+	// createMatch prices at the sell order (maker) rate; a market SELL is the taker, so it
+	// gets the resting buy order's rate instead
+	if order.Type == "SELL" {
+		for i := range matches {
+			matches[i].Rate = matches[i].BuyOrder.Rate
+		}
+	}
+	return matches
+}
+
+// marketMatches returns the matches a market order would take within maxSlippage percent of
+// the best available rate
+func (e *MatchingEngine) marketMatches(order Order, maxSlippage decimal.Decimal) []Match {
+	matches := e.takerMatches(order)
+	if len(matches) == 0 {
+		return nil
+	}
+	
+	// findMatches returns the best rates first
+	best := matches[0].Rate
+	slippage := maxSlippage.Div(decimal.NewFromInt(100))
+	var accepted []Match
+	for _, match := range matches {
+		if order.Type == "BUY" && match.Rate.GreaterThan(best.Mul(decimal.NewFromInt(1).Add(slippage))) {
+			break
+		}
+		if order.Type == "SELL" && match.Rate.LessThan(best.Mul(decimal.NewFromInt(1).Sub(slippage))) {
+			break
+		}
+		accepted = append(accepted, match)
+	}
+	return accepted
+}
+
+// ExecuteMarketOrder fills a market order against the book and records it with its average rate
+func (e *MatchingEngine) ExecuteMarketOrder(order Order, maxSlippage decimal.Decimal) (MarketFill, error) {
+	matches := e.marketMatches(order, maxSlippage)
+	if len(matches) == 0 {
+		return MarketFill{}, errMarketOrderNoLiquidity
+	}
+	
+	fill := MarketFill{BestRate: matches[0].Rate, WorstRate: matches[len(matches)-1].Rate}
+	matchedAmount, quoteTotal := decimal.Zero, decimal.Zero
+	for _, match := range matches {
+		// Amounts in the order's own base currency, which is the sell side's on SELL orders
+		if order.Type == "SELL" {
+			fill.FilledAmount = fill.FilledAmount.Add(match.SellAmount)
+		} else {
+			fill.FilledAmount = fill.FilledAmount.Add(match.Amount)
+		}
+		matchedAmount = matchedAmount.Add(match.Amount)
+		quoteTotal = quoteTotal.Add(match.Amount.Mul(match.Rate))
+	}
+	fill.AverageRate = quoteTotal.DivRound(matchedAmount, 8)
+	
+	// The order, the buyer's funds and every match are written together: a failure anywhere
+	// leaves nothing behind
+	tx, err := e.db.Begin()
+	if err != nil {
+		return MarketFill{}, err
+	}
+	defer tx.Rollback()
+	
+	// Stored ACTIVE so recordMatch can fill it; it never enters the order caches
+	order.Rate = fill.AverageRate
+	order.RemainingAmount = order.Amount
+	order.Status = "ACTIVE"
+	paymentMethodsJSON, _ := json.Marshal(order.PaymentMethods)
+	err = tx.QueryRow(`
+		INSERT INTO orders (user_id, order_type, order_kind, currency_from, currency_to, amount,
+			remaining_amount, rate, min_amount, max_amount, payment_methods, status, created_at)
+		VALUES ($1, $2, 'MARKET', $3, $4, $5, $6, $7, 0, 0, $8, $9, $10)
+		RETURNING id
+	`, order.UserID, order.Type, order.CurrencyFrom, order.CurrencyTo, order.Amount,
+		order.RemainingAmount, order.Rate, string(paymentMethodsJSON), order.Status, order.CreatedAt).Scan(&order.ID)
+	if err != nil {
+		return MarketFill{}, fmt.Errorf("failed to insert into orders table: %v", err)
+	}
+	
+	_, err = tx.Exec(`
+		INSERT INTO p2p_orders (id, user_id, order_type, order_kind, currency_from, currency_to, amount,
+			remaining_amount, rate, min_amount, max_amount, payment_methods, status, created_at)
+		VALUES ($1, $2, $3, 'MARKET', $4, $5, $6, $7, $8, 0, 0, $9, $10, $11)
+		ON CONFLICT (id) DO NOTHING
+	`, order.ID, order.UserID, order.Type, order.CurrencyFrom, order.CurrencyTo, order.Amount,
+		order.RemainingAmount, order.Rate, convertJSONArrayToPGArray(order.PaymentMethods), order.Status, order.CreatedAt)
+	if err != nil {
+		return MarketFill{}, fmt.Errorf("failed to insert into p2p_orders table: %v", err)
+	}
+	
+	// Locked before matching, so the balance can't be spent twice by concurrent orders
+	if order.Type == "BUY" {
+		if err := lockBuyerFunds(tx, order, quoteTotal); err != nil {
+			return MarketFill{}, err
+		}
+	}
+	
+	executed := decimal.Zero
+	var executedMatches []Match
+	for _, match := range matches {
+		if order.Type == "BUY" {
+			match.BuyOrder.ID = order.ID
+		} else {
+			match.SellOrder.ID = order.ID
+		}
+		
+		matchID, err := recordMatch(tx, match)
+		if err != nil {
+			return MarketFill{}, fmt.Errorf("failed to execute match: %v", err)
+		}
+		fill.MatchIDs = append(fill.MatchIDs, matchID)
+		executedMatches = append(executedMatches, match)
+		if order.Type == "SELL" {
+			executed = executed.Add(match.SellAmount)
+		} else {
+			executed = executed.Add(match.Amount)
+		}
+	}
+	fill.FilledAmount = executed
+	fill.UnfilledAmount = order.Amount.Sub(executed)
+	
+	order.RemainingAmount = fill.UnfilledAmount
+	order.Status = "FILLED"
+	if fill.UnfilledAmount.IsPositive() {
+		order.Status = "CANCELLED"
+	}
+	_, err = tx.Exec(`UPDATE orders SET status = $2, remaining_amount = $3, updated_at = NOW() WHERE id = $1`,
+		order.ID, order.Status, order.RemainingAmount)
+	if err != nil {
+		return MarketFill{}, fmt.Errorf("failed to close market order: %v", err)
+	}
+	_, err = tx.Exec(`UPDATE p2p_orders SET status = $2, remaining_amount = $3 WHERE id = $1`,
+		order.ID, order.Status, order.RemainingAmount)
+	if err != nil {
+		return MarketFill{}, fmt.Errorf("failed to close market order: %v", err)
+	}
+	
+	if err := tx.Commit(); err != nil {
+		return MarketFill{}, err
+	}
+	for i, match := range executedMatches {
+		e.matchExecuted(match, fill.MatchIDs[i])
+	}
+	
+	fill.Order = order
+	return fill, nil
+}
+
+// handleCreateMarketOrder is the MARKET branch of handleCreateOrder; rate, min_amount and
+// max_amount are ignored
+func (s *Server) handleCreateMarketOrder(c *gin.Context, req CreateOrderRequest, userID string) {
+	if req.AmountIn == "QUOTE" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MARKET orders take amount_in BASE only"})
+		return
+	}
+	
+	baseCurrency, _ := orderBaseQuote(req.Type, req.CurrencyFrom, req.CurrencyTo)
+	if !s.checkOrderSize(c, baseCurrency, decimal.NewFromFloat(req.Amount)) {
+		return
+	}
+	
+	maxSlippage := decimal.NewFromInt(defaultMarketSlippagePercent)
+	if req.MaxSlippage != nil {
+		maxSlippage = decimal.NewFromFloat(*req.MaxSlippage)
+	}
+	
+	order := Order{
+		UserID:         userID,
+		Type:           req.Type,
+		CurrencyFrom:   req.CurrencyFrom,
+		CurrencyTo:     req.CurrencyTo,
+		Amount:         decimal.NewFromFloat(req.Amount),
+		PaymentMethods: req.PaymentMethods,
+		CreatedAt:      time.Now(),
+	}
+	
+	fill, err := s.engine.ExecuteMarketOrder(order, maxSlippage)
+	if err == errMarketOrderNoLiquidity {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":        "MARKET order could not be filled within the slippage bound",
+			"max_slippage": maxSlippage,
+		})
+		return
+	}
+	if err != nil {
+		requestLog(c).Printf("❌ Error executing market order for %s: %v", userID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	requestLog(c).Printf("⚡ Market %s order %s filled %s/%s at average rate %s", order.Type, fill.Order.ID,
+		fill.FilledAmount.String(), order.Amount.String(), fill.AverageRate.String())
+	
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Market order executed",
+		"order": OrderResponse{
+			ID:              fill.Order.ID,
+			UserID:          fill.Order.UserID,
+			Type:            fill.Order.Type,
+			CurrencyFrom:    fill.Order.CurrencyFrom,
+			CurrencyTo:      fill.Order.CurrencyTo,
+			Amount:          fill.Order.Amount,
+			RemainingAmount: fill.Order.RemainingAmount,
+			Rate:            fill.Order.Rate,
+			PaymentMethods:  fill.Order.PaymentMethods,
+			Status:          fill.Order.Status,
+			CreatedAt:       fill.Order.CreatedAt,
+			Matches:         fill.MatchIDs,
+		},
+		"order_kind":      OrderKindMarket,
+		"filled_amount":   fill.FilledAmount,
+		"unfilled_amount": fill.UnfilledAmount,
+		"average_rate":    fill.AverageRate,
+		"best_rate":       fill.BestRate,
+		"worst_rate":      fill.WorstRate,
+		"max_slippage":    maxSlippage,
+	})
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// Rate suggestions: GET /market/suggest-rate?pair=USD_BOB&type=SELL&amount=100 proposes a rate
+// inside the spread that puts a new order ahead of the current best one on its side. How far it
+// moves into the spread follows the book imbalance, (bid volume - ask volume) / total volume: a
+// seller facing more demand than supply stays close to the best ask, one facing more supply
+// moves towards the best bid, and the other way around for buyers. The expected wait is the
+// volume that has to fill first (the orders ahead plus the amount itself) over the volume that
+// orders of that type filled per minute over the last suggestRateLookback.
+
+const suggestRateLookback = 24 * time.Hour
+
+// Smallest rate step suggested, and the share of the spread a suggestion may move into
+var (
+	rateTick           = decimal.New(1, -4)
+	minSpreadShare     = decimal.NewFromFloat(0.1)
+	maxSpreadShare     = decimal.NewFromFloat(0.9)
+	imbalanceSensitivity = decimal.NewFromFloat(0.4)
+)
+
+type RecentFills struct {
+	Fills            int              `json:"fills"`
+	Volume           decimal.Decimal  `json:"volume"`
+	AverageRate      *decimal.Decimal `json:"average_rate"`
+	AvgMinutesToFill *float64         `json:"avg_minutes_to_fill"`
+	VolumePerMinute  decimal.Decimal  `json:"-"`
+}
+
+type RateSuggestion struct {
+	Pair            string           `json:"pair"`
+	Type            string           `json:"type"`
+	Amount          *decimal.Decimal `json:"amount,omitempty"`
+	BestBid         *decimal.Decimal `json:"best_bid"`
+	BestAsk         *decimal.Decimal `json:"best_ask"`
+	Spread          *decimal.Decimal `json:"spread"`
+	BidVolume       decimal.Decimal  `json:"bid_volume"`
+	AskVolume       decimal.Decimal  `json:"ask_volume"`
+	Imbalance       decimal.Decimal  `json:"imbalance"`
+	SuggestedRate   decimal.Decimal  `json:"suggested_rate"`
+	CurrentBestRate *decimal.Decimal `json:"current_best_rate"`
+	Recent          RecentFills      `json:"recent_fills"`
+	// Expected minutes to fill at the suggested rate and when joining the current best rate;
+	// null without recent fills to estimate from
+	ExpectedWaitMinutes       *float64 `json:"expected_wait_minutes"`
+	ExpectedWaitAtBestMinutes *float64 `json:"expected_wait_at_best_minutes"`
+}
+
+// bookImbalance returns (bids - asks) / (bids + asks), 0 for an empty book
+func bookImbalance(bidVolume, askVolume decimal.Decimal) decimal.Decimal {
+	total := bidVolume.Add(askVolume)
+	if !total.IsPositive() {
+		return decimal.Zero
+	}
+	return bidVolume.Sub(askVolume).Div(total).Round(4)
+}
+
+func clampDecimal(value, min, max decimal.Decimal) decimal.Decimal {
+	if value.LessThan(min) {
+		return min
+	}
+	if value.GreaterThan(max) {
+		return max
+	}
+	return value
+}
+
+// suggestCompetitiveRate proposes a rate for a new order of orderType given the best bid and
+// ask (nil when that side is empty), the book imbalance and the average recent fill rate
+func suggestCompetitiveRate(orderType string, bestBid, bestAsk *decimal.Decimal, imbalance decimal.Decimal, recentRate *decimal.Decimal) (decimal.Decimal, bool) {
+	switch {
+	case bestBid != nil && bestAsk != nil && bestAsk.Sub(*bestBid).GreaterThan(rateTick):
+		spread := bestAsk.Sub(*bestBid)
+		if orderType == "SELL" {
+			share := clampDecimal(decimal.NewFromFloat(0.5).Sub(imbalanceSensitivity.Mul(imbalance)), minSpreadShare, maxSpreadShare)
+			rate := bestAsk.Sub(spread.Mul(share)).Round(4)
+			return clampDecimal(rate, bestBid.Add(rateTick), bestAsk.Sub(rateTick)), true
+		}
+		share := clampDecimal(decimal.NewFromFloat(0.5).Add(imbalanceSensitivity.Mul(imbalance)), minSpreadShare, maxSpreadShare)
+		rate := bestBid.Add(spread.Mul(share)).Round(4)
+		return clampDecimal(rate, bestBid.Add(rateTick), bestAsk.Sub(rateTick)), true
+
+	case bestBid != nil && bestAsk != nil:
+		// No room inside the spread: join the best rate of the order's side
+		if orderType == "SELL" {
+			return *bestAsk, true
+		}
+		return *bestBid, true
+
+	case orderType == "SELL" && bestAsk != nil:
+		return bestAsk.Sub(rateTick), true
+	case orderType == "BUY" && bestBid != nil:
+		return bestBid.Add(rateTick), true
+
+	case orderType == "SELL" && bestBid != nil:
+		// No competing sellers: ask at the recent market rate, above the best bid
+		rate := bestBid.Add(rateTick)
+		if recentRate != nil && recentRate.GreaterThan(rate) {
+			rate = recentRate.Round(4)
+		}
+		return rate, true
+	case orderType == "BUY" && bestAsk != nil:
+		rate := bestAsk.Sub(rateTick)
+		if recentRate != nil && recentRate.LessThan(rate) {
+			rate = recentRate.Round(4)
+		}
+		return rate, true
+
+	case recentRate != nil:
+		return recentRate.Round(4), true
+	}
+	return decimal.Zero, false
+}
+
+// volumeAhead sums the remaining amount of same-side orders that would fill before an order at
+// rate: better rates, and equal ones when joining since they keep time priority
+func volumeAhead(orders []Order, orderType string, rate decimal.Decimal, includeEqual bool) decimal.Decimal {
+	ahead := decimal.Zero
+	for _, order := range orders {
+		better := order.Rate.LessThan(rate)
+		if orderType == "BUY" {
+			better = order.Rate.GreaterThan(rate)
+		}
+		if better || (includeEqual && order.Rate.Equal(rate)) {
+			ahead = ahead.Add(order.RemainingAmount)
+		}
+	}
+	return ahead
+}
+
+func expectedWaitMinutes(volume, perMinute decimal.Decimal) *float64 {
+	if !perMinute.IsPositive() {
+		return nil
+	}
+	minutes, _ := volume.Div(perMinute).Round(1).Float64()
+	return &minutes
+}
+
+// recentFills summarizes the matches that filled orders of orderType on the pair lately
+func (e *MatchingEngine) recentFills(currencyFrom, currencyTo, orderType string, since time.Time) (RecentFills, error) {
+	var fills RecentFills
+	orderColumn := "m.sell_order_id"
+	if orderType == "BUY" {
+		orderColumn = "m.buy_order_id"
+	}
+
+	err := e.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(m.amount), 0),
+			SUM(m.amount * m.rate) / NULLIF(SUM(m.amount), 0),
+			AVG(EXTRACT(EPOCH FROM (m.created_at - o.created_at)) / 60)::float8
+		FROM matches m
+		JOIN orders o ON o.id = `+orderColumn+`
+		WHERE o.currency_from = $1 AND o.currency_to = $2 AND m.created_at >= $3
+	`, currencyFrom, currencyTo, since).Scan(&fills.Fills, &fills.Volume, &fills.AverageRate, &fills.AvgMinutesToFill)
+	if err != nil {
+		return fills, err
+	}
+	if fills.AverageRate != nil {
+		rate := fills.AverageRate.Round(8)
+		fills.AverageRate = &rate
+	}
+	fills.VolumePerMinute = fills.Volume.Div(decimal.NewFromFloat(time.Since(since).Minutes()))
+	return fills, nil
+}
+
+func (s *Server) handleSuggestRate(c *gin.Context) {
+	currencyFrom, currencyTo, ok := bindPairQuery(c)
+	if !ok {
+		return
+	}
+	pair := currencyFrom + "_" + currencyTo
+	orderType := strings.ToUpper(c.Query("type"))
+	if orderType != "BUY" && orderType != "SELL" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be BUY or SELL"})
+		return
+	}
+
+	suggestion := RateSuggestion{Pair: pair, Type: orderType}
+	amount := decimal.Zero
+	if value := c.Query("amount"); value != "" {
+		parsed, err := decimal.NewFromString(value)
+		if err != nil || !parsed.IsPositive() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be a positive number"})
+			return
+		}
+		amount = parsed
+		suggestion.Amount = &amount
+	}
+
+	orderBook, err := s.engine.GetOrderBook(currencyFrom, currencyTo)
+	if err != nil {
+		requestLog(c).Printf("Error loading order book for %s: %v", pair, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load order book"})
+		return
+	}
+	bids, asks := orderBook.BuyOrders, orderBook.SellOrders
+	sort.SliceStable(bids, func(i, j int) bool { return bids[i].Rate.GreaterThan(bids[j].Rate) })
+	sort.SliceStable(asks, func(i, j int) bool { return asks[i].Rate.LessThan(asks[j].Rate) })
+
+	for _, order := range bids {
+		suggestion.BidVolume = suggestion.BidVolume.Add(order.RemainingAmount)
+	}
+	for _, order := range asks {
+		suggestion.AskVolume = suggestion.AskVolume.Add(order.RemainingAmount)
+	}
+	if len(bids) > 0 {
+		suggestion.BestBid = &bids[0].Rate
+	}
+	if len(asks) > 0 {
+		suggestion.BestAsk = &asks[0].Rate
+	}
+	if suggestion.BestBid != nil && suggestion.BestAsk != nil {
+		spread := suggestion.BestAsk.Sub(*suggestion.BestBid)
+		suggestion.Spread = &spread
+	}
+	suggestion.Imbalance = bookImbalance(suggestion.BidVolume, suggestion.AskVolume)
+
+	suggestion.Recent, err = s.engine.recentFills(currencyFrom, currencyTo, orderType, time.Now().Add(-suggestRateLookback))
+	if err != nil {
+		requestLog(c).Printf("Error loading recent fills for %s: %v", pair, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load recent fills"})
+		return
+	}
+
+	rate, ok := suggestCompetitiveRate(orderType, suggestion.BestBid, suggestion.BestAsk, suggestion.Imbalance, suggestion.Recent.AverageRate)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not enough market data to suggest a rate for this pair"})
+		return
+	}
+	suggestion.SuggestedRate = rate
+
+	sameSide := asks
+	suggestion.CurrentBestRate = suggestion.BestAsk
+	if orderType == "BUY" {
+		sameSide = bids
+		suggestion.CurrentBestRate = suggestion.BestBid
+	}
+	perMinute := suggestion.Recent.VolumePerMinute
+	suggestion.ExpectedWaitMinutes = expectedWaitMinutes(volumeAhead(sameSide, orderType, rate, true).Add(amount), perMinute)
+	if suggestion.CurrentBestRate != nil {
+		suggestion.ExpectedWaitAtBestMinutes = expectedWaitMinutes(volumeAhead(sameSide, orderType, *suggestion.CurrentBestRate, true).Add(amount), perMinute)
+	}
+
+	c.JSON(http.StatusOK, suggestion)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/shopspring/decimal"
+)
+
+var bookColumns = []string{"id", "user_id", "order_type", "currency_from", "currency_to", "amount", "remaining_amount",
+	"rate", "min_amount", "max_amount", "payment_methods", "status", "created_at"}
+
+// expectSeededBook expects the USD_BOB book to load with bids at 6.85 (200) and 6.80 (100) and
+// asks at 6.95 and 7.00 (100 each), and 1440 USD filled over the last day
+func expectSeededBook(mock sqlmock.Sqlmock) {
+	rows := sqlmock.NewRows(bookColumns)
+	for _, order := range []struct{ id, side, amount, rate string }{
+		{"bid-2", "BUY", "100", "6.80"},
+		{"bid-1", "BUY", "200", "6.85"},
+		{"ask-1", "SELL", "100", "6.95"},
+		{"ask-2", "SELL", "100", "7.00"},
+	} {
+		rows.AddRow(order.id, "user-"+order.id, order.side, "USD", "BOB", order.amount, order.amount,
+			order.rate, "0", "0", `["QR"]`, "ACTIVE", time.Now())
+	}
+	mock.ExpectQuery(`FROM p2p_orders\s+WHERE currency_from = \$1 AND currency_to = \$2 AND status = 'ACTIVE'`).
+		WithArgs("USD", "BOB").WillReturnRows(rows)
+	mock.ExpectQuery(`FROM matches m`).WithArgs("USD", "BOB", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "volume", "rate", "minutes"}).AddRow(int64(60), "1440", "6.9", 12.0))
+}
+
+func TestSuggestRateSitsInsideTheSpread(t *testing.T) {
+	bestBid, bestAsk := decimal.RequireFromString("6.85"), decimal.RequireFromString("6.95")
+
+	for _, orderType := range []string{"SELL", "BUY"} {
+		t.Run(orderType, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			expectSeededBook(mock)
+
+			mr := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			defer client.Close()
+			s := &Server{db: db, engine: &MatchingEngine{db: db, redis: client}}
+
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/market/suggest-rate?pair=usd_bob&type="+orderType+"&amount=50", nil)
+			s.handleSuggestRate(c)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+			}
+			var suggestion RateSuggestion
+			if err := json.Unmarshal(w.Body.Bytes(), &suggestion); err != nil {
+				t.Fatal(err)
+			}
+
+			if !suggestion.SuggestedRate.GreaterThan(bestBid) || !suggestion.SuggestedRate.LessThan(bestAsk) {
+				t.Errorf("suggested_rate = %s, want strictly between the best bid %s and best ask %s",
+					suggestion.SuggestedRate, bestBid, bestAsk)
+			}
+			// More bid than ask volume: imbalance (300 - 200) / 500
+			if !suggestion.Imbalance.Equal(decimal.RequireFromString("0.2")) {
+				t.Errorf("imbalance = %s, want 0.2", suggestion.Imbalance)
+			}
+
+			// At the suggested rate the order is first in line; at the current best it queues behind it
+			if suggestion.ExpectedWaitMinutes == nil || suggestion.ExpectedWaitAtBestMinutes == nil {
+				t.Fatalf("expected waits = %v and %v, want both estimated", suggestion.ExpectedWaitMinutes,
+					suggestion.ExpectedWaitAtBestMinutes)
+			}
+			if *suggestion.ExpectedWaitMinutes >= *suggestion.ExpectedWaitAtBestMinutes {
+				t.Errorf("expected wait %.1f min at %s, want less than %.1f min at the best rate", *suggestion.ExpectedWaitMinutes,
+					suggestion.SuggestedRate, *suggestion.ExpectedWaitAtBestMinutes)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestSuggestCompetitiveRateWithoutRoomInTheSpread(t *testing.T) {
+	bid, ask := decimal.RequireFromString("6.9"), decimal.RequireFromString("6.9001")
+
+	if rate, ok := suggestCompetitiveRate("SELL", &bid, &ask, decimal.Zero, nil); !ok || !rate.Equal(ask) {
+		t.Errorf("SELL suggestion = %s, want to join the best ask %s", rate, ask)
+	}
+	if rate, ok := suggestCompetitiveRate("BUY", &bid, &ask, decimal.Zero, nil); !ok || !rate.Equal(bid) {
+		t.Errorf("BUY suggestion = %s, want to join the best bid %s", rate, bid)
+	}
+	if _, ok := suggestCompetitiveRate("BUY", nil, nil, decimal.Zero, nil); ok {
+		t.Error("suggested a rate without a book or recent fills")
+	}
+}
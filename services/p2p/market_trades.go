@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// Public trade history of a pair, for recent prices and charts. A trade is a match that was not
+// cancelled, sandbox ones left out; it belongs to the pair of its buy order, whose book it was
+// matched on, and its rate and amount are the ones stored on the match. The side is the taker's:
+// whichever of the two orders arrived last. No user or order IDs are exposed. GET /market/ticker
+// summarizes the trades of the last tickerWindow; last is the latest trade even when older.
+
+const (
+	defaultMarketTradesLimit = 50
+	maxMarketTradesLimit     = 500
+	tickerWindow             = 24 * time.Hour
+)
+
+type MarketTrade struct {
+	ID         string          `json:"id"`
+	Amount     decimal.Decimal `json:"amount"`
+	Rate       decimal.Decimal `json:"rate"`
+	Total      decimal.Decimal `json:"total"`
+	TakerSide  string          `json:"taker_side"`
+	ExecutedAt time.Time       `json:"executed_at"`
+}
+
+type MarketTicker struct {
+	Pair          string           `json:"pair"`
+	Last          *decimal.Decimal `json:"last"`
+	LastTradeAt   *time.Time       `json:"last_trade_at"`
+	Open          *decimal.Decimal `json:"open"`
+	High          *decimal.Decimal `json:"high"`
+	Low           *decimal.Decimal `json:"low"`
+	ChangePercent *decimal.Decimal `json:"change_percent"`
+	Volume        decimal.Decimal  `json:"volume"`
+	QuoteVolume   decimal.Decimal  `json:"quote_volume"`
+	Trades        int              `json:"trades"`
+	Since         time.Time        `json:"since"`
+}
+
+// recentTrades returns the latest trades of the pair, newest first
+func (e *MatchingEngine) recentTrades(currencyFrom, currencyTo string, limit int) ([]MarketTrade, error) {
+	rows, err := e.db.Query(`
+		SELECT m.id, m.amount, m.rate, m.created_at,
+			CASE WHEN bo.created_at > so.created_at THEN 'BUY' ELSE 'SELL' END
+		FROM matches m
+		JOIN orders bo ON bo.id = m.buy_order_id
+		JOIN orders so ON so.id = m.sell_order_id
+		WHERE bo.currency_from = $1 AND bo.currency_to = $2 AND m.status <> 'CANCELLED'
+			AND COALESCE(bo.is_sandbox, false) = false
+		ORDER BY m.created_at DESC
+		LIMIT $3
+	`, currencyFrom, currencyTo, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trades := []MarketTrade{}
+	for rows.Next() {
+		var trade MarketTrade
+		if err := rows.Scan(&trade.ID, &trade.Amount, &trade.Rate, &trade.ExecutedAt, &trade.TakerSide); err != nil {
+			return nil, err
+		}
+		trade.Total = trade.Amount.Mul(trade.Rate).Round(8)
+		trades = append(trades, trade)
+	}
+	return trades, rows.Err()
+}
+
+// ticker summarizes the trades of the pair since the start of the window
+func (e *MatchingEngine) ticker(currencyFrom, currencyTo string, since time.Time) (MarketTicker, error) {
+	ticker := MarketTicker{Pair: currencyFrom + "_" + currencyTo, Since: since}
+	err := e.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(m.amount), 0), COALESCE(SUM(m.amount * m.rate), 0),
+			MAX(m.rate), MIN(m.rate),
+			(ARRAY_AGG(m.rate ORDER BY m.created_at ASC))[1]
+		FROM matches m
+		JOIN orders bo ON bo.id = m.buy_order_id
+		WHERE bo.currency_from = $1 AND bo.currency_to = $2 AND m.status <> 'CANCELLED'
+			AND COALESCE(bo.is_sandbox, false) = false AND m.created_at >= $3
+	`, currencyFrom, currencyTo, since).Scan(&ticker.Trades, &ticker.Volume, &ticker.QuoteVolume,
+		&ticker.High, &ticker.Low, &ticker.Open)
+	if err != nil {
+		return ticker, err
+	}
+	ticker.QuoteVolume = ticker.QuoteVolume.Round(8)
+
+	last, err := e.recentTrades(currencyFrom, currencyTo, 1)
+	if err != nil {
+		return ticker, err
+	}
+	if len(last) > 0 {
+		ticker.Last = &last[0].Rate
+		ticker.LastTradeAt = &last[0].ExecutedAt
+	}
+
+	if ticker.Open != nil && ticker.Last != nil && ticker.Open.IsPositive() && ticker.Trades > 0 {
+		change := ticker.Last.Sub(*ticker.Open).Div(*ticker.Open).Mul(decimal.NewFromInt(100)).Round(2)
+		ticker.ChangePercent = &change
+	}
+	return ticker, nil
+}
+
+func (s *Server) handleGetMarketTrades(c *gin.Context) {
+	currencyFrom, currencyTo, ok := bindPairQuery(c)
+	if !ok {
+		return
+	}
+	limit := defaultMarketTradesLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxMarketTradesLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxMarketTradesLimit)})
+			return
+		}
+		limit = parsed
+	}
+
+	trades, err := s.engine.recentTrades(currencyFrom, currencyTo, limit)
+	if err != nil {
+		requestLog(c).Printf("Error loading trades for %s_%s: %v", currencyFrom, currencyTo, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch trades"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pair":   currencyFrom + "_" + currencyTo,
+		"trades": trades,
+	})
+}
+
+func (s *Server) handleGetMarketTicker(c *gin.Context) {
+	currencyFrom, currencyTo, ok := bindPairQuery(c)
+	if !ok {
+		return
+	}
+
+	ticker, err := s.engine.ticker(currencyFrom, currencyTo, time.Now().Add(-tickerWindow))
+	if err != nil {
+		requestLog(c).Printf("Error computing ticker for %s_%s: %v", currencyFrom, currencyTo, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute ticker"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ticker)
+}
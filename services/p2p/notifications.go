@@ -0,0 +1,374 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// How a notification event type reaches the user:
+//   immediate - delivered right away, never throttled (critical events)
+//   throttle  - delivered right away until the user got NOTIFICATION_BURST of them in the
+//               current digest window, then coalesced into the next digest
+//   digest    - always coalesced into the periodic digest
+const (
+	deliveryImmediate = "immediate"
+	deliveryThrottle  = "throttle"
+	deliveryDigest    = "digest"
+)
+
+// Notification event types
+const (
+	eventNewOrder          = "NEW_ORDER"
+	eventOrderAccepted     = "ORDER_ACCEPTED"
+	eventPaymentConfirmed  = "PAYMENT_CONFIRMED"
+	eventReceiptPending    = "RECEIPT_PENDING"
+	eventOrderCancelled    = "ORDER_CANCELLED"
+	eventCashierSuspended  = "CASHIER_SUSPENDED"
+	eventCashierReinstated = "CASHIER_REINSTATED"
+	eventDisputeCreated    = "DISPUTE_CREATED"
+	eventKYCApproved       = "KYC_APPROVED"
+	eventKYCRejected       = "KYC_REJECTED"
+)
+
+// Overridable with NOTIFICATION_POLICIES=TYPE:mode,...; unknown types are throttled
+var defaultNotificationPolicies = map[string]string{
+	eventNewOrder:          deliveryDigest,
+	eventOrderAccepted:     deliveryThrottle,
+	eventPaymentConfirmed:  deliveryImmediate,
+	eventReceiptPending:    deliveryImmediate,
+	eventOrderCancelled:    deliveryImmediate,
+	eventCashierSuspended:  deliveryImmediate,
+	eventCashierReinstated: deliveryImmediate,
+	eventDisputeCreated:    deliveryImmediate,
+	eventKYCApproved:       deliveryImmediate,
+	eventKYCRejected:       deliveryImmediate,
+}
+
+// Order IDs kept per event type in a digest; the count covers the rest
+const maxDigestSamples = 10
+
+type NotificationEvent struct {
+	UserID  string
+	Type    string
+	OrderID string
+	Message string
+}
+
+type pendingDigest struct {
+	Count    int      `json:"count"`
+	OrderIDs []string `json:"order_ids"`
+}
+
+// NotificationDispatcher stores user notifications, coalescing high-frequency events into
+// one digest per user every interval
+type NotificationDispatcher struct {
+	db       *sql.DB
+	policies map[string]string
+	interval time.Duration
+	burst    int
+	channels []Notifier
+
+	mu      sync.Mutex
+	sent    map[string]int                       // user -> throttled events delivered this window
+	pending map[string]map[string]*pendingDigest // user -> event type -> coalesced events
+}
+
+func NewNotificationDispatcher(db *sql.DB) *NotificationDispatcher {
+	d := &NotificationDispatcher{
+		db:       db,
+		policies: loadNotificationPolicies(),
+		interval: 5 * time.Minute,
+		burst:    3,
+		channels: loadNotifiers(),
+		sent:     make(map[string]int),
+		pending:  make(map[string]map[string]*pendingDigest),
+	}
+	if value, err := strconv.Atoi(os.Getenv("NOTIFICATION_DIGEST_SECONDS")); err == nil && value > 0 {
+		d.interval = time.Duration(value) * time.Second
+	}
+	if value, err := strconv.Atoi(os.Getenv("NOTIFICATION_BURST")); err == nil && value >= 0 {
+		d.burst = value
+	}
+	return d
+}
+
+func loadNotificationPolicies() map[string]string {
+	policies := make(map[string]string, len(defaultNotificationPolicies))
+	for eventType, mode := range defaultNotificationPolicies {
+		policies[eventType] = mode
+	}
+
+	for _, entry := range strings.Split(os.Getenv("NOTIFICATION_POLICIES"), ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		eventType := strings.ToUpper(strings.TrimSpace(parts[0]))
+		mode := strings.ToLower(strings.TrimSpace(parts[1]))
+		switch mode {
+		case deliveryImmediate, deliveryThrottle, deliveryDigest:
+			policies[eventType] = mode
+		default:
+			log.Printf("Warning: ignoring notification policy %q", entry)
+		}
+	}
+	return policies
+}
+
+func (d *NotificationDispatcher) policy(eventType string) string {
+	if mode, ok := d.policies[eventType]; ok {
+		return mode
+	}
+	return deliveryThrottle
+}
+
+// Start flushes digests every interval
+func (d *NotificationDispatcher) Start() {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		d.flushDigests()
+	}
+}
+
+// Notify delivers the event now or queues it for the user's next digest
+func (d *NotificationDispatcher) Notify(event NotificationEvent) {
+	if !d.queue(event) {
+		return
+	}
+	if err := d.store(event.UserID, event.Type, event.Message, map[string]interface{}{"order_id": event.OrderID}, 1, false); err != nil {
+		log.Printf("❌ Failed to store %s notification for %s: %v", event.Type, event.UserID, err)
+	}
+}
+
+// queue reports whether the event should be delivered immediately; otherwise it is
+// added to the user's pending digest
+func (d *NotificationDispatcher) queue(event NotificationEvent) bool {
+	mode := d.policy(event.Type)
+	if mode == deliveryImmediate {
+		return true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if mode == deliveryThrottle && d.sent[event.UserID] < d.burst {
+		d.sent[event.UserID]++
+		return true
+	}
+
+	byType := d.pending[event.UserID]
+	if byType == nil {
+		byType = make(map[string]*pendingDigest)
+		d.pending[event.UserID] = byType
+	}
+	digest := byType[event.Type]
+	if digest == nil {
+		digest = &pendingDigest{}
+		byType[event.Type] = digest
+	}
+	digest.Count++
+	if event.OrderID != "" && len(digest.OrderIDs) < maxDigestSamples {
+		digest.OrderIDs = append(digest.OrderIDs, event.OrderID)
+	}
+	return false
+}
+
+// takeDigests empties the pending digests and starts a new throttling window
+func (d *NotificationDispatcher) takeDigests() map[string]map[string]*pendingDigest {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pending := d.pending
+	d.pending = make(map[string]map[string]*pendingDigest)
+	d.sent = make(map[string]int)
+	return pending
+}
+
+func (d *NotificationDispatcher) flushDigests() {
+	for userID, byType := range d.takeDigests() {
+		types := make([]string, 0, len(byType))
+		total := 0
+		for eventType, digest := range byType {
+			types = append(types, eventType)
+			total += digest.Count
+		}
+		sort.Strings(types)
+
+		parts := make([]string, 0, len(types))
+		for _, eventType := range types {
+			parts = append(parts, fmt.Sprintf("%d %s", byType[eventType].Count, eventType))
+		}
+		message := fmt.Sprintf("%d updates since your last digest: %s", total, strings.Join(parts, ", "))
+
+		data := make(map[string]interface{}, len(byType))
+		for eventType, digest := range byType {
+			data[eventType] = digest
+		}
+
+		if err := d.store(userID, "DIGEST", message, data, total, true); err != nil {
+			log.Printf("❌ Failed to store notification digest for %s: %v", userID, err)
+		}
+	}
+}
+
+func (d *NotificationDispatcher) store(userID, eventType, message string, data map[string]interface{}, eventCount int, isDigest bool) error {
+	payload, _ := json.Marshal(data)
+	_, err := d.db.Exec(`
+		INSERT INTO user_notifications (user_id, event_type, message, data, event_count, is_digest)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, userID, eventType, message, payload, eventCount, isDigest)
+	if err != nil {
+		return err
+	}
+
+	go d.sendOutbound(userID, eventType, message)
+	return nil
+}
+
+// notifyCashiersOfOrder tells the online cashiers available for the order's pair about it
+func (e *MatchingEngine) notifyCashiersOfOrder(order Order) {
+	rows, err := e.db.Query(`
+		SELECT DISTINCT ca.cashier_id
+		FROM cashier_availability ca
+		JOIN users u ON u.id = ca.cashier_id
+		JOIN orders o ON o.id = $1
+		WHERE ca.is_active = true
+			AND ca.currency_from = o.currency_from
+			AND ca.currency_to = o.currency_to
+			AND COALESCE(u.is_sandbox, false) = COALESCE(o.is_sandbox, false)
+	`, order.ID)
+	if err != nil {
+		log.Printf("❌ Failed to load cashiers for order %s: %v", order.ID, err)
+		return
+	}
+	defer rows.Close()
+
+	var cashierIDs []string
+	for rows.Next() {
+		var cashierID string
+		if err := rows.Scan(&cashierID); err != nil {
+			continue
+		}
+		cashierIDs = append(cashierIDs, cashierID)
+	}
+
+	online, err := e.onlineCashiers(cashierIDs)
+	if err != nil {
+		log.Printf("❌ Failed to check which cashiers are online for order %s: %v", order.ID, err)
+		return
+	}
+
+	message := fmt.Sprintf("New %s order: %s %s -> %s", order.Type, order.Amount.String(), order.CurrencyFrom, order.CurrencyTo)
+	for _, cashierID := range cashierIDs {
+		if online[cashierID] {
+			e.notifier.Notify(NotificationEvent{UserID: cashierID, Type: eventNewOrder, OrderID: order.ID, Message: message})
+		}
+	}
+}
+
+func (s *Server) handleGetNotifications(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	limit := 50
+	if value, err := strconv.Atoi(c.Query("limit")); err == nil && value > 0 && value <= 200 {
+		limit = value
+	}
+
+	where := "user_id = $1"
+	if c.Query("unread") == "true" {
+		where += " AND read_at IS NULL"
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, event_type, message, data, event_count, is_digest, read_at, created_at
+		FROM user_notifications
+		WHERE `+where+`
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+	defer rows.Close()
+
+	notifications := []gin.H{}
+	for rows.Next() {
+		var id, eventType, message string
+		var data []byte
+		var eventCount int
+		var isDigest bool
+		var readAt sql.NullTime
+		var createdAt time.Time
+		if err := rows.Scan(&id, &eventType, &message, &data, &eventCount, &isDigest, &readAt, &createdAt); err != nil {
+			continue
+		}
+
+		notification := gin.H{
+			"id":          id,
+			"event_type":  eventType,
+			"message":     message,
+			"data":        json.RawMessage(data),
+			"event_count": eventCount,
+			"is_digest":   isDigest,
+			"created_at":  createdAt,
+		}
+		if readAt.Valid {
+			notification["read_at"] = readAt.Time
+		}
+		notifications = append(notifications, notification)
+	}
+
+	var unread int
+	s.db.QueryRow(`SELECT COUNT(*) FROM user_notifications WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&unread)
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications,
+		"unread":        unread,
+	})
+}
+
+// handleMarkNotificationsRead marks the given notifications (or all when none are given) as read
+func (s *Server) handleMarkNotificationsRead(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	query := `UPDATE user_notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`
+	args := []interface{}{userID}
+	if len(req.IDs) > 0 {
+		query += ` AND id::text = ANY($2)`
+		args = append(args, pq.Array(req.IDs))
+	}
+
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications"})
+		return
+	}
+
+	marked, _ := result.RowsAffected()
+	c.JSON(http.StatusOK, gin.H{"marked": marked})
+}
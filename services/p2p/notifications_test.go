@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// digestDataArg matches the data of a digest holding the given number of events per type
+type digestDataArg map[string]int
+
+func (a digestDataArg) Match(v driver.Value) bool {
+	var data map[string]pendingDigest
+	if err := json.Unmarshal(v.([]byte), &data); err != nil || len(data) != len(a) {
+		return false
+	}
+	for eventType, count := range a {
+		if data[eventType].Count != count {
+			return false
+		}
+	}
+	return true
+}
+
+func expectNotification(mock sqlmock.Sqlmock, eventType string, eventCount int, isDigest bool) {
+	mock.ExpectExec(`INSERT INTO user_notifications`).
+		WithArgs("cashier-1", eventType, sqlmock.AnyArg(), sqlmock.AnyArg(), eventCount, isDigest).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestRapidEventsAreDigestedAndCriticalOnesBypassThrottling(t *testing.T) {
+	t.Setenv("NOTIFICATION_POLICIES", "")
+	t.Setenv("NOTIFICATION_BURST", "2")
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	d := NewNotificationDispatcher(db)
+	d.channels = nil
+	notify := func(eventType, orderID string) {
+		d.Notify(NotificationEvent{UserID: "cashier-1", Type: eventType, OrderID: orderID, Message: eventType})
+	}
+
+	// Acceptances are delivered until the burst of 2 is used up
+	expectNotification(mock, eventOrderAccepted, 1, false)
+	expectNotification(mock, eventOrderAccepted, 1, false)
+	// A payment confirmation is critical and goes out even after the burst
+	expectNotification(mock, eventPaymentConfirmed, 1, false)
+
+	for _, orderID := range []string{"order-1", "order-2", "order-3", "order-4", "order-5"} {
+		notify(eventNewOrder, orderID)
+	}
+	for _, orderID := range []string{"order-6", "order-7", "order-8"} {
+		notify(eventOrderAccepted, orderID)
+	}
+	notify(eventPaymentConfirmed, "order-6")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The five new orders and the third acceptance arrive together in one digest
+	mock.ExpectExec(`INSERT INTO user_notifications`).
+		WithArgs("cashier-1", "DIGEST", "6 updates since your last digest: 5 NEW_ORDER, 1 ORDER_ACCEPTED",
+			digestDataArg{eventNewOrder: 5, eventOrderAccepted: 1}, 6, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	d.flushDigests()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The flush starts a new window: acceptances are delivered again
+	expectNotification(mock, eventOrderAccepted, 1, false)
+	notify(eventOrderAccepted, "order-9")
+	d.flushDigests()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNotificationPoliciesAreConfigurable(t *testing.T) {
+	t.Setenv("NOTIFICATION_POLICIES", "new_order:immediate, PAYMENT_CONFIRMED:digest, ORDER_ACCEPTED:bogus")
+
+	policies := loadNotificationPolicies()
+	want := map[string]string{
+		eventNewOrder:         deliveryImmediate,
+		eventPaymentConfirmed: deliveryDigest,
+		eventOrderAccepted:    deliveryThrottle,
+	}
+	for eventType, mode := range want {
+		if policies[eventType] != mode {
+			t.Errorf("%s policy = %q, want %q", eventType, policies[eventType], mode)
+		}
+	}
+}
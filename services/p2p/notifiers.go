@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Outbound channels: every notification stored in user_notifications is also sent through
+// the channels listed in NOTIFICATION_CHANNELS (comma separated, default log):
+//   log   - writes the notification to the service log (development and tests)
+//   email - SMTP_HOST, SMTP_PORT (587), SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM
+//   sms   - POSTs {"to", "message"} to SMS_API_URL with SMS_API_KEY as bearer token
+// A channel missing its configuration is skipped with a warning at startup; users without an
+// email or phone are skipped by that channel.
+
+type Recipient struct {
+	UserID string
+	Email  string
+	Phone  string
+}
+
+type OutboundMessage struct {
+	EventType string
+	Subject   string
+	Body      string
+}
+
+type Notifier interface {
+	Name() string
+	Send(recipient Recipient, message OutboundMessage) error
+}
+
+func loadNotifiers() []Notifier {
+	value := os.Getenv("NOTIFICATION_CHANNELS")
+	if value == "" {
+		value = "log"
+	}
+
+	var notifiers []Notifier
+	for _, channel := range strings.Split(value, ",") {
+		switch strings.ToLower(strings.TrimSpace(channel)) {
+		case "":
+		case "log":
+			notifiers = append(notifiers, logNotifier{})
+		case "email":
+			if notifier, ok := newSMTPNotifier(); ok {
+				notifiers = append(notifiers, notifier)
+			}
+		case "sms":
+			if notifier, ok := newSMSNotifier(); ok {
+				notifiers = append(notifiers, notifier)
+			}
+		default:
+			log.Printf("Warning: ignoring unknown notification channel %q", channel)
+		}
+	}
+	return notifiers
+}
+
+type logNotifier struct{}
+
+func (logNotifier) Name() string { return "log" }
+
+func (logNotifier) Send(recipient Recipient, message OutboundMessage) error {
+	log.Printf("🔔 Notification for %s [%s]: %s", recipient.UserID, message.EventType, message.Body)
+	return nil
+}
+
+type smtpNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func newSMTPNotifier() (*smtpNotifier, bool) {
+	host := os.Getenv("SMTP_HOST")
+	from := os.Getenv("SMTP_FROM")
+	if host == "" || from == "" {
+		log.Printf("Warning: email notifications need SMTP_HOST and SMTP_FROM, channel disabled")
+		return nil, false
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	notifier := &smtpNotifier{addr: host + ":" + port, from: from}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		notifier.auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return notifier, true
+}
+
+func (n *smtpNotifier) Name() string { return "email" }
+
+func (n *smtpNotifier) Send(recipient Recipient, message OutboundMessage) error {
+	if recipient.Email == "" {
+		return nil
+	}
+	body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		n.from, recipient.Email, message.Subject, message.Body)
+	return smtp.SendMail(n.addr, n.auth, n.from, []string{recipient.Email}, []byte(body))
+}
+
+type smsNotifier struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+func newSMSNotifier() (*smsNotifier, bool) {
+	url := os.Getenv("SMS_API_URL")
+	if url == "" {
+		log.Printf("Warning: SMS notifications need SMS_API_URL, channel disabled")
+		return nil, false
+	}
+	return &smsNotifier{url: url, apiKey: os.Getenv("SMS_API_KEY"), client: &http.Client{Timeout: 10 * time.Second}}, true
+}
+
+func (n *smsNotifier) Name() string { return "sms" }
+
+func (n *smsNotifier) Send(recipient Recipient, message OutboundMessage) error {
+	if recipient.Phone == "" {
+		return nil
+	}
+	payload, _ := json.Marshal(map[string]string{"to": recipient.Phone, "message": message.Body})
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+n.apiKey)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("SMS gateway responded %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendOutbound delivers a stored notification through every configured channel
+func (d *NotificationDispatcher) sendOutbound(userID, eventType, message string) {
+	if len(d.channels) == 0 {
+		return
+	}
+
+	recipient := Recipient{UserID: userID}
+	var email, phone *string
+	if err := d.db.QueryRow(`SELECT email, phone FROM users WHERE id = $1`, userID).Scan(&email, &phone); err != nil {
+		log.Printf("❌ Failed to load contact details of %s for %s notification: %v", userID, eventType, err)
+		return
+	}
+	if email != nil {
+		recipient.Email = *email
+	}
+	if phone != nil {
+		recipient.Phone = *phone
+	}
+
+	outbound := OutboundMessage{
+		EventType: eventType,
+		Subject:   "P2P Bolivia: " + strings.ToLower(strings.ReplaceAll(eventType, "_", " ")),
+		Body:      message,
+	}
+	for _, channel := range d.channels {
+		if err := channel.Send(recipient, outbound); err != nil {
+			log.Printf("❌ Failed to send %s notification to %s by %s: %v", eventType, userID, channel.Name(), err)
+		}
+	}
+}
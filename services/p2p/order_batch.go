@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Batch order details for dashboards that would otherwise call GET /orders/:id once per order.
+// Each order is authorized on its own: the requester sees the orders they placed and the ones
+// assigned to them as cashier. Ids that do not exist or belong to someone else are reported
+// together in not_found, so the response does not reveal which ids exist.
+
+const maxBatchOrderIDs = 100
+
+type BatchOrdersRequest struct {
+	IDs []string `json:"ids" binding:"required,min=1"`
+}
+
+type BatchOrderDetails struct {
+	Order   Order `json:"order"`
+	Cashier gin.H `json:"cashier,omitempty"`
+}
+
+func (s *Server) handleGetOrdersBatch(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req BatchOrdersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Keep the caller's order and drop duplicates
+	ids := make([]string, 0, len(req.IDs))
+	seen := make(map[string]bool)
+	for _, id := range req.IDs {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	if len(ids) > maxBatchOrderIDs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d order ids per request", maxBatchOrderIDs)})
+		return
+	}
+
+	rows, err := s.db.Query(`
+		SELECT o.id, o.user_id, o.cashier_id, o.order_type, o.currency_from, o.currency_to,
+			   o.amount, COALESCE(o.remaining_amount, 0), o.rate, COALESCE(o.min_amount, 0), COALESCE(o.max_amount, 0),
+			   COALESCE(o.payment_methods, '[]'), o.status, o.accepted_at, o.expires_at, o.created_at,
+			   COALESCE(up.first_name, 'Cajero'), u.phone
+		FROM orders o
+		LEFT JOIN users u ON o.cashier_id = u.id
+		LEFT JOIN user_profiles up ON u.id = up.user_id
+		WHERE o.id::text = ANY($1) AND (o.user_id = $2 OR o.cashier_id = $2)
+	`, pq.Array(ids), userID)
+	if err != nil {
+		requestLog(c).Printf("Error fetching order batch for %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		return
+	}
+	defer rows.Close()
+
+	found := make(map[string]BatchOrderDetails)
+	for rows.Next() {
+		var details BatchOrderDetails
+		order := &details.Order
+		var cashierID sql.NullString
+		var cashierName, cashierPhone sql.NullString
+		var paymentMethodsJSON string
+
+		err := rows.Scan(
+			&order.ID, &order.UserID, &cashierID, &order.Type, &order.CurrencyFrom,
+			&order.CurrencyTo, &order.Amount, &order.RemainingAmount, &order.Rate,
+			&order.MinAmount, &order.MaxAmount, &paymentMethodsJSON, &order.Status,
+			&order.AcceptedAt, &order.ExpiresAt, &order.CreatedAt,
+			&cashierName, &cashierPhone,
+		)
+		if err != nil {
+			requestLog(c).Printf("Error scanning order batch row: %v", err)
+			continue
+		}
+		json.Unmarshal([]byte(paymentMethodsJSON), &order.PaymentMethods)
+
+		if cashierID.Valid {
+			order.CashierID = &cashierID.String
+			details.Cashier = gin.H{
+				"id":    cashierID.String,
+				"name":  cashierName.String,
+				"phone": cashierPhone.String,
+			}
+		}
+		found[order.ID] = details
+	}
+	if err := rows.Err(); err != nil {
+		requestLog(c).Printf("Error reading order batch for %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		return
+	}
+
+	orders := make([]BatchOrderDetails, 0, len(found))
+	notFound := []string{}
+	for _, id := range ids {
+		if details, ok := found[id]; ok {
+			orders = append(orders, details)
+		} else {
+			notFound = append(notFound, id)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"orders":    orders,
+		"not_found": notFound,
+	})
+}
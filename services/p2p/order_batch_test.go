@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+var batchOrderColumns = []string{"id", "user_id", "cashier_id", "order_type", "currency_from", "currency_to",
+	"amount", "remaining_amount", "rate", "min_amount", "max_amount", "payment_methods", "status",
+	"accepted_at", "expires_at", "created_at", "first_name", "phone"}
+
+func TestGetOrdersBatchReturnsOnlyAuthorizedOrders(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// user-1 placed own-1 and is the cashier of assigned-1; other-1 belongs to someone else and
+	// is left out by the query's ownership filter
+	now := time.Now()
+	mock.ExpectQuery(`WHERE o.id::text = ANY\(\$1\) AND \(o.user_id = \$2 OR o.cashier_id = \$2\)`).
+		WithArgs(`{"own-1","other-1","assigned-1"}`, "user-1").
+		WillReturnRows(sqlmock.NewRows(batchOrderColumns).
+			AddRow("assigned-1", "user-2", "user-1", "SELL", "USD", "BOB", "50", "50", "6.9", "0", "0", `["QR"]`,
+				"MATCHED", now, nil, now, "Ana", "70000000").
+			AddRow("own-1", "user-1", nil, "BUY", "BOB", "USD", "100", "100", "6.9", "0", "0", `["QR"]`,
+				"PENDING", nil, nil, now, nil, nil))
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/orders/batch",
+		strings.NewReader(`{"ids":["own-1","other-1"," own-1 ","assigned-1"]}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", "user-1")
+	(&Server{db: db}).handleGetOrdersBatch(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Orders   []BatchOrderDetails `json:"orders"`
+		NotFound []string            `json:"not_found"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, details := range response.Orders {
+		got = append(got, details.Order.ID)
+	}
+	if strings.Join(got, ",") != "own-1,assigned-1" {
+		t.Errorf("orders = %v, want own-1 and assigned-1 in request order", got)
+	}
+	if len(response.NotFound) != 1 || response.NotFound[0] != "other-1" {
+		t.Errorf("not_found = %v, want [other-1]", response.NotFound)
+	}
+	if len(response.Orders) == 2 && response.Orders[1].Cashier["id"] != "user-1" {
+		t.Errorf("cashier of assigned-1 = %v, want user-1", response.Orders[1].Cashier)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetOrdersBatchRejectsOversizedRequests(t *testing.T) {
+	ids := make([]string, maxBatchOrderIDs+1)
+	for i := range ids {
+		ids[i] = "order-" + strings.Repeat("x", i+1)
+	}
+	body, _ := json.Marshal(BatchOrdersRequest{IDs: ids})
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/orders/batch", strings.NewReader(string(body)))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", "user-1")
+	(&Server{}).handleGetOrdersBatch(c) // no database: the request must not get that far
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// Owners can fix the price or size of an order while it waits for a cashier. The order keeps
+// its created_at, so it does not lose its place in the cashiers' queue.
+
+var (
+	errOrderNotEditable   = fmt.Errorf("only pending orders can be edited")
+	errOrderEditForbidden = fmt.Errorf("not authorized to edit this order")
+	errOrderEditNotFound  = fmt.Errorf("order not found")
+)
+
+// UpdateOrderRequest holds the fields to change; omitted fields keep their current value.
+// Amounts are in the base currency, like orders created with amount_in BASE.
+type UpdateOrderRequest struct {
+	Amount         *float64 `json:"amount" binding:"omitempty,gt=0"`
+	Rate           *float64 `json:"rate" binding:"omitempty,gt=0"`
+	MinAmount      *float64 `json:"min_amount" binding:"omitempty,gte=0"`
+	MaxAmount      *float64 `json:"max_amount" binding:"omitempty,gte=0"`
+	PaymentMethods []string `json:"payment_methods" binding:"omitempty,min=1"`
+}
+
+// orderValidationError is a request problem found while applying an edit, answered with 400
+type orderValidationError struct {
+	message string
+}
+
+func (e orderValidationError) Error() string {
+	return e.message
+}
+
+// UpdatePendingOrder applies an edit to a PENDING order owned by userID in orders and p2p_orders
+// and replaces the order in the pending cache
+func (e *MatchingEngine) UpdatePendingOrder(orderID, userID string, req UpdateOrderRequest) (Order, error) {
+	tx, err := e.db.Begin()
+	if err != nil {
+		return Order{}, err
+	}
+	defer tx.Rollback()
+	
+	// Locking the row keeps a cashier from accepting the order halfway through the edit
+	var order Order
+	var paymentMethodsJSON string
+	err = tx.QueryRow(`
+		SELECT id, user_id, order_type, currency_from, currency_to, amount, remaining_amount,
+			rate, COALESCE(min_amount, 0), COALESCE(max_amount, 0), COALESCE(payment_methods, '[]'), status, created_at
+		FROM orders WHERE id = $1 FOR UPDATE
+	`, orderID).Scan(&order.ID, &order.UserID, &order.Type, &order.CurrencyFrom,
+		&order.CurrencyTo, &order.Amount, &order.RemainingAmount, &order.Rate,
+		&order.MinAmount, &order.MaxAmount, &paymentMethodsJSON, &order.Status, &order.CreatedAt)
+	if err == sql.ErrNoRows {
+		return Order{}, errOrderEditNotFound
+	}
+	if err != nil {
+		return Order{}, err
+	}
+	json.Unmarshal([]byte(paymentMethodsJSON), &order.PaymentMethods)
+	
+	if order.UserID != userID {
+		return Order{}, errOrderEditForbidden
+	}
+	if order.Status != "PENDING" {
+		return Order{}, errOrderNotEditable
+	}
+	
+	if req.Amount != nil {
+		order.Amount = decimal.NewFromFloat(*req.Amount)
+		order.RemainingAmount = order.Amount
+	}
+	if req.Rate != nil {
+		order.Rate = decimal.NewFromFloat(*req.Rate)
+	}
+	if req.MinAmount != nil {
+		order.MinAmount = decimal.NewFromFloat(*req.MinAmount)
+	}
+	if req.MaxAmount != nil {
+		order.MaxAmount = decimal.NewFromFloat(*req.MaxAmount)
+	}
+	if req.PaymentMethods != nil {
+		order.PaymentMethods = req.PaymentMethods
+	}
+	
+	// Same amount checks as order creation
+	if order.MinAmount.GreaterThan(order.Amount) {
+		return Order{}, orderValidationError{"min_amount cannot be greater than amount"}
+	}
+	if order.MaxAmount.LessThan(order.Amount) && !order.MaxAmount.IsZero() {
+		return Order{}, orderValidationError{"max_amount cannot be less than amount"}
+	}
+	if req.Amount != nil {
+		baseCurrency, _ := orderBaseQuote(order.Type, order.CurrencyFrom, order.CurrencyTo)
+		limit, err := loadOrderSizeLimit(tx, baseCurrency)
+		if err != nil {
+			return Order{}, err
+		}
+		if message := limit.violation(order.Amount); message != "" {
+			return Order{}, orderValidationError{message}
+		}
+	}
+	
+	if order.Type == "BUY" {
+		var userBalance decimal.Decimal
+		requiredAmount := order.Amount.Mul(order.Rate)
+		err = tx.QueryRow(`
+			SELECT COALESCE(balance, 0) FROM wallets
+			WHERE user_id = $1 AND currency = $2
+		`, order.UserID, order.CurrencyFrom).Scan(&userBalance)
+		if err != nil && err != sql.ErrNoRows {
+			return Order{}, fmt.Errorf("failed to check user balance: %v", err)
+		}
+		if userBalance.LessThan(requiredAmount) {
+			return Order{}, orderValidationError{fmt.Sprintf("insufficient %s balance. Required: %s, Available: %s",
+				order.CurrencyFrom, requiredAmount.String(), userBalance.String())}
+		}
+	}
+	
+	methodsJSON, _ := json.Marshal(order.PaymentMethods)
+	_, err = tx.Exec(`
+		UPDATE orders
+		SET amount = $2, remaining_amount = $3, rate = $4, min_amount = $5, max_amount = $6,
+			payment_methods = $7, updated_at = NOW()
+		WHERE id = $1
+	`, order.ID, order.Amount, order.RemainingAmount, order.Rate, order.MinAmount, order.MaxAmount, string(methodsJSON))
+	if err != nil {
+		return Order{}, err
+	}
+	
+	_, err = tx.Exec(`
+		UPDATE p2p_orders
+		SET amount = $2, remaining_amount = $3, rate = $4, min_amount = $5, max_amount = $6,
+			payment_methods = $7, updated_at = NOW()
+		WHERE id = $1
+	`, order.ID, order.Amount, order.RemainingAmount, order.Rate, order.MinAmount, order.MaxAmount,
+		convertJSONArrayToPGArray(order.PaymentMethods))
+	if err != nil {
+		return Order{}, err
+	}
+	
+	if err = tx.Commit(); err != nil {
+		return Order{}, err
+	}
+	
+	e.removePendingOrderFromCache(order.ID)
+	e.cachePendingOrder(context.Background(), order)
+	
+	return order, nil
+}
+
+func (s *Server) handleUpdateOrder(c *gin.Context) {
+	orderID := c.Param("id")
+	userID := c.GetString("user_id")
+	
+	var req UpdateOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	order, err := s.engine.UpdatePendingOrder(orderID, userID, req)
+	if err != nil {
+		if _, ok := err.(orderValidationError); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		switch err {
+		case errOrderEditNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		case errOrderEditForbidden:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to edit this order"})
+		case errOrderNotEditable:
+			c.JSON(http.StatusConflict, gin.H{"error": "Order was already accepted by a cashier and can no longer be edited"})
+		default:
+			requestLog(c).Printf("❌ Error updating order %s: %v", orderID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
+		}
+		return
+	}
+	
+	log.Printf("✏️ Order %s edited by %s: %s at %s", order.ID, userID, order.Amount.String(), order.Rate.String())
+	
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Order updated successfully",
+		"order": OrderResponse{
+			ID:              order.ID,
+			UserID:          order.UserID,
+			Type:            order.Type,
+			CurrencyFrom:    order.CurrencyFrom,
+			CurrencyTo:      order.CurrencyTo,
+			Amount:          order.Amount,
+			RemainingAmount: order.RemainingAmount,
+			Rate:            order.Rate,
+			MinAmount:       order.MinAmount,
+			MaxAmount:       order.MaxAmount,
+			PaymentMethods:  order.PaymentMethods,
+			Status:          order.Status,
+			CreatedAt:       order.CreatedAt,
+		},
+	})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Order lifecycle events are published to the P2P_EVENTS_EXCHANGE topic exchange (p2p.orders by
+// default) with routing key order.<event>, so other services can bind queues to order.* or to a
+// single event instead of polling the orders table. The body is an OrderEvent with the order as
+// it is in the database right after the change. Without a RabbitMQ connection events are logged
+// and dropped; order processing never waits on or fails because of the broker.
+
+const defaultEventsExchange = "p2p.orders"
+
+// Routing keys
+const (
+	orderEventCreated   = "order.created"
+	orderEventMatched   = "order.matched"
+	orderEventAccepted  = "order.accepted"
+	orderEventCompleted = "order.completed"
+	orderEventCancelled = "order.cancelled"
+)
+
+type OrderEvent struct {
+	Event      string    `json:"event"`
+	OrderID    string    `json:"order_id"`
+	MatchID    string    `json:"match_id,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Order      Order     `json:"order"`
+}
+
+// OrderEventPublisher publishes on a single channel, reopened after the broker closes it
+type OrderEventPublisher struct {
+	conn     *amqp.Connection
+	exchange string
+
+	mu      sync.Mutex
+	channel *amqp.Channel
+}
+
+func NewOrderEventPublisher(conn *amqp.Connection) *OrderEventPublisher {
+	exchange := os.Getenv("P2P_EVENTS_EXCHANGE")
+	if exchange == "" {
+		exchange = defaultEventsExchange
+	}
+	if conn == nil {
+		log.Printf("⚠️ No RabbitMQ connection, order events will not be published")
+	}
+	return &OrderEventPublisher{conn: conn, exchange: exchange}
+}
+
+// openChannel returns the publishing channel, declaring the exchange the first time. Callers
+// hold mu.
+func (p *OrderEventPublisher) openChannel() (*amqp.Channel, error) {
+	if p.channel != nil {
+		return p.channel, nil
+	}
+
+	channel, err := p.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := channel.ExchangeDeclare(p.exchange, "topic", true, false, false, false, nil); err != nil {
+		channel.Close()
+		return nil, err
+	}
+
+	closed := channel.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		<-closed
+		p.mu.Lock()
+		if p.channel == channel {
+			p.channel = nil
+		}
+		p.mu.Unlock()
+	}()
+
+	p.channel = channel
+	return channel, nil
+}
+
+// Publish sends event; failures are logged, never returned
+func (p *OrderEventPublisher) Publish(event OrderEvent) {
+	if p == nil || p.conn == nil {
+		log.Printf("⚠️ RabbitMQ unavailable, dropping %s event for order %s", event.Event, event.OrderID)
+		return
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding %s event for order %s: %v", event.Event, event.OrderID, err)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	channel, err := p.openChannel()
+	if err != nil {
+		log.Printf("⚠️ Failed to open RabbitMQ channel, dropping %s event for order %s: %v", event.Event, event.OrderID, err)
+		return
+	}
+
+	err = channel.Publish(p.exchange, event.Event, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    event.OccurredAt,
+		Type:         event.Event,
+		Body:         body,
+	})
+	if err != nil {
+		log.Printf("⚠️ Failed to publish %s event for order %s: %v", event.Event, event.OrderID, err)
+	}
+}
+
+// publishOrderEvent publishes event with the order's current state. Sandbox orders publish
+// nothing, so they never reach cashier streams, analytics or other consumers.
+func (e *MatchingEngine) publishOrderEvent(event, orderID, matchID string) {
+	order, err := e.loadEventOrder(orderID)
+	if err != nil {
+		log.Printf("Error loading order %s for %s event: %v", orderID, event, err)
+		return
+	}
+	if order.IsSandbox {
+		return
+	}
+
+	e.events.Publish(OrderEvent{
+		Event:      event,
+		OrderID:    orderID,
+		MatchID:    matchID,
+		OccurredAt: time.Now(),
+		Order:      order,
+	})
+}
+
+func (e *MatchingEngine) loadEventOrder(orderID string) (Order, error) {
+	var order Order
+	var cashierID sql.NullString
+	var acceptedAt sql.NullTime
+	err := e.db.QueryRow(`
+		SELECT id, user_id, cashier_id, order_type, currency_from, currency_to, amount,
+			COALESCE(remaining_amount, 0), rate, COALESCE(min_amount, 0), COALESCE(max_amount, 0),
+			status, accepted_at, created_at, COALESCE(is_sandbox, false)
+		FROM orders WHERE id = $1
+	`, orderID).Scan(&order.ID, &order.UserID, &cashierID, &order.Type, &order.CurrencyFrom,
+		&order.CurrencyTo, &order.Amount, &order.RemainingAmount, &order.Rate, &order.MinAmount,
+		&order.MaxAmount, &order.Status, &acceptedAt, &order.CreatedAt, &order.IsSandbox)
+	if err != nil {
+		return order, err
+	}
+
+	if cashierID.Valid {
+		order.CashierID = &cashierID.String
+	}
+	if acceptedAt.Valid {
+		order.AcceptedAt = &acceptedAt.Time
+	}
+	return order, nil
+}
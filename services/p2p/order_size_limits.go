@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// Smallest and largest order per currency. The bounds live in kyc_currency_requirements
+// (min_order_amount, max_order_amount; NULL = no bound) next to the KYC level needed to trade the
+// currency, so order size and KYC limits have a single source. They apply to the amount in the
+// order's base currency, after amount_in QUOTE conversion, on creation and on edits. GET /limits
+// publishes them together with the per-level limits of kyc_level_limits.
+
+type OrderSizeLimit struct {
+	Currency    string           `json:"currency"`
+	MinAmount   *decimal.Decimal `json:"min_order_amount"`
+	MaxAmount   *decimal.Decimal `json:"max_order_amount"`
+	MinKYCLevel int              `json:"min_kyc_level"`
+}
+
+// violation describes why amount is outside the bounds, or returns "" when it fits
+func (l OrderSizeLimit) violation(amount decimal.Decimal) string {
+	if l.MinAmount != nil && amount.LessThan(*l.MinAmount) {
+		return fmt.Sprintf("Order amount must be at least %s %s", l.MinAmount.String(), l.Currency)
+	}
+	if l.MaxAmount != nil && amount.GreaterThan(*l.MaxAmount) {
+		return fmt.Sprintf("Order amount must be at most %s %s", l.MaxAmount.String(), l.Currency)
+	}
+	return ""
+}
+
+// loadOrderSizeLimit returns the bounds of the currency; currencies without a row are unbounded
+func loadOrderSizeLimit(q interface {
+	QueryRow(string, ...interface{}) *sql.Row
+}, currency string) (OrderSizeLimit, error) {
+	limit := OrderSizeLimit{Currency: currency}
+	var minAmount, maxAmount decimal.NullDecimal
+	err := q.QueryRow(`
+		SELECT min_order_amount, max_order_amount, min_kyc_level
+		FROM kyc_currency_requirements WHERE currency = $1
+	`, currency).Scan(&minAmount, &maxAmount, &limit.MinKYCLevel)
+	if err == sql.ErrNoRows {
+		return limit, nil
+	}
+	if err != nil {
+		return limit, err
+	}
+
+	if minAmount.Valid {
+		limit.MinAmount = &minAmount.Decimal
+	}
+	if maxAmount.Valid {
+		limit.MaxAmount = &maxAmount.Decimal
+	}
+	return limit, nil
+}
+
+// checkOrderSize answers 400 with the allowed range when amount of currency is out of bounds
+func (s *Server) checkOrderSize(c *gin.Context, currency string, amount decimal.Decimal) bool {
+	limit, err := loadOrderSizeLimit(s.db, currency)
+	if err != nil {
+		requestLog(c).Printf("Error loading order size limits for %s: %v", currency, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify order size"})
+		return false
+	}
+
+	if message := limit.violation(amount); message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":            message,
+			"code":             "ORDER_SIZE_OUT_OF_RANGE",
+			"currency":         currency,
+			"amount":           amount,
+			"min_order_amount": limit.MinAmount,
+			"max_order_amount": limit.MaxAmount,
+		})
+		return false
+	}
+	return true
+}
+
+type KYCLevelLimit struct {
+	Level            int              `json:"kyc_level"`
+	Currency         string           `json:"limit_currency"`
+	TransactionLimit *decimal.Decimal `json:"transaction_limit"`
+	DailyLimit       *decimal.Decimal `json:"daily_limit"`
+	MonthlyLimit     *decimal.Decimal `json:"monthly_limit"`
+}
+
+// handleGetLimits lists the order size bounds of every supported currency and the KYC level limits
+func (s *Server) handleGetLimits(c *gin.Context) {
+	orders := []OrderSizeLimit{}
+	for _, currency := range supportedCurrencies() {
+		limit, err := loadOrderSizeLimit(s.db, currency)
+		if err != nil {
+			log.Printf("Error loading order size limits for %s: %v", currency, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load limits"})
+			return
+		}
+		orders = append(orders, limit)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT kyc_level, limit_currency, transaction_limit, daily_limit, monthly_limit
+		FROM kyc_level_limits ORDER BY kyc_level
+	`)
+	if err != nil {
+		log.Printf("Error loading KYC level limits: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load limits"})
+		return
+	}
+	defer rows.Close()
+
+	levels := []KYCLevelLimit{}
+	for rows.Next() {
+		var level KYCLevelLimit
+		var perTx, daily, monthly decimal.NullDecimal
+		if err := rows.Scan(&level.Level, &level.Currency, &perTx, &daily, &monthly); err != nil {
+			log.Printf("Error scanning KYC level limit: %v", err)
+			continue
+		}
+		if perTx.Valid {
+			level.TransactionLimit = &perTx.Decimal
+		}
+		if daily.Valid {
+			level.DailyLimit = &daily.Decimal
+		}
+		if monthly.Valid {
+			level.MonthlyLimit = &monthly.Decimal
+		}
+		levels = append(levels, level)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"orders":     orders,
+		"kyc_levels": levels,
+	})
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+var orderSizeColumns = []string{"min_order_amount", "max_order_amount", "min_kyc_level"}
+
+func TestOrderSizeLimitBoundaries(t *testing.T) {
+	min, max := decimal.RequireFromString("10"), decimal.RequireFromString("70000")
+	bob := OrderSizeLimit{Currency: "BOB", MinAmount: &min, MaxAmount: &max}
+
+	tests := []struct {
+		amount string
+		want   string // empty when the amount fits
+	}{
+		{amount: "9.99999999", want: "Order amount must be at least 10 BOB"},
+		{amount: "10"},
+		{amount: "10.00000001"},
+		{amount: "69999.99999999"},
+		{amount: "70000"},
+		{amount: "70000.00000001", want: "Order amount must be at most 70000 BOB"},
+	}
+	for _, tt := range tests {
+		if got := bob.violation(decimal.RequireFromString(tt.amount)); got != tt.want {
+			t.Errorf("violation(%s) = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+
+	onlyMin := OrderSizeLimit{Currency: "USD", MinAmount: &min}
+	if got := onlyMin.violation(decimal.RequireFromString("10000000")); got != "" {
+		t.Errorf("violation without a maximum = %q, want none", got)
+	}
+	if got := (OrderSizeLimit{Currency: "USDT"}).violation(decimal.RequireFromString("0.0001")); got != "" {
+		t.Errorf("violation without bounds = %q, want none", got)
+	}
+}
+
+func TestCreateOrderRejectsSizesOutsideTheRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		orderType string
+		amount    string
+		wantError string
+	}{
+		{name: "SELL just below the BOB minimum", orderType: "SELL", amount: "9.99",
+			wantError: "Order amount must be at least 10 BOB"},
+		{name: "SELL just above the BOB maximum", orderType: "SELL", amount: "70000.01",
+			wantError: "Order amount must be at most 70000 BOB"},
+		// A BUY order of BOB for USD is sized in the USD it buys
+		{name: "BUY below the USD minimum", orderType: "BUY", amount: "0.5",
+			wantError: "Order amount must be at least 1 USD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(`SELECT COALESCE\(kyc_level, 0\) FROM users`).WithArgs("user-1").
+				WillReturnRows(sqlmock.NewRows([]string{"kyc_level"}).AddRow(1))
+			for _, currency := range []string{"BOB", "USD"} {
+				mock.ExpectQuery(`SELECT COALESCE\(MAX\(min_kyc_level\), 0\) FROM kyc_currency_requirements`).WithArgs(currency).
+					WillReturnRows(sqlmock.NewRows([]string{"min_kyc_level"}).AddRow(0))
+			}
+			base, min, max := "BOB", "10", "70000"
+			if tt.orderType == "BUY" {
+				base, min, max = "USD", "1", "10000"
+			}
+			mock.ExpectQuery(`SELECT min_order_amount, max_order_amount, min_kyc_level`).WithArgs(base).
+				WillReturnRows(sqlmock.NewRows(orderSizeColumns).AddRow(min, max, 0))
+
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(fmt.Sprintf(
+				`{"type":%q,"currency_from":"BOB","currency_to":"USD","amount":%s,"rate":6.9,"payment_methods":["QR"]}`,
+				tt.orderType, tt.amount)))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Set("user_id", "user-1")
+			(&Server{db: db}).handleCreateOrder(c)
+
+			var response struct {
+				Error     string `json:"error"`
+				Code      string `json:"code"`
+				MinAmount string `json:"min_order_amount"`
+				MaxAmount string `json:"max_order_amount"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			if w.Code != http.StatusBadRequest || response.Code != "ORDER_SIZE_OUT_OF_RANGE" || response.Error != tt.wantError {
+				t.Fatalf("response = %d %s, want 400 %q", w.Code, w.Body.String(), tt.wantError)
+			}
+			if response.MinAmount != min || response.MaxAmount != max {
+				t.Errorf("allowed range = %s-%s, want %s-%s", response.MinAmount, response.MaxAmount, min, max)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCheckOrderSizeAcceptsTheBounds(t *testing.T) {
+	for _, amount := range []string{"10", "70000"} {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.ExpectQuery(`FROM kyc_currency_requirements WHERE currency = \$1`).WithArgs("BOB").
+			WillReturnRows(sqlmock.NewRows(orderSizeColumns).AddRow("10", "70000", 0))
+
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/orders", nil)
+		if !(&Server{db: db}).checkOrderSize(c, "BOB", decimal.RequireFromString(amount)) {
+			t.Errorf("%s BOB rejected: %s", amount, w.Body.String())
+		}
+		db.Close()
+	}
+}
+
+func TestGetLimits(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT min_order_amount, max_order_amount, min_kyc_level`).WithArgs("USD").
+		WillReturnRows(sqlmock.NewRows(orderSizeColumns).AddRow("1", "10000", 1))
+	mock.ExpectQuery(`SELECT min_order_amount, max_order_amount, min_kyc_level`).WithArgs("BOB").
+		WillReturnRows(sqlmock.NewRows(orderSizeColumns).AddRow("10", nil, 0))
+	// USDT has no configured row and is unbounded
+	mock.ExpectQuery(`SELECT min_order_amount, max_order_amount, min_kyc_level`).WithArgs("USDT").
+		WillReturnRows(sqlmock.NewRows(orderSizeColumns))
+	mock.ExpectQuery(`FROM kyc_level_limits ORDER BY kyc_level`).
+		WillReturnRows(sqlmock.NewRows([]string{"kyc_level", "limit_currency", "transaction_limit", "daily_limit", "monthly_limit"}).
+			AddRow(1, "BOB", "5000", "10000", nil).
+			AddRow(2, "BOB", nil, "50000", "500000"))
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/limits", nil)
+	(&Server{db: db}).handleGetLimits(c)
+
+	var response struct {
+		Orders    []OrderSizeLimit `json:"orders"`
+		KYCLevels []KYCLevelLimit  `json:"kyc_levels"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("response = %d %s: %v", w.Code, w.Body.String(), err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	if len(response.Orders) != 3 {
+		t.Fatalf("orders = %+v, want USD, BOB and USDT", response.Orders)
+	}
+	usd, bob, usdt := response.Orders[0], response.Orders[1], response.Orders[2]
+	if usd.MinAmount == nil || !usd.MinAmount.Equal(decimal.NewFromInt(1)) || usd.MaxAmount == nil ||
+		!usd.MaxAmount.Equal(decimal.NewFromInt(10000)) || usd.MinKYCLevel != 1 {
+		t.Errorf("USD limits = %+v, want 1-10000 at KYC level 1", usd)
+	}
+	if bob.MinAmount == nil || !bob.MinAmount.Equal(decimal.NewFromInt(10)) || bob.MaxAmount != nil {
+		t.Errorf("BOB limits = %+v, want a minimum of 10 and no maximum", bob)
+	}
+	if usdt.Currency != "USDT" || usdt.MinAmount != nil || usdt.MaxAmount != nil {
+		t.Errorf("USDT limits = %+v, want unbounded", usdt)
+	}
+
+	if len(response.KYCLevels) != 2 || response.KYCLevels[0].TransactionLimit == nil ||
+		response.KYCLevels[1].TransactionLimit != nil || !response.KYCLevels[1].MonthlyLimit.Equal(decimal.NewFromInt(500000)) {
+		t.Errorf("kyc_levels = %+v, want level 1 capped per transaction and level 2 only per day and month", response.KYCLevels)
+	}
+}
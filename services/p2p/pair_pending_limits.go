@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ceiling on orders waiting for a cashier per currency pair, so a burst on one pair cannot bury
+// the cashiers. P2P_MAX_PENDING_PER_PAIR applies to every pair, P2P_PAIR_PENDING_LIMITS
+// ("USD_BOB:50,USDT_BOB:100") overrides single pairs; 0 means unlimited.
+var pairPendingLimits = loadPairPendingLimits()
+
+func loadPairPendingLimits() map[string]int {
+	limits := map[string]int{"*": 0}
+	if value, err := strconv.Atoi(os.Getenv("P2P_MAX_PENDING_PER_PAIR")); err == nil && value > 0 {
+		limits["*"] = value
+	}
+
+	config := os.Getenv("P2P_PAIR_PENDING_LIMITS")
+	if config == "" {
+		return limits
+	}
+	for _, entry := range strings.Split(config, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 {
+			log.Printf("⚠️ Ignoring invalid P2P_PAIR_PENDING_LIMITS entry: %s", entry)
+			continue
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || value < 0 {
+			log.Printf("⚠️ Ignoring invalid P2P_PAIR_PENDING_LIMITS entry: %s", entry)
+			continue
+		}
+		limits[strings.ToUpper(strings.TrimSpace(parts[0]))] = value
+	}
+	return limits
+}
+
+// pairPendingLimit returns the pending-order ceiling for a pair, 0 when unlimited
+func pairPendingLimit(currencyFrom, currencyTo string) int {
+	if limit, ok := pairPendingLimits[strings.ToUpper(currencyFrom+"_"+currencyTo)]; ok {
+		return limit
+	}
+	return pairPendingLimits["*"]
+}
+
+// checkPairPendingLimit answers 503 and returns false when the pair already has as many
+// pending orders as its ceiling allows
+func (s *Server) checkPairPendingLimit(c *gin.Context, currencyFrom, currencyTo string) bool {
+	limit := pairPendingLimit(currencyFrom, currencyTo)
+	if limit == 0 {
+		return true
+	}
+
+	var pending int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM orders
+		WHERE currency_from = $1 AND currency_to = $2 AND status = 'PENDING'
+			AND COALESCE(is_sandbox, false) = false
+	`, currencyFrom, currencyTo).Scan(&pending)
+	if err != nil {
+		log.Printf("Error counting pending orders for %s_%s: %v", currencyFrom, currencyTo, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check pending orders"})
+		return false
+	}
+
+	if pending >= limit {
+		requestLog(c).Printf("🚫 Pair %s_%s is full: %d pending orders (limit %d)", currencyFrom, currencyTo, pending, limit)
+		c.Header("Retry-After", "60")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":         fmt.Sprintf("The %s/%s book is full with %d orders waiting for a cashier, please try again in a few minutes", currencyFrom, currencyTo, limit),
+			"code":          "PAIR_PENDING_LIMIT",
+			"pending_limit": limit,
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoadPairPendingLimits(t *testing.T) {
+	t.Setenv("P2P_MAX_PENDING_PER_PAIR", "100")
+	t.Setenv("P2P_PAIR_PENDING_LIMITS", "usd_bob:50, USDT_BOB:0,broken,EUR_BOB:-1")
+
+	previous := pairPendingLimits
+	t.Cleanup(func() { pairPendingLimits = previous })
+	pairPendingLimits = loadPairPendingLimits()
+
+	tests := []struct {
+		from, to string
+		want     int
+	}{
+		{"USD", "BOB", 50},
+		{"usdt", "bob", 0}, // explicitly unlimited
+		{"BOB", "USD", 100},
+		{"EUR", "BOB", 100}, // invalid entries fall back to the default
+	}
+	for _, tt := range tests {
+		if got := pairPendingLimit(tt.from, tt.to); got != tt.want {
+			t.Errorf("pairPendingLimit(%s, %s) = %d, want %d", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPairPendingLimit(t *testing.T) {
+	previous := pairPendingLimits
+	t.Cleanup(func() { pairPendingLimits = previous })
+	pairPendingLimits = map[string]int{"*": 0, "USD_BOB": 2, "USDT_BOB": 2}
+
+	tests := []struct {
+		name       string
+		from, to   string
+		pending    int64 // -1 when the pair is unlimited and nothing is counted
+		wantStatus int
+	}{
+		{name: "full pair", from: "USD", to: "BOB", pending: 2, wantStatus: http.StatusServiceUnavailable},
+		{name: "another pair with room", from: "USDT", to: "BOB", pending: 1, wantStatus: http.StatusOK},
+		{name: "unlimited pair", from: "BOB", to: "USD", pending: -1, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			if tt.pending >= 0 {
+				mock.ExpectQuery(`status = 'PENDING'`).WithArgs(tt.from, tt.to).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.pending))
+			}
+
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/orders", nil)
+
+			allowed := (&Server{db: db}).checkPairPendingLimit(c, tt.from, tt.to)
+			if allowed != (tt.wantStatus == http.StatusOK) {
+				t.Fatalf("checkPairPendingLimit() = %v, want %v", allowed, !allowed)
+			}
+			if !allowed {
+				if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), "PAIR_PENDING_LIMIT") {
+					t.Errorf("response = %d %s, want %d PAIR_PENDING_LIMIT", w.Code, w.Body.String(), tt.wantStatus)
+				}
+				if w.Header().Get("Retry-After") == "" {
+					t.Error("Retry-After header missing")
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
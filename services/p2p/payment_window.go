@@ -0,0 +1,194 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Payment window: a user has P2P_PAYMENT_WINDOW_MINUTES (default 30) after a cashier accepts
+// their order to mark it as paid. MATCHED orders still unpaid after that are cancelled: the
+// cashier's locked funds go back to their shift hold or balance, a SELL order's locked seller
+// funds go back to the seller, the assignment is closed and both parties are notified. Orders
+// the user already marked as paid (PROCESSING) are left to the dispute service's timeout.
+
+const (
+	defaultPaymentWindowMinutes = 30
+	paymentWindowCheckInterval  = time.Minute
+)
+
+func paymentWindowMinutes() int {
+	if value, err := strconv.Atoi(os.Getenv("P2P_PAYMENT_WINDOW_MINUTES")); err == nil && value >= 0 {
+		return value
+	}
+	return defaultPaymentWindowMinutes
+}
+
+// runPaymentWindowSweeper cancels unpaid orders on every tick until the process exits
+func (e *MatchingEngine) runPaymentWindowSweeper() {
+	minutes := paymentWindowMinutes()
+	if minutes == 0 {
+		log.Println("⏰ Payment window disabled, unpaid orders are not cancelled automatically")
+		return
+	}
+	window := time.Duration(minutes) * time.Minute
+
+	ticker := time.NewTicker(paymentWindowCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		e.cancelUnpaidOrders(window)
+	}
+}
+
+// cancelUnpaidOrders cancels the MATCHED orders accepted more than window ago
+func (e *MatchingEngine) cancelUnpaidOrders(window time.Duration) {
+	cutoff := time.Now().Add(-window)
+
+	rows, err := e.db.Query(`
+		SELECT id FROM orders
+		WHERE status = 'MATCHED' AND marked_paid_at IS NULL AND accepted_at < $1
+		ORDER BY accepted_at ASC
+		LIMIT 50
+	`, cutoff)
+	if err != nil {
+		log.Printf("Error querying unpaid orders: %v", err)
+		return
+	}
+
+	var orderIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			orderIDs = append(orderIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, orderID := range orderIDs {
+		err := e.cancelUnpaidOrder(orderID, cutoff, window)
+		if err == sql.ErrNoRows {
+			// Paid, cancelled or locked by another replica since the scan
+			continue
+		}
+		if err != nil {
+			log.Printf("Error cancelling unpaid order %s: %v", orderID, err)
+		}
+	}
+}
+
+// cancelUnpaidOrder cancels one unpaid order and releases the funds locked when it was accepted
+func (e *MatchingEngine) cancelUnpaidOrder(orderID string, cutoff time.Time, window time.Duration) error {
+	tx, err := e.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var order Order
+	var cashierID string
+	var shiftHoldID sql.NullString
+	err = tx.QueryRow(`
+		SELECT id, user_id, cashier_id, order_type, currency_from, currency_to, amount, rate, status, shift_hold_id
+		FROM orders
+		WHERE id = $1 AND status = 'MATCHED' AND marked_paid_at IS NULL AND accepted_at < $2
+		FOR UPDATE SKIP LOCKED
+	`, orderID, cutoff).Scan(&order.ID, &order.UserID, &cashierID, &order.Type, &order.CurrencyFrom,
+		&order.CurrencyTo, &order.Amount, &order.Rate, &order.Status, &shiftHoldID)
+	if err != nil {
+		return err
+	}
+
+	if order.Type == "BUY" {
+		if err = releaseCashierLock(tx, order, cashierID, shiftHoldID); err != nil {
+			return err
+		}
+	}
+	if err = unlockSellerFunds(tx, order); err != nil {
+		return err
+	}
+	if err = unlockBuyerFunds(tx, order); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE orders SET status = 'CANCELLED', updated_at = NOW() WHERE id = $1`, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel order: %v", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE p2p_orders SET status = 'CANCELLED', updated_at = NOW() WHERE id = $1`, orderID); err != nil {
+		log.Printf("Warning: failed to update p2p_orders table: %v", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE cashier_order_assignments
+		SET status = 'CANCELLED', completed_at = NOW()
+		WHERE cashier_id = $1 AND order_id = $2
+	`, cashierID, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to close assignment: %v", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	e.removeOrderFromCache(orderID)
+	log.Printf("⏰ Order %s cancelled: not marked as paid within %s of acceptance", orderID, window)
+
+	e.notifier.Notify(NotificationEvent{
+		UserID:  order.UserID,
+		Type:    eventOrderCancelled,
+		OrderID: orderID,
+		Message: fmt.Sprintf("Your %s order for %s %s was cancelled because it was not paid within %d minutes", order.Type, order.Amount.String(), order.CurrencyFrom, int(window.Minutes())),
+	})
+	e.notifier.Notify(NotificationEvent{
+		UserID:  cashierID,
+		Type:    eventOrderCancelled,
+		OrderID: orderID,
+		Message: fmt.Sprintf("The %s order for %s %s was cancelled because the user did not pay; your funds were released", order.Type, order.Amount.String(), order.CurrencyFrom),
+	})
+	e.publishOrderEvent(orderEventCancelled, orderID, "")
+
+	return nil
+}
+
+// releaseCashierLock reverses the lock AcceptOrder took on the cashier's funds for a BUY order:
+// the amount goes back to the shift hold it was drawn from while that hold is active, otherwise
+// from the cashier's locked funds to their balance
+func releaseCashierLock(tx *sql.Tx, order Order, cashierID string, shiftHoldID sql.NullString) error {
+	if shiftHoldID.Valid {
+		result, err := tx.Exec(`
+			UPDATE cashier_shift_holds SET remaining_amount = remaining_amount + $1, updated_at = NOW()
+			WHERE id = $2 AND status = 'ACTIVE'
+		`, order.Amount, shiftHoldID.String)
+		if err != nil {
+			return fmt.Errorf("failed to return funds to shift hold: %v", err)
+		}
+		if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected > 0 {
+			return nil
+		}
+	}
+
+	balanceColumn, lockedColumn, err := cashierBalanceColumns(order.CurrencyTo)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(fmt.Sprintf(`
+		UPDATE users SET
+			%s = %s - $1,
+			%s = COALESCE(%s, 0) + $1
+		WHERE id = $2 AND %s >= $1
+	`, lockedColumn, lockedColumn, balanceColumn, balanceColumn, lockedColumn), order.Amount, cashierID)
+	if err != nil {
+		return fmt.Errorf("failed to release cashier locked funds: %v", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return fmt.Errorf("insufficient locked %s funds for cashier", order.CurrencyTo)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+)
+
+func TestPaymentWindowMinutes(t *testing.T) {
+	for value, want := range map[string]int{"": 30, "45": 45, "0": 0, "-5": 30, "soon": 30} {
+		t.Setenv("P2P_PAYMENT_WINDOW_MINUTES", value)
+		if got := paymentWindowMinutes(); got != want {
+			t.Errorf("paymentWindowMinutes() with %q = %d, want %d", value, got, want)
+		}
+	}
+}
+
+func TestReleaseCashierLock(t *testing.T) {
+	order := Order{ID: "order-1", Type: "BUY", CurrencyFrom: "BOB", CurrencyTo: "USD", Amount: decimal.NewFromInt(100)}
+	holdSQL := `UPDATE cashier_shift_holds SET remaining_amount = remaining_amount \+ \$1.*WHERE id = \$2 AND status = 'ACTIVE'`
+	lockedSQL := `UPDATE users SET\s+cashier_locked_usd = cashier_locked_usd - \$1,\s+cashier_balance_usd = COALESCE\(cashier_balance_usd, 0\) \+ \$1\s+WHERE id = \$2 AND cashier_locked_usd >= \$1`
+
+	tests := []struct {
+		name       string
+		hold       sql.NullString
+		holdActive bool
+		unlocked   int64 // rows released from the locked funds, -1 when not attempted
+		wantErr    bool
+	}{
+		{name: "back to the active shift hold", hold: sql.NullString{String: "hold-1", Valid: true}, holdActive: true, unlocked: -1},
+		{name: "hold already released", hold: sql.NullString{String: "hold-1", Valid: true}, unlocked: 1},
+		{name: "locked on accept", unlocked: 1},
+		{name: "locked funds missing", unlocked: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			if tt.hold.Valid {
+				var rows int64
+				if tt.holdActive {
+					rows = 1
+				}
+				mock.ExpectExec(holdSQL).WithArgs(order.Amount, "hold-1").WillReturnResult(sqlmock.NewResult(0, rows))
+			}
+			if tt.unlocked >= 0 {
+				mock.ExpectExec(lockedSQL).WithArgs(order.Amount, "cashier-1").WillReturnResult(sqlmock.NewResult(0, tt.unlocked))
+			}
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = releaseCashierLock(tx, order, "cashier-1", tt.hold)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("releaseCashierLock() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCancelUnpaidOrderSkipsOrdersNoLongerUnpaid(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cutoff := time.Now().Add(-30 * time.Minute)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM orders\s+WHERE id = \$1 AND status = 'MATCHED' AND marked_paid_at IS NULL AND accepted_at < \$2\s+FOR UPDATE SKIP LOCKED`).
+		WithArgs("order-1", cutoff).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	// Paid or locked by another replica since the scan: nothing is released or cancelled
+	err = (&MatchingEngine{db: db}).cancelUnpaidOrder("order-1", cutoff, 30*time.Minute)
+	if err != sql.ErrNoRows {
+		t.Errorf("cancelUnpaidOrder() error = %v, want sql.ErrNoRows", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/shopspring/decimal"
+)
+
+func TestOrderBaseQuote(t *testing.T) {
+	tests := []struct {
+		orderType, from, to string
+		base, quote         string
+	}{
+		{orderType: "BUY", from: "BOB", to: "USD", base: "USD", quote: "BOB"},
+		{orderType: "SELL", from: "USD", to: "BOB", base: "USD", quote: "BOB"},
+		{orderType: "SELL", from: "BOB", to: "USDT", base: "BOB", quote: "USDT"},
+	}
+
+	for _, tt := range tests {
+		if base, quote := orderBaseQuote(tt.orderType, tt.from, tt.to); base != tt.base || quote != tt.quote {
+			t.Errorf("orderBaseQuote(%s, %s, %s) = %s, %s, want %s, %s", tt.orderType, tt.from, tt.to, base, quote, tt.base, tt.quote)
+		}
+	}
+}
+
+func TestQuoteToBase(t *testing.T) {
+	tests := []struct {
+		base        string
+		quote, rate string
+		want        string
+	}{
+		{base: "USD", quote: "690", rate: "6.9", want: "100"},
+		{base: "USD", quote: "100", rate: "6.9", want: "14.49"},
+		{base: "USDT", quote: "100", rate: "6.9", want: "14.492754"},
+		{base: "XYZ", quote: "1", rate: "3", want: "0.33333333"},
+		{base: "USD", quote: "0.01", rate: "6.9", want: "0"},
+		{base: "USD", quote: "690", rate: "0", want: "0"},
+	}
+
+	for _, tt := range tests {
+		got := quoteToBase(tt.base, decimal.RequireFromString(tt.quote), decimal.RequireFromString(tt.rate))
+		if !got.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("quoteToBase(%s, %s, %s) = %s, want %s", tt.base, tt.quote, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestCreateOrderAmountInBaseOrQuote(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		base       string
+		wantAmount string // base amount stored with the order, empty when nothing is stored
+		wantQuote  string
+		wantStatus int
+	}{
+		{name: "BUY amount in CurrencyTo",
+			body: `{"type":"BUY","currency_from":"BOB","currency_to":"USD","amount":100,"rate":6.9}`,
+			base: "USD", wantAmount: "100", wantQuote: "690", wantStatus: http.StatusCreated},
+		{name: "BUY amount in CurrencyFrom",
+			body: `{"type":"BUY","currency_from":"BOB","currency_to":"USD","amount":690,"rate":6.9,"amount_in":"QUOTE"}`,
+			base: "USD", wantAmount: "100", wantQuote: "690", wantStatus: http.StatusCreated},
+		{name: "SELL amount in CurrencyFrom",
+			body: `{"type":"SELL","currency_from":"USD","currency_to":"BOB","amount":100,"rate":6.9}`,
+			base: "USD", wantAmount: "100", wantQuote: "690", wantStatus: http.StatusCreated},
+		{name: "SELL amount in CurrencyTo",
+			body: `{"type":"SELL","currency_from":"USD","currency_to":"BOB","amount":690,"rate":6.9,"amount_in":"QUOTE"}`,
+			base: "USD", wantAmount: "100", wantQuote: "690", wantStatus: http.StatusCreated},
+		{name: "quote amount rounded to the base precision",
+			body: `{"type":"SELL","currency_from":"USD","currency_to":"BOB","amount":100,"rate":6.9,"amount_in":"QUOTE"}`,
+			base: "USD", wantAmount: "14.49", wantQuote: "100", wantStatus: http.StatusCreated},
+		{name: "quote amount below one base unit",
+			body:       `{"type":"SELL","currency_from":"USD","currency_to":"BOB","amount":0.01,"rate":6.9,"amount_in":"QUOTE"}`,
+			wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(`SELECT COALESCE\(kyc_level, 0\) FROM users`).WithArgs("user-1").
+				WillReturnRows(sqlmock.NewRows([]string{"kyc_level"}).AddRow(1))
+			mock.ExpectQuery(`MAX\(min_kyc_level\)`).WillReturnRows(sqlmock.NewRows([]string{"min_kyc_level"}).AddRow(0))
+			mock.ExpectQuery(`MAX\(min_kyc_level\)`).WillReturnRows(sqlmock.NewRows([]string{"min_kyc_level"}).AddRow(0))
+			if tt.wantAmount != "" {
+				mock.ExpectQuery(`SELECT min_order_amount, max_order_amount`).WithArgs(tt.base).
+					WillReturnRows(sqlmock.NewRows([]string{"min_order_amount", "max_order_amount", "min_kyc_level"}))
+				if strings.Contains(tt.body, `"BUY"`) {
+					mock.ExpectQuery(`SELECT COALESCE\(balance, 0\) FROM wallets`).WithArgs("user-1", "BOB").
+						WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow("10000"))
+				}
+				mock.ExpectQuery(`INSERT INTO orders`).
+					WithArgs("user-1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), tt.wantAmount, tt.wantAmount,
+						"6.9", "0", "0", sqlmock.AnyArg(), "PENDING", sqlmock.AnyArg(), false).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("order-1"))
+				mock.ExpectExec(`INSERT INTO p2p_orders`).WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			mr := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			defer client.Close()
+			engine := NewMatchingEngine(db, client, nil)
+			engine.notifier.channels = nil
+			s := &Server{db: db, redis: client, engine: engine}
+
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/orders",
+				strings.NewReader(strings.TrimSuffix(tt.body, "}")+`,"payment_methods":["QR"]}`))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Set("user_id", "user-1")
+			s.handleCreateOrder(c)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d %s, want %d", w.Code, w.Body.String(), tt.wantStatus)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+			if tt.wantAmount == "" {
+				return
+			}
+
+			var response struct {
+				Interpretation struct {
+					BaseCurrency string          `json:"base_currency"`
+					BaseAmount   decimal.Decimal `json:"base_amount"`
+					QuoteAmount  decimal.Decimal `json:"quote_amount"`
+				} `json:"amount_interpretation"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			got := response.Interpretation
+			if got.BaseCurrency != tt.base || !got.BaseAmount.Equal(decimal.RequireFromString(tt.wantAmount)) ||
+				!got.QuoteAmount.Equal(decimal.RequireFromString(tt.wantQuote)) {
+				t.Errorf("amount_interpretation = %+v, want %s %s for %s quote", got, tt.wantAmount, tt.base, tt.wantQuote)
+			}
+		})
+	}
+}
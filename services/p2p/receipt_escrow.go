@@ -0,0 +1,221 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// Two-sided confirmation: for the order types listed in P2P_RECEIPT_CONFIRMATION_FLOWS the
+// cashier's payment confirmation no longer settles the order. Both sides' funds move from balance
+// to locked_balance, as lockSellerFunds does, so they cannot be withdrawn or transferred, and the
+// order waits in AWAITING_RECEIPT until the user confirms receipt. If the
+// user does not confirm within P2P_RECEIPT_TIMEOUT_MINUTES the dispute service opens a dispute;
+// the funds stay locked until it is resolved.
+
+const defaultReceiptTimeoutMinutes = 60
+
+// escrowLeg is one wallet amount held while an order awaits receipt
+type escrowLeg struct {
+	UserID   string
+	Currency string
+	Amount   decimal.Decimal
+}
+
+// receiptConfirmationRequired reports whether orders of this type wait for the user's receipt
+func receiptConfirmationRequired(orderType string) bool {
+	for _, flow := range strings.Split(os.Getenv("P2P_RECEIPT_CONFIRMATION_FLOWS"), ",") {
+		if strings.EqualFold(strings.TrimSpace(flow), orderType) {
+			return true
+		}
+	}
+	return false
+}
+
+func receiptTimeoutMinutes() int {
+	if value, err := strconv.Atoi(os.Getenv("P2P_RECEIPT_TIMEOUT_MINUTES")); err == nil && value > 0 {
+		return value
+	}
+	return defaultReceiptTimeoutMinutes
+}
+
+// receiptEscrowLegs returns the wallet amounts held while an order awaits receipt: what the user
+// pays, unless it was already locked when a SELL order was accepted or a deposit funded a BUY
+// order, and, except for USD/USDT BUY orders already covered by the cashier's locked funds, what
+// the cashier pays
+func receiptEscrowLegs(order Order, cashierID string, userLocked bool) []escrowLeg {
+	converted := order.Amount.Mul(order.Rate)
+	if order.Type == "BUY" {
+		var legs []escrowLeg
+		if !userLocked {
+			legs = append(legs, escrowLeg{order.UserID, order.CurrencyFrom, converted})
+		}
+		if order.CurrencyTo == "BOB" {
+			legs = append(legs, escrowLeg{cashierID, order.CurrencyTo, order.Amount})
+		}
+		return legs
+	}
+	var legs []escrowLeg
+	if !userLocked {
+		legs = append(legs, escrowLeg{order.UserID, order.CurrencyFrom, order.Amount})
+	}
+	return append(legs, escrowLeg{cashierID, order.CurrencyTo, converted})
+}
+
+// orderEscrowLegs loads whether the user's funds are already locked, by the seller lock or the
+// buyer's deposit funding, and returns the legs
+func orderEscrowLegs(tx *sql.Tx, order Order, cashierID string) ([]escrowLeg, error) {
+	lockedAmount := sellerLockedAmount
+	if order.Type == "BUY" {
+		lockedAmount = buyerLockedAmount
+	}
+	locked, err := lockedAmount(tx, order.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the user's lock: %v", err)
+	}
+	return receiptEscrowLegs(order, cashierID, locked.IsPositive()), nil
+}
+
+// escrowForReceipt moves both sides' funds into their locked balances and the order to
+// AWAITING_RECEIPT
+func escrowForReceipt(tx *sql.Tx, order Order, cashierID string) error {
+	legs, err := orderEscrowLegs(tx, order, cashierID)
+	if err != nil {
+		return err
+	}
+	for _, leg := range legs {
+		result, err := tx.Exec(`
+			UPDATE wallets
+			SET balance = balance - $1, locked_balance = COALESCE(locked_balance, 0) + $1, updated_at = NOW()
+			WHERE user_id = $2 AND currency = $3 AND balance >= $1
+		`, leg.Amount, leg.UserID, leg.Currency)
+		if err != nil {
+			return fmt.Errorf("failed to escrow %s: %v", leg.Currency, err)
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+			return fmt.Errorf("insufficient %s balance to escrow (required: %s)", leg.Currency, leg.Amount.String())
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE orders
+		SET status = 'AWAITING_RECEIPT', escrowed_at = NOW(),
+			receipt_deadline = NOW() + make_interval(mins => $2), updated_at = NOW()
+		WHERE id = $1
+	`, order.ID, receiptTimeoutMinutes())
+	if err != nil {
+		return fmt.Errorf("failed to hold order for receipt: %v", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE p2p_orders SET status = 'AWAITING_RECEIPT', updated_at = NOW() WHERE id = $1`, order.ID); err != nil {
+		log.Printf("Warning: failed to update p2p_orders table: %v", err)
+	}
+	return nil
+}
+
+// releaseReceiptEscrow moves the funds escrowForReceipt locked back to the balances, from which
+// settleOrder then takes them in the same transaction
+func releaseReceiptEscrow(tx *sql.Tx, order Order, cashierID string) error {
+	legs, err := orderEscrowLegs(tx, order, cashierID)
+	if err != nil {
+		return err
+	}
+	for _, leg := range legs {
+		result, err := tx.Exec(`
+			UPDATE wallets
+			SET balance = balance + $1, locked_balance = locked_balance - $1, updated_at = NOW()
+			WHERE user_id = $2 AND currency = $3 AND locked_balance >= $1
+		`, leg.Amount, leg.UserID, leg.Currency)
+		if err != nil {
+			return fmt.Errorf("failed to release escrowed %s: %v", leg.Currency, err)
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+			return fmt.Errorf("escrowed %s funds not found (expected: %s)", leg.Currency, leg.Amount.String())
+		}
+	}
+	return nil
+}
+
+// ConfirmReceipt lets the order owner confirm they received the counterpart, releasing the
+// escrowed funds and completing the order
+func (e *MatchingEngine) ConfirmReceipt(orderID, userID string) error {
+	tx, err := e.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var order Order
+	var cashierID string
+	err = tx.QueryRow(`
+		SELECT id, user_id, cashier_id, order_type, currency_from, currency_to, amount, rate, status,
+			COALESCE(is_sandbox, false)
+		FROM orders WHERE id = $1 AND user_id = $2 AND status = 'AWAITING_RECEIPT' FOR UPDATE
+	`, orderID, userID).Scan(&order.ID, &order.UserID, &cashierID, &order.Type,
+		&order.CurrencyFrom, &order.CurrencyTo, &order.Amount, &order.Rate, &order.Status, &order.IsSandbox)
+	if err != nil {
+		return fmt.Errorf("order not found or not awaiting receipt")
+	}
+
+	if err = releaseReceiptEscrow(tx, order, cashierID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`UPDATE orders SET receipt_confirmed_at = NOW() WHERE id = $1`, orderID); err != nil {
+		return fmt.Errorf("failed to record receipt: %v", err)
+	}
+	if err = e.settleOrder(tx, order, cashierID); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("✅ Receipt confirmed: Order %s completed by user %s", orderID, userID)
+
+	e.notifier.Notify(NotificationEvent{
+		UserID:  cashierID,
+		Type:    eventPaymentConfirmed,
+		OrderID: orderID,
+		Message: fmt.Sprintf("The user confirmed receipt: %s order for %s %s is completed", order.Type, order.Amount.String(), order.CurrencyFrom),
+	})
+	e.notifier.Notify(NotificationEvent{
+		UserID:  order.UserID,
+		Type:    eventPaymentConfirmed,
+		OrderID: orderID,
+		Message: fmt.Sprintf("Receipt confirmed: your %s order for %s %s is completed", order.Type, order.Amount.String(), order.CurrencyFrom),
+	})
+	e.publishOrderEvent(orderEventCompleted, orderID, "")
+
+	return nil
+}
+
+// handleConfirmReceipt lets the order owner release an order held in escrow
+func (s *Server) handleConfirmReceipt(c *gin.Context) {
+	orderID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	if err := s.engine.ConfirmReceipt(orderID, userID); err != nil {
+		requestLog(c).Printf("Error confirming receipt: %v", err)
+
+		if err.Error() == "order not found or not awaiting receipt" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found or not awaiting receipt"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm receipt"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Receipt confirmed - order completed",
+		"order_id": orderID,
+		"status":   "COMPLETED",
+	})
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	escrowMoveSQL    = `UPDATE wallets\s+SET balance = balance - \$1, locked_balance = COALESCE\(locked_balance, 0\) \+ \$1, updated_at = NOW\(\)\s+WHERE user_id = \$2 AND currency = \$3 AND balance >= \$1`
+	escrowReleaseSQL = `UPDATE wallets\s+SET balance = balance \+ \$1, locked_balance = locked_balance - \$1, updated_at = NOW\(\)\s+WHERE user_id = \$2 AND currency = \$3 AND locked_balance >= \$1`
+)
+
+// escrowTestOrder is a SELL of 100 USD at 6.90 BOB whose seller funds were not locked at acceptance
+var escrowTestOrder = Order{
+	ID:           "order-1",
+	UserID:       "user-1",
+	Type:         "SELL",
+	CurrencyFrom: "USD",
+	CurrencyTo:   "BOB",
+	Amount:       decimal.NewFromInt(100),
+	Rate:         decimal.RequireFromString("6.90"),
+}
+
+func expectSellerLock(mock sqlmock.Sqlmock, amount string) {
+	mock.ExpectQuery(`SELECT COALESCE\(seller_locked_amount, 0\) FROM orders`).WithArgs(escrowTestOrder.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"seller_locked_amount"}).AddRow(amount))
+}
+
+func TestReceiptEscrowLegs(t *testing.T) {
+	converted := decimal.RequireFromString("690")
+	tests := []struct {
+		name         string
+		order        Order
+		userLocked   bool
+		want         []escrowLeg
+	}{
+		{
+			name:  "BUY paid in BOB",
+			order: Order{UserID: "user-1", Type: "BUY", CurrencyFrom: "BOB", CurrencyTo: "USD", Amount: decimal.NewFromInt(100), Rate: decimal.RequireFromString("6.90")},
+			want:  []escrowLeg{{"user-1", "BOB", converted}},
+		},
+		{
+			name:  "BUY of BOB holds the cashier's BOB",
+			order: Order{UserID: "user-1", Type: "BUY", CurrencyFrom: "USD", CurrencyTo: "BOB", Amount: decimal.NewFromInt(100), Rate: decimal.RequireFromString("6.90")},
+			want:  []escrowLeg{{"user-1", "USD", converted}, {"cashier-1", "BOB", decimal.NewFromInt(100)}},
+		},
+		{
+			name:  "SELL holds both sides",
+			order: escrowTestOrder,
+			want:  []escrowLeg{{"user-1", "USD", decimal.NewFromInt(100)}, {"cashier-1", "BOB", converted}},
+		},
+		{
+			name:         "SELL already locked at acceptance holds only the cashier",
+			order:        escrowTestOrder,
+			userLocked:   true,
+			want:         []escrowLeg{{"cashier-1", "BOB", converted}},
+		},
+		{
+			name:       "BUY funded by a deposit holds only the cashier",
+			order:      Order{UserID: "user-1", Type: "BUY", CurrencyFrom: "USD", CurrencyTo: "BOB", Amount: decimal.NewFromInt(100), Rate: decimal.RequireFromString("6.90")},
+			userLocked: true,
+			want:       []escrowLeg{{"cashier-1", "BOB", decimal.NewFromInt(100)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := receiptEscrowLegs(tt.order, "cashier-1", tt.userLocked)
+			if len(got) != len(tt.want) {
+				t.Fatalf("receiptEscrowLegs() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].UserID != tt.want[i].UserID || got[i].Currency != tt.want[i].Currency || !got[i].Amount.Equal(tt.want[i].Amount) {
+					t.Errorf("leg %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEscrowForReceiptMovesFundsOutOfBalance(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectSellerLock(mock, "0")
+	mock.ExpectExec(escrowMoveSQL).WithArgs(decimal.NewFromInt(100), "user-1", "USD").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(escrowMoveSQL).WithArgs(decimal.RequireFromString("690"), "cashier-1", "BOB").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE orders\s+SET status = 'AWAITING_RECEIPT'`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE p2p_orders SET status = 'AWAITING_RECEIPT'`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := escrowForReceipt(tx, escrowTestOrder, "cashier-1"); err != nil {
+		t.Fatalf("escrowForReceipt() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEscrowForReceiptInsufficientBalance(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectSellerLock(mock, "0")
+	mock.ExpectExec(escrowMoveSQL).WithArgs(decimal.NewFromInt(100), "user-1", "USD").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := escrowForReceipt(tx, escrowTestOrder, "cashier-1"); err == nil {
+		t.Fatal("escrowForReceipt() succeeded without the balance to cover the escrow")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Escrowed funds have left the balance, so a second hold on the same money, like any debit
+// guarded by balance >= amount (withdrawals, transfers, seller locks), finds nothing to take
+func TestEscrowedFundsCannotBeSpent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectSellerLock(mock, "0")
+	mock.ExpectExec(escrowMoveSQL).WithArgs(decimal.NewFromInt(100), "user-1", "USD").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(escrowMoveSQL).WithArgs(decimal.RequireFromString("690"), "cashier-1", "BOB").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE orders\s+SET status = 'AWAITING_RECEIPT'`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE p2p_orders SET status = 'AWAITING_RECEIPT'`).WillReturnResult(sqlmock.NewResult(0, 1))
+	// The wallet held exactly 100 USD: after the escrow its balance is 0
+	mock.ExpectExec(escrowMoveSQL).WithArgs(decimal.NewFromInt(100), "user-1", "USD").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := escrowForReceipt(tx, escrowTestOrder, "cashier-1"); err != nil {
+		t.Fatalf("escrowForReceipt() error = %v", err)
+	}
+	second := escrowTestOrder
+	second.ID = "order-2"
+	if err := lockSellerFunds(tx, second); err != errInsufficientSellerBalance {
+		t.Errorf("lockSellerFunds() on escrowed funds = %v, want %v", err, errInsufficientSellerBalance)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReleaseReceiptEscrowRestoresBalance(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectSellerLock(mock, "100")
+	mock.ExpectExec(escrowReleaseSQL).WithArgs(decimal.RequireFromString("690"), "cashier-1", "BOB").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The seller's own lock is left for debitSeller to take at settlement
+	if err := releaseReceiptEscrow(tx, escrowTestOrder, "cashier-1"); err != nil {
+		t.Fatalf("releaseReceiptEscrow() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReleaseReceiptEscrowMissingFunds(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectSellerLock(mock, "0")
+	mock.ExpectExec(escrowReleaseSQL).WithArgs(decimal.NewFromInt(100), "user-1", "USD").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := releaseReceiptEscrow(tx, escrowTestOrder, "cashier-1"); err == nil {
+		t.Fatal("releaseReceiptEscrow() succeeded without the escrowed funds")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Reconciliation: every P2P_RECONCILE_INTERVAL_MINUTES (default 15, 0 disables the job) the orders
+// and matches completed in the last P2P_RECONCILE_LOOKBACK_HOURS (default 24) are checked against
+// the rows their settlement should have left behind:
+//   - cashier orders: one wallet_transactions row per settlement leg (external_ref = order id), a
+//     COMPLETED cashier_order_assignments row, and p2p_orders COMPLETED when it has the order
+//   - bank-settled p2p_matches: the buyer's P2P_BUY and seller's P2P_SELL rows (external_ref =
+//     match id), and neither order cancelled
+// Each discrepancy is raised as a system alert of type RECONCILIATION_<KIND>, deduplicated per
+// order or match, for admins to repair and then resolve through /admin/alerts. A pass can also be
+// run on demand with POST /admin/reconciliation/run.
+
+const (
+	defaultReconcileIntervalMinutes = 15
+	defaultReconcileLookbackHours   = 24
+	reconciliationAlertSource       = "p2p.reconciliation"
+)
+
+// Discrepancy kinds
+const (
+	discrepancyMissingLedgerEntry = "MISSING_LEDGER_ENTRY"
+	discrepancyAssignment         = "ASSIGNMENT_MISMATCH"
+	discrepancyP2POrderStatus     = "P2P_ORDER_STATUS_MISMATCH"
+	discrepancyMatchOrderStatus   = "MATCH_ORDER_STATUS_MISMATCH"
+)
+
+// settlementLeg is one wallet movement of a settled order
+type settlementLeg struct {
+	UserID   string
+	Type     string // P2P_DEBIT or P2P_CREDIT
+	Currency string
+	Amount   decimal.Decimal
+}
+
+type ReconciliationDiscrepancy struct {
+	Kind     string           `json:"kind"`
+	OrderID  string           `json:"order_id,omitempty"`
+	MatchID  string           `json:"match_id,omitempty"`
+	UserID   string           `json:"user_id,omitempty"`
+	Currency string           `json:"currency,omitempty"`
+	Amount   *decimal.Decimal `json:"expected_amount,omitempty"`
+	Message  string           `json:"message"`
+}
+
+func reconcileIntervalMinutes() int {
+	if value, err := strconv.Atoi(os.Getenv("P2P_RECONCILE_INTERVAL_MINUTES")); err == nil && value >= 0 {
+		return value
+	}
+	return defaultReconcileIntervalMinutes
+}
+
+func reconcileLookbackHours() int {
+	if value, err := strconv.Atoi(os.Getenv("P2P_RECONCILE_LOOKBACK_HOURS")); err == nil && value > 0 {
+		return value
+	}
+	return defaultReconcileLookbackHours
+}
+
+// settlementLegs returns the wallet movements settleOrder makes for the order, at the ledger's
+// 8 decimal places. Credits are rounded to the currency precision like in settleOrder.
+func settlementLegs(order Order, cashierID string) []settlementLeg {
+	converted := order.Amount.Mul(order.Rate)
+
+	var userDebit, cashierCredit, cashierDebit, userCredit decimal.Decimal
+	if order.Type == "BUY" {
+		userDebit = converted
+		cashierCredit, _ = roundForCurrency(order.CurrencyFrom, converted)
+		cashierDebit = order.Amount
+		userCredit, _ = roundForCurrency(order.CurrencyTo, order.Amount)
+	} else {
+		userDebit = order.Amount
+		cashierCredit, _ = roundForCurrency(order.CurrencyFrom, order.Amount)
+		cashierDebit = converted
+		userCredit, _ = roundForCurrency(order.CurrencyTo, converted)
+	}
+
+	legs := []settlementLeg{}
+	for _, leg := range []settlementLeg{
+		{order.UserID, "P2P_DEBIT", order.CurrencyFrom, userDebit},
+		{cashierID, "P2P_CREDIT", order.CurrencyFrom, cashierCredit},
+		{cashierID, "P2P_DEBIT", order.CurrencyTo, cashierDebit},
+		{order.UserID, "P2P_CREDIT", order.CurrencyTo, userCredit},
+	} {
+		leg.Amount = leg.Amount.Round(8)
+		if leg.Amount.IsPositive() {
+			legs = append(legs, leg)
+		}
+	}
+	return legs
+}
+
+// recordSettlementLedger writes a wallet_transactions row per settlement leg of the order
+func recordSettlementLedger(tx *sql.Tx, order Order, cashierID string) error {
+	metadata, _ := json.Marshal(map[string]string{"order_id": order.ID, "cashier_id": cashierID})
+	for _, leg := range settlementLegs(order, cashierID) {
+		_, err := tx.Exec(`
+			INSERT INTO wallet_transactions (id, user_id, transaction_type, currency, amount, status, method, external_ref, metadata, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, 'COMPLETED', 'P2P', $6, $7, NOW(), NOW())
+		`, uuid.New().String(), leg.UserID, leg.Type, leg.Currency, leg.Amount, order.ID, string(metadata))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runReconciliation flags discrepancies on every tick until the process exits
+func (e *MatchingEngine) runReconciliation() {
+	minutes := reconcileIntervalMinutes()
+	if minutes == 0 {
+		log.Println("🧾 P2P reconciliation disabled")
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(minutes) * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := e.reconcileAndFlag(); err != nil {
+			log.Printf("❌ P2P reconciliation failed: %v", err)
+		}
+	}
+}
+
+// reconcileAndFlag runs a reconciliation pass and raises an alert per discrepancy found
+func (e *MatchingEngine) reconcileAndFlag() ([]ReconciliationDiscrepancy, error) {
+	since := time.Now().Add(-time.Duration(reconcileLookbackHours()) * time.Hour)
+
+	discrepancies, err := e.reconcileCashierOrders(since)
+	if err != nil {
+		return nil, err
+	}
+	matchDiscrepancies, err := e.reconcileMatches(since)
+	if err != nil {
+		return nil, err
+	}
+	discrepancies = append(discrepancies, matchDiscrepancies...)
+
+	for _, d := range discrepancies {
+		severity := "WARNING"
+		if d.Kind == discrepancyMissingLedgerEntry {
+			severity = "CRITICAL"
+		}
+		reference := d.OrderID
+		if d.MatchID != "" {
+			reference = d.MatchID
+		}
+		details := map[string]interface{}{"order_id": d.OrderID, "match_id": d.MatchID, "user_id": d.UserID, "currency": d.Currency}
+		if d.Amount != nil {
+			details["expected_amount"] = d.Amount.String()
+		}
+		raiseSystemAlert(e.db, severity, reconciliationAlertSource, "RECONCILIATION_"+d.Kind,
+			fmt.Sprintf("reconciliation:%s:%s:%s:%s", d.Kind, reference, d.UserID, d.Currency), d.Message, details)
+	}
+
+	log.Printf("🧾 P2P reconciliation checked activity since %s: %d discrepancies", since.Format(time.RFC3339), len(discrepancies))
+	return discrepancies, nil
+}
+
+func (e *MatchingEngine) reconcileCashierOrders(since time.Time) ([]ReconciliationDiscrepancy, error) {
+	rows, err := e.db.Query(`
+		SELECT o.id, o.user_id, o.cashier_id, o.order_type, o.currency_from, o.currency_to, o.amount, o.rate,
+			EXISTS (
+				SELECT 1 FROM cashier_order_assignments a
+				WHERE a.order_id = o.id AND a.cashier_id = o.cashier_id AND a.status = 'COMPLETED'
+			),
+			(SELECT p.status FROM p2p_orders p WHERE p.id::text = o.id::text)
+		FROM orders o
+		WHERE o.status = 'COMPLETED' AND o.cashier_id IS NOT NULL AND o.updated_at >= $1
+			AND COALESCE(o.is_sandbox, false) = false
+		ORDER BY o.updated_at ASC
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+
+	type completedOrder struct {
+		order          Order
+		cashierID      string
+		assignmentDone bool
+		p2pStatus      sql.NullString
+	}
+	var completed []completedOrder
+	for rows.Next() {
+		var item completedOrder
+		order := &item.order
+		if err := rows.Scan(&order.ID, &order.UserID, &item.cashierID, &order.Type, &order.CurrencyFrom,
+			&order.CurrencyTo, &order.Amount, &order.Rate, &item.assignmentDone, &item.p2pStatus); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		completed = append(completed, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	discrepancies := []ReconciliationDiscrepancy{}
+	for _, item := range completed {
+		order := item.order
+
+		if !item.assignmentDone {
+			discrepancies = append(discrepancies, ReconciliationDiscrepancy{
+				Kind: discrepancyAssignment, OrderID: order.ID, UserID: item.cashierID,
+				Message: fmt.Sprintf("Order %s is COMPLETED but the assignment of cashier %s is not", order.ID, item.cashierID),
+			})
+		}
+		if item.p2pStatus.Valid && item.p2pStatus.String != "COMPLETED" {
+			discrepancies = append(discrepancies, ReconciliationDiscrepancy{
+				Kind: discrepancyP2POrderStatus, OrderID: order.ID,
+				Message: fmt.Sprintf("Order %s is COMPLETED but p2p_orders has it %s", order.ID, item.p2pStatus.String),
+			})
+		}
+
+		missing, err := e.missingSettlementLegs(order, item.cashierID)
+		if err != nil {
+			return nil, err
+		}
+		for _, leg := range missing {
+			amount := leg.Amount
+			discrepancies = append(discrepancies, ReconciliationDiscrepancy{
+				Kind: discrepancyMissingLedgerEntry, OrderID: order.ID, UserID: leg.UserID,
+				Currency: leg.Currency, Amount: &amount,
+				Message: fmt.Sprintf("Order %s is COMPLETED but has no %s of %s %s for %s",
+					order.ID, leg.Type, amount.String(), leg.Currency, leg.UserID),
+			})
+		}
+	}
+	return discrepancies, nil
+}
+
+// missingSettlementLegs returns the settlement legs of the order without a ledger row
+func (e *MatchingEngine) missingSettlementLegs(order Order, cashierID string) ([]settlementLeg, error) {
+	rows, err := e.db.Query(`
+		SELECT user_id::text, transaction_type, currency, amount
+		FROM wallet_transactions
+		WHERE external_ref = $1 AND method = 'P2P' AND status = 'COMPLETED'
+	`, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recorded []settlementLeg
+	for rows.Next() {
+		var leg settlementLeg
+		if err := rows.Scan(&leg.UserID, &leg.Type, &leg.Currency, &leg.Amount); err != nil {
+			return nil, err
+		}
+		recorded = append(recorded, leg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var missing []settlementLeg
+	for _, expected := range settlementLegs(order, cashierID) {
+		found := -1
+		for i, leg := range recorded {
+			if leg.UserID == expected.UserID && leg.Type == expected.Type && leg.Currency == expected.Currency && leg.Amount.Equal(expected.Amount) {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			missing = append(missing, expected)
+			continue
+		}
+		// Each row accounts for one leg only
+		recorded = append(recorded[:found], recorded[found+1:]...)
+	}
+	return missing, nil
+}
+
+func (e *MatchingEngine) reconcileMatches(since time.Time) ([]ReconciliationDiscrepancy, error) {
+	rows, err := e.db.Query(`
+		SELECT m.id::text, bo.user_id::text, so.user_id::text, bo.status, so.status,
+			EXISTS (
+				SELECT 1 FROM wallet_transactions t
+				WHERE t.external_ref = m.id::text AND t.transaction_type = 'P2P_BUY' AND t.user_id::text = bo.user_id::text
+			),
+			EXISTS (
+				SELECT 1 FROM wallet_transactions t
+				WHERE t.external_ref = m.id::text AND t.transaction_type = 'P2P_SELL' AND t.user_id::text = so.user_id::text
+			)
+		FROM p2p_matches m
+		JOIN orders bo ON bo.id = m.buy_order_id
+		JOIN orders so ON so.id = m.sell_order_id
+		WHERE m.status = 'COMPLETED' AND m.completed_at >= $1
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	discrepancies := []ReconciliationDiscrepancy{}
+	for rows.Next() {
+		var matchID, buyerID, sellerID, buyStatus, sellStatus string
+		var buyRecorded, sellRecorded bool
+		if err := rows.Scan(&matchID, &buyerID, &sellerID, &buyStatus, &sellStatus, &buyRecorded, &sellRecorded); err != nil {
+			return nil, err
+		}
+
+		if !buyRecorded {
+			discrepancies = append(discrepancies, ReconciliationDiscrepancy{
+				Kind: discrepancyMissingLedgerEntry, MatchID: matchID, UserID: buyerID,
+				Message: fmt.Sprintf("Match %s is COMPLETED but has no P2P_BUY entry for buyer %s", matchID, buyerID),
+			})
+		}
+		if !sellRecorded {
+			discrepancies = append(discrepancies, ReconciliationDiscrepancy{
+				Kind: discrepancyMissingLedgerEntry, MatchID: matchID, UserID: sellerID,
+				Message: fmt.Sprintf("Match %s is COMPLETED but has no P2P_SELL credit for seller %s", matchID, sellerID),
+			})
+		}
+		if buyStatus == "CANCELLED" || sellStatus == "CANCELLED" {
+			discrepancies = append(discrepancies, ReconciliationDiscrepancy{
+				Kind: discrepancyMatchOrderStatus, MatchID: matchID,
+				Message: fmt.Sprintf("Match %s is COMPLETED but its orders are %s (buy) and %s (sell)", matchID, buyStatus, sellStatus),
+			})
+		}
+	}
+	return discrepancies, rows.Err()
+}
+
+// handleAdminRunReconciliation runs a reconciliation pass now and returns what it flagged
+func (s *Server) handleAdminRunReconciliation(c *gin.Context) {
+	discrepancies, err := s.engine.reconcileAndFlag()
+	if err != nil {
+		requestLog(c).Printf("Error running reconciliation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run reconciliation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lookback_hours": reconcileLookbackHours(),
+		"discrepancies":  discrepancies,
+		"total":          len(discrepancies),
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+)
+
+// A BUY of 14.4927536 USD at 6.90 BOB: the BOB cost is 99.99999984, of which the cashier is
+// credited 99.99 and the user 14.49 USD, the rest being dust
+var reconcileTestOrder = Order{ID: "order-1", UserID: "user-1", Type: "BUY", CurrencyFrom: "BOB", CurrencyTo: "USD",
+	Amount: decimal.RequireFromString("14.4927536"), Rate: decimal.RequireFromString("6.90")}
+
+func TestSettlementLegs(t *testing.T) {
+	sell := reconcileTestOrder
+	sell.Type = "SELL"
+	sell.CurrencyFrom, sell.CurrencyTo = "USD", "BOB"
+
+	tests := []struct {
+		name  string
+		order Order
+		want  []settlementLeg
+	}{
+		{name: "buy", order: reconcileTestOrder, want: []settlementLeg{
+			{"user-1", "P2P_DEBIT", "BOB", decimal.RequireFromString("99.99999984")},
+			{"cashier-1", "P2P_CREDIT", "BOB", decimal.RequireFromString("99.99")},
+			{"cashier-1", "P2P_DEBIT", "USD", decimal.RequireFromString("14.4927536")},
+			{"user-1", "P2P_CREDIT", "USD", decimal.RequireFromString("14.49")},
+		}},
+		{name: "sell", order: sell, want: []settlementLeg{
+			{"user-1", "P2P_DEBIT", "USD", decimal.RequireFromString("14.4927536")},
+			{"cashier-1", "P2P_CREDIT", "USD", decimal.RequireFromString("14.49")},
+			{"cashier-1", "P2P_DEBIT", "BOB", decimal.RequireFromString("99.99999984")},
+			{"user-1", "P2P_CREDIT", "BOB", decimal.RequireFromString("99.99")},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			legs := settlementLegs(tt.order, "cashier-1")
+			if len(legs) != len(tt.want) {
+				t.Fatalf("settlementLegs() = %+v, want %d legs", legs, len(tt.want))
+			}
+			for i, leg := range legs {
+				want := tt.want[i]
+				if leg.UserID != want.UserID || leg.Type != want.Type || leg.Currency != want.Currency || !leg.Amount.Equal(want.Amount) {
+					t.Errorf("leg %d = %+v, want %+v", i, leg, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMissingSettlementLegs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// The user's BOB debit is recorded twice and the cashier's USD debit not at all: a duplicate
+	// row must not stand in for the missing leg
+	mock.ExpectQuery(`FROM wallet_transactions\s+WHERE external_ref = \$1 AND method = 'P2P'`).WithArgs("order-1").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "transaction_type", "currency", "amount"}).
+			AddRow("user-1", "P2P_DEBIT", "BOB", "99.99999984").
+			AddRow("user-1", "P2P_DEBIT", "BOB", "99.99999984").
+			AddRow("cashier-1", "P2P_CREDIT", "BOB", "99.99").
+			AddRow("user-1", "P2P_CREDIT", "USD", "14.49"))
+
+	missing, err := (&MatchingEngine{db: db}).missingSettlementLegs(reconcileTestOrder, "cashier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 1 || missing[0].UserID != "cashier-1" || missing[0].Type != "P2P_DEBIT" || missing[0].Currency != "USD" {
+		t.Errorf("missingSettlementLegs() = %+v, want only the cashier's USD debit", missing)
+	}
+}
+
+func TestReconcileMatches(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	since := time.Now().Add(-24 * time.Hour)
+	mock.ExpectQuery(`FROM p2p_matches m`).WithArgs(since).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "buyer", "seller", "buy_status", "sell_status", "buy_recorded", "sell_recorded"}).
+			AddRow("match-ok", "buyer-1", "seller-1", "COMPLETED", "COMPLETED", true, true).
+			AddRow("match-unpaid", "buyer-2", "seller-2", "COMPLETED", "COMPLETED", true, false).
+			AddRow("match-cancelled", "buyer-3", "seller-3", "CANCELLED", "COMPLETED", true, true))
+
+	discrepancies, err := (&MatchingEngine{db: db}).reconcileMatches(since)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ kind, matchID, userID string }{
+		{discrepancyMissingLedgerEntry, "match-unpaid", "seller-2"},
+		{discrepancyMatchOrderStatus, "match-cancelled", ""},
+	}
+	if len(discrepancies) != len(want) {
+		t.Fatalf("reconcileMatches() = %+v, want %d discrepancies", discrepancies, len(want))
+	}
+	for i, d := range discrepancies {
+		if d.Kind != want[i].kind || d.MatchID != want[i].matchID || d.UserID != want[i].userID {
+			t.Errorf("discrepancy %d = %+v, want %+v", i, d, want[i])
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+)
+
+func TestRoundForCurrency(t *testing.T) {
+	tests := []struct {
+		currency string
+		amount   string
+		rounded  string
+		dust     string
+	}{
+		{"BOB", "689.999", "689.99", "0.009"},
+		{"USD", "14.4927536", "14.49", "0.0027536"},
+		{"USDT", "14.49275362", "14.492753", "0.00000062"},
+		{"BOB", "690", "690", "0"},
+		{"EUR", "1.123456789", "1.12345678", "0.000000009"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.currency+" "+tt.amount, func(t *testing.T) {
+			rounded, dust := roundForCurrency(tt.currency, decimal.RequireFromString(tt.amount))
+			if !rounded.Equal(decimal.RequireFromString(tt.rounded)) || !dust.Equal(decimal.RequireFromString(tt.dust)) {
+				t.Errorf("roundForCurrency() = %s, %s; want %s, %s", rounded, dust, tt.rounded, tt.dust)
+			}
+			// Nothing is lost: what is credited plus the dust is the exact amount
+			if !rounded.Add(dust).Equal(decimal.RequireFromString(tt.amount)) {
+				t.Errorf("%s + %s != %s", rounded, dust, tt.amount)
+			}
+		})
+	}
+}
+
+func TestRecordOrderDust(t *testing.T) {
+	dust := decimal.RequireFromString("0.009")
+
+	tests := []struct {
+		name   string
+		order  Order
+		dust   decimal.Decimal
+		record bool
+	}{
+		{name: "dust goes to the platform ledger", order: Order{ID: "order-1"}, dust: dust, record: true},
+		{name: "no dust, no row", order: Order{ID: "order-1"}, dust: decimal.Zero},
+		{name: "sandbox orders leave none", order: Order{ID: "order-1", IsSandbox: true}, dust: dust},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			if tt.record {
+				mock.ExpectExec(`INSERT INTO platform_dust_ledger`).WithArgs("BOB", tt.dust, "P2P_CONFIRM", "order-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := recordOrderDust(tx, tt.order, "BOB", tt.dust); err != nil {
+				t.Fatalf("recordOrderDust() error = %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
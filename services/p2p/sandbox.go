@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Sandbox mode runs a full create -> accept -> mark paid -> confirm cycle between throwaway
+// sandbox accounts funded with fake balances. Sandbox users and orders are flagged with
+// is_sandbox, the orders from their insert on, so they never reach real cashiers, the order
+// caches, published order events, the dust and settlement ledgers or analytics. The routes only
+// exist when SANDBOX_MODE=true.
+
+const sandboxEmailDomain = "sandbox.p2pbolivia.local"
+
+// Fake funds given to sandbox accounts, as a multiple of what the trade needs
+var sandboxFundingMultiplier = decimal.NewFromInt(2)
+
+type SandboxTradeRequest struct {
+	Type         string  `json:"type" binding:"omitempty,oneof=BUY SELL"`
+	CurrencyFrom string  `json:"currency_from"`
+	CurrencyTo   string  `json:"currency_to"`
+	Amount       float64 `json:"amount" binding:"omitempty,gt=0"`
+	Rate         float64 `json:"rate" binding:"omitempty,gt=0"`
+}
+
+type SandboxStep struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+type SandboxCheck struct {
+	Name     string `json:"name"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Passed   bool   `json:"passed"`
+}
+
+func sandboxEnabled() bool {
+	return strings.ToLower(os.Getenv("SANDBOX_MODE")) == "true"
+}
+
+// handleSandboxTrade simulates a complete trade and validates the resulting balances
+func (s *Server) handleSandboxTrade(c *gin.Context) {
+	requestedBy := c.GetString("user_id")
+
+	var req SandboxTradeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Defaults: buy 100 USD paying BOB at 6.90
+	if req.Type == "" {
+		req.Type = "BUY"
+	}
+	if req.CurrencyFrom == "" {
+		req.CurrencyFrom = "BOB"
+	}
+	if req.CurrencyTo == "" {
+		req.CurrencyTo = "USD"
+	}
+	if req.Amount == 0 {
+		req.Amount = 100
+	}
+	if req.Rate == 0 {
+		req.Rate = 6.90
+	}
+	req.CurrencyFrom = strings.ToUpper(req.CurrencyFrom)
+	req.CurrencyTo = strings.ToUpper(req.CurrencyTo)
+
+	if req.CurrencyFrom == req.CurrencyTo {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "currency_from and currency_to must differ"})
+		return
+	}
+
+	amount := decimal.NewFromFloat(req.Amount)
+	rate := decimal.NewFromFloat(req.Rate)
+	runID := uuid.New().String()[:8]
+
+	var steps []SandboxStep
+	runStep := func(name string, fn func() error) bool {
+		start := time.Now()
+		err := fn()
+		step := SandboxStep{Name: name, Status: "OK", DurationMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			step.Status = "FAILED"
+			step.Error = err.Error()
+		}
+		steps = append(steps, step)
+		return err == nil
+	}
+
+	fail := func() {
+		requestLog(c).Printf("🧪 SANDBOX: run %s failed at step %s", runID, steps[len(steps)-1].Name)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"sandbox": true,
+			"run_id":  runID,
+			"passed":  false,
+			"steps":   steps,
+		})
+	}
+
+	requestLog(c).Printf("🧪 SANDBOX: run %s started by %s (%s %s %s->%s @ %s)",
+		runID, requestedBy, req.Type, amount.String(), req.CurrencyFrom, req.CurrencyTo, rate.String())
+
+	var traderID, cashierID, orderID string
+
+	if !runStep("create_sandbox_accounts", func() error {
+		var err error
+		if traderID, err = s.createSandboxUser(runID, "trader", false); err != nil {
+			return err
+		}
+		cashierID, err = s.createSandboxUser(runID, "cashier", true)
+		return err
+	}) {
+		fail()
+		return
+	}
+
+	if !runStep("fund_sandbox_wallets", func() error {
+		return s.fundSandboxAccounts(traderID, cashierID, req.Type, req.CurrencyFrom, req.CurrencyTo, amount, rate)
+	}) {
+		fail()
+		return
+	}
+
+	traderFromBefore := s.sandboxBalance(traderID, req.CurrencyFrom)
+	traderToBefore := s.sandboxBalance(traderID, req.CurrencyTo)
+
+	if !runStep("create_order", func() error {
+		var err error
+		orderID, err = s.engine.AddOrder(Order{
+			UserID:          traderID,
+			Type:            req.Type,
+			CurrencyFrom:    req.CurrencyFrom,
+			CurrencyTo:      req.CurrencyTo,
+			Amount:          amount,
+			RemainingAmount: amount,
+			Rate:            rate,
+			PaymentMethods:  []string{"bank_transfer"},
+			IsSandbox:       true,
+			CreatedAt:       time.Now(),
+		})
+		return err
+	}) {
+		fail()
+		return
+	}
+
+	if !runStep("cashier_accept", func() error {
+		return s.engine.AcceptOrder(orderID, cashierID, c.GetString("request_id"))
+	}) {
+		fail()
+		return
+	}
+
+	if !runStep("mark_paid", func() error {
+		result, err := s.db.Exec(`
+			UPDATE orders SET status = 'PROCESSING', updated_at = NOW()
+			WHERE id = $1 AND user_id = $2 AND status = 'MATCHED'
+		`, orderID, traderID)
+		if err != nil {
+			return err
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return fmt.Errorf("order is not in MATCHED status")
+		}
+		s.db.Exec(`UPDATE p2p_orders SET status = 'PROCESSING', updated_at = NOW() WHERE id = $1`, orderID)
+		return nil
+	}) {
+		fail()
+		return
+	}
+
+	if !runStep("cashier_confirm_payment", func() error {
+		return s.engine.ConfirmPayment(orderID, cashierID)
+	}) {
+		fail()
+		return
+	}
+
+	// Validate the final state against what the trade should have produced
+	var checks []SandboxCheck
+	check := func(name string, expected, actual string) {
+		checks = append(checks, SandboxCheck{Name: name, Expected: expected, Actual: actual, Passed: expected == actual})
+	}
+
+	var orderStatus, assignmentStatus string
+	s.db.QueryRow(`SELECT status FROM orders WHERE id = $1`, orderID).Scan(&orderStatus)
+	s.db.QueryRow(`
+		SELECT status FROM cashier_order_assignments WHERE order_id = $1 AND cashier_id = $2
+	`, orderID, cashierID).Scan(&assignmentStatus)
+	check("order_status", "COMPLETED", orderStatus)
+	check("assignment_status", "COMPLETED", assignmentStatus)
+
+	var expectedFromDelta, expectedToDelta decimal.Decimal
+	if req.Type == "BUY" {
+		expectedFromDelta = amount.Mul(rate).Neg()
+		expectedToDelta, _ = roundForCurrency(req.CurrencyTo, amount)
+	} else {
+		expectedFromDelta = amount.Neg()
+		expectedToDelta, _ = roundForCurrency(req.CurrencyTo, amount.Mul(rate))
+	}
+
+	traderFromDelta := s.sandboxBalance(traderID, req.CurrencyFrom).Sub(traderFromBefore)
+	traderToDelta := s.sandboxBalance(traderID, req.CurrencyTo).Sub(traderToBefore)
+	check("trader_"+strings.ToLower(req.CurrencyFrom)+"_delta", expectedFromDelta.String(), traderFromDelta.String())
+	check("trader_"+strings.ToLower(req.CurrencyTo)+"_delta", expectedToDelta.String(), traderToDelta.String())
+
+	passed := true
+	for _, ch := range checks {
+		passed = passed && ch.Passed
+	}
+
+	requestLog(c).Printf("🧪 SANDBOX: run %s finished - order %s, passed=%v", runID, orderID, passed)
+
+	c.JSON(http.StatusOK, gin.H{
+		"sandbox":    true,
+		"run_id":     runID,
+		"passed":     passed,
+		"order_id":   orderID,
+		"trader_id":  traderID,
+		"cashier_id": cashierID,
+		"steps":      steps,
+		"checks":     checks,
+	})
+}
+
+// createSandboxUser inserts a throwaway account that cannot log in
+func (s *Server) createSandboxUser(runID, role string, isCashier bool) (string, error) {
+	userID := uuid.New().String()
+	email := fmt.Sprintf("%s-%s-%s@%s", role, runID, userID[:8], sandboxEmailDomain)
+
+	_, err := s.db.Exec(`
+		INSERT INTO users (id, email, password_hash, is_verified, is_cashier, kyc_level, is_sandbox)
+		VALUES ($1, $2, '!sandbox', true, $3, 3, true)
+	`, userID, email, isCashier)
+	if err != nil {
+		return "", fmt.Errorf("failed to create sandbox %s: %v", role, err)
+	}
+	return userID, nil
+}
+
+// fundSandboxAccounts credits fake balances so both sides can complete the trade
+func (s *Server) fundSandboxAccounts(traderID, cashierID, orderType, currencyFrom, currencyTo string, amount, rate decimal.Decimal) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	credit := func(userID, currency string, value decimal.Decimal) error {
+		_, err := tx.Exec(`
+			INSERT INTO wallets (user_id, currency, balance, locked_balance, created_at, updated_at)
+			VALUES ($1, $2, $3, 0, NOW(), NOW())
+			ON CONFLICT (user_id, currency)
+			DO UPDATE SET balance = wallets.balance + $3, updated_at = NOW()
+		`, userID, currency, value)
+		return err
+	}
+
+	if orderType == "BUY" {
+		if err := credit(traderID, currencyFrom, amount.Mul(rate).Mul(sandboxFundingMultiplier)); err != nil {
+			return err
+		}
+		if err := credit(cashierID, currencyTo, amount.Mul(sandboxFundingMultiplier)); err != nil {
+			return err
+		}
+		// USD/USDT BUY orders are paid out of the cashier float kept on the users row
+		_, err = tx.Exec(`
+			UPDATE users SET
+				cashier_balance_usd = COALESCE(cashier_balance_usd, 0) + $1,
+				cashier_balance_usdt = COALESCE(cashier_balance_usdt, 0) + $1
+			WHERE id = $2 AND is_sandbox = true
+		`, amount.Mul(sandboxFundingMultiplier), cashierID)
+		if err != nil {
+			return err
+		}
+	} else {
+		if err := credit(traderID, currencyFrom, amount.Mul(sandboxFundingMultiplier)); err != nil {
+			return err
+		}
+		if err := credit(cashierID, currencyTo, amount.Mul(rate).Mul(sandboxFundingMultiplier)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Server) sandboxBalance(userID, currency string) decimal.Decimal {
+	var balance decimal.Decimal
+	s.db.QueryRow(`
+		SELECT COALESCE(balance, 0) FROM wallets WHERE user_id = $1 AND currency = $2
+	`, userID, currency).Scan(&balance)
+	return balance
+}
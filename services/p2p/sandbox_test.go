@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	sandboxOrderColumns = []string{"id", "user_id", "order_type", "currency_from", "currency_to", "amount",
+		"remaining_amount", "rate", "status", "is_sandbox"}
+	sandboxEventColumns = []string{"id", "user_id", "cashier_id", "order_type", "currency_from", "currency_to", "amount",
+		"remaining_amount", "rate", "min_amount", "max_amount", "status", "accepted_at", "created_at", "is_sandbox"}
+)
+
+// expectSandboxTrade expects every statement of a sandbox BUY of 100.123 USD at 6.90 BOB. The
+// amounts leave rounding dust on both legs, so a real order would also write dust and ledger
+// rows; none are expected here and any other statement fails the step that runs it.
+func expectSandboxTrade(mock sqlmock.Sqlmock) {
+	balance := func(currency, value string) {
+		mock.ExpectQuery(`SELECT COALESCE\(balance, 0\) FROM wallets`).WithArgs(sqlmock.AnyArg(), currency).
+			WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(value))
+	}
+	eventOrder := func() {
+		mock.ExpectQuery(`accepted_at, created_at, COALESCE\(is_sandbox, false\)\s+FROM orders WHERE id = \$1`).WithArgs("order-1").
+			WillReturnRows(sqlmock.NewRows(sandboxEventColumns).AddRow("order-1", "trader", nil, "BUY", "BOB", "USD",
+				"100.123", "100.123", "6.9", "0", "0", "PENDING", nil, time.Now(), true))
+	}
+	updated := sqlmock.NewResult(0, 1)
+
+	// Accounts and fake funds, twice what the trade needs
+	mock.ExpectExec(`INSERT INTO users`).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), false).WillReturnResult(updated)
+	mock.ExpectExec(`INSERT INTO users`).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), true).WillReturnResult(updated)
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO wallets \(user_id, currency, balance, locked_balance`).WithArgs(sqlmock.AnyArg(), "BOB", "1381.6974").
+		WillReturnResult(updated)
+	mock.ExpectExec(`INSERT INTO wallets \(user_id, currency, balance, locked_balance`).WithArgs(sqlmock.AnyArg(), "USD", "200.246").
+		WillReturnResult(updated)
+	mock.ExpectExec(`cashier_balance_usd = COALESCE\(cashier_balance_usd, 0\) \+ \$1`).WillReturnResult(updated)
+	mock.ExpectCommit()
+	balance("BOB", "1381.6974")
+	balance("USD", "0")
+
+	// create_order
+	balance("BOB", "1381.6974")
+	mock.ExpectQuery(`INSERT INTO orders`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("order-1"))
+	mock.ExpectExec(`INSERT INTO p2p_orders`).WillReturnResult(updated)
+	eventOrder()
+
+	// cashier_accept, paid from the cashier's USD float
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM orders WHERE id = \$1 FOR UPDATE`).WithArgs("order-1").
+		WillReturnRows(sqlmock.NewRows(sandboxOrderColumns).AddRow("order-1", "trader", "BUY", "BOB", "USD",
+			"100.123", "100.123", "6.9", "PENDING", true))
+	mock.ExpectQuery(`FROM orders o, users u`).WillReturnRows(sqlmock.NewRows([]string{"mismatch"}).AddRow(false))
+	mock.ExpectQuery(`FROM cashier_suspensions`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(`FROM cashier_order_limits`).WillReturnRows(sqlmock.NewRows([]string{"currency", "min_amount", "max_amount"}))
+	mock.ExpectQuery(`UPDATE cashier_shift_holds`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT COALESCE\(cashier_balance_usd, 0\) FROM users`).
+		WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow("200.246"))
+	mock.ExpectExec(`cashier_balance_usd = cashier_balance_usd - \$1`).WillReturnResult(updated)
+	mock.ExpectQuery(`UPDATE orders SET\s+cashier_id = \$1`).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("MATCHED"))
+	mock.ExpectExec(`UPDATE p2p_orders SET\s+cashier_id = \$1`).WillReturnResult(updated)
+	mock.ExpectExec(`INSERT INTO cashier_order_assignments`).WillReturnResult(updated)
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO chat_rooms`).WillReturnResult(updated)
+	mock.ExpectExec(`INSERT INTO user_notifications`).WithArgs("trader", eventOrderAccepted, sqlmock.AnyArg(), sqlmock.AnyArg(), 1, false).
+		WillReturnResult(updated)
+	eventOrder()
+
+	// mark_paid
+	mock.ExpectExec(`UPDATE orders SET status = 'PROCESSING'`).WillReturnResult(updated)
+	mock.ExpectExec(`UPDATE p2p_orders SET status = 'PROCESSING'`).WillReturnResult(updated)
+
+	// cashier_confirm_payment
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM orders WHERE id = \$1 AND cashier_id = \$2 AND status IN`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "order_type", "currency_from", "currency_to", "amount",
+			"rate", "status", "is_sandbox"}).AddRow("order-1", "trader", "BUY", "BOB", "USD", "100.123", "6.9", "PROCESSING", true))
+	mock.ExpectExec(`UPDATE orders SET status = 'COMPLETED'`).WillReturnResult(updated)
+	mock.ExpectExec(`UPDATE p2p_orders SET status = 'COMPLETED'`).WillReturnResult(updated)
+	mock.ExpectQuery(`SELECT COALESCE\(buyer_locked_amount, 0\)`).WillReturnRows(sqlmock.NewRows([]string{"amount"}).AddRow("0"))
+	mock.ExpectExec(`SET balance = balance - \$1`).WithArgs("690.8487", "trader", "BOB").WillReturnResult(updated)
+	mock.ExpectExec(`INSERT INTO wallets \(user_id, currency, balance, created_at`).WithArgs(sqlmock.AnyArg(), "BOB", "690.84").
+		WillReturnResult(updated)
+	mock.ExpectExec(`UPDATE users SET cashier_locked_usd = cashier_locked_usd - \$1`).WillReturnResult(updated)
+	mock.ExpectExec(`INSERT INTO wallets \(user_id, currency, balance, created_at`).WithArgs("trader", "USD", "100.12").
+		WillReturnResult(updated)
+	mock.ExpectExec(`UPDATE cashier_order_assignments`).WillReturnResult(updated)
+	mock.ExpectCommit()
+	mock.ExpectExec(`INSERT INTO user_notifications`).WithArgs("trader", eventPaymentConfirmed, sqlmock.AnyArg(), sqlmock.AnyArg(), 1, false).
+		WillReturnResult(updated)
+	eventOrder()
+
+	// Validation of the final state
+	mock.ExpectQuery(`SELECT status FROM orders WHERE id = \$1`).WithArgs("order-1").
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("COMPLETED"))
+	mock.ExpectQuery(`SELECT status FROM cashier_order_assignments`).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("COMPLETED"))
+	balance("BOB", "690.8487")
+	balance("USD", "100.12")
+}
+
+func TestSandboxTradeFullCycle(t *testing.T) {
+	// The chat room is created in the background, so statements are matched in any order
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+	expectSandboxTrade(mock)
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	// No events publisher: sandbox orders must never reach it
+	engine := NewMatchingEngine(db, client, nil)
+	engine.notifier.channels = nil
+	s := &Server{db: db, redis: client, engine: engine}
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/sandbox/trades", strings.NewReader(`{"amount":100.123}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", "partner-1")
+	s.handleSandboxTrade(c)
+
+	var result struct {
+		Sandbox bool           `json:"sandbox"`
+		Passed  bool           `json:"passed"`
+		OrderID string         `json:"order_id"`
+		Steps   []SandboxStep  `json:"steps"`
+		Checks  []SandboxCheck `json:"checks"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("response %s: %v", w.Body.String(), err)
+	}
+	if w.Code != http.StatusOK || !result.Passed || !result.Sandbox || result.OrderID != "order-1" {
+		t.Fatalf("response = %d %s, want a passed sandbox run", w.Code, w.Body.String())
+	}
+	if len(result.Steps) != 6 || len(result.Checks) != 4 {
+		t.Errorf("got %d steps and %d checks, want 6 and 4", len(result.Steps), len(result.Checks))
+	}
+
+	// Nothing reached the caches cashiers and the order book read
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("redis keys = %v, want none", keys)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for mock.ExpectationsWereMet() != nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// Seller escrow: when a cashier accepts a SELL order the seller's amount moves from balance to
+// locked_balance in their CurrencyFrom wallet, inside the accept transaction, so the funds cannot
+// be withdrawn or spent while the cashier pays out. Settlement then takes the amount from
+// locked_balance and credits the cashier. orders.seller_locked_amount records the lock; orders
+// accepted before it existed have none and settle from balance as before.
+
+var errInsufficientSellerBalance = fmt.Errorf("insufficient seller balance")
+
+// lockSellerFunds moves a SELL order's amount into the seller's locked balance
+func lockSellerFunds(tx *sql.Tx, order Order) error {
+	if order.Type != "SELL" {
+		return nil
+	}
+
+	result, err := tx.Exec(`
+		UPDATE wallets
+		SET balance = balance - $1, locked_balance = COALESCE(locked_balance, 0) + $1, updated_at = NOW()
+		WHERE user_id = $2 AND currency = $3 AND balance >= $1
+	`, order.Amount, order.UserID, order.CurrencyFrom)
+	if err != nil {
+		return fmt.Errorf("failed to lock seller funds: %v", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return errInsufficientSellerBalance
+	}
+
+	_, err = tx.Exec(`
+		UPDATE orders SET seller_locked_amount = $2, seller_locked_at = NOW() WHERE id = $1
+	`, order.ID, order.Amount)
+	if err != nil {
+		return fmt.Errorf("failed to record seller lock: %v", err)
+	}
+	return nil
+}
+
+// sellerLockedAmount returns the amount locked in the seller's wallet when the order was accepted
+func sellerLockedAmount(tx *sql.Tx, orderID string) (decimal.Decimal, error) {
+	var amount decimal.Decimal
+	err := tx.QueryRow(`SELECT COALESCE(seller_locked_amount, 0) FROM orders WHERE id = $1`, orderID).Scan(&amount)
+	return amount, err
+}
+
+// debitSeller takes a SELL order's amount from the seller's wallet at settlement: from the
+// locked balance when it was locked at acceptance, otherwise from the balance
+func debitSeller(tx *sql.Tx, order Order) error {
+	locked, err := sellerLockedAmount(tx, order.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load seller lock: %v", err)
+	}
+
+	query := `
+		UPDATE wallets
+		SET balance = balance - $1, updated_at = NOW()
+		WHERE user_id = $2 AND currency = $3 AND balance >= $1
+	`
+	if locked.IsPositive() {
+		query = `
+			UPDATE wallets
+			SET locked_balance = locked_balance - $1, updated_at = NOW()
+			WHERE user_id = $2 AND currency = $3 AND locked_balance >= $1
+		`
+	}
+
+	result, err := tx.Exec(query, order.Amount, order.UserID, order.CurrencyFrom)
+	if err != nil {
+		return fmt.Errorf("failed to deduct %s from seller wallet: %v", order.CurrencyFrom, err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return fmt.Errorf("insufficient %s balance for seller (required: %s)", order.CurrencyFrom, order.Amount.String())
+	}
+	return nil
+}
+
+// unlockSellerFunds returns the seller's locked amount to their balance when an accepted SELL
+// order is cancelled
+func unlockSellerFunds(tx *sql.Tx, order Order) error {
+	locked, err := sellerLockedAmount(tx, order.ID)
+	if err != nil || !locked.IsPositive() {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE wallets
+		SET balance = balance + $1, locked_balance = locked_balance - $1, updated_at = NOW()
+		WHERE user_id = $2 AND currency = $3 AND locked_balance >= $1
+	`, locked, order.UserID, order.CurrencyFrom)
+	if err != nil {
+		return fmt.Errorf("failed to unlock seller funds: %v", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return fmt.Errorf("locked %s funds not found for seller (expected: %s)", order.CurrencyFrom, locked.String())
+	}
+
+	_, err = tx.Exec(`UPDATE orders SET seller_locked_amount = NULL, seller_locked_at = NULL WHERE id = $1`, order.ID)
+	return err
+}
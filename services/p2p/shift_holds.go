@@ -0,0 +1,234 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// A shift hold moves part of a cashier's balance into their locked funds at the start of a
+// shift. BUY orders accepted while the hold has enough left draw from it instead of locking
+// funds one by one; whatever is left goes back to the balance when the shift is released.
+// Orders already drawn keep their funds locked until they are confirmed.
+
+type ShiftHold struct {
+	ID              string          `json:"id"`
+	Currency        string          `json:"currency"`
+	Amount          decimal.Decimal `json:"amount"`
+	RemainingAmount decimal.Decimal `json:"remaining_amount"`
+	ReleasedAmount  decimal.Decimal `json:"released_amount"`
+	Status          string          `json:"status"`
+	CreatedAt       time.Time       `json:"created_at"`
+	ReleasedAt      *time.Time      `json:"released_at,omitempty"`
+}
+
+type PlaceShiftHoldRequest struct {
+	Currency string  `json:"currency" binding:"required"`
+	Amount   float64 `json:"amount" binding:"required,gt=0"`
+}
+
+// cashierBalanceColumns returns the users columns holding the cashier's free and locked funds
+func cashierBalanceColumns(currency string) (string, string, error) {
+	switch currency {
+	case "USD":
+		return "cashier_balance_usd", "cashier_locked_usd", nil
+	case "USDT":
+		return "cashier_balance_usdt", "cashier_locked_usdt", nil
+	default:
+		return "", "", fmt.Errorf("unsupported currency for cashier: %s", currency)
+	}
+}
+
+// drawFromShiftHold takes amount from the cashier's active shift hold. It returns the hold ID,
+// or an empty string when there is no hold with enough left.
+func drawFromShiftHold(tx *sql.Tx, cashierID, currency string, amount decimal.Decimal) (string, error) {
+	var holdID string
+	err := tx.QueryRow(`
+		UPDATE cashier_shift_holds
+		SET remaining_amount = remaining_amount - $1, updated_at = NOW()
+		WHERE cashier_id = $2 AND currency = $3 AND status = 'ACTIVE' AND remaining_amount >= $1
+		RETURNING id
+	`, amount, cashierID, currency).Scan(&holdID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return holdID, err
+}
+
+func scanShiftHold(row interface{ Scan(...interface{}) error }) (ShiftHold, error) {
+	var hold ShiftHold
+	var releasedAt sql.NullTime
+	err := row.Scan(&hold.ID, &hold.Currency, &hold.Amount, &hold.RemainingAmount,
+		&hold.ReleasedAmount, &hold.Status, &hold.CreatedAt, &releasedAt)
+	if releasedAt.Valid {
+		hold.ReleasedAt = &releasedAt.Time
+	}
+	return hold, err
+}
+
+const shiftHoldColumns = `id, currency, amount, remaining_amount, released_amount, status, created_at, released_at`
+
+func (s *Server) handleGetShiftHolds(c *gin.Context) {
+	cashierID := c.GetString("user_id")
+
+	query := `SELECT ` + shiftHoldColumns + ` FROM cashier_shift_holds WHERE cashier_id = $1`
+	if c.Query("status") != "ALL" {
+		query += ` AND status = 'ACTIVE'`
+	}
+	query += ` ORDER BY created_at DESC LIMIT 50`
+
+	rows, err := s.db.Query(query, cashierID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get shift holds"})
+		return
+	}
+	defer rows.Close()
+
+	holds := []ShiftHold{}
+	for rows.Next() {
+		hold, err := scanShiftHold(rows)
+		if err == nil {
+			holds = append(holds, hold)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"holds": holds})
+}
+
+func (s *Server) handlePlaceShiftHold(c *gin.Context) {
+	cashierID := c.GetString("user_id")
+
+	var req PlaceShiftHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	currency := strings.ToUpper(req.Currency)
+	balanceColumn, lockedColumn, err := cashierBalanceColumns(currency)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Shift holds are only available for USD and USDT"})
+		return
+	}
+	amount := decimal.NewFromFloat(req.Amount)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to place shift hold"})
+		return
+	}
+	defer tx.Rollback()
+
+	var active bool
+	tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM cashier_shift_holds WHERE cashier_id = $1 AND currency = $2 AND status = 'ACTIVE')
+	`, cashierID, currency).Scan(&active)
+	if active {
+		c.JSON(http.StatusConflict, gin.H{"error": "A shift hold is already active for this currency"})
+		return
+	}
+
+	// Move the working balance into locked funds
+	result, err := tx.Exec(fmt.Sprintf(`
+		UPDATE users SET
+			%s = %s - $1,
+			%s = COALESCE(%s, 0) + $1
+		WHERE id = $2 AND COALESCE(%s, 0) >= $1
+	`, balanceColumn, balanceColumn, lockedColumn, lockedColumn, balanceColumn), amount, cashierID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to place shift hold"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient cashier balance for this hold"})
+		return
+	}
+
+	hold, err := scanShiftHold(tx.QueryRow(`
+		INSERT INTO cashier_shift_holds (cashier_id, currency, amount, remaining_amount)
+		VALUES ($1, $2, $3, $3)
+		RETURNING `+shiftHoldColumns, cashierID, currency, amount))
+	if err != nil {
+		requestLog(c).Printf("Error placing shift hold: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to place shift hold"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to place shift hold"})
+		return
+	}
+
+	requestLog(c).Printf("🔒 Shift hold placed: cashier %s locked %s %s", cashierID, amount.String(), currency)
+	c.JSON(http.StatusCreated, gin.H{"hold": hold})
+}
+
+func (s *Server) handleReleaseShiftHold(c *gin.Context) {
+	cashierID := c.GetString("user_id")
+	holdID := c.Param("id")
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release shift hold"})
+		return
+	}
+	defer tx.Rollback()
+
+	var currency string
+	var remaining decimal.Decimal
+	err = tx.QueryRow(`
+		SELECT currency, remaining_amount FROM cashier_shift_holds
+		WHERE id = $1 AND cashier_id = $2 AND status = 'ACTIVE'
+		FOR UPDATE
+	`, holdID, cashierID).Scan(&currency, &remaining)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Active shift hold not found"})
+		return
+	}
+
+	balanceColumn, lockedColumn, err := cashierBalanceColumns(currency)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release shift hold"})
+		return
+	}
+
+	// Only the undrawn part goes back; funds of accepted orders stay locked until confirmation
+	_, err = tx.Exec(fmt.Sprintf(`
+		UPDATE users SET
+			%s = %s - $1,
+			%s = COALESCE(%s, 0) + $1
+		WHERE id = $2
+	`, lockedColumn, lockedColumn, balanceColumn, balanceColumn), remaining, cashierID)
+	if err != nil {
+		requestLog(c).Printf("Error releasing shift hold funds: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release shift hold"})
+		return
+	}
+
+	hold, err := scanShiftHold(tx.QueryRow(`
+		UPDATE cashier_shift_holds SET
+			status = 'RELEASED',
+			released_amount = remaining_amount,
+			remaining_amount = 0,
+			released_at = NOW(),
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+shiftHoldColumns, holdID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release shift hold"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release shift hold"})
+		return
+	}
+
+	requestLog(c).Printf("🔓 Shift hold released: cashier %s got back %s %s", cashierID, remaining.String(), currency)
+	c.JSON(http.StatusOK, gin.H{"hold": hold})
+}
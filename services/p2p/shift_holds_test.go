@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+var shiftHoldRowColumns = []string{"id", "currency", "amount", "remaining_amount", "released_amount", "status", "created_at", "released_at"}
+
+func shiftHoldContext(body string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/cashier/shift-holds", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "id", Value: "hold-1"}}
+	c.Set("user_id", "cashier-1")
+	return c, w
+}
+
+func TestDrawFromShiftHold(t *testing.T) {
+	tests := []struct {
+		name   string
+		found  bool
+		holdID string
+	}{
+		{name: "hold covers the order", found: true, holdID: "hold-1"},
+		{name: "no hold with enough left", found: false, holdID: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			amount := decimal.RequireFromString("100")
+			rows := sqlmock.NewRows([]string{"id"})
+			if tt.found {
+				rows.AddRow("hold-1")
+			}
+			mock.ExpectBegin()
+			mock.ExpectQuery(`UPDATE cashier_shift_holds\s+SET remaining_amount = remaining_amount - \$1.*remaining_amount >= \$1`).
+				WithArgs(amount, "cashier-1", "USD").WillReturnRows(rows)
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			holdID, err := drawFromShiftHold(tx, "cashier-1", "USD", amount)
+			if err != nil || holdID != tt.holdID {
+				t.Errorf("drawFromShiftHold() = %q, %v; want %q", holdID, err, tt.holdID)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPlaceShiftHold(t *testing.T) {
+	amount := decimal.RequireFromString("500")
+	activeQuery := `SELECT EXISTS\(SELECT 1 FROM cashier_shift_holds`
+	lockQuery := `UPDATE users SET\s+cashier_balance_usd = cashier_balance_usd - \$1,\s+cashier_locked_usd = COALESCE\(cashier_locked_usd, 0\) \+ \$1\s+WHERE id = \$2 AND COALESCE\(cashier_balance_usd, 0\) >= \$1`
+
+	tests := []struct {
+		name       string
+		body       string
+		active     bool
+		locked     int64 // rows moved into locked funds, -1 when not attempted
+		wantStatus int
+	}{
+		{name: "locks the working balance", body: `{"currency":"usd","amount":500}`, locked: 1, wantStatus: http.StatusCreated},
+		{name: "one active hold per currency", body: `{"currency":"USD","amount":500}`, active: true, locked: -1, wantStatus: http.StatusConflict},
+		{name: "insufficient balance", body: `{"currency":"USD","amount":500}`, locked: 0, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(activeQuery).WithArgs("cashier-1", "USD").
+				WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(tt.active))
+			if tt.locked >= 0 {
+				mock.ExpectExec(lockQuery).WithArgs(amount, "cashier-1").WillReturnResult(sqlmock.NewResult(0, tt.locked))
+			}
+			if tt.locked == 1 {
+				mock.ExpectQuery(`INSERT INTO cashier_shift_holds`).WithArgs("cashier-1", "USD", amount).
+					WillReturnRows(sqlmock.NewRows(shiftHoldRowColumns).
+						AddRow("hold-1", "USD", "500", "500", "0", "ACTIVE", time.Now(), nil))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			c, w := shiftHoldContext(tt.body)
+			(&Server{db: db}).handlePlaceShiftHold(c)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPlaceShiftHoldOnlyForCashierCurrencies(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	c, w := shiftHoldContext(`{"currency":"BOB","amount":500}`)
+	(&Server{db: db}).handlePlaceShiftHold(c)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReleaseShiftHoldReturnsOnlyTheUndrawnPart(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	remaining := decimal.RequireFromString("120")
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT currency, remaining_amount FROM cashier_shift_holds.*FOR UPDATE`).WithArgs("hold-1", "cashier-1").
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "remaining_amount"}).AddRow("USDT", "120"))
+	mock.ExpectExec(`UPDATE users SET\s+cashier_locked_usdt = cashier_locked_usdt - \$1,\s+cashier_balance_usdt = COALESCE\(cashier_balance_usdt, 0\) \+ \$1`).
+		WithArgs(remaining, "cashier-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`UPDATE cashier_shift_holds SET\s+status = 'RELEASED'`).WithArgs("hold-1").
+		WillReturnRows(sqlmock.NewRows(shiftHoldRowColumns).
+			AddRow("hold-1", "USDT", "500", "0", "120", "RELEASED", time.Now(), time.Now()))
+	mock.ExpectCommit()
+
+	c, w := shiftHoldContext("")
+	(&Server{db: db}).handleReleaseShiftHold(c)
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
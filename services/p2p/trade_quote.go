@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// GET /trade/quote prices a trade against the resting orders without creating anything: it walks
+// the book the way a MARKET order would (takerMatches, best rate first, the caller's own orders
+// skipped) and reports what would be paid and received, the average rate and whether the whole
+// amount can be filled. With max_slippage the walk stops where a MARKET order with that bound
+// would. P2P trades carry no commission; the fee is what the platform keeps on settlement, the
+// cross-pair bridge spread and the rounding of credits to the currency's precision, both in the
+// currency received. The quote is not binding: the book can change before the order is placed.
+
+type QuoteAmount struct {
+	Amount   decimal.Decimal `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+type QuoteFee struct {
+	Currency     string          `json:"currency"`
+	BridgeSpread decimal.Decimal `json:"bridge_spread"`
+	Rounding     decimal.Decimal `json:"rounding"`
+	Total        decimal.Decimal `json:"total"`
+}
+
+type TradeQuote struct {
+	Type            string           `json:"type"`
+	CurrencyFrom    string           `json:"currency_from"`
+	CurrencyTo      string           `json:"currency_to"`
+	RequestedAmount decimal.Decimal  `json:"requested_amount"` // in the base currency, like order amounts
+	FilledAmount    decimal.Decimal  `json:"filled_amount"`
+	UnfilledAmount  decimal.Decimal  `json:"unfilled_amount"`
+	FullyFillable   bool             `json:"fully_fillable"`
+	AverageRate     *decimal.Decimal `json:"average_rate,omitempty"`
+	BestRate        *decimal.Decimal `json:"best_rate,omitempty"`
+	WorstRate       *decimal.Decimal `json:"worst_rate,omitempty"`
+	YouPay          QuoteAmount      `json:"you_pay"`
+	YouReceive      QuoteAmount      `json:"you_receive"`
+	Fee             QuoteFee         `json:"fee"`
+	OrdersMatched   int              `json:"orders_matched"`
+	QuotedAt        time.Time        `json:"quoted_at"`
+}
+
+// quoteTrade prices the matches an order would take. The caller pays CurrencyFrom and receives
+// CurrencyTo on either side: a BUY receives its base currency, a SELL the quote currency.
+func quoteTrade(order Order, matches []Match) TradeQuote {
+	quote := TradeQuote{
+		Type:            order.Type,
+		CurrencyFrom:    order.CurrencyFrom,
+		CurrencyTo:      order.CurrencyTo,
+		RequestedAmount: order.Amount,
+		YouPay:          QuoteAmount{Amount: decimal.Zero, Currency: order.CurrencyFrom},
+		YouReceive:      QuoteAmount{Amount: decimal.Zero, Currency: order.CurrencyTo},
+		Fee:             QuoteFee{Currency: order.CurrencyTo, BridgeSpread: decimal.Zero, Rounding: decimal.Zero},
+		OrdersMatched:   len(matches),
+		QuotedAt:        time.Now(),
+	}
+
+	matchedAmount, quoteTotal := decimal.Zero, decimal.Zero
+	one := decimal.NewFromInt(1)
+	for _, match := range matches {
+		value := match.Amount.Mul(match.Rate)
+		matchedAmount = matchedAmount.Add(match.Amount)
+		quoteTotal = quoteTotal.Add(value)
+
+		// The bridge spread is taken from the buyer's side of the match
+		spread := decimal.Zero
+		if match.Bridge != nil {
+			spread = match.Amount.Mul(match.Bridge.Spread).Div(one.Sub(match.Bridge.Spread))
+		}
+
+		var received decimal.Decimal
+		if order.Type == "BUY" {
+			quote.FilledAmount = quote.FilledAmount.Add(match.Amount)
+			quote.YouPay.Amount = quote.YouPay.Amount.Add(value)
+			received = match.Amount
+		} else {
+			quote.FilledAmount = quote.FilledAmount.Add(match.SellAmount)
+			quote.YouPay.Amount = quote.YouPay.Amount.Add(match.SellAmount)
+			received = value
+			spread = spread.Mul(match.Rate)
+		}
+
+		credit, dust := roundForCurrency(order.CurrencyTo, received)
+		quote.YouReceive.Amount = quote.YouReceive.Amount.Add(credit)
+		quote.Fee.Rounding = quote.Fee.Rounding.Add(dust)
+		quote.Fee.BridgeSpread = quote.Fee.BridgeSpread.Add(spread.Round(8))
+	}
+	quote.Fee.Total = quote.Fee.BridgeSpread.Add(quote.Fee.Rounding)
+
+	quote.UnfilledAmount = order.Amount.Sub(quote.FilledAmount)
+	if quote.UnfilledAmount.IsNegative() {
+		quote.UnfilledAmount = decimal.Zero
+	}
+	quote.FullyFillable = len(matches) > 0 && quote.UnfilledAmount.IsZero()
+
+	if matchedAmount.IsPositive() {
+		average := quoteTotal.DivRound(matchedAmount, 8)
+		best, worst := matches[0].Rate, matches[len(matches)-1].Rate
+		quote.AverageRate, quote.BestRate, quote.WorstRate = &average, &best, &worst
+	}
+	return quote
+}
+
+func (s *Server) handleTradeQuote(c *gin.Context) {
+	currencyFrom, currencyTo, ok := bindPair(c, c.Query("currency_from"), c.Query("currency_to"))
+	if !ok {
+		return
+	}
+	orderType := strings.ToUpper(c.Query("type"))
+	if orderType != "BUY" && orderType != "SELL" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be BUY or SELL"})
+		return
+	}
+	amount, err := decimal.NewFromString(c.Query("amount"))
+	if err != nil || !amount.IsPositive() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be a positive number"})
+		return
+	}
+
+	order := Order{
+		UserID:       c.GetString("user_id"),
+		Type:         orderType,
+		CurrencyFrom: currencyFrom,
+		CurrencyTo:   currencyTo,
+		Amount:       amount,
+	}
+
+	var matches []Match
+	if value := c.Query("max_slippage"); value != "" {
+		maxSlippage, err := decimal.NewFromString(value)
+		if err != nil || maxSlippage.IsNegative() || maxSlippage.GreaterThan(decimal.NewFromInt(50)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_slippage must be a percentage between 0 and 50"})
+			return
+		}
+		matches = s.engine.marketMatches(order, maxSlippage)
+	} else {
+		matches = s.engine.takerMatches(order)
+	}
+
+	c.JSON(http.StatusOK, quoteTrade(order, matches))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Per-user caps on order creation so a single account cannot flood the cashiers' pending queue
+type TradingLimits struct {
+	OrdersPerMinute int
+	MaxOpenOrders   int
+}
+
+func loadTradingLimits() TradingLimits {
+	limits := TradingLimits{OrdersPerMinute: 5, MaxOpenOrders: 10}
+	if value, err := strconv.Atoi(os.Getenv("P2P_MAX_ORDERS_PER_MINUTE")); err == nil && value > 0 {
+		limits.OrdersPerMinute = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("P2P_MAX_OPEN_ORDERS")); err == nil && value > 0 {
+		limits.MaxOpenOrders = value
+	}
+	return limits
+}
+
+var tradingLimits = loadTradingLimits()
+
+// orderRateLimitMiddleware runs after authMiddleware on order creation and answers 429 when the
+// user created too many orders this minute or already has too many orders in flight
+func (s *Server) orderRateLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("user_id")
+
+		// Fixed one-minute window per user, same as API keys; Redis errors let the request through
+		window := time.Now().Unix() / 60
+		counterKey := fmt.Sprintf("p2p:orders:ratelimit:%s:%d", userID, window)
+		ctx := context.Background()
+
+		count, err := s.redis.Incr(ctx, counterKey).Result()
+		if err != nil {
+			requestLog(c).Printf("Error updating order rate limit for %s: %v", userID, err)
+		} else {
+			if count == 1 {
+				s.redis.Expire(ctx, counterKey, time.Minute)
+			}
+
+			remaining := int64(tradingLimits.OrdersPerMinute) - count
+			if remaining < 0 {
+				remaining = 0
+			}
+			c.Header("X-RateLimit-Limit", strconv.Itoa(tradingLimits.OrdersPerMinute))
+			c.Header("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+
+			if count > int64(tradingLimits.OrdersPerMinute) {
+				requestLog(c).Printf("🚫 User %s exceeded %d orders per minute", userID, tradingLimits.OrdersPerMinute)
+				c.Header("Retry-After", strconv.FormatInt(60-time.Now().Unix()%60, 10))
+				c.JSON(http.StatusTooManyRequests, gin.H{
+					"error": fmt.Sprintf("Too many orders, at most %d per minute", tradingLimits.OrdersPerMinute),
+					"code":  "ORDER_RATE_LIMITED",
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		var openOrders int
+		err = s.db.QueryRow(`
+			SELECT COUNT(*) FROM orders
+			WHERE user_id = $1 AND status IN ('PENDING', 'MATCHED', 'PROCESSING', 'AWAITING_RECEIPT')
+		`, userID).Scan(&openOrders)
+		if err != nil {
+			log.Printf("Error counting open orders for %s: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check open orders"})
+			c.Abort()
+			return
+		}
+
+		if openOrders >= tradingLimits.MaxOpenOrders {
+			requestLog(c).Printf("🚫 User %s has %d open orders (limit %d)", userID, openOrders, tradingLimits.MaxOpenOrders)
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       fmt.Sprintf("Too many open orders, at most %d pending, matched or processing", tradingLimits.MaxOpenOrders),
+				"code":        "OPEN_ORDER_LIMIT",
+				"open_orders": openOrders,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestLoadTradingLimits(t *testing.T) {
+	tests := []struct {
+		name                 string
+		perMinute, open      string
+		wantMinute, wantOpen int
+	}{
+		{name: "defaults", wantMinute: 5, wantOpen: 10},
+		{name: "configured", perMinute: "20", open: "3", wantMinute: 20, wantOpen: 3},
+		{name: "invalid values keep the defaults", perMinute: "0", open: "many", wantMinute: 5, wantOpen: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("P2P_MAX_ORDERS_PER_MINUTE", tt.perMinute)
+			t.Setenv("P2P_MAX_OPEN_ORDERS", tt.open)
+			limits := loadTradingLimits()
+			if limits.OrdersPerMinute != tt.wantMinute || limits.MaxOpenOrders != tt.wantOpen {
+				t.Errorf("loadTradingLimits() = %+v, want %d per minute and %d open", limits, tt.wantMinute, tt.wantOpen)
+			}
+		})
+	}
+}
+
+// newOrderLimitServer serves POST /orders behind the order limiter with three orders a minute and
+// two open orders allowed
+func newOrderLimitServer(t *testing.T) (*gin.Engine, sqlmock.Sqlmock, *miniredis.Miniredis) {
+	previous := tradingLimits
+	t.Cleanup(func() { tradingLimits = previous })
+	tradingLimits = TradingLimits{OrdersPerMinute: 3, MaxOpenOrders: 2}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	gin.SetMode(gin.TestMode)
+	s := &Server{db: db, redis: client}
+	router := gin.New()
+	router.POST("/orders", func(c *gin.Context) { c.Set("user_id", "user-1") }, s.orderRateLimitMiddleware(),
+		func(c *gin.Context) { c.Status(http.StatusCreated) })
+	return router, mock, mr
+}
+
+func createOrderRequest(router *gin.Engine) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders", nil))
+	return w
+}
+
+func expectOpenOrders(mock sqlmock.Sqlmock, count int64) {
+	mock.ExpectQuery(`status IN \('PENDING', 'MATCHED', 'PROCESSING', 'AWAITING_RECEIPT'\)`).WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+}
+
+func TestOrderRateLimitPerMinute(t *testing.T) {
+	router, mock, _ := newOrderLimitServer(t)
+
+	for i := 1; i <= 3; i++ {
+		expectOpenOrders(mock, 0)
+		w := createOrderRequest(router)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("order %d: status = %d, want 201: %s", i, w.Code, w.Body.String())
+		}
+		if got, want := w.Header().Get("X-RateLimit-Remaining"), fmt.Sprint(3-i); got != want {
+			t.Errorf("order %d: X-RateLimit-Remaining = %s, want %s", i, got, want)
+		}
+	}
+
+	// The fourth order in the minute is refused before the open orders are counted
+	w := createOrderRequest(router)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After header missing")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOrderRateLimitOpenOrders(t *testing.T) {
+	tests := []struct {
+		name       string
+		open       int64
+		wantStatus int
+	}{
+		{name: "one below the cap", open: 1, wantStatus: http.StatusCreated},
+		{name: "at the cap", open: 2, wantStatus: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock, _ := newOrderLimitServer(t)
+			expectOpenOrders(mock, tt.open)
+
+			if w := createOrderRequest(router); w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestOrderRateLimitWithoutRedis(t *testing.T) {
+	router, mock, mr := newOrderLimitServer(t)
+	mr.Close()
+
+	// The per-minute cap is skipped, the open order cap still holds
+	expectOpenOrders(mock, 0)
+	if w := createOrderRequest(router); w.Code != http.StatusCreated {
+		t.Errorf("status = %d, want 201: %s", w.Code, w.Body.String())
+	}
+	mock.ExpectQuery(`FROM orders`).WillReturnError(sql.ErrConnDone)
+	if w := createOrderRequest(router); w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500 when the open orders cannot be counted", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
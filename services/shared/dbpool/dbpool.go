@@ -0,0 +1,61 @@
+// services/shared/dbpool/dbpool.go
+// Package dbpool holds the connection pool settings every service applies to its database handle,
+// so the defaults and their environment variables are defined once. Services pull it in with
+// "replace shared => ../shared" and are built from the services/ directory for that reason.
+package dbpool
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultMaxOpenConns    = 25
+	DefaultMaxIdleConns    = 10
+	DefaultConnMaxLifetime = 30 * time.Minute
+)
+
+// Settings are the pool limits read from DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS and
+// DB_CONN_MAX_LIFETIME (Go duration)
+type Settings struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// FromEnv reads the settings, keeping the default for missing or invalid values. Idle
+// connections never exceed the open ones.
+func FromEnv() Settings {
+	settings := Settings{
+		MaxOpenConns:    DefaultMaxOpenConns,
+		MaxIdleConns:    DefaultMaxIdleConns,
+		ConnMaxLifetime: DefaultConnMaxLifetime,
+	}
+	if value, err := strconv.Atoi(os.Getenv("DB_MAX_OPEN_CONNS")); err == nil && value > 0 {
+		settings.MaxOpenConns = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("DB_MAX_IDLE_CONNS")); err == nil && value >= 0 {
+		settings.MaxIdleConns = value
+	}
+	if settings.MaxIdleConns > settings.MaxOpenConns {
+		settings.MaxIdleConns = settings.MaxOpenConns
+	}
+	if value, err := time.ParseDuration(os.Getenv("DB_CONN_MAX_LIFETIME")); err == nil && value > 0 {
+		settings.ConnMaxLifetime = value
+	}
+	return settings
+}
+
+// Configure applies the settings from the environment to db
+func Configure(db *sql.DB) {
+	settings := FromEnv()
+	db.SetMaxOpenConns(settings.MaxOpenConns)
+	db.SetMaxIdleConns(settings.MaxIdleConns)
+	db.SetConnMaxLifetime(settings.ConnMaxLifetime)
+
+	log.Printf("🗄️ DB pool: max_open=%d max_idle=%d max_lifetime=%s",
+		settings.MaxOpenConns, settings.MaxIdleConns, settings.ConnMaxLifetime)
+}
@@ -0,0 +1,31 @@
+package dbpool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		name                     string
+		maxOpen, maxIdle, maxAge string
+		want                     Settings
+	}{
+		{name: "defaults", want: Settings{25, 10, 30 * time.Minute}},
+		{name: "configured", maxOpen: "50", maxIdle: "0", maxAge: "5m", want: Settings{50, 0, 5 * time.Minute}},
+		{name: "idle capped at open", maxOpen: "5", maxIdle: "20", want: Settings{5, 5, 30 * time.Minute}},
+		{name: "invalid values keep the defaults", maxOpen: "-1", maxIdle: "many", maxAge: "0s",
+			want: Settings{25, 10, 30 * time.Minute}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DB_MAX_OPEN_CONNS", tt.maxOpen)
+			t.Setenv("DB_MAX_IDLE_CONNS", tt.maxIdle)
+			t.Setenv("DB_CONN_MAX_LIFETIME", tt.maxAge)
+			if got := FromEnv(); got != tt.want {
+				t.Errorf("FromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
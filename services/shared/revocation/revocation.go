@@ -0,0 +1,30 @@
+// services/shared/revocation/revocation.go
+// Package revocation keeps the Redis denylist of users whose access tokens no longer count.
+// Access tokens are stateless JWTs, so closing an account cannot invalidate the ones already
+// issued; every service's auth middleware asks IsUserRevoked after validating a token instead.
+package revocation
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const keyPrefix = "revoked_user:"
+
+// RevokeUser denies every token of userID from now on. Closed accounts are never reopened, so
+// the entry does not expire.
+func RevokeUser(ctx context.Context, rdb *redis.Client, userID string) error {
+	return rdb.Set(ctx, keyPrefix+userID, time.Now().Unix(), 0).Err()
+}
+
+// IsUserRevoked reports whether userID's tokens are denied. A Redis outage lets requests through
+// like the per-token blacklist does; a nil client means the service runs without Redis.
+func IsUserRevoked(ctx context.Context, rdb *redis.Client, userID string) bool {
+	if rdb == nil || userID == "" {
+		return false
+	}
+	revoked, err := rdb.Exists(ctx, keyPrefix+userID).Result()
+	return err == nil && revoked > 0
+}
@@ -0,0 +1,38 @@
+package revocation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestRevokeUser(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	if IsUserRevoked(ctx, rdb, "user-1") {
+		t.Fatal("IsUserRevoked() = true before the account was closed")
+	}
+	if err := RevokeUser(ctx, rdb, "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if !IsUserRevoked(ctx, rdb, "user-1") {
+		t.Error("IsUserRevoked() = false for a closed account")
+	}
+	if IsUserRevoked(ctx, rdb, "user-2") {
+		t.Error("IsUserRevoked() = true for another user")
+	}
+	if IsUserRevoked(ctx, nil, "user-1") {
+		t.Error("IsUserRevoked() = true without Redis")
+	}
+
+	// Unreachable Redis lets the request through
+	mr.Close()
+	if IsUserRevoked(ctx, rdb, "user-1") {
+		t.Error("IsUserRevoked() = true with Redis down")
+	}
+}
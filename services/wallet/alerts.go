@@ -0,0 +1,209 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SystemAlert struct {
+	ID              string                 `json:"id"`
+	Severity        string                 `json:"severity"` // INFO, WARNING, CRITICAL
+	Source          string                 `json:"source"`
+	AlertType       string                 `json:"alert_type"`
+	Message         string                 `json:"message"`
+	Details         map[string]interface{} `json:"details"`
+	Status          string                 `json:"status"` // OPEN, ACKNOWLEDGED, RESOLVED
+	Occurrences     int                    `json:"occurrences"`
+	AcknowledgedBy  *string                `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt  *time.Time             `json:"acknowledged_at,omitempty"`
+	ResolvedBy      *string                `json:"resolved_by,omitempty"`
+	ResolvedAt      *time.Time             `json:"resolved_at,omitempty"`
+	ResolutionNotes *string                `json:"resolution_notes,omitempty"`
+	LastSeenAt      time.Time              `json:"last_seen_at"`
+	CreatedAt       time.Time              `json:"created_at"`
+}
+
+// raiseSystemAlert records a problem detected by a background worker. Alerts sharing an
+// unresolved dedupe key are collapsed into one row with an occurrence counter.
+func raiseSystemAlert(db *sql.DB, severity, source, alertType, dedupeKey, message string, details map[string]interface{}) {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	detailsJSON, _ := json.Marshal(details)
+
+	var key interface{}
+	if dedupeKey != "" {
+		key = dedupeKey
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO system_alerts (severity, source, alert_type, dedupe_key, message, details)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (dedupe_key) WHERE status <> 'RESOLVED'
+		DO UPDATE SET occurrences = system_alerts.occurrences + 1,
+			last_seen_at = NOW(),
+			message = EXCLUDED.message,
+			details = EXCLUDED.details
+	`, severity, source, alertType, key, message, string(detailsJSON))
+
+	if err != nil {
+		log.Printf("❌ Failed to raise %s alert %s: %v", severity, alertType, err)
+		return
+	}
+
+	log.Printf("🚨 [%s] %s: %s", severity, alertType, message)
+}
+
+// Admin handler to list system alerts
+func (s *Server) handleAdminGetAlerts(c *gin.Context) {
+	var conditions []string
+	var args []interface{}
+	argIndex := 1
+
+	if severity := strings.ToUpper(c.Query("severity")); severity != "" {
+		conditions = append(conditions, "severity = $"+strconv.Itoa(argIndex))
+		args = append(args, severity)
+		argIndex++
+	}
+
+	// Unresolved alerts by default
+	status := strings.ToUpper(c.DefaultQuery("status", "UNRESOLVED"))
+	if status == "UNRESOLVED" {
+		conditions = append(conditions, "status <> 'RESOLVED'")
+	} else if status != "ALL" {
+		conditions = append(conditions, "status = $"+strconv.Itoa(argIndex))
+		args = append(args, status)
+		argIndex++
+	}
+
+	if alertType := strings.ToUpper(c.Query("type")); alertType != "" {
+		conditions = append(conditions, "alert_type = $"+strconv.Itoa(argIndex))
+		args = append(args, alertType)
+		argIndex++
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	query := `
+		SELECT id, severity, source, alert_type, message, COALESCE(details, '{}'), status, occurrences,
+			acknowledged_by, acknowledged_at, resolved_by, resolved_at, resolution_notes, last_seen_at, created_at
+		FROM system_alerts
+	`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += `
+		ORDER BY CASE severity WHEN 'CRITICAL' THEN 0 WHEN 'WARNING' THEN 1 ELSE 2 END, last_seen_at DESC
+		LIMIT $` + strconv.Itoa(argIndex)
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get alerts"})
+		return
+	}
+	defer rows.Close()
+
+	alerts := []SystemAlert{}
+	for rows.Next() {
+		var alert SystemAlert
+		var detailsJSON string
+		err := rows.Scan(&alert.ID, &alert.Severity, &alert.Source, &alert.AlertType, &alert.Message,
+			&detailsJSON, &alert.Status, &alert.Occurrences, &alert.AcknowledgedBy, &alert.AcknowledgedAt,
+			&alert.ResolvedBy, &alert.ResolvedAt, &alert.ResolutionNotes, &alert.LastSeenAt, &alert.CreatedAt)
+		if err != nil {
+			continue
+		}
+		json.Unmarshal([]byte(detailsJSON), &alert.Details)
+		alerts = append(alerts, alert)
+	}
+
+	c.JSON(200, gin.H{
+		"status": "success",
+		"data":   alerts,
+		"total":  len(alerts),
+	})
+}
+
+// Admin handler to acknowledge an alert
+func (s *Server) handleAdminAcknowledgeAlert(c *gin.Context) {
+	alertID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	result, err := s.db.Exec(`
+		UPDATE system_alerts
+		SET status = 'ACKNOWLEDGED', acknowledged_by = $1, acknowledged_at = NOW()
+		WHERE id = $2 AND status = 'OPEN'
+	`, userID, alertID)
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to acknowledge alert"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "Alert not found or not open"})
+		return
+	}
+
+	requestLog(c).Printf("👀 Alert %s acknowledged by %s", alertID, userID)
+	s.recordAuditChange(c, userID, "ALERT_ACKNOWLEDGE", "system_alert", alertID,
+		map[string]interface{}{"status": "OPEN"},
+		map[string]interface{}{"status": "ACKNOWLEDGED"})
+
+	c.JSON(200, gin.H{
+		"status":  "success",
+		"message": "Alert acknowledged",
+	})
+}
+
+// Admin handler to resolve an alert
+func (s *Server) handleAdminResolveAlert(c *gin.Context) {
+	alertID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Notes string `json:"notes"`
+	}
+	c.ShouldBindJSON(&req)
+
+	// The self-join reads the row as it was before the update
+	var previousStatus string
+	err := s.db.QueryRow(`
+		UPDATE system_alerts a
+		SET status = 'RESOLVED', resolved_by = $1, resolved_at = NOW(), resolution_notes = $2,
+			acknowledged_by = COALESCE(a.acknowledged_by, $1), acknowledged_at = COALESCE(a.acknowledged_at, NOW())
+		FROM system_alerts previous
+		WHERE a.id = $3 AND previous.id = a.id AND a.status <> 'RESOLVED'
+		RETURNING previous.status
+	`, userID, req.Notes, alertID).Scan(&previousStatus)
+
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "Alert not found or already resolved"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to resolve alert"})
+		return
+	}
+
+	requestLog(c).Printf("✅ Alert %s resolved by %s", alertID, userID)
+	s.recordAuditChange(c, userID, "ALERT_RESOLVE", "system_alert", alertID,
+		map[string]interface{}{"status": previousStatus},
+		map[string]interface{}{"status": "RESOLVED", "notes": req.Notes})
+
+	c.JSON(200, gin.H{
+		"status":  "success",
+		"message": "Alert resolved",
+	})
+}
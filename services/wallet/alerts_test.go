@@ -0,0 +1,148 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+func alertTestContext(method, target, body string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "id", Value: "alert-1"}}
+	c.Set("user_id", "admin-1")
+	return c, w
+}
+
+func TestRaiseSystemAlertCollapsesByDedupeKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`INSERT INTO system_alerts .* ON CONFLICT \(dedupe_key\) WHERE status <> 'RESOLVED'`).
+		WithArgs("WARNING", "reconciler", "BALANCE_DRIFT", "drift:user-1", "Balance drift", `{}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// No dedupe key: every call is its own alert
+	mock.ExpectExec(`INSERT INTO system_alerts`).
+		WithArgs("CRITICAL", "reconciler", "LEDGER_MISMATCH", nil, "Ledger mismatch", `{"diff":"1.00"}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	raiseSystemAlert(db, "WARNING", "reconciler", "BALANCE_DRIFT", "drift:user-1", "Balance drift", nil)
+	raiseSystemAlert(db, "CRITICAL", "reconciler", "LEDGER_MISMATCH", "", "Ledger mismatch", map[string]interface{}{"diff": "1.00"})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAdminGetAlertsFilters(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		filter string
+		args   []driver.Value
+	}{
+		{name: "unresolved by default", query: "", filter: `WHERE status <> 'RESOLVED'`, args: []driver.Value{50}},
+		{name: "all statuses", query: "?status=all&limit=500", filter: `FROM system_alerts\s+ORDER BY`, args: []driver.Value{50}},
+		{name: "every filter", query: "?severity=critical&status=acknowledged&type=balance_drift&limit=10",
+			filter: `WHERE severity = \$1 AND status = \$2 AND alert_type = \$3`,
+			args:   []driver.Value{"CRITICAL", "ACKNOWLEDGED", "BALANCE_DRIFT", 10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(tt.filter).WithArgs(tt.args...).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+			c, w := alertTestContext(http.MethodGet, "/admin/alerts"+tt.query, "")
+			(&Server{db: db}).handleAdminGetAlerts(c)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAdminAcknowledgeAlert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`UPDATE system_alerts .* WHERE id = \$2 AND status = 'OPEN'`).WithArgs("admin-1", "alert-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO audit_logs`).
+		WithArgs("admin-1", "ALERT_ACKNOWLEDGE", "system_alert", "alert-1", `{"status":"OPEN"}`, `{"status":"ACKNOWLEDGED"}`,
+			sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	c, w := alertTestContext(http.MethodPost, "/admin/alerts/alert-1/acknowledge", "")
+	(&Server{db: db}).handleAdminAcknowledgeAlert(c)
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", w.Code)
+	}
+
+	// Already acknowledged or resolved: nothing changes, nothing is audited
+	mock.ExpectExec(`UPDATE system_alerts`).WillReturnResult(sqlmock.NewResult(0, 0))
+	c, w = alertTestContext(http.MethodPost, "/admin/alerts/alert-1/acknowledge", "")
+	(&Server{db: db}).handleAdminAcknowledgeAlert(c)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("second acknowledge = %d, want 404", w.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAdminResolveAlert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`UPDATE system_alerts a .* RETURNING previous.status`).WithArgs("admin-1", "false positive", "alert-1").
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("ACKNOWLEDGED"))
+	mock.ExpectExec(`INSERT INTO audit_logs`).
+		WithArgs("admin-1", "ALERT_RESOLVE", "system_alert", "alert-1", `{"status":"ACKNOWLEDGED"}`,
+			`{"notes":"false positive","status":"RESOLVED"}`, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	c, w := alertTestContext(http.MethodPost, "/admin/alerts/alert-1/resolve", `{"notes":"false positive"}`)
+	(&Server{db: db}).handleAdminResolveAlert(c)
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", w.Code)
+	}
+
+	mock.ExpectQuery(`UPDATE system_alerts a`).WillReturnError(sql.ErrNoRows)
+	c, w = alertTestContext(http.MethodPost, "/admin/alerts/alert-1/resolve", `{}`)
+	(&Server{db: db}).handleAdminResolveAlert(c)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("resolving a resolved alert = %d, want 404", w.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// Reserve attestations: a statement of what the platform owes its users per currency (wallet
+// balances plus locked funds plus cashier balances and locks, sandbox accounts excluded and
+// negative balances counted as zero) next to the custody holdings declared in CUSTODY_HOLDINGS
+// ("BOB:1500000,USD:80000"), with the coverage ratio holdings / liabilities. Only totals and
+// account counts are included, never an individual balance. The JSON payload is signed with the
+// Ed25519 key whose 32-byte seed is ATTESTATION_SIGNING_KEY (base64); anyone can check it with
+// the public key from GET /attestations/public-key against the exact payload string returned.
+// The public endpoint serves an attestation at most attestationCacheTTL old; admins can force a
+// fresh one.
+
+const attestationCacheTTL = 5 * time.Minute
+
+type CurrencyReserve struct {
+	Currency         string           `json:"currency"`
+	Accounts         int              `json:"accounts"`
+	WalletBalances   decimal.Decimal  `json:"wallet_balances"`
+	LockedBalances   decimal.Decimal  `json:"locked_balances"`
+	CashierBalances  decimal.Decimal  `json:"cashier_balances"`
+	TotalLiabilities decimal.Decimal  `json:"total_liabilities"`
+	CustodyHoldings  *decimal.Decimal `json:"custody_holdings"`
+	CoverageRatio    *decimal.Decimal `json:"coverage_ratio"`
+	FullyCovered     *bool            `json:"fully_covered"`
+}
+
+type ReserveAttestation struct {
+	ID          string            `json:"id"`
+	GeneratedAt time.Time         `json:"generated_at"`
+	Currencies  []CurrencyReserve `json:"currencies"`
+}
+
+type SignedAttestation struct {
+	Attestation ReserveAttestation `json:"attestation"`
+	Payload     string             `json:"payload"`
+	Signature   string             `json:"signature"`
+	PublicKey   string             `json:"public_key"`
+	Algorithm   string             `json:"algorithm"`
+}
+
+var custodyHoldings = loadCustodyHoldings()
+
+func loadCustodyHoldings() map[string]decimal.Decimal {
+	holdings := make(map[string]decimal.Decimal)
+	config := os.Getenv("CUSTODY_HOLDINGS")
+	if config == "" {
+		return holdings
+	}
+
+	for _, entry := range strings.Split(config, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 {
+			log.Printf("⚠️ Ignoring invalid CUSTODY_HOLDINGS entry: %s", entry)
+			continue
+		}
+		amount, err := decimal.NewFromString(strings.TrimSpace(parts[1]))
+		if err != nil || amount.IsNegative() {
+			log.Printf("⚠️ Ignoring invalid CUSTODY_HOLDINGS entry: %s", entry)
+			continue
+		}
+		holdings[strings.ToUpper(strings.TrimSpace(parts[0]))] = amount
+	}
+	return holdings
+}
+
+var attestationKey = loadAttestationKey()
+
+// loadAttestationKey returns the signing key, or nil when none is configured
+func loadAttestationKey() ed25519.PrivateKey {
+	value := os.Getenv("ATTESTATION_SIGNING_KEY")
+	if value == "" {
+		return nil
+	}
+	seed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		log.Printf("⚠️ ATTESTATION_SIGNING_KEY must be a base64 %d-byte seed, attestations disabled", ed25519.SeedSize)
+		return nil
+	}
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+// reserveLiabilities sums what the platform owes its users per currency
+func (s *Server) reserveLiabilities() (map[string]*CurrencyReserve, error) {
+	reserves := make(map[string]*CurrencyReserve)
+	reserve := func(currency string) *CurrencyReserve {
+		if reserves[currency] == nil {
+			reserves[currency] = &CurrencyReserve{Currency: currency}
+		}
+		return reserves[currency]
+	}
+
+	rows, err := s.db.Query(`
+		SELECT w.currency, COUNT(*),
+			COALESCE(SUM(GREATEST(w.balance, 0)), 0),
+			COALESCE(SUM(GREATEST(COALESCE(w.locked_balance, 0), 0)), 0)
+		FROM wallets w
+		JOIN users u ON u.id = w.user_id
+		WHERE COALESCE(u.is_sandbox, false) = false
+		GROUP BY w.currency
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currency string
+		var accounts int
+		var balances, locked decimal.Decimal
+		if err := rows.Scan(&currency, &accounts, &balances, &locked); err != nil {
+			return nil, err
+		}
+		r := reserve(currency)
+		r.Accounts, r.WalletBalances, r.LockedBalances = accounts, balances, locked
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Cashier float is held outside wallets, in the users cashier columns
+	var cashierUSD, cashierUSDT decimal.Decimal
+	err = s.db.QueryRow(`
+		SELECT
+			COALESCE(SUM(GREATEST(COALESCE(cashier_balance_usd, 0), 0) + GREATEST(COALESCE(cashier_locked_usd, 0), 0)), 0),
+			COALESCE(SUM(GREATEST(COALESCE(cashier_balance_usdt, 0), 0) + GREATEST(COALESCE(cashier_locked_usdt, 0), 0)), 0)
+		FROM users
+		WHERE is_cashier = true AND COALESCE(is_sandbox, false) = false
+	`).Scan(&cashierUSD, &cashierUSDT)
+	if err != nil {
+		return nil, err
+	}
+	reserve("USD").CashierBalances = cashierUSD
+	reserve("USDT").CashierBalances = cashierUSDT
+
+	return reserves, nil
+}
+
+// buildReserveAttestation totals the liabilities and sets them against the custody holdings
+func (s *Server) buildReserveAttestation() (ReserveAttestation, error) {
+	reserves, err := s.reserveLiabilities()
+	if err != nil {
+		return ReserveAttestation{}, err
+	}
+	for currency := range custodyHoldings {
+		if reserves[currency] == nil {
+			reserves[currency] = &CurrencyReserve{Currency: currency}
+		}
+	}
+
+	idBytes := make([]byte, 16)
+	rand.Read(idBytes)
+	attestation := ReserveAttestation{
+		ID:          hex.EncodeToString(idBytes),
+		GeneratedAt: time.Now().UTC().Truncate(time.Second),
+		Currencies:  []CurrencyReserve{},
+	}
+
+	for _, r := range reserves {
+		r.TotalLiabilities = r.WalletBalances.Add(r.LockedBalances).Add(r.CashierBalances)
+		if holdings, ok := custodyHoldings[r.Currency]; ok {
+			holdings := holdings
+			covered := holdings.GreaterThanOrEqual(r.TotalLiabilities)
+			r.CustodyHoldings, r.FullyCovered = &holdings, &covered
+			if r.TotalLiabilities.IsPositive() {
+				ratio := holdings.Div(r.TotalLiabilities).Round(4)
+				r.CoverageRatio = &ratio
+			}
+		}
+		attestation.Currencies = append(attestation.Currencies, *r)
+	}
+	sort.Slice(attestation.Currencies, func(i, j int) bool {
+		return attestation.Currencies[i].Currency < attestation.Currencies[j].Currency
+	})
+	return attestation, nil
+}
+
+// signAttestation serializes the attestation and signs the exact bytes returned as payload
+func signAttestation(attestation ReserveAttestation, key ed25519.PrivateKey) (SignedAttestation, error) {
+	payload, err := json.Marshal(attestation)
+	if err != nil {
+		return SignedAttestation{}, err
+	}
+	return SignedAttestation{
+		Attestation: attestation,
+		Payload:     string(payload),
+		Signature:   base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)),
+		PublicKey:   base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Algorithm:   "Ed25519",
+	}, nil
+}
+
+type attestationCache struct {
+	mu     sync.Mutex
+	latest *SignedAttestation
+}
+
+var reserveAttestations = &attestationCache{}
+
+// currentReserveAttestation returns the cached attestation unless it is older than the TTL or fresh is set
+func (s *Server) currentReserveAttestation(fresh bool) (SignedAttestation, error) {
+	reserveAttestations.mu.Lock()
+	defer reserveAttestations.mu.Unlock()
+
+	if latest := reserveAttestations.latest; !fresh && latest != nil && time.Since(latest.Attestation.GeneratedAt) < attestationCacheTTL {
+		return *latest, nil
+	}
+
+	attestation, err := s.buildReserveAttestation()
+	if err != nil {
+		return SignedAttestation{}, err
+	}
+	signed, err := signAttestation(attestation, attestationKey)
+	if err != nil {
+		return SignedAttestation{}, err
+	}
+	reserveAttestations.latest = &signed
+	return signed, nil
+}
+
+func (s *Server) respondReserveAttestation(c *gin.Context, fresh bool) {
+	if attestationKey == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Reserve attestations are not configured"})
+		return
+	}
+
+	var previous *SignedAttestation
+	if fresh {
+		reserveAttestations.mu.Lock()
+		previous = reserveAttestations.latest
+		reserveAttestations.mu.Unlock()
+	}
+
+	signed, err := s.currentReserveAttestation(fresh)
+	if err != nil {
+		requestLog(c).Printf("Error generating reserve attestation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate attestation"})
+		return
+	}
+
+	if fresh {
+		var before map[string]interface{}
+		if previous != nil {
+			before = attestationAuditValues(previous.Attestation)
+		}
+		s.recordAuditChange(c, c.GetString("user_id"), "RESERVE_ATTESTATION_CREATE", "reserve_attestation",
+			signed.Attestation.ID, before, attestationAuditValues(signed.Attestation))
+	}
+	c.JSON(http.StatusOK, signed)
+}
+
+// attestationAuditValues is the attestation as recorded in audit_logs: its totals, not the signature
+func attestationAuditValues(attestation ReserveAttestation) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           attestation.ID,
+		"generated_at": attestation.GeneratedAt,
+		"currencies":   attestation.Currencies,
+	}
+}
+
+// handleGetReserveAttestation serves the latest signed attestation to anyone
+func (s *Server) handleGetReserveAttestation(c *gin.Context) {
+	s.respondReserveAttestation(c, false)
+}
+
+// handleAdminCreateReserveAttestation signs a fresh attestation
+func (s *Server) handleAdminCreateReserveAttestation(c *gin.Context) {
+	s.respondReserveAttestation(c, true)
+}
+
+// handleGetAttestationPublicKey returns the key attestation signatures verify against
+func (s *Server) handleGetAttestationPublicKey(c *gin.Context) {
+	if attestationKey == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Reserve attestations are not configured"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"public_key": base64.StdEncoding.EncodeToString(attestationKey.Public().(ed25519.PublicKey)),
+		"algorithm":  "Ed25519",
+	})
+}
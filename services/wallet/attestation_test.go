@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// setTestAttestationConfig installs a signing key and custody holdings and clears the cached attestation
+func setTestAttestationConfig(t *testing.T, holdings map[string]decimal.Decimal) {
+	previousKey, previousHoldings := attestationKey, custodyHoldings
+	t.Cleanup(func() {
+		attestationKey, custodyHoldings = previousKey, previousHoldings
+		reserveAttestations.latest = nil
+	})
+	attestationKey = ed25519.NewKeyFromSeed([]byte(strings.Repeat("s", ed25519.SeedSize)))
+	custodyHoldings = holdings
+	reserveAttestations.latest = nil
+}
+
+func getJSON(t *testing.T, handler gin.HandlerFunc, target interface{}) int {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	handler(c)
+	if err := json.Unmarshal(w.Body.Bytes(), target); err != nil {
+		t.Fatalf("response %s: %v", w.Body.String(), err)
+	}
+	return w.Code
+}
+
+func TestReserveAttestationTotalsAndSignature(t *testing.T) {
+	setTestAttestationConfig(t, map[string]decimal.Decimal{
+		"BOB": decimal.RequireFromString("2000"),
+		"USD": decimal.RequireFromString("350"),
+	})
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Seeded balances, already summed per currency by the database
+	mock.ExpectQuery(`FROM wallets w\s+JOIN users u`).
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "count", "balances", "locked"}).
+			AddRow("BOB", int64(3), "1500.50", "200").
+			AddRow("USD", int64(2), "100", "0"))
+	mock.ExpectQuery(`FROM users\s+WHERE is_cashier = true`).
+		WillReturnRows(sqlmock.NewRows([]string{"usd", "usdt"}).AddRow("300", "0"))
+
+	s := &Server{db: db}
+	var signed SignedAttestation
+	if code := getJSON(t, s.handleGetReserveAttestation, &signed); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	want := map[string]struct {
+		total, ratio string
+		covered      bool
+	}{
+		"BOB":  {total: "1700.5", ratio: "1.1761", covered: true},
+		"USD":  {total: "400", ratio: "0.875", covered: false},
+		"USDT": {total: "0"},
+	}
+	if len(signed.Attestation.Currencies) != len(want) {
+		t.Fatalf("currencies = %+v, want %d", signed.Attestation.Currencies, len(want))
+	}
+	for _, reserve := range signed.Attestation.Currencies {
+		w := want[reserve.Currency]
+		if !reserve.TotalLiabilities.Equal(decimal.RequireFromString(w.total)) {
+			t.Errorf("%s total_liabilities = %s, want %s", reserve.Currency, reserve.TotalLiabilities, w.total)
+		}
+		if w.ratio != "" && (reserve.CoverageRatio == nil || !reserve.CoverageRatio.Equal(decimal.RequireFromString(w.ratio)) ||
+			*reserve.FullyCovered != w.covered) {
+			t.Errorf("%s coverage = %v covered %v, want %s covered %v", reserve.Currency, reserve.CoverageRatio,
+				reserve.FullyCovered, w.ratio, w.covered)
+		}
+	}
+
+	// The signature verifies against the published key and the exact payload string
+	var published struct {
+		PublicKey string `json:"public_key"`
+	}
+	if code := getJSON(t, s.handleGetAttestationPublicKey, &published); code != http.StatusOK {
+		t.Fatalf("public key status = %d, want 200", code)
+	}
+	publicKey, _ := base64.StdEncoding.DecodeString(published.PublicKey)
+	signature, _ := base64.StdEncoding.DecodeString(signed.Signature)
+	if !ed25519.Verify(publicKey, []byte(signed.Payload), signature) {
+		t.Fatal("signature does not verify against the published public key")
+	}
+	tampered := strings.Replace(signed.Payload, `"total_liabilities":"1700.5"`, `"total_liabilities":"1.5"`, 1)
+	if tampered == signed.Payload || ed25519.Verify(publicKey, []byte(tampered), signature) {
+		t.Error("signature verifies a payload with altered liabilities")
+	}
+
+	var payload ReserveAttestation
+	if err := json.Unmarshal([]byte(signed.Payload), &payload); err != nil || payload.ID != signed.Attestation.ID {
+		t.Errorf("payload %s does not describe attestation %s: %v", signed.Payload, signed.Attestation.ID, err)
+	}
+}
+
+func TestReserveAttestationRequiresASigningKey(t *testing.T) {
+	setTestAttestationConfig(t, nil)
+	attestationKey = nil
+
+	var response map[string]interface{}
+	if code := getJSON(t, (&Server{}).handleGetReserveAttestation, &response); code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", code)
+	}
+}
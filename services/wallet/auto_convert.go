@@ -0,0 +1,220 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/shopspring/decimal"
+)
+
+// AutoConversion describes both legs of a conversion applied to a received credit
+type AutoConversion struct {
+	FromCurrency string          `json:"from_currency"`
+	ToCurrency   string          `json:"to_currency"`
+	FromAmount   decimal.Decimal `json:"from_amount"`
+	ToAmount     decimal.Decimal `json:"to_amount"`
+	Rate         decimal.Decimal `json:"rate"`
+	DebitTxID    string          `json:"debit_transaction_id"`
+	CreditTxID   string          `json:"credit_transaction_id"`
+}
+
+// autoConvertMetadata is stored on both legs; amounts stay JSON numbers like manual conversions
+type autoConvertMetadata struct {
+	Conversion   bool        `json:"conversion"`
+	AutoConvert  bool        `json:"auto_convert"`
+	FromCurrency string      `json:"from_currency"`
+	ToCurrency   string      `json:"to_currency"`
+	FromAmount   json.Number `json:"from_amount"`
+	ToAmount     json.Number `json:"to_amount"`
+	Rate         json.Number `json:"rate"`
+	SourceRef    string      `json:"source_ref"`
+}
+
+// referenceConversionRate returns how many units of `to` one unit of `from` is worth at the current
+// exchange rates, which bound the slippage of auto conversions
+func referenceConversionRate(from, to string) (decimal.Decimal, bool) {
+	fromRate, ok := rateToBOB(from)
+	if !ok {
+		return decimal.Zero, false
+	}
+	toRate, ok := rateToBOB(to)
+	if !ok {
+		return decimal.Zero, false
+	}
+	return fromRate.DivRound(toRate, 8), true
+}
+
+// marketConversionRate takes the rate of the latest completed P2P order between both currencies
+// in the last 24 hours, expressed as units of `to` per unit of `from`
+func marketConversionRate(tx *sql.Tx, from, to string) (decimal.Decimal, bool) {
+	var orderFrom string
+	var rate decimal.Decimal
+	err := tx.QueryRow(`
+		SELECT currency_from, rate
+		FROM orders
+		WHERE status = 'COMPLETED' AND COALESCE(is_sandbox, false) = false
+			AND ((currency_from = $1 AND currency_to = $2) OR (currency_from = $2 AND currency_to = $1))
+			AND updated_at > NOW() - INTERVAL '24 hours'
+		ORDER BY updated_at DESC
+		LIMIT 1
+	`, from, to).Scan(&orderFrom, &rate)
+
+	if err != nil || !rate.IsPositive() {
+		return decimal.Zero, false
+	}
+	if orderFrom == from {
+		return rate, true
+	}
+	return decimal.NewFromInt(1).DivRound(rate, 8), true
+}
+
+// checkAutoConvertLimits holds a conversion to the limits of a transfer of the converted amount: the
+// KYC level the target currency needs, the KYC level limits and the daily exposure limits
+func checkAutoConvertLimits(tx *sql.Tx, userID, from, to string, amount decimal.Decimal) error {
+	if err := checkCurrencyKYC(tx, userID, to); err != nil {
+		return err
+	}
+	if err := checkKYCLimits(tx, userID, from, amount); err != nil {
+		return err
+	}
+	return checkExposureLimits(tx, OperationTransfer, userID, from, amount)
+}
+
+// applyAutoConvert converts a credit the user just received into their preferred currency,
+// inside the transaction that made the credit. Users without an enabled preference, credits
+// below their minimum, rates outside their slippage tolerance and conversions over the user's
+// limits are left untouched. Any failure is rolled back to a savepoint so the original credit
+// still goes through.
+func applyAutoConvert(tx *sql.Tx, userID, currency string, amount decimal.Decimal, sourceRef string) *AutoConversion {
+	var enabled bool
+	var targetCurrency string
+	var maxSlippage, minAmount decimal.Decimal
+	err := tx.QueryRow(`
+		SELECT enabled, target_currency, max_slippage_percent, min_amount
+		FROM user_auto_convert_preferences
+		WHERE user_id = $1
+	`, userID).Scan(&enabled, &targetCurrency, &maxSlippage, &minAmount)
+
+	if err != nil || !enabled || targetCurrency == currency || amount.LessThan(minAmount) || !amount.IsPositive() {
+		return nil
+	}
+
+	referenceRate, ok := referenceConversionRate(currency, targetCurrency)
+	if !ok {
+		return nil
+	}
+
+	rate := referenceRate
+	if marketRate, ok := marketConversionRate(tx, currency, targetCurrency); ok {
+		rate = marketRate
+	}
+
+	slippage := rate.Sub(referenceRate).Abs().Div(referenceRate).Mul(decimal.NewFromInt(100))
+	if slippage.GreaterThan(maxSlippage) {
+		log.Printf("⚠️ Auto-convert skipped for user %s: %s->%s rate %s deviates %s%% from reference %s (max %s%%)",
+			userID, currency, targetCurrency, rate.String(), slippage.StringFixed(2), referenceRate.String(), maxSlippage.String())
+		return nil
+	}
+
+	toAmount, dust := roundForCurrency(targetCurrency, amount.Mul(rate))
+	if !toAmount.IsPositive() {
+		return nil
+	}
+
+	if _, err := tx.Exec(`SAVEPOINT auto_convert`); err != nil {
+		log.Printf("❌ Auto-convert savepoint failed for user %s: %v", userID, err)
+		return nil
+	}
+
+	if err := checkAutoConvertLimits(tx, userID, currency, targetCurrency, amount); err != nil {
+		log.Printf("⚠️ Auto-convert skipped for user %s (%s %s -> %s): %v", userID, amount.String(), currency, targetCurrency, err)
+		tx.Exec(`ROLLBACK TO SAVEPOINT auto_convert`)
+		return nil
+	}
+
+	conversion, err := executeAutoConvert(tx, userID, currency, targetCurrency, amount, toAmount, rate, sourceRef)
+	if err == nil {
+		err = recordDust(tx, targetCurrency, dust, "AUTO_CONVERT", sourceRef)
+	}
+	if err != nil {
+		log.Printf("❌ Auto-convert failed for user %s (%s %s -> %s): %v", userID, amount.String(), currency, targetCurrency, err)
+		tx.Exec(`ROLLBACK TO SAVEPOINT auto_convert`)
+		return nil
+	}
+
+	tx.Exec(`RELEASE SAVEPOINT auto_convert`)
+
+	log.Printf("🔄 Auto-converted %s %s -> %s %s for user %s (rate %s, ref %s)",
+		amount.String(), currency, toAmount.String(), targetCurrency, userID, rate.String(), sourceRef)
+
+	return conversion
+}
+
+// executeAutoConvert moves the funds between wallets and records both legs like a manual conversion
+func executeAutoConvert(tx *sql.Tx, userID, from, to string, fromAmount, toAmount, rate decimal.Decimal, sourceRef string) (*AutoConversion, error) {
+	result, err := tx.Exec(`
+		UPDATE wallets
+		SET balance = balance - $3, updated_at = NOW()
+		WHERE user_id = $1 AND currency = $2 AND balance - COALESCE(locked_balance, 0) >= $3
+	`, userID, from, fromAmount)
+	if err != nil {
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, fmt.Errorf("insufficient %s balance", from)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO wallets (user_id, currency, balance, locked_balance, created_at, updated_at)
+		VALUES ($1, $2, $3, 0, NOW(), NOW())
+		ON CONFLICT (user_id, currency)
+		DO UPDATE SET balance = wallets.balance + $3, updated_at = NOW()
+	`, userID, to, toAmount)
+	if err != nil {
+		return nil, err
+	}
+
+	conversion := &AutoConversion{
+		FromCurrency: from,
+		ToCurrency:   to,
+		FromAmount:   fromAmount,
+		ToAmount:     toAmount,
+		Rate:         rate,
+	}
+
+	metadata, err := json.Marshal(autoConvertMetadata{
+		Conversion:   true,
+		AutoConvert:  true,
+		FromCurrency: from,
+		ToCurrency:   to,
+		FromAmount:   json.Number(fromAmount.String()),
+		ToAmount:     json.Number(toAmount.String()),
+		Rate:         json.Number(rate.String()),
+		SourceRef:    sourceRef,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO transactions (user_id, type, transaction_type, currency, amount, status, method, payment_method, external_ref, metadata, created_at, updated_at)
+		VALUES ($1, 'TRANSFER_OUT', 'TRANSFER_OUT', $2, $3, 'COMPLETED', 'INTERNAL', 'INTERNAL', $4, $5, NOW(), NOW())
+		RETURNING id
+	`, userID, from, fromAmount, sourceRef, string(metadata)).Scan(&conversion.DebitTxID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO transactions (user_id, type, transaction_type, currency, amount, status, method, payment_method, external_ref, metadata, created_at, updated_at)
+		VALUES ($1, 'TRANSFER_IN', 'TRANSFER_IN', $2, $3, 'COMPLETED', 'INTERNAL', 'INTERNAL', $4, $5, NOW(), NOW())
+		RETURNING id
+	`, userID, to, toAmount, conversion.DebitTxID, string(metadata)).Scan(&conversion.CreditTxID)
+	if err != nil {
+		return nil, err
+	}
+
+	return conversion, nil
+}
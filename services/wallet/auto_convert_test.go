@@ -0,0 +1,178 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+)
+
+func TestApplyAutoConvertChecksLimits(t *testing.T) {
+	tests := []struct {
+		name          string
+		requiredLevel int
+		perTx         interface{}
+		exposure      bool   // user daily net outflow capped at 1000 BOB
+		netOutflow    string // today's net outflow in BOB, empty when not queried
+		wantConverted bool   // reaches the wallet updates
+	}{
+		{name: "target currency needs a higher KYC level", requiredLevel: 2},
+		{name: "over the transaction limit", perTx: "500"},
+		{name: "over the daily net outflow", exposure: true, netOutflow: "500"},
+		{name: "within every limit", perTx: "1000", exposure: true, netOutflow: "0", wantConverted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.exposure {
+				setTestExposureLimits(t, "1000", "0")
+			}
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`FROM user_auto_convert_preferences`).WithArgs("user-1").
+				WillReturnRows(sqlmock.NewRows([]string{"enabled", "target_currency", "max_slippage_percent", "min_amount"}).
+					AddRow(true, "USD", "5", "0"))
+			mock.ExpectQuery(`FROM orders`).WithArgs("BOB", "USD").WillReturnError(sql.ErrNoRows)
+			mock.ExpectExec(`SAVEPOINT auto_convert`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`LEFT JOIN kyc_currency_requirements`).WithArgs("user-1", "USD").
+				WillReturnRows(sqlmock.NewRows([]string{"kyc_level", "min_kyc_level"}).AddRow(1, tt.requiredLevel))
+			if tt.requiredLevel <= 1 {
+				mock.ExpectQuery(`SELECT COALESCE\(kyc_level, 0\) FROM users`).WithArgs("user-1").
+					WillReturnRows(sqlmock.NewRows([]string{"kyc_level"}).AddRow(1))
+				mock.ExpectQuery(`FROM kyc_level_limits`).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(kycLimitColumns).AddRow("BOB", nil, nil, tt.perTx))
+			}
+			if tt.netOutflow != "" {
+				mock.ExpectQuery(`FROM exposure_overrides`).WithArgs("user-1").
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mock.ExpectQuery(`FROM transactions t`).WithArgs("user-1").
+					WillReturnRows(sqlmock.NewRows(netOutflowColumns).AddRow("BOB", tt.netOutflow, "0"))
+			}
+			if tt.wantConverted {
+				// Let the debit fail: reaching it is what matters here
+				mock.ExpectExec(`UPDATE wallets`).WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+			mock.ExpectExec(`ROLLBACK TO SAVEPOINT auto_convert`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if conversion := applyAutoConvert(tx, "user-1", "BOB", decimal.NewFromInt(690), "ref-1"); conversion != nil {
+				t.Errorf("applyAutoConvert() = %+v, want nil", conversion)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// autoConvertMetadataArg matches metadata that parses as JSON and keeps the source reference intact
+type autoConvertMetadataArg struct {
+	t         *testing.T
+	sourceRef string
+}
+
+func (a autoConvertMetadataArg) Match(v driver.Value) bool {
+	var metadata struct {
+		AutoConvert bool    `json:"auto_convert"`
+		FromAmount  float64 `json:"from_amount"`
+		SourceRef   string  `json:"source_ref"`
+	}
+	if err := json.Unmarshal([]byte(v.(string)), &metadata); err != nil {
+		a.t.Errorf("metadata %s is not valid JSON: %v", v, err)
+		return false
+	}
+	return metadata.AutoConvert && metadata.FromAmount == 690 && metadata.SourceRef == a.sourceRef
+}
+
+func TestExecuteAutoConvertEscapesMetadata(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sourceRef := `ref", "auto_convert": false, "x": "\\`
+	metadata := autoConvertMetadataArg{t: t, sourceRef: sourceRef}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE wallets`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO wallets`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`'TRANSFER_OUT'`).WithArgs("user-1", "BOB", sqlmock.AnyArg(), sourceRef, metadata).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("tx-out"))
+	mock.ExpectQuery(`'TRANSFER_IN'`).WithArgs("user-1", "USD", sqlmock.AnyArg(), "tx-out", metadata).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("tx-in"))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = executeAutoConvert(tx, "user-1", "BOB", "USD", decimal.NewFromInt(690), decimal.NewFromInt(100),
+		decimal.RequireFromString("0.14492754"), sourceRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAutoConvertOrderProceeds(t *testing.T) {
+	sell := OrderEvent{Event: "order.completed", OrderID: "order-1"}
+	sell.Order.UserID, sell.Order.Type, sell.Order.CurrencyTo = "user-1", "SELL", "BOB"
+	buy := sell
+	buy.Order.Type = "BUY"
+
+	tests := []struct {
+		name      string
+		event     OrderEvent
+		converted bool // an earlier delivery already converted the proceeds
+		credited  string
+	}{
+		{name: "buy orders credit the cashier's side only", event: buy},
+		{name: "redelivered event", event: sell, converted: true},
+		{name: "seller proceeds", event: sell, credited: "690"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			if tt.event.Order.Type == "SELL" {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`FROM wallets WHERE user_id = \$1 AND currency = \$2 FOR UPDATE`).WithArgs("user-1", "BOB").
+					WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow("user-1"))
+				mock.ExpectQuery(`type = 'TRANSFER_OUT' AND method = 'INTERNAL'`).WithArgs("user-1", "order-1").
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(tt.converted))
+				if tt.credited != "" {
+					mock.ExpectQuery(`FROM wallet_transactions`).WithArgs("order-1", "user-1", "BOB").
+						WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(tt.credited))
+					// The credited amount goes through applyAutoConvert; no preference leaves it as is
+					mock.ExpectQuery(`FROM user_auto_convert_preferences`).WithArgs("user-1").WillReturnError(sql.ErrNoRows)
+				}
+				mock.ExpectRollback()
+			}
+
+			if err := autoConvertOrderProceeds(db, tt.event); err != nil {
+				t.Fatal(err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
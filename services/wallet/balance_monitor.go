@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// Defense in depth for wallet balances. The database rejects negative balances, but rows that
+// predate the constraint, or a bypassed check, are caught here: every few minutes the monitor
+// raises a CRITICAL alert for each negative balance or locked balance, and a WARNING for
+// residues closer to zero than BALANCE_ANOMALY_EPSILON, which usually point at rounding bugs.
+
+type BalanceAnomaly struct {
+	UserID             string          `json:"user_id"`
+	Currency           string          `json:"currency"`
+	Balance            decimal.Decimal `json:"balance"`
+	LockedBalance      decimal.Decimal `json:"locked_balance"`
+	Kind               string          `json:"kind"` // NEGATIVE_BALANCE, NEGATIVE_LOCKED, NEAR_ZERO
+	UpdatedAt          time.Time       `json:"updated_at"`
+	RecentTransactions []gin.H         `json:"recent_transactions,omitempty"`
+}
+
+func balanceAnomalyEpsilon() decimal.Decimal {
+	if value, err := decimal.NewFromString(os.Getenv("BALANCE_ANOMALY_EPSILON")); err == nil && !value.IsNegative() {
+		return value
+	}
+	return decimal.RequireFromString("0.000001")
+}
+
+func (s *Server) monitorBalances() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		s.checkBalanceAnomalies()
+		<-ticker.C
+	}
+}
+
+// findBalanceAnomalies returns the wallets with a negative balance, or a near-zero residue too
+func (s *Server) findBalanceAnomalies(includeNearZero bool) ([]BalanceAnomaly, error) {
+	epsilon := balanceAnomalyEpsilon()
+	rows, err := s.db.Query(`
+		SELECT user_id, currency, COALESCE(balance, 0), COALESCE(locked_balance, 0), updated_at
+		FROM wallets
+		WHERE balance < 0 OR locked_balance < 0
+			OR ($1 AND ((balance > 0 AND balance < $2) OR (locked_balance > 0 AND locked_balance < $2)))
+		ORDER BY LEAST(balance, locked_balance) ASC
+		LIMIT 500
+	`, includeNearZero, epsilon)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anomalies := []BalanceAnomaly{}
+	for rows.Next() {
+		var anomaly BalanceAnomaly
+		var updatedAt sql.NullTime
+		if err := rows.Scan(&anomaly.UserID, &anomaly.Currency, &anomaly.Balance, &anomaly.LockedBalance, &updatedAt); err != nil {
+			continue
+		}
+		anomaly.UpdatedAt = updatedAt.Time
+
+		switch {
+		case anomaly.Balance.IsNegative():
+			anomaly.Kind = "NEGATIVE_BALANCE"
+		case anomaly.LockedBalance.IsNegative():
+			anomaly.Kind = "NEGATIVE_LOCKED"
+		default:
+			anomaly.Kind = "NEAR_ZERO"
+		}
+		anomalies = append(anomalies, anomaly)
+	}
+	return anomalies, nil
+}
+
+func (s *Server) checkBalanceAnomalies() {
+	anomalies, err := s.findBalanceAnomalies(true)
+	if err != nil {
+		log.Printf("❌ Balance monitor query failed: %v", err)
+		return
+	}
+
+	for _, anomaly := range anomalies {
+		details := map[string]interface{}{
+			"user_id":        anomaly.UserID,
+			"currency":       anomaly.Currency,
+			"balance":        anomaly.Balance.String(),
+			"locked_balance": anomaly.LockedBalance.String(),
+		}
+		dedupeKey := fmt.Sprintf("balance_anomaly:%s:%s:%s", anomaly.Kind, anomaly.UserID, anomaly.Currency)
+
+		if anomaly.Kind == "NEAR_ZERO" {
+			raiseSystemAlert(s.db, "WARNING", "wallet.balance_monitor", "BALANCE_RESIDUE", dedupeKey,
+				fmt.Sprintf("Wallet %s of user %s holds a near-zero residue (balance %s, locked %s)",
+					anomaly.Currency, anomaly.UserID, anomaly.Balance.String(), anomaly.LockedBalance.String()), details)
+			continue
+		}
+		raiseSystemAlert(s.db, "CRITICAL", "wallet.balance_monitor", anomaly.Kind, dedupeKey,
+			fmt.Sprintf("Wallet %s of user %s is negative (balance %s, locked %s)",
+				anomaly.Currency, anomaly.UserID, anomaly.Balance.String(), anomaly.LockedBalance.String()), details)
+	}
+}
+
+// Admin handler listing negative balances with the latest movements that may explain them
+func (s *Server) handleAdminGetNegativeBalances(c *gin.Context) {
+	anomalies, err := s.findBalanceAnomalies(c.Query("include_near_zero") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load balances"})
+		return
+	}
+
+	for i := range anomalies {
+		anomalies[i].RecentTransactions = s.recentWalletMovements(anomalies[i].UserID, anomalies[i].Currency)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   anomalies,
+		"total":  len(anomalies),
+	})
+}
+
+func (s *Server) recentWalletMovements(userID, currency string) []gin.H {
+	rows, err := s.db.Query(`
+		SELECT id, COALESCE(type, transaction_type), amount, status, COALESCE(method, payment_method, ''), updated_at
+		FROM transactions
+		WHERE (COALESCE(user_id, from_user_id) = $1 OR to_user_id = $1) AND currency = $2
+		ORDER BY updated_at DESC
+		LIMIT 10
+	`, userID, currency)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	movements := []gin.H{}
+	for rows.Next() {
+		var id, txType, status, method string
+		var amount decimal.Decimal
+		var updatedAt time.Time
+		if err := rows.Scan(&id, &txType, &amount, &status, &method, &updatedAt); err == nil {
+			movements = append(movements, gin.H{
+				"id":         id,
+				"type":       txType,
+				"amount":     amount,
+				"status":     status,
+				"method":     method,
+				"updated_at": updatedAt,
+			})
+		}
+	}
+	return movements
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var balanceAnomalyColumns = []string{"user_id", "currency", "balance", "locked_balance", "updated_at"}
+
+func TestBalanceMonitorFlagsNegativeBalances(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// A withdrawal that slipped past the balance check left user-1 at -25 BOB
+	mock.ExpectQuery(`FROM wallets\s+WHERE balance < 0 OR locked_balance < 0`).
+		WithArgs(true, balanceAnomalyEpsilon()).
+		WillReturnRows(sqlmock.NewRows(balanceAnomalyColumns).
+			AddRow("user-1", "BOB", "-25", "0", time.Now()).
+			AddRow("user-2", "USD", "10", "-0.5", time.Now()).
+			AddRow("user-3", "USDT", "0.0000001", "0", time.Now()))
+	mock.ExpectExec(`INSERT INTO system_alerts`).
+		WithArgs("CRITICAL", "wallet.balance_monitor", "NEGATIVE_BALANCE", "balance_anomaly:NEGATIVE_BALANCE:user-1:BOB",
+			"Wallet BOB of user user-1 is negative (balance -25, locked 0)", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO system_alerts`).
+		WithArgs("CRITICAL", "wallet.balance_monitor", "NEGATIVE_LOCKED", "balance_anomaly:NEGATIVE_LOCKED:user-2:USD",
+			sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO system_alerts`).
+		WithArgs("WARNING", "wallet.balance_monitor", "BALANCE_RESIDUE", "balance_anomaly:NEAR_ZERO:user-3:USDT",
+			sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	(&Server{db: db}).checkBalanceAnomalies()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAdminNegativeBalancesShowRecentMovements(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM wallets\s+WHERE balance < 0`).WithArgs(false, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(balanceAnomalyColumns).AddRow("user-1", "BOB", "-25", "0", time.Now()))
+	mock.ExpectQuery(`FROM transactions\s+WHERE \(COALESCE\(user_id, from_user_id\) = \$1 OR to_user_id = \$1\) AND currency = \$2`).
+		WithArgs("user-1", "BOB").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "amount", "status", "method", "updated_at"}).
+			AddRow("tx-2", "WITHDRAWAL", "125", "COMPLETED", "BANK", time.Now()).
+			AddRow("tx-1", "DEPOSIT", "100", "COMPLETED", "QR", time.Now().Add(-time.Hour)))
+
+	c, w := alertTestContext(http.MethodGet, "/admin/wallets/negative", "")
+	(&Server{db: db}).handleAdminGetNegativeBalances(c)
+
+	var response struct {
+		Data []BalanceAnomaly `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("response = %d %s: %v", w.Code, w.Body.String(), err)
+	}
+	if len(response.Data) != 1 || response.Data[0].Kind != "NEGATIVE_BALANCE" || len(response.Data[0].RecentTransactions) != 2 ||
+		response.Data[0].RecentTransactions[0]["id"] != "tx-2" {
+		t.Errorf("data = %+v, want user-1's negative BOB balance with the withdrawal that caused it first", response.Data)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -89,11 +90,28 @@ func (bi *BankIntegration) pollBankNotifications() {
 		}
 		
 		for _, notification := range notifications {
+			// Parked notifications wait for an operator to replay or discard them
+			if isDeadLetterParked(bi.db, DeadLetterBankNotification, notification.ID) {
+				continue
+			}
+			
 			err := bi.processBankNotification(notification)
 			if err != nil {
 				log.Printf("❌ Error processing notification %s: %v", notification.ID, err)
+				raiseSystemAlert(bi.db, "WARNING", "wallet.bank_integration", "NOTIFICATION_FAILED",
+					"notification:"+notification.ID,
+					fmt.Sprintf("Bank notification %s could not be processed: %v", notification.ID, err),
+					map[string]interface{}{
+						"notification_id": notification.ID,
+						"reference":       notification.Reference,
+						"amount":          notification.Amount.String(),
+						"currency":        notification.Currency,
+					})
+				recordDeadLetter(bi.db, DeadLetterBankNotification, notification.ID, notification, err,
+					errors.Is(err, errUnmatchedNotification))
 				continue
 			}
+			markDeadLetterRecovered(bi.db, DeadLetterBankNotification, notification.ID)
 		}
 	}
 }
@@ -186,10 +204,9 @@ func (bi *BankIntegration) processBankNotification(notification BankNotification
 	// Determine user and action based on reference and bank account
 	userID, actionType, matchOrderID, err := bi.parseNotificationReference(notification)
 	if err != nil {
+		// Parked as a dead letter by the caller until the reference or account mapping is fixed
 		log.Printf("⚠️ Could not parse notification reference: %v", err)
-		// Mark as processed even if we can't parse it to avoid reprocessing
-		bi.redis.Set(ctx, cacheKey, "unparseable", 24*time.Hour)
-		return nil
+		return fmt.Errorf("%w: %v", errUnmatchedNotification, err)
 	}
 	
 	// Create wallet transaction record
@@ -275,19 +292,25 @@ func (bi *BankIntegration) parseNotificationReference(notification BankNotificat
 	ref := strings.ToUpper(strings.TrimSpace(notification.Reference))
 	
 	// P2P payment reference format: "P2P-{MATCH_ID}-{USER_ID}"
-	if strings.HasPrefix(ref, "P2P-") {
-		parts := strings.Split(ref, "-")
-		if len(parts) >= 3 {
-			return parts[2], "P2P_PAYMENT", parts[1], nil
+	if matchID, payerID, ok := parseP2PPaymentReference(ref); ok {
+		return payerID, "P2P_PAYMENT", matchID, nil
+	}
+	
+	// Deposit reference issued when the user started the deposit: "DEP-{CODE}-{CHECK}"
+	if isDepositReference(ref) {
+		var depositUserID string
+		err = bi.db.QueryRow(`
+			SELECT user_id FROM transactions
+			WHERE deposit_reference = $1 AND transaction_type = 'DEPOSIT'
+		`, ref).Scan(&depositUserID)
+		if err == nil {
+			return depositUserID, "DEPOSIT", "", nil
 		}
 	}
 	
-	// Regular deposit reference format: "DEPOSIT-{USER_ID}"
-	if strings.HasPrefix(ref, "DEPOSIT-") {
-		userID := strings.TrimPrefix(ref, "DEPOSIT-")
-		if userID != "" {
-			return userID, "DEPOSIT", "", nil
-		}
+	// Legacy deposit reference format: "DEPOSIT-{USER_ID}"
+	if depositUserID, ok := parseLegacyDepositReference(ref); ok {
+		return depositUserID, "DEPOSIT", "", nil
 	}
 	
 	// Try to find user by bank account mapping
@@ -327,6 +350,24 @@ func (bi *BankIntegration) processDeposit(tx *sql.Tx, userID string, notificatio
 		return err
 	}
 	
+	// Close the deposit the user opened with this reference, if any
+	ref := strings.ToUpper(strings.TrimSpace(notification.Reference))
+	if isDepositReference(ref) {
+		_, err = tx.Exec(`
+			UPDATE transactions SET status = 'COMPLETED', updated_at = NOW()
+			WHERE deposit_reference = $1 AND user_id = $2 AND transaction_type = 'DEPOSIT' AND status IN ('PENDING', 'PROCESSING')
+		`, ref, userID)
+		if err != nil {
+			return err
+		}
+		
+		if orderFundingEnabled() {
+			if err := bi.fundOrderFromDeposit(tx, userID, ref, notification.Amount, notification.Currency); err != nil {
+				return err
+			}
+		}
+	}
+	
 	log.Printf("💰 Deposit processed: %s %s credited to user %s",
 		notification.Amount.String(), notification.Currency, userID)
 	
@@ -369,21 +410,78 @@ func (bi *BankIntegration) processP2PPayment(tx *sql.Tx, userID, matchOrderID st
 	return nil
 }
 
+// A match is under dispute while either of its orders is DISPUTED or has a dispute not yet
+// resolved; its escrow then stays put until the resolution decides where it goes
+const matchUnderDisputeCondition = `(
+	bo.status = 'DISPUTED' OR so.status = 'DISPUTED' OR EXISTS (
+		SELECT 1 FROM disputes d
+		WHERE d.order_id IN (m.buy_order_id, m.sell_order_id) AND d.status NOT IN ('RESOLVED', 'CLOSED')
+	)
+)`
+
+var errEscrowUnderDispute = errors.New("escrow is frozen: the match has an unresolved dispute")
+
+// matchDisputedCondition holds for a match with any dispute on its orders, resolved or not. The
+// resolution decides where the funds of such a match go, so the auto-release never touches it.
+const matchDisputedCondition = `(
+	bo.status = 'DISPUTED' OR so.status = 'DISPUTED' OR EXISTS (
+		SELECT 1 FROM disputes d WHERE d.order_id IN (m.buy_order_id, m.sell_order_id)
+	)
+)`
+
+// matchEverDisputed locks the match and reports whether its orders were ever disputed
+func matchEverDisputed(tx *sql.Tx, matchID string) (bool, error) {
+	var disputed bool
+	err := tx.QueryRow(`
+		SELECT `+matchDisputedCondition+`
+		FROM p2p_matches m
+		JOIN orders bo ON m.buy_order_id = bo.id
+		JOIN orders so ON m.sell_order_id = so.id
+		WHERE m.id = $1
+		FOR UPDATE OF m
+	`, matchID).Scan(&disputed)
+	return disputed, err
+}
+
 func (bi *BankIntegration) releaseP2PEscrow(tx *sql.Tx, matchID, buyerID, sellerID, currency string, amount decimal.Decimal) error {
+	// Never release funds while a dispute may still send them the other way
+	var disputed bool
+	err := tx.QueryRow(`
+		SELECT `+matchUnderDisputeCondition+`
+		FROM p2p_matches m
+		JOIN orders bo ON m.buy_order_id = bo.id
+		JOIN orders so ON m.sell_order_id = so.id
+		WHERE m.id = $1
+		FOR UPDATE OF m
+	`, matchID).Scan(&disputed)
+	if err != nil {
+		return fmt.Errorf("failed to check disputes of match %s: %v", matchID, err)
+	}
+	if disputed {
+		return errEscrowUnderDispute
+	}
+	
+	// Round the credit to the currency precision; the remainder goes to the dust account
+	creditAmount, dust := roundForCurrency(currency, amount)
+	
 	// Credit the seller
-	_, err := tx.Exec(`
+	_, err = tx.Exec(`
 		INSERT INTO wallets (user_id, currency, balance, locked_balance, created_at, updated_at)
 		VALUES ($1, $2, $3, 0, NOW(), NOW())
 		ON CONFLICT (user_id, currency) 
 		DO UPDATE SET 
 			balance = wallets.balance + $3,
 			updated_at = NOW()
-	`, sellerID, currency, amount)
+	`, sellerID, currency, creditAmount)
 	
 	if err != nil {
 		return err
 	}
 	
+	if err = recordDust(tx, currency, dust, "ESCROW_RELEASE", matchID); err != nil {
+		return err
+	}
+	
 	// Release locked balance from seller (if any)
 	_, err = tx.Exec(`
 		UPDATE wallets 
@@ -425,9 +523,16 @@ func (bi *BankIntegration) releaseP2PEscrow(tx *sql.Tx, matchID, buyerID, seller
 	_, err = tx.Exec(`
 		INSERT INTO wallet_transactions (id, user_id, transaction_type, currency, amount, status, method, external_ref, created_at, updated_at)
 		VALUES ($1, $2, 'P2P_SELL', $3, $4, 'COMPLETED', 'P2P', $5, NOW(), NOW())
-	`, sellerTxID, sellerID, currency, amount, matchID)
+	`, sellerTxID, sellerID, currency, creditAmount, matchID)
 	
-	return err
+	if err != nil {
+		return err
+	}
+	
+	// Convert the seller's proceeds if they opted in
+	applyAutoConvert(tx, sellerID, currency, creditAmount, matchID)
+	
+	return nil
 }
 
 func (bi *BankIntegration) processPendingTransactions() {
@@ -470,6 +575,10 @@ func (bi *BankIntegration) checkPendingTransactions() {
 		if time.Since(createdAt) > time.Hour {
 			bi.db.Exec("UPDATE wallet_transactions SET status = 'FAILED', updated_at = NOW() WHERE id = $1", txID)
 			log.Printf("⏰ Transaction marked as failed due to timeout: %s", txID)
+			raiseSystemAlert(bi.db, "WARNING", "wallet.pending_transactions", "TRANSACTION_TIMEOUT",
+				"transaction_timeout:"+txID,
+				fmt.Sprintf("Bank transaction %s was never confirmed and was marked as failed", txID),
+				map[string]interface{}{"transaction_id": txID, "user_id": userID, "created_at": createdAt})
 		}
 	}
 }
@@ -484,7 +593,8 @@ func (bi *BankIntegration) monitorEscrowReleases() {
 }
 
 func (bi *BankIntegration) checkEscrowReleases() {
-	// Check for P2P matches that need escrow release
+	// Check for P2P matches that need escrow release; disputed ones, even resolved, are left to
+	// the resolution
 	query := `
 		SELECT m.id, m.amount, m.rate, bo.currency_from, so.user_id as seller_id
 		FROM p2p_matches m
@@ -492,7 +602,7 @@ func (bi *BankIntegration) checkEscrowReleases() {
 		JOIN orders so ON m.sell_order_id = so.id
 		WHERE m.status = 'PENDING' 
 		AND m.created_at < NOW() - INTERVAL '24 hours'
-	`
+		AND NOT ` + matchDisputedCondition
 	
 	rows, err := bi.db.Query(query)
 	if err != nil {
@@ -512,18 +622,41 @@ func (bi *BankIntegration) checkEscrowReleases() {
 		// Auto-release escrow after 24 hours (safety mechanism)
 		log.Printf("⏰ Auto-releasing escrow for match %s after timeout", matchID)
 		
+		details := map[string]interface{}{
+			"match_id":  matchID,
+			"seller_id": sellerID,
+			"amount":    amount.String(),
+			"currency":  currency,
+		}
+		
 		tx, err := bi.db.Begin()
 		if err != nil {
 			continue
 		}
 		
-		err = bi.releaseP2PEscrow(tx, matchID, "", sellerID, currency, amount)
+		disputed, err := matchEverDisputed(tx, matchID)
+		if err == nil && !disputed {
+			err = bi.releaseP2PEscrow(tx, matchID, "", sellerID, currency, amount)
+		}
+		if disputed || err == errEscrowUnderDispute {
+			// Disputed since the scan
+			tx.Rollback()
+			continue
+		}
 		if err != nil {
 			tx.Rollback()
+			details["error"] = err.Error()
+			raiseSystemAlert(bi.db, "CRITICAL", "wallet.escrow_monitor", "STUCK_ESCROW", "stuck_escrow:"+matchID,
+				fmt.Sprintf("Escrow for match %s is stuck for over 24h and auto-release failed", matchID), details)
+			continue
+		}
+		
+		if err = tx.Commit(); err != nil {
 			continue
 		}
 		
-		tx.Commit()
+		raiseSystemAlert(bi.db, "WARNING", "wallet.escrow_monitor", "STUCK_ESCROW", "stuck_escrow:"+matchID,
+			fmt.Sprintf("Escrow for match %s was auto-released after 24h without payment confirmation", matchID), details)
 	}
 }
 
@@ -531,12 +664,15 @@ func (bi *BankIntegration) acknowledgeNotification(notificationID string) {
 	payload := map[string]string{"notification_id": notificationID}
 	payloadJSON, _ := json.Marshal(payload)
 	
-	resp, err := bi.httpClient.Post(
-		bi.listenerURL+"/api/acknowledge",
-		"application/json",
-		strings.NewReader(string(payloadJSON)),
-	)
+	req, err := http.NewRequest("POST", bi.listenerURL+"/api/acknowledge", strings.NewReader(string(payloadJSON)))
+	if err != nil {
+		log.Printf("Failed to acknowledge notification %s: %v", notificationID, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setWebhookHeaders(req, payloadJSON)
 	
+	resp, err := bi.httpClient.Do(req)
 	if err != nil {
 		log.Printf("Failed to acknowledge notification %s: %v", notificationID, err)
 		return
@@ -548,38 +684,7 @@ func (bi *BankIntegration) acknowledgeNotification(notificationID string) {
 	}
 }
 
-func (bi *BankIntegration) GetPendingDeposits(userID string) ([]WalletTransaction, error) {
-	query := `
-		SELECT id, user_id, transaction_type, currency, amount, status, method, external_ref, created_at, updated_at
-		FROM wallet_transactions 
-		WHERE user_id = $1 AND transaction_type = 'DEPOSIT' AND status = 'PENDING'
-		ORDER BY created_at DESC
-	`
-	
-	rows, err := bi.db.Query(query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	
-	var transactions []WalletTransaction
-	for rows.Next() {
-		var tx WalletTransaction
-		err := rows.Scan(&tx.ID, &tx.UserID, &tx.Type, &tx.Currency, &tx.Amount,
-			&tx.Status, &tx.Method, &tx.ExternalRef, &tx.CreatedAt, &tx.UpdatedAt)
-		if err != nil {
-			continue
-		}
-		transactions = append(transactions, tx)
-	}
-	
-	return transactions, nil
-}
-
-func (bi *BankIntegration) GetDepositInstructions(userID, currency string, amount decimal.Decimal) (map[string]interface{}, error) {
-	// Generate unique reference for this deposit
-	reference := fmt.Sprintf("DEPOSIT-%s-%d", userID, time.Now().Unix())
-	
+func (bi *BankIntegration) GetDepositInstructions(currency string, amount decimal.Decimal, reference string) (map[string]interface{}, error) {
 	// Get bank account for deposits
 	var bankAccount, bankName, accountHolder string
 	err := bi.db.QueryRow(`
@@ -604,6 +709,6 @@ func (bi *BankIntegration) GetDepositInstructions(userID, currency string, amoun
 			"Transfiere exactamente %s %s a la cuenta %s con referencia: %s",
 			amount.String(), currency, bankAccount, reference,
 		),
-		"expires_at": time.Now().Add(24 * time.Hour),
+		"expires_at": time.Now().Add(depositReferenceTTL),
 	}, nil
 }
\ No newline at end of file
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// Step-up confirmation for outgoing money. Each withdrawal or transfer gets a list of required
+// factors from its BOB-equivalent amount, the sender's KYC level and a risk score:
+//   - PIN: every withdrawal; transfers from TRANSACTION_PIN_THRESHOLD_BOB or when the risk
+//     score reaches CONFIRMATION_RISK_PIN_SCORE
+//   - EMAIL_OTP: from the sender's KYC level threshold in CONFIRMATION_OTP_THRESHOLDS_BOB
+//     ("0:500,1:2000,2:10000,3:50000") or when the risk score reaches CONFIRMATION_RISK_OTP_SCORE
+
+const (
+	ConfirmationPIN      = "PIN"
+	ConfirmationEmailOTP = "EMAIL_OTP"
+)
+
+const (
+	OperationWithdrawal = "WITHDRAWAL"
+	OperationTransfer   = "TRANSFER"
+)
+
+var defaultOTPThresholdsBOB = map[int]decimal.Decimal{
+	0: decimal.NewFromInt(500),
+	1: decimal.NewFromInt(2000),
+	2: decimal.NewFromInt(10000),
+	3: decimal.NewFromInt(50000),
+}
+
+var otpThresholdsBOB = loadOTPThresholds()
+
+func loadOTPThresholds() map[int]decimal.Decimal {
+	thresholds := make(map[int]decimal.Decimal)
+	for level, threshold := range defaultOTPThresholdsBOB {
+		thresholds[level] = threshold
+	}
+
+	config := os.Getenv("CONFIRMATION_OTP_THRESHOLDS_BOB")
+	if config == "" {
+		return thresholds
+	}
+	for _, entry := range strings.Split(config, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 {
+			log.Printf("⚠️ Ignoring invalid CONFIRMATION_OTP_THRESHOLDS_BOB entry: %s", entry)
+			continue
+		}
+		level, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		threshold, errAmount := decimal.NewFromString(strings.TrimSpace(parts[1]))
+		if err != nil || errAmount != nil || !threshold.IsPositive() {
+			log.Printf("⚠️ Ignoring invalid CONFIRMATION_OTP_THRESHOLDS_BOB entry: %s", entry)
+			continue
+		}
+		thresholds[level] = threshold
+	}
+	return thresholds
+}
+
+func confirmationRiskScore(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
+
+var (
+	riskPINScore = confirmationRiskScore("CONFIRMATION_RISK_PIN_SCORE", 40)
+	riskOTPScore = confirmationRiskScore("CONFIRMATION_RISK_OTP_SCORE", 60)
+)
+
+// ConfirmationCheck describes an outgoing operation for the policy
+type ConfirmationCheck struct {
+	Operation   string
+	UserID      string
+	Currency    string
+	Amount      decimal.Decimal
+	RecipientID string // transfers only
+}
+
+// ConfirmationRequirement is the policy's decision for one operation
+type ConfirmationRequirement struct {
+	Factors     []string `json:"required_confirmations"`
+	RiskScore   int      `json:"risk_score"`
+	RiskReasons []string `json:"risk_reasons"`
+}
+
+func (r ConfirmationRequirement) requires(factor string) bool {
+	for _, required := range r.Factors {
+		if required == factor {
+			return true
+		}
+	}
+	return false
+}
+
+// requiredConfirmations applies the policy to an operation
+func (s *Server) requiredConfirmations(check ConfirmationCheck) (ConfirmationRequirement, error) {
+	var kycLevel int
+	if err := s.db.QueryRow("SELECT COALESCE(kyc_level, 0) FROM users WHERE id = $1", check.UserID).Scan(&kycLevel); err != nil {
+		return ConfirmationRequirement{}, err
+	}
+
+	score, reasons := s.transactionRiskScore(check)
+	requirement := ConfirmationRequirement{Factors: []string{}, RiskScore: score, RiskReasons: reasons}
+	amountBOB := toLimitCurrency(check.Currency, check.Amount)
+
+	if check.Operation == OperationWithdrawal || transferNeedsPIN(check.Currency, check.Amount) || score >= riskPINScore {
+		requirement.Factors = append(requirement.Factors, ConfirmationPIN)
+	}
+
+	otpThreshold, ok := otpThresholdsBOB[kycLevel]
+	if !ok {
+		otpThreshold = defaultOTPThresholdsBOB[0]
+	}
+	if amountBOB.GreaterThanOrEqual(otpThreshold) || score >= riskOTPScore {
+		requirement.Factors = append(requirement.Factors, ConfirmationEmailOTP)
+	}
+
+	return requirement, nil
+}
+
+// transactionRiskScore adds up simple risk signals, 0 to 100
+func (s *Server) transactionRiskScore(check ConfirmationCheck) (int, []string) {
+	score := 0
+	reasons := []string{}
+	add := func(points int, reason string) {
+		score += points
+		reasons = append(reasons, reason)
+	}
+
+	var newAccount bool
+	var failedPINs int
+	s.db.QueryRow(`
+		SELECT created_at > NOW() - INTERVAL '7 days', COALESCE(pin_failed_count, 0)
+		FROM users WHERE id = $1
+	`, check.UserID).Scan(&newAccount, &failedPINs)
+	if newAccount {
+		add(30, "ACCOUNT_YOUNGER_THAN_7_DAYS")
+	}
+	if failedPINs > 0 {
+		add(20, "RECENT_WRONG_PIN")
+	}
+
+	var recentOutgoing int
+	s.db.QueryRow(`
+		SELECT COUNT(*) FROM transactions
+		WHERE user_id = $1 AND transaction_type IN ('WITHDRAWAL', 'TRANSFER_OUT')
+			AND created_at > NOW() - INTERVAL '1 hour'
+	`, check.UserID).Scan(&recentOutgoing)
+	if recentOutgoing >= 3 {
+		add(20, "MANY_RECENT_OUTGOING")
+	}
+
+	if check.Operation == OperationTransfer && check.RecipientID != "" {
+		var knownRecipient, newRecipient bool
+		s.db.QueryRow(`
+			SELECT EXISTS(
+				SELECT 1 FROM transactions
+				WHERE user_id = $1 AND transaction_type = 'TRANSFER_OUT' AND status = 'COMPLETED'
+					AND COALESCE(external_ref, payment_reference) = $2
+			)
+		`, check.UserID, check.RecipientID).Scan(&knownRecipient)
+		if !knownRecipient {
+			add(20, "NEW_COUNTERPARTY")
+		}
+		s.db.QueryRow(`SELECT created_at > NOW() - INTERVAL '7 days' FROM users WHERE id = $1`, check.RecipientID).Scan(&newRecipient)
+		if newRecipient {
+			add(20, "COUNTERPARTY_ACCOUNT_YOUNGER_THAN_7_DAYS")
+		}
+	}
+
+	if score > 100 {
+		score = 100
+	}
+	return score, reasons
+}
+
+// enforceConfirmations checks the proofs sent with an operation against the policy. When it
+// returns false the response has already been written.
+func (s *Server) enforceConfirmations(c *gin.Context, check ConfirmationCheck, pin, otp string) bool {
+	requirement, err := s.requiredConfirmations(check)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate confirmation policy"})
+		return false
+	}
+
+	// Tell the client everything it has to collect before checking any single proof
+	missing := []string{}
+	if requirement.requires(ConfirmationPIN) && pin == "" {
+		missing = append(missing, ConfirmationPIN)
+	}
+	if requirement.requires(ConfirmationEmailOTP) && otp == "" {
+		missing = append(missing, ConfirmationEmailOTP)
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":                  fmt.Sprintf("Confirmation required: %s", strings.Join(missing, ", ")),
+			"code":                   "CONFIRMATION_REQUIRED",
+			"required_confirmations": requirement.Factors,
+			"missing":                missing,
+			"risk_score":             requirement.RiskScore,
+		})
+		return false
+	}
+
+	if requirement.requires(ConfirmationPIN) && !s.verifyTransactionPIN(c, check.UserID, pin) {
+		return false
+	}
+	if requirement.requires(ConfirmationEmailOTP) && !s.verifyTransactionOTP(c, check, otp) {
+		return false
+	}
+	return true
+}
+
+// Handler previewing which confirmations an operation will need, so clients can prompt upfront
+func (s *Server) handleGetConfirmationRequirements(c *gin.Context) {
+	var req struct {
+		Operation   string  `json:"operation" binding:"required,oneof=WITHDRAWAL TRANSFER"`
+		Currency    string  `json:"currency" binding:"required"`
+		Amount      float64 `json:"amount" binding:"required,gt=0"`
+		RecipientID string  `json:"recipient_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	requirement, err := s.requiredConfirmations(ConfirmationCheck{
+		Operation:   req.Operation,
+		UserID:      c.GetString("user_id"),
+		Currency:    strings.ToUpper(req.Currency),
+		Amount:      decimal.NewFromFloat(req.Amount),
+		RecipientID: req.RecipientID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate confirmation policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, requirement)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// Currencies the platform trades, from SUPPORTED_CURRENCIES (default "USD,BOB,USDT"); the p2p
+// service reads the same variable to validate order pairs.
+
+const defaultSupportedCurrencies = "USD,BOB,USDT"
+
+func supportedCurrencies() []string {
+	value := os.Getenv("SUPPORTED_CURRENCIES")
+	if value == "" {
+		value = defaultSupportedCurrencies
+	}
+
+	var currencies []string
+	seen := make(map[string]bool)
+	for _, currency := range strings.Split(value, ",") {
+		currency = strings.ToUpper(strings.TrimSpace(currency))
+		if currency != "" && !seen[currency] {
+			seen[currency] = true
+			currencies = append(currencies, currency)
+		}
+	}
+	return currencies
+}
+
+func isSupportedCurrency(currency string) bool {
+	for _, supported := range supportedCurrencies() {
+		if supported == currency {
+			return true
+		}
+	}
+	return false
+}
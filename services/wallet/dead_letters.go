@@ -0,0 +1,415 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Dead letters keep the bank notifications and withdrawals that failed processing, with every
+// error seen. Notifications are retried by the poller until maxNotificationAttempts, then PARKED
+// and skipped; unmatched references and processor-rejected withdrawals are parked right away.
+// Operators replay parked items once the cause is fixed, or discard them with a reason.
+const (
+	DeadLetterBankNotification = "BANK_NOTIFICATION"
+	DeadLetterTransaction      = "TRANSACTION"
+
+	DeadLetterRetrying  = "RETRYING"
+	DeadLetterParked    = "PARKED"
+	DeadLetterReplaying = "REPLAYING"
+	DeadLetterRecovered = "RECOVERED"
+	DeadLetterReplayed  = "REPLAYED"
+	DeadLetterDiscarded = "DISCARDED"
+)
+
+const maxNotificationAttempts = 5
+
+// errUnmatchedNotification marks notifications whose reference matches no user or order;
+// retrying cannot help until someone fixes the reference or the account mapping
+var errUnmatchedNotification = errors.New("notification does not match any user")
+
+type DeadLetter struct {
+	ID              string                   `json:"id"`
+	Source          string                   `json:"source"`
+	ItemID          string                   `json:"item_id"`
+	Payload         map[string]interface{}   `json:"payload"`
+	Status          string                   `json:"status"`
+	Attempts        int                      `json:"attempts"`
+	LastError       string                   `json:"last_error"`
+	Errors          []map[string]interface{} `json:"errors"`
+	ResolvedBy      *string                  `json:"resolved_by,omitempty"`
+	ResolvedAt      *time.Time               `json:"resolved_at,omitempty"`
+	ResolutionNotes *string                  `json:"resolution_notes,omitempty"`
+	CreatedAt       time.Time                `json:"created_at"`
+	UpdatedAt       time.Time                `json:"updated_at"`
+}
+
+// recordDeadLetter stores a processing failure and returns the item's resulting status. Repeated
+// failures of the same item append to its error history; park moves it out of automatic retries.
+func recordDeadLetter(db *sql.DB, source, itemID string, payload interface{}, failure error, park bool) string {
+	payloadJSON, _ := json.Marshal(payload)
+	entryJSON, _ := json.Marshal([]map[string]interface{}{
+		{"at": time.Now().UTC(), "error": failure.Error()},
+	})
+
+	initialStatus := DeadLetterRetrying
+	if park {
+		initialStatus = DeadLetterParked
+	}
+
+	var status string
+	err := db.QueryRow(`
+		INSERT INTO dead_letters (source, item_id, payload, status, last_error, errors)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (source, item_id) DO UPDATE SET
+			payload = EXCLUDED.payload,
+			attempts = dead_letters.attempts + 1,
+			last_error = EXCLUDED.last_error,
+			errors = dead_letters.errors || EXCLUDED.errors,
+			status = CASE
+				WHEN dead_letters.status = 'DISCARDED' THEN 'DISCARDED'
+				WHEN $7 OR dead_letters.status IN ('PARKED', 'REPLAYING', 'REPLAYED')
+					OR dead_letters.attempts + 1 >= $8 THEN 'PARKED'
+				ELSE 'RETRYING'
+			END,
+			updated_at = NOW()
+		RETURNING status
+	`, source, itemID, string(payloadJSON), initialStatus, failure.Error(), string(entryJSON),
+		park, maxNotificationAttempts).Scan(&status)
+	if err != nil {
+		log.Printf("❌ Failed to dead-letter %s %s: %v", source, itemID, err)
+		return ""
+	}
+
+	if status == DeadLetterParked {
+		raiseSystemAlert(db, "WARNING", "wallet.dead_letter", "DEAD_LETTER",
+			"dead_letter:"+source+":"+itemID,
+			fmt.Sprintf("%s %s parked after failing: %v", source, itemID, failure),
+			map[string]interface{}{"source": source, "item_id": itemID, "error": failure.Error()})
+	}
+	return status
+}
+
+// isDeadLetterParked reports whether the poller must leave a notification for the operators
+func isDeadLetterParked(db *sql.DB, source, itemID string) bool {
+	var parked bool
+	db.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM dead_letters
+			WHERE source = $1 AND item_id = $2 AND status IN ('PARKED', 'REPLAYING', 'DISCARDED')
+		)
+	`, source, itemID).Scan(&parked)
+	return parked
+}
+
+// markDeadLetterRecovered closes a retrying item that went through on a later attempt
+func markDeadLetterRecovered(db *sql.DB, source, itemID string) {
+	db.Exec(`
+		UPDATE dead_letters SET status = 'RECOVERED', updated_at = NOW()
+		WHERE source = $1 AND item_id = $2 AND status = 'RETRYING'
+	`, source, itemID)
+}
+
+// recordAuditLog stores an admin action in audit_logs
+func (s *Server) recordAuditLog(c *gin.Context, userID, action, entityType, entityID string, details map[string]interface{}) {
+	s.recordAuditChange(c, userID, action, entityType, entityID, nil, details)
+}
+
+// recordAuditChange stores an admin action in audit_logs with the entity's values before it, if
+// it existed, and after it
+func (s *Server) recordAuditChange(c *gin.Context, userID, action, entityType, entityID string, before, after map[string]interface{}) {
+	var oldValues interface{}
+	if before != nil {
+		beforeJSON, _ := json.Marshal(before)
+		oldValues = string(beforeJSON)
+	}
+	afterJSON, _ := json.Marshal(after)
+	_, err := s.db.Exec(`
+		INSERT INTO audit_logs (user_id, action, entity_type, entity_id, old_values, new_values, ip_address, user_agent, service)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')::inet, $8, 'wallet')
+	`, userID, action, entityType, entityID, oldValues, string(afterJSON), c.ClientIP(), c.Request.UserAgent())
+
+	if err != nil {
+		log.Printf("⚠️ Failed to write audit log %s for %s %s: %v", action, entityType, entityID, err)
+		return
+	}
+
+	log.Printf("📝 Audit: %s by %s on %s %s", action, userID, entityType, entityID)
+}
+
+// Admin handler listing dead letters, parked ones by default, newest failures first
+func (s *Server) handleAdminGetDeadLetters(c *gin.Context) {
+	var conditions []string
+	var args []interface{}
+
+	status := strings.ToUpper(c.DefaultQuery("status", DeadLetterParked))
+	if status != "ALL" {
+		args = append(args, status)
+		conditions = append(conditions, "status = $"+strconv.Itoa(len(args)))
+	}
+	if source := strings.ToUpper(c.Query("source")); source != "" {
+		args = append(args, source)
+		conditions = append(conditions, "source = $"+strconv.Itoa(len(args)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	var total int
+	s.db.QueryRow("SELECT COUNT(*) FROM dead_letters "+where, args...).Scan(&total)
+
+	query := `
+		SELECT id, source, item_id, payload, status, attempts, last_error, errors,
+			resolved_by, resolved_at, resolution_notes, created_at, updated_at
+		FROM dead_letters ` + where +
+		fmt.Sprintf(" ORDER BY updated_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	rows, err := s.db.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get dead letters"})
+		return
+	}
+	defer rows.Close()
+
+	letters := []DeadLetter{}
+	for rows.Next() {
+		letter, err := scanDeadLetter(rows)
+		if err != nil {
+			continue
+		}
+		letters = append(letters, letter)
+	}
+
+	c.JSON(200, gin.H{
+		"status": "success",
+		"data":   letters,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func scanDeadLetter(rows *sql.Rows) (DeadLetter, error) {
+	var letter DeadLetter
+	var payloadJSON, errorsJSON string
+	var resolvedBy, resolutionNotes sql.NullString
+	var resolvedAt sql.NullTime
+	err := rows.Scan(&letter.ID, &letter.Source, &letter.ItemID, &payloadJSON, &letter.Status,
+		&letter.Attempts, &letter.LastError, &errorsJSON, &resolvedBy, &resolvedAt,
+		&resolutionNotes, &letter.CreatedAt, &letter.UpdatedAt)
+	if err != nil {
+		return letter, err
+	}
+
+	json.Unmarshal([]byte(payloadJSON), &letter.Payload)
+	json.Unmarshal([]byte(errorsJSON), &letter.Errors)
+	if resolvedBy.Valid {
+		letter.ResolvedBy = &resolvedBy.String
+	}
+	if resolvedAt.Valid {
+		letter.ResolvedAt = &resolvedAt.Time
+	}
+	if resolutionNotes.Valid {
+		letter.ResolutionNotes = &resolutionNotes.String
+	}
+	return letter, nil
+}
+
+// Admin handler re-running a dead letter after its cause was fixed
+func (s *Server) handleAdminReplayDeadLetter(c *gin.Context) {
+	letterID := c.Param("id")
+	adminID := c.GetString("user_id")
+
+	// Claiming the item first keeps two admins (or the poller) from processing it twice
+	var source, itemID, payloadJSON string
+	err := s.db.QueryRow(`
+		UPDATE dead_letters SET status = 'REPLAYING', updated_at = NOW()
+		WHERE id = $1 AND status IN ('RETRYING', 'PARKED')
+		RETURNING source, item_id, payload
+	`, letterID).Scan(&source, &itemID, &payloadJSON)
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "Dead letter not found or not replayable"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to replay dead letter"})
+		return
+	}
+
+	var result gin.H
+	switch source {
+	case DeadLetterBankNotification:
+		var notification BankNotification
+		if err = json.Unmarshal([]byte(payloadJSON), &notification); err == nil {
+			err = s.bankIntegration.processBankNotification(notification)
+		}
+		if err != nil {
+			recordDeadLetter(s.db, source, itemID, notification, err, true)
+		}
+		result = gin.H{"notification_id": itemID}
+	case DeadLetterTransaction:
+		// Withdrawal failures are recorded by the dispatch itself
+		result, err = s.replayFailedWithdrawal(itemID)
+	default:
+		err = fmt.Errorf("unknown dead letter source %s", source)
+	}
+
+	s.recordAuditLog(c, adminID, "DEAD_LETTER_REPLAY", "dead_letter", letterID, map[string]interface{}{
+		"source":  source,
+		"item_id": itemID,
+		"success": err == nil,
+	})
+
+	if err != nil {
+		requestLog(c).Printf("❌ Replay of %s %s by %s failed: %v", source, itemID, adminID, err)
+		c.JSON(422, gin.H{"error": err.Error(), "id": letterID, "status": DeadLetterParked})
+		return
+	}
+
+	s.db.Exec(`
+		UPDATE dead_letters SET status = 'REPLAYED', resolved_by = $2, resolved_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`, letterID, adminID)
+
+	requestLog(c).Printf("🔁 %s %s replayed by %s", source, itemID, adminID)
+
+	result["id"] = letterID
+	result["status"] = DeadLetterReplayed
+	c.JSON(200, gin.H{
+		"status": "success",
+		"data":   result,
+	})
+}
+
+// replayFailedWithdrawal locks the funds again and hands a FAILED withdrawal back to its processor
+func (s *Server) replayFailedWithdrawal(txID string) (gin.H, error) {
+	dbTx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer dbTx.Rollback()
+
+	tx := Transaction{ID: txID, Type: "WITHDRAWAL", Status: "PENDING"}
+	var metadataJSON string
+	err = dbTx.QueryRow(`
+		SELECT user_id, currency, amount, COALESCE(method, payment_method, ''), COALESCE(metadata, '{}'), created_at
+		FROM transactions
+		WHERE id = $1 AND transaction_type = 'WITHDRAWAL' AND status = 'FAILED'
+		FOR UPDATE
+	`, txID).Scan(&tx.UserID, &tx.Currency, &tx.Amount, &tx.Method, &metadataJSON, &tx.CreatedAt)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("withdrawal %s is no longer failed", txID)
+	}
+	if err != nil {
+		recordDeadLetter(s.db, DeadLetterTransaction, txID, gin.H{"transaction_id": txID}, err, true)
+		return nil, err
+	}
+	tx.Metadata = metadataJSON
+
+	result, err := dbTx.Exec(`
+		UPDATE wallets SET balance = balance - $1, locked_balance = locked_balance + $1, updated_at = NOW()
+		WHERE user_id = $2 AND currency = $3 AND balance >= $1
+	`, tx.Amount, tx.UserID, tx.Currency)
+	if err == nil {
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			err = fmt.Errorf("insufficient %s balance to replay withdrawal of %s", tx.Currency, tx.Amount.String())
+		}
+	}
+	if err == nil {
+		_, err = dbTx.Exec(`
+			UPDATE transactions SET status = 'PENDING', notes = NULL, updated_at = NOW()
+			WHERE id = $1
+		`, txID)
+	}
+	if err == nil {
+		err = dbTx.Commit()
+	}
+	if err != nil {
+		recordDeadLetter(s.db, DeadLetterTransaction, txID, withdrawalDeadLetterPayload(tx), err, true)
+		return nil, err
+	}
+
+	var destination map[string]interface{}
+	json.Unmarshal([]byte(metadataJSON), &destination)
+
+	response, status := s.dispatchWithdrawal(tx, destination)
+	if status >= 300 {
+		return nil, fmt.Errorf("%v", response["error"])
+	}
+	response["transaction_id"] = txID
+	return response, nil
+}
+
+func withdrawalDeadLetterPayload(tx Transaction) gin.H {
+	return gin.H{
+		"transaction_id": tx.ID,
+		"user_id":        tx.UserID,
+		"currency":       tx.Currency,
+		"amount":         tx.Amount.String(),
+		"method":         tx.Method,
+	}
+}
+
+// Admin handler closing a dead letter that will not be replayed; discarded notifications are
+// acknowledged so the bank listener stops serving them
+func (s *Server) handleAdminDiscardDeadLetter(c *gin.Context) {
+	letterID := c.Param("id")
+	adminID := c.GetString("user_id")
+
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "reason is required when discarding a dead letter"})
+		return
+	}
+
+	var source, itemID string
+	err := s.db.QueryRow(`
+		UPDATE dead_letters
+		SET status = 'DISCARDED', resolved_by = $2, resolved_at = NOW(), resolution_notes = $3, updated_at = NOW()
+		WHERE id = $1 AND status IN ('RETRYING', 'PARKED')
+		RETURNING source, item_id
+	`, letterID, adminID, req.Reason).Scan(&source, &itemID)
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "Dead letter not found or already closed"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to discard dead letter"})
+		return
+	}
+
+	if source == DeadLetterBankNotification {
+		s.bankIntegration.acknowledgeNotification(itemID)
+	}
+
+	s.recordAuditLog(c, adminID, "DEAD_LETTER_DISCARD", "dead_letter", letterID, map[string]interface{}{
+		"source":  source,
+		"item_id": itemID,
+		"reason":  req.Reason,
+	})
+	requestLog(c).Printf("🗑️ %s %s discarded by %s: %s", source, itemID, adminID, req.Reason)
+
+	c.JSON(200, gin.H{
+		"status": "success",
+		"data":   gin.H{"id": letterID, "status": DeadLetterDiscarded},
+	})
+}
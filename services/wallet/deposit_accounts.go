@@ -0,0 +1,220 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Admin management of the bank accounts shown in deposit instructions. Only one account per
+// currency is active at a time: activating or creating an account deactivates the previous one
+// in the same transaction, and a partial unique index backs this up.
+
+var depositAccountCurrencies = map[string]bool{"BOB": true, "USD": true}
+
+type DepositAccount struct {
+	ID            string    `json:"id"`
+	Currency      string    `json:"currency"`
+	BankName      string    `json:"bank_name"`
+	AccountNumber string    `json:"account_number"`
+	AccountHolder string    `json:"account_holder"`
+	IsActive      bool      `json:"is_active"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type CreateDepositAccountRequest struct {
+	Currency      string `json:"currency" binding:"required"`
+	BankName      string `json:"bank_name" binding:"required"`
+	AccountNumber string `json:"account_number" binding:"required"`
+	AccountHolder string `json:"account_holder" binding:"required"`
+	Active        *bool  `json:"is_active"`
+}
+
+const depositAccountColumns = `id, currency, bank, account_number, account_holder, COALESCE(is_active, false), created_at`
+
+func scanDepositAccount(row interface{ Scan(...interface{}) error }) (DepositAccount, error) {
+	var account DepositAccount
+	err := row.Scan(&account.ID, &account.Currency, &account.BankName, &account.AccountNumber,
+		&account.AccountHolder, &account.IsActive, &account.CreatedAt)
+	return account, err
+}
+
+// auditValues is the account as recorded in audit_logs
+func (a DepositAccount) auditValues() map[string]interface{} {
+	return map[string]interface{}{
+		"currency":       a.Currency,
+		"bank_name":      a.BankName,
+		"account_number": a.AccountNumber,
+		"account_holder": a.AccountHolder,
+		"is_active":      a.IsActive,
+	}
+}
+
+func (s *Server) handleAdminGetDepositAccounts(c *gin.Context) {
+	rows, err := s.db.Query(`SELECT ` + depositAccountColumns + ` FROM deposit_accounts ORDER BY currency, created_at DESC`)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load deposit accounts"})
+		return
+	}
+	defer rows.Close()
+
+	accounts := []DepositAccount{}
+	for rows.Next() {
+		if account, err := scanDepositAccount(rows); err == nil {
+			accounts = append(accounts, account)
+		}
+	}
+
+	c.JSON(200, gin.H{
+		"status": "success",
+		"data":   accounts,
+	})
+}
+
+func (s *Server) handleAdminCreateDepositAccount(c *gin.Context) {
+	var req CreateDepositAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if !depositAccountCurrencies[currency] {
+		c.JSON(400, gin.H{"error": "Deposit accounts are only supported for BOB and USD"})
+		return
+	}
+	accountNumber := strings.TrimSpace(req.AccountNumber)
+	bankName := strings.TrimSpace(req.BankName)
+	accountHolder := strings.TrimSpace(req.AccountHolder)
+	if accountNumber == "" || bankName == "" || accountHolder == "" {
+		c.JSON(400, gin.H{"error": "Bank name, account number and account holder cannot be empty"})
+		return
+	}
+	active := req.Active == nil || *req.Active
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create deposit account"})
+		return
+	}
+	defer tx.Rollback()
+
+	if active {
+		if err := deactivateDepositAccounts(tx, currency); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to update existing deposit accounts"})
+			return
+		}
+	}
+
+	account, err := scanDepositAccount(tx.QueryRow(`
+		INSERT INTO deposit_accounts (currency, bank, account_number, account_holder, is_active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+depositAccountColumns, currency, bankName, accountNumber, accountHolder, active))
+	if err != nil {
+		requestLog(c).Printf("❌ Failed to create deposit account: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to create deposit account"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create deposit account"})
+		return
+	}
+
+	requestLog(c).Printf("🏦 Deposit account %s created for %s by admin %s", account.ID, currency, c.GetString("user_id"))
+	s.recordAuditChange(c, c.GetString("user_id"), "DEPOSIT_ACCOUNT_CREATE", "deposit_account", account.ID, nil, account.auditValues())
+	c.JSON(201, gin.H{
+		"status":  "success",
+		"message": "Deposit account created successfully",
+		"data":    account,
+	})
+}
+
+func (s *Server) handleAdminToggleDepositAccount(c *gin.Context) {
+	accountID := c.Param("id")
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to update deposit account"})
+		return
+	}
+	defer tx.Rollback()
+
+	var currency string
+	var active bool
+	err = tx.QueryRow(`
+		SELECT currency, COALESCE(is_active, false) FROM deposit_accounts WHERE id::text = $1 FOR UPDATE
+	`, accountID).Scan(&currency, &active)
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "Deposit account not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to update deposit account"})
+		return
+	}
+
+	if !active {
+		if err := deactivateDepositAccounts(tx, currency); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to update existing deposit accounts"})
+			return
+		}
+	}
+
+	account, err := scanDepositAccount(tx.QueryRow(`
+		UPDATE deposit_accounts SET is_active = $1, updated_at = NOW()
+		WHERE id::text = $2
+		RETURNING `+depositAccountColumns, !active, accountID))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to update deposit account"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to update deposit account"})
+		return
+	}
+
+	requestLog(c).Printf("🏦 Deposit account %s set active=%t by admin %s", accountID, account.IsActive, c.GetString("user_id"))
+	before := account.auditValues()
+	before["is_active"] = active
+	s.recordAuditChange(c, c.GetString("user_id"), "DEPOSIT_ACCOUNT_TOGGLE", "deposit_account", account.ID, before, account.auditValues())
+	c.JSON(200, gin.H{
+		"status": "success",
+		"data":   account,
+	})
+}
+
+func (s *Server) handleAdminDeleteDepositAccount(c *gin.Context) {
+	accountID := c.Param("id")
+
+	account, err := scanDepositAccount(s.db.QueryRow(`
+		DELETE FROM deposit_accounts WHERE id::text = $1
+		RETURNING `+depositAccountColumns, accountID))
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "Deposit account not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to delete deposit account"})
+		return
+	}
+
+	requestLog(c).Printf("🗑️ Deposit account %s deleted by admin %s", accountID, c.GetString("user_id"))
+	s.recordAuditChange(c, c.GetString("user_id"), "DEPOSIT_ACCOUNT_DELETE", "deposit_account", account.ID, account.auditValues(), nil)
+	c.JSON(200, gin.H{
+		"status":  "success",
+		"message": "Deposit account deleted successfully",
+	})
+}
+
+// deactivateDepositAccounts retires the active account of a currency before another takes its place
+func deactivateDepositAccounts(tx *sql.Tx, currency string) error {
+	_, err := tx.Exec(`
+		UPDATE deposit_accounts SET is_active = FALSE, updated_at = NOW()
+		WHERE currency = $1 AND is_active = TRUE
+	`, currency)
+	return err
+}
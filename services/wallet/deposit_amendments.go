@@ -0,0 +1,138 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// A deposit that is still waiting for the transfer can change its amount or currency. It gets a
+// fresh reference and instructions; the old reference stops matching, so a transfer sent with it
+// is not credited against the amended deposit and ends up in manual review like any unknown one.
+
+type AmendDepositRequest struct {
+	Currency string  `json:"currency"`
+	Amount   float64 `json:"amount" binding:"gte=0"`
+}
+
+func (s *Server) handleAmendDeposit(c *gin.Context) {
+	txID := c.Param("id")
+	userID := c.GetString("user_id")
+
+	var req AmendDepositRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Currency == "" && req.Amount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount or currency is required"})
+		return
+	}
+
+	dbTx, err := s.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer dbTx.Rollback()
+
+	// Locking the row keeps a bank notification for the old reference from completing it mid-amend
+	var tx Transaction
+	var oldReference, fundingOrderID sql.NullString
+	err = dbTx.QueryRow(`
+		SELECT id, user_id, currency, amount, status, COALESCE(method, payment_method, ''),
+			deposit_reference, funding_order_id::text, created_at
+		FROM transactions
+		WHERE id = $1 AND user_id = $2 AND transaction_type = 'DEPOSIT'
+		FOR UPDATE
+	`, txID, userID).Scan(&tx.ID, &tx.UserID, &tx.Currency, &tx.Amount, &tx.Status, &tx.Method,
+		&oldReference, &fundingOrderID, &tx.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deposit not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load deposit"})
+		return
+	}
+
+	// PROCESSING means a transfer was already matched to the current reference
+	if tx.Status != "PENDING" {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Only deposits waiting for the transfer can be amended",
+			"status": tx.Status,
+		})
+		return
+	}
+
+	if tx.Method != "BANK" && tx.Method != "QR" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only BANK and QR deposits can be amended"})
+		return
+	}
+
+	if req.Currency != "" {
+		tx.Currency = strings.ToUpper(req.Currency)
+	}
+	if req.Amount > 0 {
+		tx.Amount = decimal.NewFromFloat(req.Amount)
+	}
+
+	if !s.enforceKYCLimits(c, userID, tx.Currency, tx.Amount) {
+		return
+	}
+	if fundingOrderID.Valid {
+		if err := validateFundingOrder(dbTx, userID, fundingOrderID.String, tx.Currency, tx.Amount); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	tx.Reference, err = nextDepositReference(dbTx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to amend deposit"})
+		return
+	}
+
+	// Superseded references are kept in the metadata so support can trace late transfers
+	_, err = dbTx.Exec(`
+		UPDATE transactions
+		SET currency = $2, amount = $3, deposit_reference = $4, external_ref = '', updated_at = NOW(),
+			metadata = jsonb_set(COALESCE(metadata, '{}'::jsonb), '{superseded_references}',
+				COALESCE(metadata->'superseded_references', '[]'::jsonb) || to_jsonb($5::text))
+		WHERE id = $1
+	`, tx.ID, tx.Currency, tx.Amount, tx.Reference, oldReference.String)
+	if err != nil {
+		requestLog(c).Printf("❌ Error amending deposit %s: %v", tx.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to amend deposit"})
+		return
+	}
+
+	if err = dbTx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	requestLog(c).Printf("✏️ Deposit %s amended by %s: %s %s, reference %s -> %s",
+		tx.ID, userID, tx.Amount.String(), tx.Currency, oldReference.String, tx.Reference)
+
+	// Regenerate the instructions for the new reference the same way the deposit was started
+	var response gin.H
+	if tx.Method == "QR" {
+		response = s.processQRDeposit(tx)
+	} else {
+		response = s.processBankDeposit(tx)
+	}
+
+	response["transaction_id"] = tx.ID
+	response["reference"] = tx.Reference
+	response["previous_reference"] = oldReference.String
+	response["amount"] = tx.Amount
+	response["currency"] = tx.Currency
+	if fundingOrderID.Valid {
+		response["funding_order_id"] = fundingOrderID.String
+	}
+	c.JSON(http.StatusOK, response)
+}
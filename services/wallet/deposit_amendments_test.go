@@ -0,0 +1,127 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+var amendDepositColumns = []string{"id", "user_id", "currency", "amount", "status", "method",
+	"deposit_reference", "funding_order_id", "created_at"}
+
+const amendDepositQuery = `FROM transactions\s+WHERE id = \$1 AND user_id = \$2 AND transaction_type = 'DEPOSIT'\s+FOR UPDATE`
+
+func amendTestDeposit(s *Server, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPatch, "/deposits/tx-1", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "id", Value: "tx-1"}}
+	c.Set("user_id", "user-1")
+	s.handleAmendDeposit(c)
+	return w
+}
+
+func TestAmendDeposit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	amount := decimal.RequireFromString("250")
+	mock.ExpectBegin()
+	mock.ExpectQuery(amendDepositQuery).WithArgs("tx-1", "user-1").WillReturnRows(sqlmock.NewRows(amendDepositColumns).
+		AddRow("tx-1", "user-1", "BOB", "100", "PENDING", "BANK", "DEP-0000123-2", nil, time.Now()))
+	mock.ExpectQuery(`LEFT JOIN kyc_currency_requirements`).WithArgs("user-1", "USD").
+		WillReturnRows(sqlmock.NewRows([]string{"kyc_level", "min_kyc_level"}).AddRow(1, 0))
+	mock.ExpectQuery(`SELECT COALESCE\(kyc_level, 0\) FROM users`).WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"kyc_level"}).AddRow(1))
+	mock.ExpectQuery(`FROM kyc_level_limits`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(kycLimitColumns).AddRow("BOB", nil, nil, nil))
+	mock.ExpectQuery(`SELECT nextval\('deposit_reference_seq'\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(1372))
+	mock.ExpectExec(`UPDATE transactions\s+SET currency = \$2, amount = \$3, deposit_reference = \$4.*superseded_references`).
+		WithArgs("tx-1", "USD", amount, "DEP-0000124-9", "DEP-0000123-2").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`FROM deposit_accounts`).WithArgs("USD").
+		WillReturnRows(sqlmock.NewRows([]string{"account_number", "bank", "account_holder"}).AddRow("1000-1", "BNB", "P2P Bolivia"))
+	mock.ExpectExec(`UPDATE transactions SET external_ref = \$1`).WithArgs("DEP-0000124-9", "tx-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w := amendTestDeposit(&Server{db: db, bankIntegration: &BankIntegration{db: db}}, `{"currency":"usd","amount":250}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	var response struct {
+		Reference         string `json:"reference"`
+		PreviousReference string `json:"previous_reference"`
+		Currency          string `json:"currency"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Reference != "DEP-0000124-9" || response.PreviousReference != "DEP-0000123-2" || response.Currency != "USD" {
+		t.Errorf("response = %+v, want the new USD reference and the old one", response)
+	}
+}
+
+func TestAmendDepositRefusals(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		status     string
+		method     string
+		missing    bool
+		wantStatus int
+	}{
+		{name: "nothing to change", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "negative amount", body: `{"amount":-5}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown deposit", body: `{"amount":50}`, missing: true, wantStatus: http.StatusNotFound},
+		{name: "transfer already matched", body: `{"amount":50}`, status: "PROCESSING", method: "BANK", wantStatus: http.StatusConflict},
+		{name: "completed", body: `{"amount":50}`, status: "COMPLETED", method: "QR", wantStatus: http.StatusConflict},
+		{name: "crypto deposit", body: `{"amount":50}`, status: "PENDING", method: "CRYPTO", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			if tt.missing || tt.status != "" {
+				mock.ExpectBegin()
+				query := mock.ExpectQuery(amendDepositQuery).WithArgs("tx-1", "user-1")
+				if tt.missing {
+					query.WillReturnError(sql.ErrNoRows)
+				} else {
+					query.WillReturnRows(sqlmock.NewRows(amendDepositColumns).
+						AddRow("tx-1", "user-1", "BOB", "100", tt.status, tt.method, "DEP-0000123-2", nil, time.Now()))
+				}
+				mock.ExpectRollback()
+			}
+
+			w := amendTestDeposit(&Server{db: db}, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			// Nothing is written for a refused amendment
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
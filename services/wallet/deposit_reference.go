@@ -0,0 +1,80 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Deposit references are what users type in the bank transfer concept, so they must be short,
+// unique and resistant to typos. They come from a database sequence (safe under concurrency),
+// encoded in base 36 with a check character, e.g. DEP-00001AK-7. The prefix is configurable
+// with DEPOSIT_REFERENCE_PREFIX.
+
+const depositReferenceAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// Minimum number of base 36 digits in the sequence part
+const depositReferenceWidth = 7
+
+func depositReferencePrefix() string {
+	if prefix := strings.ToUpper(strings.TrimSpace(os.Getenv("DEPOSIT_REFERENCE_PREFIX"))); prefix != "" {
+		return prefix
+	}
+	return "DEP"
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// nextDepositReference takes the next value of deposit_reference_seq and formats it
+func nextDepositReference(db queryRower) (string, error) {
+	var seq int64
+	if err := db.QueryRow(`SELECT nextval('deposit_reference_seq')`).Scan(&seq); err != nil {
+		return "", fmt.Errorf("failed to allocate deposit reference: %v", err)
+	}
+	return formatDepositReference(seq), nil
+}
+
+func formatDepositReference(seq int64) string {
+	code := strings.ToUpper(fmt.Sprintf("%0*s", depositReferenceWidth, encodeBase36(seq)))
+	return fmt.Sprintf("%s-%s-%c", depositReferencePrefix(), code, depositReferenceCheck(code))
+}
+
+func encodeBase36(n int64) string {
+	if n == 0 {
+		return "0"
+	}
+	var out []byte
+	for n > 0 {
+		out = append([]byte{depositReferenceAlphabet[n%36]}, out...)
+		n /= 36
+	}
+	return string(out)
+}
+
+// depositReferenceCheck is a weighted mod 36 checksum, catching every swap of neighbouring characters
+// and most single character typos
+func depositReferenceCheck(code string) byte {
+	sum := 0
+	for i, ch := range code {
+		sum += (i + 1) * strings.IndexRune(depositReferenceAlphabet, ch)
+	}
+	return depositReferenceAlphabet[sum%36]
+}
+
+// isDepositReference reports whether ref looks like a well formed reference with a valid check character
+func isDepositReference(ref string) bool {
+	parts := strings.Split(ref, "-")
+	if len(parts) != 3 || parts[0] != depositReferencePrefix() || len(parts[2]) != 1 || len(parts[1]) < depositReferenceWidth {
+		return false
+	}
+	for _, ch := range parts[1] {
+		if !strings.ContainsRune(depositReferenceAlphabet, ch) {
+			return false
+		}
+	}
+	return depositReferenceCheck(parts[1]) == parts[2][0]
+}
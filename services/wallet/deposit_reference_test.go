@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestFormatDepositReference(t *testing.T) {
+	tests := []struct {
+		seq  int64
+		want string
+	}{
+		{0, "DEP-0000000-0"},
+		{1, "DEP-0000001-7"},
+		{1371, "DEP-0000123-2"},
+		{78364164095, "DEP-ZZZZZZZ-8"},
+		{78364164096, "DEP-10000000-1"}, // grows past the minimum width instead of wrapping
+	}
+
+	for _, tt := range tests {
+		if got := formatDepositReference(tt.seq); got != tt.want {
+			t.Errorf("formatDepositReference(%d) = %s, want %s", tt.seq, got, tt.want)
+		}
+		if !isDepositReference(tt.want) {
+			t.Errorf("isDepositReference(%s) = false", tt.want)
+		}
+	}
+}
+
+func TestDepositReferencePrefix(t *testing.T) {
+	t.Setenv("DEPOSIT_REFERENCE_PREFIX", " bol ")
+	ref := formatDepositReference(1)
+	if ref != "BOL-0000001-7" {
+		t.Fatalf("formatDepositReference(1) = %s, want BOL-0000001-7", ref)
+	}
+	if isDepositReference("DEP-0000001-7") {
+		t.Error("reference with another prefix accepted")
+	}
+}
+
+func TestIsDepositReferenceRejectsMalformed(t *testing.T) {
+	for _, ref := range []string{
+		"",
+		"DEP-0000123",
+		"DEP-000123-2",   // shorter than the minimum width
+		"DEP-0000123-22", // check is one character
+		"dep-0000123-2",  // references are upper case
+		"DEP-00001a3-2",  // outside the alphabet
+		"DEP-0000-123-2", // extra dash
+		"DEP-0000123-3",  // wrong check
+		"DEP-0000213-2",  // swapped digits
+		"DEP-0000124-2",  // single typo
+	} {
+		if isDepositReference(ref) {
+			t.Errorf("isDepositReference(%q) = true", ref)
+		}
+	}
+}
+
+func TestDepositReferenceCheckCatchesTypos(t *testing.T) {
+	code := "00A1K7Z"
+	check := depositReferenceCheck(code)
+
+	// Every swap of two different neighbouring characters changes the check
+	for i := 0; i+1 < len(code); i++ {
+		swapped := []byte(code)
+		swapped[i], swapped[i+1] = swapped[i+1], swapped[i]
+		if swapped[i] != swapped[i+1] && depositReferenceCheck(string(swapped)) == check {
+			t.Errorf("swap at %d not caught: %s", i, swapped)
+		}
+	}
+
+	// Positions weighted 2, 3, 4 and 6 share factors with 36, so a few single typos there slip through
+	var typos, caught int
+	for i := range code {
+		for _, ch := range []byte(depositReferenceAlphabet) {
+			if ch == code[i] {
+				continue
+			}
+			typo := []byte(code)
+			typo[i] = ch
+			typos++
+			if depositReferenceCheck(string(typo)) != check {
+				caught++
+			} else if i%4 == 0 || i == 6 {
+				t.Errorf("typo at position %d not caught: %s", i+1, typo)
+			}
+		}
+	}
+	if caught*100 < typos*95 {
+		t.Errorf("caught %d of %d single character typos, want at least 95%%", caught, typos)
+	}
+}
+
+func TestNextDepositReference(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT nextval\('deposit_reference_seq'\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(1371))
+
+	ref, err := nextDepositReference(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref != "DEP-0000123-2" {
+		t.Errorf("nextDepositReference() = %s, want DEP-0000123-2", ref)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// anyDisputeSQL matches matchDisputedCondition: a dispute of any status on either order
+const anyDisputeSQL = `SELECT 1 FROM disputes d WHERE d\.order_id IN \(m\.buy_order_id, m\.sell_order_id\)\s*\)`
+
+func TestCheckEscrowReleasesLeavesDisputedMatches(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	bi := &BankIntegration{db: db}
+
+	// The scan leaves out matches with any dispute, resolved ones included
+	mock.ExpectQuery(`WHERE m\.status = 'PENDING'[\s\S]*AND NOT \(\s*bo\.status = 'DISPUTED' OR so\.status = 'DISPUTED' OR EXISTS \(\s*` + anyDisputeSQL).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "amount", "rate", "currency_from", "seller_id"}).
+			AddRow("match-1", "100", "6.90", "BOB", "seller-1"))
+	// The dispute was resolved in the buyer's favour after the scan: the seller is not credited
+	mock.ExpectBegin()
+	mock.ExpectQuery(anyDisputeSQL + `[\s\S]*FOR UPDATE OF m`).WithArgs("match-1").
+		WillReturnRows(sqlmock.NewRows([]string{"disputed"}).AddRow(true))
+	mock.ExpectRollback()
+
+	bi.checkEscrowReleases()
+	// Any credit, dust or alert statement fails the mock
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
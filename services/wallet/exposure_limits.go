@@ -0,0 +1,358 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// Daily exposure limits cap how much value may leave per calendar day, per user and for the whole
+// platform, on top of the KYC limits. Net outflow is what went out minus what came in today, in BOB:
+// for a user, withdrawals and outgoing transfers minus deposits and incoming transfers; for the
+// platform, withdrawals minus deposits (transfers stay inside). Withdrawals count from the moment
+// they are requested, so in-flight ones hold their share of the cap. 0 disables a limit.
+type ExposureLimits struct {
+	UserDailyNetOutflow   decimal.Decimal
+	GlobalDailyNetOutflow decimal.Decimal
+}
+
+func loadExposureLimits() ExposureLimits {
+	limits := ExposureLimits{UserDailyNetOutflow: decimal.Zero, GlobalDailyNetOutflow: decimal.Zero}
+	if value, err := decimal.NewFromString(os.Getenv("EXPOSURE_USER_DAILY_NET_OUTFLOW_BOB")); err == nil && value.IsPositive() {
+		limits.UserDailyNetOutflow = value
+	}
+	if value, err := decimal.NewFromString(os.Getenv("EXPOSURE_GLOBAL_DAILY_NET_OUTFLOW_BOB")); err == nil && value.IsPositive() {
+		limits.GlobalDailyNetOutflow = value
+	}
+	return limits
+}
+
+var exposureLimits = loadExposureLimits()
+
+// Overrides granted by admins last at most this long
+const maxExposureOverrideHours = 72
+
+// Statuses that still hold (or already moved) an outgoing amount
+const exposureOutflowStatuses = `'PENDING', 'PROCESSING', 'COMPLETED', 'PENDING_APPROVAL'`
+
+// ExposureLimitError describes which daily exposure limit an operation would exceed
+type ExposureLimitError struct {
+	Scope     string          `json:"scope"` // USER, GLOBAL
+	Max       decimal.Decimal `json:"max"`
+	Used      decimal.Decimal `json:"net_outflow"`
+	Requested decimal.Decimal `json:"requested"`
+	Currency  string          `json:"limit_currency"`
+}
+
+func (e *ExposureLimitError) Error() string {
+	if e.Scope == "GLOBAL" {
+		return "The platform reached its daily outflow limit, withdrawals and transfers resume tomorrow"
+	}
+	return fmt.Sprintf("daily net outflow limit exceeded: used %s + requested %s exceeds %s %s",
+		e.Used.StringFixed(2), e.Requested.StringFixed(2), e.Max.StringFixed(2), e.Currency)
+}
+
+// dailyNetOutflow sums today's net outflow in BOB for a user, or for the platform when userID is empty
+func dailyNetOutflow(q limitQuerier, userID string) (decimal.Decimal, error) {
+	total := decimal.Zero
+
+	query := fmt.Sprintf(`
+		SELECT t.currency,
+			COALESCE(SUM(t.amount) FILTER (WHERE COALESCE(t.transaction_type, t.type) IN ('WITHDRAWAL', 'TRANSFER_OUT')
+				AND t.status IN (%s)), 0),
+			COALESCE(SUM(t.amount) FILTER (WHERE COALESCE(t.transaction_type, t.type) IN ('DEPOSIT', 'TRANSFER_IN')
+				AND t.status = 'COMPLETED'), 0)
+		FROM transactions t
+		WHERE t.user_id = $1
+			AND COALESCE(t.method, '') <> 'INTERNAL'
+			AND t.created_at >= date_trunc('day', NOW())
+		GROUP BY t.currency
+	`, exposureOutflowStatuses)
+	args := []interface{}{userID}
+	if userID == "" {
+		query = fmt.Sprintf(`
+			SELECT t.currency,
+				COALESCE(SUM(t.amount) FILTER (WHERE COALESCE(t.transaction_type, t.type) = 'WITHDRAWAL'
+					AND t.status IN (%s)), 0),
+				COALESCE(SUM(t.amount) FILTER (WHERE COALESCE(t.transaction_type, t.type) = 'DEPOSIT'
+					AND t.status = 'COMPLETED'), 0)
+			FROM transactions t
+			JOIN users u ON u.id = t.user_id
+			WHERE COALESCE(u.is_sandbox, false) = false
+				AND COALESCE(t.method, '') <> 'INTERNAL'
+				AND t.created_at >= date_trunc('day', NOW())
+			GROUP BY t.currency
+		`, exposureOutflowStatuses)
+		args = nil
+	}
+
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var currency string
+		var outflow, inflow decimal.Decimal
+		if err := rows.Scan(&currency, &outflow, &inflow); err != nil {
+			return total, err
+		}
+		total = total.Add(toLimitCurrency(currency, outflow.Sub(inflow)))
+	}
+
+	return total, rows.Err()
+}
+
+// hasExposureOverride reports whether an admin let the user through the exposure limits for now
+func hasExposureOverride(q limitQuerier, userID string) (bool, error) {
+	var active bool
+	err := q.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM exposure_overrides
+			WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		)
+	`, userID).Scan(&active)
+	return active, err
+}
+
+// checkExposureLimits returns an *ExposureLimitError when the outflow would breach a daily limit.
+// Transfers do not move the platform's net outflow, but they stop as well once it is over the limit.
+func checkExposureLimits(q limitQuerier, operation, userID, currency string, amount decimal.Decimal) error {
+	limits := exposureLimits
+	if limits.UserDailyNetOutflow.IsZero() && limits.GlobalDailyNetOutflow.IsZero() {
+		return nil
+	}
+
+	overridden, err := hasExposureOverride(q, userID)
+	if err != nil {
+		return err
+	}
+	if overridden {
+		return nil
+	}
+
+	requested := toLimitCurrency(currency, amount)
+
+	if limits.UserDailyNetOutflow.IsPositive() {
+		used, err := dailyNetOutflow(q, userID)
+		if err != nil {
+			return err
+		}
+		if used.Add(requested).GreaterThan(limits.UserDailyNetOutflow) {
+			return &ExposureLimitError{Scope: "USER", Max: limits.UserDailyNetOutflow,
+				Used: used, Requested: requested, Currency: "BOB"}
+		}
+	}
+
+	if limits.GlobalDailyNetOutflow.IsPositive() {
+		used, err := dailyNetOutflow(q, "")
+		if err != nil {
+			return err
+		}
+		globalRequested := decimal.Zero
+		if operation == OperationWithdrawal {
+			globalRequested = requested
+		}
+		if used.Add(globalRequested).GreaterThan(limits.GlobalDailyNetOutflow) ||
+			used.GreaterThanOrEqual(limits.GlobalDailyNetOutflow) {
+			return &ExposureLimitError{Scope: "GLOBAL", Max: limits.GlobalDailyNetOutflow,
+				Used: used, Requested: requested, Currency: "BOB"}
+		}
+	}
+
+	return nil
+}
+
+// enforceExposureLimits writes the error response when a daily limit is hit; returns false if the
+// request must stop. A user over their cap gets 403, a platform-wide halt 503 until midnight.
+func (s *Server) enforceExposureLimits(c *gin.Context, operation, userID, currency string, amount decimal.Decimal) bool {
+	err := checkExposureLimits(s.db, operation, userID, currency, amount)
+	if err == nil {
+		return true
+	}
+
+	if limitErr, ok := err.(*ExposureLimitError); ok {
+		if limitErr.Scope == "GLOBAL" {
+			requestLog(c).Printf("🛑 Global daily outflow limit reached: %s + %s > %s BOB (user %s)",
+				limitErr.Used.StringFixed(2), limitErr.Requested.StringFixed(2), limitErr.Max.StringFixed(2), userID)
+			now := time.Now()
+			midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+			c.Header("Retry-After", strconv.Itoa(int(midnight.Sub(now).Seconds())))
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": limitErr.Error(),
+				"code":  "GLOBAL_EXPOSURE_LIMIT",
+			})
+			return false
+		}
+
+		requestLog(c).Printf("🚫 User %s reached the daily net outflow limit", userID)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   limitErr.Error(),
+			"code":    "DAILY_EXPOSURE_LIMIT",
+			"details": limitErr,
+		})
+		return false
+	}
+
+	log.Printf("❌ Failed to check exposure limits for user %s: %v", userID, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify exposure limits"})
+	return false
+}
+
+type ExposureOverride struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	Email     string     `json:"email"`
+	GrantedBy string     `json:"granted_by"`
+	Reason    string     `json:"reason"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Admin handler showing today's platform net outflow against the limits, plus active overrides
+func (s *Server) handleAdminGetExposure(c *gin.Context) {
+	globalOutflow, err := dailyNetOutflow(s.db, "")
+	if err != nil {
+		log.Printf("❌ Failed to compute global net outflow: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to compute exposure"})
+		return
+	}
+
+	rows, err := s.db.Query(`
+		SELECT o.id, o.user_id, COALESCE(u.email, ''), o.granted_by, o.reason, o.expires_at, o.created_at
+		FROM exposure_overrides o
+		LEFT JOIN users u ON u.id = o.user_id
+		WHERE o.revoked_at IS NULL AND o.expires_at > NOW()
+		ORDER BY o.expires_at ASC
+	`)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get exposure overrides"})
+		return
+	}
+	defer rows.Close()
+
+	overrides := []ExposureOverride{}
+	for rows.Next() {
+		var o ExposureOverride
+		if err := rows.Scan(&o.ID, &o.UserID, &o.Email, &o.GrantedBy, &o.Reason, &o.ExpiresAt, &o.CreatedAt); err != nil {
+			continue
+		}
+		overrides = append(overrides, o)
+	}
+
+	globalReached := exposureLimits.GlobalDailyNetOutflow.IsPositive() &&
+		globalOutflow.GreaterThanOrEqual(exposureLimits.GlobalDailyNetOutflow)
+	data := gin.H{
+		"limit_currency":               "BOB",
+		"user_daily_net_outflow_max":   exposureLimits.UserDailyNetOutflow,
+		"global_daily_net_outflow":     globalOutflow,
+		"global_daily_net_outflow_max": exposureLimits.GlobalDailyNetOutflow,
+		"global_limit_reached":         globalReached,
+		"overrides":                    overrides,
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		userOutflow, err := dailyNetOutflow(s.db, userID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to compute exposure"})
+			return
+		}
+		data["user_id"] = userID
+		data["user_daily_net_outflow"] = userOutflow
+	}
+
+	c.JSON(200, gin.H{
+		"status": "success",
+		"data":   data,
+	})
+}
+
+// Admin handler letting a user past the exposure limits for a few hours
+func (s *Server) handleAdminCreateExposureOverride(c *gin.Context) {
+	adminID := c.GetString("user_id")
+
+	var req struct {
+		UserID string `json:"user_id" binding:"required"`
+		Reason string `json:"reason" binding:"required"`
+		Hours  int    `json:"hours"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "user_id and reason are required"})
+		return
+	}
+	if req.Hours == 0 {
+		req.Hours = 24
+	}
+	if req.Hours < 0 || req.Hours > maxExposureOverrideHours {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("hours must be between 1 and %d", maxExposureOverrideHours)})
+		return
+	}
+
+	var o ExposureOverride
+	err := s.db.QueryRow(`
+		INSERT INTO exposure_overrides (user_id, granted_by, reason, expires_at)
+		SELECT id, $2, $3, NOW() + make_interval(hours => $4) FROM users WHERE id = $1
+		RETURNING id, user_id, granted_by, reason, expires_at, created_at
+	`, req.UserID, adminID, req.Reason, req.Hours).Scan(&o.ID, &o.UserID, &o.GrantedBy, &o.Reason, &o.ExpiresAt, &o.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create exposure override"})
+		return
+	}
+
+	requestLog(c).Printf("🔓 Exposure limits overridden for user %s until %s by %s: %s",
+		o.UserID, o.ExpiresAt.Format(time.RFC3339), adminID, o.Reason)
+	s.recordAuditChange(c, adminID, "EXPOSURE_OVERRIDE_CREATE", "exposure_override", o.ID, nil, map[string]interface{}{
+		"user_id":    o.UserID,
+		"reason":     o.Reason,
+		"expires_at": o.ExpiresAt,
+	})
+
+	c.JSON(201, gin.H{
+		"status": "success",
+		"data":   o,
+	})
+}
+
+// Admin handler ending an override before it expires
+func (s *Server) handleAdminRevokeExposureOverride(c *gin.Context) {
+	adminID := c.GetString("user_id")
+
+	var o ExposureOverride
+	var revokedAt time.Time
+	err := s.db.QueryRow(`
+		UPDATE exposure_overrides SET revoked_by = $2, revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL
+		RETURNING id, user_id, granted_by, reason, expires_at, revoked_at, created_at
+	`, c.Param("id"), adminID).Scan(&o.ID, &o.UserID, &o.GrantedBy, &o.Reason, &o.ExpiresAt, &revokedAt, &o.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "Override not found or already revoked"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to revoke exposure override"})
+		return
+	}
+	o.RevokedAt = &revokedAt
+
+	requestLog(c).Printf("🔒 Exposure override %s for user %s revoked by %s", o.ID, o.UserID, adminID)
+	s.recordAuditChange(c, adminID, "EXPOSURE_OVERRIDE_REVOKE", "exposure_override", o.ID,
+		map[string]interface{}{"user_id": o.UserID, "expires_at": o.ExpiresAt, "revoked_at": nil},
+		map[string]interface{}{"user_id": o.UserID, "expires_at": o.ExpiresAt, "revoked_at": revokedAt})
+
+	c.JSON(200, gin.H{
+		"status": "success",
+		"data":   o,
+	})
+}
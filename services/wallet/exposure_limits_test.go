@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+var netOutflowColumns = []string{"currency", "outflow", "inflow"}
+
+func setTestExposureLimits(t *testing.T, user, global string) {
+	previous := exposureLimits
+	t.Cleanup(func() { exposureLimits = previous })
+	exposureLimits = ExposureLimits{UserDailyNetOutflow: decimal.RequireFromString(user),
+		GlobalDailyNetOutflow: decimal.RequireFromString(global)}
+}
+
+func TestCheckExposureLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		operation  string
+		amount     int64
+		overridden bool
+		userUsed   string // net outflow in BOB, empty when not queried
+		globalUsed string
+		wantScope  string
+	}{
+		{name: "within both limits", operation: OperationWithdrawal, amount: 1000, userUsed: "2000", globalUsed: "50000"},
+		{name: "user over the cap", operation: OperationWithdrawal, amount: 1000, userUsed: "9500", wantScope: "USER"},
+		{name: "deposits today free up the cap", operation: OperationTransfer, amount: 1000, userUsed: "-3000", globalUsed: "0"},
+		{name: "withdrawal over the platform cap", operation: OperationWithdrawal, amount: 1000, userUsed: "0",
+			globalUsed: "99500", wantScope: "GLOBAL"},
+		{name: "transfers don't move the platform outflow", operation: OperationTransfer, amount: 1000, userUsed: "0",
+			globalUsed: "99500"},
+		{name: "everything stops once the platform is at its cap", operation: OperationTransfer, amount: 10, userUsed: "0",
+			globalUsed: "100000", wantScope: "GLOBAL"},
+		{name: "admin override", operation: OperationWithdrawal, amount: 50000, overridden: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestExposureLimits(t, "10000", "100000")
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(`FROM exposure_overrides`).WithArgs("user-1").
+				WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(tt.overridden))
+			if tt.userUsed != "" {
+				mock.ExpectQuery(`FROM transactions t\s+WHERE t.user_id = \$1`).WithArgs("user-1").
+					WillReturnRows(sqlmock.NewRows(netOutflowColumns).AddRow("BOB", tt.userUsed, "0"))
+			}
+			if tt.globalUsed != "" {
+				mock.ExpectQuery(`JOIN users u ON u.id = t.user_id`).
+					WillReturnRows(sqlmock.NewRows(netOutflowColumns).AddRow("BOB", tt.globalUsed, "0"))
+			}
+
+			err = checkExposureLimits(db, tt.operation, "user-1", "BOB", decimal.NewFromInt(tt.amount))
+			limitErr, _ := err.(*ExposureLimitError)
+			switch {
+			case tt.wantScope == "" && err != nil:
+				t.Fatalf("checkExposureLimits() error = %v, want allowed", err)
+			case tt.wantScope != "" && (limitErr == nil || limitErr.Scope != tt.wantScope):
+				t.Fatalf("checkExposureLimits() error = %v, want %s limit", err, tt.wantScope)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestDailyNetOutflowConvertsToBOB(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM transactions t`).WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows(netOutflowColumns).AddRow("BOB", "500", "200").AddRow("USD", "100", "0"))
+
+	used, err := dailyNetOutflow(db, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := decimal.RequireFromString("990"); !used.Equal(want) {
+		t.Errorf("dailyNetOutflow() = %s, want %s", used, want)
+	}
+}
+
+func TestExposureLimitsDisabled(t *testing.T) {
+	setTestExposureLimits(t, "0", "0")
+	// No limits configured: nothing is queried
+	if err := checkExposureLimits(nil, OperationWithdrawal, "user-1", "BOB", decimal.NewFromInt(1000000)); err != nil {
+		t.Errorf("checkExposureLimits() error = %v", err)
+	}
+}
+
+func TestEnforceExposureLimitsResponses(t *testing.T) {
+	tests := []struct {
+		name       string
+		userUsed   string
+		globalUsed string
+		wantStatus int
+		wantRetry  bool
+	}{
+		{name: "user cap", userUsed: "9500", wantStatus: http.StatusForbidden},
+		{name: "platform halt until midnight", userUsed: "0", globalUsed: "100000", wantStatus: http.StatusServiceUnavailable, wantRetry: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestExposureLimits(t, "10000", "100000")
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(`FROM exposure_overrides`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			mock.ExpectQuery(`WHERE t.user_id = \$1`).WillReturnRows(sqlmock.NewRows(netOutflowColumns).AddRow("BOB", tt.userUsed, "0"))
+			if tt.globalUsed != "" {
+				mock.ExpectQuery(`JOIN users u`).WillReturnRows(sqlmock.NewRows(netOutflowColumns).AddRow("BOB", tt.globalUsed, "0"))
+			}
+
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+			if (&Server{db: db}).enforceExposureLimits(c, OperationWithdrawal, "user-1", "BOB", decimal.NewFromInt(1000)) {
+				t.Fatal("enforceExposureLimits() let the withdrawal through")
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if hasRetry := w.Header().Get("Retry-After") != ""; hasRetry != tt.wantRetry {
+				t.Errorf("Retry-After set = %v, want %v", hasRetry, tt.wantRetry)
+			}
+		})
+	}
+}
+
+// expectUnlimitedKYC lets the KYC checks of a handler through without limits
+func expectUnlimitedKYC(mock sqlmock.Sqlmock, currency string) {
+	mock.ExpectQuery(`LEFT JOIN kyc_currency_requirements`).WithArgs("user-1", currency).
+		WillReturnRows(sqlmock.NewRows([]string{"kyc_level", "min_kyc_level"}).AddRow(1, 0))
+	mock.ExpectQuery(`SELECT COALESCE\(kyc_level, 0\) FROM users`).WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"kyc_level"}).AddRow(1))
+	mock.ExpectQuery(`FROM kyc_level_limits`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(kycLimitColumns).AddRow("BOB", nil, nil, nil))
+}
+
+func postAsUser(handler gin.HandlerFunc, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", "user-1")
+	handler(c)
+	return w
+}
+
+func TestWithdrawalOverExposureCapRejected(t *testing.T) {
+	tests := []struct {
+		name       string
+		userUsed   string
+		globalUsed string
+		wantStatus int
+	}{
+		{name: "user cap", userUsed: "9500", wantStatus: http.StatusForbidden},
+		{name: "platform cap", userUsed: "0", globalUsed: "99500", wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestExposureLimits(t, "10000", "100000")
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(`SELECT COALESCE\(is_verified, false\) FROM users`).WithArgs("user-1").
+				WillReturnRows(sqlmock.NewRows([]string{"is_verified"}).AddRow(true))
+			mock.ExpectQuery(`SELECT balance FROM wallets`).WithArgs("user-1", "BOB").
+				WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow("50000"))
+			expectUnlimitedKYC(mock, "BOB")
+			mock.ExpectQuery(`FROM exposure_overrides`).WithArgs("user-1").
+				WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			mock.ExpectQuery(`WHERE t.user_id = \$1`).WithArgs("user-1").
+				WillReturnRows(sqlmock.NewRows(netOutflowColumns).AddRow("BOB", tt.userUsed, "0"))
+			if tt.globalUsed != "" {
+				mock.ExpectQuery(`JOIN users u`).WillReturnRows(sqlmock.NewRows(netOutflowColumns).AddRow("BOB", tt.globalUsed, "0"))
+			}
+
+			// Stopped before confirmations, approval or any funds are locked
+			w := postAsUser((&Server{db: db}).handleWithdrawal,
+				`{"currency":"BOB","amount":1000,"method":"BANK","destination":{"account":"123"}}`)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestDepositIgnoresExposureLimits(t *testing.T) {
+	// Already over both caps: a deposit only lowers the net outflow, so it must not be checked
+	setTestExposureLimits(t, "10000", "100000")
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	expectUnlimitedKYC(mock, "BOB")
+	mock.ExpectExec(`INSERT INTO deposit_attempts`).WillReturnResult(sqlmock.NewResult(0, 1))
+	// Fail right after the checks: reaching the reference is what matters here
+	mock.ExpectQuery(`SELECT nextval\('deposit_reference_seq'\)`).WillReturnError(errors.New("sequence unavailable"))
+
+	w := postAsUser((&Server{db: db}).handleDeposit,
+		`{"currency":"BOB","amount":1000,"method":"BANK","first_name":"Ana","last_name":"Rojas"}`)
+	if !strings.Contains(w.Body.String(), "Failed to create deposit") {
+		t.Errorf("response = %d %s, want the deposit past the limit checks", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -3,8 +3,8 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"strconv"
@@ -14,6 +14,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/shopspring/decimal"
+
+	"shared/revocation"
 )
 
 type WalletBalance struct {
@@ -32,7 +34,9 @@ type Transaction struct {
 	Status      string          `json:"status"` // PENDING, COMPLETED, FAILED, CANCELLED
 	Method      string          `json:"method"` // BANK, PAYPAL, STRIPE, QR, P2P
 	ExternalRef string          `json:"external_ref,omitempty"`
+	Reference   string          `json:"reference,omitempty"` // Deposit reference the user quotes in the transfer
 	Metadata    string          `json:"metadata,omitempty"`
+	Tags        []string        `json:"tags,omitempty"` // The requesting user's own tags
 	CreatedAt   time.Time       `json:"created_at"`
 	UpdatedAt   time.Time       `json:"updated_at"`
 }
@@ -43,13 +47,16 @@ type DepositRequest struct {
 	Method    string  `json:"method" binding:"required,oneof=BANK PAYPAL STRIPE QR"`
 	FirstName string  `json:"first_name" binding:"required"`
 	LastName  string  `json:"last_name" binding:"required"`
+	OrderID   string  `json:"order_id"` // optional BUY order this deposit pays for
 }
 
 type WithdrawalRequest struct {
 	Currency    string                 `json:"currency" binding:"required"`
 	Amount      float64                `json:"amount" binding:"required,gt=0"`
-	Method      string                 `json:"method" binding:"required,oneof=BANK PAYPAL STRIPE"`
+	Method      string                 `json:"method" binding:"required,oneof=BANK CRYPTO PAYPAL STRIPE"`
 	Destination map[string]interface{} `json:"destination" binding:"required"`
+	PIN         string                 `json:"pin"`
+	OTP         string                 `json:"otp"`
 }
 
 type TransferRequest struct {
@@ -57,6 +64,8 @@ type TransferRequest struct {
 	ToCurrency   string  `json:"to_currency" binding:"required"`
 	Amount       float64 `json:"amount" binding:"required,gt=0"`
 	RecipientID  string  `json:"recipient_id" binding:"required"`
+	PIN          string  `json:"pin"`
+	OTP          string  `json:"otp"`
 }
 
 type ConvertRequest struct {
@@ -67,6 +76,13 @@ type ConvertRequest struct {
 	Rate         float64 `json:"rate" binding:"required,gt=0"`
 }
 
+type AutoConvertPreferenceRequest struct {
+	Enabled            bool     `json:"enabled"`
+	TargetCurrency     string   `json:"target_currency" binding:"required,oneof=BOB USD USDT"`
+	MaxSlippagePercent *float64 `json:"max_slippage_percent" binding:"omitempty,gte=0,lte=10"`
+	MinAmount          *float64 `json:"min_amount" binding:"omitempty,gte=0"`
+}
+
 func (s *Server) handleGetWallets(c *gin.Context) {
 	userID := c.GetString("user_id")
 	
@@ -116,6 +132,10 @@ func (s *Server) handleGetWallets(c *gin.Context) {
 func (s *Server) handleGetWalletByCurrency(c *gin.Context) {
 	userID := c.GetString("user_id")
 	currency := strings.ToUpper(c.Param("currency"))
+	if !isSupportedCurrency(currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported currency", "supported_currencies": supportedCurrencies()})
+		return
+	}
 	
 	var wallet WalletBalance
 	err := s.db.QueryRow(`
@@ -152,51 +172,23 @@ func (s *Server) handleGetWalletByCurrency(c *gin.Context) {
 
 func (s *Server) handleGetTransactions(c *gin.Context) {
 	userID := c.GetString("user_id")
-	currency := c.Query("currency")
-	txType := c.Query("type")
-	status := c.Query("status")
 	limit := c.DefaultQuery("limit", "50")
 	offset := c.DefaultQuery("offset", "0")
 	
 	limitInt, _ := strconv.Atoi(limit)
 	offsetInt, _ := strconv.Atoi(offset)
 	
-	// Build query
-	var conditions []string
-	var args []interface{}
-	argIndex := 1
-	
-	baseQuery := `
-		SELECT id, COALESCE(user_id, from_user_id) as user_id, COALESCE(type, transaction_type) as type, currency, amount, status, COALESCE(method, payment_method) as method, COALESCE(external_ref, payment_reference) as external_ref, metadata, created_at, updated_at
-		FROM transactions
-		WHERE COALESCE(user_id, from_user_id) = $1 OR to_user_id = $1
-	`
-	args = append(args, userID)
-	argIndex++
-	
-	if currency != "" {
-		conditions = append(conditions, fmt.Sprintf("currency = $%d", argIndex))
-		args = append(args, strings.ToUpper(currency))
-		argIndex++
-	}
-	
-	if txType != "" {
-		conditions = append(conditions, fmt.Sprintf("type = $%d", argIndex))
-		args = append(args, txType)
-		argIndex++
-	}
-	
-	if status != "" {
-		conditions = append(conditions, fmt.Sprintf("status = $%d", argIndex))
-		args = append(args, status)
-		argIndex++
+	where, args, err := transactionFilters(c, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 	
-	if len(conditions) > 0 {
-		baseQuery += " AND " + strings.Join(conditions, " AND ")
-	}
+	var total int
+	s.db.QueryRow("SELECT COUNT(*) FROM transactions "+where, args...).Scan(&total)
 	
-	baseQuery += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	baseQuery := "SELECT " + transactionColumns + " FROM transactions " + where +
+		fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
 	args = append(args, limitInt, offsetInt)
 	
 	rows, err := s.db.Query(baseQuery, args...)
@@ -228,10 +220,11 @@ func (s *Server) handleGetTransactions(c *gin.Context) {
 		
 		transactions = append(transactions, tx)
 	}
+	s.attachTransactionTags(c, userID, transactions)
 	
 	c.JSON(http.StatusOK, gin.H{
 		"transactions": transactions,
-		"total":        len(transactions),
+		"total":        total,
 		"limit":        limitInt,
 		"offset":       offsetInt,
 	})
@@ -254,6 +247,23 @@ func (s *Server) handleDeposit(c *gin.Context) {
 	fmt.Printf("📊 [WALLET-BACKEND] Datos recibidos: userID=%s, currency=%s, amount=%s, method=%s, firstName=%s, lastName=%s\n", 
 		userID, currency, amount.String(), req.Method, req.FirstName, req.LastName)
 	
+	// Enforce KYC level limits
+	if !s.enforceKYCLimits(c, userID, currency, amount) {
+		return
+	}
+	
+	// A deposit opened for a BUY order must be able to pay for it
+	if req.OrderID != "" {
+		if !orderFundingEnabled() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Funding orders from deposits is not enabled"})
+			return
+		}
+		if err := validateFundingOrder(s.db, userID, req.OrderID, currency, amount); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	
 	// Record deposit attempt
 	fmt.Printf("💾 [WALLET-BACKEND] Insertando en deposit_attempts...\n")
 	_, err := s.db.Exec(`
@@ -272,6 +282,12 @@ func (s *Server) handleDeposit(c *gin.Context) {
 	// Create transaction record
 	fmt.Printf("🆔 [WALLET-BACKEND] Generando transaction ID...\n")
 	txID := s.generateTxID()
+	reference, err := nextDepositReference(s.db)
+	if err != nil {
+		fmt.Printf("❌ [WALLET-BACKEND] Error allocating deposit reference: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create deposit"})
+		return
+	}
 	tx := Transaction{
 		ID:        txID,
 		UserID:    userID,
@@ -280,6 +296,7 @@ func (s *Server) handleDeposit(c *gin.Context) {
 		Amount:    amount,
 		Status:    "PENDING",
 		Method:    req.Method,
+		Reference: reference,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -290,9 +307,9 @@ func (s *Server) handleDeposit(c *gin.Context) {
 	// Insert transaction (using both old and new fields for compatibility)
 	fmt.Printf("💾 [WALLET-BACKEND] Insertando transaction en base de datos...\n")
 	_, err = s.db.Exec(`
-		INSERT INTO transactions (id, user_id, from_user_id, type, transaction_type, currency, amount, status, method, payment_method, external_ref, created_at, updated_at)
-		VALUES ($1, $2, $2, $3, $3, $4, $5, $6, $7, $7, '', $8, $9)
-	`, tx.ID, tx.UserID, tx.Type, tx.Currency, tx.Amount, tx.Status, tx.Method, tx.CreatedAt, tx.UpdatedAt)
+		INSERT INTO transactions (id, user_id, from_user_id, type, transaction_type, currency, amount, status, method, payment_method, external_ref, deposit_reference, funding_order_id, created_at, updated_at)
+		VALUES ($1, $2, $2, $3, $3, $4, $5, $6, $7, $7, '', $8, NULLIF($9, '')::uuid, $10, $11)
+	`, tx.ID, tx.UserID, tx.Type, tx.Currency, tx.Amount, tx.Status, tx.Method, tx.Reference, req.OrderID, tx.CreatedAt, tx.UpdatedAt)
 	
 	if err != nil {
 		fmt.Printf("❌ [WALLET-BACKEND] Error creating deposit transaction: %v\n", err)
@@ -318,6 +335,10 @@ func (s *Server) handleDeposit(c *gin.Context) {
 	}
 	
 	response["transaction_id"] = txID
+	response["reference"] = reference
+	if req.OrderID != "" {
+		response["funding_order_id"] = req.OrderID
+	}
 	fmt.Printf("🎉 [WALLET-BACKEND] Enviando respuesta exitosa: txID=%s, method=%s\n", txID, req.Method)
 	c.JSON(http.StatusOK, response)
 }
@@ -333,6 +354,14 @@ func (s *Server) handleWithdrawal(c *gin.Context) {
 	amount := decimal.NewFromFloat(req.Amount)
 	currency := strings.ToUpper(req.Currency)
 	
+	// Withdrawals require a verified email
+	var isVerified bool
+	s.db.QueryRow(`SELECT COALESCE(is_verified, false) FROM users WHERE id = $1`, userID).Scan(&isVerified)
+	if !isVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Verify your email before withdrawing funds", "code": "EMAIL_NOT_VERIFIED"})
+		return
+	}
+	
 	// Check balance
 	var balance decimal.Decimal
 	err := s.db.QueryRow(`
@@ -349,6 +378,39 @@ func (s *Server) handleWithdrawal(c *gin.Context) {
 		return
 	}
 	
+	// Enforce KYC level limits
+	if !s.enforceKYCLimits(c, userID, currency, amount) {
+		return
+	}
+	
+	// Daily net outflow caps, per user and platform-wide
+	if !s.enforceExposureLimits(c, OperationWithdrawal, userID, currency, amount) {
+		return
+	}
+	
+	if _, err := s.withdrawalRouter.Route(currency, req.Method); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errWithdrawalRailUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	
+	// PIN always, plus an emailed code for large or risky withdrawals; checked last so a
+	// code is not consumed by a withdrawal that fails validation
+	check := ConfirmationCheck{Operation: OperationWithdrawal, UserID: userID, Currency: currency, Amount: amount}
+	if !s.enforceConfirmations(c, check, req.PIN, req.OTP) {
+		return
+	}
+	
+	// Large withdrawals wait for an operator with the funds locked
+	status := "PENDING"
+	needsApproval := withdrawalNeedsApproval(currency, amount)
+	if needsApproval {
+		status = WithdrawalPendingApproval
+	}
+	
 	// Create transaction
 	txID := s.generateTxID()
 	metadataJSON, _ := json.Marshal(req.Destination)
@@ -359,7 +421,7 @@ func (s *Server) handleWithdrawal(c *gin.Context) {
 		Type:      "WITHDRAWAL",
 		Currency:  currency,
 		Amount:    amount,
-		Status:    "PENDING",
+		Status:    status,
 		Method:    req.Method,
 		Metadata:  string(metadataJSON),
 		CreatedAt: time.Now(),
@@ -402,17 +464,21 @@ func (s *Server) handleWithdrawal(c *gin.Context) {
 		return
 	}
 	
-	// Process withdrawal
-	var response gin.H
-	switch req.Method {
-	case "BANK":
-		response = s.processBankWithdrawal(tx)
-	default:
-		response = gin.H{"error": "Payment method not available in Bolivia. Use BANK instead."}
+	if needsApproval {
+		requestLog(c).Printf("⏸️ Withdrawal %s (%s %s) waiting for approval", txID, amount.String(), currency)
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":        "Withdrawal submitted for approval",
+			"transaction_id": txID,
+			"status":         strings.ToLower(WithdrawalPendingApproval),
+		})
+		return
 	}
 	
+	// Hand the withdrawal to the processor routed for its currency and method
+	response, httpStatus := s.dispatchWithdrawal(tx, req.Destination)
+	
 	response["transaction_id"] = txID
-	c.JSON(http.StatusOK, response)
+	c.JSON(httpStatus, response)
 }
 
 func (s *Server) handleTransfer(c *gin.Context) {
@@ -446,6 +512,22 @@ func (s *Server) handleTransfer(c *gin.Context) {
 		return
 	}
 	
+	// Enforce KYC level limits
+	if !s.enforceKYCLimits(c, userID, fromCurrency, amount) {
+		return
+	}
+	
+	// Daily net outflow caps, per user and platform-wide
+	if !s.enforceExposureLimits(c, OperationTransfer, userID, fromCurrency, amount) {
+		return
+	}
+	
+	// Large or risky transfers need the transaction PIN and possibly an emailed code
+	check := ConfirmationCheck{Operation: OperationTransfer, UserID: userID, Currency: fromCurrency, Amount: amount, RecipientID: req.RecipientID}
+	if !s.enforceConfirmations(c, check, req.PIN, req.OTP) {
+		return
+	}
+	
 	// Start database transaction
 	dbTx, err := s.db.Begin()
 	if err != nil {
@@ -502,6 +584,9 @@ func (s *Server) handleTransfer(c *gin.Context) {
 		return
 	}
 	
+	// Convert the received funds if the recipient opted in
+	applyAutoConvert(dbTx, req.RecipientID, toCurrency, amount, inTxID)
+	
 	// Commit transaction
 	if err = dbTx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transfer"})
@@ -549,13 +634,14 @@ func (s *Server) handleGetTransaction(c *gin.Context) {
 		tx.Metadata = metadata.String
 	}
 	
-	c.JSON(http.StatusOK, tx)
+	transactions := []Transaction{tx}
+	s.attachTransactionTags(c, userID, transactions)
+	
+	c.JSON(http.StatusOK, transactions[0])
 }
 
 func (s *Server) createDefaultWallets(userID string) error {
-	currencies := []string{"USD", "BOB", "USDT"}
-	
-	for _, currency := range currencies {
+	for _, currency := range supportedCurrencies() {
 		_, err := s.db.Exec(`
 			INSERT INTO wallets (user_id, currency, balance, locked_balance, created_at, updated_at)
 			VALUES ($1, $2, 0, 0, NOW(), NOW())
@@ -587,16 +673,16 @@ func (s *Server) generateTxID() string {
 
 func (s *Server) handleConvert(c *gin.Context) {
 	userID := c.GetString("user_id")
-	log.Printf("🔄 [CONVERSION] Starting conversion for user: %s", userID)
+	requestLog(c).Printf("🔄 [CONVERSION] Starting conversion for user: %s", userID)
 	
 	var req ConvertRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("❌ [CONVERSION] JSON binding error: %v", err)
+		requestLog(c).Printf("❌ [CONVERSION] JSON binding error: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	
-	log.Printf("📊 [CONVERSION] Request: %s %.4f -> %s %.4f (rate: %.6f)", 
+	requestLog(c).Printf("📊 [CONVERSION] Request: %s %.4f -> %s %.4f (rate: %.6f)", 
 		req.FromCurrency, req.FromAmount, req.ToCurrency, req.ToAmount, req.Rate)
 
 	// Validate currency conversion
@@ -616,10 +702,10 @@ func (s *Server) handleConvert(c *gin.Context) {
 		return
 	}
 
-	log.Printf("🏦 [CONVERSION] Starting database transaction...")
+	requestLog(c).Printf("🏦 [CONVERSION] Starting database transaction...")
 	tx, err := s.db.Begin()
 	if err != nil {
-		log.Printf("❌ [CONVERSION] Failed to begin transaction: %v", err)
+		requestLog(c).Printf("❌ [CONVERSION] Failed to begin transaction: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
 		return
 	}
@@ -636,20 +722,20 @@ func (s *Server) handleConvert(c *gin.Context) {
 	if err := row.Scan(&availableBalance); err != nil {
 		if err == sql.ErrNoRows {
 			availableBalance = decimal.Zero
-			log.Printf("⚠️ [CONVERSION] No wallet found for %s %s, using zero balance", userID, req.FromCurrency)
+			requestLog(c).Printf("⚠️ [CONVERSION] No wallet found for %s %s, using zero balance", userID, req.FromCurrency)
 		} else {
-			log.Printf("❌ [CONVERSION] Balance check error: %v", err)
+			requestLog(c).Printf("❌ [CONVERSION] Balance check error: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check balance"})
 			return
 		}
 	}
 
 	fromAmountDecimal := decimal.NewFromFloat(req.FromAmount)
-	log.Printf("💰 [CONVERSION] Balance check: available=%s, required=%s", 
+	requestLog(c).Printf("💰 [CONVERSION] Balance check: available=%s, required=%s", 
 		availableBalance.String(), fromAmountDecimal.String())
 		
 	if availableBalance.LessThan(fromAmountDecimal) {
-		log.Printf("❌ [CONVERSION] Insufficient balance: need %s, have %s", 
+		requestLog(c).Printf("❌ [CONVERSION] Insufficient balance: need %s, have %s", 
 			fromAmountDecimal.String(), availableBalance.String())
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Insufficient balance",
@@ -661,10 +747,10 @@ func (s *Server) handleConvert(c *gin.Context) {
 
 	// Generate transaction ID
 	transactionID := s.generateTxID()
-	log.Printf("🆔 [CONVERSION] Generated transaction ID: %s", transactionID)
+	requestLog(c).Printf("🆔 [CONVERSION] Generated transaction ID: %s", transactionID)
 
 	// Deduct from source currency wallet
-	log.Printf("💸 [CONVERSION] Deducting %s %s from wallet...", fromAmountDecimal.String(), req.FromCurrency)
+	requestLog(c).Printf("💸 [CONVERSION] Deducting %s %s from wallet...", fromAmountDecimal.String(), req.FromCurrency)
 	result, err := tx.Exec(`
 		UPDATE wallets 
 		SET balance = balance - $3, updated_at = NOW()
@@ -672,7 +758,7 @@ func (s *Server) handleConvert(c *gin.Context) {
 	`, userID, req.FromCurrency, fromAmountDecimal)
 	
 	if err != nil {
-		log.Printf("❌ [CONVERSION] Failed to deduct from source wallet: %v", err)
+		requestLog(c).Printf("❌ [CONVERSION] Failed to deduct from source wallet: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to deduct from source wallet", 
 			"details": err.Error(),
@@ -684,11 +770,11 @@ func (s *Server) handleConvert(c *gin.Context) {
 	}
 	
 	rowsAffected, _ := result.RowsAffected()
-	log.Printf("✅ [CONVERSION] Deducted %s %s (rows affected: %d)", fromAmountDecimal.String(), req.FromCurrency, rowsAffected)
+	requestLog(c).Printf("✅ [CONVERSION] Deducted %s %s (rows affected: %d)", fromAmountDecimal.String(), req.FromCurrency, rowsAffected)
 
 	// Add to target currency wallet
 	toAmountDecimal := decimal.NewFromFloat(req.ToAmount)
-	log.Printf("💰 [CONVERSION] Adding %s %s to wallet...", toAmountDecimal.String(), req.ToCurrency)
+	requestLog(c).Printf("💰 [CONVERSION] Adding %s %s to wallet...", toAmountDecimal.String(), req.ToCurrency)
 	result, err = tx.Exec(`
 		INSERT INTO wallets (user_id, currency, balance, locked_balance, updated_at)
 		VALUES ($1, $2, $3, 0, NOW())
@@ -699,7 +785,7 @@ func (s *Server) handleConvert(c *gin.Context) {
 	`, userID, req.ToCurrency, toAmountDecimal)
 	
 	if err != nil {
-		log.Printf("❌ [CONVERSION] Failed to add to target wallet: %v", err)
+		requestLog(c).Printf("❌ [CONVERSION] Failed to add to target wallet: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to add to target wallet",
 			"details": err.Error(),
@@ -708,21 +794,21 @@ func (s *Server) handleConvert(c *gin.Context) {
 	}
 	
 	rowsAffected, _ = result.RowsAffected()
-	log.Printf("✅ [CONVERSION] Added %s %s (rows affected: %d)", toAmountDecimal.String(), req.ToCurrency, rowsAffected)
+	requestLog(c).Printf("✅ [CONVERSION] Added %s %s (rows affected: %d)", toAmountDecimal.String(), req.ToCurrency, rowsAffected)
 
 	// Record the conversion transaction (debit from source currency)
 	metadata := fmt.Sprintf(`{"conversion": true, "from_currency": "%s", "to_currency": "%s", "from_amount": %.4f, "to_amount": %.4f, "rate": %.6f}`,
 		req.FromCurrency, req.ToCurrency, req.FromAmount, req.ToAmount, req.Rate)
 	
-	log.Printf("📝 [CONVERSION] Recording debit transaction: %s %s", fromAmountDecimal.String(), req.FromCurrency)
+	requestLog(c).Printf("📝 [CONVERSION] Recording debit transaction: %s %s", fromAmountDecimal.String(), req.FromCurrency)
 	_, err = tx.Exec(`
 		INSERT INTO transactions (id, user_id, type, transaction_type, currency, amount, status, method, payment_method, metadata, created_at, updated_at)
 		VALUES ($1, $2, 'TRANSFER_OUT', 'TRANSFER_OUT', $3, $4, 'COMPLETED', 'INTERNAL', 'INTERNAL', $5, NOW(), NOW())
 	`, transactionID, userID, req.FromCurrency, fromAmountDecimal, metadata)
 
 	if err != nil {
-		log.Printf("❌ [CONVERSION] Failed to record conversion transaction: %v", err)
-		log.Printf("❌ [CONVERSION] Transaction data: id=%s, user=%s, currency=%s, amount=%s", 
+		requestLog(c).Printf("❌ [CONVERSION] Failed to record conversion transaction: %v", err)
+		requestLog(c).Printf("❌ [CONVERSION] Transaction data: id=%s, user=%s, currency=%s, amount=%s", 
 			transactionID, userID, req.FromCurrency, fromAmountDecimal.String())
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to record conversion transaction",
@@ -730,22 +816,22 @@ func (s *Server) handleConvert(c *gin.Context) {
 		})
 		return
 	}
-	log.Printf("✅ [CONVERSION] Recorded debit transaction: %s", transactionID)
+	requestLog(c).Printf("✅ [CONVERSION] Recorded debit transaction: %s", transactionID)
 
 	// Record the target currency transaction (credit to target currency)
 	targetTransactionID := s.generateTxID()
 	targetMetadata := fmt.Sprintf(`{"conversion": true, "from_currency": "%s", "to_currency": "%s", "from_amount": %.4f, "to_amount": %.4f, "rate": %.6f, "source_tx": "%s"}`,
 		req.FromCurrency, req.ToCurrency, req.FromAmount, req.ToAmount, req.Rate, transactionID)
 	
-	log.Printf("📝 [CONVERSION] Recording credit transaction: %s %s", toAmountDecimal.String(), req.ToCurrency)
+	requestLog(c).Printf("📝 [CONVERSION] Recording credit transaction: %s %s", toAmountDecimal.String(), req.ToCurrency)
 	_, err = tx.Exec(`
 		INSERT INTO transactions (id, user_id, type, transaction_type, currency, amount, status, method, payment_method, metadata, created_at, updated_at)
 		VALUES ($1, $2, 'TRANSFER_IN', 'TRANSFER_IN', $3, $4, 'COMPLETED', 'INTERNAL', 'INTERNAL', $5, NOW(), NOW())
 	`, targetTransactionID, userID, req.ToCurrency, toAmountDecimal, targetMetadata)
 
 	if err != nil {
-		log.Printf("❌ [CONVERSION] Failed to record target transaction: %v", err)
-		log.Printf("❌ [CONVERSION] Target transaction data: id=%s, user=%s, currency=%s, amount=%s", 
+		requestLog(c).Printf("❌ [CONVERSION] Failed to record target transaction: %v", err)
+		requestLog(c).Printf("❌ [CONVERSION] Target transaction data: id=%s, user=%s, currency=%s, amount=%s", 
 			targetTransactionID, userID, req.ToCurrency, toAmountDecimal.String())
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to record target transaction",
@@ -753,12 +839,12 @@ func (s *Server) handleConvert(c *gin.Context) {
 		})
 		return
 	}
-	log.Printf("✅ [CONVERSION] Recorded credit transaction: %s", targetTransactionID)
+	requestLog(c).Printf("✅ [CONVERSION] Recorded credit transaction: %s", targetTransactionID)
 
 	// Commit transaction
-	log.Printf("💾 [CONVERSION] Committing transaction...")
+	requestLog(c).Printf("💾 [CONVERSION] Committing transaction...")
 	if err := tx.Commit(); err != nil {
-		log.Printf("❌ [CONVERSION] Failed to commit transaction: %v", err)
+		requestLog(c).Printf("❌ [CONVERSION] Failed to commit transaction: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to commit conversion",
 			"details": err.Error(),
@@ -766,7 +852,7 @@ func (s *Server) handleConvert(c *gin.Context) {
 		return
 	}
 
-	log.Printf("🎉 [CONVERSION] SUCCESS: Converted %.4f %s -> %.4f %s (rate: %.6f)", 
+	requestLog(c).Printf("🎉 [CONVERSION] SUCCESS: Converted %.4f %s -> %.4f %s (rate: %.6f)", 
 		req.FromAmount, req.FromCurrency, req.ToAmount, req.ToCurrency, req.Rate)
 
 	c.JSON(http.StatusOK, gin.H{
@@ -781,6 +867,77 @@ func (s *Server) handleConvert(c *gin.Context) {
 	})
 }
 
+func (s *Server) handleGetAutoConvertPreference(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var enabled bool
+	var targetCurrency string
+	var maxSlippage, minAmount decimal.Decimal
+	var updatedAt time.Time
+	err := s.db.QueryRow(`
+		SELECT enabled, target_currency, max_slippage_percent, min_amount, updated_at
+		FROM user_auto_convert_preferences
+		WHERE user_id = $1
+	`, userID).Scan(&enabled, &targetCurrency, &maxSlippage, &minAmount, &updatedAt)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get auto-convert preference"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":              enabled,
+		"target_currency":      targetCurrency,
+		"max_slippage_percent": maxSlippage,
+		"min_amount":           minAmount,
+		"updated_at":           updatedAt,
+	})
+}
+
+func (s *Server) handleUpdateAutoConvertPreference(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req AutoConvertPreferenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	maxSlippage := decimal.NewFromFloat(1.0)
+	if req.MaxSlippagePercent != nil {
+		maxSlippage = decimal.NewFromFloat(*req.MaxSlippagePercent)
+	}
+	minAmount := decimal.Zero
+	if req.MinAmount != nil {
+		minAmount = decimal.NewFromFloat(*req.MinAmount)
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO user_auto_convert_preferences (user_id, enabled, target_currency, max_slippage_percent, min_amount, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		ON CONFLICT (user_id)
+		DO UPDATE SET enabled = $2, target_currency = $3, max_slippage_percent = $4, min_amount = $5, updated_at = NOW()
+	`, userID, req.Enabled, req.TargetCurrency, maxSlippage, minAmount)
+
+	if err != nil {
+		requestLog(c).Printf("❌ Failed to save auto-convert preference for %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save auto-convert preference"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":              "Auto-convert preference updated",
+		"enabled":              req.Enabled,
+		"target_currency":      req.TargetCurrency,
+		"max_slippage_percent": maxSlippage,
+		"min_amount":           minAmount,
+	})
+}
+
 func (s *Server) authMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -809,6 +966,11 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 		
 		if claims, ok := token.Claims.(jwt.MapClaims); ok {
 			userID := claims["user_id"].(string)
+			if revocation.IsUserRevoked(c.Request.Context(), s.redis, userID) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is closed"})
+				c.Abort()
+				return
+			}
 			c.Set("user_id", userID)
 			c.Next()
 		} else {
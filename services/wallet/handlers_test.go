@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetTransactionsTotalCountsEveryMatchingRow(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// 12 completed BOB transactions match; the page holds the first two
+	where := `WHERE \(COALESCE\(user_id, from_user_id\) = \$1 OR to_user_id = \$1\) AND currency = \$2 AND status = \$3`
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM transactions `+where+`$`).WithArgs("user-1", "BOB", "COMPLETED").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(int64(12)))
+	rows := sqlmock.NewRows([]string{"id", "user_id", "type", "currency", "amount", "status", "method",
+		"external_ref", "metadata", "created_at", "updated_at"})
+	for _, id := range []string{"tx-1", "tx-2"} {
+		rows.AddRow(id, "user-1", "DEPOSIT", "BOB", "100", "COMPLETED", "QR", nil, nil, time.Now(), time.Now())
+	}
+	mock.ExpectQuery(`FROM transactions `+where+` ORDER BY created_at DESC LIMIT \$4 OFFSET \$5`).
+		WithArgs("user-1", "BOB", "COMPLETED", 2, 0).
+		WillReturnRows(rows)
+	mock.ExpectQuery(`FROM transaction_tags`).WillReturnRows(sqlmock.NewRows([]string{"transaction_id", "tag"}))
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/transactions?currency=bob&status=COMPLETED&limit=2", nil)
+	c.Set("user_id", "user-1")
+	(&Server{db: db}).handleGetTransactions(c)
+
+	var response struct {
+		Transactions []Transaction `json:"transactions"`
+		Total        int           `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("response = %d %s: %v", w.Code, w.Body.String(), err)
+	}
+	if len(response.Transactions) != 2 || response.Total != 12 {
+		t.Errorf("page of %d with total %d, want 2 of 12", len(response.Transactions), response.Total)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
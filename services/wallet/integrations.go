@@ -26,9 +26,9 @@ func (s *Server) processQRDeposit(tx Transaction) gin.H {
 			"type":       "QR_SIMPLE",
 			"amount":     tx.Amount.String(),
 			"currency":   "BOB",
-			"reference":  fmt.Sprintf("DEP-%s", tx.ID[:8]),
+			"reference":  tx.Reference,
 			"tx_id":      tx.ID,
-			"expires_at": time.Now().Add(24 * time.Hour).Unix(),
+			"expires_at": time.Now().Add(depositReferenceTTL).Unix(),
 		}
 	} else {
 		// Crypto QR for USD/USDT
@@ -39,7 +39,7 @@ func (s *Server) processQRDeposit(tx Transaction) gin.H {
 			"amount":     tx.Amount.String(),
 			"currency":   tx.Currency,
 			"tx_id":      tx.ID,
-			"expires_at": time.Now().Add(24 * time.Hour).Unix(),
+			"expires_at": time.Now().Add(depositReferenceTTL).Unix(),
 		}
 	}
 	
@@ -64,7 +64,7 @@ func (s *Server) processQRDeposit(tx Transaction) gin.H {
 	// Update transaction with reference
 	reference := ""
 	if tx.Currency == "BOB" {
-		reference = fmt.Sprintf("DEP-%s", tx.ID[:8])
+		reference = tx.Reference
 	} else {
 		reference = s.generateCryptoAddress(tx.Currency, tx.UserID)
 	}
@@ -76,7 +76,7 @@ func (s *Server) processQRDeposit(tx Transaction) gin.H {
 		"qr_data":         qrData,
 		"qr_code_url":     fmt.Sprintf("/public/qr/%s", qrFileName),
 		"qr_code_base64":  base64.StdEncoding.EncodeToString(qrCode),
-		"expires_at":      time.Now().Add(24 * time.Hour),
+		"expires_at":      time.Now().Add(depositReferenceTTL),
 		"status":          "pending_payment",
 	}
 }
@@ -84,11 +84,14 @@ func (s *Server) processQRDeposit(tx Transaction) gin.H {
 // Bank Transfer for Bolivia
 func (s *Server) processBankDeposit(tx Transaction) gin.H {
 	// Get deposit instructions from bank integration
-	instructions, err := s.bankIntegration.GetDepositInstructions(tx.UserID, tx.Currency, tx.Amount)
+	instructions, err := s.bankIntegration.GetDepositInstructions(tx.Currency, tx.Amount, tx.Reference)
 	if err != nil {
 		return gin.H{"error": "Failed to get deposit instructions"}
 	}
 	
+	// Keep the reference on the transaction so pending deposits can be matched and tracked
+	s.db.Exec("UPDATE transactions SET external_ref = $1 WHERE id = $2", instructions["reference"], tx.ID)
+	
 	return gin.H{
 		"message":      "Bank deposit initiated",
 		"instructions": instructions,
@@ -96,28 +99,6 @@ func (s *Server) processBankDeposit(tx Transaction) gin.H {
 	}
 }
 
-func (s *Server) processBankWithdrawal(tx Transaction) gin.H {
-	// Bank withdrawal for Bolivia
-	// In a real implementation, this would integrate with local banking APIs
-	
-	// For now, we'll create a withdrawal request that needs manual processing
-	withdrawalRef := s.generateBankReference(tx.ID)
-	
-	// Update transaction with withdrawal reference
-	s.db.Exec(`
-		UPDATE transactions 
-		SET external_ref = $1, status = 'PROCESSING' 
-		WHERE id = $2
-	`, withdrawalRef, tx.ID)
-	
-	return gin.H{
-		"message":         "Bank withdrawal initiated",
-		"reference":       withdrawalRef,
-		"status":          "processing",
-		"estimated_time":  "1-2 business days",
-	}
-}
-
 // Helper functions
 func (s *Server) generateCryptoAddress(currency, userID string) string {
 	// Generate a deterministic address based on user and currency
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// KYCLimits mirrors a row of kyc_level_limits; nil limits mean unlimited
+type KYCLimits struct {
+	Level            int
+	Currency         string
+	MonthlyLimit     *decimal.Decimal
+	DailyLimit       *decimal.Decimal
+	TransactionLimit *decimal.Decimal
+}
+
+// KYCLimitError describes which KYC limit a transaction would exceed
+type KYCLimitError struct {
+	Limit     string          `json:"limit"` // TRANSACTION, DAILY, MONTHLY
+	Level     int             `json:"kyc_level"`
+	Max       decimal.Decimal `json:"max"`
+	Used      decimal.Decimal `json:"used"`
+	Requested decimal.Decimal `json:"requested"`
+	Currency  string          `json:"limit_currency"`
+}
+
+func (e *KYCLimitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded for KYC level %d: used %s + requested %s exceeds %s %s",
+		strings.ToLower(e.Limit), e.Level, e.Used.StringFixed(2), e.Requested.StringFixed(2), e.Max.StringFixed(2), e.Currency)
+}
+
+// KYCCurrencyError is returned when the user's KYC level is below the minimum configured for the
+// currency in kyc_currency_requirements
+type KYCCurrencyError struct {
+	Code          string `json:"code"`
+	Currency      string `json:"currency"`
+	Level         int    `json:"kyc_level"`
+	RequiredLevel int    `json:"required_level"`
+}
+
+func (e *KYCCurrencyError) Error() string {
+	return fmt.Sprintf("%s requires KYC level %d, current level is %d", e.Currency, e.RequiredLevel, e.Level)
+}
+
+// limitQuerier is satisfied by both *sql.DB and *sql.Tx, so limits can also be checked inside the
+// transaction that moves the funds
+type limitQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// toLimitCurrency expresses amount in BOB at the current exchange rates
+func toLimitCurrency(currency string, amount decimal.Decimal) decimal.Decimal {
+	rate, ok := rateToBOB(currency)
+	if !ok {
+		return amount
+	}
+	return amount.Mul(rate)
+}
+
+// getKYCLimits loads the limits configured for the user's current KYC level
+func getKYCLimits(q limitQuerier, userID string) (*KYCLimits, error) {
+	var level int
+	err := q.QueryRow("SELECT COALESCE(kyc_level, 0) FROM users WHERE id = $1", userID).Scan(&level)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := &KYCLimits{Level: level}
+	var monthly, daily, perTx decimal.NullDecimal
+	err = q.QueryRow(`
+		SELECT limit_currency, monthly_limit, daily_limit, transaction_limit
+		FROM kyc_level_limits WHERE kyc_level = $1
+	`, level).Scan(&limits.Currency, &monthly, &daily, &perTx)
+	if err != nil {
+		return nil, err
+	}
+
+	if monthly.Valid {
+		limits.MonthlyLimit = &monthly.Decimal
+	}
+	if daily.Valid {
+		limits.DailyLimit = &daily.Decimal
+	}
+	if perTx.Valid {
+		limits.TransactionLimit = &perTx.Decimal
+	}
+
+	return limits, nil
+}
+
+// getCompletedVolume sums the user's completed deposits, withdrawals and outgoing transfers
+// within the given window, expressed in the limit currency
+func getCompletedVolume(q limitQuerier, userID, window string) (decimal.Decimal, error) {
+	total := decimal.Zero
+
+	rows, err := q.Query(`
+		SELECT currency, COALESCE(SUM(amount), 0)
+		FROM transactions
+		WHERE user_id = $1
+			AND status = 'COMPLETED'
+			AND COALESCE(transaction_type, type) IN ('DEPOSIT', 'WITHDRAWAL', 'TRANSFER_OUT')
+			AND COALESCE(method, '') <> 'INTERNAL'
+			AND created_at > NOW() - $2::interval
+		GROUP BY currency
+	`, userID, window)
+	if err != nil {
+		return total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var currency string
+		var amount decimal.Decimal
+		if err := rows.Scan(&currency, &amount); err != nil {
+			return total, err
+		}
+		total = total.Add(toLimitCurrency(currency, amount))
+	}
+
+	return total, rows.Err()
+}
+
+// checkCurrencyKYC returns a *KYCCurrencyError when the currency needs a higher KYC level than the
+// user has; currencies without a configured requirement are open to every level
+func checkCurrencyKYC(q limitQuerier, userID, currency string) error {
+	var level, required int
+	err := q.QueryRow(`
+		SELECT COALESCE(u.kyc_level, 0), COALESCE(r.min_kyc_level, 0)
+		FROM users u
+		LEFT JOIN kyc_currency_requirements r ON r.currency = $2
+		WHERE u.id = $1
+	`, userID, strings.ToUpper(currency)).Scan(&level, &required)
+	if err != nil {
+		return err
+	}
+
+	if level < required {
+		return &KYCCurrencyError{Code: "KYC_LEVEL_REQUIRED", Currency: strings.ToUpper(currency), Level: level, RequiredLevel: required}
+	}
+	return nil
+}
+
+// checkKYCLimits returns a *KYCLimitError when the amount would push the user over a KYC limit
+func checkKYCLimits(q limitQuerier, userID, currency string, amount decimal.Decimal) error {
+	limits, err := getKYCLimits(q, userID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no KYC limits configured for user %s", userID)
+	}
+	if err != nil {
+		return err
+	}
+
+	requested := toLimitCurrency(currency, amount)
+
+	if limits.TransactionLimit != nil && requested.GreaterThan(*limits.TransactionLimit) {
+		return &KYCLimitError{Limit: "TRANSACTION", Level: limits.Level, Max: *limits.TransactionLimit,
+			Used: decimal.Zero, Requested: requested, Currency: limits.Currency}
+	}
+
+	if limits.DailyLimit != nil {
+		used, err := getCompletedVolume(q, userID, "24 hours")
+		if err != nil {
+			return err
+		}
+		if used.Add(requested).GreaterThan(*limits.DailyLimit) {
+			return &KYCLimitError{Limit: "DAILY", Level: limits.Level, Max: *limits.DailyLimit,
+				Used: used, Requested: requested, Currency: limits.Currency}
+		}
+	}
+
+	if limits.MonthlyLimit != nil {
+		used, err := getCompletedVolume(q, userID, "30 days")
+		if err != nil {
+			return err
+		}
+		if used.Add(requested).GreaterThan(*limits.MonthlyLimit) {
+			return &KYCLimitError{Limit: "MONTHLY", Level: limits.Level, Max: *limits.MonthlyLimit,
+				Used: used, Requested: requested, Currency: limits.Currency}
+		}
+	}
+
+	return nil
+}
+
+// enforceKYCLimits writes the 403 response when the currency needs a higher KYC level or a limit is
+// hit; returns false if the request must stop
+func (s *Server) enforceKYCLimits(c *gin.Context, userID, currency string, amount decimal.Decimal) bool {
+	err := checkCurrencyKYC(s.db, userID, currency)
+	if err == nil {
+		err = checkKYCLimits(s.db, userID, currency, amount)
+	}
+	if err == nil {
+		return true
+	}
+
+	if currencyErr, ok := err.(*KYCCurrencyError); ok {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   currencyErr.Error(),
+			"code":    currencyErr.Code,
+			"details": currencyErr,
+		})
+		return false
+	}
+
+	if limitErr, ok := err.(*KYCLimitError); ok {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   limitErr.Error(),
+			"details": limitErr,
+		})
+		return false
+	}
+
+	log.Printf("❌ Failed to check KYC limits for user %s: %v", userID, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify KYC limits"})
+	return false
+}
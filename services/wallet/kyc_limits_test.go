@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+)
+
+var kycLimitColumns = []string{"limit_currency", "monthly_limit", "daily_limit", "transaction_limit"}
+
+func TestCheckKYCLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		currency    string
+		amount      int64
+		perTx       interface{}
+		daily       interface{}
+		monthly     interface{}
+		usedDaily   string // empty when the daily window must not be queried
+		usedMonthly string // empty when the monthly window must not be queried
+		wantLimit   string // empty when the transaction is allowed
+	}{
+		{name: "within every limit", currency: "BOB", amount: 500, perTx: "1000", daily: "5000", monthly: "20000",
+			usedDaily: "1000", usedMonthly: "10000"},
+		{name: "single transaction too large", currency: "BOB", amount: 1500, perTx: "1000", daily: "5000", monthly: "20000",
+			wantLimit: "TRANSACTION"},
+		{name: "USD counted in BOB", currency: "USD", amount: 150, perTx: "1000", wantLimit: "TRANSACTION"},
+		{name: "daily volume", currency: "BOB", amount: 500, perTx: "1000", daily: "5000", monthly: "20000",
+			usedDaily: "4600", wantLimit: "DAILY"},
+		{name: "monthly volume", currency: "BOB", amount: 500, daily: "5000", monthly: "20000",
+			usedDaily: "0", usedMonthly: "19600", wantLimit: "MONTHLY"},
+		{name: "unlimited level", currency: "USD", amount: 100000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(`SELECT COALESCE\(kyc_level, 0\) FROM users`).WithArgs("user-1").
+				WillReturnRows(sqlmock.NewRows([]string{"kyc_level"}).AddRow(1))
+			mock.ExpectQuery(`FROM kyc_level_limits`).WithArgs(1).
+				WillReturnRows(sqlmock.NewRows(kycLimitColumns).AddRow("BOB", tt.monthly, tt.daily, tt.perTx))
+			if tt.usedDaily != "" {
+				mock.ExpectQuery(`FROM transactions`).WithArgs("user-1", "24 hours").
+					WillReturnRows(sqlmock.NewRows([]string{"currency", "sum"}).AddRow("BOB", tt.usedDaily))
+			}
+			if tt.usedMonthly != "" {
+				mock.ExpectQuery(`FROM transactions`).WithArgs("user-1", "30 days").
+					WillReturnRows(sqlmock.NewRows([]string{"currency", "sum"}).AddRow("BOB", tt.usedMonthly))
+			}
+
+			err = checkKYCLimits(db, "user-1", tt.currency, decimal.NewFromInt(tt.amount))
+			limitErr, _ := err.(*KYCLimitError)
+			switch {
+			case tt.wantLimit == "" && err != nil:
+				t.Fatalf("checkKYCLimits() error = %v, want allowed", err)
+			case tt.wantLimit != "" && limitErr == nil:
+				t.Fatalf("checkKYCLimits() error = %v, want %s limit", err, tt.wantLimit)
+			case limitErr != nil && limitErr.Limit != tt.wantLimit:
+				t.Errorf("limit = %s, want %s", limitErr.Limit, tt.wantLimit)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestGetCompletedVolumeConvertsToLimitCurrency(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM transactions`).WithArgs("user-1", "24 hours").
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "sum"}).
+			AddRow("BOB", "100").AddRow("USD", "10").AddRow("USDT", "20"))
+
+	used, err := getCompletedVolume(db, "user-1", "24 hours")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 100 BOB + 30 dollars at the 6.90 reference rate
+	if want := decimal.RequireFromString("307"); !used.Equal(want) {
+		t.Errorf("getCompletedVolume() = %s, want %s", used, want)
+	}
+}
+
+func TestCheckCurrencyKYC(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		required int
+		wantErr  bool
+	}{
+		{name: "USDT needs level 2", currency: "usdt", required: 2, wantErr: true},
+		{name: "BOB open to every level", currency: "BOB", required: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(`LEFT JOIN kyc_currency_requirements`).WithArgs("user-1", strings.ToUpper(tt.currency)).
+				WillReturnRows(sqlmock.NewRows([]string{"kyc_level", "min_kyc_level"}).AddRow(1, tt.required))
+
+			err = checkCurrencyKYC(db, "user-1", tt.currency)
+			currencyErr, _ := err.(*KYCCurrencyError)
+			if tt.wantErr != (currencyErr != nil) {
+				t.Fatalf("checkCurrencyKYC() error = %v, want blocked %v", err, tt.wantErr)
+			}
+			if currencyErr != nil && (currencyErr.Currency != "USDT" || currencyErr.Level != 1 || currencyErr.RequiredLevel != 2) {
+				t.Errorf("checkCurrencyKYC() error = %+v", currencyErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -1,24 +1,33 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 	"github.com/shopspring/decimal"
 	_ "github.com/lib/pq"
+
+	"shared/dbpool"
 )
 
 type Server struct {
-	db              *sql.DB
-	router          *gin.Engine
-	bankIntegration *BankIntegration
+	db               *sql.DB
+	router           *gin.Engine
+	bankIntegration  *BankIntegration
+	withdrawalRouter *WithdrawalRouter
+	qrStorage        *QRStorage
+	rates            *RateProvider
+	redis            *redis.Client
 }
 
 func main() {
@@ -37,6 +46,7 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 	defer db.Close()
+	dbpool.Configure(db)
 
 	// Test database connection
 	if err := db.Ping(); err != nil {
@@ -64,15 +74,39 @@ func main() {
 	// Initialize bank integration
 	bankIntegration := NewBankIntegration(db, rdb, listenerURL)
 
+	// Exchange rates behind every valuation in BOB
+	exchangeRates = NewRateProvider(rdb)
+
 	// Create server
 	server := &Server{
 		db:              db,
 		router:          gin.Default(),
 		bankIntegration: bankIntegration,
+		qrStorage:       NewQRStorage(),
+		rates:           exchangeRates,
+		redis:           rdb,
 	}
 
+	server.withdrawalRouter = NewWithdrawalRouter(server)
+	
 	// Start bank integration
 	bankIntegration.Start()
+	
+	// Track external confirmation of outgoing withdrawals
+	go server.monitorWithdrawals()
+	
+	// Alert on wallets driven negative
+	go server.monitorBalances()
+	
+	// Auto-convert proceeds of P2P sells settled by the p2p service
+	go server.consumeOrderEvents()
+
+	// Background work stops when the service is asked to shut down
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	
+	// Keep exchange rates fresh from the configured provider
+	go server.rates.Start(ctx)
 
 	// Setup routes
 	server.setupRoutes()
@@ -83,39 +117,70 @@ func main() {
 		port = "3003"
 	}
 
-	log.Printf("Wallet service starting on port %s", port)
-	if err := server.router.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	httpServer := &http.Server{Addr: ":" + port, Handler: server.router}
+	go func() {
+		log.Printf("Wallet service starting on port %s", port)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Printf("Wallet service shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error during shutdown: %v", err)
 	}
 }
 
 func (s *Server) setupRoutes() {
-	// Health check
-	s.router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "healthy", "service": "wallet"})
-	})
+	setupMetrics(s.router, "wallet",
+		countGauge(s.db, "wallet_pending_deposits", "Deposits started but not credited yet.",
+			`SELECT COUNT(*) FROM transactions WHERE transaction_type = 'DEPOSIT' AND status IN ('PENDING', 'PROCESSING')`),
+		countGauge(s.db, "wallet_processing_withdrawals", "Withdrawals submitted to a processor and not settled yet.",
+			`SELECT COUNT(*) FROM transactions WHERE transaction_type = 'WITHDRAWAL' AND status IN ('PENDING', 'PROCESSING')`),
+		countGauge(s.db, "wallet_withdrawals_pending_approval", "Large withdrawals waiting for an admin decision.",
+			`SELECT COUNT(*) FROM transactions WHERE transaction_type = 'WITHDRAWAL' AND status = 'PENDING_APPROVAL'`),
+	)
+	s.router.Use(requestIDMiddleware())
+
+	// Health checks
+	setupHealthRoutes(s.router, "wallet", databaseCheck(s.db), redisCheck(s.redis))
 
 	// API routes
 	api := s.router.Group("/api/v1")
 	{
 		// Public routes
 		api.GET("/rates", s.handleGetExchangeRates)
+		api.GET("/attestations/reserves", s.handleGetReserveAttestation)
+		api.GET("/attestations/public-key", s.handleGetAttestationPublicKey)
 		
 		// Protected routes
 		api.GET("/wallets", s.authMiddleware(), s.handleGetWallets)
 		api.GET("/wallets/:currency", s.authMiddleware(), s.handleGetWalletByCurrency)
 		api.GET("/transactions", s.authMiddleware(), s.handleGetTransactions)
+		api.GET("/transactions/export", s.authMiddleware(), s.handleExportTransactions)
 		api.GET("/transactions/:id", s.authMiddleware(), s.handleGetTransaction)
+		api.POST("/transactions/:id/tags", s.authMiddleware(), s.handleAddTransactionTags)
+		api.DELETE("/transactions/:id/tags/:tag", s.authMiddleware(), s.handleDeleteTransactionTag)
 		
 		// Transaction operations
 		api.POST("/deposit", s.authMiddleware(), s.handleDeposit)
+		api.POST("/deposits/:id/amend", s.authMiddleware(), s.handleAmendDeposit)
 		api.POST("/withdraw", s.authMiddleware(), s.handleWithdrawal)
 		api.POST("/transfer", s.authMiddleware(), s.handleTransfer)
+		api.POST("/confirmations/requirements", s.authMiddleware(), s.handleGetConfirmationRequirements)
+		api.POST("/confirmations/otp", s.authMiddleware(), s.handleRequestTransactionOTP)
 		api.POST("/convert", s.authMiddleware(), s.handleConvert)
+		api.GET("/auto-convert", s.authMiddleware(), s.handleGetAutoConvertPreference)
+		api.PUT("/auto-convert", s.authMiddleware(), s.handleUpdateAutoConvertPreference)
 		
 		// Bank integration endpoints
 		api.GET("/deposit-instructions/:currency", s.authMiddleware(), s.handleGetDepositInstructions)
 		api.GET("/deposit-qr/:currency", s.authMiddleware(), s.handleGetDepositQR)
+		api.GET("/deposit-qr/:currency/image", s.handleGetDepositQRImage)
 		api.GET("/pending-deposits", s.authMiddleware(), s.handleGetPendingDeposits)
 		
 		// Admin endpoints for QR management
@@ -124,26 +189,54 @@ func (s *Server) setupRoutes() {
 			admin.GET("/deposit-qr", s.handleAdminGetAllQR)
 			admin.POST("/deposit-qr", s.handleAdminUploadQR)
 			admin.DELETE("/deposit-qr/:id", s.handleAdminDeleteQR)
+			
+			// Bank accounts shown in deposit instructions
+			admin.GET("/deposit-accounts", s.handleAdminGetDepositAccounts)
+			admin.POST("/deposit-accounts", s.handleAdminCreateDepositAccount)
+			admin.POST("/deposit-accounts/:id/toggle", s.handleAdminToggleDepositAccount)
+			admin.DELETE("/deposit-accounts/:id", s.handleAdminDeleteDepositAccount)
+			
+			// System alerts raised by background workers
+			admin.GET("/alerts", s.handleAdminGetAlerts)
+			admin.POST("/alerts/:id/acknowledge", s.handleAdminAcknowledgeAlert)
+			admin.POST("/alerts/:id/resolve", s.handleAdminResolveAlert)
+			admin.GET("/negative-balances", s.handleAdminGetNegativeBalances)
+			
+			// Withdrawals handled by the manual processor
+			admin.POST("/withdrawals/:id/complete", s.handleAdminCompleteWithdrawal)
+			admin.POST("/withdrawals/:id/fail", s.handleAdminFailWithdrawal)
+			
+			// Large withdrawals waiting for approval
+			admin.GET("/withdrawals/pending", s.handleAdminGetPendingWithdrawals)
+			admin.POST("/withdrawals/:id/approve", s.handleAdminApproveWithdrawal)
+			admin.POST("/withdrawals/:id/reject", s.handleAdminRejectWithdrawal)
+			
+			// Daily exposure limits and the overrides that lift them
+			admin.GET("/exposure", s.handleAdminGetExposure)
+			admin.POST("/exposure/overrides", s.handleAdminCreateExposureOverride)
+			admin.DELETE("/exposure/overrides/:id", s.handleAdminRevokeExposureOverride)
+			
+			// Signed reserve attestations
+			admin.POST("/attestations/reserves", s.handleAdminCreateReserveAttestation)
+			
+			// Bank notifications and withdrawals that failed processing
+			admin.GET("/dead-letter", s.handleAdminGetDeadLetters)
+			admin.POST("/dead-letter/:id/replay", s.handleAdminReplayDeadLetter)
+			admin.POST("/dead-letter/:id/discard", s.handleAdminDiscardDeadLetter)
 		}
 		
 		// Payment integration webhooks (Bolivia only)
-		api.POST("/webhooks/bank", s.handleBankWebhook)
-	}
-}
-
-func (s *Server) handleGetExchangeRates(c *gin.Context) {
-	// Simulate real-time exchange rates
-	rates := gin.H{
-		"USD_BOB": 6.90,
-		"BOB_USD": 0.145,
-		"USD_USDT": 1.00,
-		"USDT_USD": 1.00,
-		"BOB_USDT": 0.145,
-		"USDT_BOB": 6.90,
-		"last_updated": "2024-01-15T10:30:00Z",
+		api.POST("/webhooks/bank", newWebhookGuard(s.db, "wallet").middleware(), s.handleBankWebhook)
+		
+		// Signed withdrawal status callbacks from processors
+		api.POST("/webhooks/withdrawals/:processor", s.handleWithdrawalCallback)
+		
+		// Sandbox routes, only available when SANDBOX_MODE=true
+		if sandboxEnabled() {
+			log.Printf("🧪 Sandbox mode enabled")
+			api.POST("/sandbox/bank-notifications", s.authMiddleware(), s.handleSandboxBankNotification)
+		}
 	}
-	
-	c.JSON(200, rates)
 }
 
 // DISABLED: PayPal not available in Bolivia
@@ -360,7 +453,8 @@ func (s *Server) handleGetDepositInstructions(c *gin.Context) {
 		}
 	}
 	
-	instructions, err := s.bankIntegration.GetDepositInstructions(userID, currency, amount)
+	// Without a deposit record the user's own reference is used, which still credits the right wallet
+	instructions, err := s.bankIntegration.GetDepositInstructions(currency, amount, "DEPOSIT-"+userID)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
@@ -376,15 +470,15 @@ func (s *Server) handleGetDepositQR(c *gin.Context) {
 	currency := c.Param("currency")
 	
 	// Get QR code from database
-	var qrImageURL, qrDescription string
+	var qrDescription string
 	var amountFixed sql.NullFloat64
 	
 	err := s.db.QueryRow(`
-		SELECT qr_image_url, qr_description, amount_fixed
+		SELECT qr_description, amount_fixed
 		FROM deposit_qr_codes 
 		WHERE currency = $1 AND is_active = true 
 		LIMIT 1
-	`, currency).Scan(&qrImageURL, &qrDescription, &amountFixed)
+	`, currency).Scan(&qrDescription, &amountFixed)
 	
 	if err != nil {
 		c.JSON(404, gin.H{"error": "No QR code available for " + currency})
@@ -393,7 +487,7 @@ func (s *Server) handleGetDepositQR(c *gin.Context) {
 	
 	response := gin.H{
 		"currency":    currency,
-		"qr_image_url": qrImageURL,
+		"qr_image_url": qrImagePath(currency),
 		"description": qrDescription,
 		"method":      "QR",
 	}
@@ -465,6 +559,11 @@ func (s *Server) handleAdminGetAllQR(c *gin.Context) {
 			continue
 		}
 		
+		// Only the active QR of a currency is served by the image endpoint
+		if isActive {
+			qrImageURL = qrImagePath(currency)
+		}
+		
 		qrCode := map[string]interface{}{
 			"id":            id,
 			"currency":      currency,
@@ -510,25 +609,19 @@ func (s *Server) handleAdminUploadQR(c *gin.Context) {
 		return
 	}
 	
-	// Save file (in production, you'd save to cloud storage)
-	filename := fmt.Sprintf("qr_%s_%d%s", 
-		strings.ToLower(currency), 
-		time.Now().Unix(), 
-		filepath.Ext(file.Filename))
-	
-	uploadPath := "/tmp/uploads/" + filename
-	
-	// Create upload directory if it doesn't exist
-	os.MkdirAll("/tmp/uploads", 0755)
+	if file.Size > maxQRImageSize {
+		c.JSON(400, gin.H{"error": "File too large (max 5MB)"})
+		return
+	}
 	
-	if err := c.SaveUploadedFile(file, uploadPath); err != nil {
+	// The object key is stored; clients load the image through the wallet service
+	objectKey, err := s.qrStorage.save(c, currency, "qr_image")
+	if err != nil {
+		requestLog(c).Printf("❌ Error storing QR image for %s: %v", currency, err)
 		c.JSON(500, gin.H{"error": "Failed to save file"})
 		return
 	}
 	
-	// In production, you'd upload to cloud storage and get public URL
-	publicURL := "/uploads/" + filename
-	
 	if description == "" {
 		description = fmt.Sprintf("Escanea este QR para depositar %s", currency)
 	}
@@ -540,6 +633,7 @@ func (s *Server) handleAdminUploadQR(c *gin.Context) {
 		WHERE currency = $1 AND is_active = TRUE
 	`, currency)
 	if err != nil {
+		s.qrStorage.remove(objectKey)
 		c.JSON(500, gin.H{"error": "Failed to update existing QR codes"})
 		return
 	}
@@ -551,20 +645,26 @@ func (s *Server) handleAdminUploadQR(c *gin.Context) {
 		INSERT INTO deposit_qr_codes (currency, qr_image_url, qr_description, created_by)
 		VALUES ($1, $2, $3, $4)
 		RETURNING id
-	`, currency, publicURL, description, userID).Scan(&qrID)
+	`, currency, objectKey, description, userID).Scan(&qrID)
 	
 	if err != nil {
+		s.qrStorage.remove(objectKey)
 		c.JSON(500, gin.H{"error": "Failed to save QR code"})
 		return
 	}
 	
+	s.recordAuditLog(c, userID, "DEPOSIT_QR_UPLOAD", "deposit_qr", qrID, map[string]interface{}{
+		"currency":    currency,
+		"description": description,
+	})
+	
 	c.JSON(200, gin.H{
 		"status":  "success",
 		"message": "QR code uploaded successfully",
 		"data": gin.H{
 			"id":           qrID,
 			"currency":     currency,
-			"qr_image_url": publicURL,
+			"qr_image_url": qrImagePath(currency),
 			"description":  description,
 		},
 	})
@@ -574,21 +674,26 @@ func (s *Server) handleAdminUploadQR(c *gin.Context) {
 func (s *Server) handleAdminDeleteQR(c *gin.Context) {
 	qrID := c.Param("id")
 	
-	result, err := s.db.Exec(`
+	var objectKey, currency string
+	err := s.db.QueryRow(`
 		DELETE FROM deposit_qr_codes 
 		WHERE id = $1
-	`, qrID)
+		RETURNING qr_image_url, currency
+	`, qrID).Scan(&objectKey, &currency)
 	
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "QR code not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 	
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(404, gin.H{"error": "QR code not found"})
-		return
-	}
+	s.qrStorage.remove(objectKey)
+	s.recordAuditLog(c, c.GetString("user_id"), "DEPOSIT_QR_DELETE", "deposit_qr", qrID, map[string]interface{}{
+		"currency": currency,
+	})
 	
 	c.JSON(200, gin.H{
 		"status":  "success",
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// With DEPOSIT_ORDER_FUNDING_ENABLED=true a deposit can be opened for one of the user's BUY
+// orders. The deposit must cover what the order costs; once the transfer clears the wallet is
+// credited as usual and the order moves on by itself: a MATCHED order goes to PROCESSING, as if
+// the buyer had marked it paid, and a PENDING one is flagged funded so the cashier's acceptance
+// takes it straight to PROCESSING. Either way the order's cost moves from the buyer's balance to
+// locked_balance in the same transaction, recorded in orders.buyer_locked_amount, so it cannot
+// be withdrawn before the p2p service settles the order from the locked balance.
+
+var errFundingOrderNotFound = errors.New("order not found or not open for funding")
+
+func orderFundingEnabled() bool {
+	return os.Getenv("DEPOSIT_ORDER_FUNDING_ENABLED") == "true"
+}
+
+// fundingOrderCost returns what the buyer pays for a BUY order of theirs that can still be funded
+func fundingOrderCost(db queryRower, userID, orderID string) (string, decimal.Decimal, error) {
+	var currencyFrom string
+	var amount, rate decimal.Decimal
+	err := db.QueryRow(`
+		SELECT currency_from, amount, rate FROM orders
+		WHERE id::text = $1 AND user_id = $2 AND order_type = 'BUY'
+			AND status IN ('PENDING', 'MATCHED') AND funded_at IS NULL
+	`, orderID, userID).Scan(&currencyFrom, &amount, &rate)
+	if err != nil {
+		return "", decimal.Zero, errFundingOrderNotFound
+	}
+	return currencyFrom, amount.Mul(rate), nil
+}
+
+// validateFundingOrder checks a deposit about to be opened for an order can pay for it
+func validateFundingOrder(db queryRower, userID, orderID, currency string, amount decimal.Decimal) error {
+	currencyFrom, cost, err := fundingOrderCost(db, userID, orderID)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(currencyFrom, currency) {
+		return fmt.Errorf("order is paid in %s, deposit is in %s", currencyFrom, currency)
+	}
+	if amount.LessThan(cost) {
+		return fmt.Errorf("deposit of %s %s does not cover the order cost of %s %s",
+			amount.String(), currency, cost.String(), currencyFrom)
+	}
+	return nil
+}
+
+// fundOrderFromDeposit advances the order a cleared deposit was opened for. Deposits that no
+// longer cover the order, or whose order moved on meanwhile, just stay in the wallet.
+func (bi *BankIntegration) fundOrderFromDeposit(tx *sql.Tx, userID, reference string, deposited decimal.Decimal, currency string) error {
+	var depositID string
+	var orderID sql.NullString
+	err := tx.QueryRow(`
+		SELECT id, funding_order_id FROM transactions
+		WHERE deposit_reference = $1 AND user_id = $2 AND transaction_type = 'DEPOSIT'
+	`, reference, userID).Scan(&depositID, &orderID)
+	if err != nil || !orderID.Valid {
+		return nil
+	}
+
+	currencyFrom, cost, err := fundingOrderCost(tx, userID, orderID.String)
+	if err != nil {
+		log.Printf("⚠️ Deposit %s cleared but order %s can no longer be funded", reference, orderID.String)
+		return nil
+	}
+	if !strings.EqualFold(currencyFrom, currency) || deposited.LessThan(cost) {
+		log.Printf("⚠️ Deposit %s of %s %s does not cover order %s (%s %s), left in wallet",
+			reference, deposited.String(), currency, orderID.String, cost.String(), currencyFrom)
+		return nil
+	}
+
+	result, err := tx.Exec(`
+		UPDATE wallets
+		SET balance = balance - $1, locked_balance = COALESCE(locked_balance, 0) + $1, updated_at = NOW()
+		WHERE user_id = $2 AND currency = $3 AND balance >= $1
+	`, cost, userID, currencyFrom)
+	if err != nil {
+		return fmt.Errorf("failed to lock funds for order %s: %v", orderID.String, err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		log.Printf("⚠️ Deposit %s cleared but the balance cannot cover order %s (%s %s), left in wallet",
+			reference, orderID.String, cost.String(), currencyFrom)
+		return nil
+	}
+
+	var status string
+	err = tx.QueryRow(`
+		UPDATE orders SET
+			funding_deposit_id = $1,
+			funded_at = NOW(),
+			buyer_locked_amount = $3,
+			status = CASE WHEN status = 'MATCHED' THEN 'PROCESSING' ELSE status END,
+			updated_at = NOW()
+		WHERE id = $2
+		RETURNING status
+	`, depositID, orderID.String, cost).Scan(&status)
+	if err != nil {
+		return fmt.Errorf("failed to fund order %s: %v", orderID.String, err)
+	}
+
+	if status == "PROCESSING" {
+		tx.Exec(`UPDATE p2p_orders SET status = 'PROCESSING', updated_at = NOW() WHERE id = $1`, orderID.String)
+	}
+
+	log.Printf("🔗 Deposit %s funded order %s (now %s)", reference, orderID.String, status)
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+)
+
+const fundingLockSQL = `UPDATE wallets\s+SET balance = balance - \$1, locked_balance = COALESCE\(locked_balance, 0\) \+ \$1, updated_at = NOW\(\)\s+WHERE user_id = \$2 AND currency = \$3 AND balance >= \$1`
+
+// expectFundingOrder returns a deposit opened for a BUY order of 100 USD at 6.90, costing 690 BOB
+func expectFundingOrder(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`SELECT id, funding_order_id FROM transactions`).WithArgs("DEP-1", "user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "funding_order_id"}).AddRow("deposit-1", "order-1"))
+	mock.ExpectQuery(`SELECT currency_from, amount, rate FROM orders`).WithArgs("order-1", "user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"currency_from", "amount", "rate"}).AddRow("BOB", "100", "6.90"))
+}
+
+func runFundOrderFromDeposit(t *testing.T, deposited string, expect func(sqlmock.Sqlmock)) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expect(mock)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bi := &BankIntegration{}
+	if err := bi.fundOrderFromDeposit(tx, "user-1", "DEP-1", decimal.RequireFromString(deposited), "BOB"); err != nil {
+		t.Fatalf("fundOrderFromDeposit() error = %v", err)
+	}
+	// Any statement not expected above fails the mock
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFundOrderFromDeposit(t *testing.T) {
+	cost := decimal.RequireFromString("690")
+
+	t.Run("locks the order cost and moves the order on", func(t *testing.T) {
+		runFundOrderFromDeposit(t, "700", func(mock sqlmock.Sqlmock) {
+			expectFundingOrder(mock)
+			mock.ExpectExec(fundingLockSQL).WithArgs(cost, "user-1", "BOB").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(`UPDATE orders SET\s+funding_deposit_id = \$1,\s+funded_at = NOW\(\),\s+buyer_locked_amount = \$3`).
+				WithArgs("deposit-1", "order-1", cost).
+				WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("PROCESSING"))
+			mock.ExpectExec(`UPDATE p2p_orders SET status = 'PROCESSING'`).WithArgs("order-1").WillReturnResult(sqlmock.NewResult(0, 1))
+		})
+	})
+
+	t.Run("deposit short of the cost stays in the wallet", func(t *testing.T) {
+		runFundOrderFromDeposit(t, "600", expectFundingOrder)
+	})
+
+	t.Run("balance that cannot cover the cost leaves the order alone", func(t *testing.T) {
+		runFundOrderFromDeposit(t, "700", func(mock sqlmock.Sqlmock) {
+			expectFundingOrder(mock)
+			mock.ExpectExec(fundingLockSQL).WithArgs(cost, "user-1", "BOB").WillReturnResult(sqlmock.NewResult(0, 0))
+		})
+	})
+}
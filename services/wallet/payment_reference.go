@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// P2P payment references, "P2P-{MATCH_ID}-{USER_ID}", and legacy deposit references,
+// "DEPOSIT-{USER_ID}", carry ids that themselves contain dashes, so they cannot be split on "-".
+// The user id is always a UUID and is anchored at the end of the reference; the match id is
+// whatever lies between the prefix and it. Banks tend to upper-case the transfer concept, so the
+// ids are handed back lower-cased, the way they are stored.
+
+const uuidPattern = `[0-9A-F]{8}-[0-9A-F]{4}-[0-9A-F]{4}-[0-9A-F]{4}-[0-9A-F]{12}`
+
+var (
+	p2pPaymentReferencePattern = regexp.MustCompile(`^P2P-([0-9A-Z_]+(?:-[0-9A-Z_]+)*)-(` + uuidPattern + `)$`)
+	legacyDepositRefPattern    = regexp.MustCompile(`^DEPOSIT-(` + uuidPattern + `)$`)
+)
+
+func formatP2PPaymentReference(matchID, userID string) string {
+	return strings.ToUpper(fmt.Sprintf("P2P-%s-%s", matchID, userID))
+}
+
+// parseP2PPaymentReference recovers the match and user ids of a P2P payment reference
+func parseP2PPaymentReference(ref string) (matchID, userID string, ok bool) {
+	groups := p2pPaymentReferencePattern.FindStringSubmatch(normalizeReference(ref))
+	if groups == nil {
+		return "", "", false
+	}
+	return strings.ToLower(groups[1]), strings.ToLower(groups[2]), true
+}
+
+// parseLegacyDepositReference recovers the user id of a "DEPOSIT-{USER_ID}" reference
+func parseLegacyDepositReference(ref string) (userID string, ok bool) {
+	groups := legacyDepositRefPattern.FindStringSubmatch(normalizeReference(ref))
+	if groups == nil {
+		return "", false
+	}
+	return strings.ToLower(groups[1]), true
+}
+
+func normalizeReference(ref string) string {
+	return strings.ToUpper(strings.TrimSpace(ref))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// newTestUUID returns a random version 4 UUID in the lower-case form Postgres stores
+func newTestUUID(t *testing.T) string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func TestP2PPaymentReferenceRoundTrip(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		matchID, userID := newTestUUID(t), newTestUUID(t)
+		ref := formatP2PPaymentReference(matchID, userID)
+
+		// Banks hand the concept back upper-cased, lower-cased or padded
+		for _, received := range []string{ref, strings.ToLower(ref), "  " + ref + "\n"} {
+			gotMatch, gotUser, ok := parseP2PPaymentReference(received)
+			if !ok || gotMatch != matchID || gotUser != userID {
+				t.Fatalf("parseP2PPaymentReference(%q) = %q, %q, %v; want %q, %q", received, gotMatch, gotUser, ok, matchID, userID)
+			}
+		}
+	}
+}
+
+func TestParseP2PPaymentReference(t *testing.T) {
+	userID := "0b6f3c1e-5d2a-4f8e-9c7b-1a2b3c4d5e6f"
+
+	tests := []struct {
+		ref       string
+		wantMatch string
+		wantOK    bool
+	}{
+		{ref: "P2P-MATCH_42-" + userID, wantMatch: "match_42", wantOK: true},
+		{ref: "P2P-2024-11-ABC-" + userID, wantMatch: "2024-11-abc", wantOK: true},
+		{ref: "P2P-" + userID, wantOK: false},                     // no match id
+		{ref: "P2P--" + userID, wantOK: false},                    // empty match id
+		{ref: "P2P-MATCH-0b6f3c1e-5d2a-4f8e-9c7b", wantOK: false}, // truncated user id
+		{ref: "DEPOSIT-" + userID, wantOK: false},
+		{ref: "P2P-MATCH 1-" + userID, wantOK: false},
+		{ref: "XP2P-MATCH-" + userID, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		matchID, gotUser, ok := parseP2PPaymentReference(tt.ref)
+		if ok != tt.wantOK || (ok && (matchID != tt.wantMatch || gotUser != userID)) {
+			t.Errorf("parseP2PPaymentReference(%q) = %q, %q, %v; want %q, %v", tt.ref, matchID, gotUser, ok, tt.wantMatch, tt.wantOK)
+		}
+	}
+}
+
+func TestParseLegacyDepositReference(t *testing.T) {
+	userID := newTestUUID(t)
+	if got, ok := parseLegacyDepositReference("deposit-" + strings.ToUpper(userID)); !ok || got != userID {
+		t.Errorf("parseLegacyDepositReference() = %q, %v; want %q", got, ok, userID)
+	}
+
+	for _, ref := range []string{"DEPOSIT-", "DEPOSIT-" + userID + "-1", "DEPOSIT-" + userID[:30], "DEP-0000123-2"} {
+		if _, ok := parseLegacyDepositReference(ref); ok {
+			t.Errorf("parseLegacyDepositReference(%q) accepted", ref)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Deposit references (bank reference, QR payload, crypto address) are honoured for this long
+const depositReferenceTTL = 24 * time.Hour
+
+// Status reasons reported for deposits that have not been credited yet
+const (
+	DepositAwaitingTransfer  = "AWAITING_TRANSFER"
+	DepositUnderReview       = "UNDER_REVIEW"
+	DepositMatchedProcessing = "MATCHED_PROCESSING"
+	DepositReferenceExpired  = "REFERENCE_EXPIRED"
+)
+
+// Typical clearing time per method, used until there is enough history to estimate it
+var defaultDepositClearingTimes = map[string]time.Duration{
+	"BANK":   2 * time.Hour,
+	"QR":     15 * time.Minute,
+	"PAYPAL": 30 * time.Minute,
+	"STRIPE": 30 * time.Minute,
+}
+
+// Completed deposits needed before historical data replaces the default clearing time
+const minDepositHistorySamples = 5
+
+type PendingDeposit struct {
+	ID                  string          `json:"id"`
+	Currency            string          `json:"currency"`
+	Amount              decimal.Decimal `json:"amount"`
+	Status              string          `json:"status"`
+	Method              string          `json:"method"`
+	Reference           string          `json:"reference,omitempty"`
+	StatusReason        string          `json:"status_reason"`
+	StatusMessage       string          `json:"status_message"`
+	EstimatedClearingAt time.Time       `json:"estimated_clearing_at"`
+	EstimateSource      string          `json:"estimate_source"` // HISTORICAL or DEFAULT
+	ExpiresAt           time.Time       `json:"expires_at"`
+	CreatedAt           time.Time       `json:"created_at"`
+	UpdatedAt           time.Time       `json:"updated_at"`
+}
+
+// GetPendingDeposits lists the user's deposits that were initiated but not credited yet, with
+// the reason they are still pending and when they are expected to clear
+func (bi *BankIntegration) GetPendingDeposits(userID string) ([]PendingDeposit, error) {
+	rows, err := bi.db.Query(`
+		SELECT id, currency, amount, status, COALESCE(method, ''), COALESCE(deposit_reference, external_ref, ''),
+			created_at, updated_at
+		FROM transactions
+		WHERE user_id = $1 AND transaction_type = 'DEPOSIT' AND status IN ('PENDING', 'PROCESSING')
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deposits := []PendingDeposit{}
+	for rows.Next() {
+		var deposit PendingDeposit
+		err := rows.Scan(&deposit.ID, &deposit.Currency, &deposit.Amount, &deposit.Status, &deposit.Method,
+			&deposit.Reference, &deposit.CreatedAt, &deposit.UpdatedAt)
+		if err != nil {
+			continue
+		}
+		deposit.ExpiresAt = deposit.CreatedAt.Add(depositReferenceTTL)
+		deposits = append(deposits, deposit)
+	}
+
+	now := time.Now()
+	estimates := make(map[string]time.Duration)
+	sources := make(map[string]string)
+
+	for i := range deposits {
+		deposit := &deposits[i]
+
+		key := deposit.Method + ":" + deposit.Currency
+		if _, ok := estimates[key]; !ok {
+			estimates[key], sources[key] = bi.estimateDepositClearingTime(deposit.Method, deposit.Currency)
+		}
+		deposit.EstimatedClearingAt = deposit.CreatedAt.Add(estimates[key])
+		deposit.EstimateSource = sources[key]
+
+		switch {
+		case deposit.Status == "PROCESSING":
+			deposit.StatusReason = DepositMatchedProcessing
+			deposit.StatusMessage = "Payment received and matched, crediting your wallet"
+		case now.After(deposit.ExpiresAt):
+			deposit.StatusReason = DepositReferenceExpired
+			deposit.StatusMessage = "The deposit reference expired before a payment was received"
+		case now.After(deposit.EstimatedClearingAt):
+			deposit.StatusReason = DepositUnderReview
+			deposit.StatusMessage = "Taking longer than usual, our team is checking the transfer"
+		default:
+			deposit.StatusReason = DepositAwaitingTransfer
+			deposit.StatusMessage = "Waiting for your transfer to reach our account"
+		}
+
+		// A deposit that is late but still valid is expected to clear soon, not in the past
+		if deposit.StatusReason != DepositReferenceExpired && deposit.EstimatedClearingAt.Before(now) {
+			deposit.EstimatedClearingAt = now.Add(estimates[key] / 4)
+		}
+	}
+
+	return deposits, nil
+}
+
+// estimateDepositClearingTime uses the median time completed deposits took over the last 30 days
+func (bi *BankIntegration) estimateDepositClearingTime(method, currency string) (time.Duration, string) {
+	var medianSeconds float64
+	var samples int
+	err := bi.db.QueryRow(`
+		SELECT COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM (updated_at - created_at))), 0),
+			COUNT(*)
+		FROM transactions
+		WHERE transaction_type = 'DEPOSIT' AND status = 'COMPLETED'
+			AND method = $1 AND currency = $2
+			AND created_at > NOW() - INTERVAL '30 days'
+	`, method, currency).Scan(&medianSeconds, &samples)
+
+	if err == nil && samples >= minDepositHistorySamples && medianSeconds > 0 {
+		return time.Duration(medianSeconds * float64(time.Second)), "HISTORICAL"
+	}
+
+	if fallback, ok := defaultDepositClearingTimes[method]; ok {
+		return fallback, "DEFAULT"
+	}
+	return defaultDepositClearingTimes["BANK"], "DEFAULT"
+}
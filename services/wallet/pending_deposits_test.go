@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestGetPendingDeposits(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	columns := []string{"id", "currency", "amount", "status", "method", "reference", "created_at", "updated_at"}
+	mock.ExpectQuery(`FROM transactions\s+WHERE user_id = \$1 AND transaction_type = 'DEPOSIT'`).WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("fresh-qr", "BOB", "100", "PENDING", "QR", "QR-1", now.Add(-5*time.Minute), now.Add(-5*time.Minute)).
+			AddRow("matched", "BOB", "100", "PROCESSING", "BANK", "DEP-1", now.Add(-3*time.Hour), now).
+			AddRow("late", "BOB", "100", "PENDING", "BANK", "DEP-2", now.Add(-5*time.Hour), now.Add(-5*time.Hour)).
+			AddRow("expired", "BOB", "100", "PENDING", "BANK", "DEP-3", now.Add(-30*time.Hour), now.Add(-30*time.Hour)))
+
+	// Too few QR samples fall back to the default; BANK has history. Each method and currency is
+	// estimated once.
+	mock.ExpectQuery(`percentile_cont`).WithArgs("QR", "BOB").
+		WillReturnRows(sqlmock.NewRows([]string{"median", "count"}).AddRow(60.0, 2))
+	mock.ExpectQuery(`percentile_cont`).WithArgs("BANK", "BOB").
+		WillReturnRows(sqlmock.NewRows([]string{"median", "count"}).AddRow(3600.0, 10))
+
+	deposits, err := (&BankIntegration{db: db}).GetPendingDeposits("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	want := map[string]struct {
+		reason string
+		source string
+	}{
+		"fresh-qr": {DepositAwaitingTransfer, "DEFAULT"},
+		"matched":  {DepositMatchedProcessing, "HISTORICAL"},
+		"late":     {DepositUnderReview, "HISTORICAL"},
+		"expired":  {DepositReferenceExpired, "HISTORICAL"},
+	}
+	if len(deposits) != len(want) {
+		t.Fatalf("got %d deposits, want %d", len(deposits), len(want))
+	}
+
+	for _, deposit := range deposits {
+		if deposit.StatusReason != want[deposit.ID].reason || deposit.EstimateSource != want[deposit.ID].source {
+			t.Errorf("%s = %s (%s), want %s (%s)", deposit.ID, deposit.StatusReason, deposit.EstimateSource,
+				want[deposit.ID].reason, want[deposit.ID].source)
+		}
+		if !deposit.ExpiresAt.Equal(deposit.CreatedAt.Add(depositReferenceTTL)) {
+			t.Errorf("%s expires at %s, want 24h after creation", deposit.ID, deposit.ExpiresAt)
+		}
+
+		switch deposit.ID {
+		case "fresh-qr":
+			if !deposit.EstimatedClearingAt.Equal(deposit.CreatedAt.Add(15 * time.Minute)) {
+				t.Errorf("fresh-qr clears at %s, want the 15 minute QR default", deposit.EstimatedClearingAt)
+			}
+		case "expired":
+			if !deposit.EstimatedClearingAt.Equal(deposit.CreatedAt.Add(time.Hour)) {
+				t.Errorf("expired clears at %s, want the original estimate", deposit.EstimatedClearingAt)
+			}
+		default:
+			// Late deposits are re-estimated from now instead of showing a time in the past
+			if deposit.EstimatedClearingAt.Before(now) {
+				t.Errorf("%s clears at %s, in the past", deposit.ID, deposit.EstimatedClearingAt)
+			}
+		}
+	}
+}
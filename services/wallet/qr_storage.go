@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Max QR image upload size (5MB)
+const maxQRImageSize = 5 * 1024 * 1024
+
+// Rows created before QR images moved to object storage hold a gateway path
+const legacyQRPrefix = "/uploads/"
+
+// QRStorage keeps deposit QR images in MinIO, or on local disk when
+// QR_STORAGE_LOCAL is set (dev only, images are lost with the container)
+type QRStorage struct {
+	client   *minio.Client
+	bucket   string
+	local    bool
+	localDir string
+}
+
+func NewQRStorage() *QRStorage {
+	storage := &QRStorage{
+		bucket:   "deposit-qr",
+		local:    strings.EqualFold(os.Getenv("QR_STORAGE_LOCAL"), "true"),
+		localDir: "/tmp/uploads",
+	}
+	if value := os.Getenv("QR_BUCKET"); value != "" {
+		storage.bucket = value
+	}
+	if value := os.Getenv("QR_LOCAL_DIR"); value != "" {
+		storage.localDir = value
+	}
+
+	if storage.local {
+		log.Printf("⚠️ QR images stored on local disk at %s", storage.localDir)
+		return storage
+	}
+
+	endpoint := os.Getenv("MINIO_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "minio:9000"
+	}
+	accessKey := os.Getenv("MINIO_ACCESS_KEY")
+	if accessKey == "" {
+		accessKey = "minioadmin"
+	}
+	secretKey := os.Getenv("MINIO_SECRET_KEY")
+	if secretKey == "" {
+		secretKey = "minioadmin"
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: false,
+	})
+	if err != nil {
+		log.Printf("Warning: MinIO connection failed: %v", err)
+		return storage
+	}
+	storage.client = client
+	storage.ensureBucket()
+
+	return storage
+}
+
+func (q *QRStorage) ensureBucket() {
+	ctx := context.Background()
+	exists, err := q.client.BucketExists(ctx, q.bucket)
+	if err != nil {
+		log.Printf("Warning: could not check QR bucket: %v", err)
+		return
+	}
+	if !exists {
+		if err := q.client.MakeBucket(ctx, q.bucket, minio.MakeBucketOptions{}); err != nil {
+			log.Printf("Warning: could not create QR bucket: %v", err)
+		}
+	}
+}
+
+// save stores an uploaded QR image and returns its object key
+func (q *QRStorage) save(c *gin.Context, currency, filename string) (string, error) {
+	file, header, err := c.Request.FormFile(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	objectKey := fmt.Sprintf("%s/qr_%s_%s%s",
+		strings.ToLower(currency),
+		strings.ToLower(currency),
+		newRequestID(),
+		ext)
+
+	if q.local {
+		path := filepath.Join(q.localDir, filepath.FromSlash(objectKey))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return "", err
+		}
+		if err := c.SaveUploadedFile(header, path); err != nil {
+			return "", err
+		}
+		return objectKey, nil
+	}
+
+	if q.client == nil {
+		return "", fmt.Errorf("object storage unavailable")
+	}
+
+	_, err = q.client.PutObject(
+		c.Request.Context(),
+		q.bucket,
+		objectKey,
+		file,
+		header.Size,
+		minio.PutObjectOptions{ContentType: header.Header.Get("Content-Type")},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return objectKey, nil
+}
+
+// serve streams a stored QR image to the client
+func (q *QRStorage) serve(c *gin.Context, objectKey string) {
+	contentType := mime.TypeByExtension(filepath.Ext(objectKey))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	if q.local || strings.HasPrefix(objectKey, legacyQRPrefix) {
+		path := filepath.Join(q.localDir, filepath.FromSlash(strings.TrimPrefix(objectKey, legacyQRPrefix)))
+		if _, err := os.Stat(path); err != nil {
+			c.JSON(404, gin.H{"error": "QR image not found"})
+			return
+		}
+		c.Header("Cache-Control", "no-cache")
+		c.File(path)
+		return
+	}
+
+	if q.client == nil {
+		c.JSON(503, gin.H{"error": "File storage unavailable"})
+		return
+	}
+
+	object, err := q.client.GetObject(c.Request.Context(), q.bucket, objectKey, minio.GetObjectOptions{})
+	if err != nil {
+		requestLog(c).Printf("❌ Error reading QR image %s: %v", objectKey, err)
+		c.JSON(500, gin.H{"error": "Failed to read QR image"})
+		return
+	}
+	defer object.Close()
+
+	// Admins replace QR images in place, so clients revalidate on every load
+	c.DataFromReader(http.StatusOK, -1, contentType, object, map[string]string{
+		"Cache-Control": "no-cache",
+	})
+}
+
+// remove deletes a stored QR image; legacy files on the gateway volume are left alone
+func (q *QRStorage) remove(objectKey string) {
+	if objectKey == "" || strings.HasPrefix(objectKey, legacyQRPrefix) {
+		return
+	}
+
+	if q.local {
+		os.Remove(filepath.Join(q.localDir, filepath.FromSlash(objectKey)))
+		return
+	}
+	if q.client == nil {
+		return
+	}
+	if err := q.client.RemoveObject(context.Background(), q.bucket, objectKey, minio.RemoveObjectOptions{}); err != nil {
+		log.Printf("Warning: could not remove QR image %s: %v", objectKey, err)
+	}
+}
+
+// qrImagePath is the URL clients load a currency's active QR image from
+func qrImagePath(currency string) string {
+	return "/api/v1/deposit-qr/" + currency + "/image"
+}
+
+func (s *Server) handleGetDepositQRImage(c *gin.Context) {
+	currency := c.Param("currency")
+
+	var objectKey string
+	err := s.db.QueryRow(`
+		SELECT qr_image_url
+		FROM deposit_qr_codes
+		WHERE currency = $1 AND is_active = true
+		LIMIT 1
+	`, currency).Scan(&objectKey)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "No QR code available for " + currency})
+		return
+	}
+
+	s.qrStorage.serve(c, objectKey)
+}
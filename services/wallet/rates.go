@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/shopspring/decimal"
+)
+
+const ratesCacheKey = "wallet:exchange_rates"
+
+// Cached rates older than the TTL are still served (flagged stale) for this long, so a
+// provider outage degrades to the last known rates before the hardcoded ones
+const ratesStaleRetention = 24 * time.Hour
+
+// Served when the provider is not configured or nothing was fetched yet
+var fallbackRatesToBOB = map[string]decimal.Decimal{
+	"USD":  decimal.NewFromFloat(6.90),
+	"USDT": decimal.NewFromFloat(6.90),
+}
+
+// exchangeRates values every amount the service expresses in BOB: KYC and exposure limits,
+// confirmation thresholds and the reference rate of auto conversions. Set in main; without it
+// the fallback rates apply.
+var exchangeRates *RateProvider
+
+// rateToBOB returns the BOB value of one unit of currency
+func rateToBOB(currency string) (decimal.Decimal, bool) {
+	currency = strings.ToUpper(currency)
+	if currency == "BOB" {
+		return decimal.NewFromInt(1), true
+	}
+
+	toBOB := fallbackRatesToBOB
+	if exchangeRates != nil {
+		if latest := exchangeRates.latest(); latest != nil {
+			toBOB = latest.ToBOB
+		}
+	}
+	rate, ok := toBOB[currency]
+	return rate, ok
+}
+
+type cachedRates struct {
+	ToBOB     map[string]decimal.Decimal `json:"to_bob"`
+	FetchedAt time.Time                  `json:"fetched_at"`
+}
+
+// RateProvider polls RATES_PROVIDER_URL for the BOB price of USD and USDT and caches it in Redis.
+// The provider answers with {"USD_BOB": 6.96, "USDT_BOB": 6.97}, optionally wrapped in "rates".
+type RateProvider struct {
+	redis      *redis.Client
+	url        string
+	interval   time.Duration
+	ttl        time.Duration
+	httpClient *http.Client
+
+	// In-memory copy of the cached rates for the valuations above, reread once per interval
+	mu       sync.Mutex
+	memo     *cachedRates
+	memoRead time.Time
+}
+
+func NewRateProvider(rdb *redis.Client) *RateProvider {
+	p := &RateProvider{
+		redis:      rdb,
+		url:        os.Getenv("RATES_PROVIDER_URL"),
+		interval:   time.Minute,
+		ttl:        5 * time.Minute,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+	if value, err := strconv.Atoi(os.Getenv("RATES_REFRESH_SECONDS")); err == nil && value > 0 {
+		p.interval = time.Duration(value) * time.Second
+	}
+	if value, err := strconv.Atoi(os.Getenv("RATES_CACHE_TTL_SECONDS")); err == nil && value > 0 {
+		p.ttl = time.Duration(value) * time.Second
+	}
+	return p
+}
+
+// Start refreshes the cached rates on every tick until ctx is cancelled
+func (p *RateProvider) Start(ctx context.Context) {
+	if p.url == "" {
+		log.Printf("⚠️ RATES_PROVIDER_URL not set, serving fixed exchange rates")
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.refresh(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("❌ Failed to refresh exchange rates: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("Exchange rate refresh stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *RateProvider) refresh(ctx context.Context) error {
+	toBOB, err := p.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload, _ := json.Marshal(cachedRates{ToBOB: toBOB, FetchedAt: time.Now().UTC()})
+	return p.redis.Set(ctx, ratesCacheKey, payload, ratesStaleRetention).Err()
+}
+
+func (p *RateProvider) fetch(ctx context.Context) (map[string]decimal.Decimal, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rates provider returned %d", resp.StatusCode)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if wrapped, ok := body["rates"]; ok {
+		body = nil
+		if err := json.Unmarshal(wrapped, &body); err != nil {
+			return nil, err
+		}
+	}
+
+	toBOB := make(map[string]decimal.Decimal, len(fallbackRatesToBOB))
+	for currency := range fallbackRatesToBOB {
+		raw, ok := body[currency+"_BOB"]
+		if !ok {
+			return nil, fmt.Errorf("rates provider did not return %s_BOB", currency)
+		}
+		var rate decimal.Decimal
+		if err := json.Unmarshal(raw, &rate); err != nil || !rate.IsPositive() {
+			return nil, fmt.Errorf("invalid %s_BOB rate %s", currency, string(raw))
+		}
+		toBOB[currency] = rate
+	}
+	return toBOB, nil
+}
+
+// current returns the cached rates, or nil when nothing usable is cached
+func (p *RateProvider) current(ctx context.Context) *cachedRates {
+	payload, err := p.redis.Get(ctx, ratesCacheKey).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("Error reading cached exchange rates: %v", err)
+		}
+		return nil
+	}
+
+	var rates cachedRates
+	if err := json.Unmarshal(payload, &rates); err != nil || len(rates.ToBOB) == 0 {
+		return nil
+	}
+	return &rates
+}
+
+// latest returns the cached rates through the in-memory copy, so valuations do not hit Redis on
+// every call; nil when nothing usable was ever cached
+func (p *RateProvider) latest() *cachedRates {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.memo == nil || time.Since(p.memoRead) > p.interval {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		if cached := p.current(ctx); cached != nil {
+			p.memo = cached
+		}
+		cancel()
+		p.memoRead = time.Now()
+	}
+	if p.memo != nil && time.Since(p.memo.FetchedAt) > ratesStaleRetention {
+		return nil
+	}
+	return p.memo
+}
+
+func (s *Server) handleGetExchangeRates(c *gin.Context) {
+	toBOB := fallbackRatesToBOB
+	source := "fallback"
+	stale := s.rates.url != ""
+	var lastUpdated *time.Time
+
+	if cached := s.rates.current(c.Request.Context()); cached != nil {
+		toBOB = cached.ToBOB
+		source = "provider"
+		stale = time.Since(cached.FetchedAt) > s.rates.ttl
+		lastUpdated = &cached.FetchedAt
+	}
+
+	usd, usdt := toBOB["USD"], toBOB["USDT"]
+	rates := gin.H{
+		"USD_BOB":      usd.Round(4).InexactFloat64(),
+		"BOB_USD":      decimal.NewFromInt(1).DivRound(usd, 6).InexactFloat64(),
+		"USDT_BOB":     usdt.Round(4).InexactFloat64(),
+		"BOB_USDT":     decimal.NewFromInt(1).DivRound(usdt, 6).InexactFloat64(),
+		"USD_USDT":     usd.DivRound(usdt, 6).InexactFloat64(),
+		"USDT_USD":     usdt.DivRound(usd, 6).InexactFloat64(),
+		"last_updated": lastUpdated,
+		"source":       source,
+		"stale":        stale,
+	}
+
+	c.JSON(200, rates)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/shopspring/decimal"
+)
+
+// setTestExchangeRates installs a provider backed by miniredis and caches usd as the USD and
+// USDT rate, fetched at fetchedAt
+func setTestExchangeRates(t *testing.T, usd string, fetchedAt time.Time) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	rate := decimal.RequireFromString(usd)
+	payload, _ := json.Marshal(cachedRates{ToBOB: map[string]decimal.Decimal{"USD": rate, "USDT": rate}, FetchedAt: fetchedAt})
+	if err := client.Set(context.Background(), ratesCacheKey, payload, 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := exchangeRates
+	t.Cleanup(func() { exchangeRates = previous })
+	exchangeRates = NewRateProvider(client)
+}
+
+func TestValuationsFollowTheRateProvider(t *testing.T) {
+	setTestExchangeRates(t, "6.96", time.Now())
+
+	if got, want := toLimitCurrency("usd", decimal.NewFromInt(100)), decimal.RequireFromString("696"); !got.Equal(want) {
+		t.Errorf("toLimitCurrency() = %s, want %s", got, want)
+	}
+	if got, _ := referenceConversionRate("USD", "BOB"); !got.Equal(decimal.RequireFromString("6.96")) {
+		t.Errorf("referenceConversionRate(USD, BOB) = %s, want 6.96", got)
+	}
+	if got := toLimitCurrency("BOB", decimal.NewFromInt(100)); !got.Equal(decimal.NewFromInt(100)) {
+		t.Errorf("toLimitCurrency(BOB) = %s, want 100", got)
+	}
+}
+
+func TestValuationsFallBackWithoutUsableRates(t *testing.T) {
+	tests := []struct {
+		name    string
+		install func(t *testing.T)
+	}{
+		{name: "no provider", install: func(t *testing.T) {
+			previous := exchangeRates
+			t.Cleanup(func() { exchangeRates = previous })
+			exchangeRates = nil
+		}},
+		{name: "rates past the stale retention", install: func(t *testing.T) {
+			setTestExchangeRates(t, "6.96", time.Now().Add(-2*ratesStaleRetention))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.install(t)
+			if got, want := toLimitCurrency("USD", decimal.NewFromInt(100)), decimal.RequireFromString("690"); !got.Equal(want) {
+				t.Errorf("toLimitCurrency() = %s, want %s", got, want)
+			}
+		})
+	}
+}
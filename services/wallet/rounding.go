@@ -0,0 +1,85 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/shopspring/decimal"
+)
+
+// Default number of decimals each currency is settled with
+var defaultCurrencyPrecision = map[string]int32{
+	"BOB":  2,
+	"USD":  2,
+	"USDT": 6,
+}
+
+var (
+	currencyPrecision     map[string]int32
+	currencyPrecisionOnce sync.Once
+)
+
+// loadCurrencyPrecision reads CURRENCY_PRECISION (e.g. "BOB:2,USD:2,USDT:6") on top of the defaults
+func loadCurrencyPrecision() map[string]int32 {
+	currencyPrecisionOnce.Do(func() {
+		currencyPrecision = make(map[string]int32)
+		for currency, places := range defaultCurrencyPrecision {
+			currencyPrecision[currency] = places
+		}
+
+		config := os.Getenv("CURRENCY_PRECISION")
+		if config == "" {
+			return
+		}
+
+		for _, entry := range strings.Split(config, ",") {
+			parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			places, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err != nil || places < 0 || places > 8 {
+				log.Printf("⚠️ Ignoring invalid CURRENCY_PRECISION entry: %s", entry)
+				continue
+			}
+			currencyPrecision[strings.ToUpper(strings.TrimSpace(parts[0]))] = int32(places)
+		}
+	})
+
+	return currencyPrecision
+}
+
+// roundForCurrency rounds an amount down to the currency precision and returns the remainder as dust
+func roundForCurrency(currency string, amount decimal.Decimal) (decimal.Decimal, decimal.Decimal) {
+	places, ok := loadCurrencyPrecision()[currency]
+	if !ok {
+		// Unknown currencies keep the storage precision
+		places = 8
+	}
+
+	rounded := amount.RoundFloor(places)
+	return rounded, amount.Sub(rounded)
+}
+
+// recordDust routes a rounding remainder to the platform dust account
+func recordDust(tx *sql.Tx, currency string, dust decimal.Decimal, source, reference string) error {
+	if !dust.IsPositive() {
+		return nil
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO platform_dust_ledger (currency, amount, source, reference, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+	`, currency, dust, source, reference)
+
+	if err != nil {
+		return err
+	}
+
+	log.Printf("🪙 Dust recorded: %s %s from %s (%s)", dust.String(), currency, source, reference)
+	return nil
+}
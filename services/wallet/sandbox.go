@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// Sandbox bank notifications let integration tests drive the bank listener flow
+// (deposits and P2P payments) for sandbox accounts without a real bank transfer.
+// The route only exists when SANDBOX_MODE=true and refuses non-sandbox users.
+
+type SandboxBankNotificationRequest struct {
+	UserID   string  `json:"user_id" binding:"required"`
+	Amount   float64 `json:"amount" binding:"required,gt=0"`
+	Currency string  `json:"currency" binding:"required"`
+	Type     string  `json:"type" binding:"omitempty,oneof=DEPOSIT P2P_PAYMENT"`
+	MatchID  string  `json:"match_id"`
+}
+
+func sandboxEnabled() bool {
+	return strings.ToLower(os.Getenv("SANDBOX_MODE")) == "true"
+}
+
+func (s *Server) handleSandboxBankNotification(c *gin.Context) {
+	var req SandboxBankNotificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Type == "" {
+		req.Type = "DEPOSIT"
+	}
+	if req.Type == "P2P_PAYMENT" && req.MatchID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "match_id is required for P2P_PAYMENT"})
+		return
+	}
+
+	// Fake funds may only ever reach sandbox accounts
+	var isSandbox bool
+	err := s.db.QueryRow(`SELECT COALESCE(is_sandbox, false) FROM users WHERE id = $1`, req.UserID).Scan(&isSandbox)
+	if err != nil || !isSandbox {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Simulated bank notifications are only allowed for sandbox users"})
+		return
+	}
+
+	reference := "DEPOSIT-" + req.UserID
+	if req.Type == "P2P_PAYMENT" {
+		reference = formatP2PPaymentReference(req.MatchID, req.UserID)
+	}
+
+	now := time.Now()
+	notification := BankNotification{
+		ID:              fmt.Sprintf("sandbox_%d", now.UnixNano()),
+		TransactionID:   fmt.Sprintf("SANDBOX-%d", now.UnixNano()),
+		BankAccount:     "SANDBOX",
+		Amount:          decimal.NewFromFloat(req.Amount),
+		Currency:        strings.ToUpper(req.Currency),
+		SenderName:      "Sandbox Bank",
+		SenderAccount:   "SANDBOX",
+		Reference:       reference,
+		TransactionType: "DEPOSIT",
+		Status:          "COMPLETED",
+		Timestamp:       now,
+	}
+
+	requestLog(c).Printf("🧪 SANDBOX: simulating bank notification %s (%s %s, ref %s)",
+		notification.ID, notification.Amount.String(), notification.Currency, reference)
+
+	if err := s.bankIntegration.processBankNotification(notification); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "sandbox": true})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sandbox":         true,
+		"notification_id": notification.ID,
+		"reference":       reference,
+		"amount":          notification.Amount,
+		"currency":        notification.Currency,
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// transactionColumns are the columns scanned into a Transaction by the list and export endpoints
+const transactionColumns = `id, COALESCE(user_id, from_user_id) as user_id, COALESCE(type, transaction_type) as type, currency, amount, status, COALESCE(method, payment_method) as method, COALESCE(external_ref, payment_reference) as external_ref, metadata, created_at, updated_at`
+
+// transactionFilters builds the WHERE clause over the user's transactions from the filters shared
+// by the list, count and export queries: currency, type, status, one of the user's tags, and
+// from/to dates (YYYY-MM-DD or RFC3339, to inclusive for plain dates).
+func transactionFilters(c *gin.Context, userID string) (string, []interface{}, error) {
+	where := "WHERE (COALESCE(user_id, from_user_id) = $1 OR to_user_id = $1)"
+	args := []interface{}{userID}
+
+	addFilter := func(condition string, value interface{}) {
+		args = append(args, value)
+		where += fmt.Sprintf(" AND "+condition, len(args))
+	}
+
+	if currency := c.Query("currency"); currency != "" {
+		addFilter("currency = $%d", strings.ToUpper(currency))
+	}
+	if txType := c.Query("type"); txType != "" {
+		addFilter("COALESCE(type, transaction_type) = $%d", txType)
+	}
+	if status := c.Query("status"); status != "" {
+		addFilter("status = $%d", status)
+	}
+	if value := c.Query("tag"); value != "" {
+		tag, err := normalizeTransactionTag(value)
+		if err != nil {
+			return "", nil, err
+		}
+		addFilter("id IN (SELECT transaction_id FROM transaction_tags WHERE user_id = $1 AND tag = $%d)", tag)
+	}
+	if from := c.Query("from"); from != "" {
+		date, _, err := parseExportDate(from)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid from date: %s", from)
+		}
+		addFilter("created_at >= $%d", date)
+	}
+	if to := c.Query("to"); to != "" {
+		date, dateOnly, err := parseExportDate(to)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid to date: %s", to)
+		}
+		if dateOnly {
+			addFilter("created_at < $%d", date.AddDate(0, 0, 1))
+		} else {
+			addFilter("created_at <= $%d", date)
+		}
+	}
+
+	return where, args, nil
+}
+
+// parseExportDate accepts a plain date or a full timestamp and reports which one it got
+func parseExportDate(value string) (time.Time, bool, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, true, nil
+	}
+	date, err := time.Parse(time.RFC3339, value)
+	return date, false, err
+}
+
+func (s *Server) handleExportTransactions(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		return
+	}
+
+	where, args, err := transactionFilters(c, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	query := "SELECT " + transactionColumns + " FROM transactions " + where + " ORDER BY created_at DESC"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		requestLog(c).Printf("❌ Failed to export transactions for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions"})
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("transactions-%s.%s", time.Now().Format("2006-01-02"), format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	if format == "json" {
+		transactions := []Transaction{}
+		for rows.Next() {
+			if tx, err := scanExportTransaction(rows); err == nil {
+				transactions = append(transactions, tx)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"transactions": transactions, "total": len(transactions)})
+		return
+	}
+
+	// Write rows as they come so large histories never sit in memory
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"id", "date", "type", "currency", "amount", "status", "method", "external_ref"})
+
+	c.Stream(func(w io.Writer) bool {
+		if !rows.Next() {
+			writer.Flush()
+			return false
+		}
+		tx, err := scanExportTransaction(rows)
+		if err != nil {
+			return true
+		}
+		writer.Write([]string{
+			tx.ID,
+			tx.CreatedAt.Format(time.RFC3339),
+			tx.Type,
+			tx.Currency,
+			tx.Amount.String(),
+			tx.Status,
+			tx.Method,
+			tx.ExternalRef,
+		})
+		writer.Flush()
+		return writer.Error() == nil
+	})
+}
+
+func scanExportTransaction(rows *sql.Rows) (Transaction, error) {
+	var tx Transaction
+	var metadata, externalRef sql.NullString
+	err := rows.Scan(&tx.ID, &tx.UserID, &tx.Type, &tx.Currency, &tx.Amount,
+		&tx.Status, &tx.Method, &externalRef, &metadata, &tx.CreatedAt, &tx.UpdatedAt)
+	tx.ExternalRef = externalRef.String
+	tx.Metadata = metadata.String
+	return tx, err
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/shopspring/decimal"
+)
+
+// One-time codes for the EMAIL_OTP confirmation factor. A code is issued for one operation,
+// currency and amount, lives TRANSACTION_OTP_TTL_MINUTES, allows a few wrong attempts and is
+// consumed on use. Codes are delivered through OTP_WEBHOOK_URL (same payload as the auth
+// service's webhook notifier); without it no code can be issued and requests get 503.
+
+var errTransactionOTPUnavailable = errors.New("OTP_WEBHOOK_URL is not configured")
+
+const (
+	transactionOTPMaxAttempts = 5
+	transactionOTPResendAfter = time.Minute
+)
+
+func transactionOTPTTL() time.Duration {
+	if value, err := strconv.Atoi(os.Getenv("TRANSACTION_OTP_TTL_MINUTES")); err == nil && value > 0 {
+		return time.Duration(value) * time.Minute
+	}
+	return 5 * time.Minute
+}
+
+type transactionOTP struct {
+	CodeHash string          `json:"code_hash"`
+	Currency string          `json:"currency"`
+	Amount   decimal.Decimal `json:"amount"`
+	Attempts int             `json:"attempts"`
+	IssuedAt time.Time       `json:"issued_at"`
+}
+
+func transactionOTPKey(userID, operation string) string {
+	return fmt.Sprintf("wallet:otp:%s:%s", userID, operation)
+}
+
+func hashTransactionOTP(key, code string) string {
+	sum := sha256.Sum256([]byte(key + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// Handler issuing a code for an operation the policy asked EMAIL_OTP for
+func (s *Server) handleRequestTransactionOTP(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Operation string  `json:"operation" binding:"required,oneof=WITHDRAWAL TRANSFER"`
+		Currency  string  `json:"currency" binding:"required"`
+		Amount    float64 `json:"amount" binding:"required,gt=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if os.Getenv("OTP_WEBHOOK_URL") == "" {
+		requestLog(c).Printf("❌ Transaction code requested by user %s but %v", userID, errTransactionOTPUnavailable)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Confirmation codes are not available", "code": "OTP_UNAVAILABLE"})
+		return
+	}
+
+	ctx := context.Background()
+	key := transactionOTPKey(userID, req.Operation)
+
+	var previous transactionOTP
+	if payload, err := s.redis.Get(ctx, key).Bytes(); err == nil && json.Unmarshal(payload, &previous) == nil {
+		if wait := transactionOTPResendAfter - time.Since(previous.IssuedAt); wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "A code was just sent, wait before requesting another"})
+			return
+		}
+	}
+
+	var email string
+	if err := s.db.QueryRow("SELECT email FROM users WHERE id = $1", userID).Scan(&email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate code"})
+		return
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	ttl := transactionOTPTTL()
+	otp := transactionOTP{
+		CodeHash: hashTransactionOTP(key, code),
+		Currency: strings.ToUpper(req.Currency),
+		Amount:   decimal.NewFromFloat(req.Amount),
+		IssuedAt: time.Now(),
+	}
+	payload, _ := json.Marshal(otp)
+	if err := s.redis.Set(ctx, key, payload, ttl).Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store code"})
+		return
+	}
+
+	if err := deliverTransactionOTP(email, code); err != nil {
+		requestLog(c).Printf("❌ Failed to deliver transaction code to user %s: %v", userID, err)
+		s.redis.Del(ctx, key)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send code"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "Confirmation code sent by email",
+		"expires_at": otp.IssuedAt.Add(ttl),
+	})
+}
+
+// checkTransactionOTPScript checks a code hash against the stored code in one step, so two
+// requests can't both consume the same code or both spend the same attempt. It returns 0 when
+// the code matched and was consumed, the attempts made when it didn't, -1 when there is no
+// code and -2 when the last attempt was used up and the code dropped.
+var checkTransactionOTPScript = redis.NewScript(`
+	local payload = redis.call("GET", KEYS[1])
+	if not payload then
+		return -1
+	end
+	local otp = cjson.decode(payload)
+	if otp.code_hash == ARGV[1] then
+		redis.call("DEL", KEYS[1])
+		return 0
+	end
+	otp.attempts = (otp.attempts or 0) + 1
+	if otp.attempts >= tonumber(ARGV[2]) then
+		redis.call("DEL", KEYS[1])
+		return -2
+	end
+	redis.call("SET", KEYS[1], cjson.encode(otp), "KEEPTTL")
+	return otp.attempts
+`)
+
+// verifyTransactionOTP checks and consumes the code issued for the operation. When it returns
+// false the response has already been written.
+func (s *Server) verifyTransactionOTP(c *gin.Context, check ConfirmationCheck, code string) bool {
+	ctx := context.Background()
+	key := transactionOTPKey(check.UserID, check.Operation)
+
+	var otp transactionOTP
+	payload, err := s.redis.Get(ctx, key).Bytes()
+	if err == redis.Nil || (err == nil && json.Unmarshal(payload, &otp) != nil) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Confirmation code expired or not requested", "code": "OTP_EXPIRED"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify confirmation code"})
+		return false
+	}
+
+	// A code only confirms the operation it was requested for
+	if otp.Currency != check.Currency || !otp.Amount.Equal(check.Amount) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Confirmation code was issued for a different amount", "code": "OTP_MISMATCH"})
+		return false
+	}
+
+	result, err := checkTransactionOTPScript.Run(ctx, s.redis, []string{key},
+		hashTransactionOTP(key, code), transactionOTPMaxAttempts).Int()
+	switch {
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify confirmation code"})
+		return false
+	case result == 0:
+		return true
+	case result == -1:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Confirmation code expired or not requested", "code": "OTP_EXPIRED"})
+		return false
+	case result == -2:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Too many wrong codes, request a new one", "code": "OTP_EXPIRED"})
+		return false
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"error":              "Invalid confirmation code",
+		"code":               "OTP_INVALID",
+		"attempts_remaining": transactionOTPMaxAttempts - result,
+	})
+	return false
+}
+
+func deliverTransactionOTP(email, code string) error {
+	url := os.Getenv("OTP_WEBHOOK_URL")
+	if url == "" {
+		return errTransactionOTPUnavailable
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"template": "transaction_otp",
+		"to":       email,
+		"token":    code,
+	})
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("otp webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
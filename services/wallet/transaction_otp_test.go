@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/shopspring/decimal"
+)
+
+var otpTestCheck = ConfirmationCheck{
+	Operation: "WITHDRAWAL",
+	UserID:    "user-1",
+	Currency:  "BOB",
+	Amount:    decimal.NewFromInt(500),
+}
+
+func newOTPTestServer(t *testing.T) (*Server, *miniredis.Miniredis) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return &Server{redis: client}, mr
+}
+
+// storeTestOTP issues code for otpTestCheck the way handleRequestTransactionOTP stores it
+func storeTestOTP(t *testing.T, s *Server, code string) string {
+	key := transactionOTPKey(otpTestCheck.UserID, otpTestCheck.Operation)
+	payload, _ := json.Marshal(transactionOTP{
+		CodeHash: hashTransactionOTP(key, code),
+		Currency: otpTestCheck.Currency,
+		Amount:   otpTestCheck.Amount,
+		IssuedAt: time.Now(),
+	})
+	if err := s.redis.Set(context.Background(), key, payload, time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func verifyTestOTP(s *Server, check ConfirmationCheck, code string) (bool, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	return s.verifyTransactionOTP(c, check, code), w
+}
+
+func TestRequestTransactionOTPWithoutWebhook(t *testing.T) {
+	t.Setenv("OTP_WEBHOOK_URL", "")
+	s, mr := newOTPTestServer(t)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user_id", "user-1")
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"operation":"WITHDRAWAL","currency":"BOB","amount":500}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	s.handleRequestTransactionOTP(c)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", w.Code)
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("stored %v without a way to deliver the code", keys)
+	}
+}
+
+func TestVerifyTransactionOTP(t *testing.T) {
+	s, mr := newOTPTestServer(t)
+	key := storeTestOTP(t, s, "123456")
+
+	other := otpTestCheck
+	other.Amount = decimal.NewFromInt(5000)
+	if ok, w := verifyTestOTP(s, other, "123456"); ok || w.Code != http.StatusForbidden {
+		t.Errorf("code for another amount = %v, %d; want refused with 403", ok, w.Code)
+	}
+
+	ok, w := verifyTestOTP(s, otpTestCheck, "000000")
+	if ok || w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong code = %v, %d; want refused with 401", ok, w.Code)
+	}
+	var body struct {
+		AttemptsRemaining int `json:"attempts_remaining"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.AttemptsRemaining != transactionOTPMaxAttempts-1 {
+		t.Errorf("attempts_remaining = %d, want %d", body.AttemptsRemaining, transactionOTPMaxAttempts-1)
+	}
+	if ttl := mr.TTL(key); ttl <= 0 {
+		t.Errorf("TTL after a wrong code = %v, want it kept", ttl)
+	}
+
+	if ok, _ := verifyTestOTP(s, otpTestCheck, "123456"); !ok {
+		t.Fatal("right code refused")
+	}
+	if ok, w := verifyTestOTP(s, otpTestCheck, "123456"); ok || w.Code != http.StatusForbidden {
+		t.Errorf("reused code = %v, %d; want refused with 403", ok, w.Code)
+	}
+}
+
+func TestVerifyTransactionOTPConsumedOnce(t *testing.T) {
+	s, _ := newOTPTestServer(t)
+	storeTestOTP(t, s, "123456")
+
+	var accepted int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := verifyTestOTP(s, otpTestCheck, "123456"); ok {
+				atomic.AddInt32(&accepted, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if accepted != 1 {
+		t.Errorf("code accepted %d times, want once", accepted)
+	}
+}
+
+func TestVerifyTransactionOTPCountsConcurrentAttempts(t *testing.T) {
+	s, mr := newOTPTestServer(t)
+	key := storeTestOTP(t, s, "123456")
+
+	var invalid int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, w := verifyTestOTP(s, otpTestCheck, "000000"); w.Code == http.StatusUnauthorized {
+				atomic.AddInt32(&invalid, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if invalid != transactionOTPMaxAttempts-1 {
+		t.Errorf("%d wrong codes answered as retryable, want %d", invalid, transactionOTPMaxAttempts-1)
+	}
+	if mr.Exists(key) {
+		t.Error("code kept after the last attempt")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Withdrawals, and transfers worth at least TRANSACTION_PIN_THRESHOLD_BOB, must carry the
+// transaction PIN set through the auth service. After TRANSACTION_PIN_MAX_ATTEMPTS wrong PINs
+// in a row the PIN is locked for TRANSACTION_PIN_LOCKOUT_MINUTES; setting a new PIN unlocks it.
+
+func transactionPINThreshold() decimal.Decimal {
+	if value, err := decimal.NewFromString(os.Getenv("TRANSACTION_PIN_THRESHOLD_BOB")); err == nil && value.IsPositive() {
+		return value
+	}
+	return decimal.NewFromInt(1000)
+}
+
+func transactionPINMaxAttempts() int {
+	if value, err := strconv.Atoi(os.Getenv("TRANSACTION_PIN_MAX_ATTEMPTS")); err == nil && value > 0 {
+		return value
+	}
+	return 5
+}
+
+func transactionPINLockout() time.Duration {
+	if value, err := strconv.Atoi(os.Getenv("TRANSACTION_PIN_LOCKOUT_MINUTES")); err == nil && value > 0 {
+		return time.Duration(value) * time.Minute
+	}
+	return 30 * time.Minute
+}
+
+// transferNeedsPIN reports whether a transfer is large enough to require the transaction PIN
+func transferNeedsPIN(currency string, amount decimal.Decimal) bool {
+	return toLimitCurrency(currency, amount).GreaterThanOrEqual(transactionPINThreshold())
+}
+
+// verifyTransactionPIN checks the PIN sent with a sensitive operation. When it returns false
+// the response has already been written.
+func (s *Server) verifyTransactionPIN(c *gin.Context, userID, pin string) bool {
+	var pinHash sql.NullString
+	var lockedUntil sql.NullTime
+	err := s.db.QueryRow(`
+		SELECT transaction_pin_hash, pin_locked_until FROM users WHERE id = $1
+	`, userID).Scan(&pinHash, &lockedUntil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify transaction PIN"})
+		return false
+	}
+
+	if !pinHash.Valid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Set a transaction PIN before this operation", "code": "TRANSACTION_PIN_NOT_SET"})
+		return false
+	}
+	if lockedUntil.Valid && lockedUntil.Time.After(time.Now()) {
+		respondPINLocked(c, lockedUntil.Time)
+		return false
+	}
+	if pin == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Transaction PIN required", "code": "TRANSACTION_PIN_REQUIRED"})
+		return false
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(pinHash.String), []byte(pin)); err != nil {
+		var failedCount int
+		s.db.QueryRow(`
+			UPDATE users SET pin_failed_count = COALESCE(pin_failed_count, 0) + 1
+			WHERE id = $1
+			RETURNING pin_failed_count
+		`, userID).Scan(&failedCount)
+
+		if failedCount >= transactionPINMaxAttempts() {
+			until := time.Now().Add(transactionPINLockout())
+			s.db.Exec(`UPDATE users SET pin_failed_count = 0, pin_locked_until = $1 WHERE id = $2`, until, userID)
+			requestLog(c).Printf("🔒 Transaction PIN of user %s locked until %s", userID, until.Format(time.RFC3339))
+			respondPINLocked(c, until)
+			return false
+		}
+
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":              "Invalid transaction PIN",
+			"code":               "TRANSACTION_PIN_INVALID",
+			"attempts_remaining": transactionPINMaxAttempts() - failedCount,
+		})
+		return false
+	}
+
+	s.db.Exec(`
+		UPDATE users SET pin_failed_count = 0, pin_locked_until = NULL
+		WHERE id = $1 AND (pin_failed_count > 0 OR pin_locked_until IS NOT NULL)
+	`, userID)
+	return true
+}
+
+func respondPINLocked(c *gin.Context, lockedUntil time.Time) {
+	retryAfter := int(time.Until(lockedUntil).Seconds()) + 1
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusLocked, gin.H{
+		"error":        "Transaction PIN locked due to too many wrong attempts",
+		"code":         "TRANSACTION_PIN_LOCKED",
+		"locked_until": lockedUntil,
+		"retry_after":  retryAfter,
+	})
+}
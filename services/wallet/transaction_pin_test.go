@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestTransferNeedsPIN(t *testing.T) {
+	tests := []struct {
+		threshold string
+		currency  string
+		amount    string
+		want      bool
+	}{
+		{"", "BOB", "999.99", false},
+		{"", "BOB", "1000", true},
+		{"", "USD", "144", false}, // 993.60 BOB
+		{"", "USDT", "145", true}, // 1000.50 BOB
+		{"500", "BOB", "500", true},
+		{"-1", "BOB", "999", false}, // invalid thresholds fall back to 1000
+	}
+
+	for _, tt := range tests {
+		t.Setenv("TRANSACTION_PIN_THRESHOLD_BOB", tt.threshold)
+		if got := transferNeedsPIN(tt.currency, decimal.RequireFromString(tt.amount)); got != tt.want {
+			t.Errorf("transferNeedsPIN(%s %s) with threshold %q = %v, want %v", tt.amount, tt.currency, tt.threshold, got, tt.want)
+		}
+	}
+}
+
+func verifyTestPIN(s *Server, pin string) (bool, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	return s.verifyTransactionPIN(c, "user-1", pin), w
+}
+
+func TestVerifyTransactionPIN(t *testing.T) {
+	t.Setenv("TRANSACTION_PIN_MAX_ATTEMPTS", "3")
+	hash, err := bcrypt.GenerateFromPassword([]byte("4826"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinQuery := `SELECT transaction_pin_hash, pin_locked_until FROM users WHERE id = \$1`
+	pinColumns := []string{"transaction_pin_hash", "pin_locked_until"}
+
+	tests := []struct {
+		name        string
+		pin         string
+		hash        interface{}
+		lockedUntil interface{}
+		failedCount int // pin_failed_count after a wrong PIN, 0 when the PIN is not checked
+		wantOK      bool
+		wantStatus  int
+		wantCode    string
+	}{
+		{name: "right PIN", pin: "4826", hash: string(hash), wantOK: true, wantStatus: http.StatusOK},
+		{name: "no PIN set", pin: "4826", wantStatus: http.StatusForbidden, wantCode: "TRANSACTION_PIN_NOT_SET"},
+		{name: "PIN missing", pin: "", hash: string(hash), wantStatus: http.StatusForbidden, wantCode: "TRANSACTION_PIN_REQUIRED"},
+		{name: "locked", pin: "4826", hash: string(hash), lockedUntil: time.Now().Add(10 * time.Minute),
+			wantStatus: http.StatusLocked, wantCode: "TRANSACTION_PIN_LOCKED"},
+		{name: "lock expired", pin: "4826", hash: string(hash), lockedUntil: time.Now().Add(-time.Minute),
+			wantOK: true, wantStatus: http.StatusOK},
+		{name: "wrong PIN", pin: "0000", hash: string(hash), failedCount: 1,
+			wantStatus: http.StatusUnauthorized, wantCode: "TRANSACTION_PIN_INVALID"},
+		{name: "last wrong PIN locks", pin: "0000", hash: string(hash), failedCount: 3,
+			wantStatus: http.StatusLocked, wantCode: "TRANSACTION_PIN_LOCKED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(pinQuery).WithArgs("user-1").
+				WillReturnRows(sqlmock.NewRows(pinColumns).AddRow(tt.hash, tt.lockedUntil))
+			switch {
+			case tt.wantOK:
+				mock.ExpectExec(`UPDATE users SET pin_failed_count = 0, pin_locked_until = NULL`).WithArgs("user-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			case tt.failedCount > 0:
+				mock.ExpectQuery(`UPDATE users SET pin_failed_count = COALESCE\(pin_failed_count, 0\) \+ 1`).WithArgs("user-1").
+					WillReturnRows(sqlmock.NewRows([]string{"pin_failed_count"}).AddRow(tt.failedCount))
+				if tt.failedCount >= 3 {
+					mock.ExpectExec(`UPDATE users SET pin_failed_count = 0, pin_locked_until = \$1`).
+						WithArgs(sqlmock.AnyArg(), "user-1").WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+			}
+
+			ok, w := verifyTestPIN(&Server{db: db}, tt.pin)
+			if ok != tt.wantOK || w.Code != tt.wantStatus {
+				t.Fatalf("verifyTransactionPIN() = %v, %d; want %v, %d", ok, w.Code, tt.wantOK, tt.wantStatus)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+
+			var body struct {
+				Code              string `json:"code"`
+				AttemptsRemaining int    `json:"attempts_remaining"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if body.Code != tt.wantCode {
+				t.Errorf("code = %s, want %s", body.Code, tt.wantCode)
+			}
+			if tt.wantCode == "TRANSACTION_PIN_INVALID" && body.AttemptsRemaining != 2 {
+				t.Errorf("attempts_remaining = %d, want 2", body.AttemptsRemaining)
+			}
+			if tt.wantStatus == http.StatusLocked && w.Header().Get("Retry-After") == "" {
+				t.Error("locked response without Retry-After")
+			}
+		})
+	}
+}
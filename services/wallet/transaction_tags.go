@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Users organize their transactions with free-form tags. Tags are private: each party of a
+// transaction tags it for itself, and only sees its own tags. They are trimmed and lower-cased,
+// so "Rent" and "rent" are the same tag, and must fit maxTransactionTagLength characters without
+// control characters or "/". A transaction carries at most maxTransactionTags tags per user.
+// GET /transactions?tag= lists the transactions carrying a tag.
+
+const (
+	maxTransactionTags      = 10
+	maxTransactionTagLength = 32
+)
+
+// normalizeTransactionTag returns the stored form of a tag
+func normalizeTransactionTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	switch {
+	case tag == "":
+		return "", fmt.Errorf("tags cannot be empty")
+	case utf8.RuneCountInString(tag) > maxTransactionTagLength:
+		return "", fmt.Errorf("tags must be at most %d characters", maxTransactionTagLength)
+	case strings.ContainsRune(tag, '/') || strings.IndexFunc(tag, unicode.IsControl) >= 0:
+		return "", fmt.Errorf("tag %q contains invalid characters", tag)
+	}
+	return tag, nil
+}
+
+// isTransactionParty reports whether the user sent or received the transaction. When it returns
+// false the response has already been written.
+func (s *Server) isTransactionParty(c *gin.Context, txID, userID string) bool {
+	var exists bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM transactions
+			WHERE id = $1 AND (COALESCE(user_id, from_user_id) = $2 OR to_user_id = $2)
+		)
+	`, txID, userID).Scan(&exists)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "22P02" {
+		exists, err = false, nil // not a UUID
+	}
+	if err != nil {
+		requestLog(c).Printf("Error checking transaction %s: %v", txID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transaction"})
+		return false
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return false
+	}
+	return true
+}
+
+// transactionTags returns the user's tags on each of the transactions, by transaction ID
+func (s *Server) transactionTags(userID string, txIDs []string) (map[string][]string, error) {
+	tags := make(map[string][]string)
+	if len(txIDs) == 0 {
+		return tags, nil
+	}
+
+	rows, err := s.db.Query(`
+		SELECT transaction_id, tag FROM transaction_tags
+		WHERE user_id = $1 AND transaction_id = ANY($2::uuid[])
+		ORDER BY tag
+	`, userID, pq.Array(txIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var txID, tag string
+		if err := rows.Scan(&txID, &tag); err != nil {
+			return nil, err
+		}
+		tags[txID] = append(tags[txID], tag)
+	}
+	return tags, rows.Err()
+}
+
+// attachTransactionTags fills in the user's tags on the transactions; a failure leaves them untagged
+func (s *Server) attachTransactionTags(c *gin.Context, userID string, transactions []Transaction) {
+	ids := make([]string, len(transactions))
+	for i, tx := range transactions {
+		ids[i] = tx.ID
+	}
+	tags, err := s.transactionTags(userID, ids)
+	if err != nil {
+		requestLog(c).Printf("Error loading transaction tags: %v", err)
+		return
+	}
+	for i := range transactions {
+		transactions[i].Tags = tags[transactions[i].ID]
+	}
+}
+
+func (s *Server) handleAddTransactionTags(c *gin.Context) {
+	userID := c.GetString("user_id")
+	txID := c.Param("id")
+
+	var req struct {
+		Tags []string `json:"tags" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Tags) == 0 || len(req.Tags) > maxTransactionTags {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Send between 1 and %d tags", maxTransactionTags)})
+		return
+	}
+	tags := make([]string, 0, len(req.Tags))
+	for _, value := range req.Tags {
+		tag, err := normalizeTransactionTag(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		tags = append(tags, tag)
+	}
+
+	if !s.isTransactionParty(c, txID, userID) {
+		return
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to tag transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Concurrent requests for the same transaction queue on its row, so the cap is checked
+	// against everything tagged before them and nothing is inserted past it
+	var locked string
+	if err := tx.QueryRow(`SELECT id FROM transactions WHERE id = $1 FOR UPDATE`, txID).Scan(&locked); err != nil {
+		requestLog(c).Printf("Error locking transaction %s for tagging: %v", txID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to tag transaction"})
+		return
+	}
+
+	var count int
+	if err := tx.QueryRow(`
+		SELECT COUNT(*) FROM (
+			SELECT tag FROM transaction_tags WHERE transaction_id = $1 AND user_id = $2
+			UNION
+			SELECT unnest($3::text[])
+		) tags
+	`, txID, userID, pq.Array(tags)).Scan(&count); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to tag transaction"})
+		return
+	}
+	if count > maxTransactionTags {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("A transaction can have at most %d tags", maxTransactionTags),
+			"code":  "TRANSACTION_TAG_LIMIT",
+		})
+		return
+	}
+
+	for _, tag := range tags {
+		_, err := tx.Exec(`
+			INSERT INTO transaction_tags (transaction_id, user_id, tag) VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING
+		`, txID, userID, tag)
+		if err != nil {
+			requestLog(c).Printf("Error tagging transaction %s: %v", txID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to tag transaction"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to tag transaction"})
+		return
+	}
+
+	s.respondTransactionTags(c, txID, userID)
+}
+
+func (s *Server) handleDeleteTransactionTag(c *gin.Context) {
+	userID := c.GetString("user_id")
+	txID := c.Param("id")
+
+	if !s.isTransactionParty(c, txID, userID) {
+		return
+	}
+	tag, err := normalizeTransactionTag(c.Param("tag"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+
+	result, err := s.db.Exec(`
+		DELETE FROM transaction_tags WHERE transaction_id = $1 AND user_id = $2 AND tag = $3
+	`, txID, userID, tag)
+	if err != nil {
+		requestLog(c).Printf("Error removing tag from transaction %s: %v", txID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove tag"})
+		return
+	}
+	if removed, _ := result.RowsAffected(); removed == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+
+	s.respondTransactionTags(c, txID, userID)
+}
+
+// respondTransactionTags answers with the user's current tags on the transaction
+func (s *Server) respondTransactionTags(c *gin.Context, txID, userID string) {
+	tags, err := s.transactionTags(userID, []string{txID})
+	if err != nil {
+		requestLog(c).Printf("Error loading tags of transaction %s: %v", txID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load tags"})
+		return
+	}
+	current := tags[txID]
+	if current == nil {
+		current = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{"transaction_id": txID, "tags": current})
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+func TestNormalizeTransactionTag(t *testing.T) {
+	tests := []struct {
+		tag     string
+		want    string
+		wantErr bool
+	}{
+		{tag: "  Rent ", want: "rent"},
+		{tag: "Viaje a La Paz", want: "viaje a la paz"},
+		{tag: strings.Repeat("ñ", maxTransactionTagLength), want: strings.Repeat("ñ", maxTransactionTagLength)},
+		{tag: strings.Repeat("a", maxTransactionTagLength+1), wantErr: true},
+		{tag: "   ", wantErr: true},
+		{tag: "food/drinks", wantErr: true},
+		{tag: "line\nbreak", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeTransactionTag(tt.tag)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("normalizeTransactionTag(%q) = %q, %v, want %q (error %v)", tt.tag, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func postTransactionTags(s *Server, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/transactions/:id/tags", func(c *gin.Context) {
+		c.Set("user_id", "user-1")
+		s.handleAddTransactionTags(c)
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/transactions/tx-1/tags", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAddTransactionTagsRejectsInvalidRequests(t *testing.T) {
+	tooMany := make([]string, maxTransactionTags+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf(`"tag-%d"`, i)
+	}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "no tags", body: `{"tags":[]}`},
+		{name: "more tags than a transaction can carry", body: `{"tags":[` + strings.Join(tooMany, ",") + `]}`},
+		{name: "invalid tag", body: `{"tags":["ok","a/b"]}`},
+		{name: "blank tag", body: `{"tags":[" "]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			// Rejected before the transaction is even looked up
+			if w := postTransactionTags(&Server{db: db}, tt.body); w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400: %s", w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAddTransactionTagsEnforcesTheCap(t *testing.T) {
+	tests := []struct {
+		name       string
+		tagged     int64 // distinct tags once the new ones are added
+		wantStatus int
+	}{
+		{name: "over the cap", tagged: maxTransactionTags + 1, wantStatus: http.StatusBadRequest},
+		{name: "up to the cap", tagged: maxTransactionTags, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(`SELECT 1 FROM transactions`).WithArgs("tx-1", "user-1").
+				WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT id FROM transactions WHERE id = \$1 FOR UPDATE`).WithArgs("tx-1").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("tx-1"))
+			// The cap is counted before anything is inserted
+			mock.ExpectQuery(`UNION`).WithArgs("tx-1", "user-1", `{"rent","food"}`).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.tagged))
+			if tt.wantStatus == http.StatusOK {
+				mock.ExpectExec(`INSERT INTO transaction_tags`).WithArgs("tx-1", "user-1", "rent").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO transaction_tags`).WithArgs("tx-1", "user-1", "food").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`SELECT transaction_id, tag FROM transaction_tags`).
+					WillReturnRows(sqlmock.NewRows([]string{"transaction_id", "tag"}).AddRow("tx-1", "food").AddRow("tx-1", "rent"))
+			} else {
+				mock.ExpectRollback()
+			}
+
+			w := postTransactionTags(&Server{db: db}, `{"tags":["Rent","food"]}`)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus == http.StatusBadRequest && !strings.Contains(w.Body.String(), "TRANSACTION_TAG_LIMIT") {
+				t.Errorf("body = %s, want the TRANSACTION_TAG_LIMIT code", w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestTransactionFiltersByTag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newContext := func(query string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/transactions?"+query, nil)
+		return c
+	}
+
+	where, args, err := transactionFilters(newContext("tag=%20Rent"), "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(where, "SELECT transaction_id FROM transaction_tags WHERE user_id = $1 AND tag = $2") {
+		t.Errorf("where = %q, want the user's own tags filtered", where)
+	}
+	if len(args) != 2 || args[1] != "rent" {
+		t.Errorf("args = %v, want the normalized tag", args)
+	}
+
+	if _, _, err := transactionFilters(newContext("tag=a/b"), "user-1"); err == nil {
+		t.Error("transactionFilters() accepted an invalid tag")
+	}
+}
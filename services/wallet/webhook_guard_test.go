@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+const webhookNonceInsertSQL = `INSERT INTO webhook_nonces \(source, nonce\) VALUES \(\$1, \$2\)`
+
+func newWebhookGuardTestRouter(t *testing.T, secret string) (*gin.Engine, sqlmock.Sqlmock) {
+	t.Setenv("WEBHOOK_SECRET", secret)
+	t.Setenv("WEBHOOK_REPLAY_PROTECTION", "true")
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	router := gin.New()
+	router.POST("/webhooks/bank", newWebhookGuard(db, "wallet").middleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router, mock
+}
+
+type webhookTestCall struct {
+	timestamp string
+	nonce     string
+	signature string
+	body      string
+}
+
+// signedWebhookCall is a call signed the way setWebhookHeaders signs it
+func signedWebhookCall(secret, nonce, body string) webhookTestCall {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	return webhookTestCall{timestamp, nonce, signWebhook(secret, timestamp, nonce, []byte(body)), body}
+}
+
+func (call webhookTestCall) send(router *gin.Engine) int {
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/bank", strings.NewReader(call.body))
+	req.Header.Set(webhookTimestampHeader, call.timestamp)
+	req.Header.Set(webhookNonceHeader, call.nonce)
+	req.Header.Set(webhookSignatureHeader, call.signature)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestWebhookGuardReplay(t *testing.T) {
+	router, mock := newWebhookGuardTestRouter(t, "secret")
+	call := signedWebhookCall("secret", "nonce-1", `{"reference":"DEP-1","status":"COMPLETED"}`)
+
+	mock.ExpectExec(webhookNonceInsertSQL).WithArgs("wallet", "nonce-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	if status := call.send(router); status != http.StatusOK {
+		t.Fatalf("first call = %d, want 200", status)
+	}
+
+	mock.ExpectExec(webhookNonceInsertSQL).WithArgs("wallet", "nonce-1").WillReturnResult(sqlmock.NewResult(0, 0))
+	if status := call.send(router); status != http.StatusConflict {
+		t.Errorf("replayed call = %d, want 409", status)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWebhookGuardRejectsTamperedCalls(t *testing.T) {
+	call := signedWebhookCall("secret", "nonce-1", `{"reference":"DEP-1","status":"COMPLETED"}`)
+
+	tampered := map[string]webhookTestCall{
+		"fresh nonce on a captured call": {call.timestamp, "nonce-2", call.signature, call.body},
+		"fresh timestamp":                {strconv.FormatInt(time.Now().Unix()+1, 10), call.nonce, call.signature, call.body},
+		"changed body":                   {call.timestamp, call.nonce, call.signature, `{"reference":"DEP-2","status":"COMPLETED"}`},
+		"other secret":                   signedWebhookCall("other", "nonce-1", call.body),
+		"unsigned":                       {call.timestamp, call.nonce, "", call.body},
+	}
+
+	for name, call := range tampered {
+		t.Run(name, func(t *testing.T) {
+			router, mock := newWebhookGuardTestRouter(t, "secret")
+			if status := call.send(router); status != http.StatusUnauthorized {
+				t.Errorf("status = %d, want 401", status)
+			}
+			// Rejected before the nonce is recorded: any query fails the mock
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestWebhookGuardWithoutSecret(t *testing.T) {
+	router, _ := newWebhookGuardTestRouter(t, "")
+	call := signedWebhookCall("", "nonce-1", `{}`)
+	if status := call.send(router); status != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", status)
+	}
+}
+
+func TestWebhookGuardStaleTimestamp(t *testing.T) {
+	router, _ := newWebhookGuardTestRouter(t, "secret")
+	timestamp := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	call := webhookTestCall{timestamp, "nonce-1", signWebhook("secret", timestamp, "nonce-1", []byte(`{}`)), `{}`}
+	if status := call.send(router); status != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", status)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// Withdrawals waiting for an operator keep their funds locked until approved or rejected
+const (
+	WithdrawalPendingApproval = "PENDING_APPROVAL"
+	WithdrawalRejected        = "REJECTED"
+)
+
+// Default approval thresholds, overridable with WITHDRAWAL_APPROVAL_THRESHOLDS="BOB:10000,USD:1500".
+// Currencies without a threshold never need approval.
+var defaultWithdrawalApprovalThresholds = map[string]decimal.Decimal{
+	"BOB":  decimal.NewFromInt(10000),
+	"USD":  decimal.NewFromInt(1500),
+	"USDT": decimal.NewFromInt(1500),
+}
+
+var withdrawalApprovalThresholds = loadWithdrawalApprovalThresholds()
+
+func loadWithdrawalApprovalThresholds() map[string]decimal.Decimal {
+	thresholds := make(map[string]decimal.Decimal)
+	for currency, threshold := range defaultWithdrawalApprovalThresholds {
+		thresholds[currency] = threshold
+	}
+
+	config := os.Getenv("WITHDRAWAL_APPROVAL_THRESHOLDS")
+	if config == "" {
+		return thresholds
+	}
+
+	thresholds = make(map[string]decimal.Decimal)
+	for _, entry := range strings.Split(config, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 {
+			log.Printf("⚠️ Ignoring invalid WITHDRAWAL_APPROVAL_THRESHOLDS entry: %s", entry)
+			continue
+		}
+		threshold, err := decimal.NewFromString(strings.TrimSpace(parts[1]))
+		if err != nil || !threshold.IsPositive() {
+			log.Printf("⚠️ Ignoring invalid WITHDRAWAL_APPROVAL_THRESHOLDS entry: %s", entry)
+			continue
+		}
+		thresholds[strings.ToUpper(strings.TrimSpace(parts[0]))] = threshold
+	}
+	return thresholds
+}
+
+// withdrawalNeedsApproval reports whether a withdrawal is large enough to wait for an operator
+func withdrawalNeedsApproval(currency string, amount decimal.Decimal) bool {
+	threshold, ok := withdrawalApprovalThresholds[strings.ToUpper(currency)]
+	return ok && amount.GreaterThanOrEqual(threshold)
+}
+
+type PendingWithdrawal struct {
+	ID          string                 `json:"id"`
+	UserID      string                 `json:"user_id"`
+	Email       string                 `json:"email"`
+	Currency    string                 `json:"currency"`
+	Amount      decimal.Decimal        `json:"amount"`
+	Method      string                 `json:"method"`
+	Destination map[string]interface{} `json:"destination"`
+	CreatedAt   time.Time              `json:"created_at"`
+}
+
+// Admin handler listing withdrawals waiting for approval, oldest first
+func (s *Server) handleAdminGetPendingWithdrawals(c *gin.Context) {
+	query := `
+		SELECT t.id, t.user_id, COALESCE(u.email, ''), t.currency, t.amount,
+			COALESCE(t.method, t.payment_method, ''), COALESCE(t.metadata, '{}'), t.created_at
+		FROM transactions t
+		LEFT JOIN users u ON u.id = t.user_id
+		WHERE t.transaction_type = 'WITHDRAWAL' AND t.status = 'PENDING_APPROVAL'
+	`
+	var args []interface{}
+	if currency := strings.ToUpper(c.Query("currency")); currency != "" {
+		query += " AND t.currency = $1"
+		args = append(args, currency)
+	}
+	query += " ORDER BY t.created_at ASC"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get pending withdrawals"})
+		return
+	}
+	defer rows.Close()
+
+	withdrawals := []PendingWithdrawal{}
+	for rows.Next() {
+		var w PendingWithdrawal
+		var metadataJSON string
+		if err := rows.Scan(&w.ID, &w.UserID, &w.Email, &w.Currency, &w.Amount, &w.Method, &metadataJSON, &w.CreatedAt); err != nil {
+			continue
+		}
+		json.Unmarshal([]byte(metadataJSON), &w.Destination)
+		withdrawals = append(withdrawals, w)
+	}
+
+	c.JSON(200, gin.H{
+		"status": "success",
+		"data":   withdrawals,
+		"total":  len(withdrawals),
+	})
+}
+
+// Admin handler approving a large withdrawal; it is then dispatched like any other
+func (s *Server) handleAdminApproveWithdrawal(c *gin.Context) {
+	txID := c.Param("id")
+	adminID := c.GetString("user_id")
+
+	var req struct {
+		Notes string `json:"notes"`
+	}
+	c.ShouldBindJSON(&req)
+
+	// The status guard makes approval happen once even with concurrent admins
+	var tx Transaction
+	var metadataJSON string
+	err := s.db.QueryRow(`
+		UPDATE transactions
+		SET status = 'PENDING', reviewed_by = $2, reviewed_at = NOW(), notes = COALESCE(NULLIF($3, ''), notes), updated_at = NOW()
+		WHERE id = $1 AND transaction_type = 'WITHDRAWAL' AND status = 'PENDING_APPROVAL'
+		RETURNING id, user_id, currency, amount, COALESCE(method, payment_method, ''), COALESCE(metadata, '{}'), created_at
+	`, txID, adminID, req.Notes).Scan(&tx.ID, &tx.UserID, &tx.Currency, &tx.Amount, &tx.Method, &metadataJSON, &tx.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "Withdrawal not found or not pending approval"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to approve withdrawal"})
+		return
+	}
+	tx.Type = "WITHDRAWAL"
+	tx.Status = "PENDING"
+	tx.Metadata = metadataJSON
+
+	var destination map[string]interface{}
+	json.Unmarshal([]byte(metadataJSON), &destination)
+
+	requestLog(c).Printf("✅ Withdrawal %s (%s %s) approved by %s", txID, tx.Amount.String(), tx.Currency, adminID)
+	s.recordAuditChange(c, adminID, "WITHDRAWAL_APPROVE", "transaction", txID,
+		map[string]interface{}{"status": "PENDING_APPROVAL"},
+		map[string]interface{}{"status": "PENDING", "amount": tx.Amount.String(), "currency": tx.Currency, "notes": req.Notes})
+
+	// A processor rejection returns the locked funds, same as for automatic withdrawals
+	response, status := s.dispatchWithdrawal(tx, destination)
+	response["transaction_id"] = txID
+	if status >= 300 {
+		c.JSON(status, response)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status": "success",
+		"data":   response,
+	})
+}
+
+// Admin handler rejecting a large withdrawal; the locked amount goes back to the user
+func (s *Server) handleAdminRejectWithdrawal(c *gin.Context) {
+	txID := c.Param("id")
+	adminID := c.GetString("user_id")
+
+	var req struct {
+		Notes string `json:"notes" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "notes are required when rejecting a withdrawal"})
+		return
+	}
+
+	dbTx, err := s.db.Begin()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer dbTx.Rollback()
+
+	var userID, currency string
+	var amount decimal.Decimal
+	err = dbTx.QueryRow(`
+		SELECT user_id, currency, amount FROM transactions
+		WHERE id = $1 AND transaction_type = 'WITHDRAWAL' AND status = 'PENDING_APPROVAL'
+		FOR UPDATE
+	`, txID).Scan(&userID, &currency, &amount)
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "Withdrawal not found or not pending approval"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to reject withdrawal"})
+		return
+	}
+
+	_, err = dbTx.Exec(`
+		UPDATE wallets SET locked_balance = GREATEST(0, locked_balance - $1), balance = balance + $1, updated_at = NOW()
+		WHERE user_id = $2 AND currency = $3
+	`, amount, userID, currency)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to unlock balance"})
+		return
+	}
+
+	_, err = dbTx.Exec(`
+		UPDATE transactions
+		SET status = 'REJECTED', reviewed_by = $2, reviewed_at = NOW(), notes = $3, updated_at = NOW()
+		WHERE id = $1
+	`, txID, adminID, req.Notes)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to reject withdrawal"})
+		return
+	}
+
+	if err = dbTx.Commit(); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	requestLog(c).Printf("🚫 Withdrawal %s (%s %s) rejected by %s: %s", txID, amount.String(), currency, adminID, req.Notes)
+	s.recordAuditChange(c, adminID, "WITHDRAWAL_REJECT", "transaction", txID,
+		map[string]interface{}{"status": "PENDING_APPROVAL"},
+		map[string]interface{}{"status": WithdrawalRejected, "amount": amount.String(), "currency": currency, "notes": req.Notes})
+
+	c.JSON(200, gin.H{
+		"status": "success",
+		"data":   gin.H{"id": txID, "status": WithdrawalRejected},
+	})
+}
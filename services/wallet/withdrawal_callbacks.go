@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Withdrawal status callbacks: processors that confirm withdrawals asynchronously POST the
+// outcome to /webhooks/withdrawals/:processor instead of waiting for the monitor to poll them.
+// Each call carries X-Webhook-Timestamp (unix seconds, within WEBHOOK_MAX_SKEW_SECONDS) and
+// X-Webhook-Signature, the hex HMAC-SHA256 of "<timestamp>.<body>" with the processor's secret
+// from WITHDRAWAL_CALLBACK_SECRETS ("crypto:secret,..."). A COMPLETED callback burns the locked
+// amount and a FAILED one returns it to the balance, through the same finalizeWithdrawal the
+// monitor and the admin endpoints use.
+//
+// Callbacks are idempotent so processors can retry freely: repeating the status a withdrawal
+// already has answers 200. Answers tell the processor whether to retry: 2xx means done, 4xx
+// means the call will never succeed (bad signature, unknown withdrawal, conflicting status) and
+// 503 with Retry-After (WITHDRAWAL_CALLBACK_RETRY_AFTER_SECONDS) means try again later.
+
+const defaultWithdrawalCallbackRetryAfter = 30
+
+var withdrawalCallbackSecrets = loadWithdrawalCallbackSecrets()
+
+func loadWithdrawalCallbackSecrets() map[string]string {
+	secrets := make(map[string]string)
+	config := os.Getenv("WITHDRAWAL_CALLBACK_SECRETS")
+	if config == "" {
+		return secrets
+	}
+
+	for _, entry := range strings.Split(config, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			log.Printf("⚠️ Ignoring invalid WITHDRAWAL_CALLBACK_SECRETS entry")
+			continue
+		}
+		secrets[strings.ToLower(strings.TrimSpace(parts[0]))] = strings.TrimSpace(parts[1])
+	}
+	return secrets
+}
+
+func withdrawalCallbackRetryAfter() int {
+	if value, err := strconv.Atoi(os.Getenv("WITHDRAWAL_CALLBACK_RETRY_AFTER_SECONDS")); err == nil && value > 0 {
+		return value
+	}
+	return defaultWithdrawalCallbackRetryAfter
+}
+
+func webhookMaxSkew() time.Duration {
+	if value, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_SKEW_SECONDS")); err == nil && value > 0 {
+		return time.Duration(value) * time.Second
+	}
+	return 300 * time.Second
+}
+
+// signWithdrawalCallback returns the signature a processor sends for the body at timestamp
+func signWithdrawalCallback(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type WithdrawalCallback struct {
+	TransactionID string `json:"transaction_id"`
+	ExternalRef   string `json:"external_ref"`
+	Status        string `json:"status" binding:"required"`
+	Confirmations int    `json:"confirmations"`
+	Reason        string `json:"reason"`
+}
+
+// retryLater asks the processor to deliver the callback again
+func retryLater(c *gin.Context, message string) {
+	c.Header("Retry-After", strconv.Itoa(withdrawalCallbackRetryAfter()))
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": message})
+}
+
+func (s *Server) handleWithdrawalCallback(c *gin.Context) {
+	processor := strings.ToLower(c.Param("processor"))
+	secret, ok := withdrawalCallbackSecrets[processor]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown withdrawal processor"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 64<<10))
+	if err != nil {
+		retryLater(c, "Failed to read callback")
+		return
+	}
+
+	timestamp := c.GetHeader(webhookTimestampHeader)
+	sentAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing webhook timestamp"})
+		return
+	}
+	if skew := time.Since(time.Unix(sentAt, 0)); skew > webhookMaxSkew() || skew < -webhookMaxSkew() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Webhook timestamp outside the allowed window"})
+		return
+	}
+	expected := signWithdrawalCallback(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(c.GetHeader(webhookSignatureHeader)))) {
+		requestLog(c).Printf("⚠️ Withdrawal callback with invalid signature from %s for processor %s", c.ClientIP(), processor)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook signature"})
+		return
+	}
+
+	var callback WithdrawalCallback
+	if err := json.Unmarshal(body, &callback); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid callback body"})
+		return
+	}
+	callback.Status = strings.ToUpper(callback.Status)
+	if callback.Status != WithdrawalProcessing && callback.Status != WithdrawalCompleted && callback.Status != WithdrawalFailed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be PROCESSING, COMPLETED or FAILED"})
+		return
+	}
+	if callback.TransactionID == "" && callback.ExternalRef == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "transaction_id or external_ref is required"})
+		return
+	}
+
+	var txID, status string
+	var externalRef sql.NullString
+	err = s.db.QueryRow(`
+		SELECT id, status, external_ref FROM transactions
+		WHERE transaction_type = 'WITHDRAWAL' AND withdrawal_processor = $1
+			AND (id::text = $2 OR ($3 <> '' AND external_ref = $3))
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, processor, callback.TransactionID, callback.ExternalRef).Scan(&txID, &status, &externalRef)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Withdrawal not found"})
+		return
+	}
+	if err != nil {
+		requestLog(c).Printf("Error loading withdrawal for %s callback: %v", processor, err)
+		retryLater(c, "Failed to load withdrawal")
+		return
+	}
+
+	response := gin.H{"transaction_id": txID, "status": callback.Status}
+
+	switch {
+	case callback.Status == WithdrawalProcessing && (status == WithdrawalProcessing || status == "PENDING"):
+		// Progress updates repeat with growing confirmations. This also settles the reference of
+		// a send whose dispatch went unconfirmed.
+		s.db.Exec(`
+			UPDATE transactions SET external_confirmations = $1, external_ref = COALESCE(external_ref, NULLIF($3, '')), updated_at = NOW()
+			WHERE id = $2
+		`, callback.Confirmations, txID, callback.ExternalRef)
+		c.JSON(http.StatusOK, response)
+		return
+	case status == callback.Status:
+		// A retry of a callback already applied
+		response["duplicate"] = true
+		c.JSON(http.StatusOK, response)
+		return
+	case status != WithdrawalProcessing && status != "PENDING":
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Withdrawal is already %s", status), "transaction_id": txID})
+		return
+	}
+
+	err = s.finalizeWithdrawal(txID, callback.Status, callback.Reason, callback.Confirmations)
+	if err == sql.ErrNoRows {
+		// Finalized by the monitor or an admin since it was loaded; answer like a retry would
+		var current string
+		s.db.QueryRow(`SELECT status FROM transactions WHERE id = $1`, txID).Scan(&current)
+		if current == callback.Status {
+			response["duplicate"] = true
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Withdrawal is already %s", current), "transaction_id": txID})
+		return
+	}
+	if err != nil {
+		requestLog(c).Printf("Error finalizing withdrawal %s from %s callback: %v", txID, processor, err)
+		retryLater(c, "Failed to update withdrawal")
+		return
+	}
+
+	if callback.Status == WithdrawalFailed {
+		s.recordWithdrawalFailure(txID, processor, externalRef.String, callback.Reason)
+	}
+	requestLog(c).Printf("📨 Withdrawal %s %s by %s callback", txID, strings.ToLower(callback.Status), processor)
+	c.JSON(http.StatusOK, response)
+}
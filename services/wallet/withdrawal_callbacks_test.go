@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+const withdrawalCallbackLookupSQL = `SELECT id, status, external_ref FROM transactions\s+WHERE transaction_type = 'WITHDRAWAL' AND withdrawal_processor = \$1`
+
+func newWithdrawalCallbackTestRouter(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+	previous := withdrawalCallbackSecrets
+	t.Cleanup(func() { withdrawalCallbackSecrets = previous })
+	withdrawalCallbackSecrets = map[string]string{"crypto": "processor-secret"}
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	s := &Server{db: db}
+	router := gin.New()
+	router.POST("/webhooks/withdrawals/:processor", s.handleWithdrawalCallback)
+	return router, mock
+}
+
+// sendWithdrawalCallback posts body signed with secret, timestamped sentAt
+func sendWithdrawalCallback(router *gin.Engine, processor, secret, body string, sentAt time.Time) *httptest.ResponseRecorder {
+	timestamp := strconv.FormatInt(sentAt.Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/withdrawals/"+processor, strings.NewReader(body))
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, signWithdrawalCallback(secret, timestamp, []byte(body)))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestWithdrawalCallbackRejectsUntrustedCalls(t *testing.T) {
+	body := `{"transaction_id":"tx-1","status":"COMPLETED"}`
+
+	tests := []struct {
+		name       string
+		processor  string
+		secret     string
+		sentAt     time.Time
+		body       string
+		wantStatus int
+	}{
+		{name: "unknown processor", processor: "paypal", secret: "processor-secret", sentAt: time.Now(), body: body, wantStatus: http.StatusNotFound},
+		{name: "wrong secret", processor: "crypto", secret: "guess", sentAt: time.Now(), body: body, wantStatus: http.StatusUnauthorized},
+		{name: "stale timestamp", processor: "crypto", secret: "processor-secret", sentAt: time.Now().Add(-time.Hour), body: body, wantStatus: http.StatusUnauthorized},
+		{name: "unknown status", processor: "crypto", secret: "processor-secret", sentAt: time.Now(),
+			body: `{"transaction_id":"tx-1","status":"REVERSED"}`, wantStatus: http.StatusBadRequest},
+		{name: "no withdrawal reference", processor: "crypto", secret: "processor-secret", sentAt: time.Now(),
+			body: `{"status":"COMPLETED"}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := newWithdrawalCallbackTestRouter(t)
+			if w := sendWithdrawalCallback(router, tt.processor, tt.secret, tt.body, tt.sentAt); w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			// Refused before the withdrawal is loaded
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestWithdrawalCallbackIsIdempotent(t *testing.T) {
+	router, mock := newWithdrawalCallbackTestRouter(t)
+	mock.ExpectQuery(withdrawalCallbackLookupSQL).WithArgs("crypto", "tx-1", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "external_ref"}).AddRow("tx-1", "COMPLETED", "0xabc"))
+
+	w := sendWithdrawalCallback(router, "crypto", "processor-secret", `{"transaction_id":"tx-1","status":"completed"}`, time.Now())
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var response struct {
+		Duplicate bool `json:"duplicate"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if !response.Duplicate {
+		t.Error("repeated callback not answered as a duplicate")
+	}
+	// Nothing is settled twice: any further statement fails the mock
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWithdrawalCallbackConflictingStatus(t *testing.T) {
+	router, mock := newWithdrawalCallbackTestRouter(t)
+	mock.ExpectQuery(withdrawalCallbackLookupSQL).WithArgs("crypto", "", "0xabc").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "external_ref"}).AddRow("tx-1", "FAILED", "0xabc"))
+
+	w := sendWithdrawalCallback(router, "crypto", "processor-secret", `{"external_ref":"0xabc","status":"COMPLETED"}`, time.Now())
+	if w.Code != http.StatusConflict {
+		t.Errorf("status = %d, want 409", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWithdrawalCallbackProcessingRecordsConfirmations(t *testing.T) {
+	router, mock := newWithdrawalCallbackTestRouter(t)
+	mock.ExpectQuery(withdrawalCallbackLookupSQL).WithArgs("crypto", "tx-1", "0xabc").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "external_ref"}).AddRow("tx-1", "PROCESSING", nil))
+	mock.ExpectExec(`UPDATE transactions SET external_confirmations = \$1, external_ref = COALESCE\(external_ref, NULLIF\(\$3, ''\)\)`).
+		WithArgs(int64(3), "tx-1", "0xabc").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	body := `{"transaction_id":"tx-1","external_ref":"0xabc","status":"PROCESSING","confirmations":3}`
+	if w := sendWithdrawalCallback(router, "crypto", "processor-secret", body, time.Now()); w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,678 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// Withdrawal statuses reported by processors
+const (
+	WithdrawalProcessing = "PROCESSING"
+	WithdrawalCompleted  = "COMPLETED"
+	WithdrawalFailed     = "FAILED"
+)
+
+// WithdrawalProcessor sends funds out of the platform for one rail (bank transfer, on-chain send...)
+// and reports on the external confirmation of what it sent. Submit returns a withdrawalRejection
+// when the processor refused the withdrawal and sent nothing; any other error leaves it unknown
+// whether the funds went out, and Lookup finds the send by our transaction ID (nil when the
+// processor has no record of it).
+type WithdrawalProcessor interface {
+	Name() string
+	Submit(tx Transaction, destination map[string]interface{}) (*WithdrawalSubmission, error)
+	CheckStatus(externalRef string) (*WithdrawalStatus, error)
+	Lookup(reference string) (*WithdrawalSubmission, error)
+}
+
+// errWithdrawalRailUnavailable marks a route whose processor is not configured, such as crypto
+// withdrawals without CRYPTO_WITHDRAWAL_URL
+var errWithdrawalRailUnavailable = errors.New("withdrawal processor unavailable")
+
+// withdrawalRejection is a definitive refusal by the processor: nothing was sent
+type withdrawalRejection struct {
+	reason string
+}
+
+func (e *withdrawalRejection) Error() string { return e.reason }
+
+func rejectWithdrawal(format string, args ...interface{}) error {
+	return &withdrawalRejection{reason: fmt.Sprintf(format, args...)}
+}
+
+func isWithdrawalRejection(err error) bool {
+	var rejection *withdrawalRejection
+	return errors.As(err, &rejection)
+}
+
+// mockProvidersAllowed reports whether APP_ENV allows mock providers; anything but development
+// or test counts as production
+func mockProvidersAllowed() bool {
+	switch strings.ToLower(os.Getenv("APP_ENV")) {
+	case "development", "test":
+		return true
+	}
+	return false
+}
+
+type WithdrawalSubmission struct {
+	ExternalRef   string
+	Status        string
+	EstimatedTime string
+	Details       gin.H
+}
+
+type WithdrawalStatus struct {
+	Status        string
+	Confirmations int
+	Reason        string
+}
+
+// WithdrawalRouter dispatches withdrawals to a processor by currency and method
+type WithdrawalRouter struct {
+	processors map[string]WithdrawalProcessor
+	routes     map[string]string
+}
+
+// Default routes, overridable with WITHDRAWAL_ROUTES="BOB:BANK=manual,USDT:CRYPTO=crypto"
+var defaultWithdrawalRoutes = map[string]string{
+	"BOB:BANK":    "manual",
+	"USD:BANK":    "manual",
+	"USDT:CRYPTO": "crypto",
+}
+
+var withdrawalProcessorNames = map[string]bool{"manual": true, "crypto": true, "mock": true}
+
+func routeKey(currency, method string) string {
+	return strings.ToUpper(currency) + ":" + strings.ToUpper(method)
+}
+
+func NewWithdrawalRouter(s *Server) *WithdrawalRouter {
+	router := &WithdrawalRouter{
+		processors: map[string]WithdrawalProcessor{
+			"manual": &ManualWithdrawalProcessor{reference: s.generateBankReference},
+		},
+		routes: make(map[string]string),
+	}
+
+	// The mock confirms every withdrawal without sending anything; it must be routed to explicitly
+	if mockProvidersAllowed() {
+		router.processors["mock"] = &MockWithdrawalProcessor{}
+	}
+
+	// On-chain sends go through a custody/node service; without one crypto withdrawals are refused
+	if cryptoURL := os.Getenv("CRYPTO_WITHDRAWAL_URL"); cryptoURL != "" {
+		requiredConfirmations := 12
+		if value, err := strconv.Atoi(os.Getenv("CRYPTO_REQUIRED_CONFIRMATIONS")); err == nil && value > 0 {
+			requiredConfirmations = value
+		}
+		router.processors["crypto"] = &CryptoWithdrawalProcessor{
+			baseURL:               strings.TrimRight(cryptoURL, "/"),
+			apiKey:                os.Getenv("CRYPTO_WITHDRAWAL_API_KEY"),
+			requiredConfirmations: requiredConfirmations,
+			httpClient:            &http.Client{Timeout: 30 * time.Second},
+		}
+	} else {
+		log.Printf("⚠️ CRYPTO_WITHDRAWAL_URL not set, crypto withdrawals are unavailable")
+	}
+
+	for key, processor := range defaultWithdrawalRoutes {
+		router.routes[key] = processor
+	}
+
+	if config := os.Getenv("WITHDRAWAL_ROUTES"); config != "" {
+		for _, entry := range strings.Split(config, ",") {
+			parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+			if len(parts) != 2 {
+				log.Printf("⚠️ Ignoring invalid WITHDRAWAL_ROUTES entry: %s", entry)
+				continue
+			}
+			name := strings.ToLower(strings.TrimSpace(parts[1]))
+			if !withdrawalProcessorNames[name] {
+				log.Printf("⚠️ Ignoring WITHDRAWAL_ROUTES entry with unknown processor: %s", entry)
+				continue
+			}
+			if name == "mock" && !mockProvidersAllowed() {
+				log.Printf("⚠️ Ignoring WITHDRAWAL_ROUTES entry %s: the mock processor is only available with APP_ENV=development", entry)
+				continue
+			}
+			router.routes[strings.ToUpper(strings.TrimSpace(parts[0]))] = name
+		}
+	}
+
+	return router
+}
+
+// Route returns the processor configured for a currency and method
+func (r *WithdrawalRouter) Route(currency, method string) (WithdrawalProcessor, error) {
+	name, ok := r.routes[routeKey(currency, method)]
+	if !ok {
+		return nil, fmt.Errorf("%s withdrawals via %s are not supported", strings.ToUpper(currency), strings.ToUpper(method))
+	}
+	processor, ok := r.processors[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s withdrawals via %s are temporarily unavailable", errWithdrawalRailUnavailable,
+			strings.ToUpper(currency), strings.ToUpper(method))
+	}
+	return processor, nil
+}
+
+// Processor looks up a processor by the name stored on the transaction
+func (r *WithdrawalRouter) Processor(name string) (WithdrawalProcessor, bool) {
+	processor, ok := r.processors[name]
+	return processor, ok
+}
+
+// ManualWithdrawalProcessor issues a bank reference and leaves the transfer to operations,
+// who confirm it through the admin withdrawal endpoints
+type ManualWithdrawalProcessor struct {
+	reference func(txID string) string
+}
+
+func (p *ManualWithdrawalProcessor) Name() string { return "manual" }
+
+func (p *ManualWithdrawalProcessor) Submit(tx Transaction, destination map[string]interface{}) (*WithdrawalSubmission, error) {
+	if _, ok := destination["account_number"]; !ok {
+		return nil, rejectWithdrawal("destination.account_number is required for bank withdrawals")
+	}
+
+	return &WithdrawalSubmission{
+		ExternalRef:   p.reference(tx.ID),
+		Status:        WithdrawalProcessing,
+		EstimatedTime: "1-2 business days",
+	}, nil
+}
+
+func (p *ManualWithdrawalProcessor) CheckStatus(externalRef string) (*WithdrawalStatus, error) {
+	// Completed or failed by an operator, never by the monitor
+	return &WithdrawalStatus{Status: WithdrawalProcessing}, nil
+}
+
+func (p *ManualWithdrawalProcessor) Lookup(reference string) (*WithdrawalSubmission, error) {
+	// Submit does no I/O, so a manual withdrawal is never left unconfirmed
+	return nil, nil
+}
+
+// MockWithdrawalProcessor accepts every withdrawal and confirms it on the next status check. Only
+// registered when mockProvidersAllowed.
+type MockWithdrawalProcessor struct{}
+
+func (p *MockWithdrawalProcessor) Name() string { return "mock" }
+
+func (p *MockWithdrawalProcessor) Submit(tx Transaction, destination map[string]interface{}) (*WithdrawalSubmission, error) {
+	return &WithdrawalSubmission{
+		ExternalRef:   fmt.Sprintf("MOCK-%s", tx.ID[:8]),
+		Status:        WithdrawalProcessing,
+		EstimatedTime: "under 1 minute",
+	}, nil
+}
+
+func (p *MockWithdrawalProcessor) CheckStatus(externalRef string) (*WithdrawalStatus, error) {
+	return &WithdrawalStatus{Status: WithdrawalCompleted, Confirmations: 1}, nil
+}
+
+func (p *MockWithdrawalProcessor) Lookup(reference string) (*WithdrawalSubmission, error) {
+	return &WithdrawalSubmission{ExternalRef: fmt.Sprintf("MOCK-%s", reference[:8]), Status: WithdrawalProcessing}, nil
+}
+
+// CryptoWithdrawalProcessor sends on-chain through a custody service exposing POST /send,
+// GET /sends/{reference} (404 when it never received the send) and GET /transactions/{hash}.
+// The custody service must treat reference as an idempotency key.
+type CryptoWithdrawalProcessor struct {
+	baseURL               string
+	apiKey                string
+	requiredConfirmations int
+	httpClient            *http.Client
+}
+
+func (p *CryptoWithdrawalProcessor) Name() string { return "crypto" }
+
+func (p *CryptoWithdrawalProcessor) Submit(tx Transaction, destination map[string]interface{}) (*WithdrawalSubmission, error) {
+	address, _ := destination["address"].(string)
+	if address == "" {
+		return nil, rejectWithdrawal("destination.address is required for crypto withdrawals")
+	}
+
+	network, _ := destination["network"].(string)
+	if network == "" {
+		network = "TRC20"
+	}
+
+	payload, _ := json.Marshal(map[string]string{
+		"currency":  tx.Currency,
+		"network":   network,
+		"address":   address,
+		"amount":    tx.Amount.String(),
+		"reference": tx.ID,
+	})
+
+	req, err := http.NewRequest(http.MethodPost, p.baseURL+"/send", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("crypto send failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		TxHash string `json:"tx_hash"`
+		Error  string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	// Only a 4xx is a refusal; a 5xx or a success without hash may still have been sent
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		return nil, rejectWithdrawal("crypto send rejected (status %d): %s", resp.StatusCode, result.Error)
+	}
+	if resp.StatusCode >= 300 || result.TxHash == "" {
+		return nil, fmt.Errorf("crypto send unconfirmed (status %d): %s", resp.StatusCode, result.Error)
+	}
+
+	return &WithdrawalSubmission{
+		ExternalRef:   result.TxHash,
+		Status:        WithdrawalProcessing,
+		EstimatedTime: fmt.Sprintf("%d network confirmations", p.requiredConfirmations),
+		Details:       gin.H{"tx_hash": result.TxHash, "network": network, "address": address},
+	}, nil
+}
+
+func (p *CryptoWithdrawalProcessor) Lookup(reference string) (*WithdrawalSubmission, error) {
+	req, err := http.NewRequest(http.MethodGet, p.baseURL+"/sends/"+reference, nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("crypto send lookup returned %d", resp.StatusCode)
+	}
+
+	var result struct {
+		TxHash string `json:"tx_hash"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if result.TxHash == "" {
+		return nil, fmt.Errorf("crypto send lookup returned no tx_hash")
+	}
+	return &WithdrawalSubmission{ExternalRef: result.TxHash, Status: WithdrawalProcessing}, nil
+}
+
+func (p *CryptoWithdrawalProcessor) CheckStatus(externalRef string) (*WithdrawalStatus, error) {
+	req, err := http.NewRequest(http.MethodGet, p.baseURL+"/transactions/"+externalRef, nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("crypto status check returned %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Confirmations int    `json:"confirmations"`
+		Failed        bool   `json:"failed"`
+		Reason        string `json:"reason"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	status := &WithdrawalStatus{Status: WithdrawalProcessing, Confirmations: result.Confirmations}
+	if result.Failed {
+		status.Status = WithdrawalFailed
+		status.Reason = result.Reason
+	} else if result.Confirmations >= p.requiredConfirmations {
+		status.Status = WithdrawalCompleted
+	}
+	return status, nil
+}
+
+// dispatchWithdrawal hands a created withdrawal to its processor. When nothing was sent (no
+// route, or the processor refused it) the locked funds are returned to the user straight away.
+// When the outcome is unknown (timeout, transport error, 5xx) the withdrawal stays PROCESSING with
+// the funds locked, and the monitor reconciles it with the processor by transaction ID.
+func (s *Server) dispatchWithdrawal(tx Transaction, destination map[string]interface{}) (gin.H, int) {
+	processor, err := s.withdrawalRouter.Route(tx.Currency, tx.Method)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errWithdrawalRailUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		return s.failWithdrawalDispatch(tx, err), status
+	}
+
+	submission, err := processor.Submit(tx, destination)
+	if err != nil && isWithdrawalRejection(err) {
+		return s.failWithdrawalDispatch(tx, err), http.StatusBadRequest
+	}
+	if err != nil {
+		log.Printf("⚠️ Withdrawal %s sent to %s processor without confirmation, reconciling: %v", tx.ID, processor.Name(), err)
+		s.db.Exec(`
+			UPDATE transactions
+			SET status = 'PROCESSING', withdrawal_processor = $1, notes = $2, updated_at = NOW()
+			WHERE id = $3
+		`, processor.Name(), "Dispatch unconfirmed: "+err.Error(), tx.ID)
+
+		return gin.H{
+			"message":   "Withdrawal submitted, waiting for the processor to confirm it",
+			"processor": processor.Name(),
+			"status":    strings.ToLower(WithdrawalProcessing),
+		}, http.StatusAccepted
+	}
+
+	s.db.Exec(`
+		UPDATE transactions
+		SET external_ref = $1, status = $2, withdrawal_processor = $3, updated_at = NOW()
+		WHERE id = $4
+	`, submission.ExternalRef, submission.Status, processor.Name(), tx.ID)
+
+	log.Printf("💸 Withdrawal %s (%s %s via %s) sent to %s processor, ref %s",
+		tx.ID, tx.Amount.String(), tx.Currency, tx.Method, processor.Name(), submission.ExternalRef)
+
+	response := gin.H{
+		"message":        "Withdrawal initiated",
+		"reference":      submission.ExternalRef,
+		"processor":      processor.Name(),
+		"status":         strings.ToLower(submission.Status),
+		"estimated_time": submission.EstimatedTime,
+	}
+	for key, value := range submission.Details {
+		response[key] = value
+	}
+	return response, http.StatusOK
+}
+
+// failWithdrawalDispatch releases the funds of a withdrawal that was never sent and parks it for replay
+func (s *Server) failWithdrawalDispatch(tx Transaction, cause error) gin.H {
+	log.Printf("❌ Withdrawal %s could not be dispatched: %v", tx.ID, cause)
+	if finalizeErr := s.finalizeWithdrawal(tx.ID, WithdrawalFailed, cause.Error(), 0); finalizeErr != nil {
+		log.Printf("❌ Failed to release funds of withdrawal %s: %v", tx.ID, finalizeErr)
+	}
+	recordDeadLetter(s.db, DeadLetterTransaction, tx.ID, withdrawalDeadLetterPayload(tx), cause, true)
+	return gin.H{"error": cause.Error()}
+}
+
+// finalizeWithdrawal settles a PROCESSING/PENDING withdrawal: the locked amount is burnt on
+// completion and returned to the available balance on failure
+func (s *Server) finalizeWithdrawal(txID, status, reason string, confirmations int) error {
+	dbTx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbTx.Rollback()
+
+	var userID, currency string
+	var amount decimal.Decimal
+	err = dbTx.QueryRow(`
+		SELECT user_id, currency, amount FROM transactions
+		WHERE id = $1 AND transaction_type = 'WITHDRAWAL' AND status IN ('PENDING', 'PROCESSING')
+		FOR UPDATE
+	`, txID).Scan(&userID, &currency, &amount)
+	if err != nil {
+		return err
+	}
+
+	if status == WithdrawalCompleted {
+		_, err = dbTx.Exec(`
+			UPDATE wallets SET locked_balance = GREATEST(0, locked_balance - $1), updated_at = NOW()
+			WHERE user_id = $2 AND currency = $3
+		`, amount, userID, currency)
+	} else {
+		_, err = dbTx.Exec(`
+			UPDATE wallets SET locked_balance = GREATEST(0, locked_balance - $1), balance = balance + $1, updated_at = NOW()
+			WHERE user_id = $2 AND currency = $3
+		`, amount, userID, currency)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = dbTx.Exec(`
+		UPDATE transactions
+		SET status = $1, external_confirmations = $2, notes = NULLIF($3, ''),
+			completed_at = CASE WHEN $1 = 'COMPLETED' THEN NOW() ELSE completed_at END,
+			updated_at = NOW()
+		WHERE id = $4
+	`, status, confirmations, reason, txID)
+	if err != nil {
+		return err
+	}
+
+	if err = dbTx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("🏁 Withdrawal %s %s %s", txID, strings.ToLower(status), reason)
+	return nil
+}
+
+// monitorWithdrawals polls processors for the external confirmation of in-flight withdrawals
+func (s *Server) monitorWithdrawals() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.checkProcessingWithdrawals()
+	}
+}
+
+func (s *Server) checkProcessingWithdrawals() {
+	s.reconcileUnconfirmedWithdrawals()
+
+	rows, err := s.db.Query(`
+		SELECT id, withdrawal_processor, external_ref
+		FROM transactions
+		WHERE transaction_type = 'WITHDRAWAL' AND status = 'PROCESSING'
+			AND withdrawal_processor IS NOT NULL AND external_ref IS NOT NULL
+		ORDER BY created_at ASC
+		LIMIT 100
+	`)
+	if err != nil {
+		log.Printf("Error querying processing withdrawals: %v", err)
+		return
+	}
+
+	type inFlight struct {
+		id, processor, externalRef string
+	}
+	var withdrawals []inFlight
+	for rows.Next() {
+		var w inFlight
+		if err := rows.Scan(&w.id, &w.processor, &w.externalRef); err == nil {
+			withdrawals = append(withdrawals, w)
+		}
+	}
+	rows.Close()
+
+	for _, w := range withdrawals {
+		processor, ok := s.withdrawalRouter.Processor(w.processor)
+		if !ok {
+			continue
+		}
+
+		status, err := processor.CheckStatus(w.externalRef)
+		if err != nil {
+			log.Printf("Error checking withdrawal %s with %s: %v", w.id, w.processor, err)
+			continue
+		}
+
+		switch status.Status {
+		case WithdrawalCompleted, WithdrawalFailed:
+			if err := s.finalizeWithdrawal(w.id, status.Status, status.Reason, status.Confirmations); err != nil {
+				log.Printf("Error finalizing withdrawal %s: %v", w.id, err)
+				continue
+			}
+			if status.Status == WithdrawalFailed {
+				s.recordWithdrawalFailure(w.id, w.processor, w.externalRef, status.Reason)
+			}
+		default:
+			s.db.Exec(`UPDATE transactions SET external_confirmations = $1 WHERE id = $2`, status.Confirmations, w.id)
+		}
+	}
+}
+
+// withdrawalReconcileGrace is how long a processor may take to show a send whose dispatch went
+// unconfirmed before an operator is asked to check it (WITHDRAWAL_RECONCILE_GRACE, default 30m)
+func withdrawalReconcileGrace() time.Duration {
+	if value, err := time.ParseDuration(os.Getenv("WITHDRAWAL_RECONCILE_GRACE")); err == nil && value > 0 {
+		return value
+	}
+	return 30 * time.Minute
+}
+
+// reconcileUnconfirmedWithdrawals asks processors, by transaction ID, about withdrawals whose
+// dispatch went unconfirmed. A send the processor knows gets its reference and is then followed
+// like any other; one it still does not know after the grace period is parked for an operator,
+// who completes or fails it by hand. The funds stay locked until then.
+func (s *Server) reconcileUnconfirmedWithdrawals() {
+	rows, err := s.db.Query(`
+		SELECT t.id, t.withdrawal_processor, t.updated_at < NOW() - $1::interval
+		FROM transactions t
+		WHERE t.transaction_type = 'WITHDRAWAL' AND t.status = 'PROCESSING'
+			AND t.withdrawal_processor IS NOT NULL AND t.external_ref IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM dead_letters d
+				WHERE d.source = 'TRANSACTION' AND d.item_id = t.id::text AND d.status = 'PARKED'
+			)
+		ORDER BY t.created_at ASC
+		LIMIT 100
+	`, fmt.Sprintf("%d seconds", int(withdrawalReconcileGrace().Seconds())))
+	if err != nil {
+		log.Printf("Error querying unconfirmed withdrawals: %v", err)
+		return
+	}
+
+	type unconfirmed struct {
+		id, processor string
+		overdue       bool
+	}
+	var withdrawals []unconfirmed
+	for rows.Next() {
+		var w unconfirmed
+		if err := rows.Scan(&w.id, &w.processor, &w.overdue); err == nil {
+			withdrawals = append(withdrawals, w)
+		}
+	}
+	rows.Close()
+
+	for _, w := range withdrawals {
+		processor, ok := s.withdrawalRouter.Processor(w.processor)
+		if !ok {
+			continue
+		}
+
+		submission, err := processor.Lookup(w.id)
+		if err != nil {
+			log.Printf("Error looking up withdrawal %s with %s: %v", w.id, w.processor, err)
+			continue
+		}
+		if submission != nil {
+			s.db.Exec(`
+				UPDATE transactions SET external_ref = $1, notes = NULL, updated_at = NOW()
+				WHERE id = $2 AND external_ref IS NULL
+			`, submission.ExternalRef, w.id)
+			log.Printf("🔎 Withdrawal %s found at %s processor, ref %s", w.id, w.processor, submission.ExternalRef)
+			continue
+		}
+		if w.overdue {
+			recordDeadLetter(s.db, DeadLetterTransaction, w.id, gin.H{
+				"transaction_id": w.id,
+				"processor":      w.processor,
+			}, fmt.Errorf("%s processor has no record of the withdrawal; check it and complete or fail it manually", w.processor), true)
+		}
+	}
+}
+
+// recordWithdrawalFailure keeps a withdrawal its processor reported as failed for review
+func (s *Server) recordWithdrawalFailure(txID, processor, externalRef, reason string) {
+	recordDeadLetter(s.db, DeadLetterTransaction, txID, gin.H{
+		"transaction_id": txID,
+		"processor":      processor,
+		"external_ref":   externalRef,
+	}, fmt.Errorf("%s processor reported failure: %s", processor, reason), true)
+}
+
+// Admin actions for withdrawals handled by the manual processor
+
+func (s *Server) handleAdminCompleteWithdrawal(c *gin.Context) {
+	s.adminFinalizeWithdrawal(c, WithdrawalCompleted)
+}
+
+func (s *Server) handleAdminFailWithdrawal(c *gin.Context) {
+	s.adminFinalizeWithdrawal(c, WithdrawalFailed)
+}
+
+func (s *Server) adminFinalizeWithdrawal(c *gin.Context, status string) {
+	txID := c.Param("id")
+
+	var req struct {
+		Notes string `json:"notes"`
+	}
+	c.ShouldBindJSON(&req)
+
+	if status == WithdrawalFailed && req.Notes == "" {
+		c.JSON(400, gin.H{"error": "notes are required when failing a withdrawal"})
+		return
+	}
+
+	var previousStatus string
+	s.db.QueryRow(`SELECT status FROM transactions WHERE id::text = $1`, txID).Scan(&previousStatus)
+
+	err := s.finalizeWithdrawal(txID, status, req.Notes, 0)
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "Withdrawal not found or already finalized"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to update withdrawal"})
+		return
+	}
+
+	s.recordAuditChange(c, c.GetString("user_id"), "WITHDRAWAL_"+status, "transaction", txID,
+		map[string]interface{}{"status": previousStatus},
+		map[string]interface{}{"status": status, "notes": req.Notes})
+
+	c.JSON(200, gin.H{
+		"status": "success",
+		"data":   gin.H{"id": txID, "status": status},
+	})
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/shopspring/decimal"
+)
+
+func TestWithdrawalRouting(t *testing.T) {
+	tests := []struct {
+		name          string
+		appEnv        string
+		cryptoURL     string
+		routes        string
+		currency      string
+		method        string
+		wantProcessor string
+		wantErr       error // nil, errWithdrawalRailUnavailable, or errUnsupported for any other error
+	}{
+		{name: "bank goes to manual", currency: "BOB", method: "BANK", wantProcessor: "manual"},
+		{name: "crypto with custody configured", cryptoURL: "http://custody", currency: "USDT", method: "CRYPTO", wantProcessor: "crypto"},
+		{name: "crypto without custody is unavailable", currency: "USDT", method: "CRYPTO", wantErr: errWithdrawalRailUnavailable},
+		{name: "crypto without custody is unavailable in development too", appEnv: "development", currency: "USDT", method: "CRYPTO", wantErr: errWithdrawalRailUnavailable},
+		{name: "mock route ignored in production", appEnv: "production", routes: "USDT:CRYPTO=mock", currency: "USDT", method: "CRYPTO", wantErr: errWithdrawalRailUnavailable},
+		{name: "mock route ignored without APP_ENV", routes: "USDT:CRYPTO=mock", currency: "USDT", method: "CRYPTO", wantErr: errWithdrawalRailUnavailable},
+		{name: "mock route honoured in development", appEnv: "development", routes: "USDT:CRYPTO=mock", currency: "USDT", method: "CRYPTO", wantProcessor: "mock"},
+		{name: "route override", routes: "USD:CRYPTO=crypto", cryptoURL: "http://custody", currency: "usd", method: "crypto", wantProcessor: "crypto"},
+		{name: "unknown processor ignored", routes: "BOB:BANK=paypal", currency: "BOB", method: "BANK", wantProcessor: "manual"},
+		{name: "unsupported route", currency: "BOB", method: "CRYPTO", wantErr: errUnsupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("APP_ENV", tt.appEnv)
+			t.Setenv("CRYPTO_WITHDRAWAL_URL", tt.cryptoURL)
+			t.Setenv("WITHDRAWAL_ROUTES", tt.routes)
+
+			processor, err := NewWithdrawalRouter(&Server{}).Route(tt.currency, tt.method)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("Route() error = %v", err)
+			case tt.wantErr == errUnsupported && (err == nil || errors.Is(err, errWithdrawalRailUnavailable)):
+				t.Fatalf("Route() error = %v, want unsupported route", err)
+			case tt.wantErr == errWithdrawalRailUnavailable && !errors.Is(err, errWithdrawalRailUnavailable):
+				t.Fatalf("Route() error = %v, want %v", err, errWithdrawalRailUnavailable)
+			}
+			if tt.wantProcessor != "" && processor.Name() != tt.wantProcessor {
+				t.Errorf("Route() = %s, want %s", processor.Name(), tt.wantProcessor)
+			}
+		})
+	}
+}
+
+var errUnsupported = errors.New("unsupported")
+
+func TestCryptoSubmitErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		handler      http.HandlerFunc
+		destination  map[string]interface{}
+		wantRejected bool
+	}{
+		{
+			name:         "missing address is refused before sending",
+			destination:  map[string]interface{}{},
+			wantRejected: true,
+		},
+		{
+			name: "4xx is a refusal",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				w.Write([]byte(`{"error":"invalid address"}`))
+			},
+			wantRejected: true,
+		},
+		{
+			name: "5xx may have been sent",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+			},
+		},
+		{
+			name: "success without tx hash may have been sent",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{}`))
+			},
+		},
+		{
+			name: "timeout may have been sent",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(200 * time.Millisecond)
+				w.Write([]byte(`{"tx_hash":"0xabc"}`))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseURL := "http://127.0.0.1:0"
+			if tt.handler != nil {
+				server := httptest.NewServer(tt.handler)
+				defer server.Close()
+				baseURL = server.URL
+			}
+			destination := tt.destination
+			if destination == nil {
+				destination = map[string]interface{}{"address": "TXYZ"}
+			}
+
+			processor := &CryptoWithdrawalProcessor{baseURL: baseURL, requiredConfirmations: 1, httpClient: &http.Client{Timeout: 50 * time.Millisecond}}
+			_, err := processor.Submit(Transaction{ID: "11111111-2222-3333-4444-555555555555", Currency: "USDT", Amount: decimal.NewFromInt(10)}, destination)
+			if err == nil {
+				t.Fatal("Submit() succeeded, want an error")
+			}
+			if got := isWithdrawalRejection(err); got != tt.wantRejected {
+				t.Errorf("isWithdrawalRejection(%v) = %v, want %v", err, got, tt.wantRejected)
+			}
+		})
+	}
+
+	t.Run("connection refused may have been sent", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+		processor := &CryptoWithdrawalProcessor{baseURL: server.URL, httpClient: &http.Client{Timeout: time.Second}}
+		_, err := processor.Submit(Transaction{ID: "11111111-2222-3333-4444-555555555555", Currency: "USDT"}, map[string]interface{}{"address": "TXYZ"})
+		if err == nil || isWithdrawalRejection(err) {
+			t.Errorf("Submit() error = %v, want an unconfirmed send", err)
+		}
+	})
+}
+
+func TestCryptoLookup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sends/known" {
+			w.Write([]byte(`{"tx_hash":"0xabc"}`))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	processor := &CryptoWithdrawalProcessor{baseURL: server.URL, httpClient: server.Client()}
+
+	submission, err := processor.Lookup("known")
+	if err != nil || submission == nil || submission.ExternalRef != "0xabc" {
+		t.Errorf("Lookup(known) = %+v, %v; want ref 0xabc", submission, err)
+	}
+	submission, err = processor.Lookup("unknown")
+	if err != nil || submission != nil {
+		t.Errorf("Lookup(unknown) = %+v, %v; want no record", submission, err)
+	}
+}
+
+// failingProcessor fails every Submit with err
+type failingProcessor struct {
+	MockWithdrawalProcessor
+	err error
+}
+
+func (p *failingProcessor) Name() string { return "failing" }
+
+func (p *failingProcessor) Submit(tx Transaction, destination map[string]interface{}) (*WithdrawalSubmission, error) {
+	return nil, p.err
+}
+
+func newDispatchTestServer(t *testing.T, processor WithdrawalProcessor) (*Server, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	router := &WithdrawalRouter{
+		processors: map[string]WithdrawalProcessor{},
+		routes:     map[string]string{"USDT:CRYPTO": "crypto"},
+	}
+	if processor != nil {
+		router.processors["crypto"] = processor
+	}
+	return &Server{db: db, withdrawalRouter: router}, mock
+}
+
+func expectWithdrawalRefund(mock sqlmock.Sqlmock, tx Transaction) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT user_id, currency, amount FROM transactions`).WithArgs(tx.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "currency", "amount"}).AddRow(tx.UserID, tx.Currency, tx.Amount.String()))
+	mock.ExpectExec(`UPDATE wallets SET locked_balance = GREATEST\(0, locked_balance - \$1\), balance = balance \+ \$1`).
+		WithArgs(tx.Amount, tx.UserID, tx.Currency).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE transactions`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`INSERT INTO dead_letters`).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(DeadLetterRetrying))
+}
+
+func TestDispatchWithdrawalErrorPaths(t *testing.T) {
+	tx := Transaction{
+		ID:       "11111111-2222-3333-4444-555555555555",
+		UserID:   "user-1",
+		Currency: "USDT",
+		Method:   "CRYPTO",
+		Amount:   decimal.NewFromInt(25),
+	}
+
+	t.Run("unconfigured rail refunds with 503", func(t *testing.T) {
+		s, mock := newDispatchTestServer(t, nil)
+		expectWithdrawalRefund(mock, tx)
+
+		_, status := s.dispatchWithdrawal(tx, map[string]interface{}{"address": "TXYZ"})
+		if status != http.StatusServiceUnavailable {
+			t.Errorf("status = %d, want 503", status)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("refusal refunds with 400", func(t *testing.T) {
+		s, mock := newDispatchTestServer(t, &failingProcessor{err: rejectWithdrawal("invalid address")})
+		expectWithdrawalRefund(mock, tx)
+
+		_, status := s.dispatchWithdrawal(tx, map[string]interface{}{"address": "TXYZ"})
+		if status != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", status)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("unconfirmed send stays PROCESSING with the funds locked", func(t *testing.T) {
+		s, mock := newDispatchTestServer(t, &failingProcessor{err: errors.New("context deadline exceeded")})
+		mock.ExpectExec(`UPDATE transactions\s+SET status = 'PROCESSING', withdrawal_processor = \$1`).
+			WithArgs("failing", sqlmock.AnyArg(), tx.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		response, status := s.dispatchWithdrawal(tx, map[string]interface{}{"address": "TXYZ"})
+		if status != http.StatusAccepted {
+			t.Errorf("status = %d, want 202", status)
+		}
+		if response["status"] != "processing" {
+			t.Errorf("response status = %v, want processing", response["status"])
+		}
+		// No refund and no dead letter: any unexpected query fails the mock
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestReconcileUnconfirmedWithdrawals(t *testing.T) {
+	s, mock := newDispatchTestServer(t, nil)
+	s.withdrawalRouter.processors["mock"] = &MockWithdrawalProcessor{}
+
+	mock.ExpectQuery(`SELECT t.id, t.withdrawal_processor`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "withdrawal_processor", "overdue"}).
+			AddRow("11111111-2222-3333-4444-555555555555", "mock", false))
+	mock.ExpectExec(`UPDATE transactions SET external_ref = \$1`).
+		WithArgs("MOCK-11111111", "11111111-2222-3333-4444-555555555555").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	s.reconcileUnconfirmedWithdrawals()
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
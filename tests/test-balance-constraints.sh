@@ -0,0 +1,45 @@
+#!/bin/bash
+
+echo "🧪 Balance Constraints Test"
+echo "==========================="
+
+# Colors
+GREEN='\033[0;32m'
+RED='\033[0;31m'
+NC='\033[0m' # No Color
+
+FAILED=0
+
+# Every write runs in a transaction that is rolled back, so the database is left untouched
+expect_rejected() {
+    local description=$1
+    local sql=$2
+    local output
+    output=$(docker exec -i p2p-postgres psql -U p2padmin -d p2p_bolivia -v ON_ERROR_STOP=1 <<SQL 2>&1
+BEGIN;
+$sql;
+ROLLBACK;
+SQL
+)
+    if echo "$output" | grep -q "violates check constraint"; then
+        echo -e "${GREEN}✅ $description is rejected${NC}"
+    else
+        echo -e "${RED}❌ $description was accepted: $output${NC}"
+        FAILED=1
+    fi
+}
+
+EMAIL="constraint-test-$(date +%s%N)@test.com"
+NEW_USER="INSERT INTO users (email, password_hash, is_cashier) VALUES ('$EMAIL', 'x', true) RETURNING id"
+
+expect_rejected "Negative wallet balance" \
+    "WITH u AS ($NEW_USER) INSERT INTO wallets (user_id, currency, balance) SELECT id, 'BOB', -0.01 FROM u"
+expect_rejected "Negative wallet locked balance" \
+    "WITH u AS ($NEW_USER) INSERT INTO wallets (user_id, currency, locked_balance) SELECT id, 'BOB', -0.01 FROM u"
+
+for column in cashier_balance_usd cashier_locked_usd cashier_balance_bob cashier_locked_bob cashier_balance_usdt cashier_locked_usdt; do
+    expect_rejected "Negative $column" \
+        "INSERT INTO users (email, password_hash, is_cashier, $column) VALUES ('$EMAIL', 'x', true, -0.01)"
+done
+
+exit $FAILED